@@ -21,6 +21,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math/big"
+	"sort"
 
 	pb "github.com/google/go-sev-guest/proto/sevsnp"
 	"github.com/google/logger"
@@ -118,8 +119,15 @@ const (
 	// ExtraPlatformInfoGUID represents more information about the machine collecting an attestation
 	// report than just the report to help interpret the attestation report.
 	ExtraPlatformInfoGUID = "ecae0c0f-9502-43b1-afa2-0ae2e0d565b6"
+	// HclRuntimeDataGUID identifies the runtime data claims that an Azure confidential VM's
+	// paravisor (HCL) binds into REPORT_DATA. Quotes obtained through the HCL carry them in the
+	// certificate table so that the report data can be checked against the caller's nonce.
+	HclRuntimeDataGUID = "8da2e190-0d5d-4d5f-8f46-5b2b0a8fd1c2"
 	// ExtraPlatformInfoV0Size is the minimum size for an ExtraPlatformInfo blob.
 	ExtraPlatformInfoV0Size = 8
+	// ExtraPlatformInfoV1Size is the size for an ExtraPlatformInfo blob that also describes how the
+	// quote was obtained.
+	ExtraPlatformInfoV1Size = 20
 
 	// CpuidProductMask keeps only the SevProduct-relevant bits from the CPUID(1).EAX result.
 	CpuidProductMask    = 0x0fff0fff
@@ -317,6 +325,34 @@ func ParseSnpPlatformInfo(platformInfo uint64) (SnpPlatformInfo, error) {
 	return result, nil
 }
 
+// SnpPlatformInfoToBytes translates a structural representation of platform info to its ABI
+// format.
+func SnpPlatformInfoToBytes(info SnpPlatformInfo) uint64 {
+	var result uint64
+	if info.SMTEnabled {
+		result |= 1 << 0
+	}
+	if info.TSMEEnabled {
+		result |= 1 << 1
+	}
+	if info.ECCEnabled {
+		result |= 1 << 2
+	}
+	if info.RAPLDisabled {
+		result |= 1 << 3
+	}
+	if info.CiphertextHidingDRAMEnabled {
+		result |= 1 << 4
+	}
+	if info.AliasCheckComplete {
+		result |= 1 << 5
+	}
+	if info.TIOEnabled {
+		result |= 1 << 7
+	}
+	return result
+}
+
 // ParseAskCert returns a struct representation of the AMD certificate format from a byte array.
 func ParseAskCert(data []byte) (*AskCert, int, error) {
 	var cert AskCert
@@ -389,15 +425,26 @@ func mbz64(data uint64, base string, hi, lo int) error {
 	return nil
 }
 
+// checkRawReportSize returns an error if report is not exactly ReportSize bytes.
+func checkRawReportSize(report []byte) error {
+	if len(report) < ReportSize {
+		return fmt.Errorf("%w: %d bytes, want %d", ErrReportTooShort, len(report), ReportSize)
+	}
+	if len(report) != ReportSize {
+		return fmt.Errorf("incorrect report size: %d bytes, want %d", len(report), ReportSize)
+	}
+	return nil
+}
+
 // ReportToSignatureDER returns the signature component of an attestation report in DER format for
 // use in x509 verification.
 func ReportToSignatureDER(report []byte) ([]byte, error) {
-	if len(report) != ReportSize {
-		return nil, fmt.Errorf("incorrect report size: %x, want %x", len(report), ReportSize)
+	if err := checkRawReportSize(report); err != nil {
+		return nil, err
 	}
 	algo := SignatureAlgo(report)
 	if algo != SignEcdsaP384Sha384 {
-		return nil, fmt.Errorf("unknown signature algorithm: %d", algo)
+		return nil, fmt.Errorf("%w: %d", ErrBadSignatureAlgo, algo)
 	}
 	signature := report[signatureOffset:ReportSize]
 	var b cryptobyte.Builder
@@ -506,16 +553,45 @@ func ComposeSignerInfo(signerInfo SignerInfo) uint32 {
 // ReportSignerInfo returns the signer info component of a SEV-SNP raw report.
 func ReportSignerInfo(data []byte) (uint32, error) {
 	if len(data) < 0x4C {
-		return 0, fmt.Errorf("report too small: %d", len(data))
+		return 0, fmt.Errorf("%w: %d bytes", ErrReportTooShort, len(data))
 	}
 	return binary.LittleEndian.Uint32(data[0x48:0x4C]), nil
 }
 
+// String returns a SignerInfo string rendering.
+func (s SignerInfo) String() string {
+	return fmt.Sprintf("{SigningKey: %v, MaskChipKey: %t, AuthorKeyEn: %t}", s.SigningKey, s.MaskChipKey, s.AuthorKeyEn)
+}
+
+// Compose returns the uint32 encoding of the signer info for the attestation report byte range
+// 0x48:0x4C.
+func (s SignerInfo) Compose() uint32 {
+	return ComposeSignerInfo(s)
+}
+
+// ParseReportSignerInfo returns the interpreted signer info component of a SEV-SNP raw report.
+func ParseReportSignerInfo(data []byte) (SignerInfo, error) {
+	info, err := ReportSignerInfo(data)
+	if err != nil {
+		return SignerInfo{}, err
+	}
+	return ParseSignerInfo(info)
+}
+
+// ProtoSignerInfo returns the interpreted signer info component of a SEV-SNP report proto.
+func ProtoSignerInfo(report *pb.Report) (SignerInfo, error) {
+	if report == nil {
+		return SignerInfo{}, fmt.Errorf("report cannot be nil")
+	}
+	return ParseSignerInfo(report.GetSignerInfo())
+}
+
 // ReportToProto creates a pb.Report from the little-endian AMD SEV-SNP attestation report byte
 // array in SEV SNP ABI format for ATTESTATION_REPORT.
 func ReportToProto(data []uint8) (*pb.Report, error) {
 	if len(data) < ReportSize {
-		return nil, fmt.Errorf("array size is 0x%x, an SEV-SNP attestation report size is 0x%x", len(data), ReportSize)
+		return nil, fmt.Errorf("%w: array size is 0x%x, an SEV-SNP attestation report size is 0x%x",
+			ErrReportTooShort, len(data), ReportSize)
 	}
 
 	r := &pb.Report{}
@@ -609,6 +685,17 @@ func ReportCertsToProto(data []uint8) (*pb.Attestation, error) {
 	return &pb.Attestation{Report: mreport, CertificateChain: table.Proto()}, nil
 }
 
+// AttestationToAbiBytes translates the attestation back into the report's ABI format followed by
+// the certificate table, as ReportCertsToProto expects. The table is empty if the attestation has
+// no certificates.
+func AttestationToAbiBytes(attestation *pb.Attestation) ([]byte, error) {
+	report, err := ReportToAbiBytes(attestation.GetReport())
+	if err != nil {
+		return nil, err
+	}
+	return append(report, CertsFromProto(attestation.GetCertificateChain()).Marshal()...), nil
+}
+
 func checkReportSizes(r *pb.Report) error {
 	if len(r.FamilyId) != FamilyIDSize {
 		return fmt.Errorf("report family_id length is %d, expect %d", len(r.FamilyId), FamilyIDSize)
@@ -650,12 +737,13 @@ func checkReportSizes(r *pb.Report) error {
 // attestation report data.
 func ValidateReportFormat(r []byte) error {
 	if len(r) < ReportSize {
-		return fmt.Errorf("report size is %d bytes. Expected %d bytes", len(r), ReportSize)
+		return fmt.Errorf("%w: report size is %d bytes. Expected %d bytes", ErrReportTooShort, len(r), ReportSize)
 	}
 
 	version := binary.LittleEndian.Uint32(r[0x00:0x04])
 	if version < MinSupportedReportVersion || version > MaxSupportedReportVersion {
-		return fmt.Errorf("report version is: %d. Expected between %d and %d", version, MinSupportedReportVersion, MaxSupportedReportVersion)
+		return fmt.Errorf("%w: report version is: %d. Expected between %d and %d", ErrUnsupportedVersion,
+			version, MinSupportedReportVersion, MaxSupportedReportVersion)
 	}
 
 	policy := binary.LittleEndian.Uint64(r[0x08:0x10])
@@ -786,8 +874,8 @@ func AmdBigInt(b []byte) *big.Int {
 // SetSignature sets the signature component the SnpAttestationReport with the specified
 // representation of the R, S components of an ECDSA signature. Useful for testing.
 func SetSignature(r, s *big.Int, report []byte) error {
-	if len(report) != ReportSize {
-		return fmt.Errorf("unexpected report size: %x, want %x", len(report), ReportSize)
+	if err := checkRawReportSize(report); err != nil {
+		return err
 	}
 	signature := report[signatureOffset:ReportSize]
 	copy(ecdsaGetR(signature), bigIntToAMDRS(r))
@@ -832,7 +920,7 @@ func ParseSnpCertTableHeader(certs []byte) ([]CertTableHeaderEntry, error) {
 	for {
 		var next CertTableHeaderEntry
 		if err := next.Unmarshal(slice); err != nil {
-			return nil, fmt.Errorf("cert table index %d entry unmarshalling error: %v", index, err)
+			return nil, fmt.Errorf("%w: index %d entry unmarshalling error: %v", ErrMalformedCertTable, index, err)
 		}
 
 		slice = slice[CertTableEntrySize:]
@@ -848,8 +936,8 @@ func ParseSnpCertTableHeader(certs []byte) ([]CertTableHeaderEntry, error) {
 	// Double-check that each offset is after the header.
 	for i, entry := range entries {
 		if entry.Offset < uint32(index) {
-			return nil, fmt.Errorf("cert table entry %d has invalid offset into header (size %d): %d",
-				i, entry.Offset, index)
+			return nil, fmt.Errorf("%w: entry %d has invalid offset into header (size %d): %d",
+				ErrMalformedCertTable, i, index, entry.Offset)
 		}
 	}
 	return entries, nil
@@ -865,8 +953,9 @@ func (c *CertTable) Unmarshal(certs []byte) error {
 	for i, entry := range certTableHeader {
 		var next CertTableEntry
 		copy(next.GUID[:], entry.GUID[:])
-		if entry.Offset+entry.Length > uint32(len(certs)) {
-			return fmt.Errorf("cert table entry %d specifies a byte range outside the certificate data block (size %d): offset=%d, length%d", i, len(certs), entry.Offset, entry.Length)
+		if uint64(entry.Offset)+uint64(entry.Length) > uint64(len(certs)) {
+			return fmt.Errorf("%w: entry %d specifies a byte range outside the certificate data block (size %d): offset=%d, length=%d",
+				ErrMalformedCertTable, i, len(certs), entry.Offset, entry.Length)
 		}
 		next.RawCert = make([]byte, entry.Length)
 		copy(next.RawCert, certs[entry.Offset:entry.Offset+entry.Length])
@@ -890,7 +979,48 @@ func (c *CertTable) GetByGUIDString(guid string) ([]byte, error) {
 	return nil, fmt.Errorf("cert not found for GUID %s", guid)
 }
 
-// CertsFromProto returns the CertTable represented in the given certificate chain.
+// Add sets the certificate for the given GUID string. An existing entry with the same GUID is
+// replaced in place, so that the table never contains duplicate GUIDs. Returns the table to allow
+// chaining calls when building a table.
+func (c *CertTable) Add(guid string, cert []byte) (*CertTable, error) {
+	g, err := uuid.Parse(guid)
+	if err != nil {
+		return c, fmt.Errorf("invalid cert table GUID %q: %v", guid, err)
+	}
+	c.AddEntry(CertTableEntry{GUID: g, RawCert: cert})
+	return c, nil
+}
+
+// AddEntry sets the given entry in the table, replacing any entry with the same GUID.
+func (c *CertTable) AddEntry(entry CertTableEntry) {
+	for i := range c.Entries {
+		if c.Entries[i].GUID == entry.GUID {
+			c.Entries[i].RawCert = entry.RawCert
+			return
+		}
+	}
+	c.Entries = append(c.Entries, entry)
+}
+
+// Remove deletes the entry for the given GUID string from the table. Returns whether an entry was
+// removed.
+func (c *CertTable) Remove(guid string) bool {
+	g, err := uuid.Parse(guid)
+	if err != nil {
+		return false
+	}
+	for i, entry := range c.Entries {
+		if entry.GUID == g {
+			c.Entries = append(c.Entries[:i], c.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// CertsFromProto returns the CertTable represented in the given certificate chain. Entries are in
+// ARK, ASK, VCEK, VLEK order followed by the extras in GUID order, so a table in that order
+// round-trips through Proto byte for byte.
 func CertsFromProto(chain *pb.CertificateChain) *CertTable {
 	c := &CertTable{}
 	if len(chain.GetArkCert()) != 0 {
@@ -909,9 +1039,14 @@ func CertsFromProto(chain *pb.CertificateChain) *CertTable {
 		c.Entries = append(c.Entries,
 			CertTableEntry{GUID: uuid.MustParse(VlekGUID), RawCert: chain.GetVlekCert()})
 	}
-	for guid, cert := range chain.GetExtras() {
+	guids := make([]string, 0, len(chain.GetExtras()))
+	for guid := range chain.GetExtras() {
+		guids = append(guids, guid)
+	}
+	sort.Strings(guids)
+	for _, guid := range guids {
 		c.Entries = append(c.Entries,
-			CertTableEntry{GUID: uuid.MustParse(guid), RawCert: cert})
+			CertTableEntry{GUID: uuid.MustParse(guid), RawCert: chain.GetExtras()[guid]})
 	}
 	return c
 }
@@ -1093,6 +1228,17 @@ func MakeExtraPlatformInfo() *ExtraPlatformInfo {
 	}
 }
 
+// MakeExtraPlatformInfoV1 returns MakeExtraPlatformInfo's platform info extended with a
+// description of how the quote was obtained, to help debug attestation failures.
+func MakeExtraPlatformInfoV1(provider QuoteProviderKind, vmpl, driverVersion uint32) *ExtraPlatformInfo {
+	info := MakeExtraPlatformInfo()
+	info.Size = ExtraPlatformInfoV1Size
+	info.Provider = provider
+	info.Vmpl = vmpl
+	info.DriverVersion = driverVersion
+	return info
+}
+
 // DefaultSevProduct returns the initial product version for a commercially available AMD SEV-SNP chip.
 func DefaultSevProduct() *pb.SevProduct {
 	return &pb.SevProduct{
@@ -1106,6 +1252,40 @@ func DefaultSevProduct() *pb.SevProduct {
 type ExtraPlatformInfo struct {
 	Size      uint32 // Size doubles as Version, following the Linux ABI expansion methodology.
 	Cpuid1Eax uint32 // Provides product information
+	// The following fields are only present when Size >= ExtraPlatformInfoV1Size.
+	Provider      QuoteProviderKind // The guest interface that produced the quote.
+	Vmpl          uint32            // The VMPL the report was requested and generated at.
+	DriverVersion uint32            // The guest kernel version in KERNEL_VERSION(a,b,c) encoding.
+}
+
+// QuoteProviderKind identifies the guest interface through which a quote was obtained.
+type QuoteProviderKind uint32
+
+const (
+	// QuoteProviderUnknown means the quote provider was not recorded.
+	QuoteProviderUnknown QuoteProviderKind = iota
+	// QuoteProviderIoctl is the /dev/sev-guest ioctl interface.
+	QuoteProviderIoctl
+	// QuoteProviderConfigfsTsm is the configfs-tsm report interface.
+	QuoteProviderConfigfsTsm
+	// QuoteProviderAzureHcl is the Azure confidential VM paravisor's vTPM interface.
+	QuoteProviderAzureHcl
+)
+
+// String returns a human-readable name for the quote provider kind.
+func (k QuoteProviderKind) String() string {
+	switch k {
+	case QuoteProviderUnknown:
+		return "unknown"
+	case QuoteProviderIoctl:
+		return "ioctl"
+	case QuoteProviderConfigfsTsm:
+		return "configfs-tsm"
+	case QuoteProviderAzureHcl:
+		return "azure-hcl"
+	default:
+		return fmt.Sprintf("QuoteProviderKind(%d)", uint32(k))
+	}
 }
 
 // ParseExtraPlatformInfo extracts an ExtraPlatformInfo from a blob if it matches expectations, or
@@ -1123,17 +1303,33 @@ func ParseExtraPlatformInfo(data []byte) (*ExtraPlatformInfo, error) {
 	if uint32(len(data)) != result.Size {
 		return nil, fmt.Errorf("actual size %d bytes != reported size %d bytes", len(data), result.Size)
 	}
+	if result.Size == ExtraPlatformInfoV0Size {
+		return result, nil
+	}
+	// Later versions only append fields, so sizes beyond V1 still parse as V1.
+	if result.Size < ExtraPlatformInfoV1Size {
+		return nil, fmt.Errorf("%d bytes is between ExtraPlatformInfo versions. Want %d or >= %d bytes",
+			result.Size, ExtraPlatformInfoV0Size, ExtraPlatformInfoV1Size)
+	}
+	result.Provider = QuoteProviderKind(binary.LittleEndian.Uint32(data[0x08:0x0C]))
+	result.Vmpl = binary.LittleEndian.Uint32(data[0x0C:0x10])
+	result.DriverVersion = binary.LittleEndian.Uint32(data[0x10:0x14])
 	return result, nil
 }
 
 // Marshal returns ExtraPlatformInfo in its ABI format or errors.
 func (i *ExtraPlatformInfo) Marshal() ([]byte, error) {
-	if i.Size != ExtraPlatformInfoV0Size {
+	if i.Size != ExtraPlatformInfoV0Size && i.Size != ExtraPlatformInfoV1Size {
 		return nil, fmt.Errorf("unsupported ExtraPlatformInfo size %d bytes", i.Size)
 	}
-	data := make([]byte, ExtraPlatformInfoV0Size)
+	data := make([]byte, i.Size)
 	binary.LittleEndian.PutUint32(data[0:0x04], i.Size)
 	binary.LittleEndian.PutUint32(data[0x04:0x08], i.Cpuid1Eax)
+	if i.Size == ExtraPlatformInfoV1Size {
+		binary.LittleEndian.PutUint32(data[0x08:0x0C], uint32(i.Provider))
+		binary.LittleEndian.PutUint32(data[0x0C:0x10], i.Vmpl)
+		binary.LittleEndian.PutUint32(data[0x10:0x14], i.DriverVersion)
+	}
 	return data, nil
 }
 
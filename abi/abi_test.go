@@ -16,7 +16,9 @@ package abi
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/rand"
 	"runtime"
@@ -201,6 +203,73 @@ func TestReportMbz(t *testing.T) {
 	}
 }
 
+func TestReportAbiRoundTrip(t *testing.T) {
+	reportProto := &spb.Report{}
+	if err := prototext.Unmarshal([]byte(emptyReportV3), reportProto); err != nil {
+		t.Fatalf("test failure: %v", err)
+	}
+	// Set every field that the ABI format represents.
+	reportProto.GuestSvn = 1
+	reportProto.Policy = 0x3ff0102
+	reportProto.Vmpl = 2
+	reportProto.CurrentTcb = 0xdb18000000000004
+	reportProto.PlatformInfo = 0xbf
+	reportProto.SignerInfo = ComposeSignerInfo(SignerInfo{SigningKey: VlekReportSigner, MaskChipKey: true, AuthorKeyEn: true})
+	for i, field := range [][]byte{reportProto.FamilyId, reportProto.ImageId, reportProto.ReportData,
+		reportProto.Measurement, reportProto.HostData, reportProto.IdKeyDigest, reportProto.AuthorKeyDigest,
+		reportProto.ReportId, reportProto.ReportIdMa, reportProto.ChipId} {
+		for j := range field {
+			field[j] = byte(i + j)
+		}
+	}
+	for j := 0; j < EcdsaP384Sha384SignatureSize; j++ {
+		reportProto.Signature[j] = byte(j)
+	}
+	reportProto.ReportedTcb = 0xdb18000000000003
+	reportProto.Cpuid1EaxFms = FmsToCpuid1Eax(0x19, 0x11, 1)
+	reportProto.CommittedTcb = 0xdb18000000000002
+	reportProto.CurrentBuild, reportProto.CurrentMinor, reportProto.CurrentMajor = 3, 55, 1
+	reportProto.CommittedBuild, reportProto.CommittedMinor, reportProto.CommittedMajor = 2, 54, 1
+	reportProto.LaunchTcb = 0xdb18000000000001
+	reportProto.LaunchMitVector = 0x5
+	reportProto.CurrentMitVector = 0x7
+
+	raw, err := ReportToAbiBytes(reportProto)
+	if err != nil {
+		t.Fatalf("ReportToAbiBytes(%v) = _, %v. Want nil", reportProto, err)
+	}
+	got, err := ReportToProto(raw)
+	if err != nil {
+		t.Fatalf("ReportToProto(%v) = _, %v. Want nil", raw, err)
+	}
+	if diff := cmp.Diff(got, reportProto, protocmp.Transform()); diff != "" {
+		t.Errorf("ReportToProto(ReportToAbiBytes(r)) = %v, want %v: %s", got, reportProto, diff)
+	}
+	again, err := ReportToAbiBytes(got)
+	if err != nil {
+		t.Fatalf("ReportToAbiBytes(%v) = _, %v. Want nil", got, err)
+	}
+	if !bytes.Equal(again, raw) {
+		t.Errorf("ReportToAbiBytes(ReportToProto(raw)) = %v, want %v", again, raw)
+	}
+	if _, err := ParseSnpPolicy(got.Policy); err != nil {
+		t.Fatalf("ParseSnpPolicy(0x%x) = _, %v. Want nil", got.Policy, err)
+	}
+
+	certs := testRawCertTable(t).table
+	attestation, err := ReportCertsToProto(append(append([]byte{}, raw...), certs...))
+	if err != nil {
+		t.Fatalf("ReportCertsToProto(report, certs) = _, %v. Want nil", err)
+	}
+	extended, err := AttestationToAbiBytes(attestation)
+	if err != nil {
+		t.Fatalf("AttestationToAbiBytes(%v) = _, %v. Want nil", attestation, err)
+	}
+	if !bytes.Equal(extended[:ReportSize], raw) || !bytes.Equal(extended[ReportSize:], certs) {
+		t.Errorf("AttestationToAbiBytes(ReportCertsToProto(raw)) = %v, want %v", extended, append(raw, certs...))
+	}
+}
+
 func TestSnpPolicySection(t *testing.T) {
 	entropySize := 128
 	entropy := make([]uint8, entropySize)
@@ -291,6 +360,70 @@ func TestSnpPlatformInfo(t *testing.T) {
 			t.Errorf("ParseSnpPlatformInfo(%x) = %v, want %v", tc.input, got, tc.want)
 		}
 	}
+	for input := uint64(0); input < 1<<(maxPlatformInfoBit+1); input++ {
+		info, err := ParseSnpPlatformInfo(input)
+		if err != nil {
+			continue
+		}
+		if got := SnpPlatformInfoToBytes(info); got != input {
+			t.Errorf("SnpPlatformInfoToBytes(ParseSnpPlatformInfo(0x%x)) = 0x%x, want 0x%x", input, got, input)
+		}
+	}
+}
+
+func TestSignerInfo(t *testing.T) {
+	tests := []struct {
+		input   uint32
+		want    SignerInfo
+		wantErr string
+	}{
+		{
+			input: 0,
+			want:  SignerInfo{SigningKey: VcekReportSigner},
+		},
+		{
+			input: 7,
+			want:  SignerInfo{SigningKey: VlekReportSigner, MaskChipKey: true, AuthorKeyEn: true},
+		},
+		{
+			input: 0x1c,
+			want:  SignerInfo{SigningKey: NoneReportSigner},
+		},
+		{
+			input:   0x8,
+			wantErr: "signing_key values 2-6 are reserved",
+		},
+		{
+			input:   0x20,
+			wantErr: "mbz range data[0x48:0x4C]",
+		},
+	}
+	for _, tc := range tests {
+		raw := make([]byte, ReportSize)
+		binary.LittleEndian.PutUint32(raw[0x48:0x4C], tc.input)
+		for name, parse := range map[string]func() (SignerInfo, error){
+			"ParseSignerInfo":       func() (SignerInfo, error) { return ParseSignerInfo(tc.input) },
+			"ParseReportSignerInfo": func() (SignerInfo, error) { return ParseReportSignerInfo(raw) },
+			"ProtoSignerInfo": func() (SignerInfo, error) {
+				return ProtoSignerInfo(&spb.Report{SignerInfo: tc.input})
+			},
+		} {
+			got, err := parse()
+			if (err != nil && (tc.wantErr == "" || !strings.Contains(err.Error(), tc.wantErr))) ||
+				(err == nil && tc.wantErr != "") {
+				t.Errorf("%s(%x) errored unexpectedly. Got %v, want %v", name, tc.input, err, tc.wantErr)
+			}
+			if err == nil && tc.want != got {
+				t.Errorf("%s(%x) = %v, want %v", name, tc.input, got, tc.want)
+			}
+			if err == nil && got.Compose() != tc.input {
+				t.Errorf("%s(%x).Compose() = %x, want %x", name, tc.input, got.Compose(), tc.input)
+			}
+		}
+	}
+	if _, err := ProtoSignerInfo(nil); err == nil {
+		t.Error("ProtoSignerInfo(nil) = _, nil. Want error")
+	}
 }
 
 func TestCpuid(t *testing.T) {
@@ -391,8 +524,103 @@ func TestCertTableProto(t *testing.T) {
 	if !bytes.Equal(bs, result.table) {
 		t.Errorf("c.Marshal() = %v, want %v", bs, result.table)
 	}
+	if bs := CertsFromProto(p).Marshal(); !bytes.Equal(bs, result.table) {
+		t.Errorf("CertsFromProto(c.Proto()).Marshal() = %v, want %v", bs, result.table)
+	}
+
+	// Extras are in GUID order whatever the map iteration order.
+	p.Extras["ffffffff-0000-c0de-0000-000000000000"] = []byte("last")
+	p.Extras["00000000-0000-0000-0000-000000000000"] = []byte("first")
+	want := CertsFromProto(p).Marshal()
+	for i := 0; i < 10; i++ {
+		table := CertsFromProto(p)
+		if got := table.Marshal(); !bytes.Equal(got, want) {
+			t.Fatalf("CertsFromProto(%v).Marshal() = %v, want %v", p, got, want)
+		}
+		if diff := cmp.Diff(table.Proto(), p, protocmp.Transform()); diff != "" {
+			t.Errorf("CertsFromProto(p).Proto() = %v, want %v: %s", table.Proto(), p, diff)
+		}
+	}
+	if guid := CertsFromProto(p).Entries[4].GUID.String(); guid != "00000000-0000-0000-0000-000000000000" {
+		t.Errorf("CertsFromProto(%v).Entries[4].GUID = %s, want the least extra GUID", p, guid)
+	}
+}
+
+func TestCertTableBuilder(t *testing.T) {
+	want := testRawCertTable(t)
+	c := new(CertTable)
+	for _, entry := range []struct {
+		guid string
+		cert string
+	}{
+		{ArkGUID, "ark"},
+		{AskGUID, "ask"},
+		{VcekGUID, "not the vcek"},
+		{VlekGUID, "vlek"},
+		{extraGUID, "extra"},
+		{VcekGUID, "vcek"}, // Replaces the earlier VCEK entry in place.
+	} {
+		if _, err := c.Add(entry.guid, []byte(entry.cert)); err != nil {
+			t.Fatalf("c.Add(%q, %q) = _, %v. Want nil", entry.guid, entry.cert, err)
+		}
+	}
+	if got := c.Marshal(); !bytes.Equal(got, want.table) {
+		t.Errorf("c.Marshal() = %v, want %v", got, want.table)
+	}
+
+	if !c.Remove(extraGUID) {
+		t.Errorf("c.Remove(%q) = false, want true", extraGUID)
+	}
+	if c.Remove(extraGUID) {
+		t.Errorf("c.Remove(%q) = true after removal, want false", extraGUID)
+	}
+	if _, err := c.GetByGUIDString(extraGUID); err == nil {
+		t.Errorf("c.GetByGUIDString(%q) = _, nil after removal. Want error", extraGUID)
+	}
+	if len(c.Entries) != 4 {
+		t.Errorf("len(c.Entries) = %d after removal, want 4", len(c.Entries))
+	}
+	if _, err := c.Add("not a guid", nil); err == nil {
+		t.Error("c.Add(\"not a guid\", nil) = _, nil. Want error")
+	}
 }
 
+func TestParseErrorClasses(t *testing.T) {
+	report := make([]byte, ReportSize)
+	binary.LittleEndian.PutUint32(report[0x00:0x04], 2)
+	binary.LittleEndian.PutUint64(report[0x08:0x10], 1<<policyReserved1bit)
+	badVersion := clone(report)
+	binary.LittleEndian.PutUint32(badVersion[0x00:0x04], MaxSupportedReportVersion+1)
+	badTable := make([]byte, 2*CertTableEntrySize)
+	copy(badTable, uuid.MustParse(VcekGUID).NodeID()) // Nonzero GUID, offset inside the header.
+	binary.LittleEndian.PutUint32(badTable[GUIDSize:], 1)
+	tcs := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "ReportToProto short", err: second(ReportToProto(report[:0x100])), want: ErrReportTooShort},
+		{name: "ReportSignerInfo short", err: second(ReportSignerInfo(report[:4])), want: ErrReportTooShort},
+		{name: "ValidateReportFormat short", err: ValidateReportFormat(report[:0x100]), want: ErrReportTooShort},
+		{name: "ValidateReportFormat version", err: ValidateReportFormat(badVersion), want: ErrUnsupportedVersion},
+		{name: "ReportToSignatureDER algo", err: second(ReportToSignatureDER(report)), want: ErrBadSignatureAlgo},
+		{name: "cert table offset", err: new(CertTable).Unmarshal(badTable), want: ErrMalformedCertTable},
+		{name: "cert table truncated", err: new(CertTable).Unmarshal(badTable[:1]), want: ErrMalformedCertTable},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if !errors.Is(tc.err, tc.want) {
+				t.Errorf("got error %v, want errors.Is(_, %v)", tc.err, tc.want)
+			}
+		})
+	}
+	if err := ValidateReportFormat(report); err != nil {
+		t.Errorf("ValidateReportFormat() = %v. Want nil", err)
+	}
+}
+
+func second[T any](_ T, err error) error { return err }
+
 func TestSevProduct(t *testing.T) {
 	oldCpuid := cpuid
 	defer func() { cpuid = oldCpuid }()
@@ -536,3 +764,49 @@ func TestExtendedPlatformCertTable(t *testing.T) {
 		})
 	}
 }
+
+func TestExtraPlatformInfoVersions(t *testing.T) {
+	v1 := &ExtraPlatformInfo{
+		Size:          ExtraPlatformInfoV1Size,
+		Cpuid1Eax:     0x00a00f11,
+		Provider:      QuoteProviderConfigfsTsm,
+		Vmpl:          2,
+		DriverVersion: 0x060800,
+	}
+	blob, err := v1.Marshal()
+	if err != nil {
+		t.Fatalf("%v.Marshal() = _, %v. Want nil", v1, err)
+	}
+	got, err := ParseExtraPlatformInfo(blob)
+	if err != nil {
+		t.Fatalf("ParseExtraPlatformInfo(%v) = _, %v. Want nil", blob, err)
+	}
+	if diff := cmp.Diff(got, v1); diff != "" {
+		t.Errorf("ParseExtraPlatformInfo(%v) = %v, want %v: %s", blob, got, v1, diff)
+	}
+	if got.Provider.String() != "configfs-tsm" {
+		t.Errorf("Provider.String() = %q, want %q", got.Provider.String(), "configfs-tsm")
+	}
+
+	// A future version appends fields, and its V1 prefix must still be interpreted.
+	future := append(clone(blob), 0xff, 0xff, 0xff, 0xff)
+	binary.LittleEndian.PutUint32(future[0:4], uint32(len(future)))
+	if got, err := ParseExtraPlatformInfo(future); err != nil || got.Vmpl != 2 || got.Provider != QuoteProviderConfigfsTsm {
+		t.Errorf("ParseExtraPlatformInfo(future) = %v, %v. Want V1 fields", got, err)
+	}
+
+	v0 := &ExtraPlatformInfo{Size: ExtraPlatformInfoV0Size, Cpuid1Eax: 0x00a00f11}
+	blob, err = v0.Marshal()
+	if err != nil {
+		t.Fatalf("%v.Marshal() = _, %v. Want nil", v0, err)
+	}
+	if got, err := ParseExtraPlatformInfo(blob); err != nil || got.Provider != QuoteProviderUnknown {
+		t.Errorf("ParseExtraPlatformInfo(v0) = %v, %v. Want unknown provider", got, err)
+	}
+
+	between := make([]byte, 12)
+	binary.LittleEndian.PutUint32(between[0:4], 12)
+	if _, err := ParseExtraPlatformInfo(between); err == nil {
+		t.Error("ParseExtraPlatformInfo(12 bytes) = _, nil. Want error")
+	}
+}
@@ -88,87 +88,104 @@ const (
 	// rbModeExited = 31
 	// Kernel error, unexpected.
 	// rmpInitRequired = 32
-	// Platform management error, unexpected.
-	// badSvn = 33
-	// Platform management error, unexpected.
-	// badVersion = 34
-	// Platform management error, unexpected.
-	// shutdownRequired = 35
-	// Platform management error, unexpected.
-	// updateFailed = 36
-	// Platform management error, unexpected.
-	// restoreRequired = 37
+	// BadSvn is the code for when a firmware image's SVN is lower than the committed SVN.
+	BadSvn = 33
+	// BadVersion is the code for when a firmware image's version is incompatible.
+	BadVersion = 34
+	// ShutdownRequired is the code for when the platform must be shut down before the command.
+	ShutdownRequired = 35
+	// UpdateFailed is the code for when a firmware update did not complete.
+	UpdateFailed = 36
+	// RestoreRequired is the code for when the platform must be restored before the command.
+	RestoreRequired = 37
 )
 
 // GuestRequestInvalidLength is set by the ccp driver and not the AMD-SP when an guest extended
 // request provides too few pages for the firmware to populate with data.
 const GuestRequestInvalidLength SevFirmwareStatus = 0x100000000
 
+// GuestRequestVmmBusy is set by the ccp driver and not the AMD-SP when the hypervisor declined to
+// forward a guest request because the guest exceeded its request rate limit.
+const GuestRequestVmmBusy SevFirmwareStatus = 0x200000000
+
+var firmwareStatusDescriptions = map[SevFirmwareStatus]string{
+	Success:                   "success",
+	InvalidPlatformState:      "platform state is invalid for this command",
+	InvalidGuestState:         "guest state is invalid for this command",
+	InvalidLength:             "memory buffer is too small (library bug, please report)",
+	PolicyFailure:             "request is not allowed by guest policy",
+	Inactive:                  "guest is inactive",
+	InvalidAddress:            "address provided is invalid (library bug, please report)",
+	InvalidCommand:            "invalid command (library bug, please report)",
+	HwErrorPlatform:           "hardware condition has occurred affecting the platform (report to sysadmin)",
+	HwErrorUnsafe:             "hardware condition has occurred affecting the platform. Buffers unsafe (report to sysadmin)",
+	Unsupported:               "unsupported feature",
+	InvalidParam:              "invalid parameter (library bug, please report)",
+	ResourceLimit:             "SEV firmware has run out of recources necessary to complete the command",
+	SecureDataInvalid:         "part-specific SEV data failed integrity checks (report to sysadmin)",
+	InvalidPageSize:           "RMP: invalid page size",
+	InvalidPageState:          "RMP: invalid page state",
+	InvalidMdataEntry:         "RMP: invalid recorded metadata",
+	InvalidPageOwner:          "RMP: ASID mismatch between accessors",
+	AeadOflow:                 "AMD-SP firmware memory would be over capacity for AEAD use",
+	BadSvn:                    "firmware SVN is lower than the committed SVN",
+	BadVersion:                "firmware version is incompatible",
+	ShutdownRequired:          "platform must be shut down first",
+	UpdateFailed:              "firmware update failed",
+	RestoreRequired:           "platform must be restored first",
+	GuestRequestInvalidLength: "too few extended guest request data pages",
+	GuestRequestVmmBusy:       "hypervisor is busy (guest request throttled)",
+}
+
+var firmwareStatusHints = map[SevFirmwareStatus]string{
+	InvalidPlatformState:      "the host's SEV firmware is not initialized for SNP guests; contact the host operator",
+	InvalidGuestState:         "the guest was not launched as expected by the firmware; relaunch the VM",
+	PolicyFailure:             "launch the guest with a policy that permits the request, e.g., debug or migration",
+	HwErrorPlatform:           "retry later and report persistent failures to the host operator",
+	HwErrorUnsafe:             "do not trust output buffers; report to the host operator",
+	Unsupported:               "the firmware does not implement this feature; update the host firmware",
+	ResourceLimit:             "retry later, when the firmware has freed resources",
+	SecureDataInvalid:         "report to the host operator; the part's SEV data is corrupted",
+	BadSvn:                    "install firmware with an SVN at least the committed SVN",
+	BadVersion:                "install a firmware version compatible with the platform",
+	UpdateFailed:              "retry the firmware update or restore the previous firmware",
+	GuestRequestInvalidLength: "query the certificate length and retry with a larger buffer",
+	GuestRequestVmmBusy:       "retry with exponential backoff, e.g., with client.RetryOptions",
+}
+
+// String returns a description of the firmware status.
+func (s SevFirmwareStatus) String() string {
+	if desc, ok := firmwareStatusDescriptions[s]; ok {
+		return desc
+	}
+	return fmt.Sprintf("unexpected firmware status (see SEV API spec): %x", uint64(s))
+}
+
+// Hint returns a suggestion for how to remedy the firmware status, or "" if there is none.
+func (s SevFirmwareStatus) Hint() string {
+	return firmwareStatusHints[s]
+}
+
 // SevFirmwareErr is an error that interprets firmware status codes from the AMD secure processor.
+// It matches any other *SevFirmwareErr with the same Status under errors.Is, so callers may test
+// for a status with, e.g., errors.Is(err, &abi.SevFirmwareErr{Status: abi.InvalidParam}).
 type SevFirmwareErr struct {
 	Status SevFirmwareStatus
+	// Err is the error of the system call that reported the status, if any.
+	Err error
 }
 
 func (e *SevFirmwareErr) Error() string {
-	if e.Status == Success {
-		return "success"
-	}
-	if e.Status == InvalidPlatformState {
-		return "platform state is invalid for this command"
-	}
-	if e.Status == InvalidGuestState {
-		return "guest state is invalid for this command"
-	}
-	if e.Status == InvalidLength {
-		return "memory buffer is too small (library bug, please report)"
-	}
-	if e.Status == PolicyFailure {
-		return "request is not allowed by guest policy"
-	}
-	if e.Status == Inactive {
-		return "guest is inactive"
-	}
-	if e.Status == InvalidAddress {
-		return "address provided is invalid (library bug, please report)"
-	}
-	if e.Status == InvalidCommand {
-		return "invalid command (library bug, please report)"
-	}
-	if e.Status == HwErrorPlatform {
-		return "hardware condition has occurred affecting the platform (report to sysadmin)"
-	}
-	if e.Status == HwErrorUnsafe {
-		return "hardware condition has occurred affecting the platform. Buffers unsafe (report to sysadmin)"
-	}
-	if e.Status == Unsupported {
-		return "unsupported feature"
-	}
-	if e.Status == InvalidParam {
-		return "invalid parameter (library bug, please report)"
-	}
-	if e.Status == ResourceLimit {
-		return "SEV firmware has run out of recources necessary to complete the command"
-	}
-	if e.Status == SecureDataInvalid {
-		return "part-specific SEV data failed integrity checks (report to sysadmin)"
-	}
-	if e.Status == InvalidPageSize {
-		return "RMP: invalid page size"
-	}
-	if e.Status == InvalidPageState {
-		return "RMP: invalid page state"
-	}
-	if e.Status == InvalidMdataEntry {
-		return "RMP: invalid recorded metadata"
-	}
-	if e.Status == InvalidPageOwner {
-		return "RMP: ASID mismatch between accessors"
-	}
-	if e.Status == AeadOflow {
-		return "AMD-SP firmware memory would be over capacity for AEAD use"
-	}
-	if e.Status == GuestRequestInvalidLength {
-		return "too few extended guest request data pages"
-	}
-	return fmt.Sprintf("unexpected firmware status (see SEV API spec): %x", uint64(e.Status))
+	return e.Status.String()
+}
+
+// Unwrap returns the system call error that reported the status.
+func (e *SevFirmwareErr) Unwrap() error {
+	return e.Err
+}
+
+// Is returns whether target is a *SevFirmwareErr with the same status.
+func (e *SevFirmwareErr) Is(target error) bool {
+	t, ok := target.(*SevFirmwareErr)
+	return ok && t.Status == e.Status
 }
@@ -0,0 +1,57 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestSevFirmwareErr(t *testing.T) {
+	err := fmt.Errorf("could not get report: %w", &SevFirmwareErr{Status: UpdateFailed, Err: syscall.EIO})
+	if !errors.Is(err, &SevFirmwareErr{Status: UpdateFailed}) {
+		t.Errorf("errors.Is(%v, UpdateFailed) = false, want true", err)
+	}
+	if errors.Is(err, &SevFirmwareErr{Status: InvalidParam}) {
+		t.Errorf("errors.Is(%v, InvalidParam) = true, want false", err)
+	}
+	if !errors.Is(err, syscall.EIO) {
+		t.Errorf("errors.Is(%v, EIO) = false, want the syscall error to be wrapped", err)
+	}
+	var fwErr *SevFirmwareErr
+	if !errors.As(err, &fwErr) || fwErr.Status != UpdateFailed {
+		t.Errorf("errors.As(%v) = %v, want status %d", err, fwErr, UpdateFailed)
+	}
+	if got := err.Error(); got != "could not get report: firmware update failed" {
+		t.Errorf("Error() = %q, want the status description", got)
+	}
+}
+
+func TestSevFirmwareStatusString(t *testing.T) {
+	if got, want := SevFirmwareStatus(InvalidParam).String(), "invalid parameter (library bug, please report)"; got != want {
+		t.Errorf("InvalidParam.String() = %q, want %q", got, want)
+	}
+	if got, want := SevFirmwareStatus(0x99).String(), "unexpected firmware status (see SEV API spec): 99"; got != want {
+		t.Errorf("SevFirmwareStatus(0x99).String() = %q, want %q", got, want)
+	}
+	if GuestRequestVmmBusy.Hint() == "" {
+		t.Error("GuestRequestVmmBusy.Hint() is empty, want a remediation")
+	}
+	if SevFirmwareStatus(InvalidAddress).Hint() != "" {
+		t.Error("InvalidAddress.Hint() is not empty, want none for library bugs")
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// The CBOR encodings below are maps keyed by the field numbers of the corresponding sevsnp proto
+// messages, so that the two representations evolve together. Encoding is deterministic per
+// RFC 8949 section 4.2 "Core Deterministic Encoding Requirements".
+
+type reportCBOR struct {
+	Version          uint32 `cbor:"1,keyasint,omitempty"`
+	GuestSvn         uint32 `cbor:"2,keyasint,omitempty"`
+	Policy           uint64 `cbor:"3,keyasint,omitempty"`
+	FamilyID         []byte `cbor:"4,keyasint,omitempty"`
+	ImageID          []byte `cbor:"5,keyasint,omitempty"`
+	Vmpl             uint32 `cbor:"6,keyasint,omitempty"`
+	SignatureAlgo    uint32 `cbor:"7,keyasint,omitempty"`
+	CurrentTcb       uint64 `cbor:"8,keyasint,omitempty"`
+	PlatformInfo     uint64 `cbor:"9,keyasint,omitempty"`
+	SignerInfo       uint32 `cbor:"10,keyasint,omitempty"`
+	ReportData       []byte `cbor:"11,keyasint,omitempty"`
+	Measurement      []byte `cbor:"12,keyasint,omitempty"`
+	HostData         []byte `cbor:"13,keyasint,omitempty"`
+	IDKeyDigest      []byte `cbor:"14,keyasint,omitempty"`
+	AuthorKeyDigest  []byte `cbor:"15,keyasint,omitempty"`
+	ReportID         []byte `cbor:"16,keyasint,omitempty"`
+	ReportIDMa       []byte `cbor:"17,keyasint,omitempty"`
+	ReportedTcb      uint64 `cbor:"18,keyasint,omitempty"`
+	ChipID           []byte `cbor:"19,keyasint,omitempty"`
+	CommittedTcb     uint64 `cbor:"20,keyasint,omitempty"`
+	CurrentBuild     uint32 `cbor:"21,keyasint,omitempty"`
+	CurrentMinor     uint32 `cbor:"22,keyasint,omitempty"`
+	CurrentMajor     uint32 `cbor:"23,keyasint,omitempty"`
+	CommittedBuild   uint32 `cbor:"24,keyasint,omitempty"`
+	CommittedMinor   uint32 `cbor:"25,keyasint,omitempty"`
+	CommittedMajor   uint32 `cbor:"26,keyasint,omitempty"`
+	LaunchTcb        uint64 `cbor:"27,keyasint,omitempty"`
+	Signature        []byte `cbor:"28,keyasint,omitempty"`
+	Cpuid1EaxFms     uint32 `cbor:"29,keyasint,omitempty"`
+	LaunchMitVector  uint64 `cbor:"30,keyasint,omitempty"`
+	CurrentMitVector uint64 `cbor:"31,keyasint,omitempty"`
+}
+
+type certificateChainCBOR struct {
+	VcekCert []byte            `cbor:"1,keyasint,omitempty"`
+	AskCert  []byte            `cbor:"2,keyasint,omitempty"`
+	ArkCert  []byte            `cbor:"3,keyasint,omitempty"`
+	VlekCert []byte            `cbor:"6,keyasint,omitempty"`
+	Extras   map[string][]byte `cbor:"7,keyasint,omitempty"`
+}
+
+type sevProductCBOR struct {
+	Name            int32   `cbor:"1,keyasint,omitempty"`
+	MachineStepping *uint32 `cbor:"3,keyasint,omitempty"`
+}
+
+type attestationCBOR struct {
+	Report           *reportCBOR           `cbor:"1,keyasint,omitempty"`
+	CertificateChain *certificateChainCBOR `cbor:"2,keyasint,omitempty"`
+	Product          *sevProductCBOR       `cbor:"3,keyasint,omitempty"`
+}
+
+var cborEncMode cbor.EncMode
+var cborDecMode cbor.DecMode
+
+func init() {
+	var err error
+	cborEncMode, err = cbor.CoreDetEncOptions().EncMode()
+	if err != nil {
+		panic(fmt.Sprintf("could not create CBOR encoding mode: %v", err))
+	}
+	cborDecMode, err = cbor.DecOptions{
+		DupMapKey:   cbor.DupMapKeyEnforcedAPF,
+		IndefLength: cbor.IndefLengthForbidden,
+	}.DecMode()
+	if err != nil {
+		panic(fmt.Sprintf("could not create CBOR decoding mode: %v", err))
+	}
+}
+
+func reportToCBORValue(r *pb.Report) *reportCBOR {
+	return &reportCBOR{
+		Version:          r.GetVersion(),
+		GuestSvn:         r.GetGuestSvn(),
+		Policy:           r.GetPolicy(),
+		FamilyID:         r.GetFamilyId(),
+		ImageID:          r.GetImageId(),
+		Vmpl:             r.GetVmpl(),
+		SignatureAlgo:    r.GetSignatureAlgo(),
+		CurrentTcb:       r.GetCurrentTcb(),
+		PlatformInfo:     r.GetPlatformInfo(),
+		SignerInfo:       r.GetSignerInfo(),
+		ReportData:       r.GetReportData(),
+		Measurement:      r.GetMeasurement(),
+		HostData:         r.GetHostData(),
+		IDKeyDigest:      r.GetIdKeyDigest(),
+		AuthorKeyDigest:  r.GetAuthorKeyDigest(),
+		ReportID:         r.GetReportId(),
+		ReportIDMa:       r.GetReportIdMa(),
+		ReportedTcb:      r.GetReportedTcb(),
+		ChipID:           r.GetChipId(),
+		CommittedTcb:     r.GetCommittedTcb(),
+		CurrentBuild:     r.GetCurrentBuild(),
+		CurrentMinor:     r.GetCurrentMinor(),
+		CurrentMajor:     r.GetCurrentMajor(),
+		CommittedBuild:   r.GetCommittedBuild(),
+		CommittedMinor:   r.GetCommittedMinor(),
+		CommittedMajor:   r.GetCommittedMajor(),
+		LaunchTcb:        r.GetLaunchTcb(),
+		Signature:        r.GetSignature(),
+		Cpuid1EaxFms:     r.GetCpuid1EaxFms(),
+		LaunchMitVector:  r.GetLaunchMitVector(),
+		CurrentMitVector: r.GetCurrentMitVector(),
+	}
+}
+
+func (r *reportCBOR) proto() *pb.Report {
+	return &pb.Report{
+		Version:          r.Version,
+		GuestSvn:         r.GuestSvn,
+		Policy:           r.Policy,
+		FamilyId:         r.FamilyID,
+		ImageId:          r.ImageID,
+		Vmpl:             r.Vmpl,
+		SignatureAlgo:    r.SignatureAlgo,
+		CurrentTcb:       r.CurrentTcb,
+		PlatformInfo:     r.PlatformInfo,
+		SignerInfo:       r.SignerInfo,
+		ReportData:       r.ReportData,
+		Measurement:      r.Measurement,
+		HostData:         r.HostData,
+		IdKeyDigest:      r.IDKeyDigest,
+		AuthorKeyDigest:  r.AuthorKeyDigest,
+		ReportId:         r.ReportID,
+		ReportIdMa:       r.ReportIDMa,
+		ReportedTcb:      r.ReportedTcb,
+		ChipId:           r.ChipID,
+		CommittedTcb:     r.CommittedTcb,
+		CurrentBuild:     r.CurrentBuild,
+		CurrentMinor:     r.CurrentMinor,
+		CurrentMajor:     r.CurrentMajor,
+		CommittedBuild:   r.CommittedBuild,
+		CommittedMinor:   r.CommittedMinor,
+		CommittedMajor:   r.CommittedMajor,
+		LaunchTcb:        r.LaunchTcb,
+		Signature:        r.Signature,
+		Cpuid1EaxFms:     r.Cpuid1EaxFms,
+		LaunchMitVector:  r.LaunchMitVector,
+		CurrentMitVector: r.CurrentMitVector,
+	}
+}
+
+func certificateChainToCBORValue(c *pb.CertificateChain) *certificateChainCBOR {
+	return &certificateChainCBOR{
+		VcekCert: c.GetVcekCert(),
+		AskCert:  c.GetAskCert(),
+		ArkCert:  c.GetArkCert(),
+		VlekCert: c.GetVlekCert(),
+		Extras:   c.GetExtras(),
+	}
+}
+
+func (c *certificateChainCBOR) proto() *pb.CertificateChain {
+	return &pb.CertificateChain{
+		VcekCert: c.VcekCert,
+		AskCert:  c.AskCert,
+		ArkCert:  c.ArkCert,
+		VlekCert: c.VlekCert,
+		Extras:   c.Extras,
+	}
+}
+
+func sevProductToCBORValue(p *pb.SevProduct) *sevProductCBOR {
+	result := &sevProductCBOR{Name: int32(p.GetName())}
+	if p.GetMachineStepping() != nil {
+		stepping := p.GetMachineStepping().GetValue()
+		result.MachineStepping = &stepping
+	}
+	return result
+}
+
+func (p *sevProductCBOR) proto() *pb.SevProduct {
+	result := &pb.SevProduct{Name: pb.SevProduct_SevProductName(p.Name)}
+	if p.MachineStepping != nil {
+		result.MachineStepping = wrapperspb.UInt32(*p.MachineStepping)
+	}
+	return result
+}
+
+// ReportToCBOR returns the deterministic CBOR encoding of an attestation report. The report is
+// expected to be well-formed, i.e., to have the field sizes of the AMD SEV-SNP ABI.
+func ReportToCBOR(r *pb.Report) ([]byte, error) {
+	if err := checkReportSizes(r); err != nil {
+		return nil, err
+	}
+	return cborEncMode.Marshal(reportToCBORValue(r))
+}
+
+// ReportFromCBOR returns the attestation report represented by the given CBOR encoding.
+func ReportFromCBOR(data []byte) (*pb.Report, error) {
+	var value reportCBOR
+	if err := cborDecMode.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("could not decode CBOR report: %v", err)
+	}
+	r := value.proto()
+	if err := checkReportSizes(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CertificateChainToCBOR returns the deterministic CBOR encoding of a certificate chain.
+func CertificateChainToCBOR(c *pb.CertificateChain) ([]byte, error) {
+	return cborEncMode.Marshal(certificateChainToCBORValue(c))
+}
+
+// CertificateChainFromCBOR returns the certificate chain represented by the given CBOR encoding.
+func CertificateChainFromCBOR(data []byte) (*pb.CertificateChain, error) {
+	var value certificateChainCBOR
+	if err := cborDecMode.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("could not decode CBOR certificate chain: %v", err)
+	}
+	return value.proto(), nil
+}
+
+// AttestationToCBOR returns the deterministic CBOR encoding of an attestation report together with
+// its certificate chain and product.
+func AttestationToCBOR(a *pb.Attestation) ([]byte, error) {
+	var value attestationCBOR
+	if a.GetReport() != nil {
+		if err := checkReportSizes(a.GetReport()); err != nil {
+			return nil, err
+		}
+		value.Report = reportToCBORValue(a.GetReport())
+	}
+	if a.GetCertificateChain() != nil {
+		value.CertificateChain = certificateChainToCBORValue(a.GetCertificateChain())
+	}
+	if a.GetProduct() != nil {
+		value.Product = sevProductToCBORValue(a.GetProduct())
+	}
+	return cborEncMode.Marshal(&value)
+}
+
+// AttestationFromCBOR returns the attestation represented by the given CBOR encoding.
+func AttestationFromCBOR(data []byte) (*pb.Attestation, error) {
+	var value attestationCBOR
+	if err := cborDecMode.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("could not decode CBOR attestation: %v", err)
+	}
+	result := &pb.Attestation{}
+	if value.Report != nil {
+		result.Report = value.Report.proto()
+		if err := checkReportSizes(result.Report); err != nil {
+			return nil, err
+		}
+	}
+	if value.CertificateChain != nil {
+		result.CertificateChain = value.CertificateChain.proto()
+	}
+	if value.Product != nil {
+		result.Product = value.Product.proto()
+	}
+	return result, nil
+}
+
+// CBORReport wraps a report proto to implement cbor.Marshaler and cbor.Unmarshaler, e.g., for
+// embedding within a larger CBOR structure such as an Entity Attestation Token.
+type CBORReport struct {
+	Report *pb.Report
+}
+
+// MarshalCBOR implements cbor.Marshaler.
+func (r CBORReport) MarshalCBOR() ([]byte, error) {
+	return ReportToCBOR(r.Report)
+}
+
+// UnmarshalCBOR implements cbor.Unmarshaler.
+func (r *CBORReport) UnmarshalCBOR(data []byte) error {
+	report, err := ReportFromCBOR(data)
+	if err != nil {
+		return err
+	}
+	r.Report = report
+	return nil
+}
+
+// CBORCertificateChain wraps a certificate chain proto to implement cbor.Marshaler and
+// cbor.Unmarshaler.
+type CBORCertificateChain struct {
+	CertificateChain *pb.CertificateChain
+}
+
+// MarshalCBOR implements cbor.Marshaler.
+func (c CBORCertificateChain) MarshalCBOR() ([]byte, error) {
+	return CertificateChainToCBOR(c.CertificateChain)
+}
+
+// UnmarshalCBOR implements cbor.Unmarshaler.
+func (c *CBORCertificateChain) UnmarshalCBOR(data []byte) error {
+	chain, err := CertificateChainFromCBOR(data)
+	if err != nil {
+		return err
+	}
+	c.CertificateChain = chain
+	return nil
+}
+
+// CBORAttestation wraps an attestation proto to implement cbor.Marshaler and cbor.Unmarshaler.
+type CBORAttestation struct {
+	Attestation *pb.Attestation
+}
+
+// MarshalCBOR implements cbor.Marshaler.
+func (a CBORAttestation) MarshalCBOR() ([]byte, error) {
+	return AttestationToCBOR(a.Attestation)
+}
+
+// UnmarshalCBOR implements cbor.Unmarshaler.
+func (a *CBORAttestation) UnmarshalCBOR(data []byte) error {
+	attestation, err := AttestationFromCBOR(data)
+	if err != nil {
+		return err
+	}
+	a.Attestation = attestation
+	return nil
+}
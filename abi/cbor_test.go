@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/go-cmp/cmp"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestAttestationCBORRoundTrip(t *testing.T) {
+	report := &spb.Report{}
+	if err := prototext.Unmarshal([]byte(emptyReportV3), report); err != nil {
+		t.Fatalf("test failure: %v", err)
+	}
+	report.CurrentTcb = 0xdb18000000000004
+	report.Measurement[0] = 0x42
+	attestation := &spb.Attestation{
+		Report: report,
+		CertificateChain: &spb.CertificateChain{
+			VcekCert: []byte("vcek"),
+			AskCert:  []byte("ask"),
+			ArkCert:  []byte("ark"),
+			Extras:   map[string][]byte{ExtraPlatformInfoGUID: []byte("extra")},
+		},
+		Product: &spb.SevProduct{
+			Name:            spb.SevProduct_SEV_PRODUCT_GENOA,
+			MachineStepping: wrapperspb.UInt32(1),
+		},
+	}
+
+	data, err := AttestationToCBOR(attestation)
+	if err != nil {
+		t.Fatalf("AttestationToCBOR(%v) = _, %v. Want nil", attestation, err)
+	}
+	got, err := AttestationFromCBOR(data)
+	if err != nil {
+		t.Fatalf("AttestationFromCBOR(%v) = _, %v. Want nil", data, err)
+	}
+	if diff := cmp.Diff(got, attestation, protocmp.Transform()); diff != "" {
+		t.Errorf("AttestationFromCBOR(AttestationToCBOR(a)) = %v, want %v: %s", got, attestation, diff)
+	}
+	again, err := AttestationToCBOR(got)
+	if err != nil {
+		t.Fatalf("AttestationToCBOR(%v) = _, %v. Want nil", got, err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("AttestationToCBOR is not deterministic: %x vs %x", data, again)
+	}
+
+	// The wrapper types must compose with an enclosing CBOR structure.
+	type envelope struct {
+		Report CBORReport           `cbor:"1,keyasint"`
+		Chain  CBORCertificateChain `cbor:"2,keyasint"`
+	}
+	env, err := cbor.Marshal(envelope{
+		Report: CBORReport{Report: report},
+		Chain:  CBORCertificateChain{CertificateChain: attestation.CertificateChain},
+	})
+	if err != nil {
+		t.Fatalf("cbor.Marshal(envelope) = _, %v. Want nil", err)
+	}
+	var gotEnv envelope
+	if err := cbor.Unmarshal(env, &gotEnv); err != nil {
+		t.Fatalf("cbor.Unmarshal(%v) = %v. Want nil", env, err)
+	}
+	if diff := cmp.Diff(gotEnv.Report.Report, report, protocmp.Transform()); diff != "" {
+		t.Errorf("envelope report = %v, want %v: %s", gotEnv.Report.Report, report, diff)
+	}
+	if diff := cmp.Diff(gotEnv.Chain.CertificateChain, attestation.CertificateChain, protocmp.Transform()); diff != "" {
+		t.Errorf("envelope chain = %v, want %v: %s", gotEnv.Chain.CertificateChain, attestation.CertificateChain, diff)
+	}
+}
+
+func TestReportCBORErrors(t *testing.T) {
+	if _, err := ReportToCBOR(&spb.Report{}); err == nil || !strings.Contains(err.Error(), "family_id length") {
+		t.Errorf("ReportToCBOR(empty) = _, %v. Want family_id length error", err)
+	}
+	short, err := cbor.Marshal(map[int][]byte{4: {1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReportFromCBOR(short); err == nil || !strings.Contains(err.Error(), "family_id length") {
+		t.Errorf("ReportFromCBOR(%x) = _, %v. Want family_id length error", short, err)
+	}
+	if _, err := ReportFromCBOR([]byte{0xff}); err == nil || !strings.Contains(err.Error(), "could not decode CBOR report") {
+		t.Errorf("ReportFromCBOR(0xff) = _, %v. Want decode error", err)
+	}
+}
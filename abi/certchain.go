@@ -0,0 +1,197 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/google/uuid"
+)
+
+// ErrChainEntryNotFound is returned when a certificate chain has no entry for a GUID.
+var ErrChainEntryNotFound = errors.New("certificate chain entry not found")
+
+// chainField returns the certificate chain field that holds the entry for guid, or nil if the
+// entry is one of the extras.
+func chainField(chain *pb.CertificateChain, guid uuid.UUID) *[]byte {
+	switch guid.String() {
+	case VcekGUID:
+		return &chain.VcekCert
+	case VlekGUID:
+		return &chain.VlekCert
+	case AskGUID:
+		return &chain.AskCert
+	case ArkGUID:
+		return &chain.ArkCert
+	}
+	return nil
+}
+
+// extrasKey returns the key of chain's extras entry for guid, which may differ from its canonical
+// form in case, or the canonical form if there is no entry.
+func extrasKey(chain *pb.CertificateChain, guid uuid.UUID) string {
+	key := guid.String()
+	if _, ok := chain.GetExtras()[key]; ok {
+		return key
+	}
+	for k := range chain.GetExtras() {
+		if g, err := uuid.Parse(k); err == nil && g == guid {
+			return k
+		}
+	}
+	return key
+}
+
+func parseChainGUID(guid string) (uuid.UUID, error) {
+	g, err := uuid.Parse(guid)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid certificate chain GUID %q: %v", guid, err)
+	}
+	return g, nil
+}
+
+// ChainEntry returns the blob of the certificate chain's entry for the given GUID string. The
+// VCEK, VLEK, ASK, and ARK GUIDs identify the chain's certificate fields, and any other GUID one of
+// its extras. Returns an error that wraps ErrChainEntryNotFound if the chain has no such entry.
+func ChainEntry(chain *pb.CertificateChain, guid string) ([]byte, error) {
+	g, err := parseChainGUID(guid)
+	if err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		return nil, fmt.Errorf("%w: GUID %s", ErrChainEntryNotFound, g)
+	}
+	var blob []byte
+	if field := chainField(chain, g); field != nil {
+		blob = *field
+	} else {
+		blob = chain.GetExtras()[extrasKey(chain, g)]
+	}
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("%w: GUID %s", ErrChainEntryNotFound, g)
+	}
+	return blob, nil
+}
+
+// validateChainEntry returns an error if blob is not the expected content of the entry for guid.
+// The entries of endorsement and AMD keys must be X.509 certificates in DER format, and the
+// ExtraPlatformInfoGUID entry must parse as ExtraPlatformInfo.
+func validateChainEntry(guid uuid.UUID, blob []byte) error {
+	if len(blob) == 0 {
+		return fmt.Errorf("certificate chain entry for GUID %s is empty", guid)
+	}
+	switch guid.String() {
+	case VcekGUID, VlekGUID, AskGUID, ArkGUID, AsvkGUID:
+		if _, err := x509.ParseCertificate(blob); err != nil {
+			return fmt.Errorf("certificate chain entry for GUID %s is not an X.509 certificate: %v", guid, err)
+		}
+	case ExtraPlatformInfoGUID:
+		if _, err := ParseExtraPlatformInfo(blob); err != nil {
+			return fmt.Errorf("certificate chain entry for GUID %s is not extra platform info: %v", guid, err)
+		}
+	}
+	return nil
+}
+
+// SetChainEntry sets the certificate chain's entry for the given GUID string to blob, in the field
+// or extras entry that ChainEntry reads. Extras are keyed by the GUID's canonical lowercase form,
+// which replaces an entry for the same GUID in another case.
+func SetChainEntry(chain *pb.CertificateChain, guid string, blob []byte) error {
+	if chain == nil {
+		return errors.New("certificate chain is nil")
+	}
+	g, err := parseChainGUID(guid)
+	if err != nil {
+		return err
+	}
+	if err := validateChainEntry(g, blob); err != nil {
+		return err
+	}
+	if field := chainField(chain, g); field != nil {
+		*field = blob
+		return nil
+	}
+	delete(chain.Extras, extrasKey(chain, g))
+	if chain.Extras == nil {
+		chain.Extras = make(map[string][]byte)
+	}
+	chain.Extras[g.String()] = blob
+	return nil
+}
+
+// RemoveChainEntry deletes the certificate chain's entry for the given GUID string. Returns whether
+// an entry was removed.
+func RemoveChainEntry(chain *pb.CertificateChain, guid string) bool {
+	if _, err := ChainEntry(chain, guid); err != nil {
+		return false
+	}
+	g, _ := uuid.Parse(guid)
+	if field := chainField(chain, g); field != nil {
+		*field = nil
+	} else {
+		delete(chain.Extras, extrasKey(chain, g))
+	}
+	return true
+}
+
+func setChainCertificate(chain *pb.CertificateChain, guid, name string, cert *x509.Certificate) error {
+	if cert == nil {
+		return fmt.Errorf("%s certificate is nil", name)
+	}
+	return SetChainEntry(chain, guid, cert.Raw)
+}
+
+func chainCertificate(chain *pb.CertificateChain, guid, name string) (*x509.Certificate, error) {
+	der, err := ChainEntry(chain, guid)
+	if err != nil {
+		return nil, fmt.Errorf("no %s certificate: %w", name, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s certificate: %v", name, err)
+	}
+	return cert, nil
+}
+
+// ChainVlekCert returns the certificate chain's VLEK certificate.
+func ChainVlekCert(chain *pb.CertificateChain) (*x509.Certificate, error) {
+	return chainCertificate(chain, VlekGUID, "VLEK")
+}
+
+// SetChainVlekCert sets the certificate chain's VLEK certificate.
+func SetChainVlekCert(chain *pb.CertificateChain, cert *x509.Certificate) error {
+	return setChainCertificate(chain, VlekGUID, "VLEK", cert)
+}
+
+// ChainAsvkCert returns the certificate chain's ASVK certificate. That is the AsvkGUID entry if
+// there is one, so that a chain may have both an ASK and an ASVK. Otherwise, a chain with a VLEK
+// certificate but no VCEK certificate holds the ASVK under the ASK GUID, as the host provides it.
+func ChainAsvkCert(chain *pb.CertificateChain) (*x509.Certificate, error) {
+	if _, err := ChainEntry(chain, AsvkGUID); err == nil {
+		return chainCertificate(chain, AsvkGUID, "ASVK")
+	}
+	if len(chain.GetVlekCert()) != 0 && len(chain.GetVcekCert()) == 0 {
+		return chainCertificate(chain, AskGUID, "ASVK")
+	}
+	return nil, fmt.Errorf("no ASVK certificate: %w: GUID %s", ErrChainEntryNotFound, AsvkGUID)
+}
+
+// SetChainAsvkCert sets the certificate chain's AsvkGUID entry to the ASVK certificate.
+func SetChainAsvkCert(chain *pb.CertificateChain, cert *x509.Certificate) error {
+	return setChainCertificate(chain, AsvkGUID, "ASVK", cert)
+}
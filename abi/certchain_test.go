@@ -0,0 +1,139 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+func testCertificate(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestChainEntries(t *testing.T) {
+	vlek := testCertificate(t, "SEV-VLEK")
+	asvk := testCertificate(t, "SEV-Milan")
+	chain := &spb.CertificateChain{}
+	if err := SetChainVlekCert(chain, vlek); err != nil {
+		t.Fatalf("SetChainVlekCert() = %v. Want nil", err)
+	}
+	if !bytes.Equal(chain.GetVlekCert(), vlek.Raw) {
+		t.Errorf("SetChainVlekCert() set vlek_cert %v, want %v", chain.GetVlekCert(), vlek.Raw)
+	}
+	if got, err := ChainVlekCert(chain); err != nil || !got.Equal(vlek) {
+		t.Errorf("ChainVlekCert() = %v, %v. Want the VLEK certificate", got, err)
+	}
+
+	// A VLEK-only chain holds the ASVK under the ASK GUID.
+	if _, err := ChainAsvkCert(chain); !errors.Is(err, ErrChainEntryNotFound) {
+		t.Errorf("ChainAsvkCert(no ASK) = _, %v. Want %v", err, ErrChainEntryNotFound)
+	}
+	if err := SetChainEntry(chain, strings.ToUpper(AskGUID), asvk.Raw); err != nil {
+		t.Fatalf("SetChainEntry(ASK) = %v. Want nil", err)
+	}
+	if got, err := ChainAsvkCert(chain); err != nil || !got.Equal(asvk) {
+		t.Errorf("ChainAsvkCert(VLEK chain) = %v, %v. Want the ASK entry", got, err)
+	}
+	chain.VcekCert = []byte("vcek")
+	if _, err := ChainAsvkCert(chain); !errors.Is(err, ErrChainEntryNotFound) {
+		t.Errorf("ChainAsvkCert(VCEK chain) = _, %v. Want %v", err, ErrChainEntryNotFound)
+	}
+	if err := SetChainAsvkCert(chain, asvk); err != nil {
+		t.Fatalf("SetChainAsvkCert() = %v. Want nil", err)
+	}
+	if got, err := ChainAsvkCert(chain); err != nil || !got.Equal(asvk) || !bytes.Equal(chain.GetExtras()[AsvkGUID], asvk.Raw) {
+		t.Errorf("ChainAsvkCert() = %v, %v. Want the AsvkGUID entry", got, err)
+	}
+
+	// Other GUIDs are extras under their canonical form.
+	const custom = "ABCDEF01-0000-C0DE-0000-000000000000"
+	chain.Extras[custom] = []byte("old")
+	if got, err := ChainEntry(chain, strings.ToLower(custom)); err != nil || string(got) != "old" {
+		t.Errorf("ChainEntry(%q) = %q, %v. Want \"old\"", strings.ToLower(custom), got, err)
+	}
+	if err := SetChainEntry(chain, custom, []byte("new")); err != nil {
+		t.Fatalf("SetChainEntry(%q) = %v. Want nil", custom, err)
+	}
+	if _, ok := chain.Extras[custom]; ok || string(chain.Extras[strings.ToLower(custom)]) != "new" {
+		t.Errorf("SetChainEntry(%q) extras = %v, want only the canonical key", custom, chain.Extras)
+	}
+	if !RemoveChainEntry(chain, custom) || RemoveChainEntry(chain, custom) {
+		t.Errorf("RemoveChainEntry(%q) twice did not remove exactly once", custom)
+	}
+	if _, err := ChainEntry(chain, custom); !errors.Is(err, ErrChainEntryNotFound) {
+		t.Errorf("ChainEntry(%q) after removal = _, %v. Want %v", custom, err, ErrChainEntryNotFound)
+	}
+	if !RemoveChainEntry(chain, VcekGUID) || chain.GetVcekCert() != nil {
+		t.Errorf("RemoveChainEntry(VCEK) did not clear vcek_cert %v", chain.GetVcekCert())
+	}
+
+	tcs := []struct {
+		name    string
+		chain   *spb.CertificateChain
+		guid    string
+		blob    []byte
+		wantErr string
+	}{
+		{name: "nil chain", guid: custom, blob: []byte("x"), wantErr: "chain is nil"},
+		{name: "bad GUID", chain: chain, guid: "not a guid", blob: []byte("x"), wantErr: "invalid certificate chain GUID"},
+		{name: "empty", chain: chain, guid: custom, wantErr: "is empty"},
+		{name: "VCEK not a certificate", chain: chain, guid: VcekGUID, blob: []byte("x"), wantErr: "not an X.509 certificate"},
+		{name: "bad extra platform info", chain: chain, guid: ExtraPlatformInfoGUID, blob: []byte("x"), wantErr: "not extra platform info"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := SetChainEntry(tc.chain, tc.guid, tc.blob); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("SetChainEntry(%q, %q) = %v. Want error containing %q", tc.guid, tc.blob, err, tc.wantErr)
+			}
+		})
+	}
+	if _, err := ChainEntry(nil, VcekGUID); !errors.Is(err, ErrChainEntryNotFound) {
+		t.Errorf("ChainEntry(nil) = _, %v. Want %v", err, ErrChainEntryNotFound)
+	}
+	if err := SetChainVlekCert(chain, nil); err == nil {
+		t.Error("SetChainVlekCert(nil) = nil. Want error")
+	}
+}
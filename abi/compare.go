@@ -0,0 +1,53 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"crypto/subtle"
+	"fmt"
+)
+
+// FieldEqual returns whether a and b are equal, compared in constant time. Both must be exactly size
+// bytes, since a length mismatch would otherwise silently compare unequal and mask a malformed
+// input. The field name is only used for error messages.
+func FieldEqual(field string, size int, a, b []byte) (bool, error) {
+	if len(a) != size {
+		return false, fmt.Errorf("%s is %d bytes. Expect %d", field, len(a), size)
+	}
+	if len(b) != size {
+		return false, fmt.Errorf("%s is %d bytes. Expect %d", field, len(b), size)
+	}
+	return subtle.ConstantTimeCompare(a, b) == 1, nil
+}
+
+// MeasurementEqual returns whether two MEASUREMENT values are equal, compared in constant time.
+func MeasurementEqual(a, b []byte) (bool, error) {
+	return FieldEqual("MEASUREMENT", MeasurementSize, a, b)
+}
+
+// ReportDataEqual returns whether two REPORT_DATA values are equal, compared in constant time.
+func ReportDataEqual(a, b []byte) (bool, error) {
+	return FieldEqual("REPORT_DATA", ReportDataSize, a, b)
+}
+
+// HostDataEqual returns whether two HOST_DATA values are equal, compared in constant time.
+func HostDataEqual(a, b []byte) (bool, error) {
+	return FieldEqual("HOST_DATA", HostDataSize, a, b)
+}
+
+// ChipIDEqual returns whether two CHIP_ID values are equal, compared in constant time.
+func ChipIDEqual(a, b []byte) (bool, error) {
+	return FieldEqual("CHIP_ID", ChipIDSize, a, b)
+}
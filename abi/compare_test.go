@@ -0,0 +1,51 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFieldEqual(t *testing.T) {
+	measurement := make([]byte, MeasurementSize)
+	other := make([]byte, MeasurementSize)
+	other[MeasurementSize-1] = 1
+	tcs := []struct {
+		name    string
+		compare func(a, b []byte) (bool, error)
+		a, b    []byte
+		want    bool
+		wantErr string
+	}{
+		{name: "equal", compare: MeasurementEqual, a: measurement, b: measurement, want: true},
+		{name: "last byte differs", compare: MeasurementEqual, a: measurement, b: other},
+		{name: "short", compare: MeasurementEqual, a: measurement, b: other[:4], wantErr: "MEASUREMENT is 4 bytes. Expect 48"},
+		{name: "empty", compare: ReportDataEqual, a: nil, b: make([]byte, ReportDataSize), wantErr: "REPORT_DATA is 0 bytes. Expect 64"},
+		{name: "host data", compare: HostDataEqual, a: make([]byte, HostDataSize), b: make([]byte, HostDataSize), want: true},
+		{name: "chip id", compare: ChipIDEqual, a: make([]byte, ChipIDSize), b: make([]byte, HostDataSize), wantErr: "CHIP_ID is 32 bytes. Expect 64"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.compare(tc.a, tc.b)
+			if (err == nil) != (tc.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("compare() = _, %v. Want error %q", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("compare() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
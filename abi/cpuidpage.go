@@ -0,0 +1,163 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	// CpuidPageSize is the size in bytes of the SEV-SNP CPUID page.
+	CpuidPageSize = 0x1000
+	// CpuidPageMaxEntries is the maximum number of CPUID functions the CPUID page may contain.
+	CpuidPageMaxEntries = 64
+	// CpuidFunctionSize is the size in bytes of a CPUID function entry in the CPUID page.
+	CpuidFunctionSize   = 0x30
+	cpuidPageHeaderSize = 0x10
+)
+
+// CpuidFunction represents one SNP_CPUID_FUNCTION entry of the CPUID page: the inputs to the CPUID
+// instruction and the outputs the guest will observe for them.
+type CpuidFunction struct {
+	EaxIn  uint32
+	EcxIn  uint32
+	Xcr0In uint64
+	XssIn  uint64
+	Eax    uint32
+	Ebx    uint32
+	Ecx    uint32
+	Edx    uint32
+}
+
+// CpuidPage represents the SEV-SNP CPUID page that the AMD-SP validated at launch.
+//
+// See the SEV-SNP firmware ABI specification section "CPUID Reporting".
+type CpuidPage struct {
+	Functions []CpuidFunction
+}
+
+func (f *CpuidFunction) inputString() string {
+	return fmt.Sprintf("CPUID[eax=0x%x,ecx=0x%x,xcr0=0x%x,xss=0x%x]", f.EaxIn, f.EcxIn, f.Xcr0In, f.XssIn)
+}
+
+func (f *CpuidFunction) sameInput(other *CpuidFunction) bool {
+	return f.EaxIn == other.EaxIn && f.EcxIn == other.EcxIn && f.Xcr0In == other.Xcr0In &&
+		f.XssIn == other.XssIn
+}
+
+func (f *CpuidFunction) unmarshal(data []byte) error {
+	f.EaxIn = binary.LittleEndian.Uint32(data[0x00:0x04])
+	f.EcxIn = binary.LittleEndian.Uint32(data[0x04:0x08])
+	f.Xcr0In = binary.LittleEndian.Uint64(data[0x08:0x10])
+	f.XssIn = binary.LittleEndian.Uint64(data[0x10:0x18])
+	f.Eax = binary.LittleEndian.Uint32(data[0x18:0x1C])
+	f.Ebx = binary.LittleEndian.Uint32(data[0x1C:0x20])
+	f.Ecx = binary.LittleEndian.Uint32(data[0x20:0x24])
+	f.Edx = binary.LittleEndian.Uint32(data[0x24:0x28])
+	return mbz(data, 0x28, 0x30)
+}
+
+func (f *CpuidFunction) write(data []byte) {
+	binary.LittleEndian.PutUint32(data[0x00:0x04], f.EaxIn)
+	binary.LittleEndian.PutUint32(data[0x04:0x08], f.EcxIn)
+	binary.LittleEndian.PutUint64(data[0x08:0x10], f.Xcr0In)
+	binary.LittleEndian.PutUint64(data[0x10:0x18], f.XssIn)
+	binary.LittleEndian.PutUint32(data[0x18:0x1C], f.Eax)
+	binary.LittleEndian.PutUint32(data[0x1C:0x20], f.Ebx)
+	binary.LittleEndian.PutUint32(data[0x20:0x24], f.Ecx)
+	binary.LittleEndian.PutUint32(data[0x24:0x28], f.Edx)
+}
+
+// ParseCpuidPage returns the CPUID page represented by data, or an error if the page is malformed.
+func ParseCpuidPage(data []byte) (*CpuidPage, error) {
+	if len(data) != CpuidPageSize {
+		return nil, fmt.Errorf("CPUID page size is 0x%x bytes. Expect 0x%x", len(data), CpuidPageSize)
+	}
+	count := binary.LittleEndian.Uint32(data[0x00:0x04])
+	if count > CpuidPageMaxEntries {
+		return nil, fmt.Errorf("CPUID page count %d exceeds the maximum %d", count, CpuidPageMaxEntries)
+	}
+	if err := mbz(data, 0x04, cpuidPageHeaderSize); err != nil {
+		return nil, fmt.Errorf("CPUID page header: %v", err)
+	}
+	page := &CpuidPage{Functions: make([]CpuidFunction, count)}
+	for i := range page.Functions {
+		start := cpuidPageHeaderSize + i*CpuidFunctionSize
+		if err := page.Functions[i].unmarshal(data[start : start+CpuidFunctionSize]); err != nil {
+			return nil, fmt.Errorf("CPUID page function %d: %v", i, err)
+		}
+	}
+	if err := mbz(data, cpuidPageHeaderSize+int(count)*CpuidFunctionSize, CpuidPageSize); err != nil {
+		return nil, fmt.Errorf("CPUID page unused entries: %v", err)
+	}
+	return page, nil
+}
+
+// Marshal returns the CPUID page in its ABI format.
+func (p *CpuidPage) Marshal() ([]byte, error) {
+	if len(p.Functions) > CpuidPageMaxEntries {
+		return nil, fmt.Errorf("CPUID page has %d functions. Expect at most %d", len(p.Functions),
+			CpuidPageMaxEntries)
+	}
+	data := make([]byte, CpuidPageSize)
+	binary.LittleEndian.PutUint32(data[0x00:0x04], uint32(len(p.Functions)))
+	for i := range p.Functions {
+		start := cpuidPageHeaderSize + i*CpuidFunctionSize
+		p.Functions[i].write(data[start : start+CpuidFunctionSize])
+	}
+	return data, nil
+}
+
+// Lookup returns the CPUID page entry for the given inputs, or nil if there is none.
+func (p *CpuidPage) Lookup(eaxIn, ecxIn uint32, xcr0In, xssIn uint64) *CpuidFunction {
+	want := &CpuidFunction{EaxIn: eaxIn, EcxIn: ecxIn, Xcr0In: xcr0In, XssIn: xssIn}
+	for i := range p.Functions {
+		if p.Functions[i].sameInput(want) {
+			return &p.Functions[i]
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the page has duplicate inputs, or if any of the expected functions,
+// e.g., those the host provided at launch, are missing from the page or observe different outputs.
+func (p *CpuidPage) Validate(expected []CpuidFunction) error {
+	var err error
+	for i := range p.Functions {
+		for j := 0; j < i; j++ {
+			if p.Functions[i].sameInput(&p.Functions[j]) {
+				err = multierr.Append(err, fmt.Errorf("CPUID page functions %d and %d both have input %s",
+					j, i, p.Functions[i].inputString()))
+			}
+		}
+	}
+	for i := range expected {
+		want := &expected[i]
+		got := p.Lookup(want.EaxIn, want.EcxIn, want.Xcr0In, want.XssIn)
+		if got == nil {
+			err = multierr.Append(err, fmt.Errorf("CPUID page is missing %s", want.inputString()))
+			continue
+		}
+		if *got != *want {
+			err = multierr.Append(err, fmt.Errorf(
+				"CPUID page %s is {eax=0x%x,ebx=0x%x,ecx=0x%x,edx=0x%x}. Expect {eax=0x%x,ebx=0x%x,ecx=0x%x,edx=0x%x}",
+				want.inputString(), got.Eax, got.Ebx, got.Ecx, got.Edx, want.Eax, want.Ebx, want.Ecx, want.Edx))
+		}
+	}
+	return err
+}
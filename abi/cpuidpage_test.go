@@ -0,0 +1,136 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testCpuidFunctions = []CpuidFunction{
+	{EaxIn: 0x1, Eax: 0x00a00f11, Ebx: 0x00020800, Ecx: 0xfeda3203, Edx: 0x178bfbff},
+	{EaxIn: 0xd, EcxIn: 0x1, Xcr0In: 0x7, Eax: 0xf, Ebx: 0x340},
+}
+
+func TestCpuidPageRoundTrip(t *testing.T) {
+	page := &CpuidPage{Functions: testCpuidFunctions}
+	data, err := page.Marshal()
+	if err != nil {
+		t.Fatalf("page.Marshal() = _, %v. Want nil", err)
+	}
+	if got := binary.LittleEndian.Uint32(data[0:4]); got != 2 {
+		t.Errorf("CPUID page count = %d, want 2", got)
+	}
+	if got := binary.LittleEndian.Uint32(data[0x10+CpuidFunctionSize+0x4:]); got != 0x1 {
+		t.Errorf("CPUID page function 1 ecx_in = 0x%x, want 0x1", got)
+	}
+	got, err := ParseCpuidPage(data)
+	if err != nil {
+		t.Fatalf("ParseCpuidPage(page.Marshal()) = _, %v. Want nil", err)
+	}
+	if diff := cmp.Diff(got, page); diff != "" {
+		t.Errorf("ParseCpuidPage(page.Marshal()) = %v, want %v: %s", got, page, diff)
+	}
+	if f := got.Lookup(0xd, 0x1, 0x7, 0); f == nil || f.Ebx != 0x340 {
+		t.Errorf("Lookup(0xd, 0x1, 0x7, 0) = %v, want ebx=0x340", f)
+	}
+	if f := got.Lookup(0xd, 0x0, 0x7, 0); f != nil {
+		t.Errorf("Lookup(0xd, 0x0, 0x7, 0) = %v, want nil", f)
+	}
+}
+
+func TestParseCpuidPageErrors(t *testing.T) {
+	good, _ := (&CpuidPage{Functions: testCpuidFunctions}).Marshal()
+	tcs := []struct {
+		name    string
+		modify  func([]byte) []byte
+		wantErr string
+	}{
+		{
+			name:    "short",
+			modify:  func(b []byte) []byte { return b[:10] },
+			wantErr: "CPUID page size is 0xa bytes",
+		},
+		{
+			name: "count too large",
+			modify: func(b []byte) []byte {
+				binary.LittleEndian.PutUint32(b[0:4], 65)
+				return b
+			},
+			wantErr: "CPUID page count 65 exceeds the maximum 64",
+		},
+		{
+			name: "header reserved",
+			modify: func(b []byte) []byte {
+				b[0x8] = 1
+				return b
+			},
+			wantErr: "CPUID page header: mbz range",
+		},
+		{
+			name: "function reserved",
+			modify: func(b []byte) []byte {
+				b[0x10+0x28] = 1
+				return b
+			},
+			wantErr: "CPUID page function 0: mbz range",
+		},
+		{
+			name: "unused entry",
+			modify: func(b []byte) []byte {
+				b[0x10+2*CpuidFunctionSize] = 1
+				return b
+			},
+			wantErr: "CPUID page unused entries: mbz range",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			data := tc.modify(append([]byte{}, good...))
+			if _, err := ParseCpuidPage(data); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ParseCpuidPage() = _, %v. Want error %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCpuidPageValidate(t *testing.T) {
+	page := &CpuidPage{Functions: testCpuidFunctions}
+	if err := page.Validate(testCpuidFunctions); err != nil {
+		t.Errorf("Validate(same) = %v. Want nil", err)
+	}
+	different := append([]CpuidFunction{}, testCpuidFunctions...)
+	different[0].Ecx ^= 0x80000000
+	different = append(different, CpuidFunction{EaxIn: 0x8000001f})
+	err := page.Validate(different)
+	for _, want := range []string{
+		"CPUID page CPUID[eax=0x1,ecx=0x0,xcr0=0x0,xss=0x0] is {eax=0xa00f11,ebx=0x20800,ecx=0xfeda3203,edx=0x178bfbff}. Expect {eax=0xa00f11,ebx=0x20800,ecx=0x7eda3203",
+		"CPUID page is missing CPUID[eax=0x8000001f",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate(different) = %v. Want error containing %q", err, want)
+		}
+	}
+	dup := &CpuidPage{Functions: append(append([]CpuidFunction{}, testCpuidFunctions...), testCpuidFunctions[0])}
+	if err := dup.Validate(nil); err == nil || !strings.Contains(err.Error(), "CPUID page functions 0 and 2 both have input") {
+		t.Errorf("Validate(duplicates) = %v. Want duplicate input error", err)
+	}
+	if _, err := (&CpuidPage{Functions: make([]CpuidFunction, 65)}).Marshal(); err == nil {
+		t.Error("Marshal(65 functions) = _, nil. Want error")
+	}
+}
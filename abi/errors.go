@@ -0,0 +1,31 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import "errors"
+
+// Parse errors classify why attestation data could not be interpreted. Errors returned by this
+// package wrap one of these when applicable, so callers may branch with errors.Is, e.g., to retry
+// fetching a truncated report while rejecting a malformed one.
+var (
+	// ErrReportTooShort is returned when a raw report is shorter than ReportSize.
+	ErrReportTooShort = errors.New("report too short")
+	// ErrUnsupportedVersion is returned when a report's version is outside the supported range.
+	ErrUnsupportedVersion = errors.New("unsupported report version")
+	// ErrBadSignatureAlgo is returned when a report's signature algorithm is unknown.
+	ErrBadSignatureAlgo = errors.New("unsupported signature algorithm")
+	// ErrMalformedCertTable is returned when a certificate table cannot be interpreted.
+	ErrMalformedCertTable = errors.New("malformed certificate table")
+)
@@ -0,0 +1,220 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+// GuestMessageType is the MSG_TYPE value of an SNP guest message.
+type GuestMessageType uint8
+
+// Message types from the SEV-SNP firmware ABI specification "Guest Messages" chapter. Each response
+// type is its request type plus one.
+const (
+	MsgCPUIDRequest GuestMessageType = iota + 1
+	MsgCPUIDResponse
+	MsgKeyRequest
+	MsgKeyResponse
+	MsgReportRequest
+	MsgReportResponse
+	MsgExportRequest
+	MsgExportResponse
+	MsgImportRequest
+	MsgImportResponse
+	MsgAbsorbRequest
+	MsgAbsorbResponse
+	MsgVMRKRequest
+	MsgVMRKResponse
+	MsgAbsorbNoMARequest
+	MsgAbsorbNoMAResponse
+	MsgTSCInfoRequest
+	MsgTSCInfoResponse
+)
+
+const (
+	// GuestMessageHeaderSize is the size in bytes of the guest message header.
+	GuestMessageHeaderSize = 0x60
+	// GuestMessageHeaderVersion is the only header version this package produces.
+	GuestMessageHeaderVersion = 1
+	// GuestMessageMaxPayloadSize is the largest payload that fits in a single 4KiB message page.
+	GuestMessageMaxPayloadSize = 0x1000 - GuestMessageHeaderSize - gcmTagSize
+
+	gcmTagSize      = 16
+	gcmIVSize       = 12
+	guestMsgAADFrom = 0x30
+)
+
+// GuestMessageHeader is the unencrypted header of an SNP_GUEST_REQUEST message.
+type GuestMessageHeader struct {
+	// AuthTag is the AEAD authentication tag. Only the first 16 bytes are used by AES-256-GCM.
+	AuthTag [32]byte
+	// SeqNo is the message sequence number. A response carries its request's number plus one.
+	SeqNo uint64
+	// Algo is the AEAD algorithm. Only AeadAes256Gcm is defined.
+	Algo uint8
+	// HdrVersion is the header format version.
+	HdrVersion uint8
+	// HdrSize is the header size in bytes.
+	HdrSize uint16
+	// MsgType is the kind of message in the payload.
+	MsgType GuestMessageType
+	// MsgVersion is the version of the payload format.
+	MsgVersion uint8
+	// MsgSize is the payload size in bytes.
+	MsgSize uint16
+	// MsgVmpck is the index of the VMPCK that protects the message.
+	MsgVmpck uint8
+}
+
+// Marshal returns the header in its ABI format.
+func (h *GuestMessageHeader) Marshal() []byte {
+	data := make([]byte, GuestMessageHeaderSize)
+	copy(data[0x00:0x20], h.AuthTag[:])
+	binary.LittleEndian.PutUint64(data[0x20:0x28], h.SeqNo)
+	data[0x30] = h.Algo
+	data[0x31] = h.HdrVersion
+	binary.LittleEndian.PutUint16(data[0x32:0x34], h.HdrSize)
+	data[0x34] = uint8(h.MsgType)
+	data[0x35] = h.MsgVersion
+	binary.LittleEndian.PutUint16(data[0x36:0x38], h.MsgSize)
+	data[0x3C] = h.MsgVmpck
+	return data
+}
+
+// ParseGuestMessageHeader returns the header at the beginning of an SNP guest message.
+func ParseGuestMessageHeader(data []byte) (*GuestMessageHeader, error) {
+	if len(data) < GuestMessageHeaderSize {
+		return nil, fmt.Errorf("guest message size is %d bytes. Expect at least %d", len(data),
+			GuestMessageHeaderSize)
+	}
+	if err := multipleMbz(data, [][2]int{{0x28, 0x30}, {0x38, 0x3C}, {0x3D, GuestMessageHeaderSize}}); err != nil {
+		return nil, fmt.Errorf("guest message header: %v", err)
+	}
+	h := &GuestMessageHeader{
+		SeqNo:      binary.LittleEndian.Uint64(data[0x20:0x28]),
+		Algo:       data[0x30],
+		HdrVersion: data[0x31],
+		HdrSize:    binary.LittleEndian.Uint16(data[0x32:0x34]),
+		MsgType:    GuestMessageType(data[0x34]),
+		MsgVersion: data[0x35],
+		MsgSize:    binary.LittleEndian.Uint16(data[0x36:0x38]),
+		MsgVmpck:   data[0x3C],
+	}
+	copy(h.AuthTag[:], data[0x00:0x20])
+	return h, nil
+}
+
+func guestMessageAEAD(vmpck []byte) (cipher.AEAD, error) {
+	if len(vmpck) != VmpckSize {
+		return nil, fmt.Errorf("vmpck length is %d bytes. Expect %d", len(vmpck), VmpckSize)
+	}
+	block, err := aes.NewCipher(vmpck)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func guestMessageIV(seqno uint64) []byte {
+	iv := make([]byte, gcmIVSize)
+	binary.LittleEndian.PutUint64(iv, seqno)
+	return iv
+}
+
+// SealGuestMessage returns the SNP guest message that carries payload encrypted and authenticated
+// with vmpck. The header's MsgType, MsgVersion, SeqNo, and MsgVmpck must be set by the caller. The
+// remaining header fields are populated.
+func SealGuestMessage(vmpck []byte, header *GuestMessageHeader, payload []byte) ([]byte, error) {
+	if len(payload) > GuestMessageMaxPayloadSize {
+		return nil, fmt.Errorf("guest message payload size is %d bytes. Expect at most %d", len(payload),
+			GuestMessageMaxPayloadSize)
+	}
+	if header.MsgVmpck >= VmpckCount {
+		return nil, fmt.Errorf("guest message vmpck %d is out of range. Expect 0-%d", header.MsgVmpck,
+			VmpckCount-1)
+	}
+	aead, err := guestMessageAEAD(vmpck)
+	if err != nil {
+		return nil, err
+	}
+	header.Algo = AeadAes256Gcm
+	header.HdrVersion = GuestMessageHeaderVersion
+	header.HdrSize = GuestMessageHeaderSize
+	header.MsgSize = uint16(len(payload))
+	header.AuthTag = [32]byte{}
+	hdr := header.Marshal()
+	sealed := aead.Seal(nil, guestMessageIV(header.SeqNo), payload, hdr[guestMsgAADFrom:])
+	ciphertext, tag := sealed[:len(payload)], sealed[len(payload):]
+	copy(header.AuthTag[:], tag)
+	copy(hdr[0x00:0x20], header.AuthTag[:])
+	return append(hdr, ciphertext...), nil
+}
+
+// OpenGuestMessage authenticates and decrypts an SNP guest message with vmpck and returns its header
+// and payload.
+func OpenGuestMessage(vmpck []byte, message []byte) (*GuestMessageHeader, []byte, error) {
+	header, err := ParseGuestMessageHeader(message)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Algo != AeadAes256Gcm {
+		return nil, nil, fmt.Errorf("guest message algorithm is %d. Expect %d (AES-256-GCM)", header.Algo,
+			AeadAes256Gcm)
+	}
+	if header.HdrVersion != GuestMessageHeaderVersion || header.HdrSize != GuestMessageHeaderSize {
+		return nil, nil, fmt.Errorf("unsupported guest message header version %d size %d",
+			header.HdrVersion, header.HdrSize)
+	}
+	end := GuestMessageHeaderSize + int(header.MsgSize)
+	if len(message) < end {
+		return nil, nil, fmt.Errorf("guest message size is %d bytes. Header claims %d", len(message), end)
+	}
+	if findNonZero(header.AuthTag[:], gcmTagSize, len(header.AuthTag)) != len(header.AuthTag) {
+		return nil, nil, fmt.Errorf("guest message authtag bytes beyond %d are not zero", gcmTagSize)
+	}
+	aead, err := guestMessageAEAD(vmpck)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed := make([]byte, 0, int(header.MsgSize)+gcmTagSize)
+	sealed = append(sealed, message[GuestMessageHeaderSize:end]...)
+	sealed = append(sealed, header.AuthTag[:gcmTagSize]...)
+	payload, err := aead.Open(nil, guestMessageIV(header.SeqNo), sealed,
+		message[guestMsgAADFrom:GuestMessageHeaderSize])
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not authenticate guest message: %v", err)
+	}
+	return header, payload, nil
+}
+
+// CheckGuestResponseHeader returns an error if response is not a well-formed response to request:
+// the sequence number and message type must each be one more than the request's, and it must be
+// protected by the same VMPCK.
+func CheckGuestResponseHeader(request, response *GuestMessageHeader) error {
+	if response.SeqNo != request.SeqNo+1 {
+		return fmt.Errorf("guest response sequence number is %d. Expect %d", response.SeqNo, request.SeqNo+1)
+	}
+	if response.MsgType != request.MsgType+1 {
+		return fmt.Errorf("guest response message type is %d. Expect %d", response.MsgType, request.MsgType+1)
+	}
+	if response.MsgVmpck != request.MsgVmpck {
+		return fmt.Errorf("guest response vmpck is %d. Expect %d", response.MsgVmpck, request.MsgVmpck)
+	}
+	return nil
+}
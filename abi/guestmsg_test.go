@@ -0,0 +1,124 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"strings"
+	"testing"
+)
+
+func TestGuestMessageRoundTrip(t *testing.T) {
+	vmpck := bytes.Repeat([]byte{0x42}, VmpckSize)
+	payload := []byte("report request payload")
+	req := &GuestMessageHeader{SeqNo: 5, MsgType: MsgReportRequest, MsgVersion: 1, MsgVmpck: 0}
+	msg, err := SealGuestMessage(vmpck, req, payload)
+	if err != nil {
+		t.Fatalf("SealGuestMessage() = _, %v. Want nil", err)
+	}
+	if len(msg) != GuestMessageHeaderSize+len(payload) {
+		t.Errorf("len(SealGuestMessage()) = %d, want %d", len(msg), GuestMessageHeaderSize+len(payload))
+	}
+	if bytes.Contains(msg, payload) {
+		t.Error("SealGuestMessage() output contains the plaintext payload")
+	}
+
+	// Cross-check the AEAD construction independently: IV is the little-endian sequence number and
+	// the AAD is the header from ALGO onward.
+	block, _ := aes.NewCipher(vmpck)
+	gcm, _ := cipher.NewGCM(block)
+	iv := make([]byte, 12)
+	iv[0] = 5
+	want := gcm.Seal(nil, iv, payload, msg[0x30:0x60])
+	if !bytes.Equal(msg[0x60:], want[:len(payload)]) || !bytes.Equal(msg[0:16], want[len(payload):]) {
+		t.Errorf("SealGuestMessage() = %x, want ciphertext %x", msg, want)
+	}
+
+	hdr, got, err := OpenGuestMessage(vmpck, msg)
+	if err != nil {
+		t.Fatalf("OpenGuestMessage() = _, _, %v. Want nil", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("OpenGuestMessage() payload = %q, want %q", got, payload)
+	}
+	if hdr.SeqNo != 5 || hdr.MsgType != MsgReportRequest || hdr.MsgSize != uint16(len(payload)) ||
+		hdr.Algo != AeadAes256Gcm || hdr.HdrSize != GuestMessageHeaderSize {
+		t.Errorf("OpenGuestMessage() header = %+v, want fields of %+v", hdr, req)
+	}
+
+	tampered := append([]byte{}, msg...)
+	tampered[0x34] = uint8(MsgKeyRequest) // Header fields from ALGO on are authenticated.
+	if _, _, err := OpenGuestMessage(vmpck, tampered); err == nil || !strings.Contains(err.Error(), "could not authenticate") {
+		t.Errorf("OpenGuestMessage(tampered) = _, _, %v. Want authentication error", err)
+	}
+	if _, _, err := OpenGuestMessage(bytes.Repeat([]byte{1}, VmpckSize), msg); err == nil {
+		t.Error("OpenGuestMessage(wrong key) = _, _, nil. Want error")
+	}
+	if _, _, err := OpenGuestMessage(vmpck, msg[:GuestMessageHeaderSize+1]); err == nil || !strings.Contains(err.Error(), "Header claims") {
+		t.Errorf("OpenGuestMessage(truncated) = _, _, %v. Want size error", err)
+	}
+}
+
+func TestCheckGuestResponseHeader(t *testing.T) {
+	req := &GuestMessageHeader{SeqNo: 7, MsgType: MsgKeyRequest, MsgVmpck: 1}
+	tcs := []struct {
+		name    string
+		resp    *GuestMessageHeader
+		wantErr string
+	}{
+		{
+			name: "ok",
+			resp: &GuestMessageHeader{SeqNo: 8, MsgType: MsgKeyResponse, MsgVmpck: 1},
+		},
+		{
+			name:    "replayed seqno",
+			resp:    &GuestMessageHeader{SeqNo: 7, MsgType: MsgKeyResponse, MsgVmpck: 1},
+			wantErr: "sequence number is 7. Expect 8",
+		},
+		{
+			name:    "wrong type",
+			resp:    &GuestMessageHeader{SeqNo: 8, MsgType: MsgReportResponse, MsgVmpck: 1},
+			wantErr: "message type is 6. Expect 4",
+		},
+		{
+			name:    "wrong vmpck",
+			resp:    &GuestMessageHeader{SeqNo: 8, MsgType: MsgKeyResponse},
+			wantErr: "vmpck is 0. Expect 1",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckGuestResponseHeader(req, tc.resp)
+			if (err == nil) != (tc.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("CheckGuestResponseHeader() = %v. Want error %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSealGuestMessageErrors(t *testing.T) {
+	vmpck := make([]byte, VmpckSize)
+	if _, err := SealGuestMessage(vmpck[:3], &GuestMessageHeader{}, nil); err == nil {
+		t.Error("SealGuestMessage(short key) = _, nil. Want error")
+	}
+	if _, err := SealGuestMessage(vmpck, &GuestMessageHeader{MsgVmpck: 4}, nil); err == nil {
+		t.Error("SealGuestMessage(vmpck 4) = _, nil. Want error")
+	}
+	if _, err := SealGuestMessage(vmpck, &GuestMessageHeader{}, make([]byte, 0x1000)); err == nil {
+		t.Error("SealGuestMessage(large payload) = _, nil. Want error")
+	}
+}
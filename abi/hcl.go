@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// On Azure confidential VMs, the paravisor (HCL) exposes the SEV-SNP attestation report through a
+// vTPM NV index as an HCL report:
+//
+//	header        [0x00:0x20]
+//	SNP report    [0x20:0x4C0]
+//	runtime data  [0x4C0:]      (a 20 byte header followed by JSON claims)
+//
+// The SNP report's REPORT_DATA is a digest of the runtime data claims.
+const (
+	// HclHeaderSize is the size of the HCL report header that precedes the SEV-SNP report.
+	HclHeaderSize = 0x20
+	// HclSignature is "HCLA" in little endian, the first field of an HCL report.
+	HclSignature = 0x414c4348
+	// HclRuntimeDataHeaderSize is the size of the runtime data header that follows the SEV-SNP
+	// report.
+	HclRuntimeDataHeaderSize = 0x14
+	// HclReportTypeSnp is the runtime data report type of an SEV-SNP report.
+	HclReportTypeSnp = 2
+)
+
+// HclHashType is the algorithm with which the HCL binds the runtime claims to the SEV-SNP report's
+// REPORT_DATA.
+type HclHashType uint32
+
+const (
+	// HclHashSHA256 binds the SHA-256 digest of the runtime claims.
+	HclHashSHA256 HclHashType = 1
+	// HclHashSHA384 binds the SHA-384 digest of the runtime claims.
+	HclHashSHA384 HclHashType = 2
+	// HclHashSHA512 binds the SHA-512 digest of the runtime claims.
+	HclHashSHA512 HclHashType = 3
+)
+
+// HclReport is the parsed form of an HCL report.
+type HclReport struct {
+	// Report is the SEV-SNP attestation report in its ABI format.
+	Report []byte
+	// HashType is the algorithm of the REPORT_DATA binding.
+	HashType HclHashType
+	// RuntimeClaims is the JSON-encoded runtime claims.
+	RuntimeClaims []byte
+}
+
+// ParseHclReport parses an HCL report. The result does not alias data.
+func ParseHclReport(data []byte) (*HclReport, error) {
+	runtimeDataOffset := HclHeaderSize + ReportSize
+	if len(data) < runtimeDataOffset+HclRuntimeDataHeaderSize {
+		return nil, fmt.Errorf("HCL report is %d bytes, want at least %d", len(data),
+			runtimeDataOffset+HclRuntimeDataHeaderSize)
+	}
+	if sig := binary.LittleEndian.Uint32(data[0x00:0x04]); sig != HclSignature {
+		return nil, fmt.Errorf("HCL report signature is 0x%08x, want 0x%08x", sig, HclSignature)
+	}
+	runtimeData := data[runtimeDataOffset:]
+	if reportType := binary.LittleEndian.Uint32(runtimeData[0x08:0x0C]); reportType != HclReportTypeSnp {
+		return nil, fmt.Errorf("HCL report type is %d, want %d (SEV-SNP)", reportType, HclReportTypeSnp)
+	}
+	claimsSize := uint64(binary.LittleEndian.Uint32(runtimeData[0x10:0x14]))
+	claims := runtimeData[HclRuntimeDataHeaderSize:]
+	if claimsSize > uint64(len(claims)) {
+		return nil, fmt.Errorf("HCL runtime claims are %d bytes, but only %d remain", claimsSize, len(claims))
+	}
+	return &HclReport{
+		Report:        append([]byte{}, data[HclHeaderSize:runtimeDataOffset]...),
+		HashType:      HclHashType(binary.LittleEndian.Uint32(runtimeData[0x0C:0x10])),
+		RuntimeClaims: append([]byte{}, claims[:claimsSize]...),
+	}, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func hclReport(report, claims []byte, hashType HclHashType) []byte {
+	header := make([]byte, HclHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:4], HclSignature)
+	runtimeData := make([]byte, HclRuntimeDataHeaderSize)
+	binary.LittleEndian.PutUint32(runtimeData[0:4], uint32(HclRuntimeDataHeaderSize+len(claims)))
+	binary.LittleEndian.PutUint32(runtimeData[8:12], HclReportTypeSnp)
+	binary.LittleEndian.PutUint32(runtimeData[12:16], uint32(hashType))
+	binary.LittleEndian.PutUint32(runtimeData[16:20], uint32(len(claims)))
+	return bytes.Join([][]byte{header, report, runtimeData, claims}, nil)
+}
+
+func TestParseHclReport(t *testing.T) {
+	report := bytes.Repeat([]byte{0xab}, ReportSize)
+	claims := []byte(`{"user-data":"0102"}`)
+	data := hclReport(report, claims, HclHashSHA384)
+	got, err := ParseHclReport(append(data, 0, 0))
+	if err != nil {
+		t.Fatalf("ParseHclReport() = _, %v. Want nil", err)
+	}
+	if !bytes.Equal(got.Report, report) || !bytes.Equal(got.RuntimeClaims, claims) || got.HashType != HclHashSHA384 {
+		t.Errorf("ParseHclReport() = %v, want the report and claims it was made from", got)
+	}
+	data[HclHeaderSize] = 0
+	if got.Report[0] != 0xab {
+		t.Error("ParseHclReport() result aliases its input")
+	}
+}
+
+func TestParseHclReportErrors(t *testing.T) {
+	good := hclReport(make([]byte, ReportSize), []byte("{}"), HclHashSHA256)
+	badSig := append([]byte{}, good...)
+	badSig[0] = 0
+	tdx := append([]byte{}, good...)
+	binary.LittleEndian.PutUint32(tdx[HclHeaderSize+ReportSize+0x08:], 4)
+	truncated := good[:len(good)-1]
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{name: "short", data: good[:100], wantErr: "HCL report is 100 bytes"},
+		{name: "signature", data: badSig, wantErr: "HCL report signature"},
+		{name: "tdx", data: tdx, wantErr: "HCL report type is 4"},
+		{name: "truncated claims", data: truncated, wantErr: "HCL runtime claims are 2 bytes, but only 1 remain"},
+	} {
+		if _, err := ParseHclReport(tc.data); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("ParseHclReport(%s) = _, %v. Want error %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
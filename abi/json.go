@@ -0,0 +1,324 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// HexBytes is a byte slice that is represented in JSON as a lowercase hex string instead of the
+// base64 string that encoding/json and protojson use.
+type HexBytes []byte
+
+// MarshalJSON implements json.Marshaler.
+func (h HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(h))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (h *HexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("could not decode hex string %q: %v", s, err)
+	}
+	*h = b
+	return nil
+}
+
+// reportJSON is the JSON representation of an attestation report. Object keys are the sevsnp
+// proto field names and appear in field number order, so output is stable across releases.
+type reportJSON struct {
+	Version          uint32   `json:"version"`
+	GuestSvn         uint32   `json:"guest_svn"`
+	Policy           uint64   `json:"policy"`
+	FamilyID         HexBytes `json:"family_id"`
+	ImageID          HexBytes `json:"image_id"`
+	Vmpl             uint32   `json:"vmpl"`
+	SignatureAlgo    uint32   `json:"signature_algo"`
+	CurrentTcb       uint64   `json:"current_tcb"`
+	PlatformInfo     uint64   `json:"platform_info"`
+	SignerInfo       uint32   `json:"signer_info"`
+	ReportData       HexBytes `json:"report_data"`
+	Measurement      HexBytes `json:"measurement"`
+	HostData         HexBytes `json:"host_data"`
+	IDKeyDigest      HexBytes `json:"id_key_digest"`
+	AuthorKeyDigest  HexBytes `json:"author_key_digest"`
+	ReportID         HexBytes `json:"report_id"`
+	ReportIDMa       HexBytes `json:"report_id_ma"`
+	ReportedTcb      uint64   `json:"reported_tcb"`
+	ChipID           HexBytes `json:"chip_id"`
+	CommittedTcb     uint64   `json:"committed_tcb"`
+	CurrentBuild     uint32   `json:"current_build"`
+	CurrentMinor     uint32   `json:"current_minor"`
+	CurrentMajor     uint32   `json:"current_major"`
+	CommittedBuild   uint32   `json:"committed_build"`
+	CommittedMinor   uint32   `json:"committed_minor"`
+	CommittedMajor   uint32   `json:"committed_major"`
+	LaunchTcb        uint64   `json:"launch_tcb"`
+	Signature        HexBytes `json:"signature"`
+	Cpuid1EaxFms     uint32   `json:"cpuid1eax_fms"`
+	LaunchMitVector  uint64   `json:"launch_mit_vector"`
+	CurrentMitVector uint64   `json:"current_mit_vector"`
+}
+
+func reportToJSONValue(r *pb.Report) *reportJSON {
+	return &reportJSON{
+		Version:          r.GetVersion(),
+		GuestSvn:         r.GetGuestSvn(),
+		Policy:           r.GetPolicy(),
+		FamilyID:         r.GetFamilyId(),
+		ImageID:          r.GetImageId(),
+		Vmpl:             r.GetVmpl(),
+		SignatureAlgo:    r.GetSignatureAlgo(),
+		CurrentTcb:       r.GetCurrentTcb(),
+		PlatformInfo:     r.GetPlatformInfo(),
+		SignerInfo:       r.GetSignerInfo(),
+		ReportData:       r.GetReportData(),
+		Measurement:      r.GetMeasurement(),
+		HostData:         r.GetHostData(),
+		IDKeyDigest:      r.GetIdKeyDigest(),
+		AuthorKeyDigest:  r.GetAuthorKeyDigest(),
+		ReportID:         r.GetReportId(),
+		ReportIDMa:       r.GetReportIdMa(),
+		ReportedTcb:      r.GetReportedTcb(),
+		ChipID:           r.GetChipId(),
+		CommittedTcb:     r.GetCommittedTcb(),
+		CurrentBuild:     r.GetCurrentBuild(),
+		CurrentMinor:     r.GetCurrentMinor(),
+		CurrentMajor:     r.GetCurrentMajor(),
+		CommittedBuild:   r.GetCommittedBuild(),
+		CommittedMinor:   r.GetCommittedMinor(),
+		CommittedMajor:   r.GetCommittedMajor(),
+		LaunchTcb:        r.GetLaunchTcb(),
+		Signature:        r.GetSignature(),
+		Cpuid1EaxFms:     r.GetCpuid1EaxFms(),
+		LaunchMitVector:  r.GetLaunchMitVector(),
+		CurrentMitVector: r.GetCurrentMitVector(),
+	}
+}
+
+func (r *reportJSON) proto() *pb.Report {
+	return &pb.Report{
+		Version:          r.Version,
+		GuestSvn:         r.GuestSvn,
+		Policy:           r.Policy,
+		FamilyId:         r.FamilyID,
+		ImageId:          r.ImageID,
+		Vmpl:             r.Vmpl,
+		SignatureAlgo:    r.SignatureAlgo,
+		CurrentTcb:       r.CurrentTcb,
+		PlatformInfo:     r.PlatformInfo,
+		SignerInfo:       r.SignerInfo,
+		ReportData:       r.ReportData,
+		Measurement:      r.Measurement,
+		HostData:         r.HostData,
+		IdKeyDigest:      r.IDKeyDigest,
+		AuthorKeyDigest:  r.AuthorKeyDigest,
+		ReportId:         r.ReportID,
+		ReportIdMa:       r.ReportIDMa,
+		ReportedTcb:      r.ReportedTcb,
+		ChipId:           r.ChipID,
+		CommittedTcb:     r.CommittedTcb,
+		CurrentBuild:     r.CurrentBuild,
+		CurrentMinor:     r.CurrentMinor,
+		CurrentMajor:     r.CurrentMajor,
+		CommittedBuild:   r.CommittedBuild,
+		CommittedMinor:   r.CommittedMinor,
+		CommittedMajor:   r.CommittedMajor,
+		LaunchTcb:        r.LaunchTcb,
+		Signature:        r.Signature,
+		Cpuid1EaxFms:     r.Cpuid1EaxFms,
+		LaunchMitVector:  r.LaunchMitVector,
+		CurrentMitVector: r.CurrentMitVector,
+	}
+}
+
+// ReportToJSON returns the JSON representation of an attestation report in which all byte fields
+// are hex-encoded. The report is expected to have the field sizes of the AMD SEV-SNP ABI.
+func ReportToJSON(r *pb.Report) ([]byte, error) {
+	if err := checkReportSizes(r); err != nil {
+		return nil, err
+	}
+	return json.Marshal(reportToJSONValue(r))
+}
+
+// strictUnmarshal decodes data as exactly one JSON value into v, and fails for object keys that v
+// does not have.
+func strictUnmarshal(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	// Token, unlike More, also catches a trailing '}' or ']'.
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// ReportFromJSON returns the attestation report represented by the output of ReportToJSON. It fails
+// for unknown object keys.
+func ReportFromJSON(data []byte) (*pb.Report, error) {
+	var value reportJSON
+	if err := strictUnmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("could not decode JSON report: %v", err)
+	}
+	r := value.proto()
+	if err := checkReportSizes(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// JSONReport wraps a report proto to implement json.Marshaler and json.Unmarshaler with
+// hex-encoded byte fields, e.g., for embedding within a larger JSON document.
+type JSONReport struct {
+	Report *pb.Report
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r JSONReport) MarshalJSON() ([]byte, error) {
+	return ReportToJSON(r.Report)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *JSONReport) UnmarshalJSON(data []byte) error {
+	report, err := ReportFromJSON(data)
+	if err != nil {
+		return err
+	}
+	r.Report = report
+	return nil
+}
+
+// certificateChainJSON is the JSON representation of a certificate chain. Extras are keyed by
+// GUID, and encoding/json sorts map keys, so output is stable.
+type certificateChainJSON struct {
+	VcekCert HexBytes            `json:"vcek_cert,omitempty"`
+	AskCert  HexBytes            `json:"ask_cert,omitempty"`
+	ArkCert  HexBytes            `json:"ark_cert,omitempty"`
+	VlekCert HexBytes            `json:"vlek_cert,omitempty"`
+	Extras   map[string]HexBytes `json:"extras,omitempty"`
+}
+
+// productJSON is the JSON representation of a product. The name is the enum value name.
+type productJSON struct {
+	Name            string  `json:"name"`
+	MachineStepping *uint32 `json:"machine_stepping,omitempty"`
+}
+
+// attestationJSON is the JSON representation of an attestation.
+type attestationJSON struct {
+	Report           JSONReport            `json:"report"`
+	CertificateChain *certificateChainJSON `json:"certificate_chain,omitempty"`
+	Product          *productJSON          `json:"product,omitempty"`
+}
+
+func attestationToJSONValue(a *pb.Attestation) *attestationJSON {
+	value := &attestationJSON{Report: JSONReport{Report: a.GetReport()}}
+	if chain := a.GetCertificateChain(); chain != nil {
+		value.CertificateChain = &certificateChainJSON{
+			VcekCert: chain.GetVcekCert(),
+			AskCert:  chain.GetAskCert(),
+			ArkCert:  chain.GetArkCert(),
+			VlekCert: chain.GetVlekCert(),
+		}
+		if len(chain.GetExtras()) != 0 {
+			value.CertificateChain.Extras = make(map[string]HexBytes, len(chain.GetExtras()))
+			for guid, blob := range chain.GetExtras() {
+				value.CertificateChain.Extras[guid] = blob
+			}
+		}
+	}
+	if product := a.GetProduct(); product != nil {
+		value.Product = &productJSON{Name: product.GetName().String()}
+		if product.GetMachineStepping() != nil {
+			stepping := product.GetMachineStepping().GetValue()
+			value.Product.MachineStepping = &stepping
+		}
+	}
+	return value
+}
+
+func (a *attestationJSON) proto() (*pb.Attestation, error) {
+	if a.Report.Report == nil {
+		return nil, errors.New("attestation has no report")
+	}
+	result := &pb.Attestation{Report: a.Report.Report}
+	if chain := a.CertificateChain; chain != nil {
+		result.CertificateChain = &pb.CertificateChain{
+			VcekCert: chain.VcekCert,
+			VlekCert: chain.VlekCert,
+			AskCert:  chain.AskCert,
+			ArkCert:  chain.ArkCert,
+		}
+		if len(chain.Extras) != 0 {
+			result.CertificateChain.Extras = make(map[string][]byte, len(chain.Extras))
+			for guid, blob := range chain.Extras {
+				result.CertificateChain.Extras[guid] = blob
+			}
+		}
+	}
+	if product := a.Product; product != nil {
+		name, ok := pb.SevProduct_SevProductName_value[product.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown product name %q", product.Name)
+		}
+		result.Product = &pb.SevProduct{Name: pb.SevProduct_SevProductName(name)}
+		if product.MachineStepping != nil {
+			result.Product.MachineStepping = wrapperspb.UInt32(*product.MachineStepping)
+		}
+	}
+	return result, nil
+}
+
+// AttestationToJSON returns the canonical JSON representation of an attestation, e.g., for
+// hashing, signing, or diffing. Byte fields are hex-encoded, object keys are the sevsnp proto field
+// names in field number order, and there is no insignificant whitespace, so equal attestations
+// have equal representations. The deprecated fields of the certificate chain and product are not
+// represented.
+func AttestationToJSON(a *pb.Attestation) ([]byte, error) {
+	if a.GetReport() == nil {
+		return nil, errors.New("attestation has no report")
+	}
+	if err := checkReportSizes(a.GetReport()); err != nil {
+		return nil, err
+	}
+	return json.Marshal(attestationToJSONValue(a))
+}
+
+// AttestationFromJSON returns the attestation represented by the output of AttestationToJSON. It
+// fails for unknown object keys, unknown product names, and reports without the field sizes of the
+// AMD SEV-SNP ABI.
+func AttestationFromJSON(data []byte) (*pb.Attestation, error) {
+	var value attestationJSON
+	if err := strictUnmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("could not decode JSON attestation: %v", err)
+	}
+	return value.proto()
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestReportJSONRoundTrip(t *testing.T) {
+	report := &spb.Report{}
+	if err := prototext.Unmarshal([]byte(emptyReportV3), report); err != nil {
+		t.Fatalf("test failure: %v", err)
+	}
+	report.Measurement[0] = 0xab
+	report.ChipId[63] = 0xcd
+
+	data, err := ReportToJSON(report)
+	if err != nil {
+		t.Fatalf("ReportToJSON(%v) = _, %v. Want nil", report, err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("ReportToJSON output is not JSON: %v", err)
+	}
+	wantMeasurement := "ab" + strings.Repeat("00", MeasurementSize-1)
+	if got := fields["measurement"]; got != wantMeasurement {
+		t.Errorf("ReportToJSON measurement = %v, want %q", got, wantMeasurement)
+	}
+	wantChipID := strings.Repeat("00", ChipIDSize-1) + "cd"
+	if got := fields["chip_id"]; got != wantChipID {
+		t.Errorf("ReportToJSON chip_id = %v, want %q", got, wantChipID)
+	}
+	if !strings.HasPrefix(string(data), `{"version":3,"guest_svn":0,`) {
+		t.Errorf("ReportToJSON(%v) = %s, want fields in proto field order", report, data)
+	}
+
+	got, err := ReportFromJSON(data)
+	if err != nil {
+		t.Fatalf("ReportFromJSON(%s) = _, %v. Want nil", data, err)
+	}
+	if diff := cmp.Diff(got, report, protocmp.Transform()); diff != "" {
+		t.Errorf("ReportFromJSON(ReportToJSON(r)) = %v, want %v: %s", got, report, diff)
+	}
+
+	wrapped, err := json.Marshal(struct {
+		Report JSONReport `json:"report"`
+	}{Report: JSONReport{Report: report}})
+	if err != nil {
+		t.Fatalf("json.Marshal(JSONReport) = _, %v. Want nil", err)
+	}
+	var unwrapped struct {
+		Report JSONReport `json:"report"`
+	}
+	if err := json.Unmarshal(wrapped, &unwrapped); err != nil {
+		t.Fatalf("json.Unmarshal(%s) = %v. Want nil", wrapped, err)
+	}
+	if diff := cmp.Diff(unwrapped.Report.Report, report, protocmp.Transform()); diff != "" {
+		t.Errorf("JSONReport round trip = %v, want %v: %s", unwrapped.Report.Report, report, diff)
+	}
+}
+
+func TestReportJSONErrors(t *testing.T) {
+	if _, err := ReportToJSON(&spb.Report{}); err == nil || !strings.Contains(err.Error(), "family_id length") {
+		t.Errorf("ReportToJSON(empty) = _, %v. Want family_id length error", err)
+	}
+	if _, err := ReportFromJSON([]byte(`{"family_id":"zz"}`)); err == nil || !strings.Contains(err.Error(), "could not decode hex string") {
+		t.Errorf("ReportFromJSON(bad hex) = _, %v. Want hex error", err)
+	}
+	if _, err := ReportFromJSON([]byte(`{"family_id":"` + hex.EncodeToString([]byte{1}) + `"}`)); err == nil || !strings.Contains(err.Error(), "family_id length") {
+		t.Errorf("ReportFromJSON(short family_id) = _, %v. Want family_id length error", err)
+	}
+	if _, err := ReportFromJSON([]byte(`{"family":""}`)); err == nil || !strings.Contains(err.Error(), "unknown field") {
+		t.Errorf("ReportFromJSON(unknown key) = _, %v. Want unknown field error", err)
+	}
+}
+
+func TestAttestationJSONRoundTrip(t *testing.T) {
+	report := &spb.Report{}
+	if err := prototext.Unmarshal([]byte(emptyReportV3), report); err != nil {
+		t.Fatalf("test failure: %v", err)
+	}
+	attestation := &spb.Attestation{
+		Report: report,
+		CertificateChain: &spb.CertificateChain{
+			VcekCert: []byte{1, 2},
+			AskCert:  []byte{5},
+			VlekCert: []byte{6},
+			Extras:   map[string][]byte{"ffffffff-ffff-ffff-ffff-ffffffffffff": {3}, "00000000-0000-0000-0000-000000000001": {4}},
+		},
+		Product: &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_GENOA, MachineStepping: wrapperspb.UInt32(1)},
+	}
+	data, err := AttestationToJSON(attestation)
+	if err != nil {
+		t.Fatalf("AttestationToJSON(%v) = _, %v. Want nil", attestation, err)
+	}
+	again, err := AttestationToJSON(proto.Clone(attestation).(*spb.Attestation))
+	if err != nil || !bytes.Equal(again, data) {
+		t.Errorf("AttestationToJSON(clone) = %s, %v. Want %s", again, err, data)
+	}
+	wantSuffix := `,"certificate_chain":{"vcek_cert":"0102","ask_cert":"05","vlek_cert":"06","extras":{"00000000-0000-0000-0000-000000000001":"04","ffffffff-ffff-ffff-ffff-ffffffffffff":"03"}},` +
+		`"product":{"name":"SEV_PRODUCT_GENOA","machine_stepping":1}}`
+	if !strings.HasPrefix(string(data), `{"report":{"version":3,`) || !strings.HasSuffix(string(data), wantSuffix) {
+		t.Errorf("AttestationToJSON(%v) = %s, want fields in proto field order ending in %s", attestation, data, wantSuffix)
+	}
+	got, err := AttestationFromJSON(data)
+	if err != nil {
+		t.Fatalf("AttestationFromJSON(%s) = _, %v. Want nil", data, err)
+	}
+	if diff := cmp.Diff(got, attestation, protocmp.Transform()); diff != "" {
+		t.Errorf("AttestationFromJSON(AttestationToJSON(a)) = %v, want %v: %s", got, attestation, diff)
+	}
+
+	tcs := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "no report", data: `{}`, wantErr: "no report"},
+		{name: "unknown key", data: strings.Replace(string(data), `"vcek_cert"`, `"vcek"`, 1), wantErr: "unknown field"},
+		{name: "trailing data", data: string(data) + `{}`, wantErr: "after JSON value"},
+		{name: "trailing brace", data: string(data) + `}`, wantErr: "after JSON value"},
+		{name: "trailing bracket", data: string(data) + ` ]`, wantErr: "after JSON value"},
+		{name: "unknown product", data: strings.Replace(string(data), "SEV_PRODUCT_GENOA", "GENOA", 1), wantErr: "unknown product name"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := AttestationFromJSON([]byte(tc.data)); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("AttestationFromJSON(%s) = _, %v. Want error containing %q", tc.data, err, tc.wantErr)
+			}
+		})
+	}
+	if _, err := AttestationToJSON(&spb.Attestation{}); err == nil {
+		t.Error("AttestationToJSON(no report) = _, nil. Want error")
+	}
+}
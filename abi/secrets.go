@@ -0,0 +1,172 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	// SecretsPageSize is the size in bytes of the SEV-SNP secrets page.
+	SecretsPageSize = 0x1000
+	// VmpckSize is the size in bytes of a VM platform communication key.
+	VmpckSize = 32
+	// VmpckCount is the number of VMPCKs in the secrets page, one per VMPL.
+	VmpckCount = 4
+	// GosvwSize is the size in bytes of the guest OS-visible workarounds field.
+	GosvwSize = 16
+	// SecretsOSAreaSize is the size in bytes of the secrets page area reserved for guest OS use.
+	SecretsOSAreaSize = 96
+	// VmsaTweakBitmapSize is the size in bytes of the VMSA tweak bitmap.
+	VmsaTweakBitmapSize = 64
+
+	secretsVmpck0Offset    = 0x20
+	secretsOSAreaOffset    = 0xA0
+	secretsVmsaTweakOffset = 0x100
+	secretsReserved3Offset = 0x140
+	secretsTscFactorOffset = 0x160
+	secretsReserved4Offset = 0x164
+)
+
+// SecretsPage represents the SEV-SNP secrets page that the AMD-SP installs into the guest at
+// launch. The VMPCKs are only reachable through Vmpck so that they are not accidentally logged.
+//
+// See the SEV-SNP firmware ABI specification section "Secrets Page Format".
+type SecretsPage struct {
+	// Version is the secrets page format version.
+	Version uint32
+	// ImiEn is true if the guest was launched with IMI_EN, i.e., as a migration image.
+	ImiEn bool
+	// Fms is the family, model, and stepping of the platform in CPUID[1].EAX format.
+	Fms uint32
+	// Gosvw is the guest OS-visible workarounds bitmap the hypervisor provided at launch.
+	Gosvw [GosvwSize]byte
+	// OSArea is the area of the secrets page reserved for guest OS use, e.g., for message sequence
+	// numbers.
+	OSArea [SecretsOSAreaSize]byte
+	// VmsaTweakBitmap indicates which VMSA fields are tweaked by the VMSA register protection
+	// feature.
+	VmsaTweakBitmap [VmsaTweakBitmapSize]byte
+	// TscFactor is the guest TSC scaling factor for Secure TSC guests.
+	TscFactor uint32
+
+	vmpck [VmpckCount][VmpckSize]byte
+}
+
+// ParseSecretsPage returns the secrets page represented by data, or an error if the page is
+// malformed.
+func ParseSecretsPage(data []byte) (*SecretsPage, error) {
+	if len(data) != SecretsPageSize {
+		return nil, fmt.Errorf("secrets page size is 0x%x bytes. Expect 0x%x", len(data), SecretsPageSize)
+	}
+	flags := uint64(binary.LittleEndian.Uint32(data[0x04:0x08]))
+	if err := mbz64(flags, "secrets[0x04:0x08]", 31, 1); err != nil {
+		return nil, err
+	}
+	if err := multipleMbz(data, [][2]int{
+		{0x0C, 0x10},
+		{secretsReserved3Offset, secretsTscFactorOffset},
+		{secretsReserved4Offset, SecretsPageSize},
+	}); err != nil {
+		return nil, fmt.Errorf("secrets page: %v", err)
+	}
+	p := &SecretsPage{
+		Version:   binary.LittleEndian.Uint32(data[0x00:0x04]),
+		ImiEn:     flags&1 != 0,
+		Fms:       binary.LittleEndian.Uint32(data[0x08:0x0C]),
+		TscFactor: binary.LittleEndian.Uint32(data[secretsTscFactorOffset:secretsReserved4Offset]),
+	}
+	copy(p.Gosvw[:], data[0x10:secretsVmpck0Offset])
+	for i := range p.vmpck {
+		start := secretsVmpck0Offset + i*VmpckSize
+		copy(p.vmpck[i][:], data[start:start+VmpckSize])
+	}
+	copy(p.OSArea[:], data[secretsOSAreaOffset:secretsVmsaTweakOffset])
+	copy(p.VmsaTweakBitmap[:], data[secretsVmsaTweakOffset:secretsReserved3Offset])
+	return p, nil
+}
+
+func multipleMbz(data []byte, ranges [][2]int) error {
+	for _, r := range ranges {
+		if err := mbz(data, r[0], r[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal returns the secrets page in its ABI format.
+func (p *SecretsPage) Marshal() []byte {
+	data := make([]byte, SecretsPageSize)
+	binary.LittleEndian.PutUint32(data[0x00:0x04], p.Version)
+	if p.ImiEn {
+		binary.LittleEndian.PutUint32(data[0x04:0x08], 1)
+	}
+	binary.LittleEndian.PutUint32(data[0x08:0x0C], p.Fms)
+	copy(data[0x10:secretsVmpck0Offset], p.Gosvw[:])
+	for i := range p.vmpck {
+		start := secretsVmpck0Offset + i*VmpckSize
+		copy(data[start:start+VmpckSize], p.vmpck[i][:])
+	}
+	copy(data[secretsOSAreaOffset:secretsVmsaTweakOffset], p.OSArea[:])
+	copy(data[secretsVmsaTweakOffset:secretsReserved3Offset], p.VmsaTweakBitmap[:])
+	binary.LittleEndian.PutUint32(data[secretsTscFactorOffset:secretsReserved4Offset], p.TscFactor)
+	return data
+}
+
+// Vmpck returns a copy of the VM platform communication key for the given VMPL. A key of all zeros
+// means the key has been wiped, e.g., by the guest kernel after too many message failures.
+func (p *SecretsPage) Vmpck(vmpl int) ([]byte, error) {
+	if vmpl < 0 || vmpl >= VmpckCount {
+		return nil, fmt.Errorf("vmpl %d is out of range. Expect 0-%d", vmpl, VmpckCount-1)
+	}
+	key := make([]byte, VmpckSize)
+	copy(key, p.vmpck[vmpl][:])
+	return key, nil
+}
+
+// SetVmpck sets the VM platform communication key for the given VMPL.
+func (p *SecretsPage) SetVmpck(vmpl int, key []byte) error {
+	if vmpl < 0 || vmpl >= VmpckCount {
+		return fmt.Errorf("vmpl %d is out of range. Expect 0-%d", vmpl, VmpckCount-1)
+	}
+	if len(key) != VmpckSize {
+		return fmt.Errorf("vmpck length is %d bytes. Expect %d", len(key), VmpckSize)
+	}
+	copy(p.vmpck[vmpl][:], key)
+	return nil
+}
+
+// String returns a rendering of the secrets page that never includes key material. Each VMPCK is
+// only described as present or wiped.
+func (p SecretsPage) String() string {
+	var keys [VmpckCount]string
+	for i, key := range p.vmpck {
+		keys[i] = "wiped"
+		if findNonZero(key[:], 0, VmpckSize) != VmpckSize {
+			keys[i] = "present"
+		}
+	}
+	return fmt.Sprintf("{Version: %d, ImiEn: %t, Fms: 0x%x, Gosvw: %s, Vmpck0: %s, Vmpck1: %s, Vmpck2: %s, Vmpck3: %s, TscFactor: %d}",
+		p.Version, p.ImiEn, p.Fms, hex.EncodeToString(p.Gosvw[:]), keys[0], keys[1], keys[2], keys[3],
+		p.TscFactor)
+}
+
+// GoString implements fmt.GoStringer so that %#v also redacts key material.
+func (p SecretsPage) GoString() string {
+	return "abi.SecretsPage" + p.String()
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func testSecretsPage(t *testing.T) []byte {
+	t.Helper()
+	data := make([]byte, SecretsPageSize)
+	binary.LittleEndian.PutUint32(data[0x00:], 3)
+	binary.LittleEndian.PutUint32(data[0x04:], 1)
+	binary.LittleEndian.PutUint32(data[0x08:], 0x00a00f11)
+	data[0x10] = 0x5
+	for i := 0; i < VmpckCount; i++ {
+		if i == 2 {
+			continue // Leave VMPCK2 wiped.
+		}
+		copy(data[0x20+i*VmpckSize:], bytes.Repeat([]byte{0xa0 + byte(i)}, VmpckSize))
+	}
+	data[0xA0] = 0x7
+	data[0x100] = 0x1
+	binary.LittleEndian.PutUint32(data[0x160:], 1000)
+	return data
+}
+
+func TestSecretsPage(t *testing.T) {
+	data := testSecretsPage(t)
+	p, err := ParseSecretsPage(data)
+	if err != nil {
+		t.Fatalf("ParseSecretsPage() = _, %v. Want nil", err)
+	}
+	if p.Version != 3 || !p.ImiEn || p.Fms != 0x00a00f11 || p.Gosvw[0] != 0x5 || p.OSArea[0] != 0x7 ||
+		p.VmsaTweakBitmap[0] != 0x1 || p.TscFactor != 1000 {
+		t.Errorf("ParseSecretsPage() = %v, want fields from test page", p)
+	}
+	key, err := p.Vmpck(1)
+	if err != nil {
+		t.Fatalf("p.Vmpck(1) = _, %v. Want nil", err)
+	}
+	if want := bytes.Repeat([]byte{0xa1}, VmpckSize); !bytes.Equal(key, want) {
+		t.Errorf("p.Vmpck(1) = %v, want %v", key, want)
+	}
+	key[0] = 0 // Must not alias the page.
+	if again, _ := p.Vmpck(1); again[0] != 0xa1 {
+		t.Error("p.Vmpck(1) result aliases the secrets page")
+	}
+	if _, err := p.Vmpck(4); err == nil {
+		t.Error("p.Vmpck(4) = _, nil. Want error")
+	}
+	if got := p.Marshal(); !bytes.Equal(got, data) {
+		t.Errorf("p.Marshal() = %v, want %v", got, data)
+	}
+
+	newKey := bytes.Repeat([]byte{0xff}, VmpckSize)
+	if err := p.SetVmpck(2, newKey); err != nil {
+		t.Fatalf("p.SetVmpck(2, _) = %v. Want nil", err)
+	}
+	if got, _ := p.Vmpck(2); !bytes.Equal(got, newKey) {
+		t.Errorf("p.Vmpck(2) = %v after SetVmpck, want %v", got, newKey)
+	}
+	if err := p.SetVmpck(0, []byte{1}); err == nil {
+		t.Error("p.SetVmpck(0, short) = nil. Want error")
+	}
+}
+
+func TestSecretsPageRedaction(t *testing.T) {
+	p, err := ParseSecretsPage(testSecretsPage(t))
+	if err != nil {
+		t.Fatalf("ParseSecretsPage() = _, %v. Want nil", err)
+	}
+	for i := 0; i < VmpckCount; i++ {
+		key, _ := p.Vmpck(i)
+		redacted := hex.EncodeToString(key)
+		for _, rendering := range []string{
+			p.String(), fmt.Sprintf("%v", p), fmt.Sprintf("%+v", *p), fmt.Sprintf("%#v", p), fmt.Sprintf("%s", p),
+		} {
+			if i != 2 && strings.Contains(rendering, redacted) {
+				t.Errorf("secrets page rendering %q contains VMPCK%d", rendering, i)
+			}
+		}
+	}
+	want := "Vmpck0: present, Vmpck1: present, Vmpck2: wiped, Vmpck3: present"
+	if got := p.String(); !strings.Contains(got, want) {
+		t.Errorf("p.String() = %q, want it to contain %q", got, want)
+	}
+}
+
+func TestParseSecretsPageErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		offset  int
+		wantErr string
+	}{
+		{name: "flags", offset: 0x04, wantErr: "mbz range secrets[0x04:0x08]"},
+		{name: "reserved2", offset: 0x0C, wantErr: "secrets page: mbz range [0xc:0x10]"},
+		{name: "reserved3", offset: 0x140, wantErr: "secrets page: mbz range [0x140:0x160]"},
+		{name: "reserved4", offset: 0xFFF, wantErr: "secrets page: mbz range [0x164:0x1000]"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			data := make([]byte, SecretsPageSize)
+			data[tc.offset] = 0x2
+			if _, err := ParseSecretsPage(data); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ParseSecretsPage() = _, %v. Want error %q", err, tc.wantErr)
+			}
+		})
+	}
+	if _, err := ParseSecretsPage(make([]byte, 1)); err == nil {
+		t.Error("ParseSecretsPage(short) = _, nil. Want error")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"fmt"
+
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+	"google.golang.org/protobuf/proto"
+)
+
+// ReportView is a version-independent view of an attestation report. Accessors for fields that
+// only some report versions define say whether the field is present, so callers need not branch on
+// the report version themselves.
+type ReportView struct {
+	report *pb.Report
+}
+
+// NormalizeReport returns a version-independent view of report. It is an error for the report to
+// have an unsupported version, or to populate fields its version does not define.
+func NormalizeReport(report *pb.Report) (*ReportView, error) {
+	if report == nil {
+		return nil, fmt.Errorf("report cannot be nil")
+	}
+	version := report.GetVersion()
+	if version < MinSupportedReportVersion || version > MaxSupportedReportVersion {
+		return nil, fmt.Errorf("%w: report version is: %d. Expected between %d and %d", ErrUnsupportedVersion,
+			version, MinSupportedReportVersion, MaxSupportedReportVersion)
+	}
+	if err := checkVersionFields(report, version); err != nil {
+		return nil, err
+	}
+	return &ReportView{report: report}, nil
+}
+
+// Report returns the underlying report.
+func (v *ReportView) Report() *pb.Report {
+	return v.report
+}
+
+// Cpuid1EaxFms returns the report's CPUID[1].EAX family, model, and stepping and whether the report
+// provides it. Reports before version 3 do not.
+func (v *ReportView) Cpuid1EaxFms() (uint32, bool) {
+	return ReportCpuid1EaxFms(v.report)
+}
+
+// ReportCpuid1EaxFms returns the report's CPUID[1].EAX family, model, and stepping and whether the
+// report provides it. Reports before version 3 do not, and a version 3 report with zero FMS is
+// treated as not providing it.
+func ReportCpuid1EaxFms(report *pb.Report) (uint32, bool) {
+	fms := report.GetCpuid1EaxFms()
+	return fms, report.GetVersion() >= ReportVersion3 && fms != 0
+}
+
+// MitVectors returns the report's launch and current mitigation vectors and whether the report
+// provides them. Reports before version 5 do not.
+func (v *ReportView) MitVectors() (launch, current uint64, ok bool) {
+	return v.report.GetLaunchMitVector(), v.report.GetCurrentMitVector(), v.report.GetVersion() >= ReportVersion5
+}
+
+func checkVersionFields(report *pb.Report, version uint32) error {
+	if version < ReportVersion3 && report.GetCpuid1EaxFms() != 0 {
+		return fmt.Errorf("report version %d cannot represent cpuid1eax_fms 0x%x", version,
+			report.GetCpuid1EaxFms())
+	}
+	if version < ReportVersion5 && (report.GetLaunchMitVector() != 0 || report.GetCurrentMitVector() != 0) {
+		return fmt.Errorf("report version %d cannot represent launch_mit_vector 0x%x or current_mit_vector 0x%x",
+			version, report.GetLaunchMitVector(), report.GetCurrentMitVector())
+	}
+	return nil
+}
+
+// ConvertReportVersion returns a copy of report in the format of the given report version. It is an
+// error if the target version cannot represent a field the report populates. The converted report's
+// signature no longer verifies, since the signature covers the version field.
+func ConvertReportVersion(report *pb.Report, version uint32) (*pb.Report, error) {
+	if report == nil {
+		return nil, fmt.Errorf("report cannot be nil")
+	}
+	if version < MinSupportedReportVersion || version > MaxSupportedReportVersion {
+		return nil, fmt.Errorf("%w: target report version is: %d. Expected between %d and %d",
+			ErrUnsupportedVersion, version, MinSupportedReportVersion, MaxSupportedReportVersion)
+	}
+	if err := checkVersionFields(report, version); err != nil {
+		return nil, fmt.Errorf("conversion from version %d would lose fields: %v", report.GetVersion(), err)
+	}
+	result := proto.Clone(report).(*pb.Report)
+	result.Version = version
+	return result, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+func TestNormalizeReport(t *testing.T) {
+	v2 := &spb.Report{Version: ReportVersion2}
+	view, err := NormalizeReport(v2)
+	if err != nil {
+		t.Fatalf("NormalizeReport(v2) = _, %v. Want nil", err)
+	}
+	if _, ok := view.Cpuid1EaxFms(); ok {
+		t.Error("NormalizeReport(v2).Cpuid1EaxFms() present, want absent")
+	}
+	if _, _, ok := view.MitVectors(); ok {
+		t.Error("NormalizeReport(v2).MitVectors() present, want absent")
+	}
+
+	v5 := &spb.Report{Version: ReportVersion5, Cpuid1EaxFms: 0x00a00f11, LaunchMitVector: 3}
+	view, err = NormalizeReport(v5)
+	if err != nil {
+		t.Fatalf("NormalizeReport(v5) = _, %v. Want nil", err)
+	}
+	if fms, ok := view.Cpuid1EaxFms(); !ok || fms != 0x00a00f11 {
+		t.Errorf("NormalizeReport(v5).Cpuid1EaxFms() = 0x%x, %t. Want 0x00a00f11, true", fms, ok)
+	}
+	if launch, _, ok := view.MitVectors(); !ok || launch != 3 {
+		t.Errorf("NormalizeReport(v5).MitVectors() = %d, _, %t. Want 3, _, true", launch, ok)
+	}
+
+	if _, err := NormalizeReport(&spb.Report{Version: ReportVersion2, Cpuid1EaxFms: 1}); err == nil {
+		t.Error("NormalizeReport(v2 with FMS) = _, nil. Want error")
+	}
+	if _, err := NormalizeReport(&spb.Report{Version: 1}); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("NormalizeReport(v1) = _, %v. Want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestConvertReportVersion(t *testing.T) {
+	tcs := []struct {
+		name    string
+		report  *spb.Report
+		version uint32
+		wantErr string
+	}{
+		{name: "up", report: &spb.Report{Version: ReportVersion2}, version: ReportVersion3},
+		{name: "down lossless", report: &spb.Report{Version: ReportVersion5}, version: ReportVersion2},
+		{
+			name:    "down loses fms",
+			report:  &spb.Report{Version: ReportVersion3, Cpuid1EaxFms: 0x00a00f11},
+			version: ReportVersion2,
+			wantErr: "would lose fields: report version 2 cannot represent cpuid1eax_fms",
+		},
+		{
+			name:    "down loses mit vector",
+			report:  &spb.Report{Version: ReportVersion5, CurrentMitVector: 1},
+			version: ReportVersion4,
+			wantErr: "cannot represent launch_mit_vector 0x0 or current_mit_vector 0x1",
+		},
+		{name: "unsupported", report: &spb.Report{Version: ReportVersion2}, version: 6, wantErr: "unsupported report version"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ConvertReportVersion(tc.report, tc.version)
+			if (err == nil) != (tc.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("ConvertReportVersion() = _, %v. Want error %q", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.GetVersion() != tc.version {
+				t.Errorf("ConvertReportVersion() version = %d, want %d", got.GetVersion(), tc.version)
+			}
+			if got == tc.report {
+				t.Error("ConvertReportVersion() returned its input, want a copy")
+			}
+		})
+	}
+}
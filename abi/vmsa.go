@@ -0,0 +1,338 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+const (
+	// VmsaSize is the size in bytes of a VM save area page.
+	VmsaSize = 0x1000
+	// VmsaGPA is the guest physical address that the SEV-SNP launch digest associates with each
+	// VMSA page.
+	VmsaGPA = 0xFFFFFFFFF000
+	// LaunchDigestSize is the size in bytes of the SEV-SNP launch digest (SHA-384).
+	LaunchDigestSize = 48
+	// PageInfoSize is the size in bytes of the PAGE_INFO structure hashed into the launch digest.
+	PageInfoSize = 0x70
+
+	// PageTypeNormal is the PAGE_INFO PAGE_TYPE value for a normal data page.
+	PageTypeNormal = 0x1
+	// PageTypeVmsa is the PAGE_INFO PAGE_TYPE value for a VMSA page.
+	PageTypeVmsa = 0x2
+	// PageTypeZero is the PAGE_INFO PAGE_TYPE value for a zero page.
+	PageTypeZero = 0x3
+	// PageTypeUnmeasured is the PAGE_INFO PAGE_TYPE value for an unmeasured page.
+	PageTypeUnmeasured = 0x4
+	// PageTypeSecrets is the PAGE_INFO PAGE_TYPE value for the secrets page.
+	PageTypeSecrets = 0x5
+	// PageTypeCpuid is the PAGE_INFO PAGE_TYPE value for the CPUID page.
+	PageTypeCpuid = 0x6
+)
+
+// VmcbSeg is a segment register in the VMCB save area format.
+type VmcbSeg struct {
+	Selector uint16
+	Attrib   uint16
+	Limit    uint32
+	Base     uint64
+}
+
+// Vmsa represents the SEV-ES/SEV-SNP VM save area (VMSA) page. Reserved areas are not represented
+// and must be zero.
+//
+// See AMD64 Architecture Programmer's Manual Volume 2, Table B-4 "VMSA Layout, State Save Area for
+// SEV-ES".
+type Vmsa struct {
+	Es, Cs, Ss, Ds, Fs, Gs, Gdtr, Ldtr, Idtr, Tr VmcbSeg // 0x000
+
+	Vmpl0Ssp uint64 // 0x0A0
+	Vmpl1Ssp uint64
+	Vmpl2Ssp uint64
+	Vmpl3Ssp uint64
+	UCet     uint64 // 0x0C0
+	_        [2]byte
+	Vmpl     uint8 // 0x0CA
+	Cpl      uint8
+	_        [4]byte
+	Efer     uint64 // 0x0D0
+	_        [104]byte
+
+	Xss         uint64 // 0x140
+	Cr4         uint64
+	Cr3         uint64
+	Cr0         uint64
+	Dr7         uint64
+	Dr6         uint64
+	Rflags      uint64
+	Rip         uint64 // 0x178
+	Dr0         uint64
+	Dr1         uint64
+	Dr2         uint64
+	Dr3         uint64
+	Dr0AddrMask uint64 // 0x1A0
+	Dr1AddrMask uint64
+	Dr2AddrMask uint64
+	Dr3AddrMask uint64
+	_           [24]byte
+
+	Rsp          uint64 // 0x1D8
+	SCet         uint64
+	Ssp          uint64
+	IsstAddr     uint64
+	Rax          uint64 // 0x1F8
+	Star         uint64
+	Lstar        uint64
+	Cstar        uint64
+	Sfmask       uint64
+	KernelGsBase uint64
+	SysenterCs   uint64
+	SysenterEsp  uint64
+	SysenterEip  uint64
+	Cr2          uint64 // 0x240
+	_            [32]byte
+
+	GPat         uint64 // 0x268
+	Dbgctl       uint64
+	BrFrom       uint64
+	BrTo         uint64
+	LastExcpFrom uint64
+	LastExcpTo   uint64
+	_            [80]byte
+
+	Pkru   uint32 // 0x2E8
+	TscAux uint32
+	_      [24]byte
+
+	Rcx uint64 // 0x308
+	Rdx uint64
+	Rbx uint64
+	_   uint64 // RSP is at 0x1D8.
+	Rbp uint64
+	Rsi uint64
+	Rdi uint64
+	R8  uint64 // 0x340
+	R9  uint64
+	R10 uint64
+	R11 uint64
+	R12 uint64
+	R13 uint64
+	R14 uint64
+	R15 uint64
+	_   [16]byte
+
+	GuestExitInfo1   uint64 // 0x390
+	GuestExitInfo2   uint64
+	GuestExitIntInfo uint64
+	GuestNrip        uint64
+	SevFeatures      uint64 // 0x3B0
+	VintrCtrl        uint64
+	GuestExitCode    uint64
+	VirtualTom       uint64
+	TlbID            uint64
+	PcpuID           uint64
+	EventInj         uint64
+	Xcr0             uint64 // 0x3E8
+	_                [16]byte
+
+	X87Dp    uint64 // 0x400
+	Mxcsr    uint32
+	X87Ftw   uint16
+	X87Fsw   uint16
+	X87Fcw   uint16 // 0x410
+	X87Fop   uint16
+	X87Ds    uint16
+	X87Cs    uint16
+	X87Rip   uint64
+	FpregX87 [80]byte  // 0x420
+	FpregXmm [256]byte // 0x470
+	FpregYmm [256]byte // 0x570
+	_        [VmsaSize - 0x670]byte
+}
+
+// ParseVmsa returns the VMSA represented by the given page, or an error if the page is the wrong
+// size or has non-zero reserved bytes.
+func ParseVmsa(data []byte) (*Vmsa, error) {
+	if len(data) != VmsaSize {
+		return nil, fmt.Errorf("VMSA size is 0x%x bytes. Expect 0x%x", len(data), VmsaSize)
+	}
+	v := &Vmsa{}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, v); err != nil {
+		return nil, fmt.Errorf("could not parse VMSA: %v", err)
+	}
+	// Reserved areas are skipped when reading and written as zero, so a lossy round trip means a
+	// reserved byte was set.
+	again, err := v.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if i := firstDifference(data, again); i >= 0 {
+		return nil, fmt.Errorf("VMSA reserved byte 0x%x is not zero: 0x%x", i, data[i])
+	}
+	return v, nil
+}
+
+func firstDifference(a, b []byte) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// Marshal returns the VMSA in its page ABI format.
+func (v *Vmsa) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(VmsaSize)
+	if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+		return nil, fmt.Errorf("could not marshal VMSA: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// VMMType identifies a virtual machine monitor whose vCPU reset state differs from others.
+type VMMType int
+
+const (
+	// VMMTypeQEMU is the reset state that QEMU/KVM uses.
+	VMMTypeQEMU VMMType = iota
+	// VMMTypeEC2 is the reset state that Amazon EC2 uses.
+	VMMTypeEC2
+)
+
+// ResetVmsa returns the VMSA of a vCPU in its reset state for a VMM that starts execution at eip.
+// The vcpuSig is the CPUID[1].EAX signature the VMM places in RDX at reset, and sevFeatures is the
+// SEV_FEATURES value the VMM gives the guest.
+func ResetVmsa(vmm VMMType, eip uint32, sevFeatures uint64, vcpuSig uint32) (*Vmsa, error) {
+	var csFlags, ssFlags, trFlags uint16
+	var rdx uint64
+	var mxcsr uint32
+	var fcw uint16
+	switch vmm {
+	case VMMTypeQEMU:
+		csFlags = 0x9b
+		ssFlags = 0x93
+		trFlags = 0x8b
+		rdx = uint64(vcpuSig)
+		mxcsr = 0x1f80
+		fcw = 0x37f
+	case VMMTypeEC2:
+		csFlags = 0x9b
+		if eip == 0xfffffff0 {
+			csFlags = 0x9a
+		}
+		ssFlags = 0x92
+		trFlags = 0x83
+	default:
+		return nil, fmt.Errorf("unknown VMM type %d", vmm)
+	}
+	return &Vmsa{
+		Es:          VmcbSeg{Attrib: 0x93, Limit: 0xffff},
+		Cs:          VmcbSeg{Selector: 0xf000, Attrib: csFlags, Limit: 0xffff, Base: uint64(eip & 0xffff0000)},
+		Ss:          VmcbSeg{Attrib: ssFlags, Limit: 0xffff},
+		Ds:          VmcbSeg{Attrib: 0x93, Limit: 0xffff},
+		Fs:          VmcbSeg{Attrib: 0x93, Limit: 0xffff},
+		Gs:          VmcbSeg{Attrib: 0x93, Limit: 0xffff},
+		Gdtr:        VmcbSeg{Limit: 0xffff},
+		Ldtr:        VmcbSeg{Attrib: 0x82, Limit: 0xffff},
+		Idtr:        VmcbSeg{Limit: 0xffff},
+		Tr:          VmcbSeg{Attrib: trFlags, Limit: 0xffff},
+		Efer:        0x1000,
+		Cr4:         0x40,
+		Cr0:         0x10,
+		Dr7:         0x400,
+		Dr6:         0xffff0ff0,
+		Rflags:      0x2,
+		Rip:         uint64(eip & 0xffff),
+		GPat:        0x7040600070406,
+		Rdx:         rdx,
+		SevFeatures: sevFeatures,
+		Xcr0:        0x1,
+		Mxcsr:       mxcsr,
+		X87Fcw:      fcw,
+	}, nil
+}
+
+// PageInfo represents the PAGE_INFO structure that the SEV-SNP firmware hashes to extend the
+// launch digest with each page added to the guest.
+type PageInfo struct {
+	// DigestCur is the launch digest before this page is added.
+	DigestCur [LaunchDigestSize]byte
+	// Contents is the SHA-384 digest of the page, or zero for page types that are not measured by
+	// content.
+	Contents   [LaunchDigestSize]byte
+	PageType   uint8
+	ImiPage    bool
+	Vmpl3Perms uint8
+	Vmpl2Perms uint8
+	Vmpl1Perms uint8
+	GPA        uint64
+}
+
+// Marshal returns the PAGE_INFO in its ABI format.
+func (p *PageInfo) Marshal() []byte {
+	data := make([]byte, PageInfoSize)
+	copy(data[0x00:0x30], p.DigestCur[:])
+	copy(data[0x30:0x60], p.Contents[:])
+	binary.LittleEndian.PutUint16(data[0x60:0x62], PageInfoSize)
+	data[0x62] = p.PageType
+	if p.ImiPage {
+		data[0x63] = 1
+	}
+	data[0x64] = p.Vmpl3Perms
+	data[0x65] = p.Vmpl2Perms
+	data[0x66] = p.Vmpl1Perms
+	binary.LittleEndian.PutUint64(data[0x68:0x70], p.GPA)
+	return data
+}
+
+// Digest returns the launch digest after the page described by p is added.
+func (p *PageInfo) Digest() [LaunchDigestSize]byte {
+	return sha512.Sum384(p.Marshal())
+}
+
+// SnpLaunchDigestUpdateVmsa returns the SEV-SNP launch digest after adding the given VMSA page
+// to a launch whose digest so far is digestCur.
+func SnpLaunchDigestUpdateVmsa(digestCur [LaunchDigestSize]byte, vmsa *Vmsa) ([LaunchDigestSize]byte, error) {
+	page, err := vmsa.Marshal()
+	if err != nil {
+		return [LaunchDigestSize]byte{}, err
+	}
+	info := &PageInfo{
+		DigestCur: digestCur,
+		Contents:  sha512.Sum384(page),
+		PageType:  PageTypeVmsa,
+		GPA:       VmsaGPA,
+	}
+	return info.Digest(), nil
+}
+
+// SevEsLaunchDigestUpdateVmsa adds the given VMSA page to an SEV-ES launch measurement in
+// progress. SEV-ES measures the guest as a SHA-256 digest over the contents of every page in
+// launch order, so h should be the sha256 hash of all prior launch pages.
+func SevEsLaunchDigestUpdateVmsa(h hash.Hash, vmsa *Vmsa) error {
+	page, err := vmsa.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = h.Write(page)
+	return err
+}
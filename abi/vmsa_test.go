@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestVmsaLayout(t *testing.T) {
+	v, err := ResetVmsa(VMMTypeQEMU, 0xfffffff0, 0x1, 0x00a00f11)
+	if err != nil {
+		t.Fatalf("ResetVmsa() = _, %v. Want nil", err)
+	}
+	page, err := v.Marshal()
+	if err != nil {
+		t.Fatalf("v.Marshal() = _, %v. Want nil", err)
+	}
+	if len(page) != VmsaSize {
+		t.Fatalf("len(v.Marshal()) = 0x%x, want 0x%x", len(page), VmsaSize)
+	}
+	u16 := func(offset int) uint64 { return uint64(binary.LittleEndian.Uint16(page[offset:])) }
+	u32 := func(offset int) uint64 { return uint64(binary.LittleEndian.Uint32(page[offset:])) }
+	u64 := func(offset int) uint64 { return binary.LittleEndian.Uint64(page[offset:]) }
+	tcs := []struct {
+		name string
+		got  uint64
+		want uint64
+	}{
+		{"cs.selector", u16(0x10), 0xf000},
+		{"cs.attrib", u16(0x12), 0x9b},
+		{"cs.base", u64(0x18), 0xffff0000},
+		{"tr.attrib", u16(0x92), 0x8b},
+		{"efer", u64(0xD0), 0x1000},
+		{"cr4", u64(0x148), 0x40},
+		{"rip", u64(0x178), 0xfff0},
+		{"g_pat", u64(0x268), 0x7040600070406},
+		{"rdx", u64(0x310), 0x00a00f11},
+		{"sev_features", u64(0x3B0), 0x1},
+		{"xcr0", u64(0x3E8), 0x1},
+		{"mxcsr", u32(0x408), 0x1f80},
+		{"x87_fcw", u16(0x410), 0x37f},
+	}
+	for _, tc := range tcs {
+		if tc.got != tc.want {
+			t.Errorf("VMSA %s = 0x%x, want 0x%x", tc.name, tc.got, tc.want)
+		}
+	}
+
+	got, err := ParseVmsa(page)
+	if err != nil {
+		t.Fatalf("ParseVmsa(v.Marshal()) = _, %v. Want nil", err)
+	}
+	if *got != *v {
+		t.Errorf("ParseVmsa(v.Marshal()) = %+v, want %+v", got, v)
+	}
+}
+
+func TestParseVmsaErrors(t *testing.T) {
+	if _, err := ParseVmsa(make([]byte, 10)); err == nil || !strings.Contains(err.Error(), "VMSA size is 0xa bytes") {
+		t.Errorf("ParseVmsa(short) = _, %v. Want size error", err)
+	}
+	page := make([]byte, VmsaSize)
+	page[0xCC] = 1
+	if _, err := ParseVmsa(page); err == nil || !strings.Contains(err.Error(), "VMSA reserved byte 0xcc is not zero") {
+		t.Errorf("ParseVmsa(reserved set) = _, %v. Want reserved byte error", err)
+	}
+	if _, err := ResetVmsa(VMMType(99), 0, 0, 0); err == nil {
+		t.Error("ResetVmsa(99, ...) = _, nil. Want error")
+	}
+}
+
+func TestLaunchDigestUpdateVmsa(t *testing.T) {
+	v, err := ResetVmsa(VMMTypeEC2, 0xfffffff0, 0, 0)
+	if err != nil {
+		t.Fatalf("ResetVmsa() = _, %v. Want nil", err)
+	}
+	if v.Cs.Attrib != 0x9a {
+		t.Errorf("EC2 reset vector cs.attrib = 0x%x, want 0x9a", v.Cs.Attrib)
+	}
+	page, _ := v.Marshal()
+
+	var digest [LaunchDigestSize]byte
+	digest[0] = 0x11
+	got, err := SnpLaunchDigestUpdateVmsa(digest, v)
+	if err != nil {
+		t.Fatalf("SnpLaunchDigestUpdateVmsa() = _, %v. Want nil", err)
+	}
+	pageInfo := make([]byte, PageInfoSize)
+	copy(pageInfo, digest[:])
+	contents := sha512.Sum384(page)
+	copy(pageInfo[0x30:], contents[:])
+	pageInfo[0x60] = PageInfoSize
+	pageInfo[0x62] = PageTypeVmsa
+	binary.LittleEndian.PutUint64(pageInfo[0x68:], VmsaGPA)
+	if want := sha512.Sum384(pageInfo); got != want {
+		t.Errorf("SnpLaunchDigestUpdateVmsa() = %x, want %x", got, want)
+	}
+
+	h := sha256.New()
+	if err := SevEsLaunchDigestUpdateVmsa(h, v); err != nil {
+		t.Fatalf("SevEsLaunchDigestUpdateVmsa() = %v. Want nil", err)
+	}
+	if want := sha256.Sum256(page); !bytes.Equal(h.Sum(nil), want[:]) {
+		t.Errorf("SevEsLaunchDigestUpdateVmsa() digest = %x, want %x", h.Sum(nil), want)
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/uuid"
+)
+
+// On Azure confidential VMs, the paravisor (HCL) owns VMPL0 and exposes the SEV-SNP attestation
+// report to the guest through vTPM NV indices rather than through /dev/sev-guest. Writing report
+// data to hclReportDataNvIndex causes the HCL to request a fresh report, which can then be read
+// from hclReportNvIndex as the HCL report that abi.ParseHclReport parses.
+//
+// The SNP report's REPORT_DATA is a digest of the runtime data claims, which carry the caller's
+// report data as "user-data". Verifiers must check that binding themselves.
+const (
+	hclReportNvIndex     = 0x01400001
+	hclReportDataNvIndex = 0x01400002
+
+	tpmStNoSessions    = 0x8001
+	tpmStSessions      = 0x8002
+	tpmRhOwner         = 0x40000001
+	tpmRsPw            = 0x40000009
+	tpmCcNvDefineSpace = 0x0000012A
+	tpmCcNvWrite       = 0x00000137
+	tpmCcNvRead        = 0x0000014E
+	tpmCcNvReadPublic  = 0x00000169
+	tpmRcSuccess       = 0
+	tpmAlgSha256       = 0x000B
+	tpmNvBufferMax     = 1024
+	tpmMaxResponseSize = 4096
+	tpmaNvOwnerWrite   = 0x00000002
+	tpmaNvAuthWrite    = 0x00000004
+	tpmaNvOwnerRead    = 0x00020000
+	tpmaNvAuthRead     = 0x00040000
+	tpmRcFmt1          = 0x080
+	tpmRcNumberMask    = 0x03F
+	tpmRcHandle        = 0x00B // The format-one error number reported for an undefined NV index.
+)
+
+// tpmCommander sends a marshaled TPM 2.0 command and returns the marshaled response.
+type tpmCommander interface {
+	SendCommand(command []byte) ([]byte, error)
+}
+
+// tpmError is a nonzero TPM 2.0 response code.
+type tpmError uint32
+
+func (e tpmError) Error() string {
+	return fmt.Sprintf("TPM error 0x%x", uint32(e))
+}
+
+func (e tpmError) handleNotDefined() bool {
+	// Format-one response codes carry the parameter/handle number in bits 8-11. Only the error
+	// number identifies TPM_RC_HANDLE.
+	return uint32(e)&tpmRcFmt1 != 0 && uint32(e)&tpmRcNumberMask == tpmRcHandle
+}
+
+type tpmBuffer struct {
+	data []byte
+}
+
+func (b *tpmBuffer) u16(v uint16) { b.data = binary.BigEndian.AppendUint16(b.data, v) }
+func (b *tpmBuffer) u32(v uint32) { b.data = binary.BigEndian.AppendUint32(b.data, v) }
+func (b *tpmBuffer) tpm2b(v []byte) {
+	b.u16(uint16(len(v)))
+	b.data = append(b.data, v...)
+}
+
+// tpmCommand returns a marshaled command. If authorized, the command carries an empty password
+// session for its first handle.
+func tpmCommand(cc uint32, handles []uint32, authorized bool, params []byte) []byte {
+	b := &tpmBuffer{}
+	tag := uint16(tpmStNoSessions)
+	if authorized {
+		tag = tpmStSessions
+	}
+	b.u16(tag)
+	b.u32(0) // Size placeholder.
+	b.u32(cc)
+	for _, h := range handles {
+		b.u32(h)
+	}
+	if authorized {
+		b.u32(9)       // Authorization area size.
+		b.u32(tpmRsPw) // Password session.
+		b.u16(0)       // Empty nonce.
+		b.data = append(b.data, 0)
+		b.u16(0) // Empty password.
+	}
+	b.data = append(b.data, params...)
+	binary.BigEndian.PutUint32(b.data[2:6], uint32(len(b.data)))
+	return b.data
+}
+
+// tpmResponseParams checks the response header and returns the response parameters.
+func tpmResponseParams(resp []byte, authorized bool) ([]byte, error) {
+	if len(resp) < 10 {
+		return nil, fmt.Errorf("TPM response is %d bytes. Expect at least 10", len(resp))
+	}
+	if size := binary.BigEndian.Uint32(resp[2:6]); int(size) != len(resp) {
+		return nil, fmt.Errorf("TPM response size field is %d. Expect %d", size, len(resp))
+	}
+	if rc := binary.BigEndian.Uint32(resp[6:10]); rc != tpmRcSuccess {
+		return nil, tpmError(rc)
+	}
+	params := resp[10:]
+	if authorized {
+		if len(params) < 4 {
+			return nil, fmt.Errorf("TPM response is missing its parameter size")
+		}
+		size := binary.BigEndian.Uint32(params[0:4])
+		if int(size) > len(params)-4 {
+			return nil, fmt.Errorf("TPM response parameter size %d exceeds the response", size)
+		}
+		params = params[4 : 4+size]
+	}
+	return params, nil
+}
+
+func tpmSend(t tpmCommander, cc uint32, handles []uint32, authorized bool, params []byte) ([]byte, error) {
+	resp, err := t.SendCommand(tpmCommand(cc, handles, authorized, params))
+	if err != nil {
+		return nil, err
+	}
+	return tpmResponseParams(resp, authorized)
+}
+
+// nvSize returns the data size of the NV index.
+func nvSize(t tpmCommander, index uint32) (int, error) {
+	params, err := tpmSend(t, tpmCcNvReadPublic, []uint32{index}, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	// TPM2B_NV_PUBLIC{size, nvIndex, nameAlg, attributes, TPM2B authPolicy, dataSize}
+	if len(params) < 14 {
+		return 0, fmt.Errorf("NV index 0x%x public area is truncated", index)
+	}
+	policySize := int(binary.BigEndian.Uint16(params[12:14]))
+	if len(params) < 16+policySize {
+		return 0, fmt.Errorf("NV index 0x%x public area is truncated", index)
+	}
+	return int(binary.BigEndian.Uint16(params[14+policySize : 16+policySize])), nil
+}
+
+// nvRead returns the full contents of the NV index, read in chunks no larger than the minimum
+// NV buffer size a TPM must support.
+func nvRead(t tpmCommander, index uint32) ([]byte, error) {
+	size, err := nvSize(t, index)
+	if err != nil {
+		return nil, err
+	}
+	var result []byte
+	for offset := 0; offset < size; {
+		chunk := size - offset
+		if chunk > tpmNvBufferMax {
+			chunk = tpmNvBufferMax
+		}
+		b := &tpmBuffer{}
+		b.u16(uint16(chunk))
+		b.u16(uint16(offset))
+		params, err := tpmSend(t, tpmCcNvRead, []uint32{tpmRhOwner, index}, true, b.data)
+		if err != nil {
+			return nil, fmt.Errorf("could not read NV index 0x%x at offset %d: %v", index, offset, err)
+		}
+		if len(params) < 2 || int(binary.BigEndian.Uint16(params[0:2])) != len(params)-2 {
+			return nil, fmt.Errorf("NV index 0x%x read response is malformed", index)
+		}
+		if len(params) == 2 {
+			return nil, fmt.Errorf("NV index 0x%x read returned no data at offset %d", index, offset)
+		}
+		result = append(result, params[2:]...)
+		offset += len(params) - 2
+	}
+	return result, nil
+}
+
+// nvWrite writes data to the NV index, defining the index first if it does not exist.
+func nvWrite(t tpmCommander, index uint32, data []byte) error {
+	if _, err := nvSize(t, index); err != nil {
+		tpmErr, ok := err.(tpmError)
+		if !ok || !tpmErr.handleNotDefined() {
+			return err
+		}
+		public := &tpmBuffer{}
+		public.u32(index)
+		public.u16(tpmAlgSha256)
+		public.u32(tpmaNvOwnerWrite | tpmaNvAuthWrite | tpmaNvOwnerRead | tpmaNvAuthRead)
+		public.tpm2b(nil) // Empty authPolicy.
+		public.u16(uint16(len(data)))
+		params := &tpmBuffer{}
+		params.tpm2b(nil) // Empty auth value.
+		params.tpm2b(public.data)
+		if _, err := tpmSend(t, tpmCcNvDefineSpace, []uint32{tpmRhOwner}, true, params.data); err != nil {
+			return fmt.Errorf("could not define NV index 0x%x: %v", index, err)
+		}
+	}
+	params := &tpmBuffer{}
+	params.tpm2b(data)
+	params.u16(0) // Offset.
+	if _, err := tpmSend(t, tpmCcNvWrite, []uint32{tpmRhOwner, index}, true, params.data); err != nil {
+		return fmt.Errorf("could not write NV index 0x%x: %v", index, err)
+	}
+	return nil
+}
+
+// hclUserData returns the report data that the HCL runtime claims carry as "user-data".
+func hclUserData(claims []byte) ([]byte, error) {
+	var runtime struct {
+		UserData string `json:"user-data"`
+	}
+	if err := json.Unmarshal(claims, &runtime); err != nil {
+		return nil, fmt.Errorf("could not parse HCL runtime claims: %v", err)
+	}
+	userData, err := hex.DecodeString(runtime.UserData)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode HCL runtime claims user-data: %v", err)
+	}
+	return userData, nil
+}
+
+// getHclRawQuote returns the raw quote the HCL produces for reportData. The certificate table
+// carries the HCL runtime claims under abi.HclRuntimeDataGUID, since the report's REPORT_DATA only
+// binds reportData through them.
+func getHclRawQuote(t tpmCommander, reportData [64]byte) ([]byte, error) {
+	if err := nvWrite(t, hclReportDataNvIndex, reportData[:]); err != nil {
+		return nil, err
+	}
+	hcl, err := nvRead(t, hclReportNvIndex)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := abi.ParseHclReport(hcl)
+	if err != nil {
+		return nil, err
+	}
+	// Another vTPM user may have written the report data index between the write and the read.
+	userData, err := hclUserData(parsed.RuntimeClaims)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(userData, reportData[:]) {
+		return nil, fmt.Errorf("HCL report is for user-data %x, not the requested %x", userData, reportData)
+	}
+	certs := &abi.CertTable{Entries: []abi.CertTableEntry{{
+		GUID:    uuid.MustParse(abi.HclRuntimeDataGUID),
+		RawCert: parsed.RuntimeClaims,
+	}}}
+	extended, err := abi.ExtendPlatformCertTable(certs.Marshal(),
+		abi.MakeExtraPlatformInfoV1(abi.QuoteProviderAzureHcl, 0, 0))
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate table: %v", err)
+	}
+	return append(parsed.Report, extended...), nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-sev-guest/abi"
+)
+
+// fakeNvTpm emulates the NV commands of a vTPM. Writing the report data index regenerates an HCL
+// report whose runtime claims carry the written data.
+type fakeNvTpm struct {
+	indices map[uint32][]byte
+	// frozen keeps the HCL report unchanged, as if another request's data replaced the written data.
+	frozen bool
+}
+
+func (f *fakeNvTpm) respond(rc uint32, authorized bool, params []byte) []byte {
+	b := &tpmBuffer{}
+	b.u16(tpmStNoSessions)
+	b.u32(0)
+	b.u32(rc)
+	if rc == tpmRcSuccess {
+		if authorized {
+			b.u32(uint32(len(params)))
+		}
+		b.data = append(b.data, params...)
+	}
+	binary.BigEndian.PutUint32(b.data[2:6], uint32(len(b.data)))
+	return b.data
+}
+
+func fakeHclClaims(userData []byte) []byte {
+	return []byte(fmt.Sprintf(`{"keys":[],"user-data":"%X"}`, userData))
+}
+
+func fakeHclReport(claims []byte) []byte {
+	data := make([]byte, abi.HclHeaderSize+abi.ReportSize+abi.HclRuntimeDataHeaderSize, 2600)
+	binary.LittleEndian.PutUint32(data[0:4], abi.HclSignature)
+	binary.LittleEndian.PutUint32(data[abi.HclHeaderSize:], abi.ReportVersion2)
+	binary.LittleEndian.PutUint64(data[abi.HclHeaderSize+0x08:], 0x30000) // Reserved policy bit 17 must be 1.
+	runtime := data[abi.HclHeaderSize+abi.ReportSize:]
+	binary.LittleEndian.PutUint32(runtime[0x08:], abi.HclReportTypeSnp)
+	binary.LittleEndian.PutUint32(runtime[0x10:], uint32(len(claims)))
+	data = append(data, claims...)
+	return data[:cap(data)]
+}
+
+func (f *fakeNvTpm) SendCommand(cmd []byte) ([]byte, error) {
+	cc := binary.BigEndian.Uint32(cmd[6:10])
+	switch cc {
+	case tpmCcNvReadPublic:
+		data, ok := f.indices[binary.BigEndian.Uint32(cmd[10:14])]
+		if !ok {
+			return f.respond(tpmRcFmt1|0x100|tpmRcHandle, false, nil), nil
+		}
+		b := &tpmBuffer{}
+		b.u16(14)
+		b.u32(binary.BigEndian.Uint32(cmd[10:14]))
+		b.u16(tpmAlgSha256)
+		b.u32(0)
+		b.u16(0)
+		b.u16(uint16(len(data)))
+		b.u16(0) // Empty name.
+		return f.respond(tpmRcSuccess, false, b.data), nil
+	case tpmCcNvRead:
+		data := f.indices[binary.BigEndian.Uint32(cmd[14:18])]
+		params := cmd[18+4+9:]
+		size, offset := binary.BigEndian.Uint16(params[0:2]), binary.BigEndian.Uint16(params[2:4])
+		if size > tpmNvBufferMax {
+			return f.respond(0x1D5, true, nil), nil // TPM_RC_SIZE
+		}
+		b := &tpmBuffer{}
+		b.tpm2b(data[offset : offset+size])
+		return f.respond(tpmRcSuccess, true, b.data), nil
+	case tpmCcNvDefineSpace:
+		public := cmd[14+4+9+2+2:]
+		f.indices[binary.BigEndian.Uint32(public[0:4])] = make([]byte, binary.BigEndian.Uint16(public[12:14]))
+		return f.respond(tpmRcSuccess, true, nil), nil
+	case tpmCcNvWrite:
+		index := binary.BigEndian.Uint32(cmd[14:18])
+		params := cmd[18+4+9:]
+		size := binary.BigEndian.Uint16(params[0:2])
+		copy(f.indices[index], params[2:2+size])
+		if index == hclReportDataNvIndex && !f.frozen {
+			f.indices[hclReportNvIndex] = fakeHclReport(fakeHclClaims(params[2 : 2+size]))
+		}
+		return f.respond(tpmRcSuccess, true, nil), nil
+	}
+	return f.respond(0x143, false, nil), nil // TPM_RC_COMMAND_CODE
+}
+
+func TestGetHclRawQuote(t *testing.T) {
+	tpm := &fakeNvTpm{indices: map[uint32][]byte{hclReportNvIndex: fakeHclReport(nil)}}
+	var reportData [64]byte
+	copy(reportData[:], "nonce")
+	raw, err := getHclRawQuote(tpm, reportData)
+	if err != nil {
+		t.Fatalf("getHclRawQuote() = _, %v. Want nil", err)
+	}
+	if _, ok := tpm.indices[hclReportDataNvIndex]; !ok {
+		t.Error("getHclRawQuote() did not define the report data NV index")
+	}
+	attestation, err := abi.ReportCertsToProto(raw)
+	if err != nil {
+		t.Fatalf("ReportCertsToProto(getHclRawQuote()) = _, %v. Want nil", err)
+	}
+	if attestation.GetReport().GetVersion() != abi.ReportVersion2 {
+		t.Errorf("getHclRawQuote() report version = %d, want %d", attestation.GetReport().GetVersion(), abi.ReportVersion2)
+	}
+	claims := attestation.GetCertificateChain().GetExtras()[abi.HclRuntimeDataGUID]
+	if want := fakeHclClaims(reportData[:]); !bytes.Equal(claims, want) {
+		t.Errorf("getHclRawQuote() runtime claims = %q, want %q", claims, want)
+	}
+	info, err := abi.ParseExtraPlatformInfo(attestation.GetCertificateChain().GetExtras()[abi.ExtraPlatformInfoGUID])
+	if err != nil {
+		t.Fatalf("ParseExtraPlatformInfo() = _, %v. Want nil", err)
+	}
+	if info.Provider != abi.QuoteProviderAzureHcl {
+		t.Errorf("getHclRawQuote() provider = %v, want %v", info.Provider, abi.QuoteProviderAzureHcl)
+	}
+}
+
+func TestGetHclRawQuoteOtherUserData(t *testing.T) {
+	tpm := &fakeNvTpm{indices: map[uint32][]byte{hclReportNvIndex: fakeHclReport(fakeHclClaims(make([]byte, 64)))}, frozen: true}
+	if _, err := getHclRawQuote(tpm, [64]byte{1}); err == nil {
+		t.Error("getHclRawQuote() = _, nil for a report of other user-data. Want error")
+	}
+}
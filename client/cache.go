@@ -0,0 +1,196 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// defaultQuoteVmpl keys the cache entries of GetRawQuote, whose VMPL is the provider's default.
+const defaultQuoteVmpl = ^uint(0)
+
+// reportedTcbOffset is the offset of REPORTED_TCB in an attestation report.
+const reportedTcbOffset = 0x180
+
+// DefaultMaxCachedQuotes is the number of quotes that a CachingQuoteProvider holds unless its
+// MaxEntries is set.
+const DefaultMaxCachedQuotes = 1024
+
+type quoteCacheKey struct {
+	reportData [64]byte
+	vmpl       uint
+}
+
+type cachedQuote struct {
+	key     quoteCacheKey
+	quote   []uint8
+	expires time.Time
+}
+
+// CachingQuoteProvider memoizes the raw quotes of a QuoteProvider per report data and VMPL, so that
+// services that attest the same data repeatedly do not send a request to the AMD-SP each time.
+// Quotes are served from the cache until their TTL expires or until a quote fetched since reports a
+// different TCB, e.g., after a firmware update. Because a report's contents are otherwise fixed for
+// the lifetime of the VM, a cached quote is as fresh as the report data it binds.
+type CachingQuoteProvider struct {
+	// MaxEntries bounds the number of cached quotes, since each new report data, e.g., a nonce, adds
+	// one. Caching a quote beyond the bound evicts the oldest. Set it before the first request. If
+	// it is not positive, the bound is DefaultMaxCachedQuotes.
+	MaxEntries int
+
+	base QuoteProvider
+	ttl  time.Duration
+	// now returns the current time. It is replaced in tests.
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[quoteCacheKey]*list.Element
+	// order holds the cachedQuote entries from newest to oldest, which is also the order of their
+	// expiry.
+	order       *list.List
+	reportedTcb uint64
+}
+
+// NewCachingQuoteProvider returns a provider that caches the quotes of qp for ttl. If ttl is not
+// positive, quotes are cached until the reported TCB changes, Invalidate is called, or newer quotes
+// evict them.
+func NewCachingQuoteProvider(qp QuoteProvider, ttl time.Duration) *CachingQuoteProvider {
+	return &CachingQuoteProvider{
+		MaxEntries: DefaultMaxCachedQuotes,
+		base:       qp,
+		ttl:        ttl,
+		now:        time.Now,
+		entries:    make(map[quoteCacheKey]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// IsSupported returns whether the underlying provider is supported.
+func (p *CachingQuoteProvider) IsSupported() bool {
+	return p.base.IsSupported()
+}
+
+// GetRawQuote returns the cached raw quote for reportData, or fetches one from the underlying
+// provider.
+func (p *CachingQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
+	return p.get(quoteCacheKey{reportData: reportData, vmpl: defaultQuoteVmpl}, func() ([]uint8, error) {
+		return p.base.GetRawQuote(reportData)
+	})
+}
+
+// GetRawQuoteAtLevel returns the cached raw quote for reportData at the given VMPL, or fetches one
+// from the underlying provider.
+func (p *CachingQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, vmpl uint) ([]uint8, error) {
+	leveled, ok := p.base.(LeveledQuoteProvider)
+	if !ok {
+		return nil, fmt.Errorf("quote provider %T does not support requesting a VMPL", p.base)
+	}
+	return p.get(quoteCacheKey{reportData: reportData, vmpl: vmpl}, func() ([]uint8, error) {
+		return leveled.GetRawQuoteAtLevel(reportData, vmpl)
+	})
+}
+
+// Product returns AMD SEV-related CPU information of the calling CPU.
+//
+// Deprecated: Use abi.ExtraPlatformInfoGUID in the raw quote certificate table.
+func (p *CachingQuoteProvider) Product() *pb.SevProduct {
+	return p.base.Product()
+}
+
+// Invalidate drops all cached quotes.
+func (p *CachingQuoteProvider) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+}
+
+func (p *CachingQuoteProvider) clear() {
+	p.entries = make(map[quoteCacheKey]*list.Element)
+	p.order.Init()
+}
+
+func (p *CachingQuoteProvider) expired(entry *cachedQuote) bool {
+	return p.ttl > 0 && !p.now().Before(entry.expires)
+}
+
+func (p *CachingQuoteProvider) remove(elem *list.Element) {
+	delete(p.entries, elem.Value.(*cachedQuote).key)
+	p.order.Remove(elem)
+}
+
+// insert caches quote for key, and evicts expired quotes and then the oldest quotes beyond
+// MaxEntries.
+func (p *CachingQuoteProvider) insert(key quoteCacheKey, quote []uint8) {
+	if elem, ok := p.entries[key]; ok {
+		p.remove(elem)
+	}
+	for oldest := p.order.Back(); oldest != nil && p.expired(oldest.Value.(*cachedQuote)); oldest = p.order.Back() {
+		p.remove(oldest)
+	}
+	maxEntries := p.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxCachedQuotes
+	}
+	for p.order.Len() >= maxEntries {
+		p.remove(p.order.Back())
+	}
+	entry := &cachedQuote{key: key, quote: quote, expires: p.now().Add(p.ttl)}
+	p.entries[key] = p.order.PushFront(entry)
+}
+
+func (p *CachingQuoteProvider) lookup(key quoteCacheKey) ([]uint8, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elem, ok := p.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cachedQuote)
+	if p.expired(entry) {
+		p.remove(elem)
+		return nil, false
+	}
+	return entry.quote, true
+}
+
+func (p *CachingQuoteProvider) get(key quoteCacheKey, fetch func() ([]uint8, error)) ([]uint8, error) {
+	if quote, ok := p.lookup(key); ok {
+		return append([]uint8{}, quote...), nil
+	}
+	quote, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	report, _, err := splitRawQuote(quote)
+	if err != nil {
+		return nil, err
+	}
+	reportedTcb := binary.LittleEndian.Uint64(report[reportedTcbOffset : reportedTcbOffset+8])
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if reportedTcb != p.reportedTcb {
+		// Quotes that report the old TCB are stale.
+		p.clear()
+		p.reportedTcb = reportedTcb
+	}
+	p.insert(key, append([]uint8{}, quote...))
+	return quote, nil
+}
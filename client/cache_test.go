@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// tcbQuoteProvider returns reports of the given reported TCB.
+type tcbQuoteProvider struct {
+	reportedTcb uint64
+	calls       int
+}
+
+func (p *tcbQuoteProvider) IsSupported() bool { return true }
+
+func (p *tcbQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
+	return p.GetRawQuoteAtLevel(reportData, 0)
+}
+
+func (p *tcbQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, vmpl uint) ([]uint8, error) {
+	p.calls++
+	report := make([]uint8, abi.ReportSize)
+	binary.LittleEndian.PutUint32(report[0x30:0x34], uint32(vmpl))
+	copy(report[0x50:0x90], reportData[:])
+	binary.LittleEndian.PutUint64(report[0x180:0x188], p.reportedTcb)
+	return report, nil
+}
+
+func (p *tcbQuoteProvider) Product() *pb.SevProduct { return nil }
+
+func TestCachingQuoteProvider(t *testing.T) {
+	base := &tcbQuoteProvider{reportedTcb: 1}
+	qp := NewCachingQuoteProvider(base, time.Minute)
+	now := time.Now()
+	qp.now = func() time.Time { return now }
+	get := func(reportData [64]byte, vmpl uint) {
+		t.Helper()
+		quote, err := qp.GetRawQuoteAtLevel(reportData, vmpl)
+		if err != nil {
+			t.Fatalf("GetRawQuoteAtLevel(%v, %d) = _, %v. Want nil", reportData, vmpl, err)
+		}
+		if quote[0x50] != reportData[0] || binary.LittleEndian.Uint32(quote[0x30:0x34]) != uint32(vmpl) {
+			t.Errorf("GetRawQuoteAtLevel(%v, %d) returned the quote for other request data", reportData, vmpl)
+		}
+		quote[0x50] ^= 0xff // The cache must not share its copy.
+	}
+	steps := []struct {
+		name       string
+		reportData [64]byte
+		vmpl       uint
+		advance    time.Duration
+		tcb        uint64
+		wantCalls  int
+	}{
+		{name: "first", reportData: [64]byte{1}, wantCalls: 1},
+		{name: "cached", reportData: [64]byte{1}, advance: time.Second, wantCalls: 1},
+		{name: "other data", reportData: [64]byte{2}, wantCalls: 2},
+		{name: "other vmpl", reportData: [64]byte{2}, vmpl: 1, wantCalls: 3},
+		{name: "expired", reportData: [64]byte{1}, advance: time.Minute - time.Second, wantCalls: 4},
+		{name: "still cached", reportData: [64]byte{2}, vmpl: 1, wantCalls: 4},
+		{name: "new tcb", reportData: [64]byte{3}, tcb: 2, wantCalls: 5},
+		{name: "stale tcb", reportData: [64]byte{2}, vmpl: 1, tcb: 2, wantCalls: 6},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		if step.tcb != 0 {
+			base.reportedTcb = step.tcb
+		}
+		get(step.reportData, step.vmpl)
+		if base.calls != step.wantCalls {
+			t.Errorf("%s: provider served %d requests, want %d", step.name, base.calls, step.wantCalls)
+		}
+	}
+	qp.Invalidate()
+	get([64]byte{3}, 0)
+	if base.calls != 7 {
+		t.Errorf("after Invalidate: provider served %d requests, want 7", base.calls)
+	}
+}
+
+func TestCachingQuoteProviderEviction(t *testing.T) {
+	base := &tcbQuoteProvider{}
+	qp := NewCachingQuoteProvider(base, time.Minute)
+	qp.MaxEntries = 2
+	now := time.Now()
+	qp.now = func() time.Time { return now }
+	for i := byte(1); i <= 3; i++ {
+		if _, err := qp.GetRawQuote([64]byte{i}); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+	if got := len(qp.entries); got != 2 {
+		t.Errorf("cache holds %d quotes, want MaxEntries 2", got)
+	}
+	if _, ok := qp.lookup(quoteCacheKey{reportData: [64]byte{1}, vmpl: defaultQuoteVmpl}); ok {
+		t.Error("the oldest quote is still cached beyond MaxEntries")
+	}
+
+	// A new quote evicts every expired quote, not only the oldest beyond the bound.
+	qp.MaxEntries = 0
+	now = now.Add(time.Minute)
+	if _, err := qp.GetRawQuote([64]byte{4}); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(qp.entries); got != 1 {
+		t.Errorf("cache holds %d quotes after the others expired, want 1", got)
+	}
+}
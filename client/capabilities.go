@@ -0,0 +1,93 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"github.com/google/go-configfs-tsm/configfs/configfsi"
+	"github.com/google/go-configfs-tsm/report"
+	"github.com/google/go-sev-guest/abi"
+)
+
+// PlatformCapabilities describes the SEV-SNP attestation features that the current environment
+// offers, so callers can adapt, e.g., by fetching certificates from the AMD KDS when the host does
+// not provide them.
+type PlatformCapabilities struct {
+	// Providers lists the supported built-in quote provider interfaces in selection order.
+	Providers []abi.QuoteProviderKind
+	// ConfigfsTsm is whether the configfs-tsm report interface serves SEV-SNP reports.
+	ConfigfsTsm bool
+	// ExtendedReports is whether the host provides a certificate table with reports.
+	ExtendedReports bool
+	// DerivedKeys is whether SNP_GET_DERIVED_KEY requests can be sent. Only /dev/sev-guest offers
+	// them.
+	DerivedKeys bool
+	// Vmpls lists the VMPLs that reports may be requested at, from most to least privileged.
+	Vmpls []uint
+	// CertTableSize is the buffer size in bytes that the host's certificate table requires, and 0 if
+	// the host provides no certificates.
+	CertTableSize uint32
+}
+
+// SupportsVmpl returns whether reports may be requested at the given VMPL.
+func (c *PlatformCapabilities) SupportsVmpl(vmpl uint) bool {
+	for _, v := range c.Vmpls {
+		if v == vmpl {
+			return true
+		}
+	}
+	return false
+}
+
+// vmplsFrom returns the VMPLs from floor to the least privileged VMPL.
+func vmplsFrom(floor uint) []uint {
+	var vmpls []uint
+	for vmpl := floor; vmpl < abi.VmpckCount; vmpl++ {
+		vmpls = append(vmpls, vmpl)
+	}
+	return vmpls
+}
+
+// probeConfigFsCapabilities records the capabilities of a configfs-tsm client that serves SEV-SNP
+// reports.
+func probeConfigFsCapabilities(c configfsi.Client, caps *PlatformCapabilities) {
+	r, err := report.Create(c, &report.Request{})
+	if err != nil {
+		return
+	}
+	defer r.Destroy()
+	provider, err := r.ReadOption("provider")
+	if err != nil || string(provider) != "sev_guest\n" {
+		return
+	}
+	caps.ConfigfsTsm = true
+	caps.Providers = append(caps.Providers, abi.QuoteProviderConfigfsTsm)
+	// Kernels without privlevel_floor do not restrict the privilege level.
+	floor, _ := r.PrivilegeLevelFloor()
+	caps.Vmpls = vmplsFrom(floor)
+}
+
+// probeDeviceCapabilities records the capabilities of an open SEV guest device. The certificate
+// table size query is an extended report request, so it counts against the host's rate limit.
+func probeDeviceCapabilities(d Device, caps *PlatformCapabilities) {
+	caps.DerivedKeys = true
+	caps.Providers = append(caps.Providers, abi.QuoteProviderIoctl)
+	if caps.Vmpls == nil {
+		caps.Vmpls = vmplsFrom(0)
+	}
+	if length, err := queryCertificateLength(d, int(caps.Vmpls[0])); err == nil && length != 0 {
+		caps.ExtendedReports = true
+		caps.CertTableSize = length
+	}
+}
@@ -15,6 +15,7 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -69,6 +70,20 @@ func UseDefaultSevGuest() bool {
 	return *sevGuestPath == "default"
 }
 
+// PrivilegeLevelFloorError is returned when a report is requested at a VMPL that is more privileged
+// than the quote provider permits, e.g., below the configfs-tsm privlevel_floor of a guest OS that
+// runs at a lower privilege level.
+type PrivilegeLevelFloorError struct {
+	// Requested is the requested VMPL.
+	Requested uint
+	// Floor is the most privileged VMPL that reports may be requested at.
+	Floor uint
+}
+
+func (e *PrivilegeLevelFloorError) Error() string {
+	return fmt.Sprintf("requested VMPL %d is more privileged than the configfs-tsm privlevel_floor %d", e.Requested, e.Floor)
+}
+
 func message(d Device, command uintptr, req *labi.SnpUserGuestRequest) error {
 	result, err := d.Ioctl(command, req)
 	if err != nil {
@@ -76,7 +91,7 @@ func message(d Device, command uintptr, req *labi.SnpUserGuestRequest) error {
 		// indicates a problem certificate length. We need to
 		// communicate that specifically.
 		if req.FwErr != 0 {
-			return &abi.SevFirmwareErr{Status: abi.SevFirmwareStatus(req.FwErr)}
+			return &abi.SevFirmwareErr{Status: abi.SevFirmwareStatus(req.FwErr), Err: err}
 		}
 		return err
 	}
@@ -91,6 +106,23 @@ func message(d Device, command uintptr, req *labi.SnpUserGuestRequest) error {
 //
 // Deprecated: Use LeveledQuoteProvider.
 func GetRawReportAtVmpl(d Device, reportData [64]byte, vmpl int) ([]byte, error) {
+	return GetRawReportAtVmplContext(context.Background(), d, reportData, vmpl)
+}
+
+// GetRawReportAtVmplContext behaves like GetRawReportAtVmpl, but retries throttled requests with
+// DefaultRetryOptions until ctx expires.
+//
+// Deprecated: Use GetRawQuoteAtLevelContext.
+func GetRawReportAtVmplContext(ctx context.Context, d Device, reportData [64]byte, vmpl int) ([]byte, error) {
+	var report []byte
+	err := retry(ctx, nil, func() (err error) {
+		report, err = getReportIn(d, reportData, vmpl)
+		return err
+	})
+	return report, err
+}
+
+func getReportIn(d Device, reportData [64]byte, vmpl int) ([]byte, error) {
 	var snpReportRsp labi.SnpReportRespABI
 	userGuestReq := labi.SnpUserGuestRequest{
 		ReqData: &labi.SnpReportReqABI{
@@ -112,11 +144,27 @@ func GetRawReport(d Device, reportData [64]byte) ([]byte, error) {
 	return GetRawReportAtVmpl(d, reportData, 0)
 }
 
+// GetRawReportContext behaves like GetRawReport, but retries throttled requests with
+// DefaultRetryOptions until ctx expires.
+//
+// Deprecated: Use GetRawQuoteContext.
+func GetRawReportContext(ctx context.Context, d Device, reportData [64]byte) ([]byte, error) {
+	return GetRawReportAtVmplContext(ctx, d, reportData, 0)
+}
+
 // GetReportAtVmpl gets an attestation report at the given VMPL into its protobuf representation.
 //
 // Deprecated: Use GetQuoteProtoAtLevel.
 func GetReportAtVmpl(d Device, reportData [64]byte, vmpl int) (*pb.Report, error) {
-	data, err := GetRawReportAtVmpl(d, reportData, vmpl)
+	return GetReportAtVmplContext(context.Background(), d, reportData, vmpl)
+}
+
+// GetReportAtVmplContext behaves like GetReportAtVmpl, but retries throttled requests with
+// DefaultRetryOptions until ctx expires.
+//
+// Deprecated: Use GetQuoteProtoAtLevelContext.
+func GetReportAtVmplContext(ctx context.Context, d Device, reportData [64]byte, vmpl int) (*pb.Report, error) {
+	data, err := GetRawReportAtVmplContext(ctx, d, reportData, vmpl)
 	if err != nil {
 		return nil, err
 	}
@@ -130,6 +178,14 @@ func GetReport(d Device, reportData [64]byte) (*pb.Report, error) {
 	return GetReportAtVmpl(d, reportData, 0)
 }
 
+// GetReportContext behaves like GetReport, but retries throttled requests with DefaultRetryOptions
+// until ctx expires.
+//
+// Deprecated: Use GetQuoteProtoContext.
+func GetReportContext(ctx context.Context, d Device, reportData [64]byte) (*pb.Report, error) {
+	return GetReportAtVmplContext(ctx, d, reportData, 0)
+}
+
 // getExtendedReportIn issues a GetExtendedReport command to the sev-guest driver with reportData
 // input and certs as a destination for certificate data. If certs is empty, this function returns
 // the expected size of certs as its second result value. If certs is non-empty, this function
@@ -170,18 +226,124 @@ func queryCertificateLength(d Device, vmpl int) (uint32, error) {
 	return length, nil
 }
 
+// MaxCertTableSize is the largest certificate table in bytes that the host may demand a buffer for
+// with an extended report. A VCEK or VLEK, the ASK, and the ARK take a few KiB together, so the bound
+// only stops a malicious host from forcing large allocations.
+const MaxCertTableSize = 0x10000
+
+// certTableNegotiations bounds how often the host may grow its certificate table between the length
+// query and the extended report request.
+const certTableNegotiations = 3
+
+// CertTableLengthError is returned when the length of the host's certificate table is out of bounds
+// or does not hold the table that the host returned.
+type CertTableLengthError struct {
+	// Length is the certificate table length in bytes that the host demanded or returned.
+	Length uint32
+	// Max is MaxCertTableSize if Length exceeds it, and 0 otherwise.
+	Max uint32
+	// Err is why the returned table does not fit within Length, if Length is within bounds.
+	Err error
+}
+
+func (e *CertTableLengthError) Error() string {
+	if e.Max != 0 {
+		return fmt.Sprintf("host certificate table length %d exceeds the maximum %d", e.Length, e.Max)
+	}
+	return fmt.Sprintf("host certificate table does not fit its length %d: %v", e.Length, e.Err)
+}
+
+// Unwrap returns the reason the certificate table does not fit its length.
+func (e *CertTableLengthError) Unwrap() error {
+	return e.Err
+}
+
+// getBoundedExtendedReport returns an extended report and its certificate table, starting with a
+// buffer of the given length. The host may demand a larger buffer only up to MaxCertTableSize and a
+// bounded number of times, and the table it returns must lie within the length it reports.
+func getBoundedExtendedReport(d Device, reportData [64]byte, vmpl int, length uint32) ([]byte, []byte, error) {
+	for i := 0; i < certTableNegotiations; i++ {
+		if length > MaxCertTableSize {
+			return nil, nil, &CertTableLengthError{Length: length, Max: MaxCertTableSize}
+		}
+		if length == 0 {
+			report, err := getReportIn(d, reportData, vmpl)
+			return report, nil, err
+		}
+		certs := make([]byte, length)
+		report, returned, err := getExtendedReportIn(d, reportData, vmpl, certs)
+		if err != nil {
+			return nil, nil, err
+		}
+		if report == nil {
+			logger().Debug("host certificate table grew since the length query", "length", length, "demanded", returned)
+			length = returned
+			continue
+		}
+		if returned > length {
+			return nil, nil, &CertTableLengthError{Length: returned,
+				Err: fmt.Errorf("the buffer was %d bytes", length)}
+		}
+		// A host that does not report the length on success fills the whole buffer.
+		if returned != 0 {
+			certs = certs[:returned]
+		}
+		if err := new(abi.CertTable).Unmarshal(certs); err != nil {
+			return nil, nil, &CertTableLengthError{Length: returned, Err: err}
+		}
+		return report, certs, nil
+	}
+	return nil, nil, fmt.Errorf("host certificate table length changed on each of %d requests", certTableNegotiations)
+}
+
+// getDeviceRawQuote returns the report at the given VMPL plus the device's certificate table, if
+// any, extended with ExtraPlatformInfo for a quote from the ioctl provider. The kernel version is
+// in KERNEL_VERSION(a,b,c) encoding, or 0 if unknown.
+func getDeviceRawQuote(d Device, reportData [64]byte, level uint, kernel uint32) ([]uint8, error) {
+	// If there are no certificates, then just return the raw report.
+	length, err := queryCertificateLength(d, int(level))
+	if err != nil {
+		logger().Debug("device provides no certificate table, returning the report alone", "error", err)
+		// The caller retries throttled requests with its own policy and context.
+		return getReportIn(d, reportData, int(level))
+	}
+	report, certs, err := getBoundedExtendedReport(d, reportData, int(level), length)
+	if err != nil {
+		return nil, err
+	}
+	// Mix the platform info in with the auxblob.
+	extended, err := abi.ExtendPlatformCertTable(certs, abi.MakeExtraPlatformInfoV1(abi.QuoteProviderIoctl, uint32(level), kernel))
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate table: %v", err)
+	}
+	return append(report, extended...), nil
+}
+
 // GetRawExtendedReportAtVmpl requests for an attestation report that incorporates the given user
 // data at the given VMPL, and additional key certificate information.
 //
 // Deprecated: Use LeveledQuoteProvider.
 func GetRawExtendedReportAtVmpl(d Device, reportData [64]byte, vmpl int) ([]byte, []byte, error) {
-	length, err := queryCertificateLength(d, vmpl)
-	if err != nil {
+	return GetRawExtendedReportAtVmplContext(context.Background(), d, reportData, vmpl)
+}
+
+// GetRawExtendedReportAtVmplContext behaves like GetRawExtendedReportAtVmpl, but retries throttled
+// requests with DefaultRetryOptions until ctx expires.
+//
+// Deprecated: Use GetRawQuoteAtLevelContext.
+func GetRawExtendedReportAtVmplContext(ctx context.Context, d Device, reportData [64]byte, vmpl int) ([]byte, []byte, error) {
+	var length uint32
+	if err := retry(ctx, nil, func() (err error) {
+		length, err = queryCertificateLength(d, vmpl)
+		return err
+	}); err != nil {
 		return nil, nil, fmt.Errorf("error querying certificate length: %v", err)
 	}
-	certs := make([]byte, length)
-	report, _, err := getExtendedReportIn(d, reportData, vmpl, certs)
-	if err != nil {
+	var report, certs []byte
+	if err := retry(ctx, nil, func() (err error) {
+		report, certs, err = getBoundedExtendedReport(d, reportData, vmpl, length)
+		return err
+	}); err != nil {
 		return nil, nil, err
 	}
 	return report, certs, nil
@@ -195,11 +357,53 @@ func GetRawExtendedReport(d Device, reportData [64]byte) ([]byte, []byte, error)
 	return GetRawExtendedReportAtVmpl(d, reportData, 0)
 }
 
+// GetRawExtendedReportContext behaves like GetRawExtendedReport, but retries throttled requests
+// with DefaultRetryOptions until ctx expires.
+//
+// Deprecated: Use GetRawQuoteContext.
+func GetRawExtendedReportContext(ctx context.Context, d Device, reportData [64]byte) ([]byte, []byte, error) {
+	return GetRawExtendedReportAtVmplContext(ctx, d, reportData, 0)
+}
+
+// splitRawQuote returns the report and certificate table parts of a raw quote.
+func splitRawQuote(reportcerts []byte) ([]byte, []byte, error) {
+	if len(reportcerts) < abi.ReportSize {
+		return nil, nil, fmt.Errorf("%w: raw quote is %d bytes", abi.ErrReportTooShort, len(reportcerts))
+	}
+	return reportcerts[:abi.ReportSize], reportcerts[abi.ReportSize:], nil
+}
+
+// GetRawExtendedQuote returns the attestation report and the certificate table that qp provides
+// with it, e.g., the auxblob of configfs-tsm. The table is empty if qp provides none.
+func GetRawExtendedQuote(qp QuoteProvider, reportData [64]byte) ([]byte, []byte, error) {
+	reportcerts, err := qp.GetRawQuote(reportData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return splitRawQuote(reportcerts)
+}
+
+// GetRawExtendedQuoteAtLevel returns the attestation report at the given VMPL and the certificate
+// table that qp provides with it. The table is empty if qp provides none.
+func GetRawExtendedQuoteAtLevel(qp LeveledQuoteProvider, reportData [64]byte, vmpl uint) ([]byte, []byte, error) {
+	reportcerts, err := qp.GetRawQuoteAtLevel(reportData, vmpl)
+	if err != nil {
+		return nil, nil, err
+	}
+	return splitRawQuote(reportcerts)
+}
+
 // GetQuoteProto uses the given QuoteProvider to return the
 // protobuf representation of an attestation report with cached
-// certificate chain.
+// certificate chain. Throttled requests are retried with DefaultRetryOptions.
 func GetQuoteProto(qp QuoteProvider, reportData [64]byte) (*pb.Attestation, error) {
-	reportcerts, err := qp.GetRawQuote(reportData)
+	return GetQuoteProtoContext(context.Background(), qp, reportData, nil)
+}
+
+// GetQuoteProtoContext behaves like GetQuoteProto, but retries throttled requests according to
+// opts and stops retrying when ctx expires. A nil opts uses DefaultRetryOptions.
+func GetQuoteProtoContext(ctx context.Context, qp QuoteProvider, reportData [64]byte, opts *RetryOptions) (*pb.Attestation, error) {
+	reportcerts, err := GetRawQuoteContext(ctx, qp, reportData, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -214,9 +418,15 @@ func GetQuoteProto(qp QuoteProvider, reportData [64]byte) (*pb.Attestation, erro
 
 // GetQuoteProtoAtLevel uses the given LeveledQuoteProvider to return the
 // protobuf representation of an attestation report at a given VMPL with cached
-// certificate chain.
+// certificate chain. Throttled requests are retried with DefaultRetryOptions.
 func GetQuoteProtoAtLevel(qp LeveledQuoteProvider, reportData [64]byte, vmpl uint) (*pb.Attestation, error) {
-	reportcerts, err := qp.GetRawQuoteAtLevel(reportData, vmpl)
+	return GetQuoteProtoAtLevelContext(context.Background(), qp, reportData, vmpl, nil)
+}
+
+// GetQuoteProtoAtLevelContext behaves like GetQuoteProtoAtLevel, but retries throttled requests
+// according to opts and stops retrying when ctx expires. A nil opts uses DefaultRetryOptions.
+func GetQuoteProtoAtLevelContext(ctx context.Context, qp LeveledQuoteProvider, reportData [64]byte, vmpl uint, opts *RetryOptions) (*pb.Attestation, error) {
+	reportcerts, err := GetRawQuoteAtLevelContext(ctx, qp, reportData, vmpl, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -232,7 +442,15 @@ func GetQuoteProtoAtLevel(qp LeveledQuoteProvider, reportData [64]byte, vmpl uin
 //
 // Deprecated: Use GetQuoteProtoAtLevel
 func GetExtendedReportAtVmpl(d Device, reportData [64]byte, vmpl int) (*pb.Attestation, error) {
-	reportBytes, certBytes, err := GetRawExtendedReportAtVmpl(d, reportData, vmpl)
+	return GetExtendedReportAtVmplContext(context.Background(), d, reportData, vmpl)
+}
+
+// GetExtendedReportAtVmplContext behaves like GetExtendedReportAtVmpl, but retries throttled
+// requests with DefaultRetryOptions until ctx expires.
+//
+// Deprecated: Use GetQuoteProtoAtLevelContext.
+func GetExtendedReportAtVmplContext(ctx context.Context, d Device, reportData [64]byte, vmpl int) (*pb.Attestation, error) {
+	reportBytes, certBytes, err := GetRawExtendedReportAtVmplContext(ctx, d, reportData, vmpl)
 	if err != nil {
 		return nil, err
 	}
@@ -260,6 +478,14 @@ func GetExtendedReport(d Device, reportData [64]byte) (*pb.Attestation, error) {
 	return GetExtendedReportAtVmpl(d, reportData, 0)
 }
 
+// GetExtendedReportContext behaves like GetExtendedReport, but retries throttled requests with
+// DefaultRetryOptions until ctx expires.
+//
+// Deprecated: Use GetQuoteProtoContext.
+func GetExtendedReportContext(ctx context.Context, d Device, reportData [64]byte) (*pb.Attestation, error) {
+	return GetExtendedReportAtVmplContext(ctx, d, reportData, 0)
+}
+
 // GuestFieldSelect represents which guest-provided information will be mixed into a derived key.
 type GuestFieldSelect struct {
 	TCBVersion  bool
@@ -314,6 +540,13 @@ func (g GuestFieldSelect) ABI() uint64 {
 // processor derives from the given parameters. Security limitations of this command are described
 // more in the project README.
 func GetDerivedKeyAcknowledgingItsLimitations(d Device, request *SnpDerivedKeyReq) (*labi.SnpDerivedKeyRespABI, error) {
+	return GetDerivedKeyAcknowledgingItsLimitationsContext(context.Background(), d, request)
+}
+
+// GetDerivedKeyAcknowledgingItsLimitationsContext behaves like
+// GetDerivedKeyAcknowledgingItsLimitations, but retries throttled requests with DefaultRetryOptions
+// until ctx expires.
+func GetDerivedKeyAcknowledgingItsLimitationsContext(ctx context.Context, d Device, request *SnpDerivedKeyReq) (*labi.SnpDerivedKeyRespABI, error) {
 	response := &labi.SnpDerivedKeyRespABI{}
 	rootKeySelect := uint32(1)
 	if request.UseVCEK {
@@ -329,7 +562,7 @@ func GetDerivedKeyAcknowledgingItsLimitations(d Device, request *SnpDerivedKeyRe
 		},
 		RespData: response,
 	}
-	if err := message(d, labi.IocSnpGetDerivedKey, guestRequest); err != nil {
+	if err := retry(ctx, nil, func() error { return message(d, labi.IocSnpGetDerivedKey, guestRequest) }); err != nil {
 		return nil, fmt.Errorf("error getting derived key: %v", err)
 	}
 	return response, nil
@@ -0,0 +1,167 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build freebsd
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/google/go-sev-guest/abi"
+	labi "github.com/google/go-sev-guest/client/linuxabi"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"golang.org/x/sys/unix"
+)
+
+// defaultSevGuestDevicePath is the platform's usual device path to the SEV guest.
+const defaultSevGuestDevicePath = "/dev/sev-guest"
+
+// FreeBSDDevice implements the Device interface with the FreeBSD sev-guest driver's ioctls. The
+// driver takes the same request structures as Linux's /dev/sev-guest, and the linuxabi command
+// numbers coincide with FreeBSD's _IOWR encoding.
+type FreeBSDDevice struct {
+	fd int
+}
+
+// Open opens the SEV-SNP guest device from a given path
+func (d *FreeBSDDevice) Open(path string) error {
+	fd, err := unix.Open(path, unix.O_RDWR, 0)
+	if err != nil {
+		d.fd = -1
+		return fmt.Errorf("could not open AMD SEV guest device at %s: %v", path, err)
+	}
+	d.fd = fd
+	return nil
+}
+
+// OpenDevice opens the SEV-SNP guest device.
+func OpenDevice() (*FreeBSDDevice, error) {
+	path := *sevGuestPath
+	if UseDefaultSevGuest() {
+		path = defaultSevGuestDevicePath
+	}
+	return openDeviceAt(path)
+}
+
+func openDeviceAt(path string) (*FreeBSDDevice, error) {
+	result := &FreeBSDDevice{}
+	if err := result.Open(path); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Close closes the SEV-SNP guest device.
+func (d *FreeBSDDevice) Close() error {
+	if d.fd == -1 { // Not open
+		return nil
+	}
+	if err := unix.Close(d.fd); err != nil {
+		return err
+	}
+	// Prevent double-close.
+	d.fd = -1
+	return nil
+}
+
+// Ioctl sends a command with its wrapped request and response values to the FreeBSD device.
+func (d *FreeBSDDevice) Ioctl(command uintptr, req any) (uintptr, error) {
+	switch sreq := req.(type) {
+	case *labi.SnpUserGuestRequest:
+		abi := sreq.ABI()
+		result, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(d.fd), command, uintptr(abi.Pointer()))
+		abi.Finish(sreq)
+		// The firmware error is only meaningful when the guest request itself failed.
+		if errno != unix.EIO {
+			sreq.FwErr = 0
+		}
+		if errno != 0 {
+			return 0, errno
+		}
+		return result, nil
+	}
+	return 0, fmt.Errorf("unexpected request value: %v", req)
+}
+
+// Product returns the current CPU's associated AMD SEV product information.
+func (d *FreeBSDDevice) Product() *spb.SevProduct {
+	return abi.SevProduct()
+}
+
+// FreeBSDIoctlQuoteProvider implements the QuoteProvider interface to fetch attestation quotes via
+// the FreeBSD sev-guest ioctls.
+type FreeBSDIoctlQuoteProvider struct {
+	// DevicePath is the SEV guest device to open. If empty, OpenDevice selects the device.
+	DevicePath string
+}
+
+func (p *FreeBSDIoctlQuoteProvider) openDevice() (*FreeBSDDevice, error) {
+	if p.DevicePath != "" {
+		return openDeviceAt(p.DevicePath)
+	}
+	return OpenDevice()
+}
+
+// IsSupported checks if the sev-guest device can be opened.
+func (p *FreeBSDIoctlQuoteProvider) IsSupported() bool {
+	d, err := p.openDevice()
+	if err != nil {
+		return false
+	}
+	d.Close()
+	return true
+}
+
+// GetRawQuoteAtLevel returns byte format attestation plus certificate table via the sev-guest
+// ioctls.
+func (p *FreeBSDIoctlQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, level uint) ([]uint8, error) {
+	d, err := p.openDevice()
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	// The ExtraPlatformInfo kernel version is specific to Linux.
+	return getDeviceRawQuote(d, reportData, level, 0)
+}
+
+// GetRawQuote returns byte format attestation plus certificate table at VMPL0 via the sev-guest
+// ioctls.
+func (p *FreeBSDIoctlQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
+	return p.GetRawQuoteAtLevel(reportData, 0)
+}
+
+// Product returns AMD SEV-related CPU information of the calling CPU.
+//
+// Deprecated: Use abi.ExtraPlatformInfoGUID in the raw quote certificate table.
+func (*FreeBSDIoctlQuoteProvider) Product() *spb.SevProduct {
+	return abi.SevProduct()
+}
+
+// Capabilities probes the sev-guest device for the attestation features it offers.
+func Capabilities() *PlatformCapabilities {
+	caps := &PlatformCapabilities{}
+	if d, err := OpenDevice(); err == nil {
+		probeDeviceCapabilities(d, caps)
+		d.Close()
+	}
+	return caps
+}
+
+// platformQuoteProviders returns the FreeBSD quote providers in preference order.
+func platformQuoteProviders(o *providerOptions) []providerCandidate {
+	return []providerCandidate{
+		{kind: abi.QuoteProviderIoctl, provider: &FreeBSDIoctlQuoteProvider{DevicePath: o.devicePath}},
+	}
+}
@@ -18,16 +18,21 @@
 package client
 
 import (
+	"encoding/binary"
 	"flag"
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/go-configfs-tsm/configfs/configfsi"
 	"github.com/google/go-configfs-tsm/configfs/linuxtsm"
 	"github.com/google/go-configfs-tsm/report"
 	"github.com/google/go-sev-guest/abi"
 	labi "github.com/google/go-sev-guest/client/linuxabi"
 	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"go.uber.org/multierr"
 	"golang.org/x/sys/unix"
 )
 
@@ -65,11 +70,15 @@ func (d *LinuxDevice) Open(path string) error {
 
 // OpenDevice opens the SEV-SNP guest device.
 func OpenDevice() (*LinuxDevice, error) {
-	result := &LinuxDevice{}
 	path := *sevGuestPath
 	if UseDefaultSevGuest() {
 		path = defaultSevGuestDevicePath
 	}
+	return openDeviceAt(path)
+}
+
+func openDeviceAt(path string) (*LinuxDevice, error) {
+	result := &LinuxDevice{}
 	if err := result.Open(path); err != nil {
 		return nil, err
 	}
@@ -97,6 +106,7 @@ func (d *LinuxDevice) Ioctl(command uintptr, req any) (uintptr, error) {
 		sinceLast := time.Since(d.lastCmd)
 		// Self-throttle for tests without guest OS throttle detection
 		if sinceLast < *throttleDuration {
+			logger().Debug("self-throttling SEV guest device command", "wait", *throttleDuration-sinceLast)
 			time.Sleep(*throttleDuration - sinceLast)
 		}
 	}
@@ -130,11 +140,21 @@ func (d *LinuxDevice) Product() *spb.SevProduct {
 
 // LinuxIoctlQuoteProvider implements the QuoteProvider interface to fetch
 // attestation quote via the deprecated /dev/sev-guest ioctl.
-type LinuxIoctlQuoteProvider struct{}
+type LinuxIoctlQuoteProvider struct {
+	// DevicePath is the SEV guest device to open. If empty, OpenDevice selects the device.
+	DevicePath string
+}
+
+func (p *LinuxIoctlQuoteProvider) openDevice() (*LinuxDevice, error) {
+	if p.DevicePath != "" {
+		return openDeviceAt(p.DevicePath)
+	}
+	return OpenDevice()
+}
 
 // IsSupported checks if TSM client can be created to use /dev/sev-guest ioctl.
 func (p *LinuxIoctlQuoteProvider) IsSupported() bool {
-	d, err := OpenDevice()
+	d, err := p.openDevice()
 	if err != nil {
 		return false
 	}
@@ -144,27 +164,53 @@ func (p *LinuxIoctlQuoteProvider) IsSupported() bool {
 
 // GetRawQuoteAtLevel returns byte format attestation plus certificate table via /dev/sev-guest ioctl.
 func (p *LinuxIoctlQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, level uint) ([]uint8, error) {
-	d, err := OpenDevice()
+	d, err := p.openDevice()
 	if err != nil {
 		return nil, err
 	}
 	defer d.Close()
-	// If there are no certificates, then just return the raw report.
-	length, err := queryCertificateLength(d, int(level))
-	if err != nil {
-		return GetRawReportAtVmpl(d, reportData, int(level))
+	return getDeviceRawQuote(d, reportData, level, kernelVersion())
+}
+
+// extendCertTable adds the ExtraPlatformInfoGUID entry describing this platform and how its quote
+// was obtained to the certificate table.
+func extendCertTable(certs []byte, provider abi.QuoteProviderKind, level uint) ([]byte, error) {
+	return abi.ExtendPlatformCertTable(certs, abi.MakeExtraPlatformInfoV1(provider, uint32(level), kernelVersion()))
+}
+
+// kernelVersion returns the running kernel's release in KERNEL_VERSION(a,b,c) encoding, or 0 if it
+// cannot be determined.
+func kernelVersion() uint32 {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return 0
 	}
-	certs := make([]byte, length)
-	report, _, err := getExtendedReportIn(d, reportData, int(level), certs)
-	if err != nil {
-		return nil, err
+	return parseKernelRelease(unix.ByteSliceToString(uts.Release[:]))
+}
+
+// parseKernelRelease interprets the leading "major.minor.patch" of a kernel release string such as
+// "6.8.0-45-generic". Like the kernel's own macro, the patch level saturates at 255.
+func parseKernelRelease(release string) uint32 {
+	var parts [3]uint32
+	for i := range parts {
+		end := strings.IndexFunc(release, func(r rune) bool { return r < '0' || r > '9' })
+		if end < 0 {
+			end = len(release)
+		}
+		v, err := strconv.ParseUint(release[:end], 10, 32)
+		if err != nil {
+			break
+		}
+		parts[i] = uint32(v)
+		if end == len(release) || release[end] != '.' {
+			break
+		}
+		release = release[end+1:]
 	}
-	// Mix the platform info in with the auxblob.
-	extended, err := abi.ExtendedPlatformCertTable(certs)
-	if err != nil {
-		return nil, fmt.Errorf("invalid certificate table: %v", err)
+	if parts[2] > 255 {
+		parts[2] = 255
 	}
-	return append(report, extended...), nil
+	return parts[0]<<16 | (parts[1]&0xff)<<8 | parts[2]
 }
 
 // GetRawQuote returns byte format attestation plus certificate table via /dev/sev-guest ioctl.
@@ -204,27 +250,136 @@ func (p *LinuxConfigFsQuoteProvider) IsSupported() bool {
 	return err == nil && string(provider) == "sev_guest\n"
 }
 
-// GetRawQuoteAtLevel returns byte format attestation plus certificate table via ConfigFS.
-func (p *LinuxConfigFsQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, level uint) ([]uint8, error) {
-	req := &report.Request{
-		InBlob:     reportData[:],
-		GetAuxBlob: true,
-		Privilege: &report.Privilege{
-			Level: level,
-		},
-	}
-	resp, err := linuxtsm.GetReport(req)
+// getConfigFsRawQuote returns byte format attestation plus certificate table from the configfs-tsm
+// client. A requested privilege level is written as the report's privlevel. The ExtraPlatformInfo
+// entry records the VMPL that the report was generated at.
+func getConfigFsRawQuote(c configfsi.Client, req *report.Request) ([]uint8, error) {
+	r, err := report.Create(c, req)
 	if err != nil {
 		return nil, err
 	}
+	resp, err := getConfigFsResponse(r)
+	if err := multierr.Combine(r.Destroy(), err); err != nil {
+		return nil, err
+	}
+	if len(resp.OutBlob) < abi.ReportSize {
+		return nil, fmt.Errorf("%w: configfs-tsm outblob is %d bytes", abi.ErrReportTooShort, len(resp.OutBlob))
+	}
+	vmpl := uint(binary.LittleEndian.Uint32(resp.OutBlob[0x30:0x34]))
+	if req.Privilege != nil && vmpl != req.Privilege.Level {
+		return nil, fmt.Errorf("report VMPL %d is not the requested VMPL %d", vmpl, req.Privilege.Level)
+	}
 	// Mix the platform info in with the auxblob.
-	extended, err := abi.ExtendedPlatformCertTable(resp.AuxBlob)
+	extended, err := extendCertTable(resp.AuxBlob, abi.QuoteProviderConfigfsTsm, vmpl)
 	if err != nil {
 		return nil, fmt.Errorf("invalid certificate table: %v", err)
 	}
 	return append(resp.OutBlob, extended...), nil
 }
 
+// getConfigFsSvsmQuote returns the SVSM attestation of the requested services from the
+// configfs-tsm client. The service attributes must be written before the inblob, which triggers
+// the report.
+func getConfigFsSvsmQuote(c configfsi.Client, reportData [64]byte, req *SvsmServiceRequest) (*SvsmQuote, error) {
+	r, err := report.Create(c, &report.Request{InBlob: reportData[:], GetAuxBlob: true})
+	if err != nil {
+		return nil, err
+	}
+	quote, err := getSvsmResponse(r, req)
+	if err := multierr.Combine(r.Destroy(), err); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+func getSvsmResponse(r *report.OpenReport, req *SvsmServiceRequest) (*SvsmQuote, error) {
+	if err := r.WriteOption("service_provider", []byte("svsm")); err != nil {
+		return nil, fmt.Errorf("configfs-tsm does not support SVSM attestation: %v", err)
+	}
+	if req != nil && req.ServiceGUID != "" {
+		if err := r.WriteOption("service_guid", []byte(req.ServiceGUID)); err != nil {
+			return nil, err
+		}
+	}
+	if req != nil && req.ManifestVersion != nil {
+		if err := r.WriteOption("service_manifest_version", []byte(fmt.Sprintf("%d", *req.ManifestVersion))); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := getConfigFsResponse(r)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := r.ReadOption("manifestblob")
+	if err != nil {
+		return nil, fmt.Errorf("could not read SVSM manifest: %w", err)
+	}
+	if len(resp.OutBlob) < abi.ReportSize {
+		return nil, fmt.Errorf("%w: configfs-tsm outblob is %d bytes", abi.ErrReportTooShort, len(resp.OutBlob))
+	}
+	vmpl := uint(binary.LittleEndian.Uint32(resp.OutBlob[0x30:0x34]))
+	extended, err := extendCertTable(resp.AuxBlob, abi.QuoteProviderConfigfsTsm, vmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate table: %v", err)
+	}
+	return &SvsmQuote{RawQuote: append(resp.OutBlob, extended...), Manifest: manifest}, nil
+}
+
+// GetRawSvsmQuote returns the SVSM attestation of the requested services via ConfigFS. Guests that
+// do not run under an SVSM, or whose kernel predates the configfs-tsm service attributes, get an
+// error.
+func (p *LinuxConfigFsQuoteProvider) GetRawSvsmQuote(reportData [64]byte, req *SvsmServiceRequest) (*SvsmQuote, error) {
+	c, err := linuxtsm.MakeClient()
+	if err != nil {
+		return nil, err
+	}
+	return getConfigFsSvsmQuote(c, reportData, req)
+}
+
+func getConfigFsResponse(r *report.OpenReport) (*report.Response, error) {
+	// The kernel rejects a privlevel below privlevel_floor on its own. Checking first only serves to
+	// explain the rejection, so an unreadable floor is left to the kernel.
+	if r.Privilege != nil {
+		if floor, err := r.PrivilegeLevelFloor(); err == nil && r.Privilege.Level < floor {
+			return nil, &PrivilegeLevelFloorError{Requested: r.Privilege.Level, Floor: floor}
+		}
+	}
+	getAuxBlob := r.GetAuxBlob
+	r.GetAuxBlob = false
+	resp, err := r.Get()
+	if err != nil || !getAuxBlob {
+		return resp, err
+	}
+	// The auxblob attribute is optional, and the kernel generates it with the outblob that was just
+	// read. Without it, verifiers can still fetch the certificates from the AMD KDS.
+	auxblob, err := r.ReadOption("auxblob")
+	if err != nil {
+		if report.GetGenerationErr(err) != nil {
+			logger().Error("configfs-tsm report changed while reading its auxblob", "error", err)
+			return nil, err
+		}
+		logger().Debug("configfs-tsm provides no auxblob, returning the report alone", "error", err)
+		return resp, nil
+	}
+	resp.AuxBlob = auxblob
+	return resp, nil
+}
+
+// GetRawQuoteAtLevel returns byte format attestation plus certificate table via ConfigFS.
+func (p *LinuxConfigFsQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, level uint) ([]uint8, error) {
+	c, err := linuxtsm.MakeClient()
+	if err != nil {
+		return nil, err
+	}
+	return getConfigFsRawQuote(c, &report.Request{
+		InBlob:     reportData[:],
+		GetAuxBlob: true,
+		Privilege: &report.Privilege{
+			Level: level,
+		},
+	})
+}
+
 // GetRawQuote returns byte format attestation plus certificate table via ConfigFS.
 func (p *LinuxConfigFsQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
 	req := &report.Request{
@@ -240,16 +395,11 @@ func (p *LinuxConfigFsQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8,
 			Level: uint(vmpl),
 		}
 	}
-	resp, err := linuxtsm.GetReport(req)
+	c, err := linuxtsm.MakeClient()
 	if err != nil {
 		return nil, err
 	}
-	// Mix the platform info in with the auxblob.
-	extended, err := abi.ExtendedPlatformCertTable(resp.AuxBlob)
-	if err != nil {
-		return nil, fmt.Errorf("invalid certificate table: %v", err)
-	}
-	return append(resp.OutBlob, extended...), nil
+	return getConfigFsRawQuote(c, req)
 }
 
 // Product returns the current CPU's associated AMD SEV product information.
@@ -259,30 +409,119 @@ func (*LinuxConfigFsQuoteProvider) Product() *spb.SevProduct {
 	return abi.SevProduct()
 }
 
-// GetQuoteProvider returns a supported SEV-SNP QuoteProvider.
-func GetQuoteProvider() (QuoteProvider, error) {
-	var provider QuoteProvider
-	provider = &LinuxConfigFsQuoteProvider{}
-	if provider.IsSupported() {
-		return provider, nil
+// defaultTpmDevicePath is the vTPM through the kernel's resource manager, which lets concurrent
+// TPM users share the device.
+const defaultTpmDevicePath = "/dev/tpmrm0"
+
+// linuxTpm sends TPM 2.0 commands through a Linux TPM character device.
+type linuxTpm struct {
+	f *os.File
+}
+
+func openTpm(path string) (*linuxTpm, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open TPM at %s: %v", path, err)
 	}
-	provider = &LinuxIoctlQuoteProvider{}
-	if provider.IsSupported() {
-		return provider, nil
+	return &linuxTpm{f: f}, nil
+}
+
+// SendCommand writes a marshaled TPM 2.0 command and reads its response.
+func (t *linuxTpm) SendCommand(command []byte) ([]byte, error) {
+	if _, err := t.f.Write(command); err != nil {
+		return nil, fmt.Errorf("could not send TPM command: %v", err)
+	}
+	resp := make([]byte, tpmMaxResponseSize)
+	n, err := t.f.Read(resp)
+	if err != nil {
+		return nil, fmt.Errorf("could not read TPM response: %v", err)
+	}
+	return resp[:n], nil
+}
+
+// Close closes the TPM device.
+func (t *linuxTpm) Close() error {
+	return t.f.Close()
+}
+
+// LinuxHclQuoteProvider implements the QuoteProvider interface for Azure confidential VMs, where
+// the paravisor (HCL) owns VMPL0 and provides the attestation report through the vTPM instead of
+// /dev/sev-guest.
+type LinuxHclQuoteProvider struct {
+	// TpmPath is the vTPM device to open. If empty, /dev/tpmrm0 is used.
+	TpmPath string
+}
+
+func (p *LinuxHclQuoteProvider) openTpm() (*linuxTpm, error) {
+	if p.TpmPath != "" {
+		return openTpm(p.TpmPath)
+	}
+	return openTpm(defaultTpmDevicePath)
+}
+
+// IsSupported checks if the vTPM exposes an HCL attestation report.
+func (p *LinuxHclQuoteProvider) IsSupported() bool {
+	t, err := p.openTpm()
+	if err != nil {
+		return false
+	}
+	defer t.Close()
+	_, err = nvSize(t, hclReportNvIndex)
+	return err == nil
+}
+
+// GetRawQuote returns byte format attestation plus certificate table via the vTPM. The table holds
+// the HCL runtime claims that REPORT_DATA binds reportData through, not AMD certificates.
+func (p *LinuxHclQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
+	t, err := p.openTpm()
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("no supported SEV-SNP QuoteProvider found")
+	defer t.Close()
+	return getHclRawQuote(t, reportData)
+}
+
+// GetRawQuoteAtLevel returns byte format attestation plus certificate table via the vTPM. The HCL
+// only requests reports at VMPL0.
+func (p *LinuxHclQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, level uint) ([]uint8, error) {
+	if level != 0 {
+		return nil, fmt.Errorf("the HCL only provides VMPL0 reports, not VMPL%d", level)
+	}
+	return p.GetRawQuote(reportData)
+}
+
+// Product returns AMD SEV-related CPU information of the calling CPU.
+//
+// Deprecated: Use abi.ExtraPlatformInfoGUID in the raw quote certificate table.
+func (*LinuxHclQuoteProvider) Product() *spb.SevProduct {
+	return abi.SevProduct()
 }
 
-// GetLeveledQuoteProvider returns a supported SEV-SNP LeveledQuoteProvider.
-func GetLeveledQuoteProvider() (LeveledQuoteProvider, error) {
-	var provider LeveledQuoteProvider
-	provider = &LinuxConfigFsQuoteProvider{}
-	if provider.IsSupported() {
-		return provider, nil
+// Capabilities probes the configfs-tsm report interface, the SEV guest device, and the vTPM for the
+// attestation features they offer.
+func Capabilities() *PlatformCapabilities {
+	caps := &PlatformCapabilities{}
+	if c, err := linuxtsm.MakeClient(); err == nil {
+		probeConfigFsCapabilities(c, caps)
+	}
+	if d, err := OpenDevice(); err == nil {
+		probeDeviceCapabilities(d, caps)
+		d.Close()
 	}
-	provider = &LinuxIoctlQuoteProvider{}
-	if provider.IsSupported() {
-		return provider, nil
+	if (&LinuxHclQuoteProvider{}).IsSupported() {
+		caps.Providers = append(caps.Providers, abi.QuoteProviderAzureHcl)
+		if caps.Vmpls == nil {
+			caps.Vmpls = []uint{0}
+		}
+	}
+	return caps
+}
+
+// platformQuoteProviders returns the Linux quote providers in preference order.
+func platformQuoteProviders(o *providerOptions) []providerCandidate {
+	return []providerCandidate{
+		{kind: abi.QuoteProviderConfigfsTsm, provider: &LinuxConfigFsQuoteProvider{}},
+		{kind: abi.QuoteProviderIoctl, provider: &LinuxIoctlQuoteProvider{DevicePath: o.devicePath}},
+		{kind: abi.QuoteProviderAzureHcl, provider: &LinuxHclQuoteProvider{}},
 	}
-	return nil, fmt.Errorf("no supported SEV-SNP LeveledQuoteProvider found")
 }
@@ -0,0 +1,271 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || freebsd || openbsd || netbsd
+
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-configfs-tsm/configfs/configfsi"
+	"github.com/google/go-configfs-tsm/configfs/faketsm"
+	"github.com/google/go-configfs-tsm/report"
+	"github.com/google/go-sev-guest/abi"
+	test "github.com/google/go-sev-guest/testing"
+	"github.com/google/uuid"
+)
+
+// fakeSnpTsm returns a configfs-tsm client whose outblob is an SEV-SNP report generated at the
+// written privlevel, offset by vmplSkew to emulate a misbehaving provider. A nil auxblob emulates a
+// kernel without the auxblob attribute.
+func fakeSnpTsm(floor uint, vmplSkew uint32, auxblob []byte) *faketsm.Client {
+	sub := faketsm.ReportV7(floor)
+	makeV7, readV7 := sub.MakeEntry, sub.ReadAttr
+	sub.MakeEntry = func() *faketsm.ReportEntry {
+		e := makeV7()
+		e.ROAttrs = map[string][]byte{
+			"provider":        []byte("sev_guest\n"),
+			"privlevel_floor": []byte(strconv.Itoa(int(floor)) + "\n"),
+		}
+		return e
+	}
+	sub.ReadAttr = func(e *faketsm.ReportEntry, attr string) ([]byte, error) {
+		switch attr {
+		case "outblob":
+			level, err := strconv.ParseUint(strings.TrimSpace(string(e.InAttrs["privlevel"].Value)), 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			data := make([]byte, abi.ReportSize)
+			binary.LittleEndian.PutUint32(data[0x00:0x04], abi.ReportVersion2)
+			binary.LittleEndian.PutUint64(data[0x08:0x10], 0x30000) // Reserved policy bit 17 must be 1.
+			binary.LittleEndian.PutUint32(data[0x30:0x34], uint32(level)+vmplSkew)
+			copy(data[0x50:0x90], e.InAttrs["inblob"].Value)
+			return data, nil
+		case "auxblob":
+			if auxblob == nil {
+				return nil, os.ErrNotExist
+			}
+			return auxblob, nil
+		}
+		return readV7(e, attr)
+	}
+	return &faketsm.Client{Subsystems: map[string]configfsi.Client{"report": sub}}
+}
+
+func TestGetConfigFsRawQuote(t *testing.T) {
+	var reportData [64]byte
+	copy(reportData[:], "nonce")
+	tcs := []struct {
+		name     string
+		floor    uint
+		skew     uint32
+		priv     *report.Privilege
+		wantVmpl uint32
+		wantErr  string
+	}{
+		{name: "default", wantVmpl: 0},
+		{name: "requested", floor: 1, priv: &report.Privilege{Level: 2}, wantVmpl: 2},
+		{name: "below floor", floor: 2, priv: &report.Privilege{Level: 1},
+			wantErr: "requested VMPL 1 is more privileged than the configfs-tsm privlevel_floor 2"},
+		{name: "wrong vmpl", skew: 1, priv: &report.Privilege{Level: 1},
+			wantErr: "report VMPL 2 is not the requested VMPL 1"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := getConfigFsRawQuote(fakeSnpTsm(tc.floor, tc.skew, []byte{}), &report.Request{
+				InBlob:     reportData[:],
+				GetAuxBlob: true,
+				Privilege:  tc.priv,
+			})
+			if (err == nil) != (tc.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("getConfigFsRawQuote() = _, %v. Want error %q", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			attestation, err := abi.ReportCertsToProto(raw)
+			if err != nil {
+				t.Fatalf("ReportCertsToProto(getConfigFsRawQuote()) = _, %v. Want nil", err)
+			}
+			if !bytes.Equal(attestation.GetReport().GetReportData(), reportData[:]) {
+				t.Errorf("getConfigFsRawQuote() report data = %v, want %v", attestation.GetReport().GetReportData(), reportData)
+			}
+			info, err := abi.ParseExtraPlatformInfo(attestation.GetCertificateChain().GetExtras()[abi.ExtraPlatformInfoGUID])
+			if err != nil {
+				t.Fatalf("ParseExtraPlatformInfo() = _, %v. Want nil", err)
+			}
+			if info.Provider != abi.QuoteProviderConfigfsTsm || info.Vmpl != tc.wantVmpl {
+				t.Errorf("getConfigFsRawQuote() platform info = %+v, want provider %v at VMPL %d", info,
+					abi.QuoteProviderConfigfsTsm, tc.wantVmpl)
+			}
+		})
+	}
+}
+
+func TestGetConfigFsAuxBlob(t *testing.T) {
+	vcek := []byte("vcek")
+	certs := &abi.CertTable{Entries: []abi.CertTableEntry{{GUID: uuid.MustParse(abi.VcekGUID), RawCert: vcek}}}
+	tcs := []struct {
+		name     string
+		auxblob  []byte
+		wantVcek []byte
+	}{
+		{name: "certificates", auxblob: certs.Marshal(), wantVcek: vcek},
+		{name: "no certificates", auxblob: []byte{}},
+		{name: "no auxblob attribute"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := getConfigFsRawQuote(fakeSnpTsm(0, 0, tc.auxblob), &report.Request{
+				InBlob:     make([]byte, 64),
+				GetAuxBlob: true,
+			})
+			if err != nil {
+				t.Fatalf("getConfigFsRawQuote() = _, %v. Want nil", err)
+			}
+			attestation, err := abi.ReportCertsToProto(raw)
+			if err != nil {
+				t.Fatalf("ReportCertsToProto(getConfigFsRawQuote()) = _, %v. Want nil", err)
+			}
+			if got := attestation.GetCertificateChain().GetVcekCert(); !bytes.Equal(got, tc.wantVcek) {
+				t.Errorf("getConfigFsRawQuote() VCEK = %q, want %q", got, tc.wantVcek)
+			}
+			// The VCEK certificate carries the platform information itself.
+			_, hasInfo := attestation.GetCertificateChain().GetExtras()[abi.ExtraPlatformInfoGUID]
+			if wantInfo := tc.wantVcek == nil; hasInfo != wantInfo {
+				t.Errorf("getConfigFsRawQuote() has ExtraPlatformInfo %t, want %t", hasInfo, wantInfo)
+			}
+		})
+	}
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	caps := &PlatformCapabilities{}
+	probeConfigFsCapabilities(fakeSnpTsm(1, 0, []byte{}), caps)
+	probeDeviceCapabilities(&test.Device{Certs: make([]byte, 0x1000)}, caps)
+	want := &PlatformCapabilities{
+		Providers:       []abi.QuoteProviderKind{abi.QuoteProviderConfigfsTsm, abi.QuoteProviderIoctl},
+		ConfigfsTsm:     true,
+		ExtendedReports: true,
+		DerivedKeys:     true,
+		Vmpls:           []uint{1, 2, 3},
+		CertTableSize:   0x1000,
+	}
+	if diff := cmp.Diff(want, caps); diff != "" {
+		t.Errorf("probed capabilities differ (-want +got): %s", diff)
+	}
+	if caps.SupportsVmpl(0) || !caps.SupportsVmpl(1) {
+		t.Errorf("SupportsVmpl() does not follow the privlevel floor of 1")
+	}
+
+	caps = &PlatformCapabilities{}
+	probeDeviceCapabilities(&test.Device{}, caps)
+	if caps.ExtendedReports || caps.CertTableSize != 0 || !caps.SupportsVmpl(0) {
+		t.Errorf("device without certificates probed as %+v", caps)
+	}
+}
+
+// fakeSvsmTsm returns a configfs-tsm client like fakeSnpTsm that also serves the SVSM service
+// attributes. Its manifest names the requested service GUID and manifest version.
+func fakeSvsmTsm() *faketsm.Client {
+	c := fakeSnpTsm(0, 0, []byte{})
+	sub := c.Subsystems["report"].(*faketsm.ReportSubsystem)
+	makeSnp, readSnp, checkSnp := sub.MakeEntry, sub.ReadAttr, sub.CheckInAttr
+	sub.MakeEntry = func() *faketsm.ReportEntry {
+		e := makeSnp()
+		for _, attr := range []string{"service_provider", "service_guid", "service_manifest_version"} {
+			e.InAttrs[attr] = &faketsm.ReportAttributeState{}
+		}
+		return e
+	}
+	sub.CheckInAttr = func(e *faketsm.ReportEntry, attr string, contents []byte) error {
+		if _, ok := e.InAttrs[attr]; ok && strings.HasPrefix(attr, "service_") {
+			return nil
+		}
+		return checkSnp(e, attr, contents)
+	}
+	sub.ReadAttr = func(e *faketsm.ReportEntry, attr string) ([]byte, error) {
+		if attr == "manifestblob" {
+			if string(e.InAttrs["service_provider"].Value) != "svsm" {
+				return nil, os.ErrNotExist
+			}
+			return []byte(string(e.InAttrs["service_guid"].Value) + ":" + string(e.InAttrs["service_manifest_version"].Value)), nil
+		}
+		return readSnp(e, attr)
+	}
+	return c
+}
+
+func TestGetConfigFsSvsmQuote(t *testing.T) {
+	version := uint32(1)
+	tcs := []struct {
+		name         string
+		req          *SvsmServiceRequest
+		wantManifest string
+	}{
+		{name: "all services", wantManifest: ":"},
+		{name: "vTPM", req: &SvsmServiceRequest{ServiceGUID: SvsmVtpmServiceGUID, ManifestVersion: &version},
+			wantManifest: SvsmVtpmServiceGUID + ":1"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			quote, err := getConfigFsSvsmQuote(fakeSvsmTsm(), [64]byte{1}, tc.req)
+			if err != nil {
+				t.Fatalf("getConfigFsSvsmQuote() = _, %v. Want nil", err)
+			}
+			if string(quote.Manifest) != tc.wantManifest {
+				t.Errorf("getConfigFsSvsmQuote() manifest = %q, want %q", quote.Manifest, tc.wantManifest)
+			}
+			if len(quote.RawQuote) < abi.ReportSize || quote.RawQuote[0x50] != 1 {
+				t.Errorf("getConfigFsSvsmQuote() raw quote is not the report for the report data")
+			}
+		})
+	}
+	if _, err := getConfigFsSvsmQuote(fakeSnpTsm(0, 0, []byte{}), [64]byte{}, nil); err == nil {
+		t.Error("getConfigFsSvsmQuote() without the service attributes = _, nil. Want error")
+	}
+}
+
+func TestIoctlQuoteProviderDevicePath(t *testing.T) {
+	const path = "/nonexistent/sev-guest"
+	qp := &LinuxIoctlQuoteProvider{DevicePath: path}
+	if qp.IsSupported() {
+		t.Errorf("IsSupported() = true for missing device %s", path)
+	}
+	if _, err := qp.GetRawQuote([64]byte{}); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("GetRawQuote() = _, %v. Want an error opening %s", err, path)
+	}
+}
+
+func TestHclQuoteProviderTpmPath(t *testing.T) {
+	const path = "/nonexistent/tpmrm0"
+	qp := &LinuxHclQuoteProvider{TpmPath: path}
+	if qp.IsSupported() {
+		t.Errorf("IsSupported() = true for missing vTPM %s", path)
+	}
+	if _, err := qp.GetRawQuote([64]byte{}); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("GetRawQuote() = _, %v. Want an error opening %s", err, path)
+	}
+	if _, err := qp.GetRawQuoteAtLevel([64]byte{}, 1); err == nil {
+		t.Error("GetRawQuoteAtLevel(1) = _, nil. Want error since the HCL only provides VMPL0 reports")
+	}
+}
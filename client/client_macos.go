@@ -71,12 +71,12 @@ func (*MacOSQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, level uint) (
 	return nil, fmt.Errorf("MacOS is unsupported")
 }
 
-// GetQuoteProvider returns a supported SEV-SNP QuoteProvider.
-func GetQuoteProvider() (QuoteProvider, error) {
-	return nil, fmt.Errorf("MacOS is unsupported")
+// Capabilities reports no attestation features, since MacOS is unsupported.
+func Capabilities() *PlatformCapabilities {
+	return &PlatformCapabilities{}
 }
 
-// GetLeveledQuoteProvider returns a supported SEV-SNP LeveledQuoteProvider.
-func GetLeveledQuoteProvider() (LeveledQuoteProvider, error) {
-	return nil, fmt.Errorf("MacOS is unsupported")
+// platformQuoteProviders returns no quote providers, since MacOS is unsupported.
+func platformQuoteProviders(*providerOptions) []providerCandidate {
+	return nil
 }
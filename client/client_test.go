@@ -17,9 +17,12 @@ package client
 import (
 	"bytes"
 	"crypto/x509"
+	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -28,6 +31,7 @@ import (
 	labi "github.com/google/go-sev-guest/client/linuxabi"
 	spb "github.com/google/go-sev-guest/proto/sevsnp"
 	test "github.com/google/go-sev-guest/testing"
+	"github.com/google/uuid"
 	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/testing/protocmp"
 )
@@ -200,6 +204,28 @@ func TestOpenGetRawExtendedReportClose(t *testing.T) {
 	}
 }
 
+func TestGetRawExtendedQuote(t *testing.T) {
+	devMu.Do(initDevice)
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			report, certs, err := GetRawExtendedQuote(qp, tc.Input)
+			if !test.Match(err, tc.WantErr) {
+				t.Fatalf("GetRawExtendedQuote(qp, %v) = _, _, %v. Want err: %v", tc.Input, err, tc.WantErr)
+			}
+			if tc.WantErr != "" {
+				return
+			}
+			if len(report) != abi.ReportSize {
+				t.Errorf("GetRawExtendedQuote(qp, %v) report is %d bytes, want %d", tc.Input, len(report), abi.ReportSize)
+			}
+			table := new(abi.CertTable)
+			if err := table.Unmarshal(certs); err != nil {
+				t.Errorf("GetRawExtendedQuote(qp, %v) certificate table is malformed: %v", tc.Input, err)
+			}
+		})
+	}
+}
+
 func TestGetQuoteProto(t *testing.T) {
 	devMu.Do(initDevice)
 	for _, tc := range tests {
@@ -273,3 +299,68 @@ func TestGetDerivedKey(t *testing.T) {
 		t.Errorf("GetDerivedKey...(nothing) = %v and %v. Expected equality", key1.Data, key3.Data)
 	}
 }
+
+// certLengthDevice serves extended reports with a certificate table of its choosing. It demands
+// each of demands in turn as the required buffer length, then returns table and reports returned.
+type certLengthDevice struct {
+	demands  []uint32
+	table    []byte
+	returned uint32
+}
+
+func (d *certLengthDevice) Open(string) error { return nil }
+func (d *certLengthDevice) Close() error      { return nil }
+func (d *certLengthDevice) Ioctl(command uintptr, req any) (uintptr, error) {
+	sreq := req.(*labi.SnpUserGuestRequest)
+	if command != labi.IocSnpGetExtendedReport {
+		return 0, nil
+	}
+	ext := sreq.ReqData.(*labi.SnpExtendedReportReq)
+	if len(d.demands) != 0 && ext.CertsLength < d.demands[0] {
+		ext.CertsLength = d.demands[0]
+		d.demands = d.demands[1:]
+		sreq.FwErr = uint64(abi.GuestRequestInvalidLength)
+		return 0, syscall.EIO
+	}
+	copy(ext.Certs, d.table)
+	ext.CertsLength = d.returned
+	return 0, nil
+}
+func (d *certLengthDevice) Product() *spb.SevProduct { return nil }
+
+func TestGetRawExtendedReportCertLength(t *testing.T) {
+	var lengthErr *CertTableLengthError
+	entry := make([]byte, abi.CertTableEntrySize)
+	copy(entry, uuid.MustParse(abi.VcekGUID).NodeID()) // Any nonzero GUID.
+	overflow := append([]byte{}, entry...)
+	binary.LittleEndian.PutUint32(overflow[16:20], 0xFFFFFFF0)
+	binary.LittleEndian.PutUint32(overflow[20:24], 0x20)
+	overflow = append(overflow, make([]byte, 2*abi.CertTableEntrySize)...)
+	tcs := []struct {
+		name          string
+		d             *certLengthDevice
+		wantLengthErr bool
+		wantErr       bool
+	}{
+		{name: "grown", d: &certLengthDevice{demands: []uint32{0x100, 0x200}, returned: 0x200}},
+		{name: "too large", d: &certLengthDevice{demands: []uint32{MaxCertTableSize + 1}}, wantLengthErr: true},
+		{name: "grown too large", d: &certLengthDevice{demands: []uint32{0x100, MaxCertTableSize + 1}}, wantLengthErr: true},
+		{name: "keeps growing", d: &certLengthDevice{demands: []uint32{0x100, 0x200, 0x300, 0x400}}, wantErr: true},
+		{name: "returned exceeds buffer", d: &certLengthDevice{demands: []uint32{0x100}, returned: 0x1000}, wantLengthErr: true},
+		{name: "entry outside table", d: &certLengthDevice{demands: []uint32{0x100}, table: overflow, returned: 0x100}, wantLengthErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, certs, err := GetRawExtendedReport(tc.d, [64]byte{})
+			if gotLengthErr := errors.As(err, &lengthErr); gotLengthErr != tc.wantLengthErr {
+				t.Errorf("GetRawExtendedReport() = _, _, %v. Want CertTableLengthError %t", err, tc.wantLengthErr)
+			}
+			if gotErr := err != nil; gotErr != (tc.wantErr || tc.wantLengthErr) {
+				t.Fatalf("GetRawExtendedReport() = _, _, %v. Want error %t", err, tc.wantErr || tc.wantLengthErr)
+			}
+			if err == nil && len(certs) != int(tc.d.returned) {
+				t.Errorf("GetRawExtendedReport() certificate table is %d bytes, want %d", len(certs), tc.d.returned)
+			}
+		})
+	}
+}
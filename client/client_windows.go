@@ -18,8 +18,11 @@ package client
 
 import (
 	"fmt"
+	"unsafe"
 
+	"github.com/google/go-sev-guest/abi"
 	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"golang.org/x/sys/windows"
 )
 
 // WindowsDevice implements the Device interface with Linux ioctls.
@@ -51,30 +54,120 @@ func (*WindowsDevice) Product() *spb.SevProduct {
 	return &spb.SevProduct{}
 }
 
-// WindowsQuoteProvider implements the QuoteProvider interface with Linux's configfs-tsm.
+// tbsCommander sends TPM 2.0 commands through the Windows TPM Base Services.
+type tbsCommander struct {
+	handle uintptr
+}
+
+var (
+	tbsDLL                 = windows.NewLazySystemDLL("tbs.dll")
+	procTbsiContextCreate  = tbsDLL.NewProc("Tbsi_Context_Create")
+	procTbsipSubmitCommand = tbsDLL.NewProc("Tbsip_Submit_Command")
+	procTbsipContextClose  = tbsDLL.NewProc("Tbsip_Context_Close")
+)
+
+const (
+	tbsContextVersionTwo     = 2
+	tbsIncludeTpm20          = 1 << 2
+	tbsCommandLocalityZero   = 0
+	tbsCommandPriorityNormal = 200
+	tbsMaxResponseSize       = 4096
+)
+
+// tbsContextParams2 is TBS_CONTEXT_PARAMS2.
+type tbsContextParams2 struct {
+	version uint32
+	flags   uint32
+}
+
+func openTbs() (*tbsCommander, error) {
+	if err := tbsDLL.Load(); err != nil {
+		return nil, fmt.Errorf("could not load TPM Base Services: %v", err)
+	}
+	params := tbsContextParams2{version: tbsContextVersionTwo, flags: tbsIncludeTpm20}
+	var handle uintptr
+	rc, _, _ := procTbsiContextCreate.Call(uintptr(unsafe.Pointer(&params)), uintptr(unsafe.Pointer(&handle)))
+	if rc != 0 {
+		return nil, fmt.Errorf("Tbsi_Context_Create failed: 0x%x", rc)
+	}
+	return &tbsCommander{handle: handle}, nil
+}
+
+// SendCommand submits a marshaled TPM 2.0 command and returns the response.
+func (t *tbsCommander) SendCommand(command []byte) ([]byte, error) {
+	resp := make([]byte, tbsMaxResponseSize)
+	size := uint32(len(resp))
+	rc, _, _ := procTbsipSubmitCommand.Call(t.handle, tbsCommandLocalityZero, tbsCommandPriorityNormal,
+		uintptr(unsafe.Pointer(&command[0])), uintptr(len(command)),
+		uintptr(unsafe.Pointer(&resp[0])), uintptr(unsafe.Pointer(&size)))
+	if rc != 0 {
+		return nil, fmt.Errorf("Tbsip_Submit_Command failed: 0x%x", rc)
+	}
+	return resp[:size], nil
+}
+
+// Close releases the TBS context.
+func (t *tbsCommander) Close() error {
+	if rc, _, _ := procTbsipContextClose.Call(t.handle); rc != 0 {
+		return fmt.Errorf("Tbsip_Context_Close failed: 0x%x", rc)
+	}
+	return nil
+}
+
+// WindowsQuoteProvider implements the QuoteProvider interface for Azure confidential VMs, where the
+// paravisor (HCL) provides the attestation report through the vTPM.
 type WindowsQuoteProvider struct{}
 
-// IsSupported checks if the quote provider is supported.
+// IsSupported checks if the vTPM exposes an HCL attestation report.
 func (*WindowsQuoteProvider) IsSupported() bool {
-	return false
+	t, err := openTbs()
+	if err != nil {
+		return false
+	}
+	defer t.Close()
+	_, err = nvSize(t, hclReportNvIndex)
+	return err == nil
 }
 
-// GetRawQuote returns byte format attestation plus certificate table via ConfigFS.
+// GetRawQuote returns byte format attestation plus certificate table via the vTPM. The table holds
+// the HCL runtime claims that REPORT_DATA binds reportData through, not AMD certificates.
 func (*WindowsQuoteProvider) GetRawQuote(reportData [64]byte) ([]byte, error) {
-	return nil, fmt.Errorf("Windows is unsupported")
+	t, err := openTbs()
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	return getHclRawQuote(t, reportData)
 }
 
-// GetRawQuoteAtLevel returns byte format attestation plus certificate table via ConfigFS.
-func (*WindowsQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, level uint) ([]byte, error) {
-	return nil, fmt.Errorf("Windows is unsupported")
+// GetRawQuoteAtLevel returns byte format attestation plus certificate table via the vTPM. The HCL
+// only requests reports at VMPL0.
+func (p *WindowsQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, level uint) ([]byte, error) {
+	if level != 0 {
+		return nil, fmt.Errorf("the HCL only provides VMPL0 reports, not VMPL%d", level)
+	}
+	return p.GetRawQuote(reportData)
 }
 
-// GetQuoteProvider returns a supported SEV-SNP QuoteProvider.
-func GetQuoteProvider() (QuoteProvider, error) {
-	return nil, fmt.Errorf("Windows is unsupported")
+// Product returns the current CPU's associated AMD SEV product information.
+//
+// Deprecated: Use ExtraPlatformInfoGUID from the cert table.
+func (*WindowsQuoteProvider) Product() *spb.SevProduct {
+	return abi.SevProduct()
 }
 
-// GetLeveledQuoteProvider returns a supported SEV-SNP LeveledQuoteProvider.
-func GetLeveledQuoteProvider() (LeveledQuoteProvider, error) {
-	return nil, fmt.Errorf("Windows is unsupported")
+// Capabilities reports the HCL quote provider if the vTPM exposes an HCL attestation report. The HCL
+// only requests VMPL0 reports and offers no derived keys.
+func Capabilities() *PlatformCapabilities {
+	caps := &PlatformCapabilities{}
+	if (&WindowsQuoteProvider{}).IsSupported() {
+		caps.Providers = append(caps.Providers, abi.QuoteProviderAzureHcl)
+		caps.Vmpls = []uint{0}
+	}
+	return caps
+}
+
+// platformQuoteProviders returns the Windows quote providers in preference order.
+func platformQuoteProviders(*providerOptions) []providerCandidate {
+	return []providerCandidate{{kind: abi.QuoteProviderAzureHcl, provider: &WindowsQuoteProvider{}}}
 }
@@ -0,0 +1,99 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// DefaultDerivedKeyLength is the length in bytes of keys that DeriveKey returns by default.
+	DefaultDerivedKeyLength = 32
+	// maxDerivedKeyLength is the most output HKDF-SHA256 can expand to.
+	maxDerivedKeyLength = 255 * sha256.Size
+
+	derivedKeySalt       = "go-sev-guest derived key salt"
+	derivedKeyInfoPrefix = "go-sev-guest derived key v1"
+)
+
+// DerivedKeyOptions selects the firmware key derivation parameters and the application-specific
+// expansion of a key from DeriveKey.
+type DerivedKeyOptions struct {
+	// Request selects the root key and the guest information that the AMD-SP mixes into the key.
+	// Its GuestSVN and TCBVersion are floors: guests with at least these values can derive the key.
+	Request SnpDerivedKeyReq
+	// Label separates the keys of different applications and purposes. It must not be empty.
+	Label string
+	// Length is the length of the key in bytes. If zero, DefaultDerivedKeyLength is used.
+	Length int
+}
+
+// derivedKeyInfo returns the HKDF info that binds the expanded key to the label and to every
+// firmware derivation parameter, so that keys for different purposes never coincide.
+func derivedKeyInfo(opts *DerivedKeyOptions, length int) []byte {
+	info := []byte(derivedKeyInfoPrefix)
+	info = binary.BigEndian.AppendUint32(info, uint32(len(opts.Label)))
+	info = append(info, opts.Label...)
+	var rootKey uint8
+	if opts.Request.UseVCEK {
+		rootKey = 1
+	}
+	info = append(info, rootKey)
+	info = binary.BigEndian.AppendUint64(info, opts.Request.GuestFieldSelect.ABI())
+	info = binary.BigEndian.AppendUint32(info, opts.Request.Vmpl)
+	info = binary.BigEndian.AppendUint32(info, opts.Request.GuestSVN)
+	info = binary.BigEndian.AppendUint64(info, opts.Request.TCBVersion)
+	return binary.BigEndian.AppendUint32(info, uint32(length))
+}
+
+// DeriveKey returns key material for the purpose named by opts.Label. It expands the AMD-SP
+// derived key with HKDF-SHA256 rather than returning it directly, so that no two labels or
+// derivation parameters share a key and the firmware key itself is never exposed. The security
+// limitations of derived keys that the project README describes still apply.
+func DeriveKey(d Device, opts *DerivedKeyOptions) ([]byte, error) {
+	return DeriveKeyContext(context.Background(), d, opts)
+}
+
+// DeriveKeyContext behaves like DeriveKey, but retries throttled requests with DefaultRetryOptions
+// until ctx expires.
+func DeriveKeyContext(ctx context.Context, d Device, opts *DerivedKeyOptions) ([]byte, error) {
+	if opts.Label == "" {
+		return nil, fmt.Errorf("derived key label must not be empty")
+	}
+	length := opts.Length
+	if length == 0 {
+		length = DefaultDerivedKeyLength
+	}
+	if length < 0 || length > maxDerivedKeyLength {
+		return nil, fmt.Errorf("derived key length is %d bytes. Expect 1-%d", length, maxDerivedKeyLength)
+	}
+	resp, err := GetDerivedKeyAcknowledgingItsLimitationsContext(ctx, d, &opts.Request)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { resp.Data = [32]byte{} }()
+	key := make([]byte, length)
+	kdf := hkdf.New(sha256.New, resp.Data[:], []byte(derivedKeySalt), derivedKeyInfo(opts, length))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, fmt.Errorf("could not expand derived key: %v", err)
+	}
+	return key, nil
+}
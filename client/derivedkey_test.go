@@ -0,0 +1,80 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	labi "github.com/google/go-sev-guest/client/linuxabi"
+	test "github.com/google/go-sev-guest/testing"
+	"golang.org/x/crypto/hkdf"
+)
+
+func TestDeriveKey(t *testing.T) {
+	vmrkKey := bytes.Repeat([]byte{0x11}, 32)
+	vcekKey := bytes.Repeat([]byte{0x22}, 32)
+	d := &test.Device{Keys: map[string][]byte{
+		test.DerivedKeyRequestToString(&labi.SnpDerivedKeyReqABI{RootKeySelect: 1}):                      vmrkKey,
+		test.DerivedKeyRequestToString(&labi.SnpDerivedKeyReqABI{RootKeySelect: 1, GuestFieldSelect: 8}): vmrkKey,
+		test.DerivedKeyRequestToString(&labi.SnpDerivedKeyReqABI{}):                                      vcekKey,
+	}}
+	derive := func(opts *DerivedKeyOptions) []byte {
+		t.Helper()
+		key, err := DeriveKey(d, opts)
+		if err != nil {
+			t.Fatalf("DeriveKey(%+v) = _, %v. Want nil", opts, err)
+		}
+		return key
+	}
+
+	disk := derive(&DerivedKeyOptions{Label: "disk"})
+	if len(disk) != DefaultDerivedKeyLength {
+		t.Errorf("DeriveKey() length = %d, want %d", len(disk), DefaultDerivedKeyLength)
+	}
+	if bytes.Equal(disk, vmrkKey) {
+		t.Error("DeriveKey() returned the firmware key unexpanded")
+	}
+	want := make([]byte, DefaultDerivedKeyLength)
+	opts := &DerivedKeyOptions{Label: "disk"}
+	io.ReadFull(hkdf.New(sha256.New, vmrkKey, []byte(derivedKeySalt), derivedKeyInfo(opts, len(want))), want)
+	if !bytes.Equal(disk, want) {
+		t.Errorf("DeriveKey() = %x, want HKDF expansion %x", disk, want)
+	}
+	if !bytes.Equal(derive(&DerivedKeyOptions{Label: "disk"}), disk) {
+		t.Error("DeriveKey() is not deterministic")
+	}
+
+	// The firmware returns the same key for these requests, yet each must yield a distinct key.
+	distinct := map[string]*DerivedKeyOptions{
+		"label":  {Label: "network"},
+		"fields": {Label: "disk", Request: SnpDerivedKeyReq{GuestFieldSelect: GuestFieldSelect{Measurement: true}}},
+		"root":   {Label: "disk", Request: SnpDerivedKeyReq{UseVCEK: true}},
+		"length": {Label: "disk", Length: 64},
+	}
+	for name, opts := range distinct {
+		if key := derive(opts); bytes.HasPrefix(key, disk[:16]) {
+			t.Errorf("DeriveKey(%s) shares the key %x of another purpose", name, key)
+		}
+	}
+
+	for _, opts := range []*DerivedKeyOptions{{}, {Label: "disk", Length: -1}, {Label: "disk", Length: 255*32 + 1}} {
+		if _, err := DeriveKey(d, opts); err == nil {
+			t.Errorf("DeriveKey(%+v) = _, nil. Want error", opts)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/google/go-sev-guest/abi"
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+	"go.uber.org/multierr"
+)
+
+// FallbackStep is one quote provider of a FallbackQuoteProvider chain.
+type FallbackStep struct {
+	// Kind identifies the provider in QuoteMetadata.
+	Kind abi.QuoteProviderKind
+	// Provider produces the quotes.
+	Provider QuoteProvider
+	// Probe returns whether the provider is healthy enough to try. If nil, Provider.IsSupported is
+	// used.
+	Probe func() bool
+}
+
+func (s *FallbackStep) healthy() bool {
+	if s.Probe != nil {
+		return s.Probe()
+	}
+	return s.Provider.IsSupported()
+}
+
+// QuoteMetadata describes how a FallbackQuoteProvider obtained a quote.
+type QuoteMetadata struct {
+	// Provider is the kind of the provider that produced the quote.
+	Provider abi.QuoteProviderKind
+	// Step is the position of that provider in the chain.
+	Step int
+	// Skipped combines the errors of the providers that were tried before it, or is nil.
+	Skipped error
+}
+
+// MetadataQuoteProvider is a LeveledQuoteProvider that also reports how it obtained each quote.
+// The provider that WithFallbackChain selects implements it, whatever other options are given.
+type MetadataQuoteProvider interface {
+	LeveledQuoteProvider
+	// GetRawQuoteWithMetadata returns a raw quote and how it was obtained.
+	GetRawQuoteWithMetadata(reportData [64]byte) ([]uint8, *QuoteMetadata, error)
+	// GetRawQuoteAtLevelWithMetadata returns a raw quote at the given VMPL and how it was obtained.
+	GetRawQuoteAtLevelWithMetadata(reportData [64]byte, vmpl uint) ([]uint8, *QuoteMetadata, error)
+}
+
+// FallbackQuoteProvider tries a chain of quote providers in order for each request, skipping those
+// whose probe fails, until one produces a quote. A throttled request is returned to the caller
+// rather than passed on, since every provider reaches the same AMD-SP.
+type FallbackQuoteProvider struct {
+	steps []FallbackStep
+}
+
+// NewFallbackQuoteProvider returns a provider that tries steps in the given order.
+func NewFallbackQuoteProvider(steps ...FallbackStep) *FallbackQuoteProvider {
+	return &FallbackQuoteProvider{steps: steps}
+}
+
+// IsSupported returns whether any provider in the chain is healthy.
+func (p *FallbackQuoteProvider) IsSupported() bool {
+	for i := range p.steps {
+		if p.steps[i].healthy() {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRawQuote returns a raw quote from the first provider in the chain to produce one.
+func (p *FallbackQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
+	quote, _, err := p.GetRawQuoteWithMetadata(reportData)
+	return quote, err
+}
+
+// GetRawQuoteAtLevel returns a raw quote at the given VMPL from the first LeveledQuoteProvider in
+// the chain to produce one.
+func (p *FallbackQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, vmpl uint) ([]uint8, error) {
+	quote, _, err := p.GetRawQuoteAtLevelWithMetadata(reportData, vmpl)
+	return quote, err
+}
+
+// GetRawQuoteWithMetadata returns a raw quote and which provider in the chain produced it.
+func (p *FallbackQuoteProvider) GetRawQuoteWithMetadata(reportData [64]byte) ([]uint8, *QuoteMetadata, error) {
+	return p.first(false, func(qp QuoteProvider) ([]uint8, error) {
+		return qp.GetRawQuote(reportData)
+	})
+}
+
+// GetRawQuoteAtLevelWithMetadata returns a raw quote at the given VMPL and which provider in the
+// chain produced it.
+func (p *FallbackQuoteProvider) GetRawQuoteAtLevelWithMetadata(reportData [64]byte, vmpl uint) ([]uint8, *QuoteMetadata, error) {
+	return p.first(true, func(qp QuoteProvider) ([]uint8, error) {
+		return qp.(LeveledQuoteProvider).GetRawQuoteAtLevel(reportData, vmpl)
+	})
+}
+
+// Product returns AMD SEV-related CPU information of the calling CPU.
+//
+// Deprecated: Use abi.ExtraPlatformInfoGUID in the raw quote certificate table.
+func (p *FallbackQuoteProvider) Product() *pb.SevProduct {
+	return abi.SevProduct()
+}
+
+func (p *FallbackQuoteProvider) first(leveled bool, get func(QuoteProvider) ([]uint8, error)) ([]uint8, *QuoteMetadata, error) {
+	var skipped error
+	for i := range p.steps {
+		step := &p.steps[i]
+		if _, ok := step.Provider.(LeveledQuoteProvider); leveled && !ok {
+			continue
+		}
+		if !step.healthy() {
+			logger().Debug("skipping unhealthy quote provider", "provider", step.Kind, "step", i)
+			skipped = multierr.Append(skipped, fmt.Errorf("%v quote provider is unhealthy", step.Kind))
+			continue
+		}
+		quote, err := get(step.Provider)
+		if err == nil {
+			return quote, &QuoteMetadata{Provider: step.Kind, Step: i, Skipped: skipped}, nil
+		}
+		if IsThrottled(err) {
+			return nil, nil, err
+		}
+		logger().Warn("quote provider failed, falling back", "provider", step.Kind, "step", i, "error", err)
+		skipped = multierr.Append(skipped, fmt.Errorf("%v quote provider: %w", step.Kind, err))
+	}
+	if skipped == nil {
+		return nil, nil, fmt.Errorf("no quote provider in the fallback chain applies")
+	}
+	return nil, nil, fmt.Errorf("every quote provider in the fallback chain failed: %w", skipped)
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-sev-guest/abi"
+)
+
+func TestFallbackQuoteProvider(t *testing.T) {
+	broken := &flakyQuoteProvider{failures: 1, err: errors.New("no device")}
+	unhealthy := &levelQuoteProvider{supported: true}
+	healthy := &levelQuoteProvider{supported: true}
+	qp := NewFallbackQuoteProvider(
+		FallbackStep{Kind: abi.QuoteProviderConfigfsTsm, Provider: broken},
+		FallbackStep{Kind: abi.QuoteProviderIoctl, Provider: unhealthy, Probe: func() bool { return false }},
+		FallbackStep{Kind: abi.QuoteProviderAzureHcl, Provider: unleveledQuoteProvider{}},
+		FallbackStep{Kind: abi.QuoteProviderAzureHcl, Provider: healthy},
+	)
+	_, meta, err := qp.GetRawQuoteAtLevelWithMetadata([64]byte{}, 1)
+	if err != nil {
+		t.Fatalf("GetRawQuoteAtLevelWithMetadata() = _, _, %v. Want nil", err)
+	}
+	if meta.Provider != abi.QuoteProviderAzureHcl || meta.Step != 3 {
+		t.Errorf("GetRawQuoteAtLevelWithMetadata() metadata = %+v. Want step 3 to produce the quote", meta)
+	}
+	if meta.Skipped == nil || len(unhealthy.levels) != 0 {
+		t.Errorf("GetRawQuoteAtLevelWithMetadata() did not skip the failed and unhealthy providers")
+	}
+	// The first provider has recovered.
+	_, meta, err = qp.GetRawQuoteWithMetadata([64]byte{})
+	if err != nil || meta.Step != 0 || meta.Skipped != nil {
+		t.Errorf("GetRawQuoteWithMetadata() = _, %+v, %v. Want step 0 to produce the quote", meta, err)
+	}
+
+	throttled := &flakyQuoteProvider{failures: 1, err: &abi.SevFirmwareErr{Status: abi.GuestRequestVmmBusy}}
+	qp = NewFallbackQuoteProvider(
+		FallbackStep{Kind: abi.QuoteProviderIoctl, Provider: throttled},
+		FallbackStep{Kind: abi.QuoteProviderAzureHcl, Provider: healthy},
+	)
+	if _, err := qp.GetRawQuote([64]byte{}); !IsThrottled(err) {
+		t.Errorf("GetRawQuote() = _, %v. Want the throttling error rather than a fallback", err)
+	}
+}
+
+func TestSelectFallbackChain(t *testing.T) {
+	unsupported := &levelQuoteProvider{}
+	supported := &levelQuoteProvider{supported: true}
+	candidates := []providerCandidate{
+		{kind: abi.QuoteProviderConfigfsTsm, provider: unsupported},
+		{kind: abi.QuoteProviderIoctl, provider: supported},
+	}
+	qp, err := selectQuoteProvider(applyOptions(WithFallbackChain()), candidates, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, ok := qp.(*FallbackQuoteProvider)
+	if !ok || len(chain.steps) != 2 {
+		t.Fatalf("selectQuoteProvider(WithFallbackChain()) = %v. Want a chain of both candidates", qp)
+	}
+	if _, meta, err := chain.GetRawQuoteWithMetadata([64]byte{}); err != nil || meta.Provider != abi.QuoteProviderIoctl {
+		t.Errorf("GetRawQuoteWithMetadata() = _, %+v, %v. Want the ioctl provider", meta, err)
+	}
+	if _, err := selectQuoteProvider(applyOptions(WithFallbackChain()), candidates[:1], false); err == nil {
+		t.Error("selectQuoteProvider(WithFallbackChain()) = _, nil without a supported provider. Want error")
+	}
+
+	// Other options wrap the chain, but keep its metadata.
+	supported.levels = nil
+	qp, err = selectQuoteProvider(applyOptions(WithFallbackChain(), WithVMPL(2), WithRetryPolicy(&RetryOptions{})), candidates, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withMeta, ok := qp.(MetadataQuoteProvider)
+	if !ok {
+		t.Fatalf("selectQuoteProvider(WithFallbackChain(), WithVMPL(2)) = %T. Want a MetadataQuoteProvider", qp)
+	}
+	if _, meta, err := withMeta.GetRawQuoteWithMetadata([64]byte{}); err != nil || meta.Provider != abi.QuoteProviderIoctl || meta.Step != 1 {
+		t.Errorf("GetRawQuoteWithMetadata() = _, %+v, %v. Want the ioctl provider at step 1", meta, err)
+	}
+	if _, meta, err := withMeta.GetRawQuoteAtLevelWithMetadata([64]byte{}, 3); err != nil || meta.Provider != abi.QuoteProviderIoctl {
+		t.Errorf("GetRawQuoteAtLevelWithMetadata() = _, %+v, %v. Want the ioctl provider", meta, err)
+	}
+	if want := []int{2, 3}; !reflect.DeepEqual(supported.levels, want) {
+		t.Errorf("chain requested VMPLs %v, want %v", supported.levels, want)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"sync"
+)
+
+// Logger receives the client's diagnostic messages about provider selection, retries, throttling,
+// and certificate handling. Arguments are alternating keys and values. A *slog.Logger satisfies
+// this interface.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
+
+var (
+	loggerMu     sync.RWMutex
+	activeLogger Logger = nopLogger{}
+)
+
+// SetLogger makes the client send its diagnostic messages to l. A nil l discards them, which is the
+// default.
+func SetLogger(l Logger) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	if l == nil {
+		l = nopLogger{}
+	}
+	activeLogger = l
+}
+
+// logger returns the logger that SetLogger installed.
+func logger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return activeLogger
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+)
+
+// recordingLogger records each message as its level and text.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) record(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, level+": "+msg)
+}
+
+func (l *recordingLogger) Debug(msg string, _ ...any) { l.record("DEBUG", msg) }
+func (l *recordingLogger) Info(msg string, _ ...any)  { l.record("INFO", msg) }
+func (l *recordingLogger) Warn(msg string, _ ...any)  { l.record("WARN", msg) }
+func (l *recordingLogger) Error(msg string, _ ...any) { l.record("ERROR", msg) }
+
+func (l *recordingLogger) contains(want string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, msg := range l.messages {
+		if strings.HasPrefix(msg, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSetLogger(t *testing.T) {
+	l := &recordingLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	qp := &flakyQuoteProvider{failures: 2, err: &abi.SevFirmwareErr{Status: abi.GuestRequestVmmBusy}}
+	opts := &RetryOptions{InitialDelay: time.Millisecond, MaxAttempts: 2}
+	if _, err := GetRawQuoteContext(context.Background(), qp, [64]byte{}, opts); err == nil {
+		t.Fatal("GetRawQuoteContext() = _, nil. Want the retry policy to give up")
+	}
+	candidates := []providerCandidate{
+		{kind: abi.QuoteProviderConfigfsTsm, provider: &levelQuoteProvider{}},
+		{kind: abi.QuoteProviderIoctl, provider: &levelQuoteProvider{supported: true}},
+	}
+	if _, err := selectQuoteProvider(&providerOptions{}, candidates, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"WARN: attestation request throttled, retrying",
+		"ERROR: attestation request still throttled, giving up",
+		"DEBUG: skipping unsupported quote provider",
+		"INFO: selected quote provider",
+	} {
+		if !l.contains(want) {
+			t.Errorf("logger did not receive %q. Got %q", want, l.messages)
+		}
+	}
+
+	SetLogger(nil)
+	if _, ok := logger().(nopLogger); !ok {
+		t.Errorf("SetLogger(nil) installed %T. Want the discarding logger", logger())
+	}
+}
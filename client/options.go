@@ -0,0 +1,335 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-sev-guest/abi"
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// providerCandidate is a quote provider, the interface it uses, and its selection priority.
+type providerCandidate struct {
+	kind     abi.QuoteProviderKind
+	priority int
+	provider QuoteProvider
+}
+
+// providerOptions holds the configuration that QuoteProviderOptions build up.
+type providerOptions struct {
+	vmpl       *uint
+	devicePath string
+	retry      *RetryOptions
+	preference []abi.QuoteProviderKind
+	atFloor    bool
+	fallback   bool
+}
+
+// QuoteProviderOption configures the quote provider that NewQuoteProvider or
+// NewLeveledQuoteProvider returns.
+type QuoteProviderOption func(*providerOptions)
+
+// WithVMPL makes GetRawQuote request reports at the given VMPL instead of the provider's default.
+func WithVMPL(vmpl uint) QuoteProviderOption {
+	return func(o *providerOptions) { o.vmpl = &vmpl }
+}
+
+// WithDevicePath makes the /dev/sev-guest ioctl provider open the given device path instead of the
+// one selected by --sev_guest_device_path.
+func WithDevicePath(path string) QuoteProviderOption {
+	return func(o *providerOptions) { o.devicePath = path }
+}
+
+// WithRetryPolicy makes the provider retry throttled requests according to opts instead of
+// DefaultRetryOptions.
+func WithRetryPolicy(opts *RetryOptions) QuoteProviderOption {
+	return func(o *providerOptions) { o.retry = opts }
+}
+
+// WithProviderPreference restricts provider selection to the given kinds, tried in the given order
+// regardless of their priority. Providers of the same kind are tried from highest to lowest
+// priority. Without this option, every provider of the platform is tried in the library's preferred
+// order, after registered providers of a higher priority.
+func WithProviderPreference(kinds ...abi.QuoteProviderKind) QuoteProviderOption {
+	return func(o *providerOptions) { o.preference = kinds }
+}
+
+// WithFallbackChain makes the provider try every candidate in selection order for each
+// request, rather than only the first supported one. See FallbackQuoteProvider.
+func WithFallbackChain() QuoteProviderOption {
+	return func(o *providerOptions) { o.fallback = true }
+}
+
+// WithPrivilegeLevelFloorFallback makes a request that fails with a PrivilegeLevelFloorError retry
+// once at the floor. The report's VMPL then differs from the requested one, so only use this option
+// when any VMPL that the guest may obtain is acceptable to the verifier.
+func WithPrivilegeLevelFloorFallback() QuoteProviderOption {
+	return func(o *providerOptions) { o.atFloor = true }
+}
+
+// configuredQuoteProvider applies a configured VMPL, retry policy, and floor fallback to a quote provider.
+type configuredQuoteProvider struct {
+	base    QuoteProvider
+	vmpl    *uint
+	retry   *RetryOptions
+	atFloor bool
+}
+
+// configuredProvider is a quote provider that applies a providerOptions configuration.
+type configuredProvider interface {
+	config() *configuredQuoteProvider
+}
+
+func (p *configuredQuoteProvider) config() *configuredQuoteProvider {
+	return p
+}
+
+// IsSupported returns whether the underlying provider is supported.
+func (p *configuredQuoteProvider) IsSupported() bool {
+	return p.base.IsSupported()
+}
+
+// GetRawQuote returns a raw report at the configured VMPL, or the provider's default if none.
+func (p *configuredQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
+	return p.getRawQuoteContext(context.Background(), reportData, nil)
+}
+
+// GetRawQuoteAtLevel returns a raw report at the given VMPL.
+func (p *configuredQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, vmpl uint) ([]uint8, error) {
+	return p.getRawQuoteAtLevelContext(context.Background(), reportData, vmpl, nil)
+}
+
+// Product returns AMD SEV-related CPU information of the calling CPU.
+//
+// Deprecated: Use abi.ExtraPlatformInfoGUID in the raw quote certificate table.
+func (p *configuredQuoteProvider) Product() *pb.SevProduct {
+	return p.base.Product()
+}
+
+func (p *configuredQuoteProvider) retryOptions(opts *RetryOptions) *RetryOptions {
+	if opts != nil {
+		return opts
+	}
+	return p.retry
+}
+
+func (p *configuredQuoteProvider) getRawQuoteContext(ctx context.Context, reportData [64]byte, opts *RetryOptions) ([]uint8, error) {
+	if p.vmpl != nil {
+		return p.getRawQuoteAtLevelContext(ctx, reportData, *p.vmpl, opts)
+	}
+	var result []uint8
+	err := retry(ctx, p.retryOptions(opts), func() (err error) {
+		result, err = p.base.GetRawQuote(reportData)
+		return err
+	})
+	if floor, ok := p.fallbackFloor(err); ok {
+		return p.getRawQuoteAtLevelContext(ctx, reportData, floor, opts)
+	}
+	return result, err
+}
+
+// fallbackFloor returns the VMPL to retry a request at if it failed for being below the floor and
+// the provider is configured to fall back.
+func (p *configuredQuoteProvider) fallbackFloor(err error) (uint, bool) {
+	var floorErr *PrivilegeLevelFloorError
+	if !p.atFloor || !errors.As(err, &floorErr) {
+		return 0, false
+	}
+	return floorErr.Floor, true
+}
+
+func (p *configuredQuoteProvider) getRawQuoteAtLevelContext(ctx context.Context, reportData [64]byte, vmpl uint, opts *RetryOptions) ([]uint8, error) {
+	leveled, ok := p.base.(LeveledQuoteProvider)
+	if !ok {
+		return nil, fmt.Errorf("quote provider %T does not support requesting a VMPL", p.base)
+	}
+	var result []uint8
+	err := retry(ctx, p.retryOptions(opts), func() (err error) {
+		result, err = leveled.GetRawQuoteAtLevel(reportData, vmpl)
+		return err
+	})
+	if floor, ok := p.fallbackFloor(err); ok && floor > vmpl {
+		err = retry(ctx, p.retryOptions(opts), func() (err error) {
+			result, err = leveled.GetRawQuoteAtLevel(reportData, floor)
+			return err
+		})
+	}
+	return result, err
+}
+
+// metadataRecorder passes requests on to a FallbackQuoteProvider and records the metadata of the
+// last quote it produced.
+type metadataRecorder struct {
+	chain *FallbackQuoteProvider
+	meta  *QuoteMetadata
+}
+
+func (r *metadataRecorder) IsSupported() bool {
+	return r.chain.IsSupported()
+}
+
+func (r *metadataRecorder) GetRawQuote(reportData [64]byte) (quote []uint8, err error) {
+	quote, r.meta, err = r.chain.GetRawQuoteWithMetadata(reportData)
+	return quote, err
+}
+
+func (r *metadataRecorder) GetRawQuoteAtLevel(reportData [64]byte, vmpl uint) (quote []uint8, err error) {
+	quote, r.meta, err = r.chain.GetRawQuoteAtLevelWithMetadata(reportData, vmpl)
+	return quote, err
+}
+
+func (r *metadataRecorder) Product() *pb.SevProduct {
+	return r.chain.Product()
+}
+
+// configuredFallbackQuoteProvider applies a configured VMPL, retry policy, and floor fallback to a
+// FallbackQuoteProvider, and still reports which provider in the chain produced a quote.
+type configuredFallbackQuoteProvider struct {
+	*configuredQuoteProvider
+	chain *FallbackQuoteProvider
+}
+
+// recording returns the configuration applied to a recorder of the chain's metadata.
+func (p *configuredFallbackQuoteProvider) recording() (*configuredQuoteProvider, *metadataRecorder) {
+	recorder := &metadataRecorder{chain: p.chain}
+	c := *p.configuredQuoteProvider
+	c.base = recorder
+	return &c, recorder
+}
+
+// GetRawQuoteWithMetadata returns a raw report at the configured VMPL, or the provider's default if
+// none, and which provider in the chain produced it.
+func (p *configuredFallbackQuoteProvider) GetRawQuoteWithMetadata(reportData [64]byte) ([]uint8, *QuoteMetadata, error) {
+	c, recorder := p.recording()
+	quote, err := c.GetRawQuote(reportData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return quote, recorder.meta, nil
+}
+
+// GetRawQuoteAtLevelWithMetadata returns a raw report at the given VMPL and which provider in the
+// chain produced it.
+func (p *configuredFallbackQuoteProvider) GetRawQuoteAtLevelWithMetadata(reportData [64]byte, vmpl uint) ([]uint8, *QuoteMetadata, error) {
+	c, recorder := p.recording()
+	quote, err := c.GetRawQuoteAtLevel(reportData, vmpl)
+	if err != nil {
+		return nil, nil, err
+	}
+	return quote, recorder.meta, nil
+}
+
+func newQuoteProvider(opts []QuoteProviderOption, leveled bool) (QuoteProvider, error) {
+	o := &providerOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return selectQuoteProvider(o, append(registeredQuoteProviders(), platformQuoteProviders(o)...), leveled)
+}
+
+// byPriority sorts candidates from highest to lowest priority. Ties keep their order, i.e.,
+// registration order, with registered providers before the platform's.
+func byPriority(candidates []providerCandidate) []providerCandidate {
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].priority > candidates[j].priority })
+	return candidates
+}
+
+// selectQuoteProvider returns the first supported candidate, or a chain of all of them with
+// WithFallbackChain, wrapped to apply the configured VMPL and retry policy if any. Candidates are
+// tried in priority order, or in the order of the preferred kinds if there is a preference. A
+// leveled selection, or one with a configured VMPL, only considers LeveledQuoteProviders.
+func selectQuoteProvider(o *providerOptions, candidates []providerCandidate, leveled bool) (QuoteProvider, error) {
+	if o.preference != nil {
+		var preferred []providerCandidate
+		for _, kind := range o.preference {
+			var ofKind []providerCandidate
+			for _, c := range candidates {
+				if c.kind == kind {
+					ofKind = append(ofKind, c)
+				}
+			}
+			preferred = append(preferred, byPriority(ofKind)...)
+		}
+		candidates = preferred
+	} else {
+		candidates = byPriority(candidates)
+	}
+	var steps []FallbackStep
+	for _, c := range candidates {
+		if _, ok := c.provider.(LeveledQuoteProvider); !ok && (leveled || o.vmpl != nil) {
+			continue
+		}
+		if o.fallback {
+			steps = append(steps, FallbackStep{Kind: c.kind, Provider: c.provider})
+			continue
+		}
+		if !c.provider.IsSupported() {
+			logger().Debug("skipping unsupported quote provider", "provider", c.kind)
+			continue
+		}
+		logger().Info("selected quote provider", "provider", c.kind)
+		return o.configure(c.provider), nil
+	}
+	if chain := NewFallbackQuoteProvider(steps...); o.fallback && chain.IsSupported() {
+		logger().Info("selected quote provider fallback chain", "providers", len(steps))
+		return o.configure(chain), nil
+	}
+	logger().Error("no supported SEV-SNP quote provider found", "candidates", len(candidates))
+	return nil, fmt.Errorf("no supported SEV-SNP quote provider found")
+}
+
+// configure wraps qp to apply the configured VMPL, retry policy, and floor fallback if any. A
+// wrapped FallbackQuoteProvider keeps its MetadataQuoteProvider methods.
+func (o *providerOptions) configure(qp QuoteProvider) QuoteProvider {
+	if o.vmpl == nil && o.retry == nil && !o.atFloor {
+		return qp
+	}
+	c := &configuredQuoteProvider{base: qp, vmpl: o.vmpl, retry: o.retry, atFloor: o.atFloor}
+	if chain, ok := qp.(*FallbackQuoteProvider); ok {
+		return &configuredFallbackQuoteProvider{configuredQuoteProvider: c, chain: chain}
+	}
+	return c
+}
+
+// NewQuoteProvider returns the first supported SEV-SNP QuoteProvider, configured by opts. Providers
+// registered with RegisterQuoteProvider are considered along with those of the platform.
+func NewQuoteProvider(opts ...QuoteProviderOption) (QuoteProvider, error) {
+	return newQuoteProvider(opts, false)
+}
+
+// NewLeveledQuoteProvider returns the first supported SEV-SNP LeveledQuoteProvider, configured by
+// opts. Providers registered with RegisterQuoteProvider are considered along with those of the
+// platform.
+func NewLeveledQuoteProvider(opts ...QuoteProviderOption) (LeveledQuoteProvider, error) {
+	qp, err := newQuoteProvider(opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return qp.(LeveledQuoteProvider), nil
+}
+
+// GetQuoteProvider returns a supported SEV-SNP QuoteProvider.
+func GetQuoteProvider() (QuoteProvider, error) {
+	return NewQuoteProvider()
+}
+
+// GetLeveledQuoteProvider returns a supported SEV-SNP LeveledQuoteProvider.
+func GetLeveledQuoteProvider() (LeveledQuoteProvider, error) {
+	return NewLeveledQuoteProvider()
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// levelQuoteProvider records the VMPL of each request and rejects those below its floor.
+type levelQuoteProvider struct {
+	supported bool
+	floor     uint
+	levels    []int
+}
+
+func (p *levelQuoteProvider) IsSupported() bool { return p.supported }
+
+func (p *levelQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
+	p.levels = append(p.levels, -1)
+	return reportData[:], nil
+}
+
+func (p *levelQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, vmpl uint) ([]uint8, error) {
+	p.levels = append(p.levels, int(vmpl))
+	if vmpl < p.floor {
+		return nil, &PrivilegeLevelFloorError{Requested: vmpl, Floor: p.floor}
+	}
+	return reportData[:], nil
+}
+
+func (p *levelQuoteProvider) Product() *pb.SevProduct { return nil }
+
+func applyOptions(opts ...QuoteProviderOption) *providerOptions {
+	o := &providerOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func TestSelectQuoteProvider(t *testing.T) {
+	configfs := &levelQuoteProvider{supported: true}
+	ioctl := &levelQuoteProvider{supported: true}
+	unsupported := &levelQuoteProvider{}
+	candidates := []providerCandidate{
+		{kind: abi.QuoteProviderConfigfsTsm, provider: configfs},
+		{kind: abi.QuoteProviderIoctl, provider: ioctl},
+		{kind: abi.QuoteProviderAzureHcl, provider: unsupported},
+	}
+	tcs := []struct {
+		name    string
+		opts    []QuoteProviderOption
+		want    QuoteProvider
+		wantErr bool
+	}{
+		{name: "default order", want: configfs},
+		{name: "preference", opts: []QuoteProviderOption{WithProviderPreference(abi.QuoteProviderIoctl)}, want: ioctl},
+		{name: "unsupported preference skipped",
+			opts: []QuoteProviderOption{WithProviderPreference(abi.QuoteProviderAzureHcl, abi.QuoteProviderIoctl)},
+			want: ioctl},
+		{name: "none supported", opts: []QuoteProviderOption{WithProviderPreference(abi.QuoteProviderAzureHcl)},
+			wantErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := selectQuoteProvider(applyOptions(tc.opts...), candidates, false)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("selectQuoteProvider() = _, %v. Want error %t", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("selectQuoteProvider() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConfiguredQuoteProvider(t *testing.T) {
+	base := &levelQuoteProvider{supported: true}
+	qp, err := selectQuoteProvider(applyOptions(WithVMPL(2), WithDevicePath("/dev/other")),
+		[]providerCandidate{{kind: abi.QuoteProviderIoctl, provider: base}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qp.GetRawQuote([64]byte{}); err != nil {
+		t.Fatalf("GetRawQuote() = _, %v. Want nil", err)
+	}
+	if _, err := qp.(LeveledQuoteProvider).GetRawQuoteAtLevel([64]byte{}, 1); err != nil {
+		t.Fatalf("GetRawQuoteAtLevel() = _, %v. Want nil", err)
+	}
+	if len(base.levels) != 2 || base.levels[0] != 2 || base.levels[1] != 1 {
+		t.Errorf("configured provider requested VMPLs %v, want [2 1]", base.levels)
+	}
+
+	flaky := &flakyQuoteProvider{failures: 2, err: &abi.SevFirmwareErr{Status: abi.GuestRequestVmmBusy}}
+	qp, err = selectQuoteProvider(applyOptions(WithRetryPolicy(&RetryOptions{InitialDelay: time.Millisecond, MaxAttempts: 2})),
+		[]providerCandidate{{kind: abi.QuoteProviderIoctl, provider: flaky}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetQuoteProto(qp, [64]byte{}); err == nil {
+		t.Error("GetQuoteProto() = _, nil. Want the configured retry policy to give up")
+	}
+	if flaky.calls != 2 {
+		t.Errorf("configured provider made %d requests, want 2", flaky.calls)
+	}
+}
+
+func TestPrivilegeLevelFloorFallback(t *testing.T) {
+	base := &levelQuoteProvider{supported: true, floor: 2}
+	candidates := []providerCandidate{{kind: abi.QuoteProviderConfigfsTsm, provider: base}}
+	qp, err := selectQuoteProvider(applyOptions(WithVMPL(1)), candidates, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var floorErr *PrivilegeLevelFloorError
+	if _, err := qp.GetRawQuote([64]byte{}); !errors.As(err, &floorErr) || floorErr.Floor != 2 {
+		t.Errorf("GetRawQuote() = _, %v. Want a PrivilegeLevelFloorError with floor 2", err)
+	}
+	qp, err = selectQuoteProvider(applyOptions(WithVMPL(1), WithPrivilegeLevelFloorFallback()), candidates, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qp.GetRawQuote([64]byte{}); err != nil {
+		t.Errorf("GetRawQuote() = _, %v. Want nil after falling back to the floor", err)
+	}
+	if want := []int{1, 1, 2}; !reflect.DeepEqual(base.levels, want) {
+		t.Errorf("provider requested VMPLs %v, want %v", base.levels, want)
+	}
+}
+
+// unleveledQuoteProvider only implements QuoteProvider.
+type unleveledQuoteProvider struct{}
+
+func (unleveledQuoteProvider) IsSupported() bool { return true }
+
+func (unleveledQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
+	return reportData[:], nil
+}
+
+func (unleveledQuoteProvider) Product() *pb.SevProduct { return nil }
+
+func TestRegisterQuoteProvider(t *testing.T) {
+	saved := registeredQuoteProviders()
+	t.Cleanup(func() {
+		registryMu.Lock()
+		registry = saved
+		registryMu.Unlock()
+	})
+	const custom abi.QuoteProviderKind = 100
+	low := &levelQuoteProvider{supported: true}
+	high := &levelQuoteProvider{supported: true}
+	RegisterQuoteProvider(custom, PlatformQuoteProviderPriority-1, low)
+	RegisterQuoteProvider(custom, PlatformQuoteProviderPriority+2, unleveledQuoteProvider{})
+	RegisterQuoteProvider(custom, PlatformQuoteProviderPriority+1, high)
+
+	if qp, err := NewQuoteProvider(); err != nil || qp != (unleveledQuoteProvider{}) {
+		t.Errorf("NewQuoteProvider() = %v, %v. Want the highest priority provider", qp, err)
+	}
+	if qp, err := NewLeveledQuoteProvider(); err != nil || qp != high {
+		t.Errorf("NewLeveledQuoteProvider() = %v, %v. Want the highest priority leveled provider", qp, err)
+	}
+	if qp, err := NewQuoteProvider(WithVMPL(1)); err != nil || qp.(*configuredQuoteProvider).base != high {
+		t.Errorf("NewQuoteProvider(WithVMPL(1)) = %v, %v. Want the highest priority leveled provider", qp, err)
+	}
+	high.supported = false
+	if qp, err := NewLeveledQuoteProvider(WithProviderPreference(custom)); err != nil || qp != low {
+		t.Errorf("NewLeveledQuoteProvider(custom) = %v, %v. Want the only supported custom provider", qp, err)
+	}
+
+	// A preference overrides priorities across kinds, but not within a kind.
+	const other abi.QuoteProviderKind = 101
+	high.supported = true
+	preferred := &levelQuoteProvider{supported: true}
+	RegisterQuoteProvider(other, PlatformQuoteProviderPriority-2, preferred)
+	if qp, err := NewLeveledQuoteProvider(WithProviderPreference(other, custom)); err != nil || qp != preferred {
+		t.Errorf("NewLeveledQuoteProvider(other, custom) = %v, %v. Want the first preferred kind's provider", qp, err)
+	}
+	if qp, err := NewLeveledQuoteProvider(WithProviderPreference(custom, other)); err != nil || qp != high {
+		t.Errorf("NewLeveledQuoteProvider(custom, other) = %v, %v. Want the highest priority custom provider", qp, err)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+	"go.uber.org/multierr"
+)
+
+const (
+	// maxProxyRequestSize bounds a proxyRequest, whose report data is 64 bytes.
+	maxProxyRequestSize = 4096
+	// proxyIOTimeout bounds reading a request and writing its response, so that slow clients do not
+	// hold connections.
+	proxyIOTimeout = 10 * time.Second
+)
+
+// proxyRequest is the message that a ProxyQuoteProvider sends for each quote. Each connection
+// carries one request and its response.
+type proxyRequest struct {
+	ReportData []byte `json:"report_data"`
+	// Vmpl is the requested VMPL, or nil for the server provider's default.
+	Vmpl *uint `json:"vmpl,omitempty"`
+}
+
+// proxyResponse is the QuoteServer's answer to a proxyRequest.
+type proxyResponse struct {
+	Quote []byte `json:"quote,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Throttled is whether the request failed because the host throttled it, so the client may retry.
+	Throttled bool `json:"throttled,omitempty"`
+}
+
+// ProxyQuoteProvider implements the LeveledQuoteProvider interface by forwarding requests over a
+// Unix domain socket to a QuoteServer in a privileged process. It lets unprivileged containers
+// without access to /dev/sev-guest or configfs obtain quotes. Anyone who can connect to the socket
+// can obtain quotes over arbitrary report data, so restrict its permissions accordingly, e.g., with
+// the mode of ListenAndServeQuotes.
+type ProxyQuoteProvider struct {
+	// SocketPath is the path of the QuoteServer's Unix domain socket.
+	SocketPath string
+	// Timeout bounds each request, including the server's own retries. If zero, requests do not
+	// time out.
+	Timeout time.Duration
+}
+
+// IsSupported returns whether the QuoteServer socket accepts connections.
+func (p *ProxyQuoteProvider) IsSupported() bool {
+	conn, err := net.Dial("unix", p.SocketPath)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// GetRawQuote returns a raw quote at the server provider's default VMPL.
+func (p *ProxyQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
+	return p.roundTrip(&proxyRequest{ReportData: reportData[:]})
+}
+
+// GetRawQuoteAtLevel returns a raw quote at the given VMPL.
+func (p *ProxyQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, vmpl uint) ([]uint8, error) {
+	return p.roundTrip(&proxyRequest{ReportData: reportData[:], Vmpl: &vmpl})
+}
+
+// Product returns AMD SEV-related CPU information of the calling CPU.
+//
+// Deprecated: Use abi.ExtraPlatformInfoGUID in the raw quote certificate table.
+func (p *ProxyQuoteProvider) Product() *pb.SevProduct {
+	return abi.SevProduct()
+}
+
+func (p *ProxyQuoteProvider) roundTrip(req *proxyRequest) (result []uint8, err error) {
+	conn, err := net.Dial("unix", p.SocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to quote server: %v", err)
+	}
+	defer func() { err = multierr.Combine(err, conn.Close()) }()
+	if p.Timeout != 0 {
+		if err := conn.SetDeadline(time.Now().Add(p.Timeout)); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("could not send quote request: %v", err)
+	}
+	resp := &proxyResponse{}
+	if err := json.NewDecoder(conn).Decode(resp); err != nil {
+		return nil, fmt.Errorf("could not read quote response: %v", err)
+	}
+	if resp.Throttled {
+		return nil, &abi.SevFirmwareErr{Status: abi.GuestRequestVmmBusy, Err: errors.New(resp.Error)}
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("quote server: %s", resp.Error)
+	}
+	return resp.Quote, nil
+}
+
+// QuoteServer answers ProxyQuoteProvider requests with quotes from a local provider. It serves one
+// request at a time, since the AMD-SP does as well.
+type QuoteServer struct {
+	// Provider produces the quotes. It must be a LeveledQuoteProvider to serve requests for a VMPL.
+	Provider QuoteProvider
+	mu       sync.Mutex
+}
+
+// Serve answers requests on connections accepted from l until l fails, e.g., because it is closed.
+func (s *QuoteServer) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *QuoteServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(proxyIOTimeout)); err != nil {
+		logger().Warn("could not set quote proxy connection deadline", "error", err)
+		return
+	}
+	req := &proxyRequest{}
+	if err := json.NewDecoder(io.LimitReader(conn, maxProxyRequestSize)).Decode(req); err != nil {
+		logger().Warn("could not read quote proxy request", "error", err)
+		return
+	}
+	quote, err := s.quote(req)
+	resp := &proxyResponse{Quote: quote}
+	if err != nil {
+		logger().Warn("quote proxy request failed", "error", err)
+		resp = &proxyResponse{Error: err.Error(), Throttled: IsThrottled(err)}
+	}
+	// The quote may have taken longer than the request's deadline.
+	if err := conn.SetDeadline(time.Now().Add(proxyIOTimeout)); err != nil {
+		logger().Warn("could not set quote proxy connection deadline", "error", err)
+		return
+	}
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		logger().Warn("could not send quote proxy response", "error", err)
+	}
+}
+
+func (s *QuoteServer) quote(req *proxyRequest) ([]uint8, error) {
+	var reportData [64]byte
+	if len(req.ReportData) != len(reportData) {
+		return nil, fmt.Errorf("report data is %d bytes. Expect %d", len(req.ReportData), len(reportData))
+	}
+	copy(reportData[:], req.ReportData)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Vmpl == nil {
+		return s.Provider.GetRawQuote(reportData)
+	}
+	leveled, ok := s.Provider.(LeveledQuoteProvider)
+	if !ok {
+		return nil, fmt.Errorf("quote provider %T does not support requesting a VMPL", s.Provider)
+	}
+	return leveled.GetRawQuoteAtLevel(reportData, *req.Vmpl)
+}
+
+// ListenAndServeQuotes serves quotes from qp on a Unix domain socket at socketPath, which must not
+// exist yet, with the permissions of mode, e.g., 0660 to serve only the socket's group.
+func ListenAndServeQuotes(socketPath string, mode os.FileMode, qp QuoteProvider) error {
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	if err := os.Chmod(socketPath, mode); err != nil {
+		return fmt.Errorf("could not set permissions of %s: %v", socketPath, err)
+	}
+	return (&QuoteServer{Provider: qp}).Serve(l)
+}
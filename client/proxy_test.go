@@ -0,0 +1,122 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+)
+
+func TestProxyQuoteProvider(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "quote.sock")
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	base := &levelQuoteProvider{supported: true, floor: 1}
+	go (&QuoteServer{Provider: base}).Serve(l)
+
+	qp := &ProxyQuoteProvider{SocketPath: socketPath, Timeout: time.Minute}
+	if !qp.IsSupported() {
+		t.Fatal("IsSupported() = false. Want true while the server listens")
+	}
+	reportData := [64]byte{1, 2, 3}
+	quote, err := qp.GetRawQuote(reportData)
+	if err != nil || !bytes.Equal(quote, reportData[:]) {
+		t.Errorf("GetRawQuote() = %v, %v. Want %v, nil", quote, err, reportData)
+	}
+	if _, err := qp.GetRawQuoteAtLevel(reportData, 2); err != nil {
+		t.Errorf("GetRawQuoteAtLevel(2) = _, %v. Want nil", err)
+	}
+	if _, err := qp.GetRawQuoteAtLevel(reportData, 0); err == nil {
+		t.Error("GetRawQuoteAtLevel(0) = _, nil. Want the server provider's error")
+	}
+	if want := []int{-1, 2, 0}; !reflect.DeepEqual(base.levels, want) {
+		t.Errorf("server provider requested VMPLs %v, want %v", base.levels, want)
+	}
+}
+
+func TestProxyQuoteProviderThrottled(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "quote.sock")
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	flaky := &flakyQuoteProvider{failures: 1, err: &abi.SevFirmwareErr{Status: abi.GuestRequestVmmBusy}}
+	go (&QuoteServer{Provider: flaky}).Serve(l)
+
+	qp := &ProxyQuoteProvider{SocketPath: socketPath}
+	if _, err := qp.GetRawQuote([64]byte{}); !IsThrottled(err) {
+		t.Errorf("GetRawQuote() = _, %v. Want a throttling error", err)
+	}
+	if _, err := GetRawQuoteContext(context.Background(), qp, [64]byte{}, &RetryOptions{InitialDelay: time.Millisecond}); err != nil {
+		t.Errorf("GetRawQuoteContext() = _, %v. Want nil after retrying", err)
+	}
+}
+
+func TestQuoteServerOversizedRequest(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "quote.sock")
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go (&QuoteServer{Provider: &levelQuoteProvider{supported: true}}).Serve(l)
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// A request that never ends, which the server must stop reading.
+	go conn.Write(append([]byte(`{"report_data":"`), bytes.Repeat([]byte("A"), 1<<20)...))
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	var netErr net.Error
+	if _, err := conn.Read(make([]byte, 1)); err == nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Errorf("Read() after an oversized request = _, %v. Want the server to close the connection", err)
+	}
+}
+
+func TestListenAndServeQuotesMode(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "quote.sock")
+	go ListenAndServeQuotes(socketPath, 0600, &levelQuoteProvider{supported: true})
+	qp := &ProxyQuoteProvider{SocketPath: socketPath, Timeout: time.Minute}
+	for i := 0; !qp.IsSupported(); i++ {
+		if i == 100 {
+			t.Fatal("IsSupported() = false. Want true once the server listens")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0600 {
+		t.Errorf("socket permissions = %v, want %v", got, os.FileMode(0600))
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"sync"
+
+	"github.com/google/go-sev-guest/abi"
+)
+
+// PlatformQuoteProviderPriority is the selection priority of the quote providers built into this
+// package. Registered providers with a higher priority are tried before them, and those with a
+// lower priority only if no built-in provider is supported.
+const PlatformQuoteProviderPriority = 0
+
+var (
+	registryMu sync.Mutex
+	registry   []providerCandidate
+)
+
+// RegisterQuoteProvider makes provider available to GetQuoteProvider, NewQuoteProvider, and, if it
+// is also a LeveledQuoteProvider, their leveled counterparts. Providers are tried from highest to
+// lowest priority, and in registration order within a priority. The kind identifies the provider to
+// WithProviderPreference. RegisterQuoteProvider is typically called from an init function of the
+// package that implements the provider, e.g., for an SVSM or remote proxy interface.
+func RegisterQuoteProvider(kind abi.QuoteProviderKind, priority int, provider QuoteProvider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, providerCandidate{kind: kind, priority: priority, provider: provider})
+}
+
+// registeredQuoteProviders returns a copy of the registered quote providers.
+func registeredQuoteProviders() []providerCandidate {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return append([]providerCandidate{}, registry...)
+}
@@ -0,0 +1,188 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"syscall"
+	"time"
+
+	"github.com/google/go-configfs-tsm/report"
+	"github.com/google/go-sev-guest/abi"
+	"go.uber.org/multierr"
+)
+
+const (
+	// DefaultRetryInitialDelay is the wait before the first retry of a throttled request. It matches
+	// the default hypervisor guest request rate limit of one request per two seconds.
+	DefaultRetryInitialDelay = 2 * time.Second
+	// DefaultRetryMaxDelay is the longest wait between retries of a throttled request.
+	DefaultRetryMaxDelay = 30 * time.Second
+	// DefaultRetryTimeout is how long a throttled request is retried before failure.
+	DefaultRetryTimeout = 2 * time.Minute
+	// DefaultRetryJitter is the fraction of each retry delay that is randomized.
+	DefaultRetryJitter = 0.2
+)
+
+// RetryOptions configures how quote requests are retried when the platform reports that it is
+// temporarily unable to serve them. The zero value of each field selects its default.
+type RetryOptions struct {
+	// InitialDelay is the wait before the first retry. Each following delay doubles.
+	InitialDelay time.Duration
+	// MaxDelay is the maximum amount of time to wait between retries.
+	MaxDelay time.Duration
+	// Timeout is how long to retry before failure, in addition to the deadline of the context.
+	// A negative Timeout retries until the context expires.
+	Timeout time.Duration
+	// Jitter is the fraction in [0, 1] of each delay that is randomized, so that bursty callers do
+	// not retry in lockstep. A negative Jitter disables randomization.
+	Jitter float64
+	// MaxAttempts is the maximum number of requests, including the first. Zero is unbounded, and
+	// one disables retries.
+	MaxAttempts int
+}
+
+// DefaultRetryOptions returns the retry options that GetQuoteProto and GetQuoteProtoAtLevel use.
+func DefaultRetryOptions() *RetryOptions {
+	return &RetryOptions{
+		InitialDelay: DefaultRetryInitialDelay,
+		MaxDelay:     DefaultRetryMaxDelay,
+		Timeout:      DefaultRetryTimeout,
+		Jitter:       DefaultRetryJitter,
+	}
+}
+
+func (o *RetryOptions) withDefaults() *RetryOptions {
+	result := DefaultRetryOptions()
+	if o == nil {
+		return result
+	}
+	result.MaxAttempts = o.MaxAttempts
+	if o.InitialDelay != 0 {
+		result.InitialDelay = o.InitialDelay
+	}
+	if o.MaxDelay != 0 {
+		result.MaxDelay = o.MaxDelay
+	}
+	if o.Timeout != 0 {
+		result.Timeout = o.Timeout
+	}
+	if o.Jitter < 0 {
+		result.Jitter = 0
+	} else if o.Jitter != 0 {
+		result.Jitter = o.Jitter
+	}
+	if result.Jitter > 1 {
+		result.Jitter = 1
+	}
+	return result
+}
+
+// jittered returns delay with its Jitter fraction replaced by a uniformly random duration.
+func (o *RetryOptions) jittered(delay time.Duration) time.Duration {
+	spread := time.Duration(float64(delay) * o.Jitter)
+	if spread <= 0 {
+		return delay
+	}
+	return delay - spread + time.Duration(rand.Int63n(int64(spread)+1))
+}
+
+// IsThrottled returns whether err indicates that a quote request was declined only because the
+// platform is busy and may succeed if retried: the hypervisor rate limited the guest request, the
+// device was busy, or a concurrent configfs-tsm user changed the report entry mid-request.
+func IsThrottled(err error) bool {
+	var fwErr *abi.SevFirmwareErr
+	if errors.As(err, &fwErr) && fwErr.Status == abi.GuestRequestVmmBusy {
+		return true
+	}
+	if report.GetGenerationErr(err) != nil {
+		return true
+	}
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EBUSY)
+}
+
+// retry calls do until it succeeds, returns an error that is not throttling, or the options or
+// context end the attempts.
+func retry(ctx context.Context, opts *RetryOptions, do func() error) error {
+	opts = opts.withDefaults()
+	cancel := func() {}
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	defer cancel()
+	delay := opts.InitialDelay
+	var returnedError error
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return multierr.Append(returnedError, err)
+		}
+		err := do()
+		if err == nil {
+			return nil
+		}
+		returnedError = multierr.Append(returnedError, err)
+		if !IsThrottled(err) {
+			return returnedError
+		}
+		if opts.MaxAttempts > 0 && attempt >= opts.MaxAttempts {
+			logger().Error("attestation request still throttled, giving up", "attempts", attempt, "error", err)
+			return returnedError
+		}
+		wait := opts.jittered(delay)
+		logger().Warn("attestation request throttled, retrying", "attempt", attempt, "delay", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			logger().Error("attestation request still throttled at its deadline", "attempts", attempt, "error", ctx.Err())
+			return multierr.Append(returnedError, ctx.Err())
+		case <-time.After(wait): // wait to retry
+		}
+		delay = delay + delay
+		if delay > opts.MaxDelay {
+			delay = opts.MaxDelay
+		}
+	}
+}
+
+// GetRawQuoteContext returns the raw quote from qp, retrying throttled requests according to opts
+// until ctx expires. A nil opts uses the retry policy qp was constructed with, or
+// DefaultRetryOptions.
+func GetRawQuoteContext(ctx context.Context, qp QuoteProvider, reportData [64]byte, opts *RetryOptions) ([]uint8, error) {
+	if c, ok := qp.(configuredProvider); ok {
+		return c.config().getRawQuoteContext(ctx, reportData, opts)
+	}
+	var result []uint8
+	err := retry(ctx, opts, func() (err error) {
+		result, err = qp.GetRawQuote(reportData)
+		return err
+	})
+	return result, err
+}
+
+// GetRawQuoteAtLevelContext returns the raw quote at the given VMPL from qp, retrying throttled
+// requests according to opts until ctx expires. A nil opts uses the retry policy qp was constructed
+// with, or DefaultRetryOptions.
+func GetRawQuoteAtLevelContext(ctx context.Context, qp LeveledQuoteProvider, reportData [64]byte, vmpl uint, opts *RetryOptions) ([]uint8, error) {
+	if c, ok := qp.(configuredProvider); ok {
+		return c.config().getRawQuoteAtLevelContext(ctx, reportData, vmpl, opts)
+	}
+	var result []uint8
+	err := retry(ctx, opts, func() (err error) {
+		result, err = qp.GetRawQuoteAtLevel(reportData, vmpl)
+		return err
+	})
+	return result, err
+}
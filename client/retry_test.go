@@ -0,0 +1,174 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-configfs-tsm/report"
+	"github.com/google/go-sev-guest/abi"
+	labi "github.com/google/go-sev-guest/client/linuxabi"
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// flakyQuoteProvider fails its first failures requests with err.
+type flakyQuoteProvider struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (p *flakyQuoteProvider) IsSupported() bool { return true }
+
+func (p *flakyQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
+	return p.GetRawQuoteAtLevel(reportData, 0)
+}
+
+func (p *flakyQuoteProvider) GetRawQuoteAtLevel(reportData [64]byte, _ uint) ([]uint8, error) {
+	p.calls++
+	if p.calls <= p.failures {
+		return nil, p.err
+	}
+	return reportData[:], nil
+}
+
+func (p *flakyQuoteProvider) Product() *pb.SevProduct { return nil }
+
+func TestIsThrottled(t *testing.T) {
+	tcs := []struct {
+		err  error
+		want bool
+	}{
+		{err: &abi.SevFirmwareErr{Status: abi.GuestRequestVmmBusy}, want: true},
+		{err: fmt.Errorf("wrapped: %w", syscall.EAGAIN), want: true},
+		{err: syscall.EBUSY, want: true},
+		{err: fmt.Errorf("could not read report: %w", &report.GenerationErr{Got: 2, Want: 1}), want: true},
+		{err: &abi.SevFirmwareErr{Status: abi.GuestRequestInvalidLength}},
+		{err: syscall.EIO},
+		{err: errors.New("bad report")},
+	}
+	for _, tc := range tcs {
+		if got := IsThrottled(tc.err); got != tc.want {
+			t.Errorf("IsThrottled(%v) = %t, want %t", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestGetRawQuoteContextRetries(t *testing.T) {
+	busy := &abi.SevFirmwareErr{Status: abi.GuestRequestVmmBusy}
+	fast := &RetryOptions{InitialDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	tcs := []struct {
+		name      string
+		qp        *flakyQuoteProvider
+		opts      *RetryOptions
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "throttled then ok", qp: &flakyQuoteProvider{failures: 3, err: busy}, opts: fast, wantCalls: 4},
+		{name: "not throttled", qp: &flakyQuoteProvider{failures: 3, err: syscall.EIO}, opts: fast,
+			wantCalls: 1, wantErr: true},
+		{name: "max attempts", qp: &flakyQuoteProvider{failures: 3, err: busy},
+			opts: &RetryOptions{InitialDelay: time.Millisecond, MaxAttempts: 2}, wantCalls: 2, wantErr: true},
+		{name: "timeout", qp: &flakyQuoteProvider{failures: 1000, err: busy}, wantErr: true,
+			opts: &RetryOptions{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, Timeout: 20 * time.Millisecond}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := GetRawQuoteContext(context.Background(), tc.qp, [64]byte{}, tc.opts)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("GetRawQuoteContext() = _, %v. Want error %t", err, tc.wantErr)
+			}
+			if tc.wantCalls != 0 && tc.qp.calls != tc.wantCalls {
+				t.Errorf("GetRawQuoteContext() made %d requests, want %d", tc.qp.calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestGetRawQuoteAtLevelContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	qp := &flakyQuoteProvider{failures: 1000, err: syscall.EAGAIN}
+	_, err := GetRawQuoteAtLevelContext(ctx, qp, [64]byte{}, 1, &RetryOptions{InitialDelay: time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetRawQuoteAtLevelContext() = _, %v. Want deadline exceeded", err)
+	}
+}
+
+// busyDevice fails every command as throttled by the hypervisor.
+type busyDevice struct {
+	calls int
+}
+
+func (d *busyDevice) Open(string) error { return nil }
+func (d *busyDevice) Close() error      { return nil }
+func (d *busyDevice) Ioctl(_ uintptr, req any) (uintptr, error) {
+	d.calls++
+	req.(*labi.SnpUserGuestRequest).FwErr = uint64(abi.GuestRequestVmmBusy)
+	return 0, syscall.EIO
+}
+func (d *busyDevice) Product() *pb.SevProduct { return nil }
+
+func TestDeviceContextVariants(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	d := &busyDevice{}
+	if _, err := GetReportContext(canceled, d, [64]byte{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetReportContext(canceled) = _, %v. Want context canceled", err)
+	}
+	if _, err := GetDerivedKeyAcknowledgingItsLimitationsContext(canceled, d, &SnpDerivedKeyReq{}); err == nil {
+		t.Error("GetDerivedKeyAcknowledgingItsLimitationsContext(canceled) = _, nil. Want error")
+	}
+	if d.calls != 0 {
+		t.Errorf("canceled requests sent %d commands, want 0", d.calls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := GetRawExtendedReportContext(ctx, d, [64]byte{}); err == nil {
+		t.Error("GetRawExtendedReportContext(busy) = _, _, nil. Want error")
+	}
+	if d.calls == 0 {
+		t.Error("GetRawExtendedReportContext(busy) sent no commands")
+	}
+}
+
+func TestGetDeviceRawQuoteDoesNotRetry(t *testing.T) {
+	d := &busyDevice{}
+	if _, err := getDeviceRawQuote(d, [64]byte{}, 0, 0); !IsThrottled(err) {
+		t.Errorf("getDeviceRawQuote(busy) = _, %v. Want a throttled error", err)
+	}
+	// One certificate length query and one report request, which the caller's policy retries.
+	if d.calls != 2 {
+		t.Errorf("getDeviceRawQuote(busy) sent %d commands, want 2", d.calls)
+	}
+}
+
+func TestRetryJitter(t *testing.T) {
+	opts := (&RetryOptions{Jitter: 0.5}).withDefaults()
+	for i := 0; i < 100; i++ {
+		if got := opts.jittered(time.Second); got < 500*time.Millisecond || got > time.Second {
+			t.Fatalf("jittered(1s) = %v, want within [500ms, 1s]", got)
+		}
+	}
+	if got := (&RetryOptions{Jitter: -1}).withDefaults().jittered(time.Second); got != time.Second {
+		t.Errorf("jittered(1s) with jitter disabled = %v, want 1s", got)
+	}
+}
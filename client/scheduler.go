@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+)
+
+// QuoteResult is the outcome of one request of QuoteScheduler.GetRawQuotes.
+type QuoteResult struct {
+	// Index is the position of the request's report data in the GetRawQuotes argument.
+	Index int
+	// ReportData is the report data that the quote was requested for.
+	ReportData [64]byte
+	// RawQuote is the raw quote if Err is nil.
+	RawQuote []uint8
+	// Err is the error that the request failed with.
+	Err error
+}
+
+// QuoteScheduler serializes the quote requests of concurrent callers to one QuoteProvider, since the
+// AMD-SP serves one guest request at a time and the hypervisor throttles guests that send them too
+// quickly. Throttled requests are retried while the scheduler is held, so that a backing off request
+// is not overtaken by others that would only be throttled as well.
+type QuoteScheduler struct {
+	qp   QuoteProvider
+	opts *RetryOptions
+	// turn holds a token while a request is in progress.
+	turn chan struct{}
+}
+
+// NewQuoteScheduler returns a scheduler for requests to qp that retries throttled requests according
+// to opts. A nil opts uses DefaultRetryOptions.
+func NewQuoteScheduler(qp QuoteProvider, opts *RetryOptions) *QuoteScheduler {
+	return &QuoteScheduler{qp: qp, opts: opts, turn: make(chan struct{}, 1)}
+}
+
+// GetRawQuote returns the raw quote for reportData once all earlier requests to the scheduler have
+// completed, or an error if ctx expires first.
+func (s *QuoteScheduler) GetRawQuote(ctx context.Context, reportData [64]byte) ([]uint8, error) {
+	select {
+	case s.turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.turn }()
+	return GetRawQuoteContext(ctx, s.qp, reportData, s.opts)
+}
+
+// GetRawQuotes requests a raw quote for each of reportData in order and sends each result on the
+// returned channel as it completes. The channel is closed after the last result. Once ctx expires,
+// the remaining requests fail with its error.
+func (s *QuoteScheduler) GetRawQuotes(ctx context.Context, reportData [][64]byte) <-chan QuoteResult {
+	results := make(chan QuoteResult, len(reportData))
+	go func() {
+		defer close(results)
+		for i, data := range reportData {
+			quote, err := s.GetRawQuote(ctx, data)
+			results <- QuoteResult{Index: i, ReportData: data, RawQuote: quote, Err: err}
+		}
+	}()
+	return results
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+	pb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// exclusiveQuoteProvider fails a test if it serves overlapping requests, and throttles every
+// other request.
+type exclusiveQuoteProvider struct {
+	t        *testing.T
+	inFlight int32
+	calls    int32
+}
+
+func (p *exclusiveQuoteProvider) IsSupported() bool { return true }
+
+func (p *exclusiveQuoteProvider) GetRawQuote(reportData [64]byte) ([]uint8, error) {
+	if atomic.AddInt32(&p.inFlight, 1) != 1 {
+		p.t.Error("quote requests overlapped")
+	}
+	defer atomic.AddInt32(&p.inFlight, -1)
+	time.Sleep(time.Millisecond)
+	if atomic.AddInt32(&p.calls, 1)%2 == 1 {
+		return nil, &abi.SevFirmwareErr{Status: abi.GuestRequestVmmBusy}
+	}
+	return append([]uint8{}, reportData[:]...), nil
+}
+
+func (p *exclusiveQuoteProvider) Product() *pb.SevProduct { return nil }
+
+func TestQuoteSchedulerSerializes(t *testing.T) {
+	qp := &exclusiveQuoteProvider{t: t}
+	s := NewQuoteScheduler(qp, &RetryOptions{InitialDelay: time.Millisecond})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reportData := [][64]byte{{byte(i)}, {byte(i), 1}}
+			count := 0
+			for result := range s.GetRawQuotes(context.Background(), reportData) {
+				count++
+				if result.Err != nil {
+					t.Errorf("GetRawQuotes() result %d = %v. Want nil", result.Index, result.Err)
+					continue
+				}
+				if !bytes.Equal(result.RawQuote, reportData[result.Index][:]) {
+					t.Errorf("GetRawQuotes() result %d = %v, want %v", result.Index, result.RawQuote, reportData[result.Index])
+				}
+			}
+			if count != len(reportData) {
+				t.Errorf("GetRawQuotes() sent %d results, want %d", count, len(reportData))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if qp.calls != 16 {
+		t.Errorf("scheduler made %d requests, want 16 with every other one throttled", qp.calls)
+	}
+}
+
+func TestQuoteSchedulerCanceled(t *testing.T) {
+	s := NewQuoteScheduler(&exclusiveQuoteProvider{t: t}, nil)
+	s.turn <- struct{}{} // Another request is in progress.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	for result := range s.GetRawQuotes(ctx, make([][64]byte, 2)) {
+		if !errors.Is(result.Err, context.DeadlineExceeded) {
+			t.Errorf("GetRawQuotes() result %d = %v. Want deadline exceeded", result.Index, result.Err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+// SvsmVtpmServiceGUID is the SVSM service GUID of the vTPM, whose manifest is its endorsement key.
+const SvsmVtpmServiceGUID = "c476f1eb-0123-45a5-9641-b4e7dde5bfe3"
+
+// SvsmServiceRequest selects the SVSM services to attest.
+type SvsmServiceRequest struct {
+	// ServiceGUID selects a single service. If empty, all services the SVSM offers are attested.
+	ServiceGUID string
+	// ManifestVersion selects the service manifest format. If nil, the SVSM's default is used.
+	ManifestVersion *uint32
+}
+
+// SvsmQuote is an SVSM attestation of its services. The SVSM requests the report at VMPL0 with
+// REPORT_DATA set to the SHA-512 digest of the caller's report data followed by the manifest, so a
+// verifier checks the manifest against the report rather than the report data directly.
+type SvsmQuote struct {
+	// RawQuote is the attestation report followed by its certificate table, as from GetRawQuote.
+	RawQuote []uint8
+	// Manifest is the services manifest in the format of the requested version.
+	Manifest []uint8
+}
+
+// SvsmQuoteProvider is a quote provider that can collect attestations of an SVSM's services.
+type SvsmQuoteProvider interface {
+	QuoteProvider
+	// GetRawSvsmQuote returns the SVSM attestation of the requested services bound to reportData.
+	GetRawSvsmQuote(reportData [64]byte, req *SvsmServiceRequest) (*SvsmQuote, error)
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/asn1"
 	"encoding/hex"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -59,6 +60,9 @@ var (
 	OidSpl7 = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 3704, 1, 3, 7})
 	// OidUcodeSpl is the x509v3 extension for V[CL]EK microcode security patch level.
 	OidUcodeSpl = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 3704, 1, 3, 8})
+	// OidFmcSpl is the x509v3 extension for V[CL]EK FMC firmware security patch level. Only
+	// Turin and later certificates have it.
+	OidFmcSpl = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 3704, 1, 3, 9})
 	// OidHwid is the x509v3 extension for VCEK certificate associated hardware identifier.
 	OidHwid = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 3704, 1, 4})
 	// OidCspID is the x509v3 extension for a VLEK certificate's Cloud Service Provider's
@@ -78,6 +82,7 @@ var (
 	kdsSpl6          = kdsOID{major: 3, minor: 6}
 	kdsSpl7          = kdsOID{major: 3, minor: 7}
 	kdsUcodeSpl      = kdsOID{major: 3, minor: 8}
+	kdsFmcSpl        = kdsOID{major: 3, minor: 9}
 	kdsHwid          = kdsOID{major: 4}
 	kdsCspID         = kdsOID{major: 5}
 
@@ -116,6 +121,9 @@ var (
 	}
 )
 
+// TurinHWIDSize is the size of the hardware identifier of Turin and later product lines.
+const TurinHWIDSize = 8
+
 // TCBVersion is a 64-bit bitfield of different security patch levels of AMD firmware and microcode.
 type TCBVersion uint64
 
@@ -126,7 +134,7 @@ type Extensions struct {
 	ProductName   string
 	// The host driver knows the difference between primary and secondary HWID.
 	// Primary vs secondary is irrelevant to verification. Must be nil or
-	// abi.ChipIDSize long.
+	// HWIDSize(productLine) long.
 	HWID       []byte
 	TCBVersion TCBVersion
 	CspID      string
@@ -166,6 +174,9 @@ func oidTokdsOID(id asn1.ObjectIdentifier) (kdsOID, error) {
 	if id.Equal(OidUcodeSpl) {
 		return kdsUcodeSpl, nil
 	}
+	if id.Equal(OidFmcSpl) {
+		return kdsFmcSpl, nil
+	}
 	if id.Equal(OidCspID) {
 		return kdsCspID, nil
 	}
@@ -210,10 +221,14 @@ type TCBParts struct {
 	SnpSpl uint8
 	// UcodeSpl is the microcode security patch level.
 	UcodeSpl uint8
+	// FmcSpl is the FMC firmware security patch level. Only present in Turin and later
+	// TCB versions.
+	FmcSpl uint8
 }
 
 // ComposeTCBParts returns an SEV-SNP TCB_VERSION from OID mapping values. The spl4-spl7 fields are
-// reserved, but the KDS specification designates them as 4 byte-sized fields.
+// reserved, but the KDS specification designates them as 4 byte-sized fields. This is the Milan and
+// Genoa TCB layout. See ComposeTCBPartsForProduct for other products.
 func ComposeTCBParts(parts TCBParts) (TCBVersion, error) {
 	// Only UcodeSpl may be 0-255. All others must be 0-127.
 	check127 := func(name string, value uint8) error {
@@ -232,6 +247,10 @@ func ComposeTCBParts(parts TCBParts) (TCBVersion, error) {
 	); err != nil {
 		return TCBVersion(0), err
 	}
+	if parts.FmcSpl != 0 {
+		return TCBVersion(0), fmt.Errorf("FmcSpl TCB part is %d, but this TCB layout has no FMC component",
+			parts.FmcSpl)
+	}
 	return TCBVersion(
 		(uint64(parts.UcodeSpl) << 56) |
 			(uint64(parts.SnpSpl) << 48) |
@@ -258,9 +277,55 @@ func DecomposeTCBVersion(tcb TCBVersion) TCBParts {
 	}
 }
 
+// ComposeTCBPartsForProduct returns an SEV-SNP TCB_VERSION from its parts using the TCB layout of
+// the given product. Milan and Genoa use the ComposeTCBParts layout. Turin and later place the
+// FMC SPL in the lowest byte, which shifts the boot loader, TEE, and SNP SPLs up by one byte each.
+func ComposeTCBPartsForProduct(parts TCBParts, product pb.SevProduct_SevProductName) (TCBVersion, error) {
+	if !hasFmcTCBLayout(product) {
+		return ComposeTCBParts(parts)
+	}
+	if parts.Spl7 != 0 {
+		return TCBVersion(0), fmt.Errorf("Spl7 TCB part is %d, but %v has no Spl7 component",
+			parts.Spl7, product)
+	}
+	return TCBVersion(
+		(uint64(parts.UcodeSpl) << 56) |
+			(uint64(parts.Spl6) << 48) |
+			(uint64(parts.Spl5) << 40) |
+			(uint64(parts.Spl4) << 32) |
+			(uint64(parts.SnpSpl) << 24) |
+			(uint64(parts.TeeSpl) << 16) |
+			(uint64(parts.BlSpl) << 8) |
+			(uint64(parts.FmcSpl) << 0)), nil
+}
+
+// DecomposeTCBVersionForProduct interprets the byte components of the AMD representation of the
+// platform security patch levels into a struct according to the TCB layout of the given product.
+func DecomposeTCBVersionForProduct(tcb TCBVersion, product pb.SevProduct_SevProductName) TCBParts {
+	if !hasFmcTCBLayout(product) {
+		return DecomposeTCBVersion(tcb)
+	}
+	return TCBParts{
+		UcodeSpl: uint8((uint64(tcb) >> 56) & 0xff),
+		Spl6:     uint8((uint64(tcb) >> 48) & 0xff),
+		Spl5:     uint8((uint64(tcb) >> 40) & 0xff),
+		Spl4:     uint8((uint64(tcb) >> 32) & 0xff),
+		SnpSpl:   uint8((uint64(tcb) >> 24) & 0xff),
+		TeeSpl:   uint8((uint64(tcb) >> 16) & 0xff),
+		BlSpl:    uint8((uint64(tcb) >> 8) & 0xff),
+		FmcSpl:   uint8((uint64(tcb) >> 0) & 0xff),
+	}
+}
+
+// hasFmcTCBLayout returns true if the product's TCB_VERSION has an FMC component.
+func hasFmcTCBLayout(product pb.SevProduct_SevProductName) bool {
+	return product == pb.SevProduct_SEV_PRODUCT_TURIN
+}
+
 // TCBPartsLE returns true iff all TCB components of tcb0 are <= the corresponding tcb1 components.
 func TCBPartsLE(tcb0, tcb1 TCBParts) bool {
-	return (tcb0.UcodeSpl <= tcb1.UcodeSpl) &&
+	return (tcb0.FmcSpl <= tcb1.FmcSpl) &&
+		(tcb0.UcodeSpl <= tcb1.UcodeSpl) &&
 		(tcb0.SnpSpl <= tcb1.SnpSpl) &&
 		(tcb0.Spl7 <= tcb1.Spl7) &&
 		(tcb0.Spl6 <= tcb1.Spl6) &&
@@ -270,6 +335,79 @@ func TCBPartsLE(tcb0, tcb1 TCBParts) bool {
 		(tcb0.BlSpl <= tcb1.BlSpl)
 }
 
+// TCBVersionToProto returns the components of tcb in the TCB layout of product.
+func TCBVersionToProto(tcb TCBVersion, product pb.SevProduct_SevProductName) *pb.TcbParts {
+	return TCBPartsToProto(DecomposeTCBVersionForProduct(tcb, product), product)
+}
+
+// TCBPartsToProto returns parts as a message for the TCB layout of product.
+func TCBPartsToProto(parts TCBParts, product pb.SevProduct_SevProductName) *pb.TcbParts {
+	return &pb.TcbParts{
+		Product:  product,
+		BlSpl:    uint32(parts.BlSpl),
+		TeeSpl:   uint32(parts.TeeSpl),
+		SnpSpl:   uint32(parts.SnpSpl),
+		UcodeSpl: uint32(parts.UcodeSpl),
+		FmcSpl:   uint32(parts.FmcSpl),
+		Spl4:     uint32(parts.Spl4),
+		Spl5:     uint32(parts.Spl5),
+		Spl6:     uint32(parts.Spl6),
+		Spl7:     uint32(parts.Spl7),
+	}
+}
+
+// TCBVersionFromProto returns the TCB_VERSION that parts represents in the TCB layout of its
+// product, or an error if a component does not fit the layout.
+func TCBVersionFromProto(parts *pb.TcbParts) (TCBVersion, error) {
+	if parts == nil {
+		return TCBVersion(0), errors.New("no TCB parts")
+	}
+	tcbParts, err := TCBPartsFromProto(parts)
+	if err != nil {
+		return TCBVersion(0), err
+	}
+	return ComposeTCBPartsForProduct(tcbParts, parts.GetProduct())
+}
+
+// TCBPartsFromProto returns the components of parts, or an error if a component does not fit in
+// a byte. It does not check the components against the TCB layout of the parts' product.
+func TCBPartsFromProto(parts *pb.TcbParts) (TCBParts, error) {
+	var errs error
+	component := func(name string, value uint32) uint8 {
+		if value > 255 {
+			errs = multierr.Append(errs, fmt.Errorf("%s TCB part is %d. Expect 0-255", name, value))
+		}
+		return uint8(value)
+	}
+	tcbParts := TCBParts{
+		BlSpl:    component("BlSpl", parts.GetBlSpl()),
+		TeeSpl:   component("TeeSpl", parts.GetTeeSpl()),
+		SnpSpl:   component("SnpSpl", parts.GetSnpSpl()),
+		UcodeSpl: component("UcodeSpl", parts.GetUcodeSpl()),
+		FmcSpl:   component("FmcSpl", parts.GetFmcSpl()),
+		Spl4:     component("Spl4", parts.GetSpl4()),
+		Spl5:     component("Spl5", parts.GetSpl5()),
+		Spl6:     component("Spl6", parts.GetSpl6()),
+		Spl7:     component("Spl7", parts.GetSpl7()),
+	}
+	if errs != nil {
+		return TCBParts{}, errs
+	}
+	return tcbParts, nil
+}
+
+// ReportTcbsToProto returns the TCB_VERSION fields of report by their components in the TCB
+// layout of product. For reports of version 3 and later, product may be the name of
+// abi.SevProductFromCpuid1Eax(report.GetCpuid1EaxFms()).
+func ReportTcbsToProto(report *pb.Report, product pb.SevProduct_SevProductName) *pb.ReportTcbs {
+	return &pb.ReportTcbs{
+		CurrentTcb:   TCBVersionToProto(TCBVersion(report.GetCurrentTcb()), product),
+		ReportedTcb:  TCBVersionToProto(TCBVersion(report.GetReportedTcb()), product),
+		CommittedTcb: TCBVersionToProto(TCBVersion(report.GetCommittedTcb()), product),
+		LaunchTcb:    TCBVersionToProto(TCBVersion(report.GetLaunchTcb()), product),
+	}
+}
+
 func asn1U8(ext *pkix.Extension, field string, out *uint8) error {
 	if ext == nil {
 		return fmt.Errorf("no extension for field %s", field)
@@ -342,9 +480,12 @@ func kdsOidMapToExtensions(exts map[kdsOID]*pkix.Extension) (*Extensions, error)
 	if err := asn1IA5String(exts[kdsProductName1], "ProductName1", &result.ProductName); err != nil {
 		return nil, err
 	}
+	// The product line determines the HWID size and the TCB layout.
+	productLine := ProductLineOfProductName(result.ProductName)
+	product, _ := ParseProductLine(productLine)
 	hwidExt, ok := exts[kdsHwid]
 	if ok {
-		octet, err := asn1OctetString(hwidExt, "HWID", 64)
+		octet, err := asn1OctetString(hwidExt, "HWID", HWIDSize(productLine))
 		if err != nil {
 			return nil, err
 		}
@@ -359,7 +500,7 @@ func kdsOidMapToExtensions(exts map[kdsOID]*pkix.Extension) (*Extensions, error)
 			return nil, fmt.Errorf("certificate has both HWID (%s) and CSP_ID (%s) extensions", hex.EncodeToString(result.HWID), result.CspID)
 		}
 	}
-	var blspl, snpspl, teespl, spl4, spl5, spl6, spl7, ucodespl uint8
+	var blspl, snpspl, teespl, spl4, spl5, spl6, spl7, ucodespl, fmcspl uint8
 	if err := asn1U8(exts[kdsBlSpl], "BlSpl", &blspl); err != nil {
 		return nil, err
 	}
@@ -384,7 +525,14 @@ func kdsOidMapToExtensions(exts map[kdsOID]*pkix.Extension) (*Extensions, error)
 	if err := asn1U8(exts[kdsUcodeSpl], "UcodeSpl", &ucodespl); err != nil {
 		return nil, err
 	}
-	tcb, err := ComposeTCBParts(TCBParts{
+	if hasFmcTCBLayout(product.GetName()) {
+		if err := asn1U8(exts[kdsFmcSpl], "FmcSpl", &fmcspl); err != nil {
+			return nil, err
+		}
+	} else if exts[kdsFmcSpl] != nil {
+		return nil, fmt.Errorf("unexpected FmcSpl extension for product %q", result.ProductName)
+	}
+	tcb, err := ComposeTCBPartsForProduct(TCBParts{
 		BlSpl:    blspl,
 		SnpSpl:   snpspl,
 		TeeSpl:   teespl,
@@ -393,7 +541,8 @@ func kdsOidMapToExtensions(exts map[kdsOID]*pkix.Extension) (*Extensions, error)
 		Spl6:     spl6,
 		Spl7:     spl7,
 		UcodeSpl: ucodespl,
-	})
+		FmcSpl:   fmcspl,
+	}, product.GetName())
 	if err != nil {
 		return nil, err
 	}
@@ -428,7 +577,7 @@ func VcekCertificateExtensions(cert *x509.Certificate) (*Extensions, error) {
 	if exts.CspID != "" {
 		return nil, fmt.Errorf("unexpected CSP_ID in VCEK certificate: %s", exts.CspID)
 	}
-	if len(exts.HWID) != abi.ChipIDSize {
+	if len(exts.HWID) != HWIDSize(ProductLineOfProductName(exts.ProductName)) {
 		return nil, fmt.Errorf("missing HWID extension for VCEK certificate")
 	}
 	return exts, nil
@@ -493,6 +642,75 @@ func ParseProductCertChain(pems []byte) ([]byte, []byte, error) {
 	return askBlock.Bytes, arkBlock.Bytes, nil
 }
 
+// ProductCertChain is the parsed body of the ProductCertChain (cert_chain) endpoint for a product
+// line and endorsement key kind.
+type ProductCertChain struct {
+	ProductLine string
+	Key         abi.ReportSigner
+	// Ask is the ASK certificate of a VCEK chain, or the ASVK certificate of a VLEK chain.
+	Ask *x509.Certificate
+	Ark *x509.Certificate
+}
+
+// ParseProductCertChainFor returns the certificates of the cert_chain endpoint body pems for the
+// given product line and endorsement key kind. Beyond ParseProductCertChain, it checks that the
+// certificates' common names are those of the product line's ASK (or ASVK) and ARK, that the ARK
+// signed itself, and that the ARK signed the ASK. It does not check that the ARK is trusted.
+func ParseProductCertChainFor(productLine string, key abi.ReportSigner, pems []byte) (*ProductCertChain, error) {
+	var askRole, askCN string
+	switch key {
+	case abi.VcekReportSigner:
+		askRole, askCN = "ASK", fmt.Sprintf("SEV-%s", productLine)
+	case abi.VlekReportSigner:
+		askRole, askCN = "ASVK", fmt.Sprintf("SEV-VLEK-%s", productLine)
+	default:
+		return nil, fmt.Errorf("unexpected endorsement key kind %v", key)
+	}
+	askDer, arkDer, err := ParseProductCertChain(pems)
+	if err != nil {
+		return nil, err
+	}
+	ask, err := x509.ParseCertificate(askDer)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s certificate: %v", askRole, err)
+	}
+	ark, err := x509.ParseCertificate(arkDer)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse ARK certificate: %v", err)
+	}
+	if ask.Subject.CommonName != askCN {
+		return nil, fmt.Errorf("%s common name is %q, want %q", askRole, ask.Subject.CommonName, askCN)
+	}
+	if arkCN := fmt.Sprintf("ARK-%s", productLine); ark.Subject.CommonName != arkCN {
+		return nil, fmt.Errorf("ARK common name is %q, want %q", ark.Subject.CommonName, arkCN)
+	}
+	if err := ark.CheckSignature(ark.SignatureAlgorithm, ark.RawTBSCertificate, ark.Signature); err != nil {
+		return nil, fmt.Errorf("ARK is not self-signed: %v", err)
+	}
+	if err := ark.CheckSignature(ask.SignatureAlgorithm, ask.RawTBSCertificate, ask.Signature); err != nil {
+		return nil, fmt.Errorf("%s is not signed by the ARK: %v", askRole, err)
+	}
+	return &ProductCertChain{ProductLine: productLine, Key: key, Ask: ask, Ark: ark}, nil
+}
+
+// RebaseURL returns the AMD KDS URL kdsurl, e.g., from VCEKCertURL, with the KDS's scheme and host
+// replaced by baseURL, e.g., "https://kds-mirror.example.com/amd", so that the certificate may be
+// fetched from a mirror of the KDS that serves the same paths.
+func RebaseURL(kdsurl, baseURL string) (string, error) {
+	path := strings.TrimPrefix(kdsurl, kdsBaseURL)
+	if path == kdsurl || !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("%q is not an AMD KDS URL", kdsurl)
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid KDS mirror URL %q: %v", baseURL, err)
+	}
+	if (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" || base.RawQuery != "" || base.Fragment != "" {
+		return "", fmt.Errorf("KDS mirror URL %q is not of the form http[s]://host[/path]", baseURL)
+	}
+	return strings.TrimSuffix(baseURL, "/") + path, nil
+}
+
 // productBaseURL returns the base URL for all certificate queries within a particular product for the
 // given report signer kind.
 func productBaseURL(s abi.ReportSigner, name string) string {
@@ -512,30 +730,54 @@ func ProductCertChainURL(s abi.ReportSigner, productLine string) string {
 	return fmt.Sprintf("%s/cert_chain", productBaseURL(s, productLine))
 }
 
-// VCEKCertURL returns the AMD KDS URL for retrieving the VCEK on a given product
-// at a given TCB version. The hwid is the CHIP_ID field in an attestation report.
-func VCEKCertURL(productLine string, hwid []byte, tcb TCBVersion) string {
-	parts := DecomposeTCBVersion(tcb)
-	return fmt.Sprintf("%s/%s?blSPL=%d&teeSPL=%d&snpSPL=%d&ucodeSPL=%d",
-		productBaseURL(abi.VcekReportSigner, productLine),
-		hex.EncodeToString(hwid),
+// productLineName returns the product of productLine, or SEV_PRODUCT_UNKNOWN, whose TCB layout is
+// Milan's.
+func productLineName(productLine string) pb.SevProduct_SevProductName {
+	product, err := ParseProductLine(productLine)
+	if err != nil {
+		return pb.SevProduct_SEV_PRODUCT_UNKNOWN
+	}
+	return product.Name
+}
+
+// FormatTCBVersion returns the KDS URL query arguments for the TCB version in the TCB layout of
+// the product line, e.g., "blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68" for Milan. Turin and later add the
+// fmcSPL argument.
+func FormatTCBVersion(productLine string, tcb TCBVersion) string {
+	product := productLineName(productLine)
+	parts := DecomposeTCBVersionForProduct(tcb, product)
+	query := fmt.Sprintf("blSPL=%d&teeSPL=%d&snpSPL=%d&ucodeSPL=%d",
 		parts.BlSpl,
 		parts.TeeSpl,
 		parts.SnpSpl,
 		parts.UcodeSpl,
 	)
+	if hasFmcTCBLayout(product) {
+		return fmt.Sprintf("fmcSPL=%d&%s", parts.FmcSpl, query)
+	}
+	return query
+}
+
+// VCEKCertURL returns the AMD KDS URL for retrieving the VCEK on a given product
+// at a given TCB version. The hwid is the CHIP_ID field in an attestation report, of which
+// Turin and later URLs only use the first HWIDSize(productLine) bytes.
+func VCEKCertURL(productLine string, hwid []byte, tcb TCBVersion) string {
+	if size := HWIDSize(productLine); len(hwid) > size {
+		hwid = hwid[:size]
+	}
+	return fmt.Sprintf("%s/%s?%s",
+		productBaseURL(abi.VcekReportSigner, productLine),
+		hex.EncodeToString(hwid),
+		FormatTCBVersion(productLine, tcb),
+	)
 }
 
 // VLEKCertURL returns the GET URL for retrieving a VLEK certificate, but without the necessary
 // CSP secret in the HTTP headers that makes the request validate to the KDS.
 func VLEKCertURL(productLine string, tcb TCBVersion) string {
-	parts := DecomposeTCBVersion(tcb)
-	return fmt.Sprintf("%s/cert?blSPL=%d&teeSPL=%d&snpSPL=%d&ucodeSPL=%d",
+	return fmt.Sprintf("%s/cert?%s",
 		productBaseURL(abi.VlekReportSigner, productLine),
-		parts.BlSpl,
-		parts.TeeSpl,
-		parts.SnpSpl,
-		parts.UcodeSpl,
+		FormatTCBVersion(productLine, tcb),
 	)
 }
 
@@ -570,6 +812,14 @@ type VLEKCert struct {
 	TCB         uint64
 }
 
+// VLEKCertProduct returns a VLEKCert with the product line set to productLine.
+func VLEKCertProduct(productLine string) VLEKCert {
+	return VLEKCert{
+		Product:     productLine, // TODO(Issue#114): Remove
+		ProductLine: productLine,
+	}
+}
+
 // CertFunction is an enumeration of which endorsement key type is getting certified.
 type CertFunction int
 
@@ -641,11 +891,39 @@ func ParseProductCertChainURL(kdsurl string) (string, CertFunction, error) {
 	return parsed.productLine, parsed.function, nil
 }
 
-func parseTCBURL(u *url.URL) (uint64, error) {
-	values, err := url.ParseQuery(u.RawQuery)
+// parseTCBQuery returns the TCB version of the KDS URL query arguments in the TCB layout of the
+// product line.
+func parseTCBQuery(query string, productLine string) (uint64, error) {
+	product := productLineName(productLine)
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AMD KDS URL query %q: %v", query, err)
+	}
+	if values.Has("fmcSPL") && !hasFmcTCBLayout(product) {
+		return 0, fmt.Errorf("unexpected KDS TCB version URL argument %q for product line %q", "fmcSPL", productLine)
+	}
+	parts, err := tcbPartsFromQuery(values)
 	if err != nil {
-		return 0, fmt.Errorf("invalid AMD KDS URL query %q: %v", u.RawQuery, err)
+		return 0, err
+	}
+	tcb, err := ComposeTCBPartsForProduct(parts, product)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AMD KDS TCB arguments: %v", err)
 	}
+	return uint64(tcb), err
+}
+
+// ParseTCBParts parses FormatTCBVersion KDS URL query arguments, e.g., "fmcSPL=1&blSPL=2", into
+// TCB components without regard to any product's TCB layout. Omitted query arguments are 0.
+func ParseTCBParts(query string) (TCBParts, error) {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return TCBParts{}, fmt.Errorf("invalid AMD KDS URL query %q: %v", query, err)
+	}
+	return tcbPartsFromQuery(values)
+}
+
+func tcbPartsFromQuery(values url.Values) (TCBParts, error) {
 	parts := TCBParts{}
 	for key, valuelist := range values {
 		var setter func(number uint8)
@@ -658,22 +936,35 @@ func parseTCBURL(u *url.URL) (uint64, error) {
 			setter = func(number uint8) { parts.SnpSpl = number }
 		case "ucodeSPL":
 			setter = func(number uint8) { parts.UcodeSpl = number }
+		case "fmcSPL":
+			setter = func(number uint8) { parts.FmcSpl = number }
 		default:
-			return 0, fmt.Errorf("unexpected KDS TCB version URL argument %q", key)
+			return TCBParts{}, fmt.Errorf("unexpected KDS TCB version URL argument %q", key)
 		}
 		for _, val := range valuelist {
 			number, err := strconv.Atoi(val)
 			if err != nil || number < 0 || number > 255 {
-				return 0, fmt.Errorf("invalid KDS TCB version URL argument value %q, want a value 0-255", val)
+				return TCBParts{}, fmt.Errorf("invalid KDS TCB version URL argument value %q, want a value 0-255", val)
 			}
 			setter(uint8(number))
 		}
 	}
-	tcb, err := ComposeTCBParts(parts)
+	return parts, nil
+}
+
+// ParseTCBVersion parses a TCB version in the TCB layout of the product line from either its
+// number, e.g., "0x4405000000000002", or its FormatTCBVersion KDS URL query arguments, e.g.,
+// "blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68". Omitted query arguments are 0.
+func ParseTCBVersion(productLine, s string) (TCBVersion, error) {
+	if strings.Contains(s, "=") {
+		tcb, err := parseTCBQuery(s, productLine)
+		return TCBVersion(tcb), err
+	}
+	tcb, err := strconv.ParseUint(s, 0, 64)
 	if err != nil {
-		return 0, fmt.Errorf("invalid AMD KDS TCB arguments: %v", err)
+		return 0, fmt.Errorf("TCB version %q is neither a number nor KDS URL query arguments", s)
 	}
-	return uint64(tcb), err
+	return TCBVersion(tcb), nil
 }
 
 // ParseVCEKCertURL returns the attestation report components represented in the given KDS VCEK
@@ -693,13 +984,13 @@ func ParseVCEKCertURL(kdsurl string) (VCEKCert, error) {
 	if err != nil {
 		return result, fmt.Errorf("hwid component of KDS URL is not a hex string: %q", parsed.simpleURL.Path)
 	}
-	if len(hwid) != abi.ChipIDSize {
-		return result, fmt.Errorf("hwid component of KDS URL has size %d, want %d", len(hwid), abi.ChipIDSize)
+	if size := HWIDSize(parsed.productLine); len(hwid) != size {
+		return result, fmt.Errorf("hwid component of KDS URL has size %d, want %d", len(hwid), size)
 	}
 
 	result.HWID = hwid
 
-	result.TCB, err = parseTCBURL(parsed.simpleURL)
+	result.TCB, err = parseTCBQuery(parsed.simpleURL.RawQuery, parsed.productLine)
 	return result, err
 }
 
@@ -720,7 +1011,7 @@ func ParseVLEKCertURL(kdsurl string) (VLEKCert, error) {
 		return result, fmt.Errorf("vlek function is %q, want 'cert'", parsed.simpleURL.Path)
 	}
 
-	result.TCB, err = parseTCBURL(parsed.simpleURL)
+	result.TCB, err = parseTCBQuery(parsed.simpleURL.RawQuery, parsed.productLine)
 	return result, err
 }
 
@@ -810,6 +1101,16 @@ func ProductName(product *pb.SevProduct) string {
 	}
 }
 
+// HWIDSize returns the size of the hardware identifier that certifies chips of the given product
+// line in VCEK certificates and KDS URLs. Turin identifies a chip by only the first TurinHWIDSize
+// bytes of the report's CHIP_ID field.
+func HWIDSize(productLine string) int {
+	if productLine == "Turin" {
+		return TurinHWIDSize
+	}
+	return abi.ChipIDSize
+}
+
 // ProductLineFromFms returns the product name used in the KDS endpoint to fetch VCEK certificates.
 func ProductLineFromFms(fms uint32) string {
 	return ProductLine(abi.SevProductFromCpuid1Eax(fms))
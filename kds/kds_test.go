@@ -15,9 +15,14 @@
 package kds
 
 import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/hex"
 	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -47,6 +52,218 @@ func TestVCEKCertURL(t *testing.T) {
 	}
 }
 
+func TestRebaseURL(t *testing.T) {
+	kdsurl := "https://kdsintf.amd.com/vcek/v1/Milan/cert_chain"
+	tcs := []struct {
+		baseURL string
+		want    string
+		wantErr string
+	}{
+		{baseURL: "https://mirror.example.com", want: "https://mirror.example.com/vcek/v1/Milan/cert_chain"},
+		{baseURL: "http://10.0.0.1:8080/amd/", want: "http://10.0.0.1:8080/amd/vcek/v1/Milan/cert_chain"},
+		{baseURL: "mirror.example.com", wantErr: "is not of the form"},
+		{baseURL: "https://mirror.example.com?q=1", wantErr: "is not of the form"},
+	}
+	for _, tc := range tcs {
+		got, err := RebaseURL(kdsurl, tc.baseURL)
+		if (err == nil && tc.wantErr != "") || (err != nil && !strings.Contains(err.Error(), tc.wantErr)) || got != tc.want {
+			t.Errorf("RebaseURL(%q, %q) = %q, %v. Want %q, %q", kdsurl, tc.baseURL, got, err, tc.want, tc.wantErr)
+		}
+	}
+	if _, err := RebaseURL("https://kdsintf.amd.com.evil.com/vcek", "https://mirror.example.com"); err == nil || !strings.Contains(err.Error(), "is not an AMD KDS URL") {
+		t.Errorf("RebaseURL(non-KDS URL) = _, %v. Want a non-KDS URL error", err)
+	}
+}
+
+func TestTurinCertURLs(t *testing.T) {
+	chipID := make([]byte, abi.ChipIDSize)
+	for i := range chipID {
+		chipID[i] = byte(i + 1)
+	}
+	// Turin's low TCB byte is the FMC SPL.
+	tcb := TCBVersion(0x4800000005000403)
+	wantVcek := "https://kdsintf.amd.com/vcek/v1/Turin/0102030405060708?fmcSPL=3&blSPL=4&teeSPL=0&snpSPL=5&ucodeSPL=72"
+	if got := VCEKCertURL("Turin", chipID, tcb); got != wantVcek {
+		t.Errorf("VCEKCertURL(\"Turin\", %v, %v) = %q, want %q", chipID, tcb, got, wantVcek)
+	}
+	vcek, err := ParseVCEKCertURL(wantVcek)
+	if err != nil {
+		t.Fatalf("ParseVCEKCertURL(%q) = _, %v", wantVcek, err)
+	}
+	want := VCEKCertProduct("Turin")
+	want.HWID = chipID[:TurinHWIDSize]
+	want.TCB = uint64(tcb)
+	if diff := cmp.Diff(vcek, want); diff != "" {
+		t.Errorf("ParseVCEKCertURL(%q) returned unexpected diff (-want +got):\n%s", wantVcek, diff)
+	}
+
+	wantVlek := "https://kdsintf.amd.com/vlek/v1/Turin/cert?fmcSPL=3&blSPL=4&teeSPL=0&snpSPL=5&ucodeSPL=72"
+	if got := VLEKCertURL("Turin", tcb); got != wantVlek {
+		t.Errorf("VLEKCertURL(\"Turin\", %v) = %q, want %q", tcb, got, wantVlek)
+	}
+	vlek, err := ParseVLEKCertURL(wantVlek)
+	if err != nil {
+		t.Fatalf("ParseVLEKCertURL(%q) = _, %v", wantVlek, err)
+	}
+	wantVlekCert := VLEKCertProduct("Turin")
+	wantVlekCert.TCB = uint64(tcb)
+	if diff := cmp.Diff(vlek, wantVlekCert); diff != "" {
+		t.Errorf("ParseVLEKCertURL(%q) returned unexpected diff (-want +got):\n%s", wantVlek, diff)
+	}
+
+	if got, want := CrlLinkByKey("Turin", abi.VlekReportSigner), "https://kdsintf.amd.com/vlek/v1/Turin/crl"; got != want {
+		t.Errorf("CrlLinkByKey(\"Turin\", VLEK) = %q, want %q", got, want)
+	}
+	milanFmc := fmt.Sprintf("https://kdsintf.amd.com/vcek/v1/Milan/%s?fmcSPL=1", hex.EncodeToString(chipID))
+	if _, err := ParseVCEKCertURL(milanFmc); err == nil || !strings.Contains(err.Error(), `unexpected KDS TCB version URL argument "fmcSPL" for product line "Milan"`) {
+		t.Errorf("ParseVCEKCertURL(%q) = _, %v. Want an fmcSPL error", milanFmc, err)
+	}
+	turinLongHWID := fmt.Sprintf("https://kdsintf.amd.com/vcek/v1/Turin/%s?fmcSPL=1", hex.EncodeToString(chipID))
+	if _, err := ParseVCEKCertURL(turinLongHWID); err == nil || !strings.Contains(err.Error(), "hwid component of KDS URL has size 64, want 8") {
+		t.Errorf("ParseVCEKCertURL(%q) = _, %v. Want an hwid size error", turinLongHWID, err)
+	}
+}
+
+func TestTCBVersionStrings(t *testing.T) {
+	tcs := []struct {
+		productLine string
+		tcb         TCBVersion
+		query       string
+	}{
+		{productLine: "Milan", tcb: 0x4405000000000002, query: "blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68"},
+		{productLine: "Genoa", tcb: 0x1500000000000003, query: "blSPL=3&teeSPL=0&snpSPL=0&ucodeSPL=21"},
+		{productLine: "Turin", tcb: 0x4800000005000403, query: "fmcSPL=3&blSPL=4&teeSPL=0&snpSPL=5&ucodeSPL=72"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.productLine, func(t *testing.T) {
+			if got := FormatTCBVersion(tc.productLine, tc.tcb); got != tc.query {
+				t.Errorf("FormatTCBVersion(%q, %v) = %q, want %q", tc.productLine, tc.tcb, got, tc.query)
+			}
+			for _, s := range []string{tc.query, fmt.Sprintf("0x%x", uint64(tc.tcb)), fmt.Sprintf("%d", uint64(tc.tcb))} {
+				got, err := ParseTCBVersion(tc.productLine, s)
+				if err != nil || got != tc.tcb {
+					t.Errorf("ParseTCBVersion(%q, %q) = %v, %v, want %v", tc.productLine, s, got, err, tc.tcb)
+				}
+			}
+		})
+	}
+	for _, s := range []string{"0xg", "fmcSPL=1", "blSPL=300"} {
+		if _, err := ParseTCBVersion("Milan", s); err == nil {
+			t.Errorf("ParseTCBVersion(\"Milan\", %q) = _, nil, want an error", s)
+		}
+	}
+	if got, err := ParseTCBParts("fmcSPL=1&blSPL=2"); err != nil || got != (TCBParts{FmcSpl: 1, BlSpl: 2}) {
+		t.Errorf("ParseTCBParts(\"fmcSPL=1&blSPL=2\") = %+v, %v, want {FmcSpl:1 BlSpl:2}", got, err)
+	}
+	if _, err := ParseTCBParts("spl4=1"); err == nil {
+		t.Error("ParseTCBParts(\"spl4=1\") = _, nil, want an error")
+	}
+}
+
+func TestTCBVersionForProduct(t *testing.T) {
+	tcs := []struct {
+		name    string
+		product pb.SevProduct_SevProductName
+		tcb     TCBVersion
+		parts   TCBParts
+	}{
+		{
+			name:    "Milan",
+			product: pb.SevProduct_SEV_PRODUCT_MILAN,
+			tcb:     0xdb18000000000004,
+			parts:   TCBParts{UcodeSpl: 0xdb, SnpSpl: 0x18, BlSpl: 0x4},
+		},
+		{
+			name:    "Genoa",
+			product: pb.SevProduct_SEV_PRODUCT_GENOA,
+			tcb:     0x5415000000000709,
+			parts:   TCBParts{UcodeSpl: 0x54, SnpSpl: 0x15, TeeSpl: 0x7, BlSpl: 0x9},
+		},
+		{
+			name:    "Turin",
+			product: pb.SevProduct_SEV_PRODUCT_TURIN,
+			tcb:     0x4800000003010201,
+			parts:   TCBParts{UcodeSpl: 0x48, SnpSpl: 0x3, TeeSpl: 0x1, BlSpl: 0x2, FmcSpl: 0x1},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DecomposeTCBVersionForProduct(tc.tcb, tc.product); got != tc.parts {
+				t.Errorf("DecomposeTCBVersionForProduct(0x%x, %v) = %+v, want %+v", tc.tcb, tc.product, got, tc.parts)
+			}
+			got, err := ComposeTCBPartsForProduct(tc.parts, tc.product)
+			if err != nil {
+				t.Fatalf("ComposeTCBPartsForProduct(%+v, %v) = _, %v. Want nil", tc.parts, tc.product, err)
+			}
+			if got != tc.tcb {
+				t.Errorf("ComposeTCBPartsForProduct(%+v, %v) = 0x%x, want 0x%x", tc.parts, tc.product, got, tc.tcb)
+			}
+		})
+	}
+	if _, err := ComposeTCBPartsForProduct(TCBParts{FmcSpl: 1}, pb.SevProduct_SEV_PRODUCT_MILAN); err == nil {
+		t.Error("ComposeTCBPartsForProduct(FmcSpl: 1, Milan) = _, nil. Want error")
+	}
+	if _, err := ComposeTCBPartsForProduct(TCBParts{Spl7: 1}, pb.SevProduct_SEV_PRODUCT_TURIN); err == nil {
+		t.Error("ComposeTCBPartsForProduct(Spl7: 1, Turin) = _, nil. Want error")
+	}
+	if TCBPartsLE(TCBParts{FmcSpl: 2}, TCBParts{FmcSpl: 1}) {
+		t.Error("TCBPartsLE(FmcSpl: 2, FmcSpl: 1) = true, want false")
+	}
+}
+
+func TestTCBVersionProto(t *testing.T) {
+	tcs := []struct {
+		name    string
+		product pb.SevProduct_SevProductName
+		tcb     TCBVersion
+		want    *pb.TcbParts
+	}{
+		{
+			name:    "Milan",
+			product: pb.SevProduct_SEV_PRODUCT_MILAN,
+			tcb:     0xdb18000000000004,
+			want:    &pb.TcbParts{Product: pb.SevProduct_SEV_PRODUCT_MILAN, UcodeSpl: 0xdb, SnpSpl: 0x18, BlSpl: 0x4},
+		},
+		{
+			name:    "Turin",
+			product: pb.SevProduct_SEV_PRODUCT_TURIN,
+			tcb:     0x4800000003010201,
+			want:    &pb.TcbParts{Product: pb.SevProduct_SEV_PRODUCT_TURIN, UcodeSpl: 0x48, SnpSpl: 0x3, TeeSpl: 0x1, BlSpl: 0x2, FmcSpl: 0x1},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got := TCBVersionToProto(tc.tcb, tc.product)
+			if diff := cmp.Diff(got, tc.want, protocmp.Transform()); diff != "" {
+				t.Errorf("TCBVersionToProto(0x%x, %v) = %v, want %v: %s", tc.tcb, tc.product, got, tc.want, diff)
+			}
+			tcb, err := TCBVersionFromProto(got)
+			if err != nil {
+				t.Fatalf("TCBVersionFromProto(%v) = _, %v. Want nil", got, err)
+			}
+			if tcb != tc.tcb {
+				t.Errorf("TCBVersionFromProto(%v) = 0x%x, want 0x%x", got, tcb, tc.tcb)
+			}
+		})
+	}
+	bad := []*pb.TcbParts{
+		nil,
+		{Product: pb.SevProduct_SEV_PRODUCT_MILAN, SnpSpl: 256},
+		{Product: pb.SevProduct_SEV_PRODUCT_MILAN, FmcSpl: 1},
+		{Product: pb.SevProduct_SEV_PRODUCT_TURIN, Spl7: 1},
+	}
+	for _, parts := range bad {
+		if _, err := TCBVersionFromProto(parts); err == nil {
+			t.Errorf("TCBVersionFromProto(%v) = _, nil. Want error", parts)
+		}
+	}
+	report := &pb.Report{CurrentTcb: 0x4800000003010201, LaunchTcb: 0x4700000003010201}
+	tcbs := ReportTcbsToProto(report, pb.SevProduct_SEV_PRODUCT_TURIN)
+	if tcbs.GetCurrentTcb().GetFmcSpl() != 1 || tcbs.GetLaunchTcb().GetUcodeSpl() != 0x47 || tcbs.GetCommittedTcb().GetUcodeSpl() != 0 {
+		t.Errorf("ReportTcbsToProto(%v, Turin) = %v, want current and launch TCB components", report, tcbs)
+	}
+}
+
 func TestParseProductBaseURL(t *testing.T) {
 	tcs := []struct {
 		name        string
@@ -316,3 +533,126 @@ func TestParseProductName(t *testing.T) {
 		})
 	}
 }
+
+func TestTurinExtensions(t *testing.T) {
+	u8 := func(v int) []byte {
+		b, _ := asn1.Marshal(v)
+		return b
+	}
+	exts := func(productName string, hwid []byte, fmc bool) map[kdsOID]*pkix.Extension {
+		name, _ := asn1.MarshalWithParams(productName, "ia5")
+		result := map[kdsOID]*pkix.Extension{
+			kdsStructVersion: {Value: u8(1)},
+			kdsProductName1:  {Value: name},
+			kdsBlSpl:         {Value: u8(3)},
+			kdsTeeSpl:        {Value: u8(0)},
+			kdsSnpSpl:        {Value: u8(23)},
+			kdsSpl4:          {Value: u8(0)},
+			kdsSpl5:          {Value: u8(0)},
+			kdsSpl6:          {Value: u8(0)},
+			kdsSpl7:          {Value: u8(0)},
+			kdsUcodeSpl:      {Value: u8(72)},
+			kdsHwid:          {Value: hwid},
+		}
+		if fmc {
+			result[kdsFmcSpl] = &pkix.Extension{Value: u8(1)}
+		}
+		return result
+	}
+	turinHwid := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	tcs := []struct {
+		name    string
+		exts    map[kdsOID]*pkix.Extension
+		wantTCB TCBVersion
+		wantErr string
+	}{
+		{
+			name:    "Turin",
+			exts:    exts("Turin-B0", turinHwid, true),
+			wantTCB: 0x4800000017000301,
+		},
+		{
+			name:    "Turin missing FMC SPL",
+			exts:    exts("Turin-B0", turinHwid, false),
+			wantErr: "no extension for field FmcSpl",
+		},
+		{
+			name:    "Turin full-size HWID",
+			exts:    exts("Turin-B0", make([]byte, abi.ChipIDSize), true),
+			wantErr: "could not parse extension as an octet string",
+		},
+		{
+			name:    "Milan FMC SPL",
+			exts:    exts("Milan-B0", make([]byte, abi.ChipIDSize), true),
+			wantErr: "unexpected FmcSpl extension",
+		},
+		{
+			name:    "Milan",
+			exts:    exts("Milan-B0", make([]byte, abi.ChipIDSize), false),
+			wantTCB: 0x4817000000000003,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := kdsOidMapToExtensions(tc.exts)
+			if (err == nil && tc.wantErr != "") || (err != nil && (tc.wantErr == "" || !strings.Contains(err.Error(), tc.wantErr))) {
+				t.Fatalf("kdsOidMapToExtensions() errored unexpectedly: %v, want %q", err, tc.wantErr)
+			}
+			if tc.wantErr == "" && got.TCBVersion != tc.wantTCB {
+				t.Errorf("kdsOidMapToExtensions() TCBVersion = %x, want %x", got.TCBVersion, tc.wantTCB)
+			}
+		})
+	}
+}
+
+func TestHWIDSize(t *testing.T) {
+	for productLine, want := range map[string]int{"Milan": abi.ChipIDSize, "Genoa": abi.ChipIDSize, "Turin": TurinHWIDSize} {
+		if got := HWIDSize(productLine); got != want {
+			t.Errorf("HWIDSize(%q) = %d, want %d", productLine, got, want)
+		}
+	}
+}
+
+func TestParseProductCertChainFor(t *testing.T) {
+	read := func(name string) []byte {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join("..", "verify", "trust", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	milanVcek := read("ask_ark_milan.pem")
+	tcs := []struct {
+		name        string
+		productLine string
+		key         abi.ReportSigner
+		pems        []byte
+		wantAskCN   string
+		wantErr     string
+	}{
+		{name: "Milan VCEK", productLine: "Milan", key: abi.VcekReportSigner, pems: milanVcek, wantAskCN: "SEV-Milan"},
+		{name: "Genoa VLEK", productLine: "Genoa", key: abi.VlekReportSigner, pems: read("ask_ark_genoa_vlek.pem"), wantAskCN: "SEV-VLEK-Genoa"},
+		{name: "Turin VCEK", productLine: "Turin", key: abi.VcekReportSigner, pems: read("ask_ark_turin_vcek.pem"), wantAskCN: "SEV-Turin"},
+		{name: "wrong product", productLine: "Genoa", key: abi.VcekReportSigner, pems: milanVcek, wantErr: `ASK common name is "SEV-Milan", want "SEV-Genoa"`},
+		{name: "wrong key", productLine: "Milan", key: abi.VlekReportSigner, pems: milanVcek, wantErr: `ASVK common name is "SEV-Milan", want "SEV-VLEK-Milan"`},
+		{name: "ARK only", productLine: "Milan", key: abi.VcekReportSigner, pems: milanVcek[bytes.Index(milanVcek[1:], []byte("-----BEGIN"))+1:], wantErr: "could not find ARK PEM block"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			chain, err := ParseProductCertChainFor(tc.productLine, tc.key, tc.pems)
+			if (err == nil && tc.wantErr != "") || (err != nil && !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("ParseProductCertChainFor(%q, %v, _) = _, %v, want %q", tc.productLine, tc.key, err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if chain.Ask.Subject.CommonName != tc.wantAskCN {
+				t.Errorf("ParseProductCertChainFor(%q, %v, _).Ask common name = %q, want %q", tc.productLine, tc.key, chain.Ask.Subject.CommonName, tc.wantAskCN)
+			}
+			if want := "ARK-" + tc.productLine; chain.Ark.Subject.CommonName != want {
+				t.Errorf("ParseProductCertChainFor(%q, %v, _).Ark common name = %q, want %q", tc.productLine, tc.key, chain.Ark.Subject.CommonName, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mirror serves the certificates and CRLs of a trust.CertStore at the AMD KDS's paths, so
+// that verifiers in air-gapped or rate-limited environments can use it as a KDS mirror, e.g., with
+// verify.Options.KDSMirrors or the check tool's -kds_mirrors flag.
+//
+// A Getter answers KDS requests from a store in-process instead, e.g., for fully offline
+// verification.
+//
+// The store holds certificates under the keys that verification with verify.Options.CertStore
+// and trust.PrefetchVceks store them under, so either can populate it.
+package mirror
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/kds"
+	"github.com/google/go-sev-guest/verify/trust"
+	"github.com/google/logger"
+)
+
+// kdsBaseURL is prepended to request paths to parse them with the kds package.
+const kdsBaseURL = "https://kdsintf.amd.com"
+
+// Server is an http.Handler that answers KDS requests for VCEK and VLEK certificates, cert_chain
+// bundles, and CRLs from a trust.CertStore. It answers 404 Not Found for content that the store
+// does not hold, since it never forwards requests to the KDS.
+type Server struct {
+	Store trust.CertStore
+	// CSPID is the CSP_ID of the VLEK certificates to serve. The KDS tells cloud service providers
+	// apart by their credentials rather than the URL, so a mirror serves one provider's VLEKs. If
+	// empty, VLEK certificates are not mirrored.
+	CSPID string
+}
+
+// endpoint is the content that a KDS path requests.
+type endpoint struct {
+	// keys are the store keys of the content, which is a PEM bundle if there are several.
+	keys        []string
+	contentType string
+}
+
+// parseEndpoint returns the content that the request for a KDS path and query asks for.
+// VLEK certificates are those of cspID.
+func parseEndpoint(path, rawQuery, cspID string) (*endpoint, error) {
+	kdsurl := kdsBaseURL + path
+	if rawQuery != "" {
+		kdsurl += "?" + rawQuery
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != 4 || parts[1] != "v1" {
+		return nil, fmt.Errorf("unexpected AMD KDS path %q, want /{vcek,vlek}/v1/product/endpoint", path)
+	}
+	var key abi.ReportSigner
+	switch parts[0] {
+	case "vcek":
+		key = abi.VcekReportSigner
+	case "vlek":
+		key = abi.VlekReportSigner
+	default:
+		return nil, fmt.Errorf("unexpected AMD KDS path %q, want /{vcek,vlek}/v1/product/endpoint", path)
+	}
+	productLine := parts[2]
+	switch {
+	case parts[3] == "cert_chain":
+		return &endpoint{
+			keys:        []string{trust.AskStoreKey(productLine, key), trust.ArkStoreKey(productLine, key)},
+			contentType: "application/x-pem-file",
+		}, nil
+	case parts[3] == "crl":
+		return &endpoint{keys: []string{trust.CrlStoreKey(productLine, key)}, contentType: "application/pkix-crl"}, nil
+	case key == abi.VlekReportSigner:
+		vlek, err := kds.ParseVLEKCertURL(kdsurl)
+		if err != nil {
+			return nil, err
+		}
+		if cspID == "" {
+			return nil, fmt.Errorf("%w: no CSP_ID for VLEK certificates", trust.ErrCertNotStored)
+		}
+		return &endpoint{
+			keys:        []string{trust.VlekStoreKey(vlek.ProductLine, cspID, kds.TCBVersion(vlek.TCB))},
+			contentType: "application/pkix-cert",
+		}, nil
+	default:
+		vcek, err := kds.ParseVCEKCertURL(kdsurl)
+		if err != nil {
+			return nil, err
+		}
+		return &endpoint{
+			keys:        []string{trust.VcekStoreKey(vcek.ProductLine, vcek.HWID, kds.TCBVersion(vcek.TCB))},
+			contentType: "application/pkix-cert",
+		}, nil
+	}
+}
+
+// load returns the endpoint's content from the store.
+func load(store trust.CertStore, e *endpoint) ([]byte, error) {
+	if len(e.keys) == 1 {
+		return store.Load(e.keys[0])
+	}
+	var bundle []byte
+	for _, key := range e.keys {
+		der, err := store.Load(key)
+		if err != nil {
+			return nil, err
+		}
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return bundle, nil
+}
+
+// ServeHTTP answers GET and HEAD requests for KDS paths.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body []byte
+	e, err := parseEndpoint(r.URL.Path, r.URL.RawQuery, s.CSPID)
+	if err == nil {
+		body, err = load(s.Store, e)
+	} else if !errors.Is(err, trust.ErrCertNotStored) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, trust.ErrCertNotStored) {
+		http.Error(w, "not mirrored", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Warningf("could not load %s: %v", r.URL, err)
+		http.Error(w, "could not load mirrored content", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", e.contentType)
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	if r.Method == http.MethodGet {
+		w.Write(body)
+	}
+}
+
+// Getter is a trust.HTTPSGetter that answers AMD KDS URLs from Store without network access. It
+// fails requests for content that Store does not hold with an error that errors.Is
+// trust.ErrCertNotStored and names the URL, so that offline verification reports exactly what it
+// is missing.
+type Getter struct {
+	Store trust.CertStore
+	// CSPID is the CSP_ID of the VLEK certificates to answer with, as for Server.
+	CSPID string
+}
+
+// Get returns the content that the KDS URL requests from the store.
+func (g *Getter) Get(kdsurl string) ([]byte, error) {
+	u, err := url.Parse(kdsurl)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %q: %v", kdsurl, err)
+	}
+	e, err := parseEndpoint(u.Path, u.RawQuery, g.CSPID)
+	if errors.Is(err, trust.ErrCertNotStored) {
+		return nil, fmt.Errorf("cannot answer %s offline: %w", kdsurl, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot answer %s offline: %v", kdsurl, err)
+	}
+	body, err := load(g.Store, e)
+	if err != nil {
+		return nil, fmt.Errorf("cannot answer %s offline: %w", kdsurl, err)
+	}
+	return body, nil
+}
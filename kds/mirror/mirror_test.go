@@ -0,0 +1,136 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/kds"
+	test "github.com/google/go-sev-guest/testing"
+	"github.com/google/go-sev-guest/verify/trust"
+)
+
+func TestServer(t *testing.T) {
+	signer, err := test.DefaultTestOnlyCertChain("Milan-B1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeKDS, err := test.FakeKDSFromSigner(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &trust.MemoryCertStore{}
+	requests := []trust.VcekRequest{{ProductLine: "Milan", ChipID: signer.HWID[:], TCB: signer.TCB}}
+	if err := trust.PrefetchVceks(context.Background(), requests, store, &trust.PrefetchOptions{Getter: fakeKDS}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Store(trust.CrlStoreKey("Milan", abi.VcekReportSigner), []byte("crl")); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(&Server{Store: store})
+	defer server.Close()
+	getter := &trust.MirrorHTTPSGetter{Mirrors: []string{server.URL}, Getter: &trust.SimpleHTTPSGetter{}}
+
+	vcekURL := kds.VCEKCertURL("Milan", signer.HWID[:], signer.TCB)
+	if got, err := getter.Get(vcekURL); err != nil || !bytes.Equal(got, signer.Vcek.Raw) {
+		t.Errorf("Get(%q) = %v, %v, want the VCEK certificate", vcekURL, got, err)
+	}
+	chainURL := kds.ProductCertChainURL(abi.VcekReportSigner, "Milan")
+	askark, err := getter.Get(chainURL)
+	if err != nil {
+		t.Fatalf("Get(%q) = _, %v", chainURL, err)
+	}
+	if _, err := kds.ParseProductCertChainFor("Milan", abi.VcekReportSigner, askark); err != nil {
+		t.Errorf("ParseProductCertChainFor(Get(%q)) = _, %v", chainURL, err)
+	}
+	crlURL := kds.CrlLinkByKey("Milan", abi.VcekReportSigner)
+	if got, err := getter.Get(crlURL); err != nil || string(got) != "crl" {
+		t.Errorf("Get(%q) = %q, %v, want \"crl\"", crlURL, got, err)
+	}
+
+	tcs := []struct {
+		url  string
+		want int
+	}{
+		{url: kds.VCEKCertURL("Milan", signer.HWID[:], signer.TCB+1), want: http.StatusNotFound},
+		{url: kds.VLEKCertURL("Milan", signer.TCB), want: http.StatusNotFound},
+		{url: "https://kdsintf.amd.com/vcek/v1/Milan/ff", want: http.StatusBadRequest},
+		{url: "https://kdsintf.amd.com/vcek/v2/Milan/cert_chain", want: http.StatusBadRequest},
+	}
+	for _, tc := range tcs {
+		var statusErr *trust.HTTPStatusError
+		if _, err := getter.Get(tc.url); !errors.As(err, &statusErr) || statusErr.StatusCode != tc.want {
+			t.Errorf("Get(%q) = _, %v, want status %d", tc.url, err, tc.want)
+		}
+	}
+}
+
+func TestGetter(t *testing.T) {
+	signer, err := test.DefaultTestOnlyCertChain("Milan-B1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &trust.MemoryCertStore{}
+	vcekKey := trust.VcekStoreKey("Milan", signer.HWID[:], signer.TCB)
+	if err := store.Store(vcekKey, signer.Vcek.Raw); err != nil {
+		t.Fatal(err)
+	}
+	getter := &Getter{Store: store}
+	vcekURL := kds.VCEKCertURL("Milan", signer.HWID[:], signer.TCB)
+	if got, err := getter.Get(vcekURL); err != nil || !bytes.Equal(got, signer.Vcek.Raw) {
+		t.Errorf("Get(%q) = %v, %v, want the VCEK certificate", vcekURL, got, err)
+	}
+	chainURL := kds.ProductCertChainURL(abi.VcekReportSigner, "Milan")
+	if _, err := getter.Get(chainURL); !errors.Is(err, trust.ErrCertNotStored) {
+		t.Errorf("Get(%q) = _, %v, want %v", chainURL, err, trust.ErrCertNotStored)
+	}
+	if _, err := getter.Get("https://kdsintf.amd.com/vcek/v2/Milan/cert_chain"); err == nil || errors.Is(err, trust.ErrCertNotStored) {
+		t.Errorf("Get(v2 cert_chain) = _, %v, want a parse error", err)
+	}
+}
+
+func TestVlekCSPID(t *testing.T) {
+	const tcb = kds.TCBVersion(0x1234)
+	store := &trust.MemoryCertStore{}
+	for cspID, der := range map[string]string{"CSP-A": "vlek a", "CSP-B": "vlek b"} {
+		if err := store.Store(trust.VlekStoreKey("Milan", cspID, tcb), []byte(der)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vlekURL := kds.VLEKCertURL("Milan", tcb)
+	for cspID, want := range map[string]string{"CSP-A": "vlek a", "CSP-B": "vlek b"} {
+		getter := &Getter{Store: store, CSPID: cspID}
+		if got, err := getter.Get(vlekURL); err != nil || string(got) != want {
+			t.Errorf("Getter{CSPID: %q}.Get(%q) = %q, %v, want %q", cspID, vlekURL, got, err, want)
+		}
+	}
+	if _, err := (&Getter{Store: store}).Get(vlekURL); !errors.Is(err, trust.ErrCertNotStored) {
+		t.Errorf("Getter{}.Get(%q) = _, %v, want %v", vlekURL, err, trust.ErrCertNotStored)
+	}
+
+	server := httptest.NewServer(&Server{Store: store, CSPID: "CSP-B"})
+	defer server.Close()
+	getter := &trust.MirrorHTTPSGetter{Mirrors: []string{server.URL}, Getter: &trust.SimpleHTTPSGetter{}}
+	if got, err := getter.Get(vlekURL); err != nil || string(got) != "vlek b" {
+		t.Errorf("Get(%q) from the CSP-B mirror = %q, %v, want \"vlek b\"", vlekURL, got, err)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package measure computes the SEV-SNP launch digest, i.e., the attestation report MEASUREMENT, of
+// a guest from its OVMF firmware, direct-boot kernel, initrd, command line, and vCPUs.
+package measure
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-sev-guest/abi"
+)
+
+const (
+	pageSize = 0x1000
+	// bspEIP is the reset vector at which the bootstrap processor starts.
+	bspEIP = 0xfffffff0
+	// defaultGuestFeatures is the SEV_FEATURES value with only SNPActive set.
+	defaultGuestFeatures = 0x1
+
+	sevHashTableHeaderGUID = "9438d606-4f22-4cc9-b479-a793d411fd21"
+	sevKernelEntryGUID     = "4de79437-abd2-427f-b835-d5b172d2045b"
+	sevInitrdEntryGUID     = "44baf731-3a2f-4bd7-9af1-41e29169781d"
+	sevCmdlineEntryGUID    = "97d02dd8-bd20-4c94-aa78-e7714d36ab2a"
+	// sevHashTableEntrySize is the size of a GUID, a 16-bit length, and a SHA-256 digest.
+	sevHashTableEntrySize = 16 + 2 + sha256.Size
+	// sevHashTableSize is the size of the table header and its cmdline, initrd, and kernel entries.
+	sevHashTableSize = 16 + 2 + 3*sevHashTableEntrySize
+)
+
+// Spec describes the launch inputs of an SEV-SNP guest that QEMU or EC2 starts with OVMF.
+type Spec struct {
+	// OVMF is the firmware image.
+	OVMF []byte
+	// Kernel is the direct-boot kernel. If nil, the guest measures no kernel hashes.
+	Kernel []byte
+	// Initrd is the direct-boot initrd. Only measured with Kernel.
+	Initrd []byte
+	// Cmdline is the kernel command line. Only measured with Kernel.
+	Cmdline string
+	// VCPUs is the number of vCPUs. Must be at least 1.
+	VCPUs int
+	// VCPUSig is the CPUID[1].EAX signature of the vCPU type, e.g., 0x800f12 for EPYC-v4.
+	VCPUSig uint32
+	// GuestFeatures is the SEV_FEATURES value of the vCPUs. If zero, SNPActive only.
+	GuestFeatures uint64
+	// VMM is the VMM whose vCPU reset state and page order to measure.
+	VMM abi.VMMType
+}
+
+// Manifest records an expected launch digest and the inputs it measures. Specs compute manifests,
+// and manifests can be stored, e.g., as JSON, to validate without the launch inputs.
+type Manifest struct {
+	// LaunchDigest is the expected MEASUREMENT.
+	LaunchDigest []byte `json:"launch_digest"`
+	// Inputs describes each measured input, e.g., "kernel" maps to its SHA-256 digest.
+	Inputs map[string]string `json:"inputs,omitempty"`
+}
+
+// Explain returns a diff-style explanation of why measurement is not the manifest's launch digest,
+// or "" if it is.
+func (m *Manifest) Explain(measurement []byte) string {
+	if bytes.Equal(measurement, m.LaunchDigest) {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "- MEASUREMENT %s (expected)\n", hex.EncodeToString(m.LaunchDigest))
+	fmt.Fprintf(&sb, "+ MEASUREMENT %s (reported)\n", hex.EncodeToString(measurement))
+	names := make([]string, 0, len(m.Inputs))
+	for name := range m.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, "  %s: %s\n", name, m.Inputs[name])
+	}
+	return sb.String()
+}
+
+// gctx is the guest context of a launch in progress, which holds the launch digest.
+type gctx struct {
+	digest [abi.LaunchDigestSize]byte
+}
+
+func (g *gctx) update(pageType uint8, gpa uint64, contents [abi.LaunchDigestSize]byte) {
+	info := &abi.PageInfo{DigestCur: g.digest, Contents: contents, PageType: pageType, GPA: gpa}
+	g.digest = info.Digest()
+}
+
+func (g *gctx) normalPages(gpa uint64, data []byte) error {
+	if len(data)%pageSize != 0 {
+		return fmt.Errorf("normal pages at 0x%x are %d bytes, not a multiple of the page size", gpa, len(data))
+	}
+	for offset := 0; offset < len(data); offset += pageSize {
+		g.update(abi.PageTypeNormal, gpa+uint64(offset), sha512.Sum384(data[offset:offset+pageSize]))
+	}
+	return nil
+}
+
+func (g *gctx) zeroPages(gpa uint64, size uint32) {
+	for offset := uint64(0); offset < uint64(size); offset += pageSize {
+		g.update(abi.PageTypeZero, gpa+offset, [abi.LaunchDigestSize]byte{})
+	}
+}
+
+type sevHashes struct {
+	kernel, initrd, cmdline [sha256.Size]byte
+}
+
+func newSevHashes(s *Spec) *sevHashes {
+	return &sevHashes{
+		kernel:  sha256.Sum256(s.Kernel),
+		initrd:  sha256.Sum256(s.Initrd),
+		cmdline: sha256.Sum256(append([]byte(s.Cmdline), 0)),
+	}
+}
+
+// page returns the page that holds the SEV hashes table at offset.
+func (h *sevHashes) page(offset uint32) ([]byte, error) {
+	paddedSize := (sevHashTableSize + 15) &^ 15
+	if int(offset)+paddedSize > pageSize {
+		return nil, fmt.Errorf("SEV hashes table at page offset 0x%x does not fit in the page", offset)
+	}
+	page := make([]byte, pageSize)
+	table := page[offset:]
+	copy(table[0:16], guidLE(sevHashTableHeaderGUID))
+	binary.LittleEndian.PutUint16(table[16:18], sevHashTableSize)
+	for i, entry := range []struct {
+		guid   string
+		digest [sha256.Size]byte
+	}{
+		{sevCmdlineEntryGUID, h.cmdline},
+		{sevInitrdEntryGUID, h.initrd},
+		{sevKernelEntryGUID, h.kernel},
+	} {
+		e := table[18+i*sevHashTableEntrySize:]
+		copy(e[0:16], guidLE(entry.guid))
+		binary.LittleEndian.PutUint16(e[16:18], sevHashTableEntrySize)
+		copy(e[18:18+sha256.Size], entry.digest[:])
+	}
+	return page, nil
+}
+
+func (s *Spec) measureSection(g *gctx, ovmf *OVMF, section MetadataSection, hashes *sevHashes) error {
+	gpa := uint64(section.GPA)
+	switch section.Type {
+	case SectionSnpSecMem, SectionSvsmCaa:
+		g.zeroPages(gpa, section.Size)
+	case SectionSnpSecrets:
+		g.update(abi.PageTypeSecrets, gpa, [abi.LaunchDigestSize]byte{})
+	case SectionCpuid:
+		// EC2 adds the CPUID page after every other section.
+		if s.VMM != abi.VMMTypeEC2 {
+			g.update(abi.PageTypeCpuid, gpa, [abi.LaunchDigestSize]byte{})
+		}
+	case SectionSnpKernelHashes:
+		if hashes == nil {
+			g.zeroPages(gpa, section.Size)
+			return nil
+		}
+		tableGPA, err := ovmf.SevHashesTableGPA()
+		if err != nil {
+			return err
+		}
+		page, err := hashes.page(tableGPA & (pageSize - 1))
+		if err != nil {
+			return err
+		}
+		return g.normalPages(gpa, page)
+	default:
+		return fmt.Errorf("unknown OVMF SEV metadata section type %d", section.Type)
+	}
+	return nil
+}
+
+// Manifest computes the launch digest of the spec and describes its inputs.
+func (s *Spec) Manifest() (*Manifest, error) {
+	if s.VCPUs < 1 {
+		return nil, fmt.Errorf("spec has %d vCPUs, want at least 1", s.VCPUs)
+	}
+	ovmf, err := ParseOVMF(s.OVMF)
+	if err != nil {
+		return nil, err
+	}
+	sections, err := ovmf.MetadataSections()
+	if err != nil {
+		return nil, err
+	}
+	g := &gctx{}
+	if err := g.normalPages(ovmf.GPA(), s.OVMF); err != nil {
+		return nil, fmt.Errorf("could not measure OVMF: %v", err)
+	}
+	var hashes *sevHashes
+	if s.Kernel != nil {
+		hashes = newSevHashes(s)
+	}
+	hasHashesSection := false
+	for _, section := range sections {
+		hasHashesSection = hasHashesSection || section.Type == SectionSnpKernelHashes
+		if err := s.measureSection(g, ovmf, section, hashes); err != nil {
+			return nil, err
+		}
+	}
+	if hashes != nil && !hasHashesSection {
+		return nil, fmt.Errorf("OVMF has no SNP_KERNEL_HASHES section to measure the kernel with")
+	}
+	if s.VMM == abi.VMMTypeEC2 {
+		for _, section := range sections {
+			if section.Type == SectionCpuid {
+				g.update(abi.PageTypeCpuid, uint64(section.GPA), [abi.LaunchDigestSize]byte{})
+			}
+		}
+	}
+	features := s.GuestFeatures
+	if features == 0 {
+		features = defaultGuestFeatures
+	}
+	for i := 0; i < s.VCPUs; i++ {
+		eip := uint32(bspEIP)
+		if i > 0 {
+			if eip, err = ovmf.SevEsResetEIP(); err != nil {
+				return nil, err
+			}
+		}
+		vmsa, err := abi.ResetVmsa(s.VMM, eip, features, s.VCPUSig)
+		if err != nil {
+			return nil, err
+		}
+		if g.digest, err = abi.SnpLaunchDigestUpdateVmsa(g.digest, vmsa); err != nil {
+			return nil, err
+		}
+	}
+	ovmfDigest := sha512.Sum384(s.OVMF)
+	inputs := map[string]string{
+		"ovmf":           "sha384:" + hex.EncodeToString(ovmfDigest[:]),
+		"vcpus":          fmt.Sprintf("%d", s.VCPUs),
+		"vcpu_sig":       fmt.Sprintf("0x%x", s.VCPUSig),
+		"guest_features": fmt.Sprintf("0x%x", features),
+	}
+	if hashes != nil {
+		inputs["kernel"] = "sha256:" + hex.EncodeToString(hashes.kernel[:])
+		inputs["initrd"] = "sha256:" + hex.EncodeToString(hashes.initrd[:])
+		inputs["cmdline"] = fmt.Sprintf("%q", s.Cmdline)
+	}
+	return &Manifest{LaunchDigest: g.digest[:], Inputs: inputs}, nil
+}
+
+// LaunchDigest returns the SEV-SNP launch digest of the spec.
+func (s *Spec) LaunchDigest() ([]byte, error) {
+	m, err := s.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	return m.LaunchDigest, nil
+}
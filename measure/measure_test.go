@@ -0,0 +1,217 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package measure
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/google/go-sev-guest/abi"
+	test "github.com/google/go-sev-guest/testing"
+)
+
+const (
+	testImageSize = 0x10000
+	testResetEIP  = 0xffff_f000
+	testHashesGPA = 0x80_0c00
+)
+
+func tableEntry(guid string, data []byte) []byte {
+	entry := append([]byte{}, data...)
+	entry = binary.LittleEndian.AppendUint16(entry, uint16(len(data)+footerTableEntryHeaderSize))
+	return append(entry, guidLE(guid)...)
+}
+
+func u32(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
+
+// fakeOVMF returns an OVMF image whose footer table describes sections as its SEV metadata.
+func fakeOVMF(sections []MetadataSection) []byte {
+	image := make([]byte, testImageSize)
+	for i := range image[:0x1000] {
+		image[i] = byte(i)
+	}
+	metadataOffset := 0x800
+	metadata := image[metadataOffset:]
+	binary.LittleEndian.PutUint32(metadata[0:4], sevMetadataSignature)
+	binary.LittleEndian.PutUint32(metadata[4:8], uint32(sevMetadataHeaderSize+len(sections)*sevMetadataItemSize))
+	binary.LittleEndian.PutUint32(metadata[8:12], 1)
+	binary.LittleEndian.PutUint32(metadata[12:16], uint32(len(sections)))
+	for i, s := range sections {
+		item := metadata[sevMetadataHeaderSize+i*sevMetadataItemSize:]
+		binary.LittleEndian.PutUint32(item[0:4], s.GPA)
+		binary.LittleEndian.PutUint32(item[4:8], s.Size)
+		binary.LittleEndian.PutUint32(item[8:12], uint32(s.Type))
+	}
+	var table []byte
+	table = append(table, tableEntry(ovmfSevMetadataGUID, u32(uint32(testImageSize-metadataOffset)))...)
+	table = append(table, tableEntry(sevEsResetBlockGUID, u32(testResetEIP))...)
+	table = append(table, tableEntry(sevHashTableRVGUID, append(u32(testHashesGPA), u32(0x400)...))...)
+	footer := binary.LittleEndian.AppendUint16(nil, uint16(len(table)+footerTableEntryHeaderSize))
+	footer = append(footer, guidLE(ovmfTableFooterGUID)...)
+	end := testImageSize - footerTableOffset
+	copy(image[end-len(footer):], footer)
+	copy(image[end-len(footer)-len(table):], table)
+	return image
+}
+
+var testSections = []MetadataSection{
+	{GPA: 0x80_0000, Size: 0x2000, Type: SectionSnpSecMem},
+	{GPA: 0x80_2000, Size: 0x1000, Type: SectionSnpSecrets},
+	{GPA: 0x80_3000, Size: 0x1000, Type: SectionCpuid},
+	{GPA: 0x80_4000, Size: 0x1000, Type: SectionSnpKernelHashes},
+}
+
+func TestParseOVMF(t *testing.T) {
+	ovmf, err := ParseOVMF(fakeOVMF(testSections))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ovmf.GPA(); got != fourGB-testImageSize {
+		t.Errorf("GPA() = 0x%x, want 0x%x", got, fourGB-testImageSize)
+	}
+	if eip, err := ovmf.SevEsResetEIP(); err != nil || eip != testResetEIP {
+		t.Errorf("SevEsResetEIP() = 0x%x, %v. Want 0x%x", eip, err, testResetEIP)
+	}
+	if gpa, err := ovmf.SevHashesTableGPA(); err != nil || gpa != testHashesGPA {
+		t.Errorf("SevHashesTableGPA() = 0x%x, %v. Want 0x%x", gpa, err, testHashesGPA)
+	}
+	sections, err := ovmf.MetadataSections()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != len(testSections) {
+		t.Fatalf("MetadataSections() = %v, want %v", sections, testSections)
+	}
+	for i := range sections {
+		if sections[i] != testSections[i] {
+			t.Errorf("MetadataSections()[%d] = %v, want %v", i, sections[i], testSections[i])
+		}
+	}
+
+	plain, err := ParseOVMF(make([]byte, testImageSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.MetadataSections(); !test.Match(err, "no SEV metadata entry") {
+		t.Errorf("MetadataSections() = _, %v. Want a missing metadata error", err)
+	}
+}
+
+func TestManifestLaunchDigest(t *testing.T) {
+	image := fakeOVMF(testSections[:2])
+	spec := &Spec{OVMF: image, VCPUs: 1, VCPUSig: 0x800f12}
+	got, err := spec.LaunchDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Measure by hand in the order the VMM adds the pages.
+	var digest [abi.LaunchDigestSize]byte
+	add := func(pageType uint8, gpa uint64, contents [abi.LaunchDigestSize]byte) {
+		info := &abi.PageInfo{DigestCur: digest, Contents: contents, PageType: pageType, GPA: gpa}
+		digest = info.Digest()
+	}
+	for offset := 0; offset < len(image); offset += pageSize {
+		add(abi.PageTypeNormal, fourGB-testImageSize+uint64(offset), sha512.Sum384(image[offset:offset+pageSize]))
+	}
+	add(abi.PageTypeZero, 0x80_0000, [abi.LaunchDigestSize]byte{})
+	add(abi.PageTypeZero, 0x80_1000, [abi.LaunchDigestSize]byte{})
+	add(abi.PageTypeSecrets, 0x80_2000, [abi.LaunchDigestSize]byte{})
+	vmsa, err := abi.ResetVmsa(abi.VMMTypeQEMU, bspEIP, defaultGuestFeatures, 0x800f12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := abi.SnpLaunchDigestUpdateVmsa(digest, vmsa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want[:]) {
+		t.Errorf("LaunchDigest() = %x, want %x", got, want)
+	}
+}
+
+func TestManifestInputs(t *testing.T) {
+	image := fakeOVMF(testSections)
+	base := Spec{OVMF: image, Kernel: []byte("kernel"), Initrd: []byte("initrd"), Cmdline: "console=ttyS0", VCPUs: 2}
+	baseManifest, err := base.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, change := range map[string]func(s *Spec){
+		"kernel":   func(s *Spec) { s.Kernel = []byte("other kernel") },
+		"initrd":   func(s *Spec) { s.Initrd = nil },
+		"cmdline":  func(s *Spec) { s.Cmdline = "" },
+		"vcpus":    func(s *Spec) { s.VCPUs = 4 },
+		"vcpu_sig": func(s *Spec) { s.VCPUSig = 0xa00f11 },
+		"vmm":      func(s *Spec) { s.VMM = abi.VMMTypeEC2 },
+	} {
+		spec := base
+		change(&spec)
+		m, err := spec.Manifest()
+		if err != nil {
+			t.Fatalf("%s: Manifest() = _, %v", name, err)
+		}
+		explanation := baseManifest.Explain(m.LaunchDigest)
+		if explanation == "" {
+			t.Errorf("%s: changing the input did not change the launch digest", name)
+		}
+		if !strings.Contains(explanation, "- MEASUREMENT") || !strings.Contains(explanation, "+ MEASUREMENT") {
+			t.Errorf("%s: Explain() = %q, want a diff of the measurements", name, explanation)
+		}
+	}
+	if explanation := baseManifest.Explain(baseManifest.LaunchDigest); explanation != "" {
+		t.Errorf("Explain(LaunchDigest) = %q, want \"\"", explanation)
+	}
+}
+
+func TestManifestErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		spec    *Spec
+		wantErr string
+	}{
+		{
+			name:    "no vCPUs",
+			spec:    &Spec{OVMF: fakeOVMF(testSections)},
+			wantErr: "spec has 0 vCPUs",
+		},
+		{
+			name:    "no metadata",
+			spec:    &Spec{OVMF: make([]byte, testImageSize), VCPUs: 1},
+			wantErr: "no SEV metadata entry",
+		},
+		{
+			name:    "no kernel hashes section",
+			spec:    &Spec{OVMF: fakeOVMF(testSections[:3]), Kernel: []byte("kernel"), VCPUs: 1},
+			wantErr: "no SNP_KERNEL_HASHES section",
+		},
+		{
+			name:    "unaligned image",
+			spec:    &Spec{OVMF: fakeOVMF(testSections)[1:], VCPUs: 1},
+			wantErr: "not a multiple of the page size",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.spec.Manifest(); !test.Match(err, tc.wantErr) {
+				t.Errorf("Manifest() = _, %v. Want error %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package measure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// fourGB is the address at which the OVMF image ends in guest physical memory.
+	fourGB = 0x100000000
+	// footerTableEntryHeaderSize is the size of a GUIDed table entry's header: a 16-bit size
+	// followed by the GUID.
+	footerTableEntryHeaderSize = 18
+	// footerTableOffset is the distance from the end of the image to the end of the table footer.
+	footerTableOffset = 32
+	// sevMetadataSignature is "ASEV" in little endian.
+	sevMetadataSignature  = 0x56455341
+	sevMetadataHeaderSize = 16
+	sevMetadataItemSize   = 12
+
+	ovmfTableFooterGUID = "96b582de-1fb2-45f7-baea-a366c55a082d"
+	sevHashTableRVGUID  = "7255371f-3a3b-4b04-927b-1da6efa8d454"
+	sevEsResetBlockGUID = "00f771de-1a7e-4fcb-890e-68c77e2fb44e"
+	ovmfSevMetadataGUID = "dc886566-984a-4798-a75e-5585a7bf67cc"
+)
+
+// SectionType is the type of an OVMF SEV metadata section, which determines how the VMM adds the
+// section's pages to the guest.
+type SectionType uint32
+
+const (
+	// SectionSnpSecMem is memory that the VMM adds as zero pages.
+	SectionSnpSecMem SectionType = 1
+	// SectionSnpSecrets is the SEV-SNP secrets page.
+	SectionSnpSecrets SectionType = 2
+	// SectionCpuid is the SEV-SNP CPUID page.
+	SectionCpuid SectionType = 3
+	// SectionSvsmCaa is the SVSM calling area, which the VMM adds as zero pages.
+	SectionSvsmCaa SectionType = 4
+	// SectionSnpKernelHashes is the page that holds the SEV hashes table of the kernel, initrd, and
+	// command line.
+	SectionSnpKernelHashes SectionType = 0x10
+)
+
+// MetadataSection describes a range of guest memory that OVMF's SEV metadata asks the VMM to
+// initialize.
+type MetadataSection struct {
+	GPA  uint32
+	Size uint32
+	Type SectionType
+}
+
+// OVMF is a parsed OVMF firmware image and the SEV-related data of its GUIDed footer table.
+type OVMF struct {
+	data  []byte
+	table map[string][]byte
+}
+
+// guidLE returns the little-endian (Microsoft) byte order of the GUID s.
+func guidLE(s string) []byte {
+	u := uuid.MustParse(s)
+	return []byte{u[3], u[2], u[1], u[0], u[5], u[4], u[7], u[6],
+		u[8], u[9], u[10], u[11], u[12], u[13], u[14], u[15]}
+}
+
+// guidFromLE returns the string form of the GUID in little-endian byte order b.
+func guidFromLE(b []byte) string {
+	var u uuid.UUID
+	copy(u[:], []byte{b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6]})
+	copy(u[8:], b[8:16])
+	return u.String()
+}
+
+// ParseOVMF parses the GUIDed footer table of an OVMF image. Images without a footer table have
+// no SEV metadata.
+func ParseOVMF(data []byte) (*OVMF, error) {
+	result := &OVMF{data: data, table: map[string][]byte{}}
+	footerStart := len(data) - footerTableOffset - footerTableEntryHeaderSize
+	if footerStart < 0 {
+		return nil, fmt.Errorf("OVMF image is %d bytes, too small for a footer table", len(data))
+	}
+	footer := data[footerStart : footerStart+footerTableEntryHeaderSize]
+	if !bytes.Equal(footer[2:], guidLE(ovmfTableFooterGUID)) {
+		return result, nil
+	}
+	tableSize := int(binary.LittleEndian.Uint16(footer[0:2])) - footerTableEntryHeaderSize
+	if tableSize < 0 || tableSize > footerStart {
+		return nil, fmt.Errorf("OVMF footer table size %d is invalid", tableSize)
+	}
+	table := data[footerStart-tableSize : footerStart]
+	for len(table) >= footerTableEntryHeaderSize {
+		header := table[len(table)-footerTableEntryHeaderSize:]
+		size := int(binary.LittleEndian.Uint16(header[0:2]))
+		if size < footerTableEntryHeaderSize || size > len(table) {
+			return nil, fmt.Errorf("OVMF footer table entry size %d is invalid", size)
+		}
+		result.table[guidFromLE(header[2:18])] = table[len(table)-size : len(table)-footerTableEntryHeaderSize]
+		table = table[:len(table)-size]
+	}
+	return result, nil
+}
+
+// GPA returns the guest physical address at which the VMM loads the image.
+func (o *OVMF) GPA() uint64 {
+	return fourGB - uint64(len(o.data))
+}
+
+func (o *OVMF) tableUint32(guid, name string) (uint32, error) {
+	entry, ok := o.table[guid]
+	if !ok {
+		return 0, fmt.Errorf("OVMF footer table has no %s entry", name)
+	}
+	if len(entry) < 4 {
+		return 0, fmt.Errorf("OVMF footer table %s entry is %d bytes, want at least 4", name, len(entry))
+	}
+	return binary.LittleEndian.Uint32(entry[0:4]), nil
+}
+
+// SevEsResetEIP returns the address at which application processors start.
+func (o *OVMF) SevEsResetEIP() (uint32, error) {
+	return o.tableUint32(sevEsResetBlockGUID, "SEV-ES reset block")
+}
+
+// SevHashesTableGPA returns the guest physical address of the SEV hashes table.
+func (o *OVMF) SevHashesTableGPA() (uint32, error) {
+	return o.tableUint32(sevHashTableRVGUID, "SEV hashes table")
+}
+
+// MetadataSections returns the SEV metadata sections in the order the VMM initializes them.
+func (o *OVMF) MetadataSections() ([]MetadataSection, error) {
+	offset, err := o.tableUint32(ovmfSevMetadataGUID, "SEV metadata")
+	if err != nil {
+		return nil, err
+	}
+	start := len(o.data) - int(offset)
+	if offset == 0 || start < 0 || start+sevMetadataHeaderSize > len(o.data) {
+		return nil, fmt.Errorf("OVMF SEV metadata offset 0x%x is outside the image", offset)
+	}
+	header := o.data[start : start+sevMetadataHeaderSize]
+	if sig := binary.LittleEndian.Uint32(header[0:4]); sig != sevMetadataSignature {
+		return nil, fmt.Errorf("OVMF SEV metadata signature is 0x%08x, want 0x%08x", sig, sevMetadataSignature)
+	}
+	count := int(binary.LittleEndian.Uint32(header[12:16]))
+	items := o.data[start+sevMetadataHeaderSize:]
+	if count > len(items)/sevMetadataItemSize {
+		return nil, fmt.Errorf("OVMF SEV metadata has %d sections, more than the image holds", count)
+	}
+	var result []MetadataSection
+	for i := 0; i < count; i++ {
+		item := items[i*sevMetadataItemSize:]
+		result = append(result, MetadataSection{
+			GPA:  binary.LittleEndian.Uint32(item[0:4]),
+			Size: binary.LittleEndian.Uint32(item[4:8]),
+			Type: SectionType(binary.LittleEndian.Uint32(item[8:12])),
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package profile provides named verification and validation starting points that capture the
+// constraints of the platforms that host SEV-SNP guests. Select a profile, then tighten its
+// options, e.g., with the expected MEASUREMENT and REPORT_DATA, before use.
+package profile
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/validate"
+	"github.com/google/go-sev-guest/verify"
+	"github.com/google/go-sev-guest/verify/trust"
+)
+
+const (
+	// Azure is the profile of Azure confidential VMs. Their paravisor (HCL) requests reports at
+	// VMPL0 and the VCEK certificate comes from Azure THIM, with the AMD KDS as fallback.
+	Azure = "azure"
+	// GCP is the profile of Google Compute Engine confidential VMs. The guest requests VCEK-signed
+	// reports at VMPL0, and the VCEK certificate comes from the AMD KDS.
+	GCP = "gcp"
+	// BareMetal is the profile of self-hosted SEV-SNP machines. The host may provision VCEK or VLEK
+	// certificates, and revocations are checked.
+	BareMetal = "bare-metal"
+)
+
+// Profile is a platform's verification and validation options.
+type Profile struct {
+	// Name is the profile's name, e.g., Azure.
+	Name string
+	// Verify configures the report's signature and certificate chain checks.
+	Verify *verify.Options
+	// Validate configures the report's field checks.
+	Validate *validate.Options
+}
+
+// baseValidateOptions forbids the guest policies that no production guest should have.
+func baseValidateOptions() *validate.Options {
+	return &validate.Options{
+		GuestPolicy: abi.SnpPolicy{
+			SMT: true,
+			// Debug and MigrateMA stay false, so reports of guests that permit them are rejected.
+		},
+		PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true, TSMEEnabled: true},
+	}
+}
+
+func zero() *int {
+	vmpl := 0
+	return &vmpl
+}
+
+var profiles = map[string]func() *Profile{
+	Azure: func() *Profile {
+		opts := baseValidateOptions()
+		opts.VMPL = zero()
+		return &Profile{
+			Name: Azure,
+			Verify: &verify.Options{
+				Getter:         &trust.THIMGetter{Fallback: trust.DefaultHTTPSGetter()},
+				AllowedSigners: []abi.ReportSigner{abi.VcekReportSigner},
+			},
+			Validate: opts,
+		}
+	},
+	GCP: func() *Profile {
+		opts := baseValidateOptions()
+		opts.VMPL = zero()
+		return &Profile{
+			Name: GCP,
+			Verify: &verify.Options{
+				Getter:         trust.DefaultHTTPSGetter(),
+				AllowedSigners: []abi.ReportSigner{abi.VcekReportSigner},
+			},
+			Validate: opts,
+		}
+	},
+	BareMetal: func() *Profile {
+		return &Profile{
+			Name: BareMetal,
+			Verify: &verify.Options{
+				Getter:           trust.DefaultHTTPSGetter(),
+				CheckRevocations: true,
+				AllowedSigners:   []abi.ReportSigner{abi.VcekReportSigner, abi.VlekReportSigner},
+			},
+			Validate: baseValidateOptions(),
+		}
+	},
+}
+
+// Get returns new options of the named profile, which the caller may modify.
+func Get(name string) (*Profile, error) {
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q. Expect one of %v", name, Names())
+	}
+	return profile(), nil
+}
+
+// Names returns the names of every profile in sorted order.
+func Names() []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
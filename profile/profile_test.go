@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"testing"
+
+	"github.com/google/go-sev-guest/abi"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	test "github.com/google/go-sev-guest/testing"
+	"github.com/google/go-sev-guest/validate"
+	"github.com/google/go-sev-guest/verify/testdata"
+)
+
+func TestGet(t *testing.T) {
+	for _, name := range []string{Azure, GCP, BareMetal} {
+		p, err := Get(name)
+		if err != nil {
+			t.Fatalf("Get(%q) = _, %v", name, err)
+		}
+		if p.Name != name || p.Verify == nil || p.Validate == nil {
+			t.Errorf("Get(%q) = %+v, want a complete profile", name, p)
+		}
+		if p.Validate.GuestPolicy.Debug || p.Validate.GuestPolicy.MigrateMA {
+			t.Errorf("Get(%q).Validate.GuestPolicy = %+v, want debug and migration forbidden", name, p.Validate.GuestPolicy)
+		}
+		// Tightening one profile must not change the next.
+		p.Validate.MinimumGuestSvn = 7
+		p.Verify.AllowedSigners = append(p.Verify.AllowedSigners, abi.NoneReportSigner)
+		again, err := Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.Validate.MinimumGuestSvn != 0 || len(again.Verify.AllowedSigners) == len(p.Verify.AllowedSigners) {
+			t.Errorf("Get(%q) returned options changed by an earlier caller", name)
+		}
+	}
+	if _, err := Get("on-prem"); !test.Match(err, `unknown profile "on-prem"`) {
+		t.Errorf("Get(\"on-prem\") = _, %v, want an unknown profile error", err)
+	}
+	if got := Names(); len(got) != 3 || got[0] != Azure || got[1] != BareMetal || got[2] != GCP {
+		t.Errorf("Names() = %v, want [%s %s %s]", got, Azure, BareMetal, GCP)
+	}
+}
+
+func TestValidateRejectsDebug(t *testing.T) {
+	report, err := abi.ReportToProto(testdata.AttestationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation := &spb.Attestation{
+		Report:           report,
+		CertificateChain: &spb.CertificateChain{VcekCert: testdata.VcekBytes},
+	}
+	p, err := Get(GCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The test report's guest permits debugging.
+	if err := validate.SnpAttestation(attestation, p.Validate); !test.Match(err, "unauthorized debug capability") {
+		t.Errorf("validate.SnpAttestation(_, GCP profile) = %v, want a debug error", err)
+	}
+}
@@ -38,6 +38,116 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// TCBOrdering names a preset of tcb_relations.
+type TCBOrdering int32
+
+const (
+	// Adds no relations.
+	TCBOrdering_TCB_ORDERING_UNCHECKED TCBOrdering = 0
+	// launch <= reported <= current.
+	TCBOrdering_TCB_ORDERING_MONOTONIC TCBOrdering = 1
+	// launch == reported <= current.
+	TCBOrdering_TCB_ORDERING_LAUNCH_EQUALS_REPORTED TCBOrdering = 2
+	// launch == reported == current.
+	TCBOrdering_TCB_ORDERING_EQUAL TCBOrdering = 3
+)
+
+// Enum value maps for TCBOrdering.
+var (
+	TCBOrdering_name = map[int32]string{
+		0: "TCB_ORDERING_UNCHECKED",
+		1: "TCB_ORDERING_MONOTONIC",
+		2: "TCB_ORDERING_LAUNCH_EQUALS_REPORTED",
+		3: "TCB_ORDERING_EQUAL",
+	}
+	TCBOrdering_value = map[string]int32{
+		"TCB_ORDERING_UNCHECKED":              0,
+		"TCB_ORDERING_MONOTONIC":              1,
+		"TCB_ORDERING_LAUNCH_EQUALS_REPORTED": 2,
+		"TCB_ORDERING_EQUAL":                  3,
+	}
+)
+
+func (x TCBOrdering) Enum() *TCBOrdering {
+	p := new(TCBOrdering)
+	*p = x
+	return p
+}
+
+func (x TCBOrdering) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TCBOrdering) Descriptor() protoreflect.EnumDescriptor {
+	return file_check_proto_enumTypes[0].Descriptor()
+}
+
+func (TCBOrdering) Type() protoreflect.EnumType {
+	return &file_check_proto_enumTypes[0]
+}
+
+func (x TCBOrdering) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TCBOrdering.Descriptor instead.
+func (TCBOrdering) EnumDescriptor() ([]byte, []int) {
+	return file_check_proto_rawDescGZIP(), []int{0}
+}
+
+// SigningKey is the key that signs an attestation report.
+type SigningKey int32
+
+const (
+	// Either key may sign the report.
+	SigningKey_SIGNING_KEY_UNCHECKED SigningKey = 0
+	// The Versioned Chip Endorsement Key.
+	SigningKey_SIGNING_KEY_VCEK SigningKey = 1
+	// The Versioned Loaded Endorsement Key of a cloud service provider.
+	SigningKey_SIGNING_KEY_VLEK SigningKey = 2
+)
+
+// Enum value maps for SigningKey.
+var (
+	SigningKey_name = map[int32]string{
+		0: "SIGNING_KEY_UNCHECKED",
+		1: "SIGNING_KEY_VCEK",
+		2: "SIGNING_KEY_VLEK",
+	}
+	SigningKey_value = map[string]int32{
+		"SIGNING_KEY_UNCHECKED": 0,
+		"SIGNING_KEY_VCEK":      1,
+		"SIGNING_KEY_VLEK":      2,
+	}
+)
+
+func (x SigningKey) Enum() *SigningKey {
+	p := new(SigningKey)
+	*p = x
+	return p
+}
+
+func (x SigningKey) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SigningKey) Descriptor() protoreflect.EnumDescriptor {
+	return file_check_proto_enumTypes[1].Descriptor()
+}
+
+func (SigningKey) Type() protoreflect.EnumType {
+	return &file_check_proto_enumTypes[1]
+}
+
+func (x SigningKey) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SigningKey.Descriptor instead.
+func (SigningKey) EnumDescriptor() ([]byte, []int) {
+	return file_check_proto_rawDescGZIP(), []int{1}
+}
+
 // Policy is a representation of an attestation report validation policy.
 // Each field corresponds to a field on validate.Options. This format
 // is useful for providing programmatic inputs to the `check` CLI tool.
@@ -73,6 +183,54 @@ type Policy struct {
 	TrustedIdKeyHashes        [][]byte                `protobuf:"bytes,23,rep,name=trusted_id_key_hashes,json=trustedIdKeyHashes,proto3" json:"trusted_id_key_hashes,omitempty"`
 	// The expected product that generated the attestation report. Stepping optional.
 	Product *sevsnp.SevProduct `protobuf:"bytes,24,opt,name=product,proto3" json:"product,omitempty"`
+	// Acceptable MEASUREMENT values. Each should be 48 bytes long.
+	Measurements [][]byte `protobuf:"bytes,25,rep,name=measurements,proto3" json:"measurements,omitempty"`
+	// Acceptable FAMILY_ID values of the ID block. Each should be 16 bytes long.
+	FamilyIds [][]byte `protobuf:"bytes,26,rep,name=family_ids,json=familyIds,proto3" json:"family_ids,omitempty"`
+	// Acceptable IMAGE_ID values of the ID block. Each should be 16 bytes long.
+	ImageIds [][]byte `protobuf:"bytes,27,rep,name=image_ids,json=imageIds,proto3" json:"image_ids,omitempty"`
+	// The component-wise minimum_tcb. At most one of minimum_tcb and
+	// minimum_tcb_parts may be set. The parts of every minimum TCB follow the
+	// TCB layout of product, and may only name the same product.
+	MinimumTcbParts *sevsnp.TcbParts `protobuf:"bytes,28,opt,name=minimum_tcb_parts,json=minimumTcbParts,proto3" json:"minimum_tcb_parts,omitempty"`
+	// The component-wise minimum_launch_tcb. At most one of minimum_launch_tcb
+	// and minimum_launch_tcb_parts may be set.
+	MinimumLaunchTcbParts *sevsnp.TcbParts `protobuf:"bytes,29,opt,name=minimum_launch_tcb_parts,json=minimumLaunchTcbParts,proto3" json:"minimum_launch_tcb_parts,omitempty"`
+	// PLATFORM_INFO bits that must be set. Unchecked if 0.
+	RequiredPlatformInfo uint64 `protobuf:"varint,30,opt,name=required_platform_info,json=requiredPlatformInfo,proto3" json:"required_platform_info,omitempty"`
+	// PLATFORM_INFO bits that must be clear. Unchecked if 0.
+	ForbiddenPlatformInfo uint64 `protobuf:"varint,31,opt,name=forbidden_platform_info,json=forbiddenPlatformInfo,proto3" json:"forbidden_platform_info,omitempty"`
+	// The highest permissible VMPL, 0-3, i.e., the least privileged level at
+	// which the report may have been requested.
+	MaximumVmpl *wrapperspb.UInt32Value `protobuf:"bytes,32,opt,name=maximum_vmpl,json=maximumVmpl,proto3" json:"maximum_vmpl,omitempty"`
+	// Acceptable FAMILY_ID patterns: hex digits, '?' for any nibble, and an
+	// optional trailing '*' for any remainder, e.g., "0011??33*".
+	FamilyIdPatterns []string `protobuf:"bytes,33,rep,name=family_id_patterns,json=familyIdPatterns,proto3" json:"family_id_patterns,omitempty"`
+	// Acceptable IMAGE_ID patterns in the same form as family_id_patterns.
+	ImageIdPatterns []string `protobuf:"bytes,34,rep,name=image_id_patterns,json=imageIdPatterns,proto3" json:"image_id_patterns,omitempty"`
+	// Acceptable HOST_DATA patterns in the same form as family_id_patterns.
+	HostDataPatterns []string `protobuf:"bytes,35,rep,name=host_data_patterns,json=hostDataPatterns,proto3" json:"host_data_patterns,omitempty"`
+	// The minimum acceptable COMMITTED_TCB, i.e., the lowest TCB to which the
+	// firmware may be rolled back.
+	MinimumCommittedTcb uint64 `protobuf:"varint,36,opt,name=minimum_committed_tcb,json=minimumCommittedTcb,proto3" json:"minimum_committed_tcb,omitempty"`
+	// The component-wise minimum_committed_tcb. At most one of
+	// minimum_committed_tcb and minimum_committed_tcb_parts may be set.
+	MinimumCommittedTcbParts *sevsnp.TcbParts `protobuf:"bytes,37,opt,name=minimum_committed_tcb_parts,json=minimumCommittedTcbParts,proto3" json:"minimum_committed_tcb_parts,omitempty"`
+	// Component-wise orderings of the report's TCB fields of the form
+	// "lower<=higher", where each side is current, committed, reported, or
+	// launch, e.g., "launch<=committed".
+	TcbRelations []string `protobuf:"bytes,38,rep,name=tcb_relations,json=tcbRelations,proto3" json:"tcb_relations,omitempty"`
+	// A preset of tcb_relations for how the report's LAUNCH_TCB, REPORTED_TCB,
+	// and CURRENT_TCB relate.
+	TcbOrdering TCBOrdering `protobuf:"varint,39,opt,name=tcb_ordering,json=tcbOrdering,proto3,enum=check.TCBOrdering" json:"tcb_ordering,omitempty"`
+	// If true, rejects reports whose PLATFORM_INFO has SMT enabled while their
+	// POLICY does not permit SMT.
+	RequireConsistentSmt bool `protobuf:"varint,40,opt,name=require_consistent_smt,json=requireConsistentSmt,proto3" json:"require_consistent_smt,omitempty"`
+	// Acceptable CHIP_ID values, e.g., of the machines of a fleet. Each should
+	// be 64 bytes long.
+	ChipIds [][]byte `protobuf:"bytes,41,rep,name=chip_ids,json=chipIds,proto3" json:"chip_ids,omitempty"`
+	// The key that must have signed the report.
+	SigningKey SigningKey `protobuf:"varint,42,opt,name=signing_key,json=signingKey,proto3,enum=check.SigningKey" json:"signing_key,omitempty"`
 }
 
 func (x *Policy) Reset() {
@@ -275,6 +433,132 @@ func (x *Policy) GetProduct() *sevsnp.SevProduct {
 	return nil
 }
 
+func (x *Policy) GetMeasurements() [][]byte {
+	if x != nil {
+		return x.Measurements
+	}
+	return nil
+}
+
+func (x *Policy) GetFamilyIds() [][]byte {
+	if x != nil {
+		return x.FamilyIds
+	}
+	return nil
+}
+
+func (x *Policy) GetImageIds() [][]byte {
+	if x != nil {
+		return x.ImageIds
+	}
+	return nil
+}
+
+func (x *Policy) GetMinimumTcbParts() *sevsnp.TcbParts {
+	if x != nil {
+		return x.MinimumTcbParts
+	}
+	return nil
+}
+
+func (x *Policy) GetMinimumLaunchTcbParts() *sevsnp.TcbParts {
+	if x != nil {
+		return x.MinimumLaunchTcbParts
+	}
+	return nil
+}
+
+func (x *Policy) GetRequiredPlatformInfo() uint64 {
+	if x != nil {
+		return x.RequiredPlatformInfo
+	}
+	return 0
+}
+
+func (x *Policy) GetForbiddenPlatformInfo() uint64 {
+	if x != nil {
+		return x.ForbiddenPlatformInfo
+	}
+	return 0
+}
+
+func (x *Policy) GetMaximumVmpl() *wrapperspb.UInt32Value {
+	if x != nil {
+		return x.MaximumVmpl
+	}
+	return nil
+}
+
+func (x *Policy) GetFamilyIdPatterns() []string {
+	if x != nil {
+		return x.FamilyIdPatterns
+	}
+	return nil
+}
+
+func (x *Policy) GetImageIdPatterns() []string {
+	if x != nil {
+		return x.ImageIdPatterns
+	}
+	return nil
+}
+
+func (x *Policy) GetHostDataPatterns() []string {
+	if x != nil {
+		return x.HostDataPatterns
+	}
+	return nil
+}
+
+func (x *Policy) GetMinimumCommittedTcb() uint64 {
+	if x != nil {
+		return x.MinimumCommittedTcb
+	}
+	return 0
+}
+
+func (x *Policy) GetMinimumCommittedTcbParts() *sevsnp.TcbParts {
+	if x != nil {
+		return x.MinimumCommittedTcbParts
+	}
+	return nil
+}
+
+func (x *Policy) GetTcbRelations() []string {
+	if x != nil {
+		return x.TcbRelations
+	}
+	return nil
+}
+
+func (x *Policy) GetTcbOrdering() TCBOrdering {
+	if x != nil {
+		return x.TcbOrdering
+	}
+	return TCBOrdering_TCB_ORDERING_UNCHECKED
+}
+
+func (x *Policy) GetRequireConsistentSmt() bool {
+	if x != nil {
+		return x.RequireConsistentSmt
+	}
+	return false
+}
+
+func (x *Policy) GetChipIds() [][]byte {
+	if x != nil {
+		return x.ChipIds
+	}
+	return nil
+}
+
+func (x *Policy) GetSigningKey() SigningKey {
+	if x != nil {
+		return x.SigningKey
+	}
+	return SigningKey_SIGNING_KEY_UNCHECKED
+}
+
 // RootOfTrust represents configuration for which hardware root of trust
 // certificates to use for verifying attestation report signatures.
 type RootOfTrust struct {
@@ -390,6 +674,10 @@ type Config struct {
 	RootOfTrust *RootOfTrust `protobuf:"bytes,1,opt,name=root_of_trust,json=rootOfTrust,proto3" json:"root_of_trust,omitempty"`
 	// The report validation policy.
 	Policy *Policy `protobuf:"bytes,2,opt,name=policy,proto3" json:"policy,omitempty"`
+	// The version of the Config schema that the message was written for. 0 is
+	// the unversioned schema that predates versioning. Upgrade older configs
+	// with validate/migrate.
+	SchemaVersion uint32 `protobuf:"varint,3,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
 }
 
 func (x *Config) Reset() {
@@ -438,6 +726,168 @@ func (x *Config) GetPolicy() *Policy {
 	return nil
 }
 
+func (x *Config) GetSchemaVersion() uint32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+// CheckRequest asks the check tool's service to verify and validate an
+// attestation with the policy that the service was started with.
+type CheckRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Evidence:
+	//	*CheckRequest_Attestation
+	//	*CheckRequest_Bundle
+	Evidence isCheckRequest_Evidence `protobuf_oneof:"evidence"`
+}
+
+func (x *CheckRequest) Reset() {
+	*x = CheckRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_check_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CheckRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckRequest) ProtoMessage() {}
+
+func (x *CheckRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_check_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckRequest.ProtoReflect.Descriptor instead.
+func (*CheckRequest) Descriptor() ([]byte, []int) {
+	return file_check_proto_rawDescGZIP(), []int{3}
+}
+
+func (m *CheckRequest) GetEvidence() isCheckRequest_Evidence {
+	if m != nil {
+		return m.Evidence
+	}
+	return nil
+}
+
+func (x *CheckRequest) GetAttestation() *sevsnp.Attestation {
+	if x, ok := x.GetEvidence().(*CheckRequest_Attestation); ok {
+		return x.Attestation
+	}
+	return nil
+}
+
+func (x *CheckRequest) GetBundle() []byte {
+	if x, ok := x.GetEvidence().(*CheckRequest_Bundle); ok {
+		return x.Bundle
+	}
+	return nil
+}
+
+type isCheckRequest_Evidence interface {
+	isCheckRequest_Evidence()
+}
+
+type CheckRequest_Attestation struct {
+	// The attestation to check. Certificates that its chain lacks are fetched
+	// or taken from the service's certificate store.
+	Attestation *sevsnp.Attestation `protobuf:"bytes,1,opt,name=attestation,proto3,oneof"`
+}
+
+type CheckRequest_Bundle struct {
+	// A verify.Bundle archive to check offline with only its own certificates
+	// and CRL.
+	Bundle []byte `protobuf:"bytes,2,opt,name=bundle,proto3,oneof"`
+}
+
+func (*CheckRequest_Attestation) isCheckRequest_Evidence() {}
+
+func (*CheckRequest_Bundle) isCheckRequest_Evidence() {}
+
+// CheckResponse is the outcome of a CheckRequest.
+type CheckResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// One of "pass", "fail" for an attestation that did not verify or validate,
+	// or "error" when the service could not check the attestation.
+	Result string `protobuf:"bytes,1,opt,name=result,proto3" json:"result,omitempty"`
+	// The exit code that the check tool would have exited with for the
+	// attestation.
+	ExitCode int32 `protobuf:"varint,2,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	// Why the attestation did not pass.
+	Error string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *CheckResponse) Reset() {
+	*x = CheckResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_check_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CheckResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckResponse) ProtoMessage() {}
+
+func (x *CheckResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_check_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckResponse.ProtoReflect.Descriptor instead.
+func (*CheckResponse) Descriptor() ([]byte, []int) {
+	return file_check_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CheckResponse) GetResult() string {
+	if x != nil {
+		return x.Result
+	}
+	return ""
+}
+
+func (x *CheckResponse) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+func (x *CheckResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 var File_check_proto protoreflect.FileDescriptor
 
 var file_check_proto_rawDesc = []byte{
@@ -445,7 +895,7 @@ var file_check_proto_rawDesc = []byte{
 	0x68, 0x65, 0x63, 0x6b, 0x1a, 0x1e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f,
 	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x77, 0x72, 0x61, 0x70, 0x70, 0x65, 0x72, 0x73, 0x2e, 0x70,
 	0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x0c, 0x73, 0x65, 0x76, 0x73, 0x6e, 0x70, 0x2e, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x22, 0xda, 0x07, 0x0a, 0x06, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x2a, 0x0a,
+	0x74, 0x6f, 0x22, 0xe0, 0x0e, 0x0a, 0x06, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x2a, 0x0a,
 	0x11, 0x6d, 0x69, 0x6e, 0x69, 0x6d, 0x75, 0x6d, 0x5f, 0x67, 0x75, 0x65, 0x73, 0x74, 0x5f, 0x73,
 	0x76, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0f, 0x6d, 0x69, 0x6e, 0x69, 0x6d, 0x75,
 	0x6d, 0x47, 0x75, 0x65, 0x73, 0x74, 0x53, 0x76, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x6f, 0x6c,
@@ -506,31 +956,121 @@ var file_check_proto_rawDesc = []byte{
 	0x72, 0x75, 0x73, 0x74, 0x65, 0x64, 0x49, 0x64, 0x4b, 0x65, 0x79, 0x48, 0x61, 0x73, 0x68, 0x65,
 	0x73, 0x12, 0x2c, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x18, 0x18, 0x20, 0x01,
 	0x28, 0x0b, 0x32, 0x12, 0x2e, 0x73, 0x65, 0x76, 0x73, 0x6e, 0x70, 0x2e, 0x53, 0x65, 0x76, 0x50,
-	0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x22,
-	0xdb, 0x01, 0x0a, 0x0b, 0x52, 0x6f, 0x6f, 0x74, 0x4f, 0x66, 0x54, 0x72, 0x75, 0x73, 0x74, 0x12,
-	0x1c, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
-	0x42, 0x02, 0x18, 0x01, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x12, 0x25, 0x0a,
-	0x0e, 0x63, 0x61, 0x62, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x73, 0x18,
-	0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x61, 0x62, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x50,
-	0x61, 0x74, 0x68, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x63, 0x61, 0x62, 0x75, 0x6e, 0x64, 0x6c, 0x65,
-	0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x63, 0x61, 0x62, 0x75, 0x6e, 0x64, 0x6c,
-	0x65, 0x73, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x5f, 0x63, 0x72, 0x6c, 0x18,
-	0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x43, 0x72, 0x6c, 0x12,
-	0x29, 0x0a, 0x10, 0x64, 0x69, 0x73, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x5f, 0x6e, 0x65, 0x74, 0x77,
-	0x6f, 0x72, 0x6b, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0f, 0x64, 0x69, 0x73, 0x61, 0x6c,
-	0x6c, 0x6f, 0x77, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x12, 0x21, 0x0a, 0x0c, 0x70, 0x72,
-	0x6f, 0x64, 0x75, 0x63, 0x74, 0x5f, 0x6c, 0x69, 0x6e, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x0b, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x4c, 0x69, 0x6e, 0x65, 0x22, 0x67, 0x0a,
-	0x06, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x36, 0x0a, 0x0d, 0x72, 0x6f, 0x6f, 0x74, 0x5f,
-	0x6f, 0x66, 0x5f, 0x74, 0x72, 0x75, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12,
-	0x2e, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x2e, 0x52, 0x6f, 0x6f, 0x74, 0x4f, 0x66, 0x54, 0x72, 0x75,
-	0x73, 0x74, 0x52, 0x0b, 0x72, 0x6f, 0x6f, 0x74, 0x4f, 0x66, 0x54, 0x72, 0x75, 0x73, 0x74, 0x12,
-	0x25, 0x0a, 0x06, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32,
-	0x0d, 0x2e, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x2e, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x06,
-	0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x42, 0x2c, 0x5a, 0x2a, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62,
-	0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x67, 0x6f, 0x2d, 0x73,
-	0x65, 0x76, 0x2d, 0x67, 0x75, 0x65, 0x73, 0x74, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x63,
-	0x68, 0x65, 0x63, 0x6b, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x12,
+	0x22, 0x0a, 0x0c, 0x6d, 0x65, 0x61, 0x73, 0x75, 0x72, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x18,
+	0x19, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x0c, 0x6d, 0x65, 0x61, 0x73, 0x75, 0x72, 0x65, 0x6d, 0x65,
+	0x6e, 0x74, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x66, 0x61, 0x6d, 0x69, 0x6c, 0x79, 0x5f, 0x69, 0x64,
+	0x73, 0x18, 0x1a, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x09, 0x66, 0x61, 0x6d, 0x69, 0x6c, 0x79, 0x49,
+	0x64, 0x73, 0x12, 0x1b, 0x0a, 0x09, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x69, 0x64, 0x73, 0x18,
+	0x1b, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x08, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x49, 0x64, 0x73, 0x12,
+	0x3c, 0x0a, 0x11, 0x6d, 0x69, 0x6e, 0x69, 0x6d, 0x75, 0x6d, 0x5f, 0x74, 0x63, 0x62, 0x5f, 0x70,
+	0x61, 0x72, 0x74, 0x73, 0x18, 0x1c, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x73, 0x65, 0x76,
+	0x73, 0x6e, 0x70, 0x2e, 0x54, 0x63, 0x62, 0x50, 0x61, 0x72, 0x74, 0x73, 0x52, 0x0f, 0x6d, 0x69,
+	0x6e, 0x69, 0x6d, 0x75, 0x6d, 0x54, 0x63, 0x62, 0x50, 0x61, 0x72, 0x74, 0x73, 0x12, 0x49, 0x0a,
+	0x18, 0x6d, 0x69, 0x6e, 0x69, 0x6d, 0x75, 0x6d, 0x5f, 0x6c, 0x61, 0x75, 0x6e, 0x63, 0x68, 0x5f,
+	0x74, 0x63, 0x62, 0x5f, 0x70, 0x61, 0x72, 0x74, 0x73, 0x18, 0x1d, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x10, 0x2e, 0x73, 0x65, 0x76, 0x73, 0x6e, 0x70, 0x2e, 0x54, 0x63, 0x62, 0x50, 0x61, 0x72, 0x74,
+	0x73, 0x52, 0x15, 0x6d, 0x69, 0x6e, 0x69, 0x6d, 0x75, 0x6d, 0x4c, 0x61, 0x75, 0x6e, 0x63, 0x68,
+	0x54, 0x63, 0x62, 0x50, 0x61, 0x72, 0x74, 0x73, 0x12, 0x34, 0x0a, 0x16, 0x72, 0x65, 0x71, 0x75,
+	0x69, 0x72, 0x65, 0x64, 0x5f, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x5f, 0x69, 0x6e,
+	0x66, 0x6f, 0x18, 0x1e, 0x20, 0x01, 0x28, 0x04, 0x52, 0x14, 0x72, 0x65, 0x71, 0x75, 0x69, 0x72,
+	0x65, 0x64, 0x50, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x36,
+	0x0a, 0x17, 0x66, 0x6f, 0x72, 0x62, 0x69, 0x64, 0x64, 0x65, 0x6e, 0x5f, 0x70, 0x6c, 0x61, 0x74,
+	0x66, 0x6f, 0x72, 0x6d, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x1f, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x15, 0x66, 0x6f, 0x72, 0x62, 0x69, 0x64, 0x64, 0x65, 0x6e, 0x50, 0x6c, 0x61, 0x74, 0x66, 0x6f,
+	0x72, 0x6d, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x3f, 0x0a, 0x0c, 0x6d, 0x61, 0x78, 0x69, 0x6d, 0x75,
+	0x6d, 0x5f, 0x76, 0x6d, 0x70, 0x6c, 0x18, 0x20, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x55,
+	0x49, 0x6e, 0x74, 0x33, 0x32, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x0b, 0x6d, 0x61, 0x78, 0x69,
+	0x6d, 0x75, 0x6d, 0x56, 0x6d, 0x70, 0x6c, 0x12, 0x2c, 0x0a, 0x12, 0x66, 0x61, 0x6d, 0x69, 0x6c,
+	0x79, 0x5f, 0x69, 0x64, 0x5f, 0x70, 0x61, 0x74, 0x74, 0x65, 0x72, 0x6e, 0x73, 0x18, 0x21, 0x20,
+	0x03, 0x28, 0x09, 0x52, 0x10, 0x66, 0x61, 0x6d, 0x69, 0x6c, 0x79, 0x49, 0x64, 0x50, 0x61, 0x74,
+	0x74, 0x65, 0x72, 0x6e, 0x73, 0x12, 0x2a, 0x0a, 0x11, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x69,
+	0x64, 0x5f, 0x70, 0x61, 0x74, 0x74, 0x65, 0x72, 0x6e, 0x73, 0x18, 0x22, 0x20, 0x03, 0x28, 0x09,
+	0x52, 0x0f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x49, 0x64, 0x50, 0x61, 0x74, 0x74, 0x65, 0x72, 0x6e,
+	0x73, 0x12, 0x2c, 0x0a, 0x12, 0x68, 0x6f, 0x73, 0x74, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x5f, 0x70,
+	0x61, 0x74, 0x74, 0x65, 0x72, 0x6e, 0x73, 0x18, 0x23, 0x20, 0x03, 0x28, 0x09, 0x52, 0x10, 0x68,
+	0x6f, 0x73, 0x74, 0x44, 0x61, 0x74, 0x61, 0x50, 0x61, 0x74, 0x74, 0x65, 0x72, 0x6e, 0x73, 0x12,
+	0x32, 0x0a, 0x15, 0x6d, 0x69, 0x6e, 0x69, 0x6d, 0x75, 0x6d, 0x5f, 0x63, 0x6f, 0x6d, 0x6d, 0x69,
+	0x74, 0x74, 0x65, 0x64, 0x5f, 0x74, 0x63, 0x62, 0x18, 0x24, 0x20, 0x01, 0x28, 0x04, 0x52, 0x13,
+	0x6d, 0x69, 0x6e, 0x69, 0x6d, 0x75, 0x6d, 0x43, 0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x74, 0x65, 0x64,
+	0x54, 0x63, 0x62, 0x12, 0x4f, 0x0a, 0x1b, 0x6d, 0x69, 0x6e, 0x69, 0x6d, 0x75, 0x6d, 0x5f, 0x63,
+	0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x74, 0x65, 0x64, 0x5f, 0x74, 0x63, 0x62, 0x5f, 0x70, 0x61, 0x72,
+	0x74, 0x73, 0x18, 0x25, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x73, 0x65, 0x76, 0x73, 0x6e,
+	0x70, 0x2e, 0x54, 0x63, 0x62, 0x50, 0x61, 0x72, 0x74, 0x73, 0x52, 0x18, 0x6d, 0x69, 0x6e, 0x69,
+	0x6d, 0x75, 0x6d, 0x43, 0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x74, 0x65, 0x64, 0x54, 0x63, 0x62, 0x50,
+	0x61, 0x72, 0x74, 0x73, 0x12, 0x23, 0x0a, 0x0d, 0x74, 0x63, 0x62, 0x5f, 0x72, 0x65, 0x6c, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x26, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0c, 0x74, 0x63, 0x62,
+	0x52, 0x65, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x35, 0x0a, 0x0c, 0x74, 0x63, 0x62,
+	0x5f, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x69, 0x6e, 0x67, 0x18, 0x27, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x12, 0x2e, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x2e, 0x54, 0x43, 0x42, 0x4f, 0x72, 0x64, 0x65, 0x72,
+	0x69, 0x6e, 0x67, 0x52, 0x0b, 0x74, 0x63, 0x62, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x69, 0x6e, 0x67,
+	0x12, 0x34, 0x0a, 0x16, 0x72, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65, 0x5f, 0x63, 0x6f, 0x6e, 0x73,
+	0x69, 0x73, 0x74, 0x65, 0x6e, 0x74, 0x5f, 0x73, 0x6d, 0x74, 0x18, 0x28, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x14, 0x72, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65, 0x43, 0x6f, 0x6e, 0x73, 0x69, 0x73, 0x74,
+	0x65, 0x6e, 0x74, 0x53, 0x6d, 0x74, 0x12, 0x19, 0x0a, 0x08, 0x63, 0x68, 0x69, 0x70, 0x5f, 0x69,
+	0x64, 0x73, 0x18, 0x29, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x07, 0x63, 0x68, 0x69, 0x70, 0x49, 0x64,
+	0x73, 0x12, 0x32, 0x0a, 0x0b, 0x73, 0x69, 0x67, 0x6e, 0x69, 0x6e, 0x67, 0x5f, 0x6b, 0x65, 0x79,
+	0x18, 0x2a, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x11, 0x2e, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x2e, 0x53,
+	0x69, 0x67, 0x6e, 0x69, 0x6e, 0x67, 0x4b, 0x65, 0x79, 0x52, 0x0a, 0x73, 0x69, 0x67, 0x6e, 0x69,
+	0x6e, 0x67, 0x4b, 0x65, 0x79, 0x22, 0xdb, 0x01, 0x0a, 0x0b, 0x52, 0x6f, 0x6f, 0x74, 0x4f, 0x66,
+	0x54, 0x72, 0x75, 0x73, 0x74, 0x12, 0x1c, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x42, 0x02, 0x18, 0x01, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x64,
+	0x75, 0x63, 0x74, 0x12, 0x25, 0x0a, 0x0e, 0x63, 0x61, 0x62, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x5f,
+	0x70, 0x61, 0x74, 0x68, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x61, 0x62,
+	0x75, 0x6e, 0x64, 0x6c, 0x65, 0x50, 0x61, 0x74, 0x68, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x63, 0x61,
+	0x62, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x63,
+	0x61, 0x62, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x73, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x68, 0x65, 0x63,
+	0x6b, 0x5f, 0x63, 0x72, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x63, 0x68, 0x65,
+	0x63, 0x6b, 0x43, 0x72, 0x6c, 0x12, 0x29, 0x0a, 0x10, 0x64, 0x69, 0x73, 0x61, 0x6c, 0x6c, 0x6f,
+	0x77, 0x5f, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x0f, 0x64, 0x69, 0x73, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b,
+	0x12, 0x21, 0x0a, 0x0c, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x5f, 0x6c, 0x69, 0x6e, 0x65,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x4c,
+	0x69, 0x6e, 0x65, 0x22, 0x8e, 0x01, 0x0a, 0x06, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x36,
+	0x0a, 0x0d, 0x72, 0x6f, 0x6f, 0x74, 0x5f, 0x6f, 0x66, 0x5f, 0x74, 0x72, 0x75, 0x73, 0x74, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x2e, 0x52, 0x6f,
+	0x6f, 0x74, 0x4f, 0x66, 0x54, 0x72, 0x75, 0x73, 0x74, 0x52, 0x0b, 0x72, 0x6f, 0x6f, 0x74, 0x4f,
+	0x66, 0x54, 0x72, 0x75, 0x73, 0x74, 0x12, 0x25, 0x0a, 0x06, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0d, 0x2e, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x2e, 0x50,
+	0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x06, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x25, 0x0a,
+	0x0e, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0d, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x56, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x22, 0x6d, 0x0a, 0x0c, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x37, 0x0a, 0x0b, 0x61, 0x74, 0x74, 0x65, 0x73, 0x74, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x73, 0x65, 0x76, 0x73,
+	0x6e, 0x70, 0x2e, 0x41, 0x74, 0x74, 0x65, 0x73, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x48, 0x00,
+	0x52, 0x0b, 0x61, 0x74, 0x74, 0x65, 0x73, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a,
+	0x06, 0x62, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52,
+	0x06, 0x62, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x42, 0x0a, 0x0a, 0x08, 0x65, 0x76, 0x69, 0x64, 0x65,
+	0x6e, 0x63, 0x65, 0x22, 0x5a, 0x0a, 0x0d, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x1b, 0x0a, 0x09,
+	0x65, 0x78, 0x69, 0x74, 0x5f, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x08, 0x65, 0x78, 0x69, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72,
+	0x6f, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x2a,
+	0x86, 0x01, 0x0a, 0x0b, 0x54, 0x43, 0x42, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x69, 0x6e, 0x67, 0x12,
+	0x1a, 0x0a, 0x16, 0x54, 0x43, 0x42, 0x5f, 0x4f, 0x52, 0x44, 0x45, 0x52, 0x49, 0x4e, 0x47, 0x5f,
+	0x55, 0x4e, 0x43, 0x48, 0x45, 0x43, 0x4b, 0x45, 0x44, 0x10, 0x00, 0x12, 0x1a, 0x0a, 0x16, 0x54,
+	0x43, 0x42, 0x5f, 0x4f, 0x52, 0x44, 0x45, 0x52, 0x49, 0x4e, 0x47, 0x5f, 0x4d, 0x4f, 0x4e, 0x4f,
+	0x54, 0x4f, 0x4e, 0x49, 0x43, 0x10, 0x01, 0x12, 0x27, 0x0a, 0x23, 0x54, 0x43, 0x42, 0x5f, 0x4f,
+	0x52, 0x44, 0x45, 0x52, 0x49, 0x4e, 0x47, 0x5f, 0x4c, 0x41, 0x55, 0x4e, 0x43, 0x48, 0x5f, 0x45,
+	0x51, 0x55, 0x41, 0x4c, 0x53, 0x5f, 0x52, 0x45, 0x50, 0x4f, 0x52, 0x54, 0x45, 0x44, 0x10, 0x02,
+	0x12, 0x16, 0x0a, 0x12, 0x54, 0x43, 0x42, 0x5f, 0x4f, 0x52, 0x44, 0x45, 0x52, 0x49, 0x4e, 0x47,
+	0x5f, 0x45, 0x51, 0x55, 0x41, 0x4c, 0x10, 0x03, 0x2a, 0x53, 0x0a, 0x0a, 0x53, 0x69, 0x67, 0x6e,
+	0x69, 0x6e, 0x67, 0x4b, 0x65, 0x79, 0x12, 0x19, 0x0a, 0x15, 0x53, 0x49, 0x47, 0x4e, 0x49, 0x4e,
+	0x47, 0x5f, 0x4b, 0x45, 0x59, 0x5f, 0x55, 0x4e, 0x43, 0x48, 0x45, 0x43, 0x4b, 0x45, 0x44, 0x10,
+	0x00, 0x12, 0x14, 0x0a, 0x10, 0x53, 0x49, 0x47, 0x4e, 0x49, 0x4e, 0x47, 0x5f, 0x4b, 0x45, 0x59,
+	0x5f, 0x56, 0x43, 0x45, 0x4b, 0x10, 0x01, 0x12, 0x14, 0x0a, 0x10, 0x53, 0x49, 0x47, 0x4e, 0x49,
+	0x4e, 0x47, 0x5f, 0x4b, 0x45, 0x59, 0x5f, 0x56, 0x4c, 0x45, 0x4b, 0x10, 0x02, 0x32, 0x3d, 0x0a,
+	0x07, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x72, 0x12, 0x32, 0x0a, 0x05, 0x43, 0x68, 0x65, 0x63,
+	0x6b, 0x12, 0x13, 0x2e, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x2e, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x2e, 0x43,
+	0x68, 0x65, 0x63, 0x6b, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x2c, 0x5a, 0x2a,
+	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2f, 0x67, 0x6f, 0x2d, 0x73, 0x65, 0x76, 0x2d, 0x67, 0x75, 0x65, 0x73, 0x74, 0x2f, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
 }
 
 var (
@@ -545,26 +1085,42 @@ func file_check_proto_rawDescGZIP() []byte {
 	return file_check_proto_rawDescData
 }
 
-var file_check_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_check_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_check_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
 var file_check_proto_goTypes = []interface{}{
-	(*Policy)(nil),                 // 0: check.Policy
-	(*RootOfTrust)(nil),            // 1: check.RootOfTrust
-	(*Config)(nil),                 // 2: check.Config
-	(*wrapperspb.UInt32Value)(nil), // 3: google.protobuf.UInt32Value
-	(*wrapperspb.UInt64Value)(nil), // 4: google.protobuf.UInt64Value
-	(*sevsnp.SevProduct)(nil),      // 5: sevsnp.SevProduct
+	(TCBOrdering)(0),               // 0: check.TCBOrdering
+	(SigningKey)(0),                // 1: check.SigningKey
+	(*Policy)(nil),                 // 2: check.Policy
+	(*RootOfTrust)(nil),            // 3: check.RootOfTrust
+	(*Config)(nil),                 // 4: check.Config
+	(*CheckRequest)(nil),           // 5: check.CheckRequest
+	(*CheckResponse)(nil),          // 6: check.CheckResponse
+	(*wrapperspb.UInt32Value)(nil), // 7: google.protobuf.UInt32Value
+	(*wrapperspb.UInt64Value)(nil), // 8: google.protobuf.UInt64Value
+	(*sevsnp.SevProduct)(nil),      // 9: sevsnp.SevProduct
+	(*sevsnp.TcbParts)(nil),        // 10: sevsnp.TcbParts
+	(*sevsnp.Attestation)(nil),     // 11: sevsnp.Attestation
 }
 var file_check_proto_depIdxs = []int32{
-	3, // 0: check.Policy.vmpl:type_name -> google.protobuf.UInt32Value
-	4, // 1: check.Policy.platform_info:type_name -> google.protobuf.UInt64Value
-	5, // 2: check.Policy.product:type_name -> sevsnp.SevProduct
-	1, // 3: check.Config.root_of_trust:type_name -> check.RootOfTrust
-	0, // 4: check.Config.policy:type_name -> check.Policy
-	5, // [5:5] is the sub-list for method output_type
-	5, // [5:5] is the sub-list for method input_type
-	5, // [5:5] is the sub-list for extension type_name
-	5, // [5:5] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+	7,  // 0: check.Policy.vmpl:type_name -> google.protobuf.UInt32Value
+	8,  // 1: check.Policy.platform_info:type_name -> google.protobuf.UInt64Value
+	9,  // 2: check.Policy.product:type_name -> sevsnp.SevProduct
+	10, // 3: check.Policy.minimum_tcb_parts:type_name -> sevsnp.TcbParts
+	10, // 4: check.Policy.minimum_launch_tcb_parts:type_name -> sevsnp.TcbParts
+	7,  // 5: check.Policy.maximum_vmpl:type_name -> google.protobuf.UInt32Value
+	10, // 6: check.Policy.minimum_committed_tcb_parts:type_name -> sevsnp.TcbParts
+	0,  // 7: check.Policy.tcb_ordering:type_name -> check.TCBOrdering
+	1,  // 8: check.Policy.signing_key:type_name -> check.SigningKey
+	3,  // 9: check.Config.root_of_trust:type_name -> check.RootOfTrust
+	2,  // 10: check.Config.policy:type_name -> check.Policy
+	11, // 11: check.CheckRequest.attestation:type_name -> sevsnp.Attestation
+	5,  // 12: check.Checker.Check:input_type -> check.CheckRequest
+	6,  // 13: check.Checker.Check:output_type -> check.CheckResponse
+	13, // [13:14] is the sub-list for method output_type
+	12, // [12:13] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
 }
 
 func init() { file_check_proto_init() }
@@ -609,19 +1165,48 @@ func file_check_proto_init() {
 				return nil
 			}
 		}
+		file_check_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CheckRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_check_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CheckResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_check_proto_msgTypes[3].OneofWrappers = []interface{}{
+		(*CheckRequest_Attestation)(nil),
+		(*CheckRequest_Bundle)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_check_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   3,
+			NumEnums:      2,
+			NumMessages:   5,
 			NumExtensions: 0,
-			NumServices:   0,
+			NumServices:   1,
 		},
 		GoTypes:           file_check_proto_goTypes,
 		DependencyIndexes: file_check_proto_depIdxs,
+		EnumInfos:         file_check_proto_enumTypes,
 		MessageInfos:      file_check_proto_msgTypes,
 	}.Build()
 	File_check_proto = out.File
@@ -30,9 +30,11 @@
 // To generate the Go code, your system must have "protoc" installed. See:
 // https://github.com/protocolbuffers/protobuf#protocol-compiler-installation
 //
-// The "protoc-gen-go" tool must also be installed. To install it, run:
+// The "protoc-gen-go" tool must also be installed, and "protoc-gen-go-grpc" for
+// the check.Checker service. To install them, run:
 //
 //	go install google.golang.org/protobuf/cmd/protoc-gen-go
+//	go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.3.0
 //
 // If you see a 'protoc-gen-go: program not found or is not executable' error
 // for the 'go generate' command, run the following:
@@ -46,6 +48,6 @@
 // include subdirectory.
 package proto
 
-//go:generate protoc -I$PROTOC_INSTALL_DIR/include -I=. --go_out=. --go_opt=module=github.com/google/go-sev-guest/proto check.proto
+//go:generate protoc -I$PROTOC_INSTALL_DIR/include -I=. --go_out=. --go_opt=module=github.com/google/go-sev-guest/proto --go-grpc_out=. --go-grpc_opt=module=github.com/google/go-sev-guest/proto check.proto
 //go:generate protoc --go_out=. --go_opt=module=github.com/google/go-sev-guest/proto fakekds.proto
 //go:generate protoc --go_out=. --go_opt=module=github.com/google/go-sev-guest/proto sevsnp.proto
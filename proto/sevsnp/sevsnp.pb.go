@@ -613,6 +613,205 @@ func (x *Attestation) GetProduct() *SevProduct {
 	return nil
 }
 
+// TcbParts is a TCB_VERSION by its security patch level (SPL) components in
+// the TCB layout of product, so that consumers need not decode the packed
+// 64-bit value themselves.
+type TcbParts struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The product whose TCB layout the components follow. Turin and later have
+	// an FMC component and no Spl7 component. Unknown products have the Milan
+	// and Genoa layout.
+	Product  SevProduct_SevProductName `protobuf:"varint,1,opt,name=product,proto3,enum=sevsnp.SevProduct_SevProductName" json:"product,omitempty"`
+	BlSpl    uint32                    `protobuf:"varint,2,opt,name=bl_spl,json=blSpl,proto3" json:"bl_spl,omitempty"`
+	TeeSpl   uint32                    `protobuf:"varint,3,opt,name=tee_spl,json=teeSpl,proto3" json:"tee_spl,omitempty"`
+	SnpSpl   uint32                    `protobuf:"varint,4,opt,name=snp_spl,json=snpSpl,proto3" json:"snp_spl,omitempty"`
+	UcodeSpl uint32                    `protobuf:"varint,5,opt,name=ucode_spl,json=ucodeSpl,proto3" json:"ucode_spl,omitempty"`
+	// Only Turin and later have an FMC component.
+	FmcSpl uint32 `protobuf:"varint,6,opt,name=fmc_spl,json=fmcSpl,proto3" json:"fmc_spl,omitempty"`
+	// Reserved components.
+	Spl4 uint32 `protobuf:"varint,7,opt,name=spl4,proto3" json:"spl4,omitempty"`
+	Spl5 uint32 `protobuf:"varint,8,opt,name=spl5,proto3" json:"spl5,omitempty"`
+	Spl6 uint32 `protobuf:"varint,9,opt,name=spl6,proto3" json:"spl6,omitempty"`
+	Spl7 uint32 `protobuf:"varint,10,opt,name=spl7,proto3" json:"spl7,omitempty"`
+}
+
+func (x *TcbParts) Reset() {
+	*x = TcbParts{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sevsnp_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TcbParts) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TcbParts) ProtoMessage() {}
+
+func (x *TcbParts) ProtoReflect() protoreflect.Message {
+	mi := &file_sevsnp_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TcbParts.ProtoReflect.Descriptor instead.
+func (*TcbParts) Descriptor() ([]byte, []int) {
+	return file_sevsnp_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TcbParts) GetProduct() SevProduct_SevProductName {
+	if x != nil {
+		return x.Product
+	}
+	return SevProduct_SEV_PRODUCT_UNKNOWN
+}
+
+func (x *TcbParts) GetBlSpl() uint32 {
+	if x != nil {
+		return x.BlSpl
+	}
+	return 0
+}
+
+func (x *TcbParts) GetTeeSpl() uint32 {
+	if x != nil {
+		return x.TeeSpl
+	}
+	return 0
+}
+
+func (x *TcbParts) GetSnpSpl() uint32 {
+	if x != nil {
+		return x.SnpSpl
+	}
+	return 0
+}
+
+func (x *TcbParts) GetUcodeSpl() uint32 {
+	if x != nil {
+		return x.UcodeSpl
+	}
+	return 0
+}
+
+func (x *TcbParts) GetFmcSpl() uint32 {
+	if x != nil {
+		return x.FmcSpl
+	}
+	return 0
+}
+
+func (x *TcbParts) GetSpl4() uint32 {
+	if x != nil {
+		return x.Spl4
+	}
+	return 0
+}
+
+func (x *TcbParts) GetSpl5() uint32 {
+	if x != nil {
+		return x.Spl5
+	}
+	return 0
+}
+
+func (x *TcbParts) GetSpl6() uint32 {
+	if x != nil {
+		return x.Spl6
+	}
+	return 0
+}
+
+func (x *TcbParts) GetSpl7() uint32 {
+	if x != nil {
+		return x.Spl7
+	}
+	return 0
+}
+
+// ReportTcbs is the TCB_VERSION fields of a report by their components.
+type ReportTcbs struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	CurrentTcb   *TcbParts `protobuf:"bytes,1,opt,name=current_tcb,json=currentTcb,proto3" json:"current_tcb,omitempty"`
+	ReportedTcb  *TcbParts `protobuf:"bytes,2,opt,name=reported_tcb,json=reportedTcb,proto3" json:"reported_tcb,omitempty"`
+	CommittedTcb *TcbParts `protobuf:"bytes,3,opt,name=committed_tcb,json=committedTcb,proto3" json:"committed_tcb,omitempty"`
+	LaunchTcb    *TcbParts `protobuf:"bytes,4,opt,name=launch_tcb,json=launchTcb,proto3" json:"launch_tcb,omitempty"`
+}
+
+func (x *ReportTcbs) Reset() {
+	*x = ReportTcbs{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_sevsnp_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReportTcbs) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportTcbs) ProtoMessage() {}
+
+func (x *ReportTcbs) ProtoReflect() protoreflect.Message {
+	mi := &file_sevsnp_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportTcbs.ProtoReflect.Descriptor instead.
+func (*ReportTcbs) Descriptor() ([]byte, []int) {
+	return file_sevsnp_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ReportTcbs) GetCurrentTcb() *TcbParts {
+	if x != nil {
+		return x.CurrentTcb
+	}
+	return nil
+}
+
+func (x *ReportTcbs) GetReportedTcb() *TcbParts {
+	if x != nil {
+		return x.ReportedTcb
+	}
+	return nil
+}
+
+func (x *ReportTcbs) GetCommittedTcb() *TcbParts {
+	if x != nil {
+		return x.CommittedTcb
+	}
+	return nil
+}
+
+func (x *ReportTcbs) GetLaunchTcb() *TcbParts {
+	if x != nil {
+		return x.LaunchTcb
+	}
+	return nil
+}
+
 var File_sevsnp_proto protoreflect.FileDescriptor
 
 var file_sevsnp_proto_rawDesc = []byte{
@@ -733,10 +932,42 @@ var file_sevsnp_proto_rawDesc = []byte{
 	0x43, 0x68, 0x61, 0x69, 0x6e, 0x12, 0x2c, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74,
 	0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x73, 0x65, 0x76, 0x73, 0x6e, 0x70, 0x2e,
 	0x53, 0x65, 0x76, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x64,
-	0x75, 0x63, 0x74, 0x42, 0x2d, 0x5a, 0x2b, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f,
-	0x6d, 0x2f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x67, 0x6f, 0x2d, 0x73, 0x65, 0x76, 0x2d,
-	0x67, 0x75, 0x65, 0x73, 0x74, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x73, 0x65, 0x76, 0x73,
-	0x6e, 0x70, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x75, 0x63, 0x74, 0x22, 0x96, 0x02, 0x0a, 0x08, 0x54, 0x63, 0x62, 0x50, 0x61, 0x72, 0x74, 0x73,
+	0x12, 0x3b, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0e, 0x32, 0x21, 0x2e, 0x73, 0x65, 0x76, 0x73, 0x6e, 0x70, 0x2e, 0x53, 0x65, 0x76, 0x50, 0x72,
+	0x6f, 0x64, 0x75, 0x63, 0x74, 0x2e, 0x53, 0x65, 0x76, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74,
+	0x4e, 0x61, 0x6d, 0x65, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x12, 0x15, 0x0a,
+	0x06, 0x62, 0x6c, 0x5f, 0x73, 0x70, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x62,
+	0x6c, 0x53, 0x70, 0x6c, 0x12, 0x17, 0x0a, 0x07, 0x74, 0x65, 0x65, 0x5f, 0x73, 0x70, 0x6c, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x74, 0x65, 0x65, 0x53, 0x70, 0x6c, 0x12, 0x17, 0x0a,
+	0x07, 0x73, 0x6e, 0x70, 0x5f, 0x73, 0x70, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06,
+	0x73, 0x6e, 0x70, 0x53, 0x70, 0x6c, 0x12, 0x1b, 0x0a, 0x09, 0x75, 0x63, 0x6f, 0x64, 0x65, 0x5f,
+	0x73, 0x70, 0x6c, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x75, 0x63, 0x6f, 0x64, 0x65,
+	0x53, 0x70, 0x6c, 0x12, 0x17, 0x0a, 0x07, 0x66, 0x6d, 0x63, 0x5f, 0x73, 0x70, 0x6c, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x66, 0x6d, 0x63, 0x53, 0x70, 0x6c, 0x12, 0x12, 0x0a, 0x04,
+	0x73, 0x70, 0x6c, 0x34, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x73, 0x70, 0x6c, 0x34,
+	0x12, 0x12, 0x0a, 0x04, 0x73, 0x70, 0x6c, 0x35, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04,
+	0x73, 0x70, 0x6c, 0x35, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x70, 0x6c, 0x36, 0x18, 0x09, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x04, 0x73, 0x70, 0x6c, 0x36, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x70, 0x6c, 0x37,
+	0x18, 0x0a, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x73, 0x70, 0x6c, 0x37, 0x22, 0xdc, 0x01, 0x0a,
+	0x0a, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x54, 0x63, 0x62, 0x73, 0x12, 0x31, 0x0a, 0x0b, 0x63,
+	0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x5f, 0x74, 0x63, 0x62, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x10, 0x2e, 0x73, 0x65, 0x76, 0x73, 0x6e, 0x70, 0x2e, 0x54, 0x63, 0x62, 0x50, 0x61, 0x72,
+	0x74, 0x73, 0x52, 0x0a, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x54, 0x63, 0x62, 0x12, 0x33,
+	0x0a, 0x0c, 0x72, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x65, 0x64, 0x5f, 0x74, 0x63, 0x62, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x73, 0x65, 0x76, 0x73, 0x6e, 0x70, 0x2e, 0x54, 0x63,
+	0x62, 0x50, 0x61, 0x72, 0x74, 0x73, 0x52, 0x0b, 0x72, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x65, 0x64,
+	0x54, 0x63, 0x62, 0x12, 0x35, 0x0a, 0x0d, 0x63, 0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x74, 0x65, 0x64,
+	0x5f, 0x74, 0x63, 0x62, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x73, 0x65, 0x76,
+	0x73, 0x6e, 0x70, 0x2e, 0x54, 0x63, 0x62, 0x50, 0x61, 0x72, 0x74, 0x73, 0x52, 0x0c, 0x63, 0x6f,
+	0x6d, 0x6d, 0x69, 0x74, 0x74, 0x65, 0x64, 0x54, 0x63, 0x62, 0x12, 0x2f, 0x0a, 0x0a, 0x6c, 0x61,
+	0x75, 0x6e, 0x63, 0x68, 0x5f, 0x74, 0x63, 0x62, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10,
+	0x2e, 0x73, 0x65, 0x76, 0x73, 0x6e, 0x70, 0x2e, 0x54, 0x63, 0x62, 0x50, 0x61, 0x72, 0x74, 0x73,
+	0x52, 0x09, 0x6c, 0x61, 0x75, 0x6e, 0x63, 0x68, 0x54, 0x63, 0x62, 0x42, 0x2d, 0x5a, 0x2b, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2f, 0x67, 0x6f, 0x2d, 0x73, 0x65, 0x76, 0x2d, 0x67, 0x75, 0x65, 0x73, 0x74, 0x2f, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x2f, 0x73, 0x65, 0x76, 0x73, 0x6e, 0x70, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
 }
 
 var (
@@ -752,28 +983,35 @@ func file_sevsnp_proto_rawDescGZIP() []byte {
 }
 
 var file_sevsnp_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_sevsnp_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_sevsnp_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_sevsnp_proto_goTypes = []interface{}{
 	(SevProduct_SevProductName)(0), // 0: sevsnp.SevProduct.SevProductName
 	(*Report)(nil),                 // 1: sevsnp.Report
 	(*CertificateChain)(nil),       // 2: sevsnp.CertificateChain
 	(*SevProduct)(nil),             // 3: sevsnp.SevProduct
 	(*Attestation)(nil),            // 4: sevsnp.Attestation
-	nil,                            // 5: sevsnp.CertificateChain.ExtrasEntry
-	(*wrapperspb.UInt32Value)(nil), // 6: google.protobuf.UInt32Value
+	(*TcbParts)(nil),               // 5: sevsnp.TcbParts
+	(*ReportTcbs)(nil),             // 6: sevsnp.ReportTcbs
+	nil,                            // 7: sevsnp.CertificateChain.ExtrasEntry
+	(*wrapperspb.UInt32Value)(nil), // 8: google.protobuf.UInt32Value
 }
 var file_sevsnp_proto_depIdxs = []int32{
-	5, // 0: sevsnp.CertificateChain.extras:type_name -> sevsnp.CertificateChain.ExtrasEntry
-	0, // 1: sevsnp.SevProduct.name:type_name -> sevsnp.SevProduct.SevProductName
-	6, // 2: sevsnp.SevProduct.machine_stepping:type_name -> google.protobuf.UInt32Value
-	1, // 3: sevsnp.Attestation.report:type_name -> sevsnp.Report
-	2, // 4: sevsnp.Attestation.certificate_chain:type_name -> sevsnp.CertificateChain
-	3, // 5: sevsnp.Attestation.product:type_name -> sevsnp.SevProduct
-	6, // [6:6] is the sub-list for method output_type
-	6, // [6:6] is the sub-list for method input_type
-	6, // [6:6] is the sub-list for extension type_name
-	6, // [6:6] is the sub-list for extension extendee
-	0, // [0:6] is the sub-list for field type_name
+	7,  // 0: sevsnp.CertificateChain.extras:type_name -> sevsnp.CertificateChain.ExtrasEntry
+	0,  // 1: sevsnp.SevProduct.name:type_name -> sevsnp.SevProduct.SevProductName
+	8,  // 2: sevsnp.SevProduct.machine_stepping:type_name -> google.protobuf.UInt32Value
+	1,  // 3: sevsnp.Attestation.report:type_name -> sevsnp.Report
+	2,  // 4: sevsnp.Attestation.certificate_chain:type_name -> sevsnp.CertificateChain
+	3,  // 5: sevsnp.Attestation.product:type_name -> sevsnp.SevProduct
+	0,  // 6: sevsnp.TcbParts.product:type_name -> sevsnp.SevProduct.SevProductName
+	5,  // 7: sevsnp.ReportTcbs.current_tcb:type_name -> sevsnp.TcbParts
+	5,  // 8: sevsnp.ReportTcbs.reported_tcb:type_name -> sevsnp.TcbParts
+	5,  // 9: sevsnp.ReportTcbs.committed_tcb:type_name -> sevsnp.TcbParts
+	5,  // 10: sevsnp.ReportTcbs.launch_tcb:type_name -> sevsnp.TcbParts
+	11, // [11:11] is the sub-list for method output_type
+	11, // [11:11] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
 }
 
 func init() { file_sevsnp_proto_init() }
@@ -830,6 +1068,30 @@ func file_sevsnp_proto_init() {
 				return nil
 			}
 		}
+		file_sevsnp_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TcbParts); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_sevsnp_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReportTcbs); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -837,7 +1099,7 @@ func file_sevsnp_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_sevsnp_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   5,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -129,11 +129,7 @@ var insecureRandomness = rand.New(rand.NewSource(0xc0de))
 // Sign takes a chunk of bytes, signs it with VcekPriv, and returns the R, S pair for the signature
 // in little endian format.
 func (s *AmdSigner) Sign(toSign []byte) (*big.Int, *big.Int, error) {
-	info, err := abi.ReportSignerInfo(toSign)
-	if err != nil {
-		return nil, nil, err
-	}
-	si, err := abi.ParseSignerInfo(info)
+	si, err := abi.ParseReportSignerInfo(toSign)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -418,6 +414,11 @@ func CustomExtensions(tcb kds.TCBParts, hwid []byte, cspid, productName string)
 		{Id: kds.OidSpl7, Value: spl7},
 		{Id: kds.OidUcodeSpl, Value: ucodeSpl},
 	}
+	// Turin and later certificates also certify the FMC security patch level.
+	if kds.ProductLineOfProductName(productName) == "Turin" {
+		fmcSpl, _ := asn1.Marshal(int(tcb.FmcSpl))
+		exts = append(exts, pkix.Extension{Id: kds.OidFmcSpl, Value: fmcSpl})
+	}
 	if hwid != nil {
 		asn1Hwid, _ := asn1.Marshal(hwid[:])
 		exts = append(exts, pkix.Extension{Id: kds.OidHwid, Value: asn1Hwid})
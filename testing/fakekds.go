@@ -153,7 +153,9 @@ func FakeKDSFromSigner(signer *AmdSigner) (*FakeKDS, error) {
 // exist. If not, returns nil.
 func FindChipTcbCerts(database *kpb.Certificates, chipID []byte) map[uint64][]byte {
 	for _, cert := range database.ChipCerts {
-		if bytes.Equal(cert.ChipId, chipID) {
+		// Turin and later KDS URLs identify the chip by only a prefix of its CHIP_ID.
+		if bytes.Equal(cert.ChipId, chipID) ||
+			(len(chipID) == kds.TurinHWIDSize && bytes.HasPrefix(cert.ChipId, chipID)) {
 			return cert.TcbCerts
 		}
 	}
@@ -12,10 +12,13 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package main implements a CLI tool for collecting attestation reports.
+// Package main implements a CLI tool for collecting attestation reports, and with the derivedkey
+// subcommand, keys derived by the AMD security processor.
 package main
 
 import (
+	"crypto/sha512"
+	"encoding/binary"
 	"errors"
 	"flag"
 	"fmt"
@@ -27,6 +30,7 @@ import (
 	"github.com/google/go-sev-guest/client"
 	pb "github.com/google/go-sev-guest/proto/sevsnp"
 	"github.com/google/go-sev-guest/tools/lib/cmdline"
+	"github.com/google/go-sev-guest/tools/lib/report"
 	"github.com/google/logger"
 	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/proto"
@@ -38,8 +42,10 @@ var (
 		"the expected byte size. If \"bin\" or \"auto\" from a file, then the size must be exact.")
 	outform = flag.String("outform", "bin",
 		"The format of the output attestation report. "+
-			"One of \"bin\", \"proto\", \"textproto\". "+
-			"The bin form is for AMD's specified data structures in binary.")
+			"One of \"bin\", \"proto\", \"textproto\", \"json\", or \"pem\". "+
+			"The bin form is for AMD's specified data structures in binary. "+
+			"The json form is canonical JSON with hex-encoded bytes. "+
+			"The pem form is the bin report followed by the certificate chain in PEM blocks.")
 	extended = flag.Bool("extended", false,
 		"Get both the attestation report and "+
 			"the host-provided certificate chain. "+
@@ -53,6 +59,11 @@ var (
 	reportDataFile = flag.String("infile", "",
 		"Path to a file containing 64 bytes of REPORT_DATA to include "+
 			"in the output attestation. Stdin is \"-\". Default -inform=bin.")
+	hashFile = flag.String("hash_infile", "",
+		"Path to a file whose SHA-512 digest after -hash_prefix is the REPORT_DATA to include in the output attestation, "+
+			"e.g., to bind the attestation to an artifact. Stdin is \"-\".")
+	hashPrefix = flag.String("hash_prefix", "",
+		"A domain separation string that -hash_infile hashes, after its 32-bit big-endian length, before the file's contents.")
 	vmpl = flag.String("vmpl", "default", "The VMPL at which to collect an attestation report")
 	out  = flag.String("out", "", "Path to output file to write attestation report to. "+
 		"If unset, outputs to stdout.")
@@ -60,7 +71,41 @@ var (
 	vmplInt uint
 )
 
+// hashedReportData returns the SHA-512 digest of the big-endian 32-bit length of prefix, prefix,
+// and the contents of r, which is exactly abi.ReportDataSize bytes. The length keeps the prefix and
+// the contents apart.
+func hashedReportData(r io.Reader, prefix string) ([]byte, error) {
+	h := sha512.New()
+	h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(prefix))))
+	io.WriteString(h, prefix)
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("could not hash input: %v", err)
+	}
+	return h.Sum(nil), nil
+}
+
+func hashedIndata() ([]byte, error) {
+	if *hashFile == "-" {
+		return hashedReportData(os.Stdin, *hashPrefix)
+	}
+	file, err := os.Open(*hashFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %q: %v", *hashFile, err)
+	}
+	defer file.Close()
+	return hashedReportData(file, *hashPrefix)
+}
+
 func indata() ([]byte, error) {
+	if *hashPrefix != "" && *hashFile == "" {
+		return nil, errors.New("-hash_prefix requires -hash_infile")
+	}
+	if *hashFile != "" {
+		if len(*reportData) != 0 || len(*reportDataFile) != 0 {
+			return nil, errors.New("cannot specify -hash_infile with -in or -infile")
+		}
+		return hashedIndata()
+	}
 	if len(*reportData) == 0 && len(*reportDataFile) == 0 {
 		// Default to stdin
 		*reportDataFile = "-"
@@ -82,12 +127,20 @@ func indata() ([]byte, error) {
 	return cmdline.ParseBytes("stdin", abi.ReportDataSize, file, *inform, cmdline.Filey)
 }
 
-func nonBinOut() func(proto.Message) ([]byte, error) {
+// nonBinOut returns the attestation in the -outform format, or just its report if not extended.
+func nonBinOut(attestation *pb.Attestation, extended bool) ([]byte, error) {
+	var msg proto.Message = attestation
+	if !extended {
+		msg = attestation.Report
+		attestation = &pb.Attestation{Report: attestation.Report}
+	}
 	switch *outform {
 	case "proto":
-		return proto.Marshal
+		return proto.Marshal(msg)
 	case "textproto":
-		return prototext.Marshal
+		return prototext.Marshal(msg)
+	case "json", "pem":
+		return report.Transform(attestation, *outform)
 		// unreachable panic since outform is checked in main
 	default:
 		panic(fmt.Sprintf("unknown -outform: %s", *outform))
@@ -107,7 +160,7 @@ func outputExtendedReport(data [abi.ReportDataSize]byte, out io.Writer) error {
 	if err != nil {
 		return err
 	}
-	bytes, err := nonBinOut()(attestation)
+	bytes, err := nonBinOut(attestation, true)
 	if err != nil {
 		return err
 	}
@@ -172,7 +225,7 @@ func outputReport(data [abi.ReportDataSize]byte, out io.Writer) error {
 	if err != nil {
 		return err
 	}
-	bytes, err := nonBinOut()(attestation.Report)
+	bytes, err := nonBinOut(attestation, false)
 	if err != nil {
 		return err
 	}
@@ -192,6 +245,11 @@ func outWriter() (io.Writer, *os.File, error) {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "derivedkey" {
+		logger.Init("", false, false, os.Stderr)
+		derivedKeyMain(os.Args[2:])
+		return
+	}
 	logger.Init("", *verbose, false, os.Stderr)
 	flag.Parse()
 	// Second phase of parsing.
@@ -202,8 +260,10 @@ func main() {
 		logger.Fatal(err)
 	}
 
-	if !(*outform == "bin" || *outform == "proto" || *outform == "textproto") {
-		logger.Fatalf("-outform is %s. Expect \"bin\", \"proto\", or \"textproto\"",
+	switch *outform {
+	case "bin", "proto", "textproto", "json", "pem":
+	default:
+		logger.Fatalf("-outform is %s. Expect \"bin\", \"proto\", \"textproto\", \"json\", or \"pem\"",
 			*outform)
 	}
 
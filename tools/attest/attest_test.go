@@ -0,0 +1,51 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/google/go-sev-guest/abi"
+)
+
+func TestHashedReportData(t *testing.T) {
+	tcs := []struct {
+		prefix   string
+		contents string
+	}{
+		{contents: "artifact"},
+		{prefix: "image-v1:", contents: "artifact"},
+		{prefix: "image-v1:"},
+	}
+	for _, tc := range tcs {
+		got, err := hashedReportData(strings.NewReader(tc.contents), tc.prefix)
+		if err != nil {
+			t.Fatalf("hashedReportData(%q, %q) = _, %v", tc.contents, tc.prefix, err)
+		}
+		want := sha512.Sum512(append(binary.BigEndian.AppendUint32(nil, uint32(len(tc.prefix))), tc.prefix+tc.contents...))
+		if len(got) != abi.ReportDataSize || !bytes.Equal(got, want[:]) {
+			t.Errorf("hashedReportData(%q, %q) = %x, want %x", tc.contents, tc.prefix, got, want)
+		}
+	}
+	a, _ := hashedReportData(strings.NewReader("b:artifact"), "image-v1:")
+	b, _ := hashedReportData(strings.NewReader("artifact"), "image-v1:b:")
+	if bytes.Equal(a, b) {
+		t.Error("hashedReportData() is equal for prefixes that differ only where the contents start")
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/go-sev-guest/client"
+	"github.com/google/logger"
+)
+
+const derivedKeyWarning = `WARNING: the output is secret key material. Anyone who reads it can decrypt or forge
+what the key protects. Do not log it, store it unencrypted, or pass it on a command line.
+Every guest with the same mixed-in values derives the same key, so select the guest fields
+that identify the workloads that may share it.
+`
+
+// derivedKeyFlags are the flags of the derivedkey subcommand.
+type derivedKeyFlags struct {
+	rootKey    string
+	mix        string
+	vmpl       uint
+	guestSvn   uint
+	tcbVersion uint64
+	label      string
+	length     int
+	outform    string
+	out        string
+}
+
+func newDerivedKeyFlagSet(f *derivedKeyFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet("derivedkey", flag.ExitOnError)
+	fs.StringVar(&f.rootKey, "root_key", "vmrk", "The root key to derive from. One of \"vmrk\" for the VM root key or \"vcek\". "+
+		"VCEK-derived keys are shared with every guest on the chip that mixes in the same values.")
+	fs.StringVar(&f.mix, "mix", "", "Comma-separated guest fields to mix into the key. Any of tcb_version, guest_svn, "+
+		"measurement, family_id, image_id, guest_policy.")
+	fs.UintVar(&f.vmpl, "vmpl", 0, "The VMPL to mix into the key. Must be at least the guest's current VMPL.")
+	fs.UintVar(&f.guestSvn, "guest_svn", 0, "The GUEST_SVN to mix into the key if -mix has guest_svn. "+
+		"Must be at most the guest's launch GUEST_SVN.")
+	fs.Uint64Var(&f.tcbVersion, "tcb_version", 0, "The TCB version to mix into the key if -mix has tcb_version. "+
+		"Must be at most the COMMITTED_TCB.")
+	fs.StringVar(&f.label, "label", "", "If set, outputs the HKDF-SHA256 expansion of the derived key for this "+
+		"application-specific label, as client.DeriveKey does, instead of the firmware's key itself.")
+	fs.IntVar(&f.length, "length", client.DefaultDerivedKeyLength, "The length in bytes of the -label expansion.")
+	fs.StringVar(&f.outform, "outform", "hex", "The format of the output key. One of \"hex\", \"base64\", or \"bin\".")
+	fs.StringVar(&f.out, "out", "", "Path to output file to write the key to. If unset, outputs to stdout.")
+	return fs
+}
+
+// parseGuestFields returns the guest field selection of a comma-separated -mix list.
+func parseGuestFields(mix string) (client.GuestFieldSelect, error) {
+	var result client.GuestFieldSelect
+	if mix == "" {
+		return result, nil
+	}
+	for _, field := range strings.Split(mix, ",") {
+		switch strings.TrimSpace(field) {
+		case "tcb_version":
+			result.TCBVersion = true
+		case "guest_svn":
+			result.GuestSVN = true
+		case "measurement":
+			result.Measurement = true
+		case "family_id":
+			result.FamilyID = true
+		case "image_id":
+			result.ImageID = true
+		case "guest_policy":
+			result.GuestPolicy = true
+		default:
+			return result, fmt.Errorf("unknown -mix field %q", field)
+		}
+	}
+	return result, nil
+}
+
+func (f *derivedKeyFlags) request() (*client.SnpDerivedKeyReq, error) {
+	fields, err := parseGuestFields(f.mix)
+	if err != nil {
+		return nil, err
+	}
+	if f.vmpl > 3 {
+		return nil, fmt.Errorf("-vmpl=%d. Expect 0-3", f.vmpl)
+	}
+	req := &client.SnpDerivedKeyReq{
+		GuestFieldSelect: fields,
+		Vmpl:             uint32(f.vmpl),
+		GuestSVN:         uint32(f.guestSvn),
+		TCBVersion:       f.tcbVersion,
+	}
+	switch f.rootKey {
+	case "vmrk":
+	case "vcek":
+		req.UseVCEK = true
+	default:
+		return nil, fmt.Errorf("-root_key=%q. Expect \"vmrk\" or \"vcek\"", f.rootKey)
+	}
+	return req, nil
+}
+
+func encodeKey(key []byte, outform string) ([]byte, error) {
+	switch outform {
+	case "hex":
+		return []byte(hex.EncodeToString(key) + "\n"), nil
+	case "base64":
+		return []byte(base64.StdEncoding.EncodeToString(key) + "\n"), nil
+	case "bin":
+		return key, nil
+	default:
+		return nil, fmt.Errorf("-outform=%q. Expect \"hex\", \"base64\", or \"bin\"", outform)
+	}
+}
+
+func deriveKey(f *derivedKeyFlags, d client.Device) ([]byte, error) {
+	req, err := f.request()
+	if err != nil {
+		return nil, err
+	}
+	if f.label != "" {
+		return client.DeriveKey(d, &client.DerivedKeyOptions{Request: *req, Label: f.label, Length: f.length})
+	}
+	resp, err := client.GetDerivedKeyAcknowledgingItsLimitations(d, req)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, len(resp.Data))
+	copy(key, resp.Data[:])
+	return key, nil
+}
+
+// derivedKeyMain runs the derivedkey subcommand, which requests a key from SNP_GET_DERIVED_KEY.
+func derivedKeyMain(args []string) {
+	f := &derivedKeyFlags{}
+	newDerivedKeyFlagSet(f).Parse(args)
+	if _, err := f.request(); err != nil {
+		logger.Fatal(err)
+	}
+	if _, err := encodeKey(nil, f.outform); err != nil {
+		logger.Fatal(err)
+	}
+
+	d, err := client.OpenDevice()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer d.Close()
+	key, err := deriveKey(f, d)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer func() {
+		for i := range key {
+			key[i] = 0
+		}
+	}()
+	output, err := encodeKey(key, f.outform)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	fmt.Fprint(os.Stderr, derivedKeyWarning)
+	var w io.Writer = os.Stdout
+	if f.out != "" {
+		file, err := os.OpenFile(f.out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if _, err := w.Write(output); err != nil {
+		logger.Fatal(err)
+	}
+}
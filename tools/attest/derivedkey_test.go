@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	labi "github.com/google/go-sev-guest/client/linuxabi"
+	test "github.com/google/go-sev-guest/testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	vmrkKey := bytes.Repeat([]byte{0x11}, 32)
+	vcekKey := bytes.Repeat([]byte{0x22}, 32)
+	d := &test.Device{Keys: map[string][]byte{
+		test.DerivedKeyRequestToString(&labi.SnpDerivedKeyReqABI{RootKeySelect: 1, GuestFieldSelect: 0x28, Vmpl: 1}): vmrkKey,
+		test.DerivedKeyRequestToString(&labi.SnpDerivedKeyReqABI{}):                                                  vcekKey,
+	}}
+	derive := func(args ...string) []byte {
+		t.Helper()
+		f := &derivedKeyFlags{}
+		if err := newDerivedKeyFlagSet(f).Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		key, err := deriveKey(f, d)
+		if err != nil {
+			t.Fatalf("deriveKey(%v) = _, %v. Want nil", args, err)
+		}
+		return key
+	}
+	if got := derive("-mix", "measurement,tcb_version", "-vmpl", "1"); !bytes.Equal(got, vmrkKey) {
+		t.Errorf("derivedkey -mix measurement,tcb_version -vmpl 1 = %x, want %x", got, vmrkKey)
+	}
+	if got := derive("-root_key", "vcek"); !bytes.Equal(got, vcekKey) {
+		t.Errorf("derivedkey -root_key vcek = %x, want %x", got, vcekKey)
+	}
+	expanded := derive("-root_key", "vcek", "-label", "disk", "-length", "16")
+	if len(expanded) != 16 || bytes.HasPrefix(vcekKey, expanded) {
+		t.Errorf("derivedkey -label disk -length 16 = %x, want a 16-byte expansion", expanded)
+	}
+
+	for _, args := range [][]string{
+		{"-mix", "measurement,chip_id"},
+		{"-root_key", "vlek"},
+		{"-vmpl", "4"},
+	} {
+		f := &derivedKeyFlags{}
+		if err := newDerivedKeyFlagSet(f).Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.request(); err == nil {
+			t.Errorf("derivedkey %v = nil, want error", args)
+		}
+	}
+	if got, err := encodeKey([]byte{0xab, 0xcd}, "base64"); err != nil || string(got) != "q80=\n" {
+		t.Errorf("encodeKey(abcd, base64) = %q, %v, want \"q80=\\n\"", got, err)
+	}
+}
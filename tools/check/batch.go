@@ -0,0 +1,205 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/google/go-sev-guest/tools/lib/report"
+	"github.com/google/go-sev-guest/validate"
+	"github.com/google/go-sev-guest/verify"
+)
+
+// batchFileResult is the outcome of checking one attestation of a batch.
+type batchFileResult struct {
+	Path string `json:"path"`
+	// Result is "pass", "fail", or "error" as in a verdict.
+	Result   string `json:"result"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// batchSummary is the aggregate statistics of a batch.
+type batchSummary struct {
+	Total  int `json:"total"`
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+	Errors int `json:"errors"`
+	// ByExitCode counts the attestations that did not pass by the exit code that checking just
+	// that attestation would have had.
+	ByExitCode map[string]int `json:"by_exit_code"`
+	TotalMs    float64        `json:"total_ms"`
+}
+
+// batchReport is the -output=json report of a batch.
+type batchReport struct {
+	Results []batchFileResult `json:"results"`
+	Summary batchSummary      `json:"summary"`
+}
+
+// batchPaths returns the attestation files in dir, or listed one per line in list. Blank lines and
+// lines starting with # are ignored.
+func batchPaths(dir, list string) ([]string, error) {
+	var paths []string
+	if dir != "" {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not list %q: %v", dir, err)
+		}
+		sort.Strings(paths)
+	} else {
+		var in io.Reader = os.Stdin
+		if list != "-" {
+			f, err := os.Open(list)
+			if err != nil {
+				return nil, fmt.Errorf("could not open %q: %v", list, err)
+			}
+			defer f.Close()
+			in = f
+		}
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			paths = append(paths, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("could not read %q: %v", list, err)
+		}
+	}
+	if len(paths) == 0 {
+		source := dir
+		if source == "" {
+			source = list
+		}
+		return nil, fmt.Errorf("no attestations to check in %q", source)
+	}
+	return paths, nil
+}
+
+func (r *batchFileResult) finish(exitCode int, err error) {
+	r.ExitCode = exitCode
+	switch exitCode {
+	case 0:
+		r.Result = "pass"
+	case exitVerify, exitPolicy:
+		r.Result = "fail"
+	default:
+		r.Result = "error"
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// checkBatch verifies the attestations at paths concurrently with up to workers goroutines, which
+// share each certificate and CRL fetch, and validates those that verify with opts.
+func checkBatch(paths []string, inform string, sopts *verify.Options, opts *validate.Options, workers int) *batchReport {
+	start := time.Now()
+	results := make([]batchFileResult, len(paths))
+	var attestations []*spb.Attestation
+	var indices []int
+	for i, path := range paths {
+		results[i].Path = path
+		attestation, err := report.ReadAttestation(path, inform)
+		if err != nil {
+			results[i].finish(exitInput, err)
+			continue
+		}
+		attestations = append(attestations, attestation)
+		indices = append(indices, i)
+	}
+
+	verrs := verify.SnpAttestations(attestations, sopts, workers)
+	for j, attestation := range attestations {
+		result := &results[indices[j]]
+		if err := verrs[j]; err != nil {
+			result.finish(verifyExitCode(err), fmt.Errorf("could not verify attestation signature: %v", err))
+			continue
+		}
+		if err := validate.SnpAttestation(attestation, opts); err != nil {
+			result.finish(exitPolicy, fmt.Errorf("error validating attestation: %v", err))
+			continue
+		}
+		result.finish(0, nil)
+	}
+
+	summary := batchSummary{Total: len(results), ByExitCode: map[string]int{}}
+	for _, result := range results {
+		switch result.Result {
+		case "pass":
+			summary.Passed++
+			continue
+		case "fail":
+			summary.Failed++
+		default:
+			summary.Errors++
+		}
+		summary.ByExitCode[fmt.Sprint(result.ExitCode)]++
+	}
+	summary.TotalMs = milliseconds(time.Since(start))
+	return &batchReport{Results: results, Summary: summary}
+}
+
+// write writes the report in the -output format to w.
+func (r *batchReport) write(w io.Writer, format string) error {
+	if format == outputJSON {
+		out, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return fmt.Errorf("could not marshal batch report: %v", err)
+		}
+		_, err = fmt.Fprintf(w, "%s\n", out)
+		return err
+	}
+	for _, result := range r.Results {
+		if result.ExitCode == 0 {
+			fmt.Fprintf(w, "%s: pass\n", result.Path)
+		} else {
+			fmt.Fprintf(w, "%s: %s (exit code %d): %s\n", result.Path, result.Result, result.ExitCode, result.Error)
+		}
+	}
+	s := r.Summary
+	_, err := fmt.Fprintf(w, "%d attestations: %d passed, %d failed, %d errors in %.0fms\n",
+		s.Total, s.Passed, s.Failed, s.Errors, s.TotalMs)
+	return err
+}
+
+// exitCode is the tool's exit code for the batch.
+func (r *batchReport) exitCode() int {
+	if r.Summary.Passed == r.Summary.Total {
+		return 0
+	}
+	return exitBatch
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
@@ -29,17 +30,20 @@ import (
 
 	"github.com/google/go-sev-guest/abi"
 	"github.com/google/go-sev-guest/kds"
+	"github.com/google/go-sev-guest/kds/mirror"
 	checkpb "github.com/google/go-sev-guest/proto/check"
 	spb "github.com/google/go-sev-guest/proto/sevsnp"
 	test "github.com/google/go-sev-guest/testing"
 	"github.com/google/go-sev-guest/tools/lib/cmdline"
 	"github.com/google/go-sev-guest/tools/lib/report"
 	"github.com/google/go-sev-guest/validate"
+	"github.com/google/go-sev-guest/validate/migrate"
+	"github.com/google/go-sev-guest/validate/policyfile"
+	"github.com/google/go-sev-guest/validate/signedpolicy"
 	"github.com/google/go-sev-guest/verify"
 	"github.com/google/go-sev-guest/verify/trust"
 	"github.com/google/logger"
 	"go.uber.org/multierr"
-	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
@@ -68,6 +72,10 @@ const (
 	exitCrl = 4
 	// Exit code 5 - the report did not validate according to policy.
 	exitPolicy = 5
+	// Exit code 6 - the attestation report, bundle, or config could not be read or parsed.
+	exitInput = 6
+	// Exit code 7 - some attestation of -in_dir or -in_list did not pass.
+	exitBatch = 7
 )
 
 var (
@@ -77,8 +85,20 @@ var (
 	configProto = flag.String("config", "",
 		("A path to a serialized check.Config protobuf. Any individual field flags will" +
 			"overwrite the message's associated field. Default unmarshalled as binary. Paths" +
-			" ending in .textproto will be unmarshalled as prototext."))
-	quiet = flag.Bool("quiet", false, "If true, writes nothing the stdout or stderr. Success is exit code 0, failure exit code 1.")
+			" ending in .textproto will be unmarshalled as prototext, and paths ending in .json," +
+			" .yaml, or .yml as JSON or YAML."))
+	configKey = flag.String("config_key", "",
+		("A path to a PEM-encoded ECDSA public key or certificate. If set, -config must have a" +
+			" detached signature by the key, or the tool fails without checking the attestation."))
+	configSignature = flag.String("config_signature", "",
+		"A path to the detached signature of -config. Default is the -config path with a .sig suffix.")
+	printConfig = flag.String("print_config", "",
+		("If set, writes the effective check.Config, i.e., -config with the flags applied, to stdout in this format and" +
+			" exits without checking an attestation. One of \"textproto\", \"json\", or \"yaml\"."))
+	quiet  = flag.Bool("quiet", false, "If true, writes nothing the stdout or stderr. Success is exit code 0, failure exit code 1.")
+	output = flag.String("output", outputText,
+		"The output format. One of \"text\", which writes failures to stderr, or \"json\", which writes a verdict with every"+
+			" check's outcome, the certificates, and timing to stdout.")
 
 	reportdataS  = flag.String("report_data", "", "The expected REPORT_DATA field as a hex string. Must encode 64 bytes. Unchecked if unset.")
 	reportdata   = cmdline.Bytes("-report_data", abi.ReportDataSize, reportdataS)
@@ -86,6 +106,8 @@ var (
 	hostdata     = cmdline.Bytes("-host_data", abi.HostDataSize, hostdataS)
 	familyidS    = flag.String("family_id", "", "The expected FAMILY_ID field as a hex string. Must encode 16 bytes. Unchecked if unset.")
 	familyid     = cmdline.Bytes("-family_id", abi.FamilyIDSize, familyidS)
+	familyids    = flag.String("family_ids", "", "Comma-separated hex-encoded acceptable FAMILY_ID values. Each must encode 16 bytes. Unchecked if unset.")
+	imageids     = flag.String("image_ids", "", "Comma-separated hex-encoded acceptable IMAGE_ID values. Each must encode 16 bytes. Unchecked if unset.")
 	imageidS     = flag.String("image_id", "", "The expected IMAGE_ID field as a hex string. Must encode 16 bytes. Unchecked if unset.")
 	imageid      = cmdline.Bytes("-image_id", abi.ImageIDSize, imageidS)
 	reportidS    = flag.String("report_id", "", "The expected REPORT_ID field as a hex string. Must encode 32 bytes. Unchecked if unset.")
@@ -94,14 +116,36 @@ var (
 	reportidma   = cmdline.Bytes("-report_id_ma", abi.ReportIDMASize, reportidmaS)
 	measurementS = flag.String("measurement", "", "The expected MEASUREMENT field as a hex string. Must encode 48 bytes. Unchecked if unset.")
 	measurement  = cmdline.Bytes("-measurement", abi.MeasurementSize, measurementS)
+	measurements = flag.String("measurements", "", "Comma-separated hex-encoded acceptable MEASUREMENT values. Each must encode 48 bytes. Unchecked if unset.")
 	chipidS      = flag.String("chip_id", "", "The expected CHIP_ID field as a hex string. Must encode 64 bytes. Unchecked if unset.")
 	chipid       = cmdline.Bytes("-chip_id", abi.ChipIDSize, chipidS)
+	chipids      = flag.String("chip_ids", "", "Comma-separated hex-encoded acceptable CHIP_ID values. Each must encode 64 bytes. Unchecked if unset.")
+	signingKey   = flag.String("signing_key", "", "The key that must have signed the report. One of \"vcek\" or \"vlek\". Unchecked if unset.")
 
 	// Optional Uint64. We don't want 0 to override the policy message, so instead of parsing
 	// as Uint64 up front, we keep the flag a string and parse later if given.
-	mintcb       = flag.String("minimum_tcb", "", "The minimum acceptable value for CURRENT_TCB, COMMITTED_TCB, and REPORTED_TCB.")
-	minlaunchtcb = flag.String("minimum_launch_tcb", "", "The minimum acceptable value for LAUNCH_TCB.")
+	// The TCB flags may instead be KDS URL query arguments for component-wise minimums.
+	mintcb = flag.String("minimum_tcb", "",
+		"The minimum acceptable value for CURRENT_TCB, COMMITTED_TCB, and REPORTED_TCB, as a number or as KDS URL query arguments, e.g., blSPL=3&snpSPL=8&ucodeSPL=115.")
+	minlaunchtcb = flag.String("minimum_launch_tcb", "", "The minimum acceptable value for LAUNCH_TCB in the form of -minimum_tcb.")
 	guestPolicy  = flag.String("guest_policy", "", "The most acceptable SnpPolicy component-wise in its 64-bit format.")
+
+	familyidpatterns = flag.String("family_id_patterns", "",
+		"Comma-separated acceptable FAMILY_ID patterns of hex digits, '?' for any nibble, and an optional trailing '*' for any remainder. Unchecked if unset.")
+	imageidpatterns = flag.String("image_id_patterns", "",
+		"Comma-separated acceptable IMAGE_ID patterns in the form of -family_id_patterns. Unchecked if unset.")
+	hostdatapatterns = flag.String("host_data_patterns", "",
+		"Comma-separated acceptable HOST_DATA patterns in the form of -family_id_patterns. Unchecked if unset.")
+
+	mincommittedtcb = flag.String("minimum_committed_tcb", "", "The minimum acceptable value for COMMITTED_TCB in the form of -minimum_tcb.")
+	tcbrelations    = flag.String("tcb_relations", "",
+		"Comma-separated orderings of the report's TCB fields of the form lower<=higher, e.g., launch<=committed. Each side is current, committed, reported, or launch.")
+	tcbordering = flag.String("tcb_ordering", "",
+		"How LAUNCH_TCB, REPORTED_TCB, and CURRENT_TCB relate: monotonic (launch <= reported <= current), launch_equals_reported, or equal. Unchecked if unset.")
+
+	requiredplatforminfo  = flag.String("required_platform_info", "", "The PLATFORM_INFO bits that must be set in their 64-bit format.")
+	forbiddenplatforminfo = flag.String("forbidden_platform_info", "", "The PLATFORM_INFO bits that must be clear in their 64-bit format.")
+
 	// Optional Uint8. Similar to above.
 	minbuild = flag.String("min_build", "", "The 8-bit minimum build number for AMD-SP firmware")
 	// Optional Bool.
@@ -112,9 +156,11 @@ var (
 	requireauthor  = flag.String("require_author_key", "", "Require that AUTHOR_KEY_EN is 1.")
 	requireidblock = flag.String("require_idblock", "", "Require that the VM was launch with an ID_BLOCK signed by a trusted id key or author key")
 	provisional    = flag.String("provisional", "", "Permit provisional firmware (i.e., committed values may be less than current values).")
+	consistentsmt  = flag.String("require_consistent_smt", "", "Require that POLICY permits SMT if PLATFORM_INFO has SMT enabled.")
 
 	// Optional nibble.
 	vmpl         = flag.String("vmpl", "", "The expected VMPL value of the report [0-3].")
+	maxvmpl      = flag.String("max_vmpl", "", "The highest permissible VMPL value of the report [0-3].")
 	platforminfo = flag.String("platform_info", "", "The maximum acceptable PLATFORM_INFO field bit-wise. May be empty or a 64-bit unsigned integer")
 	minversion   = flag.String("min_version", "", "Minimum AMD-SP firmware API version (major.minor). Each number must be 8-bit non-negative.")
 
@@ -126,6 +172,36 @@ var (
 	stepping  = flag.String("stepping", "", "The machine stepping for the chip that generated the attestation report. Default unchecked.")
 	cabundles = flag.String("product_key_path", "",
 		"Colon-separated paths to CA bundles for the AMD product. Must be in PEM format, ASK, then ARK certificates. If unset, uses embedded root certificates.")
+	tlsCABundles = flag.String("tls_ca_bundles", "",
+		"Colon-separated paths to PEM CA bundles to trust for HTTPS connections, e.g., of a TLS-intercepting proxy. The system roots remain trusted.")
+	tlsClientCert = flag.String("tls_client_cert", "",
+		"Path to a PEM TLS client certificate chain to present to servers that request one, e.g., an authenticating KDS proxy. Requires -tls_client_key.")
+	tlsClientKey = flag.String("tls_client_key", "", "Path to the PEM private key of -tls_client_cert.")
+	kdsMirrors   = flag.String("kds_mirrors", "",
+		"Comma-separated base URLs of AMD KDS mirrors to fetch certificates and CRLs from, in order, before the AMD KDS itself.")
+	certStore = flag.String("cert_store", "",
+		"Path to a trust.FileCertStore directory to take missing certificates from before fetching them, e.g., as prefetched for offline verification.")
+	offline = flag.Bool("offline", false,
+		"If true, never accesses the network. Certificates and CRLs come from the report's certificate chain and -cert_store, "+
+			"and verification fails with what is missing if anything would need to be fetched.")
+	bundleFile = flag.String("bundle", "",
+		"Path to a verify.Bundle archive, e.g., from the fetchcerts tool, to verify offline in place of -in.")
+	bundleAtTimestamp = flag.Bool("bundle_at_timestamp", false,
+		"If true, verify -bundle at the time it records rather than now. The timestamp is not authenticated, "+
+			"so only use this for bundles from a trusted source.")
+	inDir = flag.String("in_dir", "",
+		"Path to a directory of attestations to check in place of -in. Every file below it is checked with -inform.")
+	inList = flag.String("in_list", "",
+		"Path to a file that lists the paths of attestations to check in place of -in, one per line. Stdin is \"-\".")
+	workers = flag.Int("workers", 0,
+		"The number of attestations of -in_dir or -in_list to verify concurrently. If not positive, uses GOMAXPROCS.")
+	serveMode = flag.Bool("serve", false,
+		"If true, serves the check.Checker service with the policy of the flags and -config in place of checking -in, until killed.")
+	httpAddr     = flag.String("http_addr", "localhost:8080", "Address on which -serve answers REST requests. Empty disables REST.")
+	grpcAddr     = flag.String("grpc_addr", "localhost:8081", "Address on which -serve answers gRPC requests. Empty disables gRPC.")
+	serveTLSCert = flag.String("serve_tls_cert", "",
+		"Path to a PEM TLS server certificate chain for -serve to present over both REST and gRPC. Requires -serve_tls_key. Plaintext if unset.")
+	serveTLSKey = flag.String("serve_tls_key", "", "Path to the PEM private key of -serve_tls_cert.")
 	verbose     = flag.Bool("v", false, "Enable verbose logging.")
 	testKdsFile = flag.String("kdsdatabase", "", "Path to a fakekds.Certificates binary cache of AMD KDS")
 
@@ -210,7 +286,11 @@ func parseUint(p string, bits int) (uint64, error) {
 
 func dieWith(err error, exitCode int) {
 	if !*quiet {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+		if *output == outputJSON {
+			writeVerdict(err, exitCode)
+		} else {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
 	}
 	os.Exit(exitCode)
 }
@@ -219,34 +299,100 @@ func die(err error) {
 	dieWith(err, exitTool)
 }
 
+// inputErr is a failure to read or parse an input file.
+type inputErr struct {
+	error
+}
+
+// dieInput exits with exitInput if err is an inputErr, and with exitTool otherwise.
+func dieInput(err error) {
+	var ierr inputErr
+	if errors.As(err, &ierr) {
+		dieWith(err, exitInput)
+	}
+	die(err)
+}
+
 func parseConfig(path string) error {
 	if path == "" {
 		return nil
 	}
 	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("could not open %q: %v", path, err)
+		return inputErr{fmt.Errorf("could not open %q: %v", path, err)}
 	}
 	defer f.Close()
 
 	contents, err := io.ReadAll(f)
 	if err != nil {
-		return fmt.Errorf("could not read %q: %v", path, err)
+		return inputErr{fmt.Errorf("could not read %q: %v", path, err)}
 	}
-	if strings.HasSuffix(path, ".textproto") {
-		err = prototext.Unmarshal(contents, config)
-	} else {
-		err = proto.Unmarshal(contents, config)
+	if *configKey != "" {
+		if err := verifyConfig(path, contents); err != nil {
+			return err
+		}
 	}
+	config, err = policyfile.Unmarshal(contents, policyfile.FormatFromPath(path))
 	if err != nil {
-		return fmt.Errorf("could not deserialize %q: %v", path, err)
+		return inputErr{fmt.Errorf("could not deserialize %q: %v", path, err)}
 	}
-	// Populate fields that should not be nil
-	if config.RootOfTrust == nil {
-		config.RootOfTrust = &checkpb.RootOfTrust{}
+	migrated, warnings, err := migrate.Config(config)
+	if err != nil {
+		return inputErr{fmt.Errorf("could not migrate %q: %v", path, err)}
 	}
-	if config.Policy == nil {
-		config.Policy = &checkpb.Policy{}
+	if config.GetSchemaVersion() < migrate.CurrentVersion && !*quiet {
+		for _, w := range warnings {
+			logger.Warningf("%s: %v", path, w)
+		}
+	}
+	config = migrated
+	return nil
+}
+
+// writeConfig writes the effective config to w in the given format after checking that its policy
+// is valid.
+func writeConfig(w io.Writer, format string) error {
+	formats := map[string]policyfile.Format{
+		"textproto": policyfile.Textproto,
+		"json":      policyfile.JSON,
+		"yaml":      policyfile.YAML,
+	}
+	f, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("-print_config=%q is not one of \"textproto\", \"json\", or \"yaml\"", format)
+	}
+	if _, err := validate.PolicyToOptions(config.Policy); err != nil {
+		return fmt.Errorf("invalid policy: %v", err)
+	}
+	out, err := policyfile.Marshal(config, f)
+	if err != nil {
+		return fmt.Errorf("could not marshal config: %v", err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// verifyConfig returns an error unless the config contents at path have a detached signature by
+// the -config_key key.
+func verifyConfig(path string, contents []byte) error {
+	pemBytes, err := os.ReadFile(*configKey)
+	if err != nil {
+		return fmt.Errorf("could not read -config_key %q: %v", *configKey, err)
+	}
+	key, err := signedpolicy.ParsePublicKey(pemBytes)
+	if err != nil {
+		return err
+	}
+	sigPath := *configSignature
+	if sigPath == "" {
+		sigPath = path + ".sig"
+	}
+	signature, err := os.ReadFile(sigPath)
+	if err != nil {
+		return fmt.Errorf("could not read -config_signature %q: %v", sigPath, err)
+	}
+	if err := signedpolicy.Verify(key, contents, signature); err != nil {
+		return fmt.Errorf("could not verify %q: %v", path, err)
 	}
 	return nil
 }
@@ -318,6 +464,24 @@ func setUInt64Value(value **wrapperspb.UInt64Value, name, flag string) error {
 	return err
 }
 
+// setTCB sets the packed TCB value from a number, or the component-wise parts from KDS URL query
+// arguments. Validation checks the parts against the TCB layout of the policy's product.
+func setTCB(value *uint64, parts **spb.TcbParts, name, flag string, defaultValue uint64) error {
+	if !strings.Contains(flag, "=") {
+		if flag != "" {
+			*parts = nil
+		}
+		return setUint64(value, name, flag, defaultValue)
+	}
+	p, err := kds.ParseTCBParts(flag)
+	if err != nil {
+		return fmt.Errorf("invalid -%s=%s: %v", name, flag, err)
+	}
+	*value = 0
+	*parts = kds.TCBPartsToProto(p, spb.SevProduct_SEV_PRODUCT_UNKNOWN)
+	return nil
+}
+
 func setUInt32Value(value **wrapperspb.UInt32Value, name, flag string) error {
 	v, err := getUIntValue(32, name, flag)
 	if v != nil {
@@ -326,6 +490,30 @@ func setUInt32Value(value **wrapperspb.UInt32Value, name, flag string) error {
 	return err
 }
 
+// setEnum sets value to the enum value whose name is prefix followed by the upper-cased flag,
+// e.g., "vcek" names SIGNING_KEY_VCEK. The zero value means unchecked.
+func setEnum[E ~int32](value *E, values map[string]int32, prefix, name, flag string) error {
+	if flag == "" {
+		if !override() {
+			*value = 0
+		}
+		return nil
+	}
+	v, ok := values[prefix+strings.ToUpper(flag)]
+	if !ok || v == 0 {
+		var names []string
+		for n, v := range values {
+			if v != 0 {
+				names = append(names, fmt.Sprintf("%q", strings.ToLower(strings.TrimPrefix(n, prefix))))
+			}
+		}
+		sort.Strings(names)
+		return fmt.Errorf("flag -%s=%s invalid. Must be unset or one of %s", name, flag, strings.Join(names, ", "))
+	}
+	*value = E(v)
+	return nil
+}
+
 func setString(dest *string, _, flag string, defaultValue string) {
 	if flag == "" {
 		// Empty strings are not expected valid values, so override.
@@ -403,6 +591,11 @@ func populateConfig() error {
 		}
 		return nil
 	}
+	setPatterns := func(dest *[]string, flag string) {
+		if flag != "" {
+			*dest = strings.Split(flag, ",")
+		}
+	}
 	setCertBytes := func(dest *[][]byte, _, flag string) error {
 		if flag != "" {
 			bytes, err := getCertBytes(flag)
@@ -429,23 +622,38 @@ func populateConfig() error {
 	setNonNil(&policy.ReportId, *reportid)
 	setNonNil(&policy.ReportIdMa, *reportidma)
 	setNonNil(&policy.ChipId, *chipid)
+	setPatterns(&policy.FamilyIdPatterns, *familyidpatterns)
+	setPatterns(&policy.ImageIdPatterns, *imageidpatterns)
+	setPatterns(&policy.HostDataPatterns, *hostdatapatterns)
+	setPatterns(&policy.TcbRelations, *tcbrelations)
 	policy.Product = product
 
 	return multierr.Combine(
 		setUint64(&policy.Policy, "guest_policy", *guestPolicy, defaultGuestPolicy),
-		setUint64(&policy.MinimumTcb, "minimum_tcb",
+		setTCB(&policy.MinimumTcb, &policy.MinimumTcbParts, "minimum_tcb",
 			*mintcb, defaultMinTcb),
-		setUint64(&policy.MinimumLaunchTcb, "minimum_launch_tcb",
+		setTCB(&policy.MinimumLaunchTcb, &policy.MinimumLaunchTcbParts, "minimum_launch_tcb",
 			*minlaunchtcb, defaultMinLaunchTcb),
+		setTCB(&policy.MinimumCommittedTcb, &policy.MinimumCommittedTcbParts, "minimum_committed_tcb", *mincommittedtcb, 0),
 		setUint32(&policy.MinimumBuild, "min_build", *minbuild, defaultMinBuild),
+		setEnum(&policy.TcbOrdering, checkpb.TCBOrdering_value, "TCB_ORDERING_", "tcb_ordering", *tcbordering),
+		setEnum(&policy.SigningKey, checkpb.SigningKey_value, "SIGNING_KEY_", "signing_key", *signingKey),
 		setUInt32Value(&policy.Vmpl, "vmpl", *vmpl),
+		setUInt32Value(&policy.MaximumVmpl, "max_vmpl", *maxvmpl),
 		setUInt64Value(&policy.PlatformInfo, "platform_info", *platforminfo),
+		setUint64(&policy.RequiredPlatformInfo, "required_platform_info", *requiredplatforminfo, 0),
+		setUint64(&policy.ForbiddenPlatformInfo, "forbidden_platform_info", *forbiddenplatforminfo, 0),
 		setBool(&policy.RequireAuthorKey, "require_author_key",
 			*requireauthor, defaultRequireAuthorKey),
 		setBool(&policy.RequireIdBlock, "require_idblock",
 			*requireidblock, defaultRequireIDBlock),
 		setBool(&policy.PermitProvisionalFirmware, "permit_provisional_firmware",
 			*provisional, defaultPermitProvisionalFirmware),
+		setBool(&policy.RequireConsistentSmt, "require_consistent_smt", *consistentsmt, false),
+		setHashes(&policy.Measurements, "measurements", *measurements),
+		setHashes(&policy.FamilyIds, "family_ids", *familyids),
+		setHashes(&policy.ImageIds, "image_ids", *imageids),
+		setHashes(&policy.ChipIds, "chip_ids", *chipids),
 		setHashes(&policy.TrustedAuthorKeyHashes, "trusted_author_key_hashes",
 			*trustedauthorhashes),
 		setHashes(&policy.TrustedIdKeyHashes, "trusted_id_key_hashes",
@@ -456,27 +664,103 @@ func populateConfig() error {
 			*trustedidkeys))
 }
 
+// verifyExitCode returns the exit code for a verification failure, which is more helpful when
+// network errors affected the result.
+func verifyExitCode(err error) int {
+	exitCode := exitVerify
+	clarify := func(err error) bool {
+		if err == nil {
+			return false
+		}
+		var certNetworkErr *trust.AttestationRecreationErr
+		var crlNetworkErr verify.CRLUnavailableErr
+		if errors.As(err, &certNetworkErr) {
+			exitCode = exitCerts
+			return true
+		} else if errors.As(err, &crlNetworkErr) {
+			exitCode = exitCrl
+			return true
+		}
+		return false
+	}
+	if !clarify(err) {
+		clarify(errors.Unwrap(err))
+	}
+	return exitCode
+}
+
 func main() {
 	logger.Init("", *verbose, false, os.Stderr)
 	flag.Parse()
 	cmdline.Parse("auto")
+	if *output != outputText && *output != outputJSON {
+		invalid := *output
+		// Report the error itself as text.
+		*output = outputText
+		die(fmt.Errorf("-output=%q is not one of \"text\" or \"json\"", invalid))
+	}
 
 	if err := parseConfig(*configProto); err != nil {
-		die(err)
+		dieInput(err)
 	}
 
 	if err := multierr.Combine(populateProduct(), populateRootOfTrust(),
 		populateConfig()); err != nil {
 		die(err)
 	}
+	if *printConfig != "" {
+		if err := writeConfig(os.Stdout, *printConfig); err != nil {
+			die(err)
+		}
+		return
+	}
 
-	if config.RootOfTrust.CheckCrl && config.RootOfTrust.DisallowNetwork {
-		die(errors.New("cannot specify both -check_crl=true and -network=false"))
+	offlineMode := *offline || *bundleFile != ""
+	if config.RootOfTrust.CheckCrl && config.RootOfTrust.DisallowNetwork && !offlineMode {
+		die(errors.New("cannot specify both -check_crl=true and -network=false. Use -offline to check the CRL from -cert_store"))
+	}
+	if offlineMode && (*kdsMirrors != "" || *testKdsFile != "") {
+		die(errors.New("-offline and -bundle cannot be used with -kds_mirrors or -kdsdatabase"))
+	}
+	if *bundleFile != "" && *infile != "-" {
+		die(errors.New("cannot specify both -bundle and -in"))
+	}
+	batchMode := *inDir != "" || *inList != ""
+	if *inDir != "" && *inList != "" {
+		die(errors.New("cannot specify both -in_dir and -in_list"))
+	}
+	if batchMode && (*infile != "-" || *bundleFile != "") {
+		die(errors.New("-in_dir and -in_list cannot be used with -in or -bundle"))
+	}
+	if *serveMode && (*infile != "-" || *bundleFile != "" || batchMode) {
+		die(errors.New("-serve cannot be used with -in, -bundle, -in_dir, or -in_list"))
 	}
 
-	attestation, err := report.ReadAttestation(*infile, *inform)
-	if err != nil {
-		die(err)
+	var bundle *verify.Bundle
+	var attestation *spb.Attestation
+	var paths []string
+	if batchMode {
+		var err error
+		paths, err = batchPaths(*inDir, *inList)
+		if err != nil {
+			dieWith(err, exitInput)
+		}
+	} else if *bundleFile != "" {
+		data, err := os.ReadFile(*bundleFile)
+		if err != nil {
+			dieWith(fmt.Errorf("could not read bundle %q: %v", *bundleFile, err), exitInput)
+		}
+		bundle, err = verify.UnmarshalBundle(data)
+		if err != nil {
+			dieWith(err, exitInput)
+		}
+		attestation = bundle.Attestation
+	} else if !*serveMode {
+		var err error
+		attestation, err = report.ReadAttestation(*infile, *inform)
+		if err != nil {
+			dieWith(err, exitInput)
+		}
 	}
 
 	sopts, err := verify.RootOfTrustToOptions(config.RootOfTrust)
@@ -484,10 +768,29 @@ func main() {
 		die(err)
 	}
 	sopts.Product = product
+	if bundle != nil && *bundleAtTimestamp {
+		sopts.Now = bundle.Timestamp
+	}
+	clientOpts := &trust.HTTPClientOptions{ClientCertPath: *tlsClientCert, ClientKeyPath: *tlsClientKey}
+	if *tlsCABundles != "" {
+		clientOpts.CABundlePaths = strings.Split(*tlsCABundles, ":")
+	}
+	client, err := trust.NewHTTPClient(clientOpts)
+	if err != nil {
+		die(err)
+	}
+	var getter trust.HTTPSGetter = &trust.SimpleHTTPSGetter{Client: client}
+	if *kdsMirrors != "" {
+		getter = &trust.MirrorHTTPSGetter{
+			Mirrors:       strings.Split(*kdsMirrors, ","),
+			FallbackToKDS: true,
+			Getter:        getter,
+		}
+	}
 	sopts.Getter = &trust.RetryHTTPSGetter{
 		Timeout:       *timeout,
 		MaxRetryDelay: *maxRetryDelay,
-		Getter:        &trust.SimpleHTTPSGetter{},
+		Getter:        getter,
 	}
 	if *testKdsFile != "" {
 		tkds := test.GetKDS(&testing.T{})
@@ -504,36 +807,89 @@ func main() {
 			die(fmt.Errorf("could not unmarshal KDS database: %v", err))
 		}
 	}
-	if err := verify.SnpAttestation(attestation, sopts); err != nil {
-		// Make the exit code more helpful when there are network errors
-		// that affected the result.
-		exitCode := exitVerify
-		clarify := func(err error) bool {
-			if err == nil {
-				return false
-			}
-			var certNetworkErr *trust.AttestationRecreationErr
-			var crlNetworkErr *verify.CRLUnavailableErr
-			if errors.As(err, &certNetworkErr) {
-				exitCode = exitCerts
-				return true
-			} else if errors.As(err, &crlNetworkErr) {
-				exitCode = exitCrl
-				return true
+	var store trust.CertStore = &trust.MemoryCertStore{}
+	if *certStore != "" {
+		if _, err := os.Stat(*certStore); err != nil {
+			die(fmt.Errorf("could not open certificate store: %v", err))
+		}
+		store = &trust.FileCertStore{Dir: *certStore}
+		sopts.CertStore = store
+	}
+	if offlineMode {
+		// Rather than skip fetching, fail each fetch with the KDS URL that the store lacks, so that
+		// the error says what to provision.
+		sopts.DisableCertFetching = false
+		sopts.Getter = &mirror.Getter{Store: store, CSPID: sopts.CSPID}
+	}
+	if batchMode {
+		opts, err := validate.PolicyToOptions(config.Policy)
+		if err != nil {
+			die(err)
+		}
+		r := checkBatch(paths, *inform, sopts, opts, *workers)
+		if !*quiet {
+			if err := r.write(os.Stdout, *output); err != nil {
+				die(err)
 			}
-			return false
 		}
-		if !clarify(err) {
-			clarify(errors.Unwrap(err))
+		os.Exit(r.exitCode())
+	}
+	if *serveMode {
+		opts, err := validate.PolicyToOptions(config.Policy)
+		if err != nil {
+			die(err)
+		}
+		// Keep the certificates that requests fetch for later requests.
+		sopts.CertStore = store
+		tlsConfig, err := serveTLSConfig(*serveTLSCert, *serveTLSKey)
+		if err != nil {
+			die(err)
 		}
-		dieWith(fmt.Errorf("could not verify attestation signature: %v", err), exitCode)
+		die(serve(&checker{sopts: sopts, opts: opts}, *httpAddr, *grpcAddr, tlsConfig))
+	}
+	verifyStart := time.Now()
+	if *output == outputJSON {
+		// The verdict reports every check, so collect them all.
+		sopts.CollectAllFailures = true
+		var res *verify.Result
+		var verr error
+		if bundle != nil {
+			res, verr = verify.SnpBundleWithResult(bundle, sopts)
+		} else {
+			res, verr = verify.SnpAttestationWithResult(attestation, sopts)
+		}
+		runVerdict.addVerification(res)
+		runVerdict.addCertificates(attestation.GetCertificateChain())
+		err = verr
+	} else if bundle != nil {
+		err = verify.SnpBundle(bundle, sopts)
+	} else {
+		err = verify.SnpAttestation(attestation, sopts)
+	}
+	runVerdict.Timing.VerifyMs = milliseconds(time.Since(verifyStart))
+	if err != nil {
+		dieWith(fmt.Errorf("could not verify attestation signature: %v", err), verifyExitCode(err))
 	}
 
 	opts, err := validate.PolicyToOptions(config.Policy)
 	if err != nil {
 		die(err)
 	}
-	if err := validate.SnpAttestation(attestation, opts); err != nil {
+	validateStart := time.Now()
+	if *output == outputJSON {
+		res, verr := validate.SnpAttestationWithResult(attestation, opts)
+		if res != nil {
+			runVerdict.addValidation(res)
+		}
+		err = verr
+	} else {
+		err = validate.SnpAttestation(attestation, opts)
+	}
+	runVerdict.Timing.ValidateMs = milliseconds(time.Since(validateStart))
+	if err != nil {
 		dieWith(fmt.Errorf("error validating attestation: %v", err), exitPolicy)
 	}
+	if *output == outputJSON && !*quiet {
+		writeVerdict(nil, 0)
+	}
 }
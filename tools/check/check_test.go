@@ -2,23 +2,49 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-sev-guest/abi"
 	"github.com/google/go-sev-guest/kds"
+	"github.com/google/go-sev-guest/kds/mirror"
 	checkpb "github.com/google/go-sev-guest/proto/check"
 	kpb "github.com/google/go-sev-guest/proto/fakekds"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
 	fakesev "github.com/google/go-sev-guest/testing"
+	"github.com/google/go-sev-guest/validate"
+	"github.com/google/go-sev-guest/validate/policyfile"
+	"github.com/google/go-sev-guest/validate/signedpolicy"
+	"github.com/google/go-sev-guest/verify"
 	"github.com/google/go-sev-guest/verify/testdata"
+	"github.com/google/go-sev-guest/verify/trust"
 	"github.com/google/logger"
 	"go.uber.org/multierr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/known/wrapperspb"
@@ -149,6 +175,15 @@ func stringSetter(name string) setterFn {
 	}
 }
 
+func signingKeySetter(p *checkpb.Policy, value string, _ *testing.T) bool {
+	v, ok := checkpb.SigningKey_value["SIGNING_KEY_"+strings.ToUpper(value)]
+	if !ok {
+		return true
+	}
+	p.SigningKey = checkpb.SigningKey(v)
+	return false
+}
+
 func boolSetter(name string) setterFn {
 	return func(p *checkpb.Policy, value string, _ *testing.T) bool {
 		switch value {
@@ -208,6 +243,15 @@ func uint64valueSetter(name string) setterFn {
 	}
 }
 
+func chipIDsSetter(p *checkpb.Policy, value string, _ *testing.T) bool {
+	chipIDs, err := parseHashes(value)
+	if err != nil {
+		return true
+	}
+	p.ChipIds = chipIDs
+	return false
+}
+
 func testCases() []testCase {
 	return []testCase{
 		{
@@ -268,6 +312,18 @@ func testCases() []testCase {
 			},
 			setter: bytesSetter("chip_id"),
 		},
+		{
+			flag:   "chip_ids",
+			good:   strings.Repeat("00", abi.ChipIDSize) + "," + goodChipID,
+			bad:    []string{strings.Repeat("00", abi.ChipIDSize), "not hex"},
+			setter: chipIDsSetter,
+		},
+		{
+			flag:   "signing_key",
+			good:   "vcek",
+			bad:    []string{"vlek", "ask"},
+			setter: signingKeySetter,
+		},
 		{
 			flag:   "minimum_tcb",
 			good:   "4901323769462652930",
@@ -499,3 +555,599 @@ func TestCaBundles(t *testing.T) {
 		}
 	})
 }
+
+func TestSignedConfig(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := proto.Marshal(&checkpb.Config{Policy: &checkpb.Policy{Policy: goodPolicy}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := signedpolicy.Sign(key, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withTempFile(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), t, func(keyPath string) {
+		withTempFile(config, t, func(configPath string) {
+			for _, tc := range []struct {
+				name      string
+				signature []byte
+				wantPass  bool
+			}{
+				{name: "good", signature: signature, wantPass: true},
+				{name: "bad", signature: signature[:len(signature)-1]},
+			} {
+				t.Run(tc.name, func(t *testing.T) {
+					withTempFile(tc.signature, t, func(sigPath string) {
+						cmd := exec.Command(check, withBaseArgs(configPath, "-config_key="+keyPath,
+							"-config_signature="+sigPath, "--product_name=Milan-B0")...)
+						output, err := cmd.CombinedOutput()
+						if tc.wantPass && err != nil {
+							t.Errorf("%s failed unexpectedly: %v, %s", cmd, err, output)
+						} else if !tc.wantPass && err == nil {
+							t.Errorf("%s succeeded unexpectedly: %s", cmd, output)
+						}
+					})
+				})
+			}
+		})
+	})
+}
+
+func TestJSONOutput(t *testing.T) {
+	statuses := func(checks []verdictCheck) map[string]string {
+		result := map[string]string{}
+		for _, c := range checks {
+			result[c.Name] = c.Status
+		}
+		return result
+	}
+	tcs := []struct {
+		name           string
+		args           []string
+		wantResult     string
+		wantExitCode   int
+		wantValidation map[string]string
+	}{
+		{
+			name:           "pass",
+			wantResult:     "pass",
+			wantValidation: map[string]string{"platform_info": "passed", "tcb": "passed"},
+		},
+		{
+			name:           "fail",
+			args:           []string{"-platform_info=0"},
+			wantResult:     "fail",
+			wantExitCode:   exitPolicy,
+			wantValidation: map[string]string{"platform_info": "failed", "tcb": "passed"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			args := withBaseArgs("", append([]string{"-output=json", "--product_name=Milan-B0"}, tc.args...)...)
+			cmd := exec.Command(check, args...)
+			out, err := cmd.Output()
+			gotCode := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				gotCode = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("%s = %v", cmd, err)
+			}
+			if gotCode != tc.wantExitCode {
+				t.Errorf("%s exit code = %d, want %d", cmd, gotCode, tc.wantExitCode)
+			}
+			var got verdict
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("%s wrote %q, which is not a JSON verdict: %v", cmd, out, err)
+			}
+			if got.Result != tc.wantResult || got.ExitCode != tc.wantExitCode {
+				t.Errorf("%s verdict = %s with exit code %d, want %s with %d", cmd, got.Result, got.ExitCode, tc.wantResult, tc.wantExitCode)
+			}
+			if status := statuses(got.Verification)["signature"]; status != "passed" {
+				t.Errorf("%s signature check status = %q, want \"passed\"", cmd, status)
+			}
+			validation := statuses(got.Validation)
+			for name, want := range tc.wantValidation {
+				if validation[name] != want {
+					t.Errorf("%s %s check status = %q, want %q", cmd, name, validation[name], want)
+				}
+			}
+			var roles []string
+			for _, c := range got.Certificates {
+				roles = append(roles, c.Role)
+			}
+			if fmt.Sprint(roles) != "[ARK ASK VCEK]" {
+				t.Errorf("%s certificate roles = %v, want [ARK ASK VCEK]", cmd, roles)
+			}
+		})
+	}
+}
+
+// testCertStore returns a certificate store directory with the certificates of the test
+// attestation, and the ASK and ARK.
+func testCertStore(t *testing.T) (dir string, ask, ark []byte) {
+	t.Helper()
+	ask, ark, err := kds.ParseProductCertChain(trust.AskArkMilanVcekBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chipID, _ := hex.DecodeString(goodChipID)
+	dir = t.TempDir()
+	store := &trust.FileCertStore{Dir: dir}
+	for key, der := range map[string][]byte{
+		trust.VcekStoreKey("Milan", chipID, goodTcb):     testdata.VcekBytes,
+		trust.AskStoreKey("Milan", abi.VcekReportSigner): ask,
+		trust.ArkStoreKey("Milan", abi.VcekReportSigner): ark,
+	} {
+		if err := store.Store(key, der); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, ask, ark
+}
+
+func TestOffline(t *testing.T) {
+	fullStore, ask, ark := testCertStore(t)
+	report, err := abi.ReportToProto(testdata.AttestationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := &verify.Bundle{
+		Attestation: &spb.Attestation{
+			Report:           report,
+			CertificateChain: &spb.CertificateChain{VcekCert: testdata.VcekBytes, AskCert: ask, ArkCert: ark},
+		},
+		Timestamp: time.Now(),
+	}
+	archive, err := bundle.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := path.Join(t.TempDir(), "bundle.tar")
+	if err := os.WriteFile(bundlePath, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+	in := []string{"-in", "../../verify/testdata/attestation.bin"}
+
+	tcs := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{name: "store", args: append(in, "-offline", "-cert_store", fullStore)},
+		{
+			name:       "empty store",
+			args:       append(in, "-offline", "-cert_store", t.TempDir()),
+			wantCode:   exitCerts,
+			wantStderr: "cannot answer https://kdsintf.amd.com/vcek/v1/Milan/cert_chain offline",
+		},
+		{
+			name:       "crl not stored",
+			args:       append(in, "-offline", "-cert_store", fullStore, "-check_crl=true"),
+			wantCode:   exitCrl,
+			wantStderr: "cannot answer https://kdsintf.amd.com/vcek/v1/Milan/crl offline",
+		},
+		{name: "bundle", args: []string{"-bundle", bundlePath}},
+		{name: "bundle at timestamp", args: []string{"-bundle", bundlePath, "-bundle_at_timestamp"}},
+		{
+			name:       "bundle without crl",
+			args:       []string{"-bundle", bundlePath, "-check_crl=true"},
+			wantCode:   exitVerify,
+			wantStderr: "bundle has no CRL",
+		},
+		{
+			name:       "offline with mirrors",
+			args:       append(in, "-offline", "-kds_mirrors", "https://kds-mirror.example.com"),
+			wantCode:   exitTool,
+			wantStderr: "cannot be used with -kds_mirrors",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append([]string{fmt.Sprintf("-guest_policy=%d", goodPolicy), "--product_name=Milan-B0"}, tc.args...)
+			cmd := exec.Command(check, args...)
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+			gotCode := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				gotCode = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("%s = %v", cmd, err)
+			}
+			if gotCode != tc.wantCode {
+				t.Errorf("%s exit code = %d, want %d. Stderr: %s", cmd, gotCode, tc.wantCode, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tc.wantStderr) {
+				t.Errorf("%s stderr = %q, want it to contain %q", cmd, stderr.String(), tc.wantStderr)
+			}
+		})
+	}
+}
+
+func TestInputErrorExitCode(t *testing.T) {
+	withTempFile([]byte("not an attestation"), t, func(path string) {
+		for _, args := range [][]string{
+			{"-in", path},
+			{"-in", path, "-inform", "textproto"},
+			{"-in", "../../verify/testdata/attestation.bin", "-config", path + ".textproto"},
+			{"-bundle", path},
+		} {
+			cmd := exec.Command(check, args...)
+			var exitErr *exec.ExitError
+			if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitInput {
+				t.Errorf("%s = %v, want exit code %d", cmd, err, exitInput)
+			}
+		}
+	})
+}
+
+func TestBatch(t *testing.T) {
+	store, _, _ := testCertStore(t)
+	dir := t.TempDir()
+	for name, contents := range map[string][]byte{
+		"a.bin":       testdata.AttestationBytes,
+		"b.bin":       testdata.AttestationBytes,
+		"sub/c.bin":   testdata.AttestationBytes,
+		"garbage.bin": []byte("not an attestation"),
+	} {
+		p := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := path.Join(t.TempDir(), "list")
+	listed := "# good\n" + path.Join(dir, "a.bin") + "\n\n" + path.Join(dir, "sub/c.bin") + "\n"
+	if err := os.WriteFile(list, []byte(listed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name     string
+		args     []string
+		wantCode int
+		want     batchSummary
+	}{
+		{
+			name:     "dir",
+			args:     []string{"-in_dir", dir},
+			wantCode: exitBatch,
+			want:     batchSummary{Total: 4, Passed: 3, Errors: 1, ByExitCode: map[string]int{"6": 1}},
+		},
+		{
+			name: "list",
+			args: []string{"-in_list", list},
+			want: batchSummary{Total: 2, Passed: 2, ByExitCode: map[string]int{}},
+		},
+		{
+			name:     "policy",
+			args:     []string{"-in_list", list, "-vmpl=3"},
+			wantCode: exitBatch,
+			want:     batchSummary{Total: 2, Failed: 2, ByExitCode: map[string]int{"5": 2}},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append([]string{fmt.Sprintf("-guest_policy=%d", goodPolicy), "--product_name=Milan-B0",
+				"-offline", "-cert_store", store, "-output=json", "-workers=2"}, tc.args...)
+			cmd := exec.Command(check, args...)
+			var stdout bytes.Buffer
+			cmd.Stdout = &stdout
+			err := cmd.Run()
+			gotCode := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				gotCode = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("%s = %v", cmd, err)
+			}
+			if gotCode != tc.wantCode {
+				t.Errorf("%s exit code = %d, want %d", cmd, gotCode, tc.wantCode)
+			}
+			var got batchReport
+			if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+				t.Fatalf("%s output %q is not a batch report: %v", cmd, stdout.String(), err)
+			}
+			got.Summary.TotalMs = 0
+			if diff := cmp.Diff(got.Summary, tc.want); diff != "" {
+				t.Errorf("%s summary differs: %s", cmd, diff)
+			}
+			if len(got.Results) != tc.want.Total {
+				t.Errorf("%s has %d results, want %d", cmd, len(got.Results), tc.want.Total)
+			}
+		})
+	}
+
+	cmd := exec.Command(check, "-in_dir", dir, "-in", path.Join(dir, "a.bin"))
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitTool {
+		t.Errorf("%s = %v, want exit code %d", cmd, err, exitTool)
+	}
+}
+
+func TestServe(t *testing.T) {
+	dir, _, _ := testCertStore(t)
+	product, err := kds.ParseProductName("Milan-B0", abi.VcekReportSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sopts := &verify.Options{Product: product, Getter: &mirror.Getter{Store: &trust.FileCertStore{Dir: dir}}}
+	passOpts, err := validate.PolicyToOptions(&checkpb.Policy{Policy: goodPolicy, Product: product})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failOpts, err := validate.PolicyToOptions(&checkpb.Policy{Policy: goodPolicy, Product: product, Vmpl: wrapperspb.UInt32(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := abi.ReportToProto(testdata.AttestationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation := &spb.Attestation{Report: report}
+	pass := &checker{sopts: sopts, opts: passOpts}
+	fail := &checker{sopts: sopts, opts: failOpts}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newGRPCServer(pass, nil)
+	go server.Serve(lis)
+	defer server.Stop()
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	req := &checkpb.CheckRequest{Evidence: &checkpb.CheckRequest_Attestation{Attestation: attestation}}
+	resp, err := checkpb.NewCheckerClient(conn).Check(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Check() = _, %v", err)
+	}
+	if resp.GetResult() != "pass" {
+		t.Errorf("gRPC Check() = %v, want pass", resp)
+	}
+
+	jsonReq, err := protojson.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		name        string
+		checker     *checker
+		method      string
+		contentType string
+		body        []byte
+		wantStatus  int
+		wantCode    int32
+	}{
+		{name: "bin", checker: pass, body: testdata.AttestationBytes, wantStatus: http.StatusOK},
+		{name: "json", checker: pass, contentType: "application/json", body: jsonReq, wantStatus: http.StatusOK},
+		{name: "policy", checker: fail, contentType: "application/json", body: jsonReq, wantStatus: http.StatusOK, wantCode: exitPolicy},
+		{name: "garbage", checker: pass, body: []byte("not an attestation"), wantStatus: http.StatusBadRequest, wantCode: exitInput},
+		{name: "empty request", checker: pass, contentType: "application/json", body: []byte("{}"), wantStatus: http.StatusOK, wantCode: exitInput},
+		{name: "get", checker: pass, method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			r := httptest.NewRequest(method, "/v1/check", bytes.NewReader(tc.body))
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			tc.checker.ServeHTTP(w, r)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("%s /v1/check status = %d, want %d. Body: %s", method, w.Code, tc.wantStatus, w.Body.String())
+			}
+			if tc.wantStatus == http.StatusMethodNotAllowed {
+				return
+			}
+			got := &checkpb.CheckResponse{}
+			if err := protojson.Unmarshal(w.Body.Bytes(), got); err != nil {
+				t.Fatalf("response %q is not a check.CheckResponse: %v", w.Body.String(), err)
+			}
+			if got.GetExitCode() != tc.wantCode {
+				t.Errorf("response = %v, want exit code %d", got, tc.wantCode)
+			}
+		})
+	}
+}
+
+// writeServerCert writes a self-signed certificate for 127.0.0.1 and its key to dir and returns
+// their paths and a pool that trusts the certificate.
+func writeServerCert(t *testing.T, dir string) (string, string, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := path.Join(dir, "server.pem"), path.Join(dir, "server.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return certPath, keyPath, pool
+}
+
+func TestServeTLS(t *testing.T) {
+	dir, _, _ := testCertStore(t)
+	product, err := kds.ParseProductName("Milan-B0", abi.VcekReportSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := validate.PolicyToOptions(&checkpb.Policy{Policy: goodPolicy, Product: product})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &checker{sopts: &verify.Options{Product: product, Getter: &mirror.Getter{Store: &trust.FileCertStore{Dir: dir}}}, opts: opts}
+	certPath, keyPath, pool := writeServerCert(t, t.TempDir())
+	if _, err := serveTLSConfig(certPath, ""); !fakesev.Match(err, "must be given together") {
+		t.Errorf("serveTLSConfig(%q, \"\") = _, %v, want an error for the missing key", certPath, err)
+	}
+	tlsConfig, err := serveTLSConfig(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConfig := &tls.Config{RootCAs: pool}
+
+	grpcLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := newGRPCServer(c, tlsConfig)
+	go grpcServer.Serve(grpcLis)
+	defer grpcServer.Stop()
+	conn, err := grpc.Dial(grpcLis.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientConfig)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	report, err := abi.ReportToProto(testdata.AttestationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &checkpb.CheckRequest{Evidence: &checkpb.CheckRequest_Attestation{Attestation: &spb.Attestation{Report: report}}}
+	if resp, err := checkpb.NewCheckerClient(conn).Check(context.Background(), req); err != nil || resp.GetResult() != "pass" {
+		t.Errorf("gRPC Check() over TLS = %v, %v, want pass", resp, err)
+	}
+
+	httpLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := newHTTPServer(c, tlsConfig)
+	go httpServer.ServeTLS(httpLis, "", "")
+	defer httpServer.Close()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+	httpResp, err := client.Post("https://"+httpLis.Addr().String()+"/v1/check", "application/octet-stream", bytes.NewReader(testdata.AttestationBytes))
+	if err != nil {
+		t.Fatalf("POST /v1/check over TLS = _, %v", err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		t.Errorf("POST /v1/check over TLS status = %d, want %d", httpResp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestInvalidOutput(t *testing.T) {
+	cmd := exec.Command(check, "-output=xml")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitTool {
+		t.Errorf("%s = %v, want exit code %d", cmd, err, exitTool)
+	}
+	if want := `-output="xml" is not one of`; !strings.Contains(stderr.String(), want) {
+		t.Errorf("%s stderr = %q, want it to contain %q", cmd, stderr.String(), want)
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	measurementHex := strings.Repeat("ab", abi.MeasurementSize)
+	dir := t.TempDir()
+	configPath := path.Join(dir, "policy.yaml")
+	if err := os.WriteFile(configPath, []byte("policy:\n  measurement: "+measurementHex+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"textproto", "json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			cmd := exec.Command(check, "-config", configPath, "-vmpl=1", "-print_config="+format)
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("%s = %v", cmd, err)
+			}
+			formats := map[string]policyfile.Format{"textproto": policyfile.Textproto, "json": policyfile.JSON, "yaml": policyfile.YAML}
+			got, err := policyfile.Unmarshal(out, formats[format])
+			if err != nil {
+				t.Fatalf("%s output %q does not parse: %v", cmd, out, err)
+			}
+			if hex.EncodeToString(got.GetPolicy().GetMeasurement()) != measurementHex || got.GetPolicy().GetVmpl().GetValue() != 1 {
+				t.Errorf("%s = %v, want the config's measurement and the flag's VMPL", cmd, got)
+			}
+			if !got.GetRootOfTrust().GetCheckCrl() {
+				t.Errorf("%s = %v, want the YAML default check_crl: true", cmd, got)
+			}
+		})
+	}
+	cmd := exec.Command(check, "-print_config=toml")
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitTool {
+		t.Errorf("%s = %v, want exit code %d", cmd, err, exitTool)
+	}
+}
+
+func TestTCBPartsFlags(t *testing.T) {
+	// goodTcb is 0x4405000000000002 in the Milan TCB layout.
+	for _, tc := range []struct {
+		tcb      string
+		wantExit int
+	}{
+		{tcb: "blSPL=2&snpSPL=5&ucodeSPL=68"},
+		{tcb: "snpSPL=5"},
+		{tcb: "blSPL=3", wantExit: exitPolicy},
+	} {
+		t.Run(tc.tcb, func(t *testing.T) {
+			cmd := exec.Command(check, withBaseArgs("", "-minimum_tcb="+tc.tcb, "--product_name=Milan-B0")...)
+			output, err := cmd.CombinedOutput()
+			var exitErr *exec.ExitError
+			if tc.wantExit == 0 && err != nil {
+				t.Errorf("%s = %v, %s. Want success", cmd, err, output)
+			} else if tc.wantExit != 0 && (!errors.As(err, &exitErr) || exitErr.ExitCode() != tc.wantExit) {
+				t.Errorf("%s = %v, %s. Want exit code %d", cmd, err, output, tc.wantExit)
+			}
+		})
+	}
+
+	cmd := exec.Command(check, "-minimum_launch_tcb=fmcSPL=1&blSPL=2", "--product_name=Turin-B1", "-print_config=textproto")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%s = %v", cmd, err)
+	}
+	got, err := policyfile.Unmarshal(out, policyfile.Textproto)
+	if err != nil {
+		t.Fatalf("%s output %q does not parse: %v", cmd, out, err)
+	}
+	parts := got.GetPolicy().GetMinimumLaunchTcbParts()
+	if parts.GetFmcSpl() != 1 || parts.GetBlSpl() != 2 || got.GetPolicy().GetMinimumLaunchTcb() != 0 {
+		t.Errorf("%s = %v, want minimum_launch_tcb_parts {fmc_spl: 1 bl_spl: 2}", cmd, got)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"time"
+
+	checkpb "github.com/google/go-sev-guest/proto/check"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/google/go-sev-guest/tools/lib/report"
+	"github.com/google/go-sev-guest/validate"
+	"github.com/google/go-sev-guest/verify"
+	"github.com/google/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxRequestSize bounds REST request bodies. Bundles with CRLs are the largest requests.
+const maxRequestSize = 16 << 20
+
+// The REST timeouts bound how long a client may hold a connection. Writing the response waits for
+// the check, which may fetch certificates and CRLs with retries.
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = time.Minute
+	httpWriteTimeout      = 5 * time.Minute
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// checker checks attestations for -serve with the options built at startup. Its verify options
+// have a certificate store, so that certificates that one request fetches serve later requests.
+type checker struct {
+	checkpb.UnimplementedCheckerServer
+	sopts *verify.Options
+	opts  *validate.Options
+}
+
+func response(exitCode int, err error) *checkpb.CheckResponse {
+	result := &batchFileResult{}
+	result.finish(exitCode, err)
+	return &checkpb.CheckResponse{Result: result.Result, ExitCode: int32(exitCode), Error: result.Error}
+}
+
+// Check verifies and validates the request's attestation. An attestation that does not pass is
+// a response rather than an error, so that clients get its exit code.
+func (c *checker) Check(ctx context.Context, req *checkpb.CheckRequest) (*checkpb.CheckResponse, error) {
+	// Verification refines the product expectation, so each request gets its own.
+	sopts := *c.sopts
+	if c.sopts.Product != nil {
+		sopts.Product = proto.Clone(c.sopts.Product).(*spb.SevProduct)
+	}
+	var attestation *spb.Attestation
+	var err error
+	switch evidence := req.GetEvidence().(type) {
+	case *checkpb.CheckRequest_Attestation:
+		attestation = evidence.Attestation
+		err = verify.SnpAttestationContext(ctx, attestation, &sopts)
+	case *checkpb.CheckRequest_Bundle:
+		bundle, berr := verify.UnmarshalBundle(evidence.Bundle)
+		if berr != nil {
+			return response(exitInput, berr), nil
+		}
+		attestation = bundle.Attestation
+		err = verify.SnpBundleContext(ctx, bundle, &sopts)
+	default:
+		return response(exitInput, errors.New("request has neither an attestation nor a bundle")), nil
+	}
+	if err != nil {
+		return response(verifyExitCode(err), fmt.Errorf("could not verify attestation signature: %v", err)), nil
+	}
+	if err := validate.SnpAttestation(attestation, c.opts); err != nil {
+		return response(exitPolicy, fmt.Errorf("error validating attestation: %v", err)), nil
+	}
+	return response(0, nil), nil
+}
+
+// parseRequest reads a REST request body. A JSON body is a check.CheckRequest in the protobuf JSON
+// mapping. Any other body is an attestation in a format that -inform accepts.
+func parseRequest(r *http.Request) (*checkpb.CheckRequest, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read request: %v", err)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		req := &checkpb.CheckRequest{}
+		if err := protojson.Unmarshal(body, req); err != nil {
+			return nil, fmt.Errorf("could not parse check.CheckRequest: %v", err)
+		}
+		return req, nil
+	}
+	attestation, err := report.ParseAttestation(body, "auto")
+	if err != nil {
+		return nil, err
+	}
+	return &checkpb.CheckRequest{Evidence: &checkpb.CheckRequest_Attestation{Attestation: attestation}}, nil
+}
+
+// ServeHTTP answers POST requests to /v1/check with a check.CheckResponse in the protobuf JSON
+// mapping. It answers 400 Bad Request for requests that do not parse, and 200 OK otherwise, even
+// for attestations that do not pass.
+func (c *checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/check" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	status := http.StatusOK
+	var resp *checkpb.CheckResponse
+	req, err := parseRequest(r)
+	if err != nil {
+		status = http.StatusBadRequest
+		resp = response(exitInput, err)
+	} else {
+		resp, _ = c.Check(r.Context(), req)
+	}
+	out, err := protojson.Marshal(resp)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not marshal response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// serveTLSConfig returns the TLS configuration for -serve to present the certificate chain at
+// certPath with the private key at keyPath, or nil for plaintext if both are empty.
+func serveTLSConfig(certPath, keyPath string) (*tls.Config, error) {
+	if certPath == "" && keyPath == "" {
+		return nil, nil
+	}
+	if certPath == "" || keyPath == "" {
+		return nil, errors.New("-serve_tls_cert and -serve_tls_key must be given together")
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS server certificate: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// newGRPCServer returns a gRPC server of the check.Checker service with c. The server uses TLS if
+// tlsConfig is not nil.
+func newGRPCServer(c *checker, tlsConfig *tls.Config) *grpc.Server {
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	checkpb.RegisterCheckerServer(server, c)
+	return server
+}
+
+// newHTTPServer returns a REST server of c. It uses TLS when it serves with ServeTLS.
+func newHTTPServer(c *checker, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Handler:           c,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		WriteTimeout:      httpWriteTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+}
+
+// serve answers check requests with c over REST on httpAddr and gRPC on grpcAddr until either
+// fails. An empty address disables its protocol. Both protocols use TLS if tlsConfig is not nil.
+func serve(c *checker, httpAddr, grpcAddr string, tlsConfig *tls.Config) error {
+	if httpAddr == "" && grpcAddr == "" {
+		return errors.New("-serve needs -http_addr or -grpc_addr")
+	}
+	errs := make(chan error, 2)
+	if grpcAddr != "" {
+		lis, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			return fmt.Errorf("could not listen on %s: %v", grpcAddr, err)
+		}
+		server := newGRPCServer(c, tlsConfig)
+		logger.Infof("Serving check.Checker over gRPC on %s", lis.Addr())
+		go func() { errs <- server.Serve(lis) }()
+	}
+	if httpAddr != "" {
+		lis, err := net.Listen("tcp", httpAddr)
+		if err != nil {
+			return fmt.Errorf("could not listen on %s: %v", httpAddr, err)
+		}
+		server := newHTTPServer(c, tlsConfig)
+		logger.Infof("Serving /v1/check on %s", lis.Addr())
+		go func() {
+			if tlsConfig != nil {
+				errs <- server.ServeTLS(lis, "", "")
+				return
+			}
+			errs <- server.Serve(lis)
+		}()
+	}
+	return <-errs
+}
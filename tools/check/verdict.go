@@ -0,0 +1,159 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/google/go-sev-guest/validate"
+	"github.com/google/go-sev-guest/verify"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// verdictCheck is the outcome of one verification or validation check in a JSON verdict.
+type verdictCheck struct {
+	Name string `json:"name"`
+	// Status is one of "passed", "failed", or "skipped".
+	Status  string   `json:"status"`
+	Details []string `json:"details,omitempty"`
+}
+
+// verdictCert identifies a certificate of the attestation's chain in a JSON verdict.
+type verdictCert struct {
+	Role      string    `json:"role"`
+	Subject   string    `json:"subject"`
+	Serial    string    `json:"serial"`
+	SHA256    string    `json:"sha256"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// verdictTiming is how long each stage took, in milliseconds.
+type verdictTiming struct {
+	VerifyMs   float64 `json:"verify_ms"`
+	ValidateMs float64 `json:"validate_ms"`
+	TotalMs    float64 `json:"total_ms"`
+}
+
+// verdict is the -output=json report of a check tool run.
+type verdict struct {
+	// Result is "pass", "fail" for an attestation that did not verify or validate, or "error" when
+	// the tool could not check the attestation.
+	Result       string         `json:"result"`
+	ExitCode     int            `json:"exit_code"`
+	Error        string         `json:"error,omitempty"`
+	Verification []verdictCheck `json:"verification"`
+	Validation   []verdictCheck `json:"validation"`
+	Certificates []verdictCert  `json:"certificates"`
+	Timing       verdictTiming  `json:"timing"`
+}
+
+// runVerdict collects the verdict of this run for -output=json.
+var runVerdict = &verdict{Verification: []verdictCheck{}, Validation: []verdictCheck{}, Certificates: []verdictCert{}}
+
+var startTime = time.Now()
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (v *verdict) addVerification(res *verify.Result) {
+	for _, c := range res.Checks {
+		check := verdictCheck{Name: string(c.Check), Status: "failed"}
+		switch {
+		case c.Skipped:
+			check.Status = "skipped"
+		case c.Passed:
+			check.Status = "passed"
+		default:
+			check.Details = []string{c.Detail}
+		}
+		v.Verification = append(v.Verification, check)
+	}
+}
+
+func (v *verdict) addValidation(res *validate.Result) {
+	for _, c := range res.Checks {
+		check := verdictCheck{Name: string(c.Check), Status: "passed", Details: c.Violations}
+		if !c.Passed {
+			check.Status = "failed"
+		}
+		v.Validation = append(v.Validation, check)
+	}
+}
+
+// addCertificates identifies the certificates of chain that parse.
+func (v *verdict) addCertificates(chain *spb.CertificateChain) {
+	for _, c := range []struct {
+		role string
+		der  []byte
+	}{
+		{"ARK", chain.GetArkCert()},
+		{"ASK", chain.GetAskCert()},
+		{"VCEK", chain.GetVcekCert()},
+		{"VLEK", chain.GetVlekCert()},
+	} {
+		if len(c.der) == 0 {
+			continue
+		}
+		cert, err := x509.ParseCertificate(c.der)
+		if err != nil {
+			continue
+		}
+		fingerprint := sha256.Sum256(c.der)
+		v.Certificates = append(v.Certificates, verdictCert{
+			Role:      c.role,
+			Subject:   cert.Subject.String(),
+			Serial:    cert.SerialNumber.Text(16),
+			SHA256:    hex.EncodeToString(fingerprint[:]),
+			NotBefore: cert.NotBefore.UTC(),
+			NotAfter:  cert.NotAfter.UTC(),
+		})
+	}
+}
+
+// writeVerdict finishes the verdict with the run's outcome and writes it to stdout.
+func writeVerdict(err error, exitCode int) {
+	runVerdict.ExitCode = exitCode
+	switch exitCode {
+	case 0:
+		runVerdict.Result = "pass"
+	case exitVerify, exitPolicy:
+		runVerdict.Result = "fail"
+	default:
+		runVerdict.Result = "error"
+	}
+	if err != nil {
+		runVerdict.Error = err.Error()
+	}
+	runVerdict.Timing.TotalMs = milliseconds(time.Since(startTime))
+	out, merr := json.MarshalIndent(runVerdict, "", "  ")
+	if merr != nil {
+		fmt.Fprintf(os.Stderr, "could not marshal verdict: %v\n", merr)
+		return
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", out)
+}
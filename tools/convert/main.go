@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// convert converts an attestation between its encodings, checking the format invariants.
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/google/go-sev-guest/tools/lib/report"
+	"github.com/google/logger"
+)
+
+var (
+	infile = flag.String("in", "-", "Path to the attestation file, or - for stdin.")
+	inform = flag.String("inform", "auto", "Format of the attestation file. "+
+		"One of auto, bin, proto, textproto, json, pem. Auto detects the format.")
+	outfile = flag.String("out", "-", "Path to the output file, or - for stdout.")
+	outform = flag.String("outform", "textproto", "Format of the output file. "+
+		"One of bin, proto, textproto, json, pem.")
+)
+
+func main() {
+	logger.Init("", false, false, os.Stderr)
+	flag.Parse()
+
+	switch *outform {
+	case "bin", "proto", "textproto", "json", "pem":
+	default:
+		logger.Fatalf("-outform is %s. Expect \"bin\", \"proto\", \"textproto\", \"json\", or \"pem\"", *outform)
+	}
+
+	in := os.Stdin
+	if *infile != "-" {
+		file, err := os.Open(*infile)
+		if err != nil {
+			logger.Fatalf("could not open %q: %v", *infile, err)
+		}
+		defer file.Close()
+		in = file
+	}
+	contents, err := io.ReadAll(in)
+	if err != nil {
+		logger.Fatalf("could not read %q: %v", *infile, err)
+	}
+	out, err := report.Convert(contents, *inform, *outform)
+	if err != nil {
+		logger.Fatalf("could not convert %q: %v", *infile, err)
+	}
+
+	if *outfile == "-" {
+		os.Stdout.Write(out)
+		return
+	}
+	if err := os.WriteFile(*outfile, out, 0644); err != nil {
+		logger.Fatalf("could not write %q: %v", *outfile, err)
+	}
+}
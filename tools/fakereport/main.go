@@ -0,0 +1,288 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// fakereport generates signed attestation reports with matching test-only ARK, ASK, and VCEK or
+// VLEK certificates and certificate tables, so that projects can test attestation verification
+// without SEV-SNP hardware. The keys are published in this module, so nothing must trust them.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/kds"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	test "github.com/google/go-sev-guest/testing"
+	"github.com/google/logger"
+	"google.golang.org/protobuf/encoding/prototext"
+)
+
+var (
+	// The testing package defines -product_name for the fake chip's KDS product name.
+	signer = flag.String("signer", "vcek", "The key that signs the report. One of \"vcek\" or \"vlek\".")
+	tcbS   = flag.String("tcb", "0",
+		"The TCB version of the report and certificate, as a number or as KDS URL query arguments, e.g., blSPL=3&snpSPL=8&ucodeSPL=115.")
+	chipIDS     = flag.String("chip_id", "", "The hex-encoded CHIP_ID of the report. Zero-padded to 64 bytes. Default all zeros.")
+	reportData  = flag.String("report_data", "", "The hex-encoded REPORT_DATA of the report. Zero-padded to 64 bytes.")
+	measurement = flag.String("measurement", "", "The hex-encoded MEASUREMENT of the report. Zero-padded to 48 bytes.")
+	hostData    = flag.String("host_data", "", "The hex-encoded HOST_DATA of the report. Zero-padded to 32 bytes.")
+	policy      = flag.String("policy", "0x30000", "The 64-bit guest POLICY of the report.")
+	vmpl        = flag.Uint("vmpl", 0, "The VMPL of the report [0-3].")
+	cspID       = flag.String("csp_id", "go-sev-guest", "The cloud service provider ID of the VLEK certificate.")
+	created     = flag.String("creation_time", "",
+		"The RFC 3339 time at which the certificates start to be valid. Default now.")
+	outDir  = flag.String("out_dir", "", "Path to the directory to write the fixtures to. Required.")
+	verbose = flag.Bool("v", false, "Enable verbose logging.")
+)
+
+// spec is what the fixtures attest to.
+type spec struct {
+	productName string
+	key         abi.ReportSigner
+	tcb         kds.TCBVersion
+	chipID      [abi.ChipIDSize]byte
+	reportData  [abi.ReportDataSize]byte
+	measurement [abi.MeasurementSize]byte
+	hostData    [abi.HostDataSize]byte
+	policy      uint64
+	vmpl        uint32
+	cspID       string
+	created     time.Time
+}
+
+// fixtures are the generated report and its certificates.
+type fixtures struct {
+	signer *test.AmdSigner
+	// report is the signed report in AMD's binary format.
+	report    []byte
+	certTable []byte
+}
+
+// generate returns a report that s describes, signed by test-only keys with certificates for the
+// report's chip and TCB.
+func generate(s *spec) (*fixtures, error) {
+	product, err := kds.ParseProductName(s.productName, abi.VcekReportSigner)
+	if err != nil {
+		return nil, err
+	}
+	parts := kds.DecomposeTCBVersionForProduct(s.tcb, product.Name)
+	hwid := s.chipID[:kds.HWIDSize(kds.ProductLine(product))]
+	b := &test.AmdSignerBuilder{
+		Keys:             test.DefaultAmdKeys(),
+		ProductName:      s.productName,
+		CSPID:            s.cspID,
+		ArkCreationTime:  s.created,
+		AskCreationTime:  s.created,
+		AsvkCreationTime: s.created,
+		VcekCreationTime: s.created,
+		VlekCreationTime: s.created,
+		VcekCustom:       test.CertOverride{Extensions: test.CustomExtensions(parts, hwid, "", s.productName)},
+		VlekCustom:       test.CertOverride{Extensions: test.CustomExtensions(parts, nil, s.cspID, s.productName)},
+		HWID:             s.chipID,
+		TCB:              s.tcb,
+	}
+	amdSigner, err := b.TestOnlyCertChain()
+	if err != nil {
+		return nil, err
+	}
+	amdSigner.Product = product
+
+	raw := test.CreateRawReport(&test.TestReportOptions{
+		ReportData: s.reportData[:],
+		SignerInfo: abi.SignerInfo{SigningKey: s.key},
+		FMS:        abi.MaskedCpuid1EaxFromSevProduct(product),
+		Version:    3,
+	})
+	report, err := abi.ReportToProto(raw[:abi.ReportSize])
+	if err != nil {
+		return nil, err
+	}
+	report.Policy = s.policy
+	report.Vmpl = s.vmpl
+	report.CurrentTcb = uint64(s.tcb)
+	report.CommittedTcb = uint64(s.tcb)
+	report.ReportedTcb = uint64(s.tcb)
+	report.LaunchTcb = uint64(s.tcb)
+	report.ChipId = s.chipID[:]
+	report.Measurement = s.measurement[:]
+	report.HostData = s.hostData[:]
+	unsigned, err := abi.ReportToAbiBytes(report)
+	if err != nil {
+		return nil, err
+	}
+	r, sig, err := amdSigner.Sign(abi.SignedComponent(unsigned))
+	if err != nil {
+		return nil, fmt.Errorf("could not sign report: %v", err)
+	}
+	if err := abi.SetSignature(r, sig, unsigned); err != nil {
+		return nil, fmt.Errorf("could not set signature: %v", err)
+	}
+	certTable, err := amdSigner.CertTableBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &fixtures{signer: amdSigner, report: unsigned, certTable: certTable}, nil
+}
+
+// attestation returns the fixtures as an Attestation message.
+func (f *fixtures) attestation() (*spb.Attestation, error) {
+	report, err := abi.ReportToProto(f.report)
+	if err != nil {
+		return nil, err
+	}
+	certs := new(abi.CertTable)
+	if err := certs.Unmarshal(f.certTable); err != nil {
+		return nil, err
+	}
+	return &spb.Attestation{Report: report, CertificateChain: certs.Proto(), Product: f.signer.Product}, nil
+}
+
+func pemCerts(ders ...[]byte) []byte {
+	var out []byte
+	for _, der := range ders {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return out
+}
+
+// write writes the fixtures to dir:
+//
+//	attestation.bin       the report followed by its certificate table, as from attest -extended
+//	attestation.textproto the report and certificates as an Attestation message
+//	report.bin            the report alone
+//	certtable.bin         the certificate table alone
+//	ark.pem, ask.pem, asvk.pem, vcek.pem, vlek.pem
+//	cert_chain.pem        the ASK or ASVK of the signer, then the ARK, e.g., for check -product_key_path
+func (f *fixtures) write(dir string, key abi.ReportSigner) error {
+	attestation, err := f.attestation()
+	if err != nil {
+		return err
+	}
+	text, err := prototext.MarshalOptions{Multiline: true}.Marshal(attestation)
+	if err != nil {
+		return err
+	}
+	ica := f.signer.Ask
+	if key == abi.VlekReportSigner {
+		ica = f.signer.Asvk
+	}
+	files := map[string][]byte{
+		"attestation.bin":       append(append([]byte{}, f.report...), f.certTable...),
+		"attestation.textproto": text,
+		"report.bin":            f.report,
+		"certtable.bin":         f.certTable,
+		"ark.pem":               pemCerts(f.signer.Ark.Raw),
+		"ask.pem":               pemCerts(f.signer.Ask.Raw),
+		"asvk.pem":              pemCerts(f.signer.Asvk.Raw),
+		"vcek.pem":              pemCerts(f.signer.Vcek.Raw),
+		"vlek.pem":              pemCerts(f.signer.Vlek.Raw),
+		"cert_chain.pem":        pemCerts(ica.Raw, f.signer.Ark.Raw),
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), contents, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hexInto decodes the hex string s into dest, which is zero-padded.
+func hexInto(dest []byte, name, s string) error {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("%s is not hex: %v", name, err)
+	}
+	if len(b) > len(dest) {
+		return fmt.Errorf("%s is %d bytes, want at most %d", name, len(b), len(dest))
+	}
+	copy(dest, b)
+	return nil
+}
+
+func parseSpec() (*spec, error) {
+	s := &spec{productName: test.GetProductName(), cspID: *cspID, vmpl: uint32(*vmpl), created: time.Now()}
+	switch *signer {
+	case "vcek":
+		s.key = abi.VcekReportSigner
+	case "vlek":
+		s.key = abi.VlekReportSigner
+	default:
+		return nil, fmt.Errorf("-signer=%q is not one of \"vcek\" or \"vlek\"", *signer)
+	}
+	if *vmpl > 3 {
+		return nil, fmt.Errorf("-vmpl=%d is not in [0-3]", *vmpl)
+	}
+	tcb, err := kds.ParseTCBVersion(kds.ProductLineOfProductName(s.productName), *tcbS)
+	if err != nil {
+		return nil, err
+	}
+	s.tcb = tcb
+	if s.policy, err = strconv.ParseUint(*policy, 0, 64); err != nil {
+		return nil, fmt.Errorf("-policy=%q is not a 64-bit number: %v", *policy, err)
+	}
+	if _, err := abi.ParseSnpPolicy(s.policy); err != nil {
+		return nil, err
+	}
+	if *created != "" {
+		if s.created, err = time.Parse(time.RFC3339, *created); err != nil {
+			return nil, fmt.Errorf("-creation_time=%q is not an RFC 3339 time: %v", *created, err)
+		}
+	}
+	for _, field := range []struct {
+		dest  []byte
+		name  string
+		value string
+	}{
+		{s.chipID[:], "-chip_id", *chipIDS},
+		{s.reportData[:], "-report_data", *reportData},
+		{s.measurement[:], "-measurement", *measurement},
+		{s.hostData[:], "-host_data", *hostData},
+	} {
+		if err := hexInto(field.dest, field.name, field.value); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func main() {
+	logger.Init("", *verbose, false, os.Stderr)
+	flag.Parse()
+
+	if *outDir == "" {
+		logger.Fatal("-out_dir is required")
+	}
+	s, err := parseSpec()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	f, err := generate(s)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if err := f.write(*outDir, s.key); err != nil {
+		logger.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote a %s report signed by TEST-ONLY keys to %s\n", s.productName, *outDir)
+}
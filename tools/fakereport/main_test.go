@@ -0,0 +1,90 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/kds"
+	"github.com/google/go-sev-guest/tools/lib/report"
+	"github.com/google/go-sev-guest/verify"
+	"github.com/google/go-sev-guest/verify/trust"
+)
+
+func TestGenerate(t *testing.T) {
+	tcs := []struct {
+		productName string
+		key         abi.ReportSigner
+		parts       kds.TCBParts
+	}{
+		{productName: "Milan-B1", key: abi.VcekReportSigner, parts: kds.TCBParts{BlSpl: 3, SnpSpl: 8, UcodeSpl: 115}},
+		{productName: "Genoa-B2", key: abi.VlekReportSigner, parts: kds.TCBParts{BlSpl: 7, SnpSpl: 14, UcodeSpl: 72}},
+		{productName: "Turin-B1", key: abi.VcekReportSigner, parts: kds.TCBParts{FmcSpl: 1, BlSpl: 1, SnpSpl: 3, UcodeSpl: 77}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.productName, func(t *testing.T) {
+			product, err := kds.ParseProductName(tc.productName, abi.VcekReportSigner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tcb, err := kds.ComposeTCBPartsForProduct(tc.parts, product.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &spec{productName: tc.productName, key: tc.key, tcb: tcb, policy: 0x30000, cspID: "go-sev-guest", created: time.Now()}
+			copy(s.chipID[:], bytes.Repeat([]byte{0xc1}, abi.ChipIDSize))
+			copy(s.reportData[:], "nonce")
+			f, err := generate(s)
+			if err != nil {
+				t.Fatalf("generate() = _, %v", err)
+			}
+			dir := t.TempDir()
+			if err := f.write(dir, tc.key); err != nil {
+				t.Fatalf("write() = %v", err)
+			}
+
+			attestation, err := report.ReadAttestation(filepath.Join(dir, "attestation.bin"), "bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain, err := os.ReadFile(filepath.Join(dir, "cert_chain.pem"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			productLine := kds.ProductLine(product)
+			if _, err := kds.ParseProductCertChainFor(productLine, tc.key, chain); err != nil {
+				t.Errorf("cert_chain.pem does not parse: %v", err)
+			}
+			root := trust.AMDRootCertsProduct(productLine)
+			root.ProductCerts = &trust.ProductCerts{Ark: f.signer.Ark, Ask: f.signer.Ask, Asvk: f.signer.Asvk}
+			opts := &verify.Options{
+				TrustedRoots:        map[string][]*trust.AMDRootCerts{productLine: {root}},
+				Product:             product,
+				DisableCertFetching: true,
+			}
+			if err := verify.SnpAttestation(attestation, opts); err != nil {
+				t.Errorf("SnpAttestation(attestation.bin) = %v, want nil", err)
+			}
+			if got := attestation.GetReport().GetReportedTcb(); got != uint64(tcb) {
+				t.Errorf("REPORTED_TCB = 0x%x, want 0x%x", got, uint64(tcb))
+			}
+		})
+	}
+}
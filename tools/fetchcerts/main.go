@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// fetchcerts fetches the certificates and CRL that verify an attestation report and writes them
+// with the report to a self-contained verify.Bundle archive for offline verification.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-sev-guest/tools/lib/report"
+	"github.com/google/go-sev-guest/verify"
+	"github.com/google/go-sev-guest/verify/trust"
+	"github.com/google/logger"
+)
+
+var (
+	infile = flag.String("in", "-", "Path to the attestation report to fetch certificates for. Stdin is \"-\".")
+	inform = flag.String("inform", "bin", "The input format for the attestation report. "+
+		"One of \"bin\", \"proto\", \"textproto\", \"json\", \"pem\".")
+	outfile = flag.String("out", "", "Path to write the bundle archive to. Required.")
+	crl     = flag.Bool("crl", true, "Fetch the product CRL, so that the bundle can be checked for revocations.")
+	thim    = flag.Bool("thim", false,
+		"Fetch the VCEK certificate and its chain from Azure THIM, falling back to the KDS for the rest. "+
+			"Only certifies the chip of the Azure VM that runs this tool.")
+	thimURL       = flag.String("thim_url", trust.DefaultTHIMURL, "The THIM certification endpoint for -thim.")
+	kdsMirrors    = flag.String("kds_mirrors", "", "Comma-separated base URLs of KDS mirrors to try before the AMD KDS.")
+	timeout       = flag.Duration("timeout", 2*time.Minute, "Duration to continue to retry failed HTTP requests.")
+	maxRetryDelay = flag.Duration("max_retry_delay", 30*time.Second, "Maximum Duration to wait between HTTP request retries.")
+	verbose       = flag.Bool("v", false, "Enable verbose logging.")
+)
+
+func getter() trust.HTTPSGetter {
+	var result trust.HTTPSGetter = &trust.SimpleHTTPSGetter{}
+	if *kdsMirrors != "" {
+		result = &trust.MirrorHTTPSGetter{
+			Mirrors:       strings.Split(*kdsMirrors, ","),
+			FallbackToKDS: true,
+			Getter:        result,
+		}
+	}
+	result = &trust.RetryHTTPSGetter{
+		Timeout:       *timeout,
+		MaxRetryDelay: *maxRetryDelay,
+		Getter:        result,
+	}
+	if *thim {
+		result = &trust.THIMGetter{URL: *thimURL, Fallback: result}
+	}
+	return result
+}
+
+func main() {
+	logger.Init("", *verbose, false, os.Stderr)
+	flag.Parse()
+
+	if *outfile == "" {
+		logger.Fatal("-out is required")
+	}
+	attestation, err := report.ReadAttestation(*infile, *inform)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	bundle, err := verify.CreateBundleContext(context.Background(), attestation, &verify.Options{
+		CheckRevocations: *crl,
+		Getter:           getter(),
+	})
+	if err != nil {
+		logger.Fatalf("could not fetch the certificates of the attestation: %v", err)
+	}
+	archive, err := bundle.Marshal()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if err := os.WriteFile(*outfile, archive, 0644); err != nil {
+		logger.Fatalf("could not write bundle to %q: %v", *outfile, err)
+	}
+	logger.Infof("Wrote bundle for offline verification to %s", *outfile)
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// kdsmirror serves a certificate store directory at the AMD KDS's paths as a local KDS mirror.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/go-sev-guest/kds/mirror"
+	"github.com/google/go-sev-guest/verify/trust"
+	"github.com/google/logger"
+)
+
+var (
+	storeDir = flag.String("store_dir", "", "Path to the trust.FileCertStore directory to serve. Required.")
+	addr     = flag.String("addr", "localhost:8080", "Address to listen on.")
+	prefix   = flag.String("prefix", "", "URL path prefix below which to serve the KDS paths, e.g., /amd.")
+	tlsCert  = flag.String("tls_cert", "", "Path to a PEM certificate chain to serve HTTPS with. Requires -tls_key.")
+	tlsKey   = flag.String("tls_key", "", "Path to the PEM private key of -tls_cert.")
+	cspID    = flag.String("csp_id", "", "The CSP_ID of the VLEK certificates to serve. If empty, VLEK certificates are not served.")
+)
+
+func main() {
+	logger.Init("", false, false, os.Stderr)
+	flag.Parse()
+
+	if *storeDir == "" {
+		logger.Fatal("-store_dir is required")
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		logger.Fatal("-tls_cert and -tls_key must be given together")
+	}
+	if _, err := os.Stat(*storeDir); err != nil {
+		logger.Fatalf("could not open certificate store: %v", err)
+	}
+	var handler http.Handler = &mirror.Server{Store: &trust.FileCertStore{Dir: *storeDir}, CSPID: *cspID}
+	if *prefix != "" {
+		handler = http.StripPrefix(strings.TrimSuffix(*prefix, "/"), handler)
+	}
+
+	logger.Infof("Serving KDS mirror of %s on %s", *storeDir, *addr)
+	var err error
+	if *tlsCert != "" {
+		err = http.ListenAndServeTLS(*addr, *tlsCert, *tlsKey, handler)
+	} else {
+		err = http.ListenAndServe(*addr, handler)
+	}
+	logger.Fatal(err)
+}
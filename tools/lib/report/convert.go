@@ -0,0 +1,133 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/google/go-sev-guest/abi"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// DetectFormat returns the format of an attestation that ParseAttestation accepts: pem, json, bin,
+// textproto, or else proto.
+func DetectFormat(b []byte) string {
+	trimmed := bytes.TrimSpace(b)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN ")):
+		return "pem"
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return "json"
+	case abi.ValidateReportFormat(b) == nil:
+		return "bin"
+	case isTextproto(b):
+		return "textproto"
+	default:
+		return "proto"
+	}
+}
+
+func isTextproto(b []byte) bool {
+	return prototext.Unmarshal(b, &spb.Attestation{}) == nil || prototext.Unmarshal(b, &spb.Report{}) == nil
+}
+
+// CheckAttestation returns an error if the attestation violates the invariants of the formats that
+// carry it: the report must have the field sizes of the AMD SEV-SNP ABI and a supported version and
+// well-formed policy and signer info, the VCEK, VLEK, ASK, and ARK certificates must be X.509
+// certificates, and extra certificate table entries must be keyed by GUID.
+func CheckAttestation(attestation *spb.Attestation) error {
+	if attestation.GetReport() == nil {
+		return fmt.Errorf("attestation has no report")
+	}
+	raw, err := abi.ReportToAbiBytes(attestation.GetReport())
+	if err != nil {
+		return fmt.Errorf("malformed report: %v", err)
+	}
+	if err := abi.ValidateReportFormat(raw); err != nil {
+		return err
+	}
+	if _, err := abi.ReportToProto(raw); err != nil {
+		return fmt.Errorf("malformed report: %v", err)
+	}
+	chain := attestation.GetCertificateChain()
+	for _, cert := range []struct {
+		name string
+		der  []byte
+	}{
+		{"VCEK", chain.GetVcekCert()},
+		{"VLEK", chain.GetVlekCert()},
+		{"ASK", chain.GetAskCert()},
+		{"ARK", chain.GetArkCert()},
+	} {
+		if len(cert.der) == 0 {
+			continue
+		}
+		if _, err := x509.ParseCertificate(cert.der); err != nil {
+			return fmt.Errorf("%s certificate is not an X.509 certificate: %v", cert.name, err)
+		}
+	}
+	for guid := range chain.GetExtras() {
+		if _, err := uuid.Parse(guid); err != nil {
+			return fmt.Errorf("certificate table entry key %q is not a GUID: %v", guid, err)
+		}
+	}
+	return nil
+}
+
+// evidence returns the attestation without its product, which only some formats carry and which
+// verification determines from the report and certificates anyway, and without an empty
+// certificate chain.
+func evidence(attestation *spb.Attestation) *spb.Attestation {
+	result := &spb.Attestation{Report: attestation.GetReport()}
+	if proto.Size(attestation.GetCertificateChain()) != 0 {
+		result.CertificateChain = attestation.GetCertificateChain()
+	}
+	return result
+}
+
+// Convert parses an attestation in the inform format, which may be "auto" to detect it, and returns
+// it in the outform format. It fails if the attestation violates CheckAttestation's invariants, or
+// if the output would not parse back into the same report and certificate chain, e.g., since the
+// bin, json, and pem formats do not carry the deprecated firmware certificate.
+func Convert(b []byte, inform, outform string) ([]byte, error) {
+	attestation, err := ParseAttestation(b, inform)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckAttestation(attestation); err != nil {
+		return nil, err
+	}
+	out, err := Transform(attestation, outform)
+	if err != nil {
+		return nil, err
+	}
+	switch outform {
+	case "tcb", "text":
+		return out, nil
+	}
+	again, err := ParseAttestation(out, outform)
+	if err != nil {
+		return nil, fmt.Errorf("%s output does not parse: %v", outform, err)
+	}
+	if !proto.Equal(evidence(again), evidence(attestation)) {
+		return nil, fmt.Errorf("the %s format cannot represent the whole attestation", outform)
+	}
+	return out, nil
+}
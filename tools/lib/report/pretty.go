@@ -0,0 +1,244 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/kds"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// printer accumulates labeled lines at increasing indentation levels.
+type printer struct {
+	b      strings.Builder
+	indent int
+}
+
+func (p *printer) line(label string, format string, args ...any) {
+	prefix := strings.Repeat("  ", p.indent) + label + ":"
+	p.b.WriteString(strings.TrimRight(fmt.Sprintf("%-28s %s", prefix, fmt.Sprintf(format, args...)), " "))
+	p.b.WriteByte('\n')
+}
+
+func (p *printer) section(label string, body func()) {
+	fmt.Fprintf(&p.b, "%s%s:\n", strings.Repeat("  ", p.indent), label)
+	p.indent++
+	body()
+	p.indent--
+}
+
+// tcbProduct returns the product whose TCB layout applies to the attestation's TCB values, or
+// SEV_PRODUCT_UNKNOWN if it cannot be determined.
+func tcbProduct(attestation *spb.Attestation) spb.SevProduct_SevProductName {
+	if fms, ok := abi.ReportCpuid1EaxFms(attestation.GetReport()); ok {
+		return abi.SevProductFromCpuid1Eax(fms).GetName()
+	}
+	return attestation.GetProduct().GetName()
+}
+
+func (p *printer) tcb(label string, tcb uint64, product spb.SevProduct_SevProductName) {
+	parts := kds.DecomposeTCBVersionForProduct(kds.TCBVersion(tcb), product)
+	components := []string{}
+	if product == spb.SevProduct_SEV_PRODUCT_TURIN {
+		components = append(components, fmt.Sprintf("fmc: %d", parts.FmcSpl))
+	}
+	components = append(components, fmt.Sprintf("bl: %d", parts.BlSpl), fmt.Sprintf("tee: %d", parts.TeeSpl))
+	for i, spl := range []uint8{parts.Spl4, parts.Spl5, parts.Spl6, parts.Spl7} {
+		if spl != 0 {
+			components = append(components, fmt.Sprintf("spl%d: %d", i+4, spl))
+		}
+	}
+	components = append(components, fmt.Sprintf("snp: %d", parts.SnpSpl), fmt.Sprintf("ucode: %d", parts.UcodeSpl))
+	p.line(label, "0x%016x {%s}", tcb, strings.Join(components, ", "))
+}
+
+func (p *printer) policy(policy uint64) {
+	parsed, err := abi.ParseSnpPolicy(policy)
+	if err != nil {
+		p.line("Policy", "0x%x (malformed: %v)", policy, err)
+		return
+	}
+	p.section(fmt.Sprintf("Policy (0x%x)", policy), func() {
+		p.line("ABI", "%d.%d", parsed.ABIMajor, parsed.ABIMinor)
+		p.line("SMT", "%t", parsed.SMT)
+		p.line("MigrateMA", "%t", parsed.MigrateMA)
+		p.line("Debug", "%t", parsed.Debug)
+		p.line("SingleSocket", "%t", parsed.SingleSocket)
+		p.line("CXLAllowed", "%t", parsed.CXLAllowed)
+		p.line("MemAES256XTS", "%t", parsed.MemAES256XTS)
+		p.line("RAPLDis", "%t", parsed.RAPLDis)
+		p.line("CipherTextHidingDRAM", "%t", parsed.CipherTextHidingDRAM)
+		p.line("PageSwapDisable", "%t", parsed.PageSwapDisable)
+	})
+}
+
+func (p *printer) platformInfo(platformInfo uint64) {
+	parsed, err := abi.ParseSnpPlatformInfo(platformInfo)
+	if err != nil {
+		p.line("Platform info", "0x%x (malformed: %v)", platformInfo, err)
+		return
+	}
+	p.section(fmt.Sprintf("Platform info (0x%x)", platformInfo), func() {
+		p.line("SMTEnabled", "%t", parsed.SMTEnabled)
+		p.line("TSMEEnabled", "%t", parsed.TSMEEnabled)
+		p.line("ECCEnabled", "%t", parsed.ECCEnabled)
+		p.line("RAPLDisabled", "%t", parsed.RAPLDisabled)
+		p.line("CiphertextHidingDRAM", "%t", parsed.CiphertextHidingDRAMEnabled)
+		p.line("AliasCheckComplete", "%t", parsed.AliasCheckComplete)
+		p.line("TIOEnabled", "%t", parsed.TIOEnabled)
+	})
+}
+
+func (p *printer) signerInfo(signerInfo uint32) {
+	parsed, err := abi.ParseSignerInfo(signerInfo)
+	if err != nil {
+		p.line("Signer info", "0x%x (malformed: %v)", signerInfo, err)
+		return
+	}
+	p.section(fmt.Sprintf("Signer info (0x%x)", signerInfo), func() {
+		p.line("SigningKey", "%v", parsed.SigningKey)
+		p.line("MaskChipKey", "%t", parsed.MaskChipKey)
+		p.line("AuthorKeyEn", "%t", parsed.AuthorKeyEn)
+	})
+}
+
+func (p *printer) report(report *spb.Report, product spb.SevProduct_SevProductName) {
+	p.line("Version", "%d", report.GetVersion())
+	p.line("Guest SVN", "%d", report.GetGuestSvn())
+	p.policy(report.GetPolicy())
+	p.line("Family ID", "%s", hex.EncodeToString(report.GetFamilyId()))
+	p.line("Image ID", "%s", hex.EncodeToString(report.GetImageId()))
+	p.line("VMPL", "%d", report.GetVmpl())
+	algo := "unknown"
+	if report.GetSignatureAlgo() == abi.SignEcdsaP384Sha384 {
+		algo = "ECDSA P-384 with SHA-384"
+	}
+	p.line("Signature algo", "%d (%s)", report.GetSignatureAlgo(), algo)
+	p.tcb("Current TCB", report.GetCurrentTcb(), product)
+	p.platformInfo(report.GetPlatformInfo())
+	p.signerInfo(report.GetSignerInfo())
+	p.line("Report data", "%s", hex.EncodeToString(report.GetReportData()))
+	p.line("Measurement", "%s", hex.EncodeToString(report.GetMeasurement()))
+	p.line("Host data", "%s", hex.EncodeToString(report.GetHostData()))
+	p.line("ID key digest", "%s", hex.EncodeToString(report.GetIdKeyDigest()))
+	p.line("Author key digest", "%s", hex.EncodeToString(report.GetAuthorKeyDigest()))
+	p.line("Report ID", "%s", hex.EncodeToString(report.GetReportId()))
+	p.line("Report ID MA", "%s", hex.EncodeToString(report.GetReportIdMa()))
+	p.tcb("Reported TCB", report.GetReportedTcb(), product)
+	if fms, ok := abi.ReportCpuid1EaxFms(report); ok {
+		p.line("CPUID[1].EAX FMS", "0x%x (%s)", fms, kds.ProductLineFromFms(fms))
+	}
+	p.line("Chip ID", "%s", hex.EncodeToString(report.GetChipId()))
+	p.tcb("Committed TCB", report.GetCommittedTcb(), product)
+	p.line("Current version", "%d.%d.%d", report.GetCurrentMajor(), report.GetCurrentMinor(), report.GetCurrentBuild())
+	p.line("Committed version", "%d.%d.%d", report.GetCommittedMajor(), report.GetCommittedMinor(),
+		report.GetCommittedBuild())
+	p.tcb("Launch TCB", report.GetLaunchTcb(), product)
+	if report.GetVersion() >= abi.ReportVersion5 {
+		p.line("Launch mit vector", "0x%x", report.GetLaunchMitVector())
+		p.line("Current mit vector", "0x%x", report.GetCurrentMitVector())
+	}
+}
+
+// certificate decodes an X.509 certificate of the chain, and the KDS extensions of endorsement key
+// certificates, i.e., those with a non-zero key.
+func (p *printer) certificate(name string, der []byte, key abi.ReportSigner, product spb.SevProduct_SevProductName) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		p.line(name, "%d bytes (not an X.509 certificate: %v)", len(der), err)
+		return
+	}
+	p.section(name, func() {
+		fingerprint := sha256.Sum256(der)
+		p.line("Subject", "%s", cert.Subject)
+		p.line("Issuer", "%s", cert.Issuer)
+		p.line("Serial", "%s", cert.SerialNumber.Text(16))
+		p.line("Not before", "%s", cert.NotBefore.UTC().Format("2006-01-02T15:04:05Z"))
+		p.line("Not after", "%s", cert.NotAfter.UTC().Format("2006-01-02T15:04:05Z"))
+		p.line("SHA-256", "%s", hex.EncodeToString(fingerprint[:]))
+		if key == abi.NoneReportSigner {
+			return
+		}
+		exts, err := kds.CertificateExtensions(cert, key)
+		if err != nil {
+			p.line("KDS extensions", "malformed: %v", err)
+			return
+		}
+		p.line("Product name", "%s", exts.ProductName)
+		if len(exts.HWID) != 0 {
+			p.line("HWID", "%s", hex.EncodeToString(exts.HWID))
+		}
+		if exts.CspID != "" {
+			p.line("CSP ID", "%s", exts.CspID)
+		}
+		p.tcb("TCB", uint64(exts.TCBVersion), product)
+	})
+}
+
+func (p *printer) certificateChain(chain *spb.CertificateChain, product spb.SevProduct_SevProductName) {
+	certs := []struct {
+		name string
+		der  []byte
+		key  abi.ReportSigner
+	}{
+		{"VCEK", chain.GetVcekCert(), abi.VcekReportSigner},
+		{"VLEK", chain.GetVlekCert(), abi.VlekReportSigner},
+		{"ASK", chain.GetAskCert(), abi.NoneReportSigner},
+		{"ARK", chain.GetArkCert(), abi.NoneReportSigner},
+		{"Firmware", chain.GetFirmwareCert(), abi.NoneReportSigner},
+	}
+	for _, cert := range certs {
+		if len(cert.der) != 0 {
+			p.certificate(cert.name, cert.der, cert.key, product)
+		}
+	}
+	guids := make([]string, 0, len(chain.GetExtras()))
+	for guid := range chain.GetExtras() {
+		guids = append(guids, guid)
+	}
+	sort.Strings(guids)
+	for _, guid := range guids {
+		p.line("Extra "+guid, "%d bytes", len(chain.GetExtras()[guid]))
+	}
+}
+
+// FormatReport returns a multi-line, human-readable rendering of an attestation report that decodes
+// its policy, TCB, platform info, and signer info. TCB values are decomposed with the layout of the
+// report's product if the report identifies it, and the Milan/Genoa layout otherwise.
+func FormatReport(report *spb.Report) string {
+	return Format(&spb.Attestation{Report: report})
+}
+
+// Format returns a multi-line, human-readable rendering of an attestation, including its report
+// as FormatReport renders it and the decoded certificates of its certificate chain.
+func Format(attestation *spb.Attestation) string {
+	p := &printer{}
+	product := tcbProduct(attestation)
+	p.section("Report", func() { p.report(attestation.GetReport(), product) })
+	if attestation.GetCertificateChain() != nil {
+		p.section("Certificate chain", func() { p.certificateChain(attestation.GetCertificateChain(), product) })
+	}
+	if attestation.GetProduct() != nil {
+		p.line("Product", "%s", kds.ProductName(attestation.GetProduct()))
+	}
+	return p.b.String()
+}
@@ -16,12 +16,16 @@
 package report
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"os"
 
 	"github.com/google/go-sev-guest/abi"
 	"github.com/google/go-sev-guest/kds"
+	"github.com/google/uuid"
 	"go.uber.org/multierr"
 	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/proto"
@@ -29,6 +33,117 @@ import (
 	spb "github.com/google/go-sev-guest/proto/sevsnp"
 )
 
+const (
+	// PemReportType is the PEM block type of an attestation report in AMD's specified ABI format.
+	PemReportType = "SEV-SNP ATTESTATION REPORT"
+	// PemCertTableEntryType is the PEM block type of a certificate table entry that is not one of
+	// the VCEK, VLEK, ASK, or ARK certificates, which have type "CERTIFICATE".
+	PemCertTableEntryType = "SEV-SNP CERTIFICATE TABLE ENTRY"
+	// PemGUIDHeader is the PEM header that holds a certificate table entry's GUID.
+	PemGUIDHeader = "GUID"
+)
+
+// asJSON returns the canonical JSON representation of the attestation, indented for humans.
+func asJSON(attestation *spb.Attestation) ([]byte, error) {
+	compact, err := abi.AttestationToJSON(attestation)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, compact, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+func parseAttestationJSON(b []byte) (*spb.Attestation, error) {
+	attestation, aerr := abi.AttestationFromJSON(b)
+	if aerr != nil {
+		// May be just a report.
+		report, rerr := abi.ReportFromJSON(b)
+		if rerr != nil {
+			return nil, fmt.Errorf("could not parse as JSON: %v", multierr.Append(aerr, rerr))
+		}
+		return &spb.Attestation{Report: report}, nil
+	}
+	return attestation, nil
+}
+
+// isKeyCertGUID returns whether guid identifies one of the X.509 certificates of the chain.
+func isKeyCertGUID(guid string) bool {
+	switch guid {
+	case abi.VcekGUID, abi.VlekGUID, abi.AskGUID, abi.ArkGUID:
+		return true
+	}
+	return false
+}
+
+// asPEM returns the report in AMD's ABI format as a PemReportType block followed by a block for
+// each certificate table entry, each with its GUID in the PemGUIDHeader header.
+func asPEM(attestation *spb.Attestation) ([]byte, error) {
+	r, err := abi.ReportToAbiBytes(attestation.GetReport())
+	if err != nil {
+		return nil, err
+	}
+	out := pem.EncodeToMemory(&pem.Block{Type: PemReportType, Bytes: r})
+	if attestation.GetCertificateChain() == nil {
+		return out, nil
+	}
+	for _, entry := range abi.CertsFromProto(attestation.GetCertificateChain()).Entries {
+		guid := entry.GUID.String()
+		blockType := PemCertTableEntryType
+		if isKeyCertGUID(guid) {
+			blockType = "CERTIFICATE"
+		}
+		out = append(out, pem.EncodeToMemory(&pem.Block{
+			Type:    blockType,
+			Headers: map[string]string{PemGUIDHeader: guid},
+			Bytes:   entry.RawCert,
+		})...)
+	}
+	return out, nil
+}
+
+func parseAttestationPEM(b []byte) (*spb.Attestation, error) {
+	var result *spb.Attestation
+	certs := &abi.CertTable{}
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case PemReportType:
+			if result != nil {
+				return nil, fmt.Errorf("more than one %s PEM block", PemReportType)
+			}
+			report, err := abi.ReportToProto(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse attestation report: %v", err)
+			}
+			result = &spb.Attestation{Report: report}
+		case "CERTIFICATE", PemCertTableEntryType:
+			guid, err := uuid.Parse(block.Headers[PemGUIDHeader])
+			if err != nil {
+				return nil, fmt.Errorf("%s PEM block has bad %s header %q: %v", block.Type, PemGUIDHeader,
+					block.Headers[PemGUIDHeader], err)
+			}
+			certs.AddEntry(abi.CertTableEntry{GUID: guid, RawCert: block.Bytes})
+		default:
+			return nil, fmt.Errorf("unexpected PEM block type %q", block.Type)
+		}
+	}
+	if result == nil {
+		return nil, fmt.Errorf("no %s PEM block", PemReportType)
+	}
+	if len(certs.Entries) != 0 {
+		result.CertificateChain = certs.Proto()
+	}
+	return result, nil
+}
+
 func parseAttestationBytes(b []byte) (*spb.Attestation, error) {
 	// This format is the attestation report in AMD's specified ABI format, immediately
 	// followed by the certificate table bytes.
@@ -50,7 +165,8 @@ func parseAttestationBytes(b []byte) (*spb.Attestation, error) {
 	return &spb.Attestation{Report: report, CertificateChain: certs.Proto()}, nil
 }
 
-// ParseAttestation parses an attestation report from a byte slice as a given format.
+// ParseAttestation parses an attestation report from a byte slice as a given format. The json and
+// pem formats are those that Transform outputs, and the auto format is the one DetectFormat returns.
 func ParseAttestation(b []byte, inform string) (*spb.Attestation, error) {
 	switch inform {
 	case "bin":
@@ -80,6 +196,12 @@ func ParseAttestation(b []byte, inform string) (*spb.Attestation, error) {
 			}
 		}
 		return result, nil
+	case "json":
+		return parseAttestationJSON(b)
+	case "pem":
+		return parseAttestationPEM(b)
+	case "auto":
+		return ParseAttestation(b, DetectFormat(b))
 	default:
 		return nil, fmt.Errorf("unknown inform: %q", inform)
 	}
@@ -113,12 +235,7 @@ func ReadAttestation(infile, inform string) (*spb.Attestation, error) {
 }
 
 func asBin(report *spb.Attestation) ([]byte, error) {
-	r, err := abi.ReportToAbiBytes(report.Report)
-	if err != nil {
-		return nil, err
-	}
-	certs := abi.CertsFromProto(report.CertificateChain).Marshal()
-	return append(r, certs...), nil
+	return abi.AttestationToAbiBytes(report)
 }
 
 func tcbBreakdown(tcb uint64) string {
@@ -134,7 +251,9 @@ func tcbText(report *spb.Attestation) ([]byte, error) {
 		tcbBreakdown(report.Report.GetLaunchTcb()))), nil
 }
 
-// Transform returns the attestation in the outform marshalled format.
+// Transform returns the attestation in the outform marshalled format. The json format is canonical
+// JSON with hex-encoded byte fields, and the pem format is the report in AMD's ABI format followed by
+// the certificate chain as PEM blocks.
 func Transform(report *spb.Attestation, outform string) ([]byte, error) {
 	switch outform {
 	case "bin":
@@ -143,8 +262,14 @@ func Transform(report *spb.Attestation, outform string) ([]byte, error) {
 		return proto.Marshal(report)
 	case "textproto":
 		return prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(report)
+	case "json":
+		return asJSON(report)
+	case "pem":
+		return asPEM(report)
 	case "tcb":
 		return tcbText(report)
+	case "text":
+		return []byte(Format(report)), nil
 	default:
 		return nil, fmt.Errorf("unknown outform: %q", outform)
 	}
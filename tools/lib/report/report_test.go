@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -230,4 +231,127 @@ func TestTransform(t *testing.T) {
 			t.Fatalf("Transform(_, \"textproto\") = %v, nil. Expect %v.", string(textout), string(input.textcerts))
 		}
 	})
+	for _, form := range []string{"json", "pem"} {
+		t.Run(form, func(t *testing.T) {
+			out, err := Transform(input.attestation, form)
+			if err != nil {
+				t.Fatalf("Transform(_, %q) = _, %v. Expect nil.", form, err)
+			}
+			again, err := Transform(input.attestation, form)
+			if err != nil || !bytes.Equal(out, again) {
+				t.Errorf("Transform(_, %q) is not deterministic: %v", form, err)
+			}
+			got, err := ParseAttestation(out, form)
+			if err != nil {
+				t.Fatalf("ParseAttestation(Transform(_, %q)) = _, %v. Expect nil.", form, err)
+			}
+			if diff := cmp.Diff(got, input.attestation, protocmp.Transform()); diff != "" {
+				t.Errorf("ParseAttestation(Transform(_, %q)) did not round trip: %s", form, diff)
+			}
+			reportOnly := &spb.Attestation{Report: input.attestation.Report}
+			out, err = Transform(reportOnly, form)
+			if err != nil {
+				t.Fatalf("Transform(report, %q) = _, %v. Expect nil.", form, err)
+			}
+			got, err = ParseAttestation(out, form)
+			if err != nil {
+				t.Fatalf("ParseAttestation(Transform(report, %q)) = _, %v. Expect nil.", form, err)
+			}
+			if diff := cmp.Diff(got, reportOnly, protocmp.Transform()); diff != "" {
+				t.Errorf("ParseAttestation(Transform(report, %q)) did not round trip: %s", form, diff)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	report := &spb.Report{
+		Version:      abi.ReportVersion3,
+		Policy:       0x30000,
+		CurrentTcb:   0x4800000003010201,
+		Cpuid1EaxFms: 0x00b00f21,
+		SignerInfo:   0x3,
+	}
+	got := FormatReport(report)
+	line := func(label, value string) string { return fmt.Sprintf("%-28s %s\n", label+":", value) }
+	for _, want := range []string{
+		"Report:\n",
+		"  Policy (0x30000):\n",
+		line("    SMT", "true"),
+		line("  Current TCB", "0x4800000003010201 {fmc: 1, bl: 2, tee: 1, snp: 3, ucode: 72}"),
+		line("    MaskChipKey", "true"),
+		line("  CPUID[1].EAX FMS", "0xb00f21 (Turin)"),
+		"  Measurement:\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("FormatReport() = %s\nwant it to contain %q", got, want)
+		}
+	}
+
+	mu.Do(initDevice)
+	text, err := Transform(input.attestation, "text")
+	if err != nil {
+		t.Fatalf("Transform(_, \"text\") = _, %v. Expect nil.", err)
+	}
+	for _, want := range []string{"Certificate chain:\n", "  VCEK:\n", "    HWID:", "  ARK:\n", "    Subject:"} {
+		if !strings.Contains(string(text), want) {
+			t.Errorf("Transform(_, \"text\") = %s\nwant it to contain %q", text, want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	mu.Do(initDevice)
+	forms := []string{"bin", "proto", "textproto", "json", "pem"}
+	for _, inform := range forms {
+		in, err := Transform(input.attestation, inform)
+		if err != nil {
+			t.Fatalf("Transform(_, %q) = _, %v. Expect nil.", inform, err)
+		}
+		if got := DetectFormat(in); got != inform {
+			t.Errorf("DetectFormat(%s attestation) = %q, want %q", inform, got, inform)
+		}
+		for _, outform := range forms {
+			got, err := Convert(in, "auto", outform)
+			if err != nil {
+				t.Errorf("Convert(%s attestation, auto, %q) = _, %v. Expect nil.", inform, outform, err)
+				continue
+			}
+			want, err := Transform(input.attestation, outform)
+			if err != nil {
+				t.Fatalf("Transform(_, %q) = _, %v. Expect nil.", outform, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Convert(%s attestation, auto, %q) = %q, want %q", inform, outform, got, want)
+			}
+		}
+	}
+
+	badGUID := proto.Clone(input.attestation).(*spb.Attestation)
+	badGUID.CertificateChain.Extras = map[string][]byte{"not a guid": []byte("blob")}
+	badCert := proto.Clone(input.attestation).(*spb.Attestation)
+	badCert.CertificateChain.AskCert = []byte("not a certificate")
+	firmware := proto.Clone(input.attestation).(*spb.Attestation)
+	firmware.CertificateChain.FirmwareCert = []byte("firmware")
+	tcs := []struct {
+		name        string
+		attestation *spb.Attestation
+		outform     string
+		wantErr     string
+	}{
+		{name: "bad guid", attestation: badGUID, outform: "bin", wantErr: "is not a GUID"},
+		{name: "bad cert", attestation: badCert, outform: "json", wantErr: "ASK certificate is not an X.509 certificate"},
+		{name: "lossy", attestation: firmware, outform: "pem", wantErr: "cannot represent the whole attestation"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			in, err := proto.Marshal(tc.attestation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Convert(in, "proto", tc.outform); !test.Match(err, tc.wantErr) {
+				t.Errorf("Convert(_, proto, %q) = _, %v, want %q", tc.outform, err, tc.wantErr)
+			}
+		})
+	}
 }
@@ -0,0 +1,148 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// measure precomputes the expected MEASUREMENT of an SEV-SNP guest from its launch inputs.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/measure"
+	checkpb "github.com/google/go-sev-guest/proto/check"
+	"github.com/google/logger"
+	"google.golang.org/protobuf/encoding/prototext"
+)
+
+var (
+	ovmfPath   = flag.String("ovmf", "", "Path to the OVMF firmware image. Required.")
+	kernelPath = flag.String("kernel", "", "Path to the direct-boot kernel. If unset, no kernel hashes are measured.")
+	initrdPath = flag.String("initrd", "", "Path to the direct-boot initrd. Requires -kernel.")
+	cmdline    = flag.String("append", "", "The kernel command line. Requires -kernel.")
+	vcpus      = flag.Int("vcpus", 1, "The number of vCPUs.")
+	vcpuType   = flag.String("vcpu_type", "EPYC-v4",
+		"The QEMU vCPU type, e.g., EPYC-v4, EPYC-Milan, or EPYC-Genoa, which determines the CPUID[1].EAX signature. Ignored if -vcpu_sig is set.")
+	vcpuSig       = flag.String("vcpu_sig", "", "The CPUID[1].EAX signature of the vCPUs, e.g., 0x800f12. Overrides -vcpu_type.")
+	guestFeatures = flag.String("guest_features", "0x1", "The SEV_FEATURES value of the vCPUs.")
+	vmmType       = flag.String("vmm_type", "qemu", "The VMM that launches the guest. One of \"qemu\" or \"ec2\".")
+	outform       = flag.String("outform", "hex",
+		"The output format. One of \"hex\" for check's -measurement flag, \"flag\" for the whole flag, "+
+			"\"textproto\" for a check.Policy, or \"manifest\" for a JSON measure.Manifest of the measured inputs.")
+)
+
+// vcpuSigs are the CPUID[1].EAX signatures of QEMU's SEV-SNP capable vCPU types.
+var vcpuSigs = map[string]uint32{
+	"EPYC":       0x800f12,
+	"EPYC-v1":    0x800f12,
+	"EPYC-v2":    0x800f12,
+	"EPYC-v3":    0x800f12,
+	"EPYC-v4":    0x800f12,
+	"EPYC-Rome":  0x830f10,
+	"EPYC-Milan": 0xa00f11,
+	"EPYC-Genoa": 0xa10f10,
+}
+
+func readFile(flagName, path string) []byte {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Fatalf("could not read -%s: %v", flagName, err)
+	}
+	return data
+}
+
+func parseUint(flagName, value string, bitSize int) uint64 {
+	result, err := strconv.ParseUint(value, 0, bitSize)
+	if err != nil {
+		logger.Fatalf("-%s=%q is not a %d-bit unsigned integer: %v", flagName, value, bitSize, err)
+	}
+	return result
+}
+
+func spec() *measure.Spec {
+	if *ovmfPath == "" {
+		logger.Fatal("-ovmf is required")
+	}
+	if *kernelPath == "" && (*initrdPath != "" || *cmdline != "") {
+		logger.Fatal("-initrd and -append require -kernel")
+	}
+	result := &measure.Spec{
+		OVMF:          readFile("ovmf", *ovmfPath),
+		Kernel:        readFile("kernel", *kernelPath),
+		Initrd:        readFile("initrd", *initrdPath),
+		Cmdline:       *cmdline,
+		VCPUs:         *vcpus,
+		GuestFeatures: parseUint("guest_features", *guestFeatures, 64),
+	}
+	if *vcpuSig != "" {
+		result.VCPUSig = uint32(parseUint("vcpu_sig", *vcpuSig, 32))
+	} else {
+		sig, ok := vcpuSigs[*vcpuType]
+		if !ok {
+			logger.Fatalf("unknown -vcpu_type=%q. Use -vcpu_sig for other vCPU types", *vcpuType)
+		}
+		result.VCPUSig = sig
+	}
+	switch strings.ToLower(*vmmType) {
+	case "qemu":
+		result.VMM = abi.VMMTypeQEMU
+	case "ec2":
+		result.VMM = abi.VMMTypeEC2
+	default:
+		logger.Fatalf("-vmm_type=%q. Expect \"qemu\" or \"ec2\"", *vmmType)
+	}
+	return result
+}
+
+func format(m *measure.Manifest) ([]byte, error) {
+	switch *outform {
+	case "hex":
+		return []byte(hex.EncodeToString(m.LaunchDigest) + "\n"), nil
+	case "flag":
+		return []byte(fmt.Sprintf("-measurement=%s\n", hex.EncodeToString(m.LaunchDigest))), nil
+	case "textproto":
+		return prototext.MarshalOptions{Multiline: true}.Marshal(&checkpb.Policy{Measurement: m.LaunchDigest})
+	case "manifest":
+		out, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	default:
+		return nil, fmt.Errorf("-outform=%q. Expect \"hex\", \"flag\", \"textproto\", or \"manifest\"", *outform)
+	}
+}
+
+func main() {
+	logger.Init("", false, false, os.Stderr)
+	flag.Parse()
+
+	manifest, err := spec().Manifest()
+	if err != nil {
+		logger.Fatalf("could not compute the launch measurement: %v", err)
+	}
+	out, err := format(manifest)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	os.Stdout.Write(out)
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-sev-guest/abi"
+)
+
+func TestVcpuSigs(t *testing.T) {
+	// The family, model, and stepping of QEMU's vCPU types.
+	tcs := []struct {
+		vcpuType string
+		family   byte
+		model    byte
+		stepping byte
+	}{
+		{vcpuType: "EPYC", family: 23, model: 1, stepping: 2},
+		{vcpuType: "EPYC-v1", family: 23, model: 1, stepping: 2},
+		{vcpuType: "EPYC-v2", family: 23, model: 1, stepping: 2},
+		{vcpuType: "EPYC-v3", family: 23, model: 1, stepping: 2},
+		{vcpuType: "EPYC-v4", family: 23, model: 1, stepping: 2},
+		{vcpuType: "EPYC-Rome", family: 23, model: 49, stepping: 0},
+		{vcpuType: "EPYC-Milan", family: 25, model: 1, stepping: 1},
+		{vcpuType: "EPYC-Genoa", family: 25, model: 17, stepping: 0},
+	}
+	if len(tcs) != len(vcpuSigs) {
+		t.Errorf("vcpuSigs has %d vCPU types, want %d", len(vcpuSigs), len(tcs))
+	}
+	for _, tc := range tcs {
+		want := abi.FmsToCpuid1Eax(tc.family, tc.model, tc.stepping)
+		if got, ok := vcpuSigs[tc.vcpuType]; !ok || got != want {
+			t.Errorf("vcpuSigs[%q] = 0x%x, %t. Want 0x%x", tc.vcpuType, got, ok, want)
+		}
+	}
+}
@@ -12,7 +12,8 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// show reads an attestation report and outputs it in a preferred format.
+// show reads an attestation report and outputs it in a preferred format, e.g., decoded and annotated
+// for debugging with -outform=text.
 package main
 
 import (
@@ -26,10 +27,11 @@ import (
 var (
 	infile = flag.String("in", "-", "Path to attestation file, or - for stdin.")
 	inform = flag.String("inform", "bin", "Format of the attestation file. "+
-		"One of bin, proto, textproto")
+		"One of bin, proto, textproto, json, pem. Json and pem are as output by attest.")
 	outfile = flag.String("out", "-", "Path to output file, or - for stdout.")
 	outform = flag.String("outform", "textproto", "Format of the output file. "+
-		"One of bin, proto, textproto, tcb. Tcb is human-readable.")
+		"One of bin, proto, textproto, json, pem, tcb, text. Tcb and text are human-readable. "+
+		"Text decodes the policy, TCB, platform info, and signer info, and the certificate chain.")
 )
 
 func main() {
@@ -0,0 +1,138 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package celpolicy validates attestation reports against policies written as CEL expressions,
+// for relying-party policies that validate.Options cannot express.
+//
+// A policy is a boolean CEL expression over these variables:
+//
+//	report             sevsnp.Report            the attestation report
+//	product            sevsnp.SevProduct        the product that generated the report
+//	certificate_chain  sevsnp.CertificateChain  the report's certificates, possibly empty
+//	guest_policy       map(string, dyn)         report.policy decomposed, e.g., guest_policy.debug
+//	current_tcb        map(string, uint)        report.current_tcb decomposed, e.g., current_tcb.snp_spl
+//	reported_tcb       map(string, uint)        report.reported_tcb decomposed
+//	committed_tcb      map(string, uint)        report.committed_tcb decomposed
+//	launch_tcb         map(string, uint)        report.launch_tcb decomposed
+//
+// The TCB maps have the keys bl_spl, tee_spl, snp_spl, ucode_spl, and fmc_spl. The guest policy
+// map has the keys abi_major, abi_minor, smt, migrate_ma, debug, single_socket, cxl_allowed,
+// mem_aes_256_xts, rapl_dis, ciphertext_hiding_dram, and page_swap_disable.
+//
+// If the attestation has no product, product is the one that the report's CPUID fields state, if
+// any, and the TCBs are decomposed in its TCB layout.
+package celpolicy
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/kds"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/google/go-sev-guest/validate/internal/policyinput"
+)
+
+// Policy is a compiled CEL policy. It is safe for concurrent use, so compile a policy once and
+// reuse it for every attestation.
+type Policy struct {
+	expr    string
+	program cel.Program
+}
+
+var tcbFields = []string{"current_tcb", "reported_tcb", "committed_tcb", "launch_tcb"}
+
+func newEnv() (*cel.Env, error) {
+	opts := []cel.EnvOption{
+		cel.Types(&spb.Report{}, &spb.SevProduct{}, &spb.CertificateChain{}),
+		cel.Variable("report", cel.ObjectType("sevsnp.Report")),
+		cel.Variable("product", cel.ObjectType("sevsnp.SevProduct")),
+		cel.Variable("certificate_chain", cel.ObjectType("sevsnp.CertificateChain")),
+		cel.Variable("guest_policy", cel.MapType(cel.StringType, cel.DynType)),
+	}
+	for _, name := range tcbFields {
+		opts = append(opts, cel.Variable(name, cel.MapType(cel.StringType, cel.UintType)))
+	}
+	return cel.NewEnv(opts...)
+}
+
+// Compile parses and type-checks the CEL expression expr, which must evaluate to a bool.
+func Compile(expr string) (*Policy, error) {
+	env, err := newEnv()
+	if err != nil {
+		return nil, fmt.Errorf("could not create CEL environment: %v", err)
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("could not compile policy %q: %v", expr, iss.Err())
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("policy %q has type %v, want bool", expr, ast.OutputType())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("could not create program for policy %q: %v", expr, err)
+	}
+	return &Policy{expr: expr, program: program}, nil
+}
+
+// activation returns the policy variables for attestation.
+func activation(attestation *spb.Attestation) (map[string]any, error) {
+	report := attestation.GetReport()
+	if report == nil {
+		return nil, fmt.Errorf("attestation missing report")
+	}
+	guestPolicy, err := abi.ParseSnpPolicy(report.GetPolicy())
+	if err != nil {
+		return nil, fmt.Errorf("could not parse guest policy: %v", err)
+	}
+	product := policyinput.Product(attestation)
+	chain := attestation.GetCertificateChain()
+	if chain == nil {
+		chain = &spb.CertificateChain{}
+	}
+	name := product.GetName()
+	decompose := func(tcb uint64) map[string]uint64 { return policyinput.TCBMap(kds.TCBVersion(tcb), name) }
+	return map[string]any{
+		"report":            report,
+		"product":           product,
+		"certificate_chain": chain,
+		"guest_policy":      policyinput.GuestPolicyMap(guestPolicy),
+		"current_tcb":       decompose(report.GetCurrentTcb()),
+		"reported_tcb":      decompose(report.GetReportedTcb()),
+		"committed_tcb":     decompose(report.GetCommittedTcb()),
+		"launch_tcb":        decompose(report.GetLaunchTcb()),
+	}, nil
+}
+
+// Validate returns an error if attestation does not satisfy the policy. Like validate.SnpAttestation,
+// it does not verify the report's signature, so only validate verified attestations.
+func (p *Policy) Validate(attestation *spb.Attestation) error {
+	vars, err := activation(attestation)
+	if err != nil {
+		return err
+	}
+	out, _, err := p.program.Eval(vars)
+	if err != nil {
+		return fmt.Errorf("could not evaluate policy %q: %v", p.expr, err)
+	}
+	ok, isBool := out.Value().(bool)
+	if !isBool {
+		return fmt.Errorf("policy %q evaluated to %v, want bool", p.expr, out)
+	}
+	if !ok {
+		return fmt.Errorf("attestation does not satisfy policy %q", p.expr)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package celpolicy
+
+import (
+	"testing"
+
+	"github.com/google/go-sev-guest/abi"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	test "github.com/google/go-sev-guest/testing"
+	"github.com/google/go-sev-guest/verify/testdata"
+)
+
+func TestPolicy(t *testing.T) {
+	report, err := abi.ReportToProto(testdata.AttestationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation := &spb.Attestation{
+		Report:  report,
+		Product: &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_MILAN},
+	}
+	tcs := []struct {
+		name           string
+		expr           string
+		wantCompileErr string
+		wantErr        string
+	}{
+		{
+			name: "satisfied",
+			expr: `report.version >= 2u && reported_tcb.snp_spl >= 5u && reported_tcb.ucode_spl == 68u &&
+				guest_policy.smt && product.name == sevsnp.SevProduct.SevProductName.SEV_PRODUCT_MILAN`,
+		},
+		{
+			name: "measurement allowlist",
+			expr: `report.measurement in [b'\x00', ` +
+				`b"\xb0\x7a\xf9\x62\x0f\x3b\x83\x9b\x47\x99\x64\x22\xdd\xec\x60\x58\x33\x89\x51\xd9\x84\xe3\x12\x11` +
+				`\x51\x31\xea\x82\x70\x5e\xaf\x5b\x6b\xdf\x8a\x9e\xce\x31\xa5\xa6\x08\xeb\x0c\xf2\xe4\x87\x2b\x01"]`,
+		},
+		{
+			name:    "unsatisfied",
+			expr:    `!guest_policy.debug`,
+			wantErr: `attestation does not satisfy policy "!guest_policy.debug"`,
+		},
+		{
+			name:           "not bool",
+			expr:           `report.guest_svn`,
+			wantCompileErr: "want bool",
+		},
+		{
+			name:           "unknown variable",
+			expr:           `vcek.tcb > 0u`,
+			wantCompileErr: "could not compile policy",
+		},
+		{
+			name:    "missing key",
+			expr:    `guest_policy.unknown == true`,
+			wantErr: "could not evaluate policy",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := Compile(tc.expr)
+			if !test.Match(err, tc.wantCompileErr) {
+				t.Fatalf("Compile(%q) = _, %v. Want error %q", tc.expr, err, tc.wantCompileErr)
+			}
+			if err != nil {
+				return
+			}
+			if err := p.Validate(attestation); !test.Match(err, tc.wantErr) {
+				t.Errorf("Validate() = %v. Want error %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyProductFromReport(t *testing.T) {
+	// The Turin layout has the FMC SPL in the lowest byte.
+	const tcb = 0x4400000016000301
+	turin := &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_TURIN}
+	attestation := &spb.Attestation{Report: &spb.Report{
+		Version:      abi.ReportVersion3,
+		Cpuid1EaxFms: abi.MaskedCpuid1EaxFromSevProduct(turin),
+		Policy:       1 << 17, // The reserved bit that must be 1.
+		ReportedTcb:  tcb,
+	}}
+	p, err := Compile(`product.name == sevsnp.SevProduct.SevProductName.SEV_PRODUCT_TURIN &&
+		reported_tcb.fmc_spl == 1u && reported_tcb.bl_spl == 3u && reported_tcb.snp_spl == 22u`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Validate(attestation); err != nil {
+		t.Errorf("Validate() = %v. Want the report's TCBs in the Turin layout", err)
+	}
+}
+
+func TestPolicyMissingReport(t *testing.T) {
+	p, err := Compile("true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Validate(&spb.Attestation{}); !test.Match(err, "attestation missing report") {
+		t.Errorf("Validate() = %v. Want error about the missing report", err)
+	}
+}
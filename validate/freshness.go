@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+)
+
+const (
+	// freshReportDataLabel separates fresh report data from any other use of SHA-512 over the
+	// same inputs.
+	freshReportDataLabel = "go-sev-guest fresh REPORT_DATA v1\x00"
+	// freshTimestampSize is the size of the big-endian Unix millisecond timestamp that starts
+	// fresh report data.
+	freshTimestampSize = 8
+)
+
+// Freshness describes the REPORT_DATA that FreshReportData binds to a relying party's nonce and the
+// time at which the guest requested the report.
+type Freshness struct {
+	// Domain separates the report data of different protocols or relying parties, e.g.,
+	// "example.com/attest/v1", so that a report requested for one cannot be replayed to another.
+	Domain string
+	// Nonce is the relying party's challenge that the report must answer. Not checked if nil.
+	Nonce []byte
+	// MaxAge is the maximum age of the report's timestamp. Not checked if zero.
+	MaxAge time.Duration
+	// MaxClockSkew is how far in the future of Now the report's timestamp may be, to tolerate
+	// guest and relying party clocks that disagree.
+	MaxClockSkew time.Duration
+	// Now returns the relying party's current time. If nil, uses time.Now.
+	Now func() time.Time
+}
+
+func freshBinding(domain string, nonce []byte, timestamp []byte) []byte {
+	h := sha512.New()
+	h.Write([]byte(freshReportDataLabel))
+	h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(domain))))
+	h.Write([]byte(domain))
+	h.Write(timestamp)
+	h.Write(nonce)
+	return h.Sum(nil)[:abi.ReportDataSize-freshTimestampSize]
+}
+
+// FreshReportData returns the REPORT_DATA that binds nonce to the time t within domain. The first 8
+// bytes are t in big-endian Unix milliseconds, and the rest is a truncated SHA-512 digest of the
+// domain, nonce, and time, so that validators can check the report's age with Options.Freshness.
+func FreshReportData(domain string, nonce []byte, t time.Time) [abi.ReportDataSize]byte {
+	var result [abi.ReportDataSize]byte
+	binary.BigEndian.PutUint64(result[:freshTimestampSize], uint64(t.UnixMilli()))
+	copy(result[freshTimestampSize:], freshBinding(domain, nonce, result[:freshTimestampSize]))
+	return result
+}
+
+// ReportDataTime returns the time that FreshReportData encoded in reportData.
+func ReportDataTime(reportData []byte) (time.Time, error) {
+	if len(reportData) != abi.ReportDataSize {
+		return time.Time{}, fmt.Errorf("REPORT_DATA is %d bytes, want %d", len(reportData), abi.ReportDataSize)
+	}
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(reportData[:freshTimestampSize]))), nil
+}
+
+func validateFreshness(reportData []byte, freshness *Freshness) error {
+	if freshness == nil {
+		return nil
+	}
+	timestamp, err := ReportDataTime(reportData)
+	if err != nil {
+		return err
+	}
+	if freshness.Nonce != nil {
+		binding := freshBinding(freshness.Domain, freshness.Nonce, reportData[:freshTimestampSize])
+		if !bytes.Equal(binding, reportData[freshTimestampSize:]) {
+			return errors.New("report field REPORT_DATA does not bind the expected nonce and domain")
+		}
+	}
+	if freshness.MaxAge == 0 {
+		return nil
+	}
+	now := time.Now
+	if freshness.Now != nil {
+		now = freshness.Now
+	}
+	current := now()
+	if age := current.Sub(timestamp); age > freshness.MaxAge {
+		return fmt.Errorf("report REPORT_DATA timestamp %v is %v old, more than the maximum age %v",
+			timestamp.UTC(), age, freshness.MaxAge)
+	}
+	if skew := timestamp.Sub(current); skew > freshness.MaxClockSkew {
+		return fmt.Errorf("report REPORT_DATA timestamp %v is %v in the future, more than the maximum clock skew %v",
+			timestamp.UTC(), skew, freshness.MaxClockSkew)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policyinput decomposes attestation reports into the variables that the celpolicy and
+// regopolicy policy languages see, so that both name them alike.
+package policyinput
+
+import (
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/kds"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// Product returns the attestation's product or, if unknown, like verification, the product that
+// the report's CPUID fields state. It never returns nil.
+func Product(attestation *spb.Attestation) *spb.SevProduct {
+	product := attestation.GetProduct()
+	if product.GetName() == spb.SevProduct_SEV_PRODUCT_UNKNOWN {
+		if fms, ok := abi.ReportCpuid1EaxFms(attestation.GetReport()); ok {
+			product = abi.SevProductFromCpuid1Eax(fms)
+		}
+	}
+	if product == nil {
+		product = &spb.SevProduct{}
+	}
+	return product
+}
+
+// TCBMap returns the components of tcb in the product's TCB layout by their names, e.g., snp_spl.
+func TCBMap(tcb kds.TCBVersion, product spb.SevProduct_SevProductName) map[string]uint64 {
+	parts := kds.DecomposeTCBVersionForProduct(tcb, product)
+	return map[string]uint64{
+		"bl_spl":    uint64(parts.BlSpl),
+		"tee_spl":   uint64(parts.TeeSpl),
+		"snp_spl":   uint64(parts.SnpSpl),
+		"ucode_spl": uint64(parts.UcodeSpl),
+		"fmc_spl":   uint64(parts.FmcSpl),
+	}
+}
+
+// GuestPolicyMap returns the fields of policy by their names, e.g., debug.
+func GuestPolicyMap(policy abi.SnpPolicy) map[string]any {
+	return map[string]any{
+		"abi_major":              uint64(policy.ABIMajor),
+		"abi_minor":              uint64(policy.ABIMinor),
+		"smt":                    policy.SMT,
+		"migrate_ma":             policy.MigrateMA,
+		"debug":                  policy.Debug,
+		"single_socket":          policy.SingleSocket,
+		"cxl_allowed":            policy.CXLAllowed,
+		"mem_aes_256_xts":        policy.MemAES256XTS,
+		"rapl_dis":               policy.RAPLDis,
+		"ciphertext_hiding_dram": policy.CipherTextHidingDRAM,
+		"page_swap_disable":      policy.PageSwapDisable,
+	}
+}
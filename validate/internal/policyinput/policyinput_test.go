@@ -0,0 +1,62 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policyinput
+
+import (
+	"testing"
+
+	"github.com/google/go-sev-guest/abi"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+func TestProduct(t *testing.T) {
+	turin := &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_TURIN}
+	genoa := &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_GENOA}
+	tcs := []struct {
+		name        string
+		attestation *spb.Attestation
+		want        spb.SevProduct_SevProductName
+	}{
+		{
+			name:        "attestation product",
+			attestation: &spb.Attestation{Report: &spb.Report{Version: abi.ReportVersion3, Cpuid1EaxFms: abi.MaskedCpuid1EaxFromSevProduct(turin)}, Product: genoa},
+			want:        spb.SevProduct_SEV_PRODUCT_GENOA,
+		},
+		{
+			name:        "report CPUID",
+			attestation: &spb.Attestation{Report: &spb.Report{Version: abi.ReportVersion3, Cpuid1EaxFms: abi.MaskedCpuid1EaxFromSevProduct(turin)}},
+			want:        spb.SevProduct_SEV_PRODUCT_TURIN,
+		},
+		{
+			name:        "unknown",
+			attestation: &spb.Attestation{Report: &spb.Report{Version: 2}},
+			want:        spb.SevProduct_SEV_PRODUCT_UNKNOWN,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Product(tc.attestation); got == nil || got.GetName() != tc.want {
+				t.Errorf("Product() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTCBMap(t *testing.T) {
+	got := TCBMap(0x4400000016000301, spb.SevProduct_SEV_PRODUCT_TURIN)
+	if got["fmc_spl"] != 1 || got["bl_spl"] != 3 || got["snp_spl"] != 22 || got["ucode_spl"] != 0x44 {
+		t.Errorf("TCBMap() = %v, want the Turin layout", got)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migrate upgrades serialized check.Config messages to the current schema version, so that
+// stored policies keep their meaning as the library adds fields.
+//
+// Each upgrade sets the fields that the newer schema interprets differently to values that preserve
+// the older meaning, and warns about settings whose defaults leave a security property unchecked.
+package migrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-sev-guest/abi"
+	cpb "github.com/google/go-sev-guest/proto/check"
+	"google.golang.org/protobuf/proto"
+)
+
+// CurrentVersion is the check.Config schema version that this library reads.
+const CurrentVersion = 1
+
+// reservedGuestPolicyBit is the POLICY bit that the SEV-SNP ABI requires to be 1.
+const reservedGuestPolicyBit = 1 << 17
+
+// Warning describes a setting of a migrated config that weakens validation.
+type Warning struct {
+	// Field is the config field path, e.g., "policy.vmpl".
+	Field string
+	// Message explains the consequence of the setting and how to strengthen it.
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Field, w.Message)
+}
+
+// upgrades[i] upgrades a config from schema version i to i+1.
+var upgrades = []func(config *cpb.Config) ([]Warning, error){
+	upgradeV0,
+}
+
+// upgradeV0 moves the deprecated root_of_trust.product to product_line and sets the reserved guest
+// policy bit that version 0 configs could omit.
+func upgradeV0(config *cpb.Config) ([]Warning, error) {
+	var warnings []Warning
+	rot := config.RootOfTrust
+	if product := rot.GetProduct(); product != "" {
+		line, stepping, hasStepping := strings.Cut(product, "-")
+		if rot.GetProductLine() != "" && rot.GetProductLine() != line {
+			return nil, fmt.Errorf("root_of_trust.product %q conflicts with root_of_trust.product_line %q",
+				product, rot.GetProductLine())
+		}
+		if hasStepping && config.Policy.GetProduct() == nil {
+			warnings = append(warnings, Warning{
+				Field: "root_of_trust.product",
+				Message: fmt.Sprintf("root_of_trust.product_line does not check the %s stepping; set policy.product",
+					stepping),
+			})
+		}
+		rot.ProductLine = line
+		rot.Product = ""
+	}
+	config.Policy.Policy |= reservedGuestPolicyBit
+	return warnings, nil
+}
+
+// Audit returns warnings for the settings of config whose values leave a security property
+// unchecked.
+func Audit(config *cpb.Config) []Warning {
+	var warnings []Warning
+	policy := config.GetPolicy()
+	if policy.GetVmpl() == nil && policy.GetMaximumVmpl() == nil {
+		warnings = append(warnings, Warning{
+			Field:   "policy.vmpl",
+			Message: "reports requested at any VMPL are accepted; set vmpl or maximum_vmpl",
+		})
+	}
+	if guestPolicy, err := abi.ParseSnpPolicy(policy.GetPolicy() | reservedGuestPolicyBit); err == nil {
+		if guestPolicy.Debug {
+			warnings = append(warnings, Warning{
+				Field:   "policy.policy",
+				Message: "guests that permit debugging are accepted, so the host may read their memory",
+			})
+		}
+		if guestPolicy.MigrateMA {
+			warnings = append(warnings, Warning{
+				Field:   "policy.policy",
+				Message: "guests that permit a migration agent are accepted",
+			})
+		}
+	}
+	idBlockFields := len(policy.GetFamilyId()) > 0 || len(policy.GetImageId()) > 0 ||
+		len(policy.GetFamilyIds()) > 0 || len(policy.GetImageIds()) > 0 ||
+		len(policy.GetFamilyIdPatterns()) > 0 || len(policy.GetImageIdPatterns()) > 0
+	if idBlockFields && !policy.GetRequireIdBlock() {
+		warnings = append(warnings, Warning{
+			Field:   "policy.require_id_block",
+			Message: "FAMILY_ID and IMAGE_ID are checked but no trusted key vouches for them; set require_id_block",
+		})
+	}
+	if policy.GetPermitProvisionalFirmware() && len(policy.GetTcbRelations()) == 0 &&
+		policy.GetMinimumCommittedTcb() == 0 && policy.GetMinimumCommittedTcbParts() == nil {
+		warnings = append(warnings, Warning{
+			Field:   "policy.permit_provisional_firmware",
+			Message: "the host may roll firmware back below CURRENT_TCB; set minimum_committed_tcb or tcb_relations",
+		})
+	}
+	if !config.GetRootOfTrust().GetCheckCrl() {
+		warnings = append(warnings, Warning{
+			Field:   "root_of_trust.check_crl",
+			Message: "revoked ASK and ASVK certificates are not detected",
+		})
+	}
+	return warnings
+}
+
+// Config returns config upgraded to CurrentVersion without modifying it, and the Audit warnings of
+// the upgraded config. Configs of a newer version than CurrentVersion are an error, since this
+// library would ignore the fields they depend on.
+func Config(config *cpb.Config) (*cpb.Config, []Warning, error) {
+	version := config.GetSchemaVersion()
+	if version > CurrentVersion {
+		return nil, nil, fmt.Errorf("config schema version %d is newer than the supported version %d", version, CurrentVersion)
+	}
+	result := proto.Clone(config).(*cpb.Config)
+	if result.RootOfTrust == nil {
+		result.RootOfTrust = &cpb.RootOfTrust{}
+	}
+	if result.Policy == nil {
+		result.Policy = &cpb.Policy{}
+	}
+	var warnings []Warning
+	for v := version; v < CurrentVersion; v++ {
+		w, err := upgrades[v](result)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not upgrade config from schema version %d: %v", v, err)
+		}
+		warnings = append(warnings, w...)
+	}
+	result.SchemaVersion = CurrentVersion
+	return result, append(warnings, Audit(result)...), nil
+}
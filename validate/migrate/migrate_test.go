@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"testing"
+
+	cpb "github.com/google/go-sev-guest/proto/check"
+	test "github.com/google/go-sev-guest/testing"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func hasWarning(warnings []Warning, field string) bool {
+	for _, w := range warnings {
+		if w.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func TestConfigUpgradesV0(t *testing.T) {
+	old := &cpb.Config{
+		RootOfTrust: &cpb.RootOfTrust{Product: "Milan-B1", CheckCrl: true},
+		Policy:      &cpb.Policy{Policy: 0x10000, Vmpl: wrapperspb.UInt32(0)},
+	}
+	oldCopy := proto.Clone(old)
+	got, warnings, err := Config(old)
+	if err != nil {
+		t.Fatalf("Config() = _, _, %v", err)
+	}
+	if !proto.Equal(old, oldCopy) {
+		t.Errorf("Config() modified its argument to %v", old)
+	}
+	if got.GetSchemaVersion() != CurrentVersion {
+		t.Errorf("Config().SchemaVersion = %d, want %d", got.GetSchemaVersion(), CurrentVersion)
+	}
+	if got.GetRootOfTrust().GetProductLine() != "Milan" || got.GetRootOfTrust().GetProduct() != "" {
+		t.Errorf("Config().RootOfTrust = %v, want product_line Milan", got.GetRootOfTrust())
+	}
+	if got.GetPolicy().GetPolicy() != 0x30000 {
+		t.Errorf("Config().Policy.Policy = 0x%x, want 0x30000", got.GetPolicy().GetPolicy())
+	}
+	if len(warnings) != 1 || !hasWarning(warnings, "root_of_trust.product") {
+		t.Errorf("Config() warnings = %v, want only the dropped stepping", warnings)
+	}
+
+	// An upgraded config is unchanged by another migration.
+	again, _, err := Config(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(again, got) {
+		t.Errorf("Config(Config()) = %v, want %v", again, got)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	if _, _, err := Config(&cpb.Config{SchemaVersion: CurrentVersion + 1}); !test.Match(err, "is newer than the supported version") {
+		t.Errorf("Config(future version) = _, _, %v. Want a version error", err)
+	}
+	conflict := &cpb.Config{RootOfTrust: &cpb.RootOfTrust{Product: "Milan", ProductLine: "Genoa"}}
+	if _, _, err := Config(conflict); !test.Match(err, `root_of_trust.product "Milan" conflicts`) {
+		t.Errorf("Config(conflicting products) = _, _, %v. Want a conflict error", err)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	weak := &cpb.Config{Policy: &cpb.Policy{
+		// Debug and migration agent permitted.
+		Policy:                    0xc0000,
+		FamilyId:                  make([]byte, 16),
+		PermitProvisionalFirmware: true,
+	}}
+	warnings := Audit(weak)
+	for _, field := range []string{"policy.vmpl", "policy.policy", "policy.require_id_block",
+		"policy.permit_provisional_firmware", "root_of_trust.check_crl"} {
+		if !hasWarning(warnings, field) {
+			t.Errorf("Audit() = %v, want a %s warning", warnings, field)
+		}
+	}
+	strong := &cpb.Config{
+		RootOfTrust: &cpb.RootOfTrust{CheckCrl: true},
+		Policy: &cpb.Policy{
+			Policy:                    0x30000,
+			MaximumVmpl:               wrapperspb.UInt32(0),
+			FamilyId:                  make([]byte, 16),
+			RequireIdBlock:            true,
+			PermitProvisionalFirmware: true,
+			TcbRelations:              []string{"launch<=committed"},
+		},
+	}
+	if warnings := Audit(strong); len(warnings) != 0 {
+		t.Errorf("Audit() = %v, want no warnings", warnings)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// BytePattern matches report fields whose bits under Mask equal Value's bits under Mask, e.g., to
+// accept any HOST_DATA that starts with a tenant's prefix.
+type BytePattern struct {
+	// Value is the expected field value. Bits outside Mask are ignored.
+	Value []byte
+	// Mask selects the bits of the field to compare. If nil, every bit is compared.
+	Mask []byte
+}
+
+// ParseBytePattern parses a pattern for a size-byte field from its hex form, in which '?' matches
+// any nibble and a trailing '*' matches the rest of the field. E.g., "0011??33*" matches the 16-byte
+// FAMILY_IDs that start with 0x00, 0x11, any byte, then 0x33.
+func ParseBytePattern(s string, size int) (*BytePattern, error) {
+	prefix := strings.HasSuffix(s, "*")
+	digits := strings.TrimSuffix(s, "*")
+	if !prefix && len(digits) != 2*size {
+		return nil, fmt.Errorf("pattern %q has %d nibbles, want %d or a trailing '*'", s, len(digits), 2*size)
+	}
+	if len(digits) > 2*size {
+		return nil, fmt.Errorf("pattern %q has %d nibbles, more than the field's %d", s, len(digits), 2*size)
+	}
+	p := &BytePattern{Value: make([]byte, size), Mask: make([]byte, size)}
+	for i, c := range digits {
+		if c == '?' {
+			continue
+		}
+		nibble, err := hex.DecodeString("0" + string(c))
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q has invalid character %q. Expect a hex digit, '?', or a trailing '*'", s, c)
+		}
+		shift := 4 * uint(1-i%2)
+		p.Value[i/2] |= nibble[0] << shift
+		p.Mask[i/2] |= 0xf << shift
+	}
+	return p, nil
+}
+
+func (p *BytePattern) check(option string, size int) error {
+	if len(p.Value) != size || (p.Mask != nil && len(p.Mask) != size) {
+		return fmt.Errorf("option %s entries must have a %d byte value and mask", option, size)
+	}
+	return nil
+}
+
+// Match returns whether given matches the pattern.
+func (p *BytePattern) Match(given []byte) bool {
+	if len(given) != len(p.Value) {
+		return false
+	}
+	for i := range given {
+		mask := byte(0xff)
+		if p.Mask != nil {
+			mask = p.Mask[i]
+		}
+		if given[i]&mask != p.Value[i]&mask {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the pattern in ParseBytePattern's form, or as value/mask in hex if the mask does
+// not select whole nibbles.
+func (p *BytePattern) String() string {
+	if p.Mask == nil {
+		return hex.EncodeToString(p.Value)
+	}
+	var sb strings.Builder
+	for i, v := range hex.EncodeToString(p.Value) {
+		switch (p.Mask[i/2] >> (4 * uint(1-i%2))) & 0xf {
+		case 0xf:
+			sb.WriteRune(v)
+		case 0:
+			sb.WriteByte('?')
+		default:
+			return hex.EncodeToString(p.Value) + "/" + hex.EncodeToString(p.Mask)
+		}
+	}
+	if s := sb.String(); strings.HasSuffix(s, "?") {
+		return strings.TrimRight(s, "?") + "*"
+	}
+	return sb.String()
+}
+
+// validateBytePatterns returns an error if the report field matches none of the non-empty patterns.
+func validateBytePatterns(option, field string, size int, given []byte, patterns []*BytePattern) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	var descs []string
+	for _, p := range patterns {
+		if err := p.check(option, size); err != nil {
+			return err
+		}
+		if p.Match(given) {
+			return nil
+		}
+		descs = append(descs, p.String())
+	}
+	return fmt.Errorf("report field %s is %s. Expect a match of one of [%s]",
+		field, hex.EncodeToString(given), strings.Join(descs, ", "))
+}
+
+func parseBytePatterns(name string, size int, patterns []string) ([]*BytePattern, error) {
+	var result []*BytePattern
+	for i, s := range patterns {
+		p, err := ParseBytePattern(s, size)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d]: %v", name, i, err)
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
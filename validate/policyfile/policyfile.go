@@ -0,0 +1,346 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policyfile reads and writes check.Config messages as policy files in binary protobuf,
+// prototext, JSON, or YAML format, so that infrastructure-as-code pipelines can write policies by
+// hand.
+//
+// JSON and YAML policies use the check.proto field names, in either their proto (snake_case) or
+// JSON (lowerCamelCase) spelling, and give bytes fields in hex rather than protojson's base64, e.g.,
+//
+//	schema_version: 1
+//	policy:
+//	  measurement: 6f7a...e2
+//	  maximum_vmpl: 0
+//	  family_id_patterns: ["0011*"]
+//
+// Every format rejects unknown fields. JSON and YAML policies get secure defaults for the fields
+// that they omit, since their authors cannot rely on protobuf's zero values being safe:
+//
+//	policy.policy            0x30000, i.e., permit SMT, but not debugging or a migration agent
+//	root_of_trust.check_crl  true
+package policyfile
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	cpb "github.com/google/go-sev-guest/proto/check"
+	"github.com/google/go-sev-guest/validate"
+	"github.com/google/go-sev-guest/validate/migrate"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Format is the serialization format of a check.Config.
+type Format int
+
+const (
+	// Binary is the binary protobuf wire format.
+	Binary Format = iota
+	// Textproto is the human-readable prototext format.
+	Textproto
+	// JSON is a JSON object of the check.proto fields with hex-encoded bytes.
+	JSON
+	// YAML is a YAML document of the check.proto fields with hex-encoded bytes.
+	YAML
+)
+
+// DefaultGuestPolicy is the policy.policy value of JSON and YAML policies that omit it.
+const DefaultGuestPolicy = 0x30000
+
+// FormatFromPath returns the format of the file path by extension: .textproto files are prototext,
+// .json files are JSON, .yaml and .yml files are YAML, and all other files are binary.
+func FormatFromPath(path string) Format {
+	switch {
+	case strings.HasSuffix(path, ".textproto"):
+		return Textproto
+	case strings.HasSuffix(path, ".json"):
+		return JSON
+	case strings.HasSuffix(path, ".yaml"), strings.HasSuffix(path, ".yml"):
+		return YAML
+	default:
+		return Binary
+	}
+}
+
+func fieldByName(fields protoreflect.FieldDescriptors, name string) protoreflect.FieldDescriptor {
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return fields.ByJSONName(name)
+}
+
+func hexToBase64(path string, value any) (any, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s is %v, want a hex string", path, value)
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not hex: %v", path, err)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// toProtoJSON rewrites the JSON object obj of message md in place into protojson's form, and
+// returns an error for fields that md does not have.
+func toProtoJSON(path string, md protoreflect.MessageDescriptor, obj map[string]any) error {
+	for name, value := range obj {
+		fieldPath := path + name
+		fd := fieldByName(md.Fields(), name)
+		if fd == nil {
+			return fmt.Errorf("unknown field %q of %s", fieldPath, md.FullName())
+		}
+		if value == nil {
+			// protojson reads null as the field's default.
+			continue
+		}
+		var err error
+		switch {
+		case fd.Kind() == protoreflect.BytesKind && fd.IsList():
+			list, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("%s is %v, want a list of hex strings", fieldPath, value)
+			}
+			for i := range list {
+				if list[i], err = hexToBase64(fmt.Sprintf("%s[%d]", fieldPath, i), list[i]); err != nil {
+					return err
+				}
+			}
+		case fd.Kind() == protoreflect.BytesKind:
+			if obj[name], err = hexToBase64(fieldPath, value); err != nil {
+				return err
+			}
+		case fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() &&
+			fd.Message().FullName().Parent() != "google.protobuf":
+			sub, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s is %v, want an object", fieldPath, value)
+			}
+			if err := toProtoJSON(fieldPath+".", fd.Message(), sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func has(obj map[string]any, md protoreflect.MessageDescriptor, name string) bool {
+	fd := md.Fields().ByName(protoreflect.Name(name))
+	_, byProtoName := obj[string(fd.Name())]
+	_, byJSONName := obj[fd.JSONName()]
+	return byProtoName || byJSONName
+}
+
+func object(obj map[string]any, md protoreflect.MessageDescriptor, name string) map[string]any {
+	fd := md.Fields().ByName(protoreflect.Name(name))
+	if sub, ok := obj[string(fd.Name())].(map[string]any); ok {
+		return sub
+	}
+	sub, _ := obj[fd.JSONName()].(map[string]any)
+	return sub
+}
+
+func unmarshalJSON(contents []byte) (*cpb.Config, error) {
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.UseNumber()
+	var obj map[string]any
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("policy is not a JSON object: %v", err)
+	}
+	config := &cpb.Config{}
+	md := config.ProtoReflect().Descriptor()
+	if err := toProtoJSON("", md, obj); err != nil {
+		return nil, err
+	}
+	rewritten, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := protojson.Unmarshal(rewritten, config); err != nil {
+		return nil, err
+	}
+	if config.RootOfTrust == nil {
+		config.RootOfTrust = &cpb.RootOfTrust{}
+	}
+	if config.Policy == nil {
+		config.Policy = &cpb.Policy{}
+	}
+	if !has(object(obj, md, "policy"), (&cpb.Policy{}).ProtoReflect().Descriptor(), "policy") {
+		config.Policy.Policy = DefaultGuestPolicy
+	}
+	if !has(object(obj, md, "root_of_trust"), (&cpb.RootOfTrust{}).ProtoReflect().Descriptor(), "check_crl") {
+		config.RootOfTrust.CheckCrl = true
+	}
+	return config, nil
+}
+
+// rejectUnknown returns an error if m or any message it holds has fields that its descriptor
+// does not, which binary protobuf deserialization otherwise silently keeps.
+func rejectUnknown(m protoreflect.Message) error {
+	if len(m.GetUnknown()) > 0 {
+		return fmt.Errorf("%s has unknown fields", m.Descriptor().FullName())
+	}
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() {
+			err = rejectUnknown(v.Message())
+		}
+		return err == nil
+	})
+	return err
+}
+
+// Unmarshal deserializes contents as a check.Config in the given format. It does not validate
+// the config's field values, so that, e.g., flags may still override them.
+func Unmarshal(contents []byte, format Format) (*cpb.Config, error) {
+	config := &cpb.Config{}
+	var err error
+	switch format {
+	case Binary:
+		if err = proto.Unmarshal(contents, config); err == nil {
+			err = rejectUnknown(config.ProtoReflect())
+		}
+	case Textproto:
+		err = prototext.Unmarshal(contents, config)
+	case JSON:
+		config, err = unmarshalJSON(contents)
+	case YAML:
+		var j []byte
+		if j, err = yaml.YAMLToJSON(contents); err == nil {
+			config, err = unmarshalJSON(j)
+		}
+	default:
+		return nil, fmt.Errorf("unknown policy format %d", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not deserialize policy: %v", err)
+	}
+	return config, nil
+}
+
+func base64ToHex(value any) any {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return value
+	}
+	return hex.EncodeToString(b)
+}
+
+// fromProtoJSON rewrites the protojson object obj of message md in place into the hex form that
+// unmarshalJSON reads.
+func fromProtoJSON(md protoreflect.MessageDescriptor, obj map[string]any) {
+	for name, value := range obj {
+		fd := fieldByName(md.Fields(), name)
+		if fd == nil {
+			continue
+		}
+		switch {
+		case fd.Kind() == protoreflect.BytesKind && fd.IsList():
+			list, _ := value.([]any)
+			for i := range list {
+				list[i] = base64ToHex(list[i])
+			}
+		case fd.Kind() == protoreflect.BytesKind:
+			obj[name] = base64ToHex(value)
+		case fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() &&
+			fd.Message().FullName().Parent() != "google.protobuf":
+			if sub, ok := value.(map[string]any); ok {
+				fromProtoJSON(fd.Message(), sub)
+			}
+		}
+	}
+}
+
+func marshalJSON(config *cpb.Config) ([]byte, error) {
+	// Emit every field, since omitted fields would get the secure defaults rather than their values.
+	j, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(j))
+	decoder.UseNumber()
+	var obj map[string]any
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+	fromProtoJSON(config.ProtoReflect().Descriptor(), obj)
+	return json.MarshalIndent(obj, "", "  ")
+}
+
+// Marshal serializes config in the given format such that Unmarshal returns an equal config. The
+// JSON and YAML forms spell out every field, so that the output is the fully resolved policy.
+func Marshal(config *cpb.Config, format Format) ([]byte, error) {
+	switch format {
+	case Binary:
+		return proto.Marshal(config)
+	case Textproto:
+		return prototext.MarshalOptions{Multiline: true}.Marshal(config)
+	case JSON:
+		return marshalJSON(config)
+	case YAML:
+		j, err := marshalJSON(config)
+		if err != nil {
+			return nil, err
+		}
+		return yaml.JSONToYAML(j)
+	default:
+		return nil, fmt.Errorf("unknown policy format %d", format)
+	}
+}
+
+// Validate upgrades config to the current schema and returns an error if its policy does not
+// translate to validate.Options, e.g., because a field has the wrong length. It returns the
+// upgraded config and the migration's warnings.
+func Validate(config *cpb.Config) (*cpb.Config, []migrate.Warning, error) {
+	upgraded, warnings, err := migrate.Config(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := validate.PolicyToOptions(upgraded.GetPolicy()); err != nil {
+		return nil, nil, fmt.Errorf("invalid policy: %v", err)
+	}
+	return upgraded, warnings, nil
+}
+
+// Load reads, deserializes, and validates the check.Config at path in the format that
+// FormatFromPath gives.
+func Load(path string) (*cpb.Config, []migrate.Warning, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read %q: %v", path, err)
+	}
+	config, err := Unmarshal(contents, FormatFromPath(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not load %q: %v", path, err)
+	}
+	config, warnings, err := Validate(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not load %q: %v", path, err)
+	}
+	return config, warnings, nil
+}
@@ -0,0 +1,245 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policyfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cpb "github.com/google/go-sev-guest/proto/check"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	test "github.com/google/go-sev-guest/testing"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var measurementHex = strings.Repeat("ab", 48)
+
+func TestUnmarshalYAML(t *testing.T) {
+	policy := []byte(`schema_version: 1
+policy:
+  measurement: ` + measurementHex + `
+  maximum_vmpl: 0
+  family_id_patterns: ["0011*"]
+root_of_trust:
+  product_line: Milan
+`)
+	config, err := Unmarshal(policy, YAML)
+	if err != nil {
+		t.Fatalf("Unmarshal(YAML) = _, %v", err)
+	}
+	if got := config.GetPolicy().GetMeasurement(); !bytes.Equal(got, bytes.Repeat([]byte{0xab}, 48)) {
+		t.Errorf("Unmarshal(YAML).Policy.Measurement = %x, want %s", got, measurementHex)
+	}
+	if got := config.GetPolicy().GetMaximumVmpl(); !proto.Equal(got, wrapperspb.UInt32(0)) {
+		t.Errorf("Unmarshal(YAML).Policy.MaximumVmpl = %v, want 0", got)
+	}
+	if got := config.GetPolicy().GetFamilyIdPatterns(); len(got) != 1 || got[0] != "0011*" {
+		t.Errorf("Unmarshal(YAML).Policy.FamilyIdPatterns = %v, want [0011*]", got)
+	}
+	if got := config.GetRootOfTrust().GetProductLine(); got != "Milan" {
+		t.Errorf("Unmarshal(YAML).RootOfTrust.ProductLine = %q, want Milan", got)
+	}
+}
+
+func TestUnmarshalDefaults(t *testing.T) {
+	tcs := []struct {
+		name         string
+		contents     string
+		format       Format
+		wantPolicy   uint64
+		wantCheckCrl bool
+	}{
+		{name: "empty JSON", contents: `{}`, format: JSON, wantPolicy: DefaultGuestPolicy, wantCheckCrl: true},
+		{name: "empty YAML", contents: `policy: {}`, format: YAML, wantPolicy: DefaultGuestPolicy, wantCheckCrl: true},
+		{
+			name:     "explicit JSON",
+			contents: `{"policy": {"policy": 720896}, "rootOfTrust": {"checkCrl": false}}`,
+			format:   JSON,
+			// 0xb0000 permits debugging.
+			wantPolicy: 0xb0000,
+		},
+		{name: "textproto", contents: ``, format: Textproto},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := Unmarshal([]byte(tc.contents), tc.format)
+			if err != nil {
+				t.Fatalf("Unmarshal(%q) = _, %v", tc.contents, err)
+			}
+			if got := config.GetPolicy().GetPolicy(); got != tc.wantPolicy {
+				t.Errorf("Unmarshal(%q).Policy.Policy = %#x, want %#x", tc.contents, got, tc.wantPolicy)
+			}
+			if got := config.GetRootOfTrust().GetCheckCrl(); got != tc.wantCheckCrl {
+				t.Errorf("Unmarshal(%q).RootOfTrust.CheckCrl = %v, want %v", tc.contents, got, tc.wantCheckCrl)
+			}
+		})
+	}
+}
+
+func TestUnmarshalUnknownFields(t *testing.T) {
+	binary, err := proto.Marshal(&cpb.Config{Policy: &cpb.Policy{MinimumGuestSvn: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Field 1000 of check.Config does not exist.
+	binary = protowire.AppendVarint(protowire.AppendTag(binary, 1000, protowire.VarintType), 1)
+	tcs := []struct {
+		name     string
+		contents []byte
+		format   Format
+		wantErr  string
+	}{
+		{
+			name:     "YAML",
+			contents: []byte("policy:\n  maximum_vmlp: 0\n"),
+			format:   YAML,
+			wantErr:  `unknown field "policy.maximum_vmlp" of check.Policy`,
+		},
+		{
+			name:     "JSON",
+			contents: []byte(`{"rootOfTrust": {"checkCRL": true}}`),
+			format:   JSON,
+			wantErr:  `unknown field "rootOfTrust.checkCRL" of check.RootOfTrust`,
+		},
+		{
+			name:     "textproto",
+			contents: []byte(`policy { minimum_svn: 1 }`),
+			format:   Textproto,
+			wantErr:  "minimum_svn",
+		},
+		{
+			name:     "binary",
+			contents: binary,
+			format:   Binary,
+			wantErr:  "check.Config has unknown fields",
+		},
+		{
+			name:     "bad hex",
+			contents: []byte(`{"policy": {"measurement": "zz"}}`),
+			format:   JSON,
+			wantErr:  "policy.measurement is not hex",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Unmarshal(tc.contents, tc.format); !test.Match(err, tc.wantErr) {
+				t.Errorf("Unmarshal(%q) = _, %v. Want error %q", tc.contents, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.yml")
+	if err := os.WriteFile(good, []byte("policy:\n  minimumGuestSvn: 2\n  vmpl: 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, warnings, err := Load(good)
+	if err != nil {
+		t.Fatalf("Load(%q) = _, _, %v", good, err)
+	}
+	if got := config.GetPolicy().GetMinimumGuestSvn(); got != 2 {
+		t.Errorf("Load(%q).Policy.MinimumGuestSvn = %d, want 2", good, got)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("Load(%q) warnings = %v, want none", good, warnings)
+	}
+
+	short := filepath.Join(dir, "short.json")
+	if err := os.WriteFile(short, []byte(`{"policy": {"measurement": "abcd"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Load(short); !test.Match(err, "invalid policy") {
+		t.Errorf("Load(%q) = _, _, %v. Want an invalid policy error", short, err)
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tcs := map[string]Format{
+		"policy.binarypb":  Binary,
+		"policy.textproto": Textproto,
+		"policy.json":      JSON,
+		"policy.yaml":      YAML,
+		"policy.yml":       YAML,
+	}
+	for path, want := range tcs {
+		if got := FormatFromPath(path); got != want {
+			t.Errorf("FormatFromPath(%q) = %d, want %d", path, got, want)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	config := &cpb.Config{
+		SchemaVersion: 1,
+		RootOfTrust:   &cpb.RootOfTrust{ProductLine: "Milan"},
+		Policy: &cpb.Policy{
+			Measurement:      bytes.Repeat([]byte{0xab}, 48),
+			FamilyIds:        [][]byte{bytes.Repeat([]byte{0x01}, 16)},
+			MaximumVmpl:      wrapperspb.UInt32(0),
+			FamilyIdPatterns: []string{"0011*"},
+			Product:          &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_MILAN},
+		},
+	}
+	for _, format := range []Format{Binary, Textproto, JSON, YAML} {
+		out, err := Marshal(config, format)
+		if err != nil {
+			t.Fatalf("Marshal(_, %d) = _, %v", format, err)
+		}
+		got, err := Unmarshal(out, format)
+		if err != nil {
+			t.Fatalf("Unmarshal(Marshal(_, %d)) = _, %v. Output: %s", format, err, out)
+		}
+		// A resolved policy keeps its zero guest policy and CRL setting rather than getting defaults.
+		if !proto.Equal(got, config) {
+			t.Errorf("Unmarshal(Marshal(_, %d)) = %v, want %v", format, got, config)
+		}
+	}
+	out, err := Marshal(config, YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "measurement: "+measurementHex) {
+		t.Errorf("Marshal(_, YAML) = %s, want a hex measurement", out)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	tcs := []struct {
+		format   Format
+		contents string
+	}{
+		{format: Textproto, contents: `policy { minimum_guest_svn: 3 }`},
+		{format: JSON, contents: `{"policy": {"minimumGuestSvn": 3}}`},
+	}
+	for _, tc := range tcs {
+		config, err := Unmarshal([]byte(tc.contents), tc.format)
+		if err != nil {
+			t.Fatalf("Unmarshal(%q, %v) = _, %v. Want nil", tc.contents, tc.format, err)
+		}
+		if got := config.GetPolicy().GetMinimumGuestSvn(); got != 3 {
+			t.Errorf("Unmarshal(%q, %v) minimum_guest_svn = %d, want 3", tc.contents, tc.format, got)
+		}
+	}
+	if _, err := Unmarshal([]byte("policy {"), Textproto); err == nil {
+		t.Error("Unmarshal(truncated textproto) = _, nil. Want error")
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package regopolicy validates attestation reports against Open Policy Agent (OPA) Rego policies,
+// for organizations that already manage their policies in Rego.
+//
+// The policy's input document has these fields:
+//
+//	report             the attestation report's fields by their proto names, with bytes in hex
+//	product            {"name": "SEV_PRODUCT_MILAN", "stepping": 1}, from the attestation or else
+//	                   the report's CPUID fields
+//	endorsement_key    the V[CL]EK certificate's signer, product_name, hwid, and tcb, if present
+//	guest_policy       report.policy decomposed as in celpolicy, e.g., input.guest_policy.debug
+//	current_tcb        report.current_tcb decomposed, e.g., input.current_tcb.snp_spl
+//	reported_tcb       report.reported_tcb decomposed
+//	committed_tcb      report.committed_tcb decomposed
+//	launch_tcb         report.launch_tcb decomposed
+//	validation         each validate.Result check as {"check", "passed", "violations"}, if given
+//
+// The TCBs are decomposed in the product's TCB layout.
+//
+// The query's value is the decision. It may be a bool, an array or set of violation strings that
+// is empty when the attestation is acceptable, or an object with a bool "allow" field and an
+// optional "violations" array.
+package regopolicy
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/kds"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/google/go-sev-guest/validate"
+	"github.com/google/go-sev-guest/validate/internal/policyinput"
+	"github.com/open-policy-agent/opa/rego"
+	"go.uber.org/multierr"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Policy is a prepared Rego query. It is safe for concurrent use, so prepare a policy once and reuse
+// it for every attestation.
+type Policy struct {
+	query    string
+	prepared rego.PreparedEvalQuery
+}
+
+// Decision is the outcome of evaluating a policy.
+type Decision struct {
+	// Allow is whether the attestation satisfies the policy.
+	Allow bool
+	// Violations are the policy's reasons to reject the attestation, if it gives any.
+	Violations []string
+}
+
+// Compile parses and compiles the Rego modules, keyed by file name, and prepares query, e.g.,
+// "data.sevsnp.allow" or "data.sevsnp.deny", for evaluation.
+func Compile(ctx context.Context, query string, modules map[string]string) (*Policy, error) {
+	opts := []func(*rego.Rego){rego.Query(query)}
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		opts = append(opts, rego.Module(name, modules[name]))
+	}
+	prepared, err := rego.New(opts...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not prepare Rego query %q: %v", query, err)
+	}
+	return &Policy{query: query, prepared: prepared}, nil
+}
+
+func fieldValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	switch fd.Kind() {
+	case protoreflect.BytesKind:
+		return hex.EncodeToString(v.Bytes())
+	case protoreflect.BoolKind:
+		return v.Bool()
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int64(v.Enum())
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+		return v.Int()
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		return v.Uint()
+	case protoreflect.MessageKind:
+		return messageMap(v.Message())
+	default:
+		return v.Interface()
+	}
+}
+
+// messageMap returns every field of m, set or not, by its proto name.
+func messageMap(m protoreflect.Message) map[string]any {
+	result := map[string]any{}
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.IsList() || fd.IsMap() {
+			continue
+		}
+		if fd.Kind() == protoreflect.MessageKind && !m.Has(fd) {
+			continue
+		}
+		result[string(fd.Name())] = fieldValue(fd, m.Get(fd))
+	}
+	return result
+}
+
+// endorsementKeyMap describes the V[CL]EK certificate that signs the report, or returns nil if the
+// attestation does not have a readable one.
+func endorsementKeyMap(attestation *spb.Attestation, info abi.SignerInfo, product spb.SevProduct_SevProductName) map[string]any {
+	var der []byte
+	switch info.SigningKey {
+	case abi.VcekReportSigner:
+		der = attestation.GetCertificateChain().GetVcekCert()
+	case abi.VlekReportSigner:
+		der = attestation.GetCertificateChain().GetVlekCert()
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil
+	}
+	exts, err := kds.CertificateExtensions(cert, info.SigningKey)
+	if err != nil {
+		return nil
+	}
+	return map[string]any{
+		"signer":       info.SigningKey.String(),
+		"product_name": exts.ProductName,
+		"hwid":         hex.EncodeToString(exts.HWID),
+		"tcb":          policyinput.TCBMap(exts.TCBVersion, product),
+	}
+}
+
+// Input returns the input document of a policy for attestation and, if not nil, the outcome of
+// validate.SnpAttestationWithResult.
+func Input(attestation *spb.Attestation, result *validate.Result) (map[string]any, error) {
+	report := attestation.GetReport()
+	if report == nil {
+		return nil, errors.New("attestation missing report")
+	}
+	guestPolicy, err := abi.ParseSnpPolicy(report.GetPolicy())
+	if err != nil {
+		return nil, fmt.Errorf("could not parse guest policy: %v", err)
+	}
+	info, err := abi.ProtoSignerInfo(report)
+	if err != nil {
+		return nil, err
+	}
+	product := policyinput.Product(attestation)
+	name := product.GetName()
+	decompose := func(tcb uint64) map[string]uint64 { return policyinput.TCBMap(kds.TCBVersion(tcb), name) }
+	input := map[string]any{
+		"report":        messageMap(report.ProtoReflect()),
+		"product":       map[string]any{"name": name.String(), "stepping": product.GetMachineStepping().GetValue()},
+		"guest_policy":  policyinput.GuestPolicyMap(guestPolicy),
+		"current_tcb":   decompose(report.GetCurrentTcb()),
+		"reported_tcb":  decompose(report.GetReportedTcb()),
+		"committed_tcb": decompose(report.GetCommittedTcb()),
+		"launch_tcb":    decompose(report.GetLaunchTcb()),
+	}
+	if key := endorsementKeyMap(attestation, info, name); key != nil {
+		input["endorsement_key"] = key
+	}
+	if result != nil {
+		var checks []any
+		for _, c := range result.Checks {
+			violations := make([]any, 0, len(c.Violations))
+			for _, v := range c.Violations {
+				violations = append(violations, v)
+			}
+			checks = append(checks, map[string]any{"check": string(c.Check), "passed": c.Passed, "violations": violations})
+		}
+		input["validation"] = checks
+	}
+	return input, nil
+}
+
+func stringList(value any) ([]string, bool) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, false
+	}
+	result := make([]string, 0, len(list))
+	for _, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, s)
+	}
+	return result, true
+}
+
+func (p *Policy) decision(value any) (*Decision, error) {
+	switch v := value.(type) {
+	case bool:
+		return &Decision{Allow: v}, nil
+	case []any:
+		violations, ok := stringList(v)
+		if !ok {
+			return nil, fmt.Errorf("Rego query %q evaluated to %v, want violation strings", p.query, v)
+		}
+		return &Decision{Allow: len(violations) == 0, Violations: violations}, nil
+	case map[string]any:
+		allow, ok := v["allow"].(bool)
+		if !ok {
+			return nil, fmt.Errorf("Rego query %q evaluated to %v, want a bool \"allow\" field", p.query, v)
+		}
+		var violations []string
+		if vs, present := v["violations"]; present {
+			if violations, ok = stringList(vs); !ok {
+				return nil, fmt.Errorf("Rego query %q evaluated to %v, want violation strings", p.query, vs)
+			}
+		}
+		return &Decision{Allow: allow, Violations: violations}, nil
+	default:
+		return nil, fmt.Errorf("Rego query %q evaluated to %v, want a bool, violation strings, or an object", p.query, v)
+	}
+}
+
+// Evaluate returns the policy's decision on attestation and, if not nil, the outcome of
+// validate.SnpAttestationWithResult. An undefined query is a decision to reject.
+func (p *Policy) Evaluate(ctx context.Context, attestation *spb.Attestation, result *validate.Result) (*Decision, error) {
+	input, err := Input(attestation, result)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := p.prepared.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return nil, fmt.Errorf("could not evaluate Rego query %q: %v", p.query, err)
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return &Decision{Violations: []string{fmt.Sprintf("Rego query %q is undefined", p.query)}}, nil
+	}
+	return p.decision(rs[0].Expressions[0].Value)
+}
+
+// Validate returns an error that joins the policy's violations if attestation does not satisfy
+// the policy. Like validate.SnpAttestation, it does not verify the report's signature, so only
+// validate verified attestations.
+func (p *Policy) Validate(ctx context.Context, attestation *spb.Attestation, result *validate.Result) error {
+	d, err := p.Evaluate(ctx, attestation, result)
+	if err != nil {
+		return err
+	}
+	if d.Allow {
+		return nil
+	}
+	if len(d.Violations) == 0 {
+		return fmt.Errorf("attestation does not satisfy Rego query %q", p.query)
+	}
+	var errs error
+	for _, v := range d.Violations {
+		errs = multierr.Append(errs, errors.New(v))
+	}
+	return errs
+}
+
+// CustomCheck returns a validate.CustomCheck named name that runs the policy, so that its
+// decision is part of validate.SnpAttestationWithResult's Result with one violation per reason.
+// The policy's input has no validation field, since the Result is not yet complete.
+func (p *Policy) CustomCheck(ctx context.Context, name validate.CheckName) *validate.CustomCheck {
+	return &validate.CustomCheck{
+		Name: name,
+		Validate: func(attestation *spb.Attestation) error {
+			return p.Validate(ctx, attestation, nil)
+		},
+	}
+}
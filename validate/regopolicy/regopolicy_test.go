@@ -0,0 +1,189 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regopolicy
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/google/go-sev-guest/abi"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	test "github.com/google/go-sev-guest/testing"
+	"github.com/google/go-sev-guest/validate"
+	"github.com/google/go-sev-guest/verify/testdata"
+)
+
+// The test report's guest permits debugging, and its REPORTED_TCB has SNP SPL 5.
+const testModule = `
+package sevsnp
+
+default allow := false
+
+allow {
+	count(deny) == 0
+}
+
+deny[msg] {
+	input.guest_policy.debug
+	msg := "guest permits debugging"
+}
+
+deny[msg] {
+	input.reported_tcb.snp_spl < 8
+	msg := sprintf("SNP SPL %d is below 8", [input.reported_tcb.snp_spl])
+}
+
+decision := {"allow": allow, "violations": [msg | deny[msg]]}
+
+same_chip {
+	input.endorsement_key.hwid == input.report.chip_id
+	input.endorsement_key.signer == "VCEK"
+}
+
+failed_checks := {c.check | c := input.validation[_]; not c.passed}
+`
+
+func testAttestation(t *testing.T) *spb.Attestation {
+	t.Helper()
+	report, err := abi.ReportToProto(testdata.AttestationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &spb.Attestation{
+		Report:           report,
+		CertificateChain: &spb.CertificateChain{VcekCert: testdata.VcekBytes},
+		Product:          &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_MILAN},
+	}
+}
+
+func compile(t *testing.T, query string) *Policy {
+	t.Helper()
+	p, err := Compile(context.Background(), query, map[string]string{"sevsnp.rego": testModule})
+	if err != nil {
+		t.Fatalf("Compile(%q) = _, %v", query, err)
+	}
+	return p
+}
+
+var wantViolations = []string{"SNP SPL 5 is below 8", "guest permits debugging"}
+
+func sameStrings(got, want []string) bool {
+	got = append([]string{}, got...)
+	sort.Strings(got)
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEvaluate(t *testing.T) {
+	ctx := context.Background()
+	attestation := testAttestation(t)
+	tcs := []struct {
+		query          string
+		wantAllow      bool
+		wantViolations []string
+	}{
+		{query: "data.sevsnp.allow"},
+		{query: "data.sevsnp.deny", wantViolations: wantViolations},
+		{query: "data.sevsnp.decision", wantViolations: wantViolations},
+		{query: "data.sevsnp.same_chip", wantAllow: true},
+		{query: "data.sevsnp.undefined", wantViolations: []string{`Rego query "data.sevsnp.undefined" is undefined`}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.query, func(t *testing.T) {
+			d, err := compile(t, tc.query).Evaluate(ctx, attestation, nil)
+			if err != nil {
+				t.Fatalf("Evaluate() = _, %v", err)
+			}
+			if d.Allow != tc.wantAllow || !sameStrings(d.Violations, tc.wantViolations) {
+				t.Errorf("Evaluate() = %+v, want allow %v with violations %v", d, tc.wantAllow, tc.wantViolations)
+			}
+		})
+	}
+}
+
+func TestEvaluateValidationResult(t *testing.T) {
+	ctx := context.Background()
+	attestation := testAttestation(t)
+	res, _ := validate.SnpAttestationWithResult(attestation, &validate.Options{
+		GuestPolicy: abi.SnpPolicy{SMT: true},
+	})
+	d, err := compile(t, "data.sevsnp.failed_checks").Evaluate(ctx, attestation, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Allow || !sameStrings(d.Violations, []string{string(validate.CheckGuestPolicy)}) {
+		t.Errorf("Evaluate(failed_checks) = %+v, want the guest_policy check", d)
+	}
+}
+
+func TestCustomCheck(t *testing.T) {
+	ctx := context.Background()
+	attestation := testAttestation(t)
+	p := compile(t, "data.sevsnp.deny")
+	res, err := validate.SnpAttestationWithResult(attestation, &validate.Options{
+		GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true, MigrateMA: true},
+		PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+		CustomChecks: []*validate.CustomCheck{p.CustomCheck(ctx, "rego")},
+	})
+	if !test.Match(err, "guest permits debugging") {
+		t.Errorf("SnpAttestationWithResult() = _, %v. Want the Rego violations", err)
+	}
+	if c := res.Check("rego"); c == nil || c.Passed || len(c.Violations) != 2 {
+		t.Errorf("SnpAttestationWithResult().Check(\"rego\") = %+v, want 2 violations", c)
+	}
+}
+
+func TestInputProductFromReport(t *testing.T) {
+	// The Turin layout has the FMC SPL in the lowest byte.
+	turin := &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_TURIN}
+	attestation := &spb.Attestation{Report: &spb.Report{
+		Version:      abi.ReportVersion3,
+		Cpuid1EaxFms: abi.MaskedCpuid1EaxFromSevProduct(turin),
+		Policy:       1 << 17, // The reserved bit that must be 1.
+		ReportedTcb:  0x4400000016000301,
+	}}
+	input, err := Input(attestation, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := input["product"].(map[string]any)["name"]; name != "SEV_PRODUCT_TURIN" {
+		t.Errorf("Input() product name = %v, want SEV_PRODUCT_TURIN from the report's CPUID fields", name)
+	}
+	tcb := input["reported_tcb"].(map[string]uint64)
+	if tcb["fmc_spl"] != 1 || tcb["bl_spl"] != 3 || tcb["snp_spl"] != 22 {
+		t.Errorf("Input() reported_tcb = %v, want it in the Turin layout", tcb)
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	if _, err := Compile(context.Background(), "data.sevsnp.allow", map[string]string{"bad.rego": "package"}); !test.Match(err, "could not prepare Rego query") {
+		t.Errorf("Compile(bad module) = _, %v. Want a prepare error", err)
+	}
+	p, err := Compile(context.Background(), `"not a decision"`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Evaluate(context.Background(), testAttestation(t), nil); !test.Match(err, "want a bool, violation strings, or an object") {
+		t.Errorf("Evaluate(string query) = _, %v. Want a decision type error", err)
+	}
+}
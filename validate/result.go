@@ -0,0 +1,103 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import "go.uber.org/multierr"
+
+// CheckName identifies one group of policy checks.
+type CheckName string
+
+const (
+	// CheckEndorsementKey reads the TCB and HWID extensions of the V[CL]EK certificate, and checks
+	// the report's signing key against Options.SigningKey.
+	CheckEndorsementKey CheckName = "endorsement_key"
+	// CheckGuestSvn checks GUEST_SVN against Options.MinimumGuestSvn.
+	CheckGuestSvn CheckName = "guest_svn"
+	// CheckGuestPolicy checks POLICY against Options.GuestPolicy.
+	CheckGuestPolicy CheckName = "guest_policy"
+	// CheckFields checks the fields with expected values, such as MEASUREMENT and REPORT_DATA.
+	CheckFields CheckName = "fields"
+	// CheckFreshness checks REPORT_DATA against Options.Freshness.
+	CheckFreshness CheckName = "freshness"
+	// CheckTCB checks the report's and certificate's TCB values against each other and the
+	// policy minimums.
+	CheckTCB CheckName = "tcb"
+	// CheckVersion checks the firmware build and API version.
+	CheckVersion CheckName = "version"
+	// CheckPlatformInfo checks PLATFORM_INFO.
+	CheckPlatformInfo CheckName = "platform_info"
+	// CheckKeys checks the ID block's ID and author keys.
+	CheckKeys CheckName = "keys"
+	// CheckVMPL checks the VMPL.
+	CheckVMPL CheckName = "vmpl"
+	// CheckChipID checks that CHIP_ID is the VCEK certificate's HWID.
+	CheckChipID CheckName = "chip_id"
+	// CheckCertTable runs Options.CertTableOptions.
+	CheckCertTable CheckName = "cert_table"
+)
+
+// CheckResult is the outcome of one group of policy checks.
+type CheckResult struct {
+	Check CheckName
+	// Passed is whether every check of the group succeeded.
+	Passed bool
+	// Violations describes each violated constraint of the group with its expected and reported
+	// values.
+	Violations []string
+}
+
+// Result enumerates the policy checks that validation performed, in order.
+type Result struct {
+	Checks []*CheckResult
+}
+
+// Passed returns whether every check succeeded.
+func (r *Result) Passed() bool {
+	for _, c := range r.Checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Check returns the outcome of the named check, or nil if it did not run.
+func (r *Result) Check(name CheckName) *CheckResult {
+	for _, c := range r.Checks {
+		if c.Check == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Violations returns every violated constraint of every check.
+func (r *Result) Violations() []string {
+	var result []string
+	for _, c := range r.Checks {
+		result = append(result, c.Violations...)
+	}
+	return result
+}
+
+// record appends the outcome of check to r and returns err.
+func (r *Result) record(check CheckName, err error) error {
+	result := &CheckResult{Check: check, Passed: err == nil}
+	for _, e := range multierr.Errors(err) {
+		result.Violations = append(result.Violations, e.Error())
+	}
+	r.Checks = append(r.Checks, result)
+	return err
+}
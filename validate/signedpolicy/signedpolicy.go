@@ -0,0 +1,135 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package signedpolicy loads check.Config messages whose serialized contents carry a detached
+// ECDSA signature, so that whoever can write the policy file cannot also weaken the policy
+// without the signing key.
+//
+// A signature is the ASN.1 DER-encoded ECDSA signature of the SHA-256 (P-256 keys) or SHA-384
+// (P-384 keys) digest of the exact file contents, as produced by, e.g.,
+//
+//	openssl dgst -sha384 -sign key.pem -out policy.textproto.sig policy.textproto
+package signedpolicy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	cpb "github.com/google/go-sev-guest/proto/check"
+	"github.com/google/go-sev-guest/validate/policyfile"
+)
+
+func digest(curve elliptic.Curve, contents []byte) (crypto.Hash, []byte, error) {
+	switch curve {
+	case elliptic.P256():
+		d := sha256.Sum256(contents)
+		return crypto.SHA256, d[:], nil
+	case elliptic.P384():
+		d := sha512.Sum384(contents)
+		return crypto.SHA384, d[:], nil
+	default:
+		return 0, nil, fmt.Errorf("unsupported policy signing curve %v. Expect P-256 or P-384", curve.Params().Name)
+	}
+}
+
+// Sign returns the detached signature of contents by key.
+func Sign(key *ecdsa.PrivateKey, contents []byte) ([]byte, error) {
+	hash, d, err := digest(key.Curve, contents)
+	if err != nil {
+		return nil, err
+	}
+	return key.Sign(rand.Reader, d, hash)
+}
+
+// Verify returns an error if signature is not key's detached signature of contents.
+func Verify(key *ecdsa.PublicKey, contents, signature []byte) error {
+	if key == nil {
+		return errors.New("no policy verification key")
+	}
+	_, d, err := digest(key.Curve, contents)
+	if err != nil {
+		return err
+	}
+	if !ecdsa.VerifyASN1(key, d, signature) {
+		return errors.New("policy signature does not verify with the policy verification key")
+	}
+	return nil
+}
+
+// ParsePublicKey parses a PEM-encoded PKIX ECDSA public key or an x.509 certificate that holds one.
+func ParsePublicKey(pemBytes []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("policy verification key is not PEM-encoded")
+	}
+	var pub any
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse policy verification key: %v", err)
+		}
+		pub = key
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse policy verification certificate: %v", err)
+		}
+		pub = cert.PublicKey
+	default:
+		return nil, fmt.Errorf("policy verification key has PEM type %q. Expect \"PUBLIC KEY\" or \"CERTIFICATE\"", block.Type)
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("policy verification key is %T, not an ECDSA public key", pub)
+	}
+	return key, nil
+}
+
+// ParseConfig verifies signature over contents with key, and only then deserializes contents as
+// a check.Config in the given format.
+func ParseConfig(contents, signature []byte, key *ecdsa.PublicKey, format policyfile.Format) (*cpb.Config, error) {
+	if err := Verify(key, contents, signature); err != nil {
+		return nil, err
+	}
+	return policyfile.Unmarshal(contents, format)
+}
+
+// LoadConfig reads the check.Config at path and its detached signature at signaturePath, and
+// returns the config only if the signature verifies with key. The config format follows
+// policyfile.FormatFromPath.
+func LoadConfig(path, signaturePath string, key *ecdsa.PublicKey) (*cpb.Config, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %q: %v", path, err)
+	}
+	signature, err := os.ReadFile(signaturePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read policy signature %q: %v", signaturePath, err)
+	}
+	config, err := ParseConfig(contents, signature, key, policyfile.FormatFromPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("could not load %q: %v", path, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signedpolicy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	test "github.com/google/go-sev-guest/testing"
+	"github.com/google/go-sev-guest/validate/policyfile"
+)
+
+const testPolicy = `policy { minimum_guest_svn: 3 }`
+
+func TestLoadConfig(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384()} {
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			key, err := ecdsa.GenerateKey(curve, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signature, err := Sign(key, []byte(testPolicy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := t.TempDir()
+			path := filepath.Join(dir, "policy.textproto")
+			sigPath := path + ".sig"
+			if err := os.WriteFile(path, []byte(testPolicy), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(sigPath, signature, 0644); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadConfig(path, sigPath, &key.PublicKey)
+			if err != nil {
+				t.Fatalf("LoadConfig() = _, %v", err)
+			}
+			if got := config.GetPolicy().GetMinimumGuestSvn(); got != 3 {
+				t.Errorf("LoadConfig().Policy.MinimumGuestSvn = %d, want 3", got)
+			}
+
+			// An attacker who weakens the policy cannot also sign it.
+			if err := os.WriteFile(path, []byte(`policy { minimum_guest_svn: 0 }`), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadConfig(path, sigPath, &key.PublicKey); !test.Match(err, "policy signature does not verify") {
+				t.Errorf("LoadConfig(modified policy) = _, %v. Want a signature error", err)
+			}
+		})
+	}
+}
+
+func TestParseConfigWrongKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := Sign(key, []byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseConfig([]byte(testPolicy), signature, &other.PublicKey, policyfile.Textproto); !test.Match(err, "policy signature does not verify") {
+		t.Errorf("ParseConfig(_, _, other key) = _, %v. Want a signature error", err)
+	}
+	if _, err := ParseConfig([]byte(testPolicy), signature, nil, policyfile.Textproto); !test.Match(err, "no policy verification key") {
+		t.Errorf("ParseConfig(_, _, nil) = _, %v. Want a missing key error", err)
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParsePublicKey() = _, %v", err)
+	}
+	if !got.Equal(&key.PublicKey) {
+		t.Errorf("ParsePublicKey() = %v, want %v", got, key.PublicKey)
+	}
+	if _, err := ParsePublicKey(der); !test.Match(err, "not PEM-encoded") {
+		t.Errorf("ParsePublicKey(DER) = _, %v. Want a PEM error", err)
+	}
+}
@@ -28,10 +28,12 @@ import (
 
 	"github.com/google/go-sev-guest/abi"
 	"github.com/google/go-sev-guest/kds"
+	"github.com/google/go-sev-guest/measure"
 	cpb "github.com/google/go-sev-guest/proto/check"
 	spb "github.com/google/go-sev-guest/proto/sevsnp"
 	"github.com/google/logger"
 	"go.uber.org/multierr"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 // Options represents verification options for an SEV-SNP attestation report.
@@ -42,45 +44,107 @@ type Options struct {
 	MinimumGuestSvn uint32
 	// ReportData is the expected REPORT_DATA field. Must be nil or 64 bytes long. Not checked if nil.
 	ReportData []byte
+	// Freshness checks that REPORT_DATA is the FreshReportData of the relying party's nonce, and
+	// that its timestamp is recent. Not checked if nil.
+	Freshness *Freshness
 	// HostData is the expected HOST_DATA field. Must be nil or 32 bytes long. Not checked if nil.
 	HostData []byte
+	// HostDataPatterns is the set of acceptable HOST_DATA patterns, e.g., a tenant's prefix when a
+	// multi-tenant host encodes variable data in the rest. Not checked if empty. Checked in addition
+	// to HostData.
+	HostDataPatterns []*BytePattern
 	// ImageID is the expected IMAGE_ID field. Must be nil or 16 bytes long. Not checked if nil.
 	ImageID []byte
+	// ImageIDs is the set of acceptable IMAGE_ID values. Each must be 16 bytes long. Not checked if
+	// empty. Checked in addition to ImageID.
+	ImageIDs [][]byte
+	// ImageIDPatterns is the set of acceptable IMAGE_ID patterns. Not checked if empty. Checked in
+	// addition to ImageID and ImageIDs.
+	ImageIDPatterns []*BytePattern
 	// FamilyID is the expected FAMILY_ID field. Must be nil or 16 bytes long. Not checked if nil.
 	FamilyID []byte
+	// FamilyIDs is the set of acceptable FAMILY_ID values. Each must be 16 bytes long. Not checked
+	// if empty. Checked in addition to FamilyID.
+	FamilyIDs [][]byte
+	// FamilyIDPatterns is the set of acceptable FAMILY_ID patterns. Not checked if empty. Checked in
+	// addition to FamilyID and FamilyIDs.
+	FamilyIDPatterns []*BytePattern
 	// ReportID is the expected REPORT_ID field. Must be nil or 32 bytes long. Not checked if nil.
 	ReportID []byte
 	// ReportIDMA is the expected REPORT_ID_MA field. Must be nil or 32 bytes long. Not checked if nil.
 	ReportIDMA []byte
 	// Measurement is the expected MEASUREMENT field. Must be nil or 48 bytes long. Not checked if nil.
 	Measurement []byte
+	// Measurements is the set of acceptable MEASUREMENT values, e.g., one per supported image
+	// version. Each must be 48 bytes long. Not checked if empty. Checked in addition to Measurement.
+	Measurements [][]byte
+	// MeasurementSpec describes the launch inputs from which to compute the expected MEASUREMENT.
+	// Not checked if nil. Computing the launch digest hashes every input, so to validate many
+	// reports, prefer MeasurementManifest with the spec's precomputed manifest.
+	MeasurementSpec *measure.Spec
+	// MeasurementManifest is a precomputed expected MEASUREMENT and a description of its inputs
+	// that explains mismatches. Not checked if nil.
+	MeasurementManifest *measure.Manifest
 	// ChipID is the expected CHIP_ID field. Must be nil or 64 bytes long. Not checked if nil.
 	ChipID []byte
+	// ChipIDs is the set of acceptable CHIP_ID values, e.g., of the machines of a fleet. Each must be
+	// 64 bytes long. Not checked if empty. Checked in addition to ChipID.
+	ChipIDs [][]byte
+	// SigningKey is the key that must have signed the report, e.g., abi.VlekReportSigner for cloud
+	// providers that endorse their hosts with a VLEK. Not checked if nil.
+	SigningKey *abi.ReportSigner
 	// MinimumBuild is the minimum firmware build version reported in the attestation report.
 	MinimumBuild uint8
 	// MinimumVersion is the minimum firmware API version reported in the attestation report,
 	// where the MSB is the major number and the LSB is the minor number.
 	MinimumVersion uint16
 	// MinimumTCB is the component-wise minimum TCB reported in the attestation report. This
-	// does not include the LaunchTCB.
+	// does not include the LaunchTCB. The report's TCB values are decomposed in the TCB layout of
+	// the product, so FmcSpl only applies to Turin and later.
 	MinimumTCB kds.TCBParts
 	// MinimumLaunchTCB is the component-wise minimum for the attestation report LaunchTCB.
 	MinimumLaunchTCB kds.TCBParts
+	// MinimumCommittedTCB is the component-wise minimum for the attestation report COMMITTED_TCB,
+	// i.e., the lowest TCB that the host could roll the firmware back to.
+	MinimumCommittedTCB kds.TCBParts
+	// TCBRelations are component-wise orderings that the report's TCB values must obey, e.g.,
+	// LAUNCH_TCB <= COMMITTED_TCB so that the firmware cannot roll back below the TCB at which
+	// the guest launched. They are compared in the TCB layout of the product. A TCBOrdering's
+	// Relations are a preset of them.
+	TCBRelations []TCBRelation
+	// Product is the product whose TCB layout the report uses. If nil, uses the attestation's
+	// product, or else the product that the report's CPUID fields state, or else the product named
+	// in the V[CL]EK certificate, or else Milan.
+	Product *spb.SevProduct
 	// PermitProvisionalFirmware if true, allows the committed TCB, build, and API values to be less
 	// than or equal to the current values. If false, committed and current values must be equal.
 	PermitProvisionalFirmware bool
 	// PlatformInfo is the maximum of acceptable PLATFORM_INFO data. Not checked if nil.
 	PlatformInfo *abi.SnpPlatformInfo
+	// RequiredPlatformInfo's true fields are PLATFORM_INFO features that the report must have, e.g.,
+	// RAPLDisabled or CiphertextHidingDRAMEnabled. Not checked if nil.
+	RequiredPlatformInfo *abi.SnpPlatformInfo
+	// ForbiddenPlatformInfo's true fields are PLATFORM_INFO features that the report must not have,
+	// e.g., SMTEnabled. Not checked if nil.
+	ForbiddenPlatformInfo *abi.SnpPlatformInfo
+	// RequireConsistentSMT if true, will not validate a report whose PLATFORM_INFO has SMT enabled
+	// while its guest POLICY does not permit SMT, which no genuine firmware produces.
+	RequireConsistentSMT bool
 	// RequireAuthorKey if true, will not validate a report without AUTHOR_KEY_EN equal to 1.
 	// Implies RequireIDBlock is true.
 	RequireAuthorKey bool
 	// VMPL is the expected VMPL value, 0-3. Unchecked if nil.
 	VMPL *int
+	// MaximumVMPL is the least privileged VMPL, 0-3, at which the report may have been requested.
+	// E.g., 0 for deployments in which only an SVSM at VMPL0 may request reports. Unchecked if nil.
+	MaximumVMPL *int
 	// RequireIDBlock if true, will not validate a report if it does not have an ID_KEY_DIGEST that
 	// is trusted through all keys in TrustedIDKeys or TrustedIDKeyHashes, or any ID key whose hash
 	// was signed by a key in TrustedAuthorKeys or TrustedIDKeyHashes. No signatures are checked,
 	// since presence in the attestation report implies that the AMD firmware successfully verified
 	// the signature at VM launch. If false, ID_KEY_DIGEST and AUTHOR_KEY_DIGEST are not checked.
+	// The ID block provides FAMILY_ID and IMAGE_ID, so only with RequireIDBlock does a trusted key
+	// vouch for the values that FamilyID, FamilyIDs, ImageID, and ImageIDs accept.
 	RequireIDBlock bool
 	// Certificates of keys that are permitted to sign ID keys. Any ID key signed by a trusted author
 	// key is implicitly trusted. Not required if TrustedAuthorKeyHashes is provided.
@@ -97,6 +161,189 @@ type Options struct {
 	// CertTableOptions allows the caller to specify extra validation conditions on non-standard
 	// UUID entries in the certificate table returned by GetExtendedReport.
 	CertTableOptions map[string]*CertEntryOption
+	// CustomChecks are caller-defined checks that run in order after every built-in check, so that
+	// bespoke requirements are part of the same validation and Result.
+	CustomChecks []*CustomCheck
+	// policyTCBs are the packed minimum TCB values of a Policy without a product. They take
+	// precedence over the minimum TCBs and are decomposed in the TCB layout of the validated
+	// report's product.
+	policyTCBs policyTCBVersions
+}
+
+// policyTCBVersions are packed minimum TCB values whose layout is not known yet. Zero values are
+// unset.
+type policyTCBVersions struct {
+	minimum, minLaunch, minCommitted kds.TCBVersion
+}
+
+// TCBField names one of the report's TCB fields.
+type TCBField int
+
+const (
+	// TCBCurrent is CURRENT_TCB.
+	TCBCurrent TCBField = iota
+	// TCBCommitted is COMMITTED_TCB.
+	TCBCommitted
+	// TCBReported is REPORTED_TCB.
+	TCBReported
+	// TCBLaunch is LAUNCH_TCB.
+	TCBLaunch
+)
+
+var tcbFieldNames = map[TCBField]string{
+	TCBCurrent:   "current",
+	TCBCommitted: "committed",
+	TCBReported:  "reported",
+	TCBLaunch:    "launch",
+}
+
+// String returns the name of the field, e.g., "committed".
+func (f TCBField) String() string {
+	if name, ok := tcbFieldNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("TCBField(%d)", int(f))
+}
+
+// TCBRelation requires that the report's Lower TCB field is component-wise at most its Higher
+// TCB field.
+type TCBRelation struct {
+	Lower  TCBField
+	Higher TCBField
+}
+
+// String returns the relation in the form that ParseTCBRelation parses, e.g., "launch<=committed".
+func (r TCBRelation) String() string {
+	return fmt.Sprintf("%v<=%v", r.Lower, r.Higher)
+}
+
+// ParseTCBRelation parses a relation of the form "lower<=higher", where each side is one of
+// current, committed, reported, or launch, e.g., "launch<=committed".
+func ParseTCBRelation(s string) (TCBRelation, error) {
+	parseField := func(name string) (TCBField, error) {
+		for field, fieldName := range tcbFieldNames {
+			if name == fieldName {
+				return field, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown TCB field %q in TCB relation %q. Expect current, committed, reported, or launch", name, s)
+	}
+	sides := strings.Split(s, "<=")
+	if len(sides) != 2 {
+		return TCBRelation{}, fmt.Errorf("TCB relation %q is not of the form \"lower<=higher\"", s)
+	}
+	lower, err := parseField(strings.TrimSpace(sides[0]))
+	if err != nil {
+		return TCBRelation{}, err
+	}
+	higher, err := parseField(strings.TrimSpace(sides[1]))
+	if err != nil {
+		return TCBRelation{}, err
+	}
+	return TCBRelation{Lower: lower, Higher: higher}, nil
+}
+
+// TCBOrdering is a preset of TCBRelations for how the report's LAUNCH_TCB, REPORTED_TCB, and
+// CURRENT_TCB relate.
+type TCBOrdering int
+
+const (
+	// TCBOrderingUnchecked does not relate LAUNCH_TCB, REPORTED_TCB, and CURRENT_TCB.
+	TCBOrderingUnchecked TCBOrdering = iota
+	// TCBOrderingMonotonic requires LAUNCH_TCB <= REPORTED_TCB <= CURRENT_TCB, i.e., the TCB has
+	// not decreased since the guest launched.
+	TCBOrderingMonotonic
+	// TCBOrderingLaunchEqualsReported requires LAUNCH_TCB == REPORTED_TCB <= CURRENT_TCB, i.e., the
+	// report is endorsed at the TCB at which the guest launched.
+	TCBOrderingLaunchEqualsReported
+	// TCBOrderingEqual requires LAUNCH_TCB == REPORTED_TCB == CURRENT_TCB, i.e., the firmware has not
+	// changed since the guest launched.
+	TCBOrderingEqual
+)
+
+var tcbOrderingNames = map[TCBOrdering]string{
+	TCBOrderingUnchecked:            "unchecked",
+	TCBOrderingMonotonic:            "monotonic",
+	TCBOrderingLaunchEqualsReported: "launch_equals_reported",
+	TCBOrderingEqual:                "equal",
+}
+
+// String returns the name of the ordering, e.g., "monotonic".
+func (o TCBOrdering) String() string {
+	if name, ok := tcbOrderingNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("TCBOrdering(%d)", int(o))
+}
+
+// Relations returns the TCBRelations that the ordering stands for, with each equality as a pair of
+// opposite relations, e.g., to append to Options.TCBRelations. Returns nil for
+// TCBOrderingUnchecked and unknown orderings.
+func (o TCBOrdering) Relations() []TCBRelation {
+	launchReported := TCBRelation{Lower: TCBLaunch, Higher: TCBReported}
+	reportedLaunch := TCBRelation{Lower: TCBReported, Higher: TCBLaunch}
+	reportedCurrent := TCBRelation{Lower: TCBReported, Higher: TCBCurrent}
+	currentReported := TCBRelation{Lower: TCBCurrent, Higher: TCBReported}
+	switch o {
+	case TCBOrderingMonotonic:
+		return []TCBRelation{launchReported, reportedCurrent}
+	case TCBOrderingLaunchEqualsReported:
+		return []TCBRelation{launchReported, reportedLaunch, reportedCurrent}
+	case TCBOrderingEqual:
+		return []TCBRelation{launchReported, reportedLaunch, reportedCurrent, currentReported}
+	}
+	return nil
+}
+
+// tcbOrderingFromProto returns the ordering that a policy's tcb_ordering names.
+func tcbOrderingFromProto(ordering cpb.TCBOrdering) (TCBOrdering, error) {
+	switch ordering {
+	case cpb.TCBOrdering_TCB_ORDERING_UNCHECKED:
+		return TCBOrderingUnchecked, nil
+	case cpb.TCBOrdering_TCB_ORDERING_MONOTONIC:
+		return TCBOrderingMonotonic, nil
+	case cpb.TCBOrdering_TCB_ORDERING_LAUNCH_EQUALS_REPORTED:
+		return TCBOrderingLaunchEqualsReported, nil
+	case cpb.TCBOrdering_TCB_ORDERING_EQUAL:
+		return TCBOrderingEqual, nil
+	}
+	return 0, fmt.Errorf("unknown tcb_ordering %v", ordering)
+}
+
+// signingKeyFromProto returns the key that a policy's signing_key names, or nil if it is unchecked.
+func signingKeyFromProto(signingKey cpb.SigningKey) (*abi.ReportSigner, error) {
+	var key abi.ReportSigner
+	switch signingKey {
+	case cpb.SigningKey_SIGNING_KEY_UNCHECKED:
+		return nil, nil
+	case cpb.SigningKey_SIGNING_KEY_VCEK:
+		key = abi.VcekReportSigner
+	case cpb.SigningKey_SIGNING_KEY_VLEK:
+		key = abi.VlekReportSigner
+	default:
+		return nil, fmt.Errorf("unknown signing_key %v", signingKey)
+	}
+	return &key, nil
+}
+
+// CustomCheck is a caller-defined validation of the parsed report and its certificate chain.
+type CustomCheck struct {
+	// Name identifies the check in a Result. Should not be one of the built-in check names.
+	Name CheckName
+	// Validate returns an error if the attestation violates the check.
+	Validate func(attestation *spb.Attestation) error
+}
+
+func (c *CustomCheck) run(attestation *spb.Attestation) error {
+	if c.Validate == nil {
+		return fmt.Errorf("invalid argument: custom check %q missing Validate function", c.Name)
+	}
+	// Keep each of a combined error's violations separate in the Result.
+	var errs error
+	for _, err := range multierr.Errors(c.Validate(attestation)) {
+		errs = multierr.Append(errs, fmt.Errorf("custom check %q failed: %v", c.Name, err))
+	}
+	return errs
 }
 
 // CertEntryKind represents a simple policy kind for cert table entries. If a UUID string key is
@@ -128,8 +375,20 @@ func lengthCheck(name string, length int, value []byte) error {
 	return nil
 }
 
+func allowlistLengthCheck(name string, length int, values [][]byte) error {
+	var errs error
+	for i, value := range values {
+		errs = multierr.Append(errs, lengthCheck(fmt.Sprintf("%s[%d]", name, i), length, value))
+	}
+	return errs
+}
+
 func checkOptionsLengths(opts *Options) error {
 	return multierr.Combine(
+		allowlistLengthCheck("measurements", abi.MeasurementSize, opts.Measurements),
+		allowlistLengthCheck("family_ids", abi.FamilyIDSize, opts.FamilyIDs),
+		allowlistLengthCheck("image_ids", abi.ImageIDSize, opts.ImageIDs),
+		allowlistLengthCheck("chip_ids", abi.ChipIDSize, opts.ChipIDs),
 		lengthCheck("family_id", abi.FamilyIDSize, opts.FamilyID),
 		lengthCheck("image_id", abi.ImageIDSize, opts.ImageID),
 		lengthCheck("report_data", abi.ReportDataSize, opts.ReportData),
@@ -167,7 +426,40 @@ func parseVersion(v string) (uint16, error) {
 	return (uint16(maj) << 8) | uint16(min), nil
 }
 
-// PolicyToOptions returns an Options object that is represented by a Policy message.
+// policyTCBParts returns the minimum TCB components that either the packed TCB value in the
+// product's TCB layout or the per-component message specifies. If the product is unknown, the
+// components are checked against the TCB layout of the message's product, if any.
+func policyTCBParts(name string, packed uint64, parts *spb.TcbParts, product spb.SevProduct_SevProductName) (kds.TCBParts, error) {
+	if parts == nil {
+		return kds.DecomposeTCBVersionForProduct(kds.TCBVersion(packed), product), nil
+	}
+	if packed != 0 {
+		return kds.TCBParts{}, fmt.Errorf("%s and %s_parts are both set. Expect at most one", name, name)
+	}
+	if partsProduct := parts.GetProduct(); partsProduct != spb.SevProduct_SEV_PRODUCT_UNKNOWN {
+		if product != spb.SevProduct_SEV_PRODUCT_UNKNOWN && partsProduct != product {
+			return kds.TCBParts{}, fmt.Errorf("%s_parts are for product %v, not the policy's product %v",
+				name, partsProduct, product)
+		}
+		product = partsProduct
+	}
+	result, err := kds.TCBPartsFromProto(parts)
+	if err != nil {
+		return kds.TCBParts{}, fmt.Errorf("invalid %s_parts: %v", name, err)
+	}
+	// Reject components that the product's TCB layout cannot represent.
+	if product == spb.SevProduct_SEV_PRODUCT_UNKNOWN {
+		return result, nil
+	}
+	if _, err := kds.ComposeTCBPartsForProduct(result, product); err != nil {
+		return kds.TCBParts{}, fmt.Errorf("invalid %s_parts: %v", name, err)
+	}
+	return result, nil
+}
+
+// PolicyToOptions returns an Options object that is represented by a Policy message. If the policy
+// has no product, the Options' minimum TCBs show its packed minimum TCB values in the Milan TCB
+// layout, but validation interprets them in the layout of the product it determines for the report.
 func PolicyToOptions(policy *cpb.Policy) (*Options, error) {
 	guestPolicy, err := abi.ParseSnpPolicy(policy.GetPolicy())
 	if err != nil {
@@ -181,14 +473,42 @@ func PolicyToOptions(policy *cpb.Policy) (*Options, error) {
 		}
 		platformInfo = &platformInfoValue
 	}
-	var vmpl *int
-	if policy.GetVmpl() != nil {
-		vmplUint32 := policy.GetVmpl().GetValue()
+	parsePlatformInfoBits := func(name string, value uint64) (*abi.SnpPlatformInfo, error) {
+		if value == 0 {
+			return nil, nil
+		}
+		info, err := abi.ParseSnpPlatformInfo(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		return &info, nil
+	}
+	requiredPlatformInfo, err := parsePlatformInfoBits("required_platform_info", policy.GetRequiredPlatformInfo())
+	if err != nil {
+		return nil, err
+	}
+	forbiddenPlatformInfo, err := parsePlatformInfoBits("forbidden_platform_info", policy.GetForbiddenPlatformInfo())
+	if err != nil {
+		return nil, err
+	}
+	parseVmpl := func(name string, value *wrapperspb.UInt32Value) (*int, error) {
+		if value == nil {
+			return nil, nil
+		}
+		vmplUint32 := value.GetValue()
 		if vmplUint32 > 3 {
-			return nil, fmt.Errorf("vmpl is %d. Expect 0-3", vmplUint32)
+			return nil, fmt.Errorf("%s is %d. Expect 0-3", name, vmplUint32)
 		}
 		vmplInt := int(vmplUint32)
-		vmpl = &vmplInt
+		return &vmplInt, nil
+	}
+	vmpl, err := parseVmpl("vmpl", policy.GetVmpl())
+	if err != nil {
+		return nil, err
+	}
+	maxVmpl, err := parseVmpl("maximum_vmpl", policy.GetMaximumVmpl())
+	if err != nil {
+		return nil, err
 	}
 	if policy.GetMinimumBuild() > 255 {
 		return nil, fmt.Errorf("minimum_build is %d. Expect 0-255", policy.GetMinimumBuild())
@@ -228,30 +548,96 @@ func PolicyToOptions(policy *cpb.Policy) (*Options, error) {
 	if err != nil {
 		return nil, err
 	}
+	familyIDPatterns, err := parseBytePatterns("family_id_patterns", abi.FamilyIDSize, policy.GetFamilyIdPatterns())
+	if err != nil {
+		return nil, err
+	}
+	imageIDPatterns, err := parseBytePatterns("image_id_patterns", abi.ImageIDSize, policy.GetImageIdPatterns())
+	if err != nil {
+		return nil, err
+	}
+	hostDataPatterns, err := parseBytePatterns("host_data_patterns", abi.HostDataSize, policy.GetHostDataPatterns())
+	if err != nil {
+		return nil, err
+	}
+	productName := policy.GetProduct().GetName()
+	minTCB, err := policyTCBParts("minimum_tcb", policy.GetMinimumTcb(), policy.GetMinimumTcbParts(), productName)
+	if err != nil {
+		return nil, err
+	}
+	minLaunchTCB, err := policyTCBParts("minimum_launch_tcb", policy.GetMinimumLaunchTcb(),
+		policy.GetMinimumLaunchTcbParts(), productName)
+	if err != nil {
+		return nil, err
+	}
+	minCommittedTCB, err := policyTCBParts("minimum_committed_tcb", policy.GetMinimumCommittedTcb(),
+		policy.GetMinimumCommittedTcbParts(), productName)
+	if err != nil {
+		return nil, err
+	}
+	var tcbRelations []TCBRelation
+	for _, s := range policy.GetTcbRelations() {
+		relation, err := ParseTCBRelation(s)
+		if err != nil {
+			return nil, err
+		}
+		tcbRelations = append(tcbRelations, relation)
+	}
+	tcbOrdering, err := tcbOrderingFromProto(policy.GetTcbOrdering())
+	if err != nil {
+		return nil, err
+	}
+	tcbRelations = append(tcbRelations, tcbOrdering.Relations()...)
+	signingKey, err := signingKeyFromProto(policy.GetSigningKey())
+	if err != nil {
+		return nil, err
+	}
 	opts := &Options{
 		MinimumGuestSvn:           policy.GetMinimumGuestSvn(),
 		GuestPolicy:               guestPolicy,
 		FamilyID:                  policy.GetFamilyId(),
 		ImageID:                   policy.GetImageId(),
+		FamilyIDs:                 policy.GetFamilyIds(),
+		ImageIDs:                  policy.GetImageIds(),
+		FamilyIDPatterns:          familyIDPatterns,
+		ImageIDPatterns:           imageIDPatterns,
+		HostDataPatterns:          hostDataPatterns,
 		ReportID:                  policy.GetReportId(),
 		ReportIDMA:                policy.GetReportIdMa(),
 		ChipID:                    policy.GetChipId(),
+		ChipIDs:                   policy.GetChipIds(),
+		SigningKey:                signingKey,
 		Measurement:               policy.GetMeasurement(),
+		Measurements:              policy.GetMeasurements(),
 		HostData:                  policy.GetHostData(),
 		ReportData:                policy.GetReportData(),
 		PlatformInfo:              platformInfo,
-		MinimumTCB:                kds.DecomposeTCBVersion(kds.TCBVersion(policy.GetMinimumTcb())),
-		MinimumLaunchTCB:          kds.DecomposeTCBVersion(kds.TCBVersion(policy.GetMinimumLaunchTcb())),
+		RequiredPlatformInfo:      requiredPlatformInfo,
+		ForbiddenPlatformInfo:     forbiddenPlatformInfo,
+		MinimumTCB:                minTCB,
+		MinimumLaunchTCB:          minLaunchTCB,
+		MinimumCommittedTCB:       minCommittedTCB,
+		TCBRelations:              tcbRelations,
+		Product:                   policy.GetProduct(),
 		MinimumBuild:              uint8(policy.GetMinimumBuild()),
 		MinimumVersion:            minVersion,
 		RequireAuthorKey:          policy.GetRequireAuthorKey(),
 		RequireIDBlock:            policy.GetRequireIdBlock(),
 		PermitProvisionalFirmware: policy.GetPermitProvisionalFirmware(),
+		RequireConsistentSMT:      policy.GetRequireConsistentSmt(),
 		TrustedAuthorKeys:         authorKeys,
 		TrustedAuthorKeyHashes:    policy.GetTrustedAuthorKeyHashes(),
 		TrustedIDKeys:             idKeys,
 		TrustedIDKeyHashes:        policy.GetTrustedIdKeyHashes(),
 		VMPL:                      vmpl,
+		MaximumVMPL:               maxVmpl,
+	}
+	if productName == spb.SevProduct_SEV_PRODUCT_UNKNOWN {
+		opts.policyTCBs = policyTCBVersions{
+			minimum:      kds.TCBVersion(policy.GetMinimumTcb()),
+			minLaunch:    kds.TCBVersion(policy.GetMinimumLaunchTcb()),
+			minCommitted: kds.TCBVersion(policy.GetMinimumCommittedTcb()),
+		}
 	}
 	if err := checkOptionsLengths(opts); err != nil {
 		return nil, err
@@ -280,34 +666,71 @@ func validatePolicy(reportPolicy uint64, required abi.SnpPolicy) error {
 			"required policy ABI version (%d.%d) is greater than the report's ABI version (%d.%d)",
 			required.ABIMajor, required.ABIMinor, policy.ABIMajor, policy.ABIMinor)
 	}
-	if !required.MigrateMA && policy.MigrateMA {
-		return errors.New("found unauthorized migration agent capability")
-	}
-	if !required.Debug && policy.Debug {
-		return errors.New("found unauthorized debug capability")
-	}
-	if !required.SMT && policy.SMT {
-		return errors.New("found unauthorized symmetric multithreading (SMT) capability")
-	}
-	if required.SingleSocket && !policy.SingleSocket {
-		return errors.New("required single socket restriction not present")
-	}
-	if !required.CXLAllowed && policy.CXLAllowed {
-		return errors.New("found unauthorized CXL capability")
+	var errs error
+	for _, b := range guestPolicyBits {
+		got, want := b.has(policy), b.has(required)
+		if b.restricts && want && !got {
+			errs = multierr.Append(errs, fmt.Errorf("%s: POLICY bit %d (%s) is 0 in the report, but the validation policy requires 1",
+				b.violation, b.bit, b.name))
+		}
+		if !b.restricts && got && !want {
+			errs = multierr.Append(errs, fmt.Errorf("%s: POLICY bit %d (%s) is 1 in the report, but the validation policy requires 0",
+				b.violation, b.bit, b.name))
+		}
 	}
-	if required.MemAES256XTS && !policy.MemAES256XTS {
-		return errors.New("found unauthorized memory encryption mode")
+	return errs
+}
+
+// guestPolicyBits describes each boolean guest POLICY bit for validatePolicy failures. A bit that
+// restricts the guest must be set in the report if the validation policy sets it. Any other bit
+// grants the guest or host a capability, and may only be set in the report if the validation
+// policy also sets it.
+var guestPolicyBits = []struct {
+	bit       int
+	name      string
+	restricts bool
+	violation string
+	has       func(abi.SnpPolicy) bool
+}{
+	{16, "SMT", false, "found unauthorized symmetric multithreading (SMT) capability",
+		func(p abi.SnpPolicy) bool { return p.SMT }},
+	{18, "MIGRATE_MA", false, "found unauthorized migration agent capability",
+		func(p abi.SnpPolicy) bool { return p.MigrateMA }},
+	{19, "DEBUG", false, "found unauthorized debug capability",
+		func(p abi.SnpPolicy) bool { return p.Debug }},
+	{20, "SINGLE_SOCKET", true, "required single socket restriction not present",
+		func(p abi.SnpPolicy) bool { return p.SingleSocket }},
+	{21, "CXL_ALLOW", false, "found unauthorized CXL capability",
+		func(p abi.SnpPolicy) bool { return p.CXLAllowed }},
+	{22, "MEM_AES_256_XTS", true, "found unauthorized memory encryption mode",
+		func(p abi.SnpPolicy) bool { return p.MemAES256XTS }},
+	{23, "RAPL_DIS", true, "found unauthorized RAPL capability",
+		func(p abi.SnpPolicy) bool { return p.RAPLDis }},
+	{24, "CIPHERTEXT_HIDING_DRAM", true, "ciphertext hiding in DRAM isn't enforced",
+		func(p abi.SnpPolicy) bool { return p.CipherTextHidingDRAM }},
+	{25, "PAGE_SWAP_DISABLE", true, "found unauthorized page swap capability",
+		func(p abi.SnpPolicy) bool { return p.PageSwapDisable }},
+}
+
+// validateSMTConsistency returns an error if required and the report's PLATFORM_INFO has SMT enabled while its
+// guest POLICY does not permit SMT. The firmware refuses to launch such a guest, so no genuine
+// report has both.
+func validateSMTConsistency(reportPolicy, platformInfo uint64, required bool) error {
+	if !required {
+		return nil
 	}
-	if required.RAPLDis && !policy.RAPLDis {
-		return errors.New("found unauthorized RAPL capability")
+	policy, err := abi.ParseSnpPolicy(reportPolicy)
+	if err != nil {
+		return fmt.Errorf("could not parse SNP policy: %v", err)
 	}
-	if required.CipherTextHidingDRAM && !policy.CipherTextHidingDRAM {
-		return errors.New("chiphertext hiding in DRAM isn't enforced")
+	info, err := abi.ParseSnpPlatformInfo(platformInfo)
+	if err != nil {
+		return fmt.Errorf("could not parse SNP platform info %x: %v", platformInfo, err)
 	}
-	if required.PageSwapDisable && !policy.PageSwapDisable {
-		return errors.New("found unauthorized page swap capability")
+	if info.SMTEnabled && !policy.SMT {
+		return fmt.Errorf("PLATFORM_INFO 0x%x has SMT enabled, but POLICY 0x%x does not permit SMT (bit 16)",
+			platformInfo, reportPolicy)
 	}
-
 	return nil
 }
 
@@ -318,15 +741,69 @@ func validateByteField(option, field string, size int, given, required []byte) e
 	if len(required) != size {
 		return fmt.Errorf("option %s must be nil or %d bytes", option, size)
 	}
-	if !bytes.Equal(required, given) {
+	equal, err := abi.FieldEqual("report field "+field, size, given, required)
+	if err != nil {
+		return err
+	}
+	if !equal {
 		return fmt.Errorf("report field %s is %s. Expect %s",
 			field, hex.EncodeToString(given), hex.EncodeToString(required))
 	}
 	return nil
 }
 
+// validateByteAllowlist returns an error if the report field is not among the non-empty
+// allowlist.
+func validateByteAllowlist(option, field string, size int, given []byte, allowed [][]byte) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	var hexes []string
+	for _, value := range allowed {
+		if len(value) != size {
+			return fmt.Errorf("option %s entries must be %d bytes", option, size)
+		}
+		if bytes.Equal(given, value) {
+			return nil
+		}
+		hexes = append(hexes, hex.EncodeToString(value))
+	}
+	return fmt.Errorf("report field %s is %s. Expect one of [%s]",
+		field, hex.EncodeToString(given), strings.Join(hexes, ", "))
+}
+
+func validateMeasurementManifest(given []byte, manifest *measure.Manifest) error {
+	if manifest == nil {
+		return nil
+	}
+	if explanation := manifest.Explain(given); explanation != "" {
+		return fmt.Errorf("report field MEASUREMENT does not match the launch inputs:\n%s", explanation)
+	}
+	return nil
+}
+
+func validateMeasurementSpec(given []byte, spec *measure.Spec) error {
+	if spec == nil {
+		return nil
+	}
+	manifest, err := spec.Manifest()
+	if err != nil {
+		return fmt.Errorf("could not compute MEASUREMENT from option MeasurementSpec: %v", err)
+	}
+	return validateMeasurementManifest(given, manifest)
+}
+
 func validateVerbatimFields(report *spb.Report, options *Options) error {
 	return multierr.Combine(
+		validateMeasurementSpec(report.GetMeasurement(), options.MeasurementSpec),
+		validateMeasurementManifest(report.GetMeasurement(), options.MeasurementManifest),
+		validateByteAllowlist("Measurements", "MEASUREMENT", abi.MeasurementSize, report.GetMeasurement(), options.Measurements),
+		validateByteAllowlist("FamilyIDs", "FAMILY_ID", abi.FamilyIDSize, report.GetFamilyId(), options.FamilyIDs),
+		validateByteAllowlist("ImageIDs", "IMAGE_ID", abi.ImageIDSize, report.GetImageId(), options.ImageIDs),
+		validateByteAllowlist("ChipIDs", "CHIP_ID", abi.ChipIDSize, report.GetChipId(), options.ChipIDs),
+		validateBytePatterns("FamilyIDPatterns", "FAMILY_ID", abi.FamilyIDSize, report.GetFamilyId(), options.FamilyIDPatterns),
+		validateBytePatterns("ImageIDPatterns", "IMAGE_ID", abi.ImageIDSize, report.GetImageId(), options.ImageIDPatterns),
+		validateBytePatterns("HostDataPatterns", "HOST_DATA", abi.HostDataSize, report.GetHostData(), options.HostDataPatterns),
 		validateByteField("ReportData", "REPORT_DATA", abi.ReportDataSize, report.GetReportData(), options.ReportData),
 		validateByteField("HostData", "HOST_DATA", abi.HostDataSize, report.GetHostData(), options.HostData),
 		validateByteField("FamilyID", "FAMILY_ID", abi.FamilyIDSize, report.GetFamilyId(), options.FamilyID),
@@ -363,26 +840,29 @@ type reportTcbDescriptions struct {
 	cert partDescription
 }
 
-func getReportTcbs(report *spb.Report, certTcb kds.TCBVersion) *reportTcbDescriptions {
+func getReportTcbs(report *spb.Report, certTcb kds.TCBVersion, product spb.SevProduct_SevProductName) *reportTcbDescriptions {
+	decompose := func(tcb uint64) kds.TCBParts {
+		return kds.DecomposeTCBVersionForProduct(kds.TCBVersion(tcb), product)
+	}
 	return &reportTcbDescriptions{
 		reported: partDescription{
-			parts: kds.DecomposeTCBVersion(kds.TCBVersion(report.GetReportedTcb())),
+			parts: decompose(report.GetReportedTcb()),
 			desc:  "report's REPORTED_TCB",
 		},
 		current: partDescription{
-			parts: kds.DecomposeTCBVersion(kds.TCBVersion(report.GetCurrentTcb())),
+			parts: decompose(report.GetCurrentTcb()),
 			desc:  "report's CURRENT_TCB",
 		},
 		committed: partDescription{
-			parts: kds.DecomposeTCBVersion(kds.TCBVersion(report.GetCommittedTcb())),
+			parts: decompose(report.GetCommittedTcb()),
 			desc:  "report's COMMITTED_TCB",
 		},
 		launch: partDescription{
-			parts: kds.DecomposeTCBVersion(kds.TCBVersion(report.GetLaunchTcb())),
+			parts: decompose(report.GetLaunchTcb()),
 			desc:  "report's LAUNCH_TCB",
 		},
 		cert: partDescription{
-			parts: kds.DecomposeTCBVersion(certTcb),
+			parts: decompose(uint64(certTcb)),
 			desc:  "TCB of the V[CL]EK certificate",
 		},
 	}
@@ -394,28 +874,40 @@ type policyTcbDescriptions struct {
 	minimum partDescription
 	// The validator policy's sp
 	minLaunch partDescription
+	// The validator policy's specified minimum committed TCB
+	minCommitted partDescription
 }
 
-func getPolicyTcbs(options *Options) *policyTcbDescriptions {
+func getPolicyTcbs(options *Options, product spb.SevProduct_SevProductName) *policyTcbDescriptions {
+	parts := func(parts kds.TCBParts, packed kds.TCBVersion) kds.TCBParts {
+		if packed != 0 {
+			return kds.DecomposeTCBVersionForProduct(packed, product)
+		}
+		return parts
+	}
 	return &policyTcbDescriptions{
 		minimum: partDescription{
-			parts: options.MinimumTCB,
+			parts: parts(options.MinimumTCB, options.policyTCBs.minimum),
 			desc:  "policy minimum TCB",
 		},
 		minLaunch: partDescription{
-			parts: options.MinimumLaunchTCB,
+			parts: parts(options.MinimumLaunchTCB, options.policyTCBs.minLaunch),
 			desc:  "policy minimum launch TCB",
 		},
+		minCommitted: partDescription{
+			parts: parts(options.MinimumCommittedTCB, options.policyTCBs.minCommitted),
+			desc:  "policy minimum committed TCB",
+		},
 	}
 }
 
 // tcbNeError return an error if the two TCBs are not equal
-func tcbNeError(left, right partDescription) error {
-	ltcb, _ := kds.ComposeTCBParts(left.parts)
-	rtcb, _ := kds.ComposeTCBParts(right.parts)
-	if ltcb == rtcb {
+func tcbNeError(left, right partDescription, product spb.SevProduct_SevProductName) error {
+	if left.parts == right.parts {
 		return nil
 	}
+	ltcb, _ := kds.ComposeTCBPartsForProduct(left.parts, product)
+	rtcb, _ := kds.ComposeTCBPartsForProduct(right.parts, product)
 	return fmt.Errorf("the %s 0x%x does not match the %s 0x%x", left.desc, ltcb, right.desc, rtcb)
 }
 
@@ -429,29 +921,87 @@ func tcbGtError(wantLower, wantHigher partDescription) error {
 		wantHigher.desc, wantHigher.parts, wantLower.desc, wantLower.parts)
 }
 
+// tcbComponents are the TCB components in the order that error messages list them.
+var tcbComponents = []struct {
+	name string
+	get  func(kds.TCBParts) uint8
+}{
+	{"fmc_spl", func(p kds.TCBParts) uint8 { return p.FmcSpl }},
+	{"bl_spl", func(p kds.TCBParts) uint8 { return p.BlSpl }},
+	{"tee_spl", func(p kds.TCBParts) uint8 { return p.TeeSpl }},
+	{"spl4", func(p kds.TCBParts) uint8 { return p.Spl4 }},
+	{"spl5", func(p kds.TCBParts) uint8 { return p.Spl5 }},
+	{"spl6", func(p kds.TCBParts) uint8 { return p.Spl6 }},
+	{"spl7", func(p kds.TCBParts) uint8 { return p.Spl7 }},
+	{"snp_spl", func(p kds.TCBParts) uint8 { return p.SnpSpl }},
+	{"ucode_spl", func(p kds.TCBParts) uint8 { return p.UcodeSpl }},
+}
+
+// tcbRelationError returns an error if lower is above higher in any component. The error names each
+// offending component of the product's TCB layout.
+func tcbRelationError(relation TCBRelation, lower, higher partDescription, product spb.SevProduct_SevProductName) error {
+	var diffs []string
+	for _, c := range tcbComponents {
+		if l, h := c.get(lower.parts), c.get(higher.parts); l > h {
+			diffs = append(diffs, fmt.Sprintf("%s %d vs. %d", c.name, l, h))
+		}
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+	ltcb, _ := kds.ComposeTCBPartsForProduct(lower.parts, product)
+	htcb, _ := kds.ComposeTCBPartsForProduct(higher.parts, product)
+	return fmt.Errorf("TCB relation %v requires the %s 0x%x <= the %s 0x%x, but %s TCB components differ: %s",
+		relation, lower.desc, ltcb, higher.desc, htcb,
+		kds.ProductLine(&spb.SevProduct{Name: product}), strings.Join(diffs, ", "))
+}
+
+// validateTcbRelations returns an error if the report's TCB fields do not obey the relations.
+func validateTcbRelations(reportTcbs *reportTcbDescriptions, relations []TCBRelation, product spb.SevProduct_SevProductName) error {
+	fields := map[TCBField]partDescription{
+		TCBCurrent:   reportTcbs.current,
+		TCBCommitted: reportTcbs.committed,
+		TCBReported:  reportTcbs.reported,
+		TCBLaunch:    reportTcbs.launch,
+	}
+	var errs error
+	for _, relation := range relations {
+		lower, lok := fields[relation.Lower]
+		higher, hok := fields[relation.Higher]
+		if !lok || !hok {
+			errs = multierr.Append(errs, fmt.Errorf("invalid argument: TCB relation %v has an unknown TCB field", relation))
+			continue
+		}
+		errs = multierr.Append(errs, tcbRelationError(relation, lower, higher, product))
+	}
+	return errs
+}
+
 // validateTcb returns an error if the TCB values present in the report and V[CL]EK certificate do not
 // obey expected relationships with respect to the given validation policy, or with respect to
 // internal consistency checks.
-func validateTcb(report *spb.Report, certTcb kds.TCBVersion, options *Options) error {
-	reportTcbs := getReportTcbs(report, certTcb)
-	policyTcbs := getPolicyTcbs(options)
+func validateTcb(report *spb.Report, certTcb kds.TCBVersion, product spb.SevProduct_SevProductName, options *Options) error {
+	reportTcbs := getReportTcbs(report, certTcb, product)
+	policyTcbs := getPolicyTcbs(options, product)
 
 	var provisionalErr error
 	if options.PermitProvisionalFirmware {
 		provisionalErr = tcbGtError(reportTcbs.committed, reportTcbs.current)
 	} else {
-		provisionalErr = tcbNeError(reportTcbs.committed, reportTcbs.current)
+		provisionalErr = tcbNeError(reportTcbs.committed, reportTcbs.current, product)
 	}
 
 	return multierr.Combine(provisionalErr,
+		validateTcbRelations(reportTcbs, options.TCBRelations, product),
 		tcbGtError(policyTcbs.minLaunch, reportTcbs.launch),
+		tcbGtError(policyTcbs.minCommitted, reportTcbs.committed),
 		// Any change to the TCB means that the V[CL]EK certificate at an earlier TCB is no
 		// longer valid. The host must make sure that the up-to-date certificate is provisioned
 		// and delivered alongside the report that contains the new reported TCB value.
 		// If the certificate's TCB is greater than the report's TCB, then the host has not
 		// provisioned a certificate for the machine's actual state and should also not be
 		// accepted.
-		tcbNeError(reportTcbs.reported, reportTcbs.cert),
+		tcbNeError(reportTcbs.reported, reportTcbs.cert, product),
 		tcbGtError(reportTcbs.cert, reportTcbs.current),
 		tcbGtError(policyTcbs.minimum, reportTcbs.reported))
 	// Note:
@@ -518,6 +1068,21 @@ func validateVersion(report *spb.Report, options *Options) error {
 	return nil
 }
 
+// chipIDHasHWID returns whether the VCEK certificate's HWID identifies the chip with the report's
+// CHIP_ID. Turin VCEK certificates carry only the first kds.TurinHWIDSize bytes of the CHIP_ID.
+func chipIDHasHWID(chipID, hwid []byte) (bool, error) {
+	if len(hwid) == abi.ChipIDSize {
+		return abi.ChipIDEqual(chipID, hwid)
+	}
+	if len(chipID) != abi.ChipIDSize {
+		return false, fmt.Errorf("CHIP_ID length is %d, expect %d", len(chipID), abi.ChipIDSize)
+	}
+	if len(hwid) == 0 || len(hwid) > abi.ChipIDSize {
+		return false, fmt.Errorf("HWID length is %d, expect at most %d", len(hwid), abi.ChipIDSize)
+	}
+	return bytes.Equal(chipID[:len(hwid)], hwid), nil
+}
+
 func allZero(buf []byte) bool {
 	for _, b := range buf {
 		if b != 0 {
@@ -559,6 +1124,49 @@ func validatePlatformInfo(platformInfo uint64, required *abi.SnpPlatformInfo) er
 	return nil
 }
 
+// platformInfoFeatures names each PLATFORM_INFO bit for RequiredPlatformInfo and
+// ForbiddenPlatformInfo failures.
+var platformInfoFeatures = []struct {
+	name string
+	has  func(info *abi.SnpPlatformInfo) bool
+}{
+	{"SMT enabled", func(info *abi.SnpPlatformInfo) bool { return info.SMTEnabled }},
+	{"TSME enabled", func(info *abi.SnpPlatformInfo) bool { return info.TSMEEnabled }},
+	{"ECC enabled", func(info *abi.SnpPlatformInfo) bool { return info.ECCEnabled }},
+	{"RAPL disabled", func(info *abi.SnpPlatformInfo) bool { return info.RAPLDisabled }},
+	{"ciphertext hiding in DRAM enabled", func(info *abi.SnpPlatformInfo) bool { return info.CiphertextHidingDRAMEnabled }},
+	{"memory alias check complete", func(info *abi.SnpPlatformInfo) bool { return info.AliasCheckComplete }},
+	{"SEV-TIO enabled", func(info *abi.SnpPlatformInfo) bool { return info.TIOEnabled }},
+}
+
+// validatePlatformInfoBits returns an error for every PLATFORM_INFO feature that required has
+// and the report lacks, or that forbidden has and the report has.
+func validatePlatformInfoBits(platformInfo uint64, required, forbidden *abi.SnpPlatformInfo) error {
+	if required == nil && forbidden == nil {
+		return nil
+	}
+	reportInfo, err := abi.ParseSnpPlatformInfo(platformInfo)
+	if err != nil {
+		return fmt.Errorf("could not parse SNP platform info %x: %v", platformInfo, err)
+	}
+	var errs error
+	for _, feature := range platformInfoFeatures {
+		isRequired := required != nil && feature.has(required)
+		isForbidden := forbidden != nil && feature.has(forbidden)
+		switch {
+		case isRequired && isForbidden:
+			errs = multierr.Append(errs, fmt.Errorf("platform feature %q is both required and forbidden", feature.name))
+		case isRequired && !feature.has(&reportInfo):
+			errs = multierr.Append(errs, fmt.Errorf("required platform feature %q missing from PLATFORM_INFO 0x%x",
+				feature.name, platformInfo))
+		case isForbidden && feature.has(&reportInfo):
+			errs = multierr.Append(errs, fmt.Errorf("forbidden platform feature %q present in PLATFORM_INFO 0x%x",
+				feature.name, platformInfo))
+		}
+	}
+	return errs
+}
+
 func addKeyHashesFromCerts(hashes [][]byte, certs []*x509.Certificate) [][]byte {
 	for _, c := range certs {
 		// Only add ECDSA P-384 keys
@@ -577,7 +1185,9 @@ func addKeyHashesFromCerts(hashes [][]byte, certs []*x509.Certificate) [][]byte
 	return hashes
 }
 
-func consolidateKeyHashes(options *Options) error {
+// consolidateKeyHashes returns the trusted ID and author key digests, including those of the
+// trusted keys' certificates.
+func consolidateKeyHashes(options *Options) (idKeyHashes, authorKeyHashes [][]byte, err error) {
 	validateHashes := func(hashes [][]byte, size int) error {
 		for _, hash := range hashes {
 			if len(hash) != size {
@@ -588,22 +1198,23 @@ func consolidateKeyHashes(options *Options) error {
 	}
 
 	if err := validateHashes(options.TrustedIDKeyHashes, abi.IDKeyDigestSize); err != nil {
-		return fmt.Errorf("bad hash size in TrustedIDKeyHashes: %v", err)
+		return nil, nil, fmt.Errorf("bad hash size in TrustedIDKeyHashes: %v", err)
 	}
 
 	if err := validateHashes(options.TrustedAuthorKeyHashes, abi.AuthorKeyDigestSize); err != nil {
-		return fmt.Errorf("bad hash size in TrustedAuthorKeyHashes: %v", err)
+		return nil, nil, fmt.Errorf("bad hash size in TrustedAuthorKeyHashes: %v", err)
 	}
 
-	options.TrustedIDKeyHashes = addKeyHashesFromCerts(options.TrustedIDKeyHashes,
+	// Copy the given hashes so that repeated validations with the same options don't grow them.
+	idKeyHashes = addKeyHashesFromCerts(append([][]byte{}, options.TrustedIDKeyHashes...),
 		options.TrustedIDKeys)
-	options.TrustedAuthorKeyHashes = addKeyHashesFromCerts(options.TrustedAuthorKeyHashes,
+	authorKeyHashes = addKeyHashesFromCerts(append([][]byte{}, options.TrustedAuthorKeyHashes...),
 		options.TrustedAuthorKeys)
-	return nil
+	return idKeyHashes, authorKeyHashes, nil
 }
 
 func validateKeys(report *spb.Report, options *Options) error {
-	info, err := abi.ParseSignerInfo(report.GetSignerInfo())
+	info, err := abi.ProtoSignerInfo(report)
 	if err != nil {
 		return err
 	}
@@ -617,7 +1228,8 @@ func validateKeys(report *spb.Report, options *Options) error {
 		return nil
 	}
 
-	if err := consolidateKeyHashes(options); err != nil {
+	idKeyHashes, authorKeyHashes, err := consolidateKeyHashes(options)
+	if err != nil {
 		return err
 	}
 
@@ -630,8 +1242,7 @@ func validateKeys(report *spb.Report, options *Options) error {
 		return false
 	}
 
-	authorKeyTrusted := info.AuthorKeyEn && bytesContained(options.TrustedAuthorKeyHashes,
-		report.GetAuthorKeyDigest())
+	authorKeyTrusted := info.AuthorKeyEn && bytesContained(authorKeyHashes, report.GetAuthorKeyDigest())
 
 	if options.RequireAuthorKey && !authorKeyTrusted {
 		return fmt.Errorf("report author key not trusted: %v",
@@ -639,7 +1250,7 @@ func validateKeys(report *spb.Report, options *Options) error {
 	}
 
 	// If the author key isn't required, check if the ID key itself is trusted.
-	if !authorKeyTrusted && !bytesContained(options.TrustedIDKeyHashes, report.GetIdKeyDigest()) {
+	if !authorKeyTrusted && !bytesContained(idKeyHashes, report.GetIdKeyDigest()) {
 		return fmt.Errorf("report ID key not trusted: %s", hex.EncodeToString(report.GetIdKeyDigest()))
 	}
 	return nil
@@ -656,7 +1267,7 @@ func validateKeyKind(report *spb.Attestation) (*x509.Certificate, error) {
 		return nil, fmt.Errorf("attestation certificate chain cannot be nil")
 	}
 
-	info, err := abi.ParseSignerInfo(report.GetReport().GetSignerInfo())
+	info, err := abi.ProtoSignerInfo(report.GetReport())
 	if err != nil {
 		return nil, err
 	}
@@ -692,50 +1303,152 @@ func certTableOptions(attestation *spb.Attestation, options map[string]*CertEntr
 	return nil
 }
 
-// SnpAttestation validates fields of the protobuf representation of an attestation report against
-// expectations. Does not check the attestation certificates or signature.
-func SnpAttestation(attestation *spb.Attestation, options *Options) error {
-	endorsementKeyCert, err := validateKeyKind(attestation)
-	if err != nil {
-		return err
+// tcbProduct returns the product whose TCB layout the attestation's report uses.
+func tcbProduct(attestation *spb.Attestation, exts *kds.Extensions, key abi.ReportSigner, options *Options) spb.SevProduct_SevProductName {
+	if name := options.Product.GetName(); name != spb.SevProduct_SEV_PRODUCT_UNKNOWN {
+		return name
 	}
-	report := attestation.GetReport()
-	info, err := abi.ParseSignerInfo(report.GetSignerInfo())
-	if err != nil {
-		return err
+	if name := attestation.GetProduct().GetName(); name != spb.SevProduct_SEV_PRODUCT_UNKNOWN {
+		return name
 	}
-	// Get the TCB values of the V[CL]EK
-	exts, err := kds.CertificateExtensions(endorsementKeyCert, info.SigningKey)
-	if err != nil {
-		return fmt.Errorf("could not get %v certificate extensions: %v", info.SigningKey, err)
+	if fms, ok := abi.ReportCpuid1EaxFms(attestation.GetReport()); ok {
+		if name := abi.SevProductFromCpuid1Eax(fms).GetName(); name != spb.SevProduct_SEV_PRODUCT_UNKNOWN {
+			return name
+		}
+	}
+	if product, err := kds.ParseProductName(exts.ProductName, key); err == nil {
+		return product.GetName()
 	}
+	return spb.SevProduct_SEV_PRODUCT_MILAN
+}
 
+func validateGuestSvn(report *spb.Report, options *Options) error {
 	if report.GetGuestSvn() < options.MinimumGuestSvn {
 		return fmt.Errorf("report's GUEST_SVN %d is less than the required minimum %d",
 			report.GetGuestSvn(), options.MinimumGuestSvn)
 	}
+	return nil
+}
 
-	if err := multierr.Combine(
-		validatePolicy(report.GetPolicy(), options.GuestPolicy),
-		validateVerbatimFields(report, options),
-		validateTcb(report, exts.TCBVersion, options),
-		validateVersion(report, options),
-		validatePlatformInfo(report.GetPlatformInfo(), options.PlatformInfo),
-		validateKeys(report, options)); err != nil {
-		return err
-	}
-
+func validateVmpl(report *spb.Report, options *Options) error {
 	if options.VMPL != nil && uint32(*options.VMPL) != report.GetVmpl() {
 		return fmt.Errorf("report VMPL %d is not %d", report.GetVmpl(), *options.VMPL)
 	}
+	if options.MaximumVMPL != nil && report.GetVmpl() > uint32(*options.MaximumVMPL) {
+		return fmt.Errorf("report VMPL %d is less privileged than the maximum permitted VMPL %d",
+			report.GetVmpl(), *options.MaximumVMPL)
+	}
+	return nil
+}
 
+func validateSigningKey(info abi.SignerInfo, options *Options) error {
+	if options.SigningKey != nil && info.SigningKey != *options.SigningKey {
+		return fmt.Errorf("report is signed by the %v, not the required %v", info.SigningKey, *options.SigningKey)
+	}
+	return nil
+}
+
+func validateChipID(report *spb.Report, info abi.SignerInfo, exts *kds.Extensions) error {
 	// MaskChipId might be 1 for the host, so only check if the the CHIP_ID is not all zeros.
-	if info.SigningKey == abi.VcekReportSigner && !allZero(report.GetChipId()) && !bytes.Equal(report.GetChipId(), exts.HWID[:]) {
-		return fmt.Errorf("report field CHIP_ID %s is not the same as the VCEK certificate's HWID %s",
-			hex.EncodeToString(report.GetChipId()), hex.EncodeToString(exts.HWID[:]))
+	if info.SigningKey == abi.VcekReportSigner && !allZero(report.GetChipId()) {
+		equal, err := chipIDHasHWID(report.GetChipId(), exts.HWID)
+		if err != nil {
+			return err
+		}
+		if !equal {
+			return fmt.Errorf("report field CHIP_ID %s is not the same as the VCEK certificate's HWID %s",
+				hex.EncodeToString(report.GetChipId()), hex.EncodeToString(exts.HWID[:]))
+		}
 	}
+	return nil
+}
+
+// SnpAttestation validates fields of the protobuf representation of an attestation report against
+// expectations. Does not check the attestation certificates or signature.
+func SnpAttestation(attestation *spb.Attestation, options *Options) error {
+	_, err := snpAttestation(attestation, options, false)
+	return err
+}
 
-	return certTableOptions(attestation, options.CertTableOptions)
+// SnpAttestationWithResult behaves like SnpAttestation but evaluates every check, even after one
+// fails, and returns each check's outcome. Only the checks that need the endorsement key
+// certificate's extensions are absent if the certificate cannot be read. The error joins every
+// violation.
+func SnpAttestationWithResult(attestation *spb.Attestation, options *Options) (*Result, error) {
+	return snpAttestation(attestation, options, true)
+}
+
+func snpAttestation(attestation *spb.Attestation, options *Options, collectAll bool) (*Result, error) {
+	res := &Result{}
+	var errs error
+	// stop collects err and returns whether validation ends here.
+	stop := func(err error) bool {
+		errs = multierr.Append(errs, err)
+		return err != nil && !collectAll
+	}
+	endorsementKeyCert, keyErr := validateKeyKind(attestation)
+	report := attestation.GetReport()
+	if report == nil {
+		return res, res.record(CheckEndorsementKey, keyErr)
+	}
+	info, err := abi.ProtoSignerInfo(report)
+	if err != nil {
+		return res, res.record(CheckEndorsementKey, err)
+	}
+	var exts *kds.Extensions
+	if keyErr == nil {
+		// Get the TCB values of the V[CL]EK
+		exts, err = kds.CertificateExtensions(endorsementKeyCert, info.SigningKey)
+		if err != nil {
+			keyErr = fmt.Errorf("could not get %v certificate extensions: %v", info.SigningKey, err)
+		}
+	}
+	keyErr = multierr.Append(keyErr, validateSigningKey(info, options))
+	if stop(res.record(CheckEndorsementKey, keyErr)) {
+		return res, errs
+	}
+
+	if stop(res.record(CheckGuestSvn, validateGuestSvn(report, options))) {
+		return res, errs
+	}
+
+	// These checks all run before validation stops, so that their errors are combined.
+	groupErr := multierr.Combine(
+		res.record(CheckGuestPolicy, validatePolicy(report.GetPolicy(), options.GuestPolicy)),
+		res.record(CheckFields, validateVerbatimFields(report, options)),
+		res.record(CheckFreshness, validateFreshness(report.GetReportData(), options.Freshness)))
+	if exts != nil {
+		groupErr = multierr.Append(groupErr, res.record(CheckTCB,
+			validateTcb(report, exts.TCBVersion, tcbProduct(attestation, exts, info.SigningKey, options), options)))
+	}
+	groupErr = multierr.Combine(groupErr,
+		res.record(CheckVersion, validateVersion(report, options)),
+		res.record(CheckPlatformInfo, multierr.Combine(
+			validateSMTConsistency(report.GetPolicy(), report.GetPlatformInfo(), options.RequireConsistentSMT),
+			validatePlatformInfo(report.GetPlatformInfo(), options.PlatformInfo),
+			validatePlatformInfoBits(report.GetPlatformInfo(), options.RequiredPlatformInfo, options.ForbiddenPlatformInfo))),
+		res.record(CheckKeys, validateKeys(report, options)))
+	if stop(groupErr) {
+		return res, errs
+	}
+
+	if stop(res.record(CheckVMPL, validateVmpl(report, options))) {
+		return res, errs
+	}
+	if exts != nil {
+		if stop(res.record(CheckChipID, validateChipID(report, info, exts))) {
+			return res, errs
+		}
+	}
+	if stop(res.record(CheckCertTable, certTableOptions(attestation, options.CertTableOptions))) {
+		return res, errs
+	}
+	for _, check := range options.CustomChecks {
+		if stop(res.record(check.Name, check.run(attestation))) {
+			return res, errs
+		}
+	}
+	return res, errs
 }
 
 // RawSnpAttestation validates fields of a raw attestation report against expectations. Does not
@@ -17,10 +17,16 @@ package validate
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	_ "embed"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -29,11 +35,14 @@ import (
 	sg "github.com/google/go-sev-guest/client"
 	labi "github.com/google/go-sev-guest/client/linuxabi"
 	"github.com/google/go-sev-guest/kds"
+	"github.com/google/go-sev-guest/measure"
 	test "github.com/google/go-sev-guest/testing"
 	"github.com/google/go-sev-guest/verify"
 	"go.uber.org/multierr"
 	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
 
+	cpb "github.com/google/go-sev-guest/proto/check"
 	spb "github.com/google/go-sev-guest/proto/sevsnp"
 )
 
@@ -329,7 +338,7 @@ func TestValidateSnpAttestation(t *testing.T) {
 				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
 				MinimumTCB:   kds.TCBParts{UcodeSpl: 0xff, SnpSpl: 0x05, BlSpl: 0x02},
 			},
-			wantErr: "the report's REPORTED_TCB {BlSpl:31 TeeSpl:127 Spl4:0 Spl5:0 Spl6:0 Spl7:0 SnpSpl:112 UcodeSpl:146} is lower than the policy minimum TCB {BlSpl:2 TeeSpl:0 Spl4:0 Spl5:0 Spl6:0 Spl7:0 SnpSpl:5 UcodeSpl:255} in at least one component",
+			wantErr: "the report's REPORTED_TCB {BlSpl:31 TeeSpl:127 Spl4:0 Spl5:0 Spl6:0 Spl7:0 SnpSpl:112 UcodeSpl:146 FmcSpl:0} is lower than the policy minimum TCB {BlSpl:2 TeeSpl:0 Spl4:0 Spl5:0 Spl6:0 Spl7:0 SnpSpl:5 UcodeSpl:255 FmcSpl:0} in at least one component",
 		},
 		{
 			name:        "Minimum build checked",
@@ -475,6 +484,144 @@ func TestValidateSnpAttestation(t *testing.T) {
 			wantErr:     fmt.Sprintf("report field %s", name),
 		})
 	}
+	otherMeasurement := make([]byte, abi.MeasurementSize)
+	vmpl2Attestation := proto.Clone(attestation12345).(*spb.Attestation)
+	vmpl2Attestation.Report.Vmpl = 2
+	vmpl1, vmpl2 := 1, 2
+	vcekSigner, vlekSigner := abi.VcekReportSigner, abi.VlekReportSigner
+	tests = append(tests,
+		testCase{
+			name:        "Measurement in allowlist",
+			attestation: attestation12345,
+			opts: &Options{
+				GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+				Measurements: [][]byte{otherMeasurement, measurement},
+			},
+		},
+		testCase{
+			name:        "Measurement not in allowlist",
+			attestation: attestation12345,
+			opts: &Options{
+				GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+				Measurements: [][]byte{otherMeasurement},
+			},
+			wantErr: "report field MEASUREMENT is " + hex.EncodeToString(measurement) + ". Expect one of [" +
+				hex.EncodeToString(otherMeasurement) + "]",
+		},
+		testCase{
+			name:        "VMPL at maximum",
+			attestation: vmpl2Attestation,
+			opts: &Options{
+				GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+				MaximumVMPL:  &vmpl2,
+			},
+		},
+		testCase{
+			name:        "VMPL above maximum",
+			attestation: vmpl2Attestation,
+			opts: &Options{
+				GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+				MaximumVMPL:  &vmpl1,
+			},
+			wantErr: "report VMPL 2 is less privileged than the maximum permitted VMPL 1",
+		},
+		testCase{
+			name:        "ID block identities in allowlists",
+			attestation: attestation12345,
+			opts: &Options{
+				GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+				FamilyIDs:    [][]byte{make([]byte, abi.FamilyIDSize), familyID},
+				ImageIDs:     [][]byte{imageID},
+			},
+		},
+		testCase{
+			name:        "IMAGE_ID not in allowlist",
+			attestation: attestation12345,
+			opts: &Options{
+				GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+				ImageIDs:     [][]byte{familyID},
+			},
+			wantErr: "report field IMAGE_ID is " + hex.EncodeToString(imageID) + ". Expect one of [" +
+				hex.EncodeToString(familyID) + "]",
+		},
+		testCase{
+			name:        "CHIP_ID in allowlist",
+			attestation: attestation12345,
+			opts: &Options{
+				GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+				ChipIDs:      [][]byte{make([]byte, abi.ChipIDSize), chipID[:]},
+			},
+		},
+		testCase{
+			name:        "CHIP_ID not in allowlist",
+			attestation: attestation12345,
+			opts: &Options{
+				GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+				ChipIDs:      [][]byte{make([]byte, abi.ChipIDSize)},
+			},
+			wantErr: "report field CHIP_ID is " + hex.EncodeToString(chipID[:]) + ". Expect one of [" +
+				hex.EncodeToString(make([]byte, abi.ChipIDSize)) + "]",
+		},
+		testCase{
+			name:        "Required signing key",
+			attestation: attestation12345,
+			opts: &Options{
+				GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+				SigningKey:   &vcekSigner,
+			},
+		},
+		testCase{
+			name:        "Wrong signing key",
+			attestation: attestation12345,
+			opts: &Options{
+				GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+				SigningKey:   &vlekSigner,
+			},
+			wantErr: "report is signed by the VCEK, not the required VLEK",
+		},
+		testCase{
+			name:        "Measurement matches manifest",
+			attestation: attestation12345,
+			opts: &Options{
+				GuestPolicy:         abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo:        &abi.SnpPlatformInfo{SMTEnabled: true},
+				MeasurementManifest: &measure.Manifest{LaunchDigest: measurement},
+			},
+		},
+		testCase{
+			name:        "Measurement does not match manifest",
+			attestation: attestation12345,
+			opts: &Options{
+				GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+				MeasurementManifest: &measure.Manifest{
+					LaunchDigest: otherMeasurement,
+					Inputs:       map[string]string{"cmdline": `"console=ttyS0"`},
+				},
+			},
+			wantErr: "- MEASUREMENT " + hex.EncodeToString(otherMeasurement) + " (expected)\n+ MEASUREMENT " +
+				hex.EncodeToString(measurement) + " (reported)\n  cmdline: \"console=ttyS0\"",
+		},
+		testCase{
+			name:        "Measurement spec without vCPUs",
+			attestation: attestation12345,
+			opts: &Options{
+				GuestPolicy:     abi.SnpPolicy{Debug: true, SMT: true},
+				PlatformInfo:    &abi.SnpPlatformInfo{SMTEnabled: true},
+				MeasurementSpec: &measure.Spec{},
+			},
+			wantErr: "could not compute MEASUREMENT from option MeasurementSpec",
+		})
 
 	for _, tc := range tests {
 		if err := SnpAttestation(tc.attestation, tc.opts); (err == nil && tc.wantErr != "") ||
@@ -482,6 +629,38 @@ func TestValidateSnpAttestation(t *testing.T) {
 			t.Errorf("%s: SnpAttestation(%v) errored unexpectedly. Got '%v', want '%s'", tc.name, tc.attestation, err, tc.wantErr)
 		}
 	}
+
+	// Each of these options violates the policy, but SnpAttestation stops at the GUEST_SVN.
+	vmpl3 := 3
+	violating := &Options{
+		MinimumGuestSvn: 1 << 31,
+		GuestPolicy:     abi.SnpPolicy{Debug: true, SMT: true},
+		PlatformInfo:    &abi.SnpPlatformInfo{SMTEnabled: true},
+		Measurement:     otherMeasurement,
+		HostData:        make([]byte, abi.HostDataSize),
+		VMPL:            &vmpl3,
+	}
+	if err := SnpAttestation(attestation12345, violating); !test.Match(err, "GUEST_SVN") || test.Match(err, "MEASUREMENT") {
+		t.Errorf("SnpAttestation() = %v. Want only a GUEST_SVN error", err)
+	}
+	res, err := SnpAttestationWithResult(attestation12345, violating)
+	for _, want := range []string{"GUEST_SVN", "MEASUREMENT", "HOST_DATA", "VMPL"} {
+		if !test.Match(err, want) {
+			t.Errorf("SnpAttestationWithResult() = _, %v. Want a %s error", err, want)
+		}
+	}
+	if res.Passed() {
+		t.Error("SnpAttestationWithResult().Passed() = true, want false")
+	}
+	if got := len(res.Violations()); got != 4 {
+		t.Errorf("SnpAttestationWithResult().Violations() = %v, want 4 violations", res.Violations())
+	}
+	if c := res.Check(CheckFields); c == nil || c.Passed || len(c.Violations) != 2 {
+		t.Errorf("SnpAttestationWithResult().Check(%q) = %+v, want 2 violations", CheckFields, c)
+	}
+	if c := res.Check(CheckTCB); c == nil || !c.Passed {
+		t.Errorf("SnpAttestationWithResult().Check(%q) = %+v, want passed", CheckTCB, c)
+	}
 }
 
 func TestCertTableOptions(t *testing.T) {
@@ -538,3 +717,654 @@ func TestCertTableOptions(t *testing.T) {
 	}
 
 }
+
+func TestChipIDHasHWID(t *testing.T) {
+	chipID := make([]byte, abi.ChipIDSize)
+	copy(chipID, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	other := make([]byte, abi.ChipIDSize)
+	tcs := []struct {
+		name    string
+		hwid    []byte
+		want    bool
+		wantErr string
+	}{
+		{name: "full size", hwid: chipID, want: true},
+		{name: "full size mismatch", hwid: other},
+		{name: "Turin size", hwid: chipID[:8], want: true},
+		{name: "Turin size mismatch", hwid: other[:8]},
+		{name: "empty", hwid: []byte{}, wantErr: "HWID length is 0"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := chipIDHasHWID(chipID, tc.hwid)
+			if !test.Match(err, tc.wantErr) {
+				t.Fatalf("chipIDHasHWID() = _, %v. Want error %q", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("chipIDHasHWID() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConsolidateKeyHashesKeepsOptions(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &Options{
+		TrustedIDKeys:      []*x509.Certificate{{PublicKey: &key.PublicKey}},
+		TrustedIDKeyHashes: [][]byte{make([]byte, abi.IDKeyDigestSize)},
+	}
+	for i := 0; i < 2; i++ {
+		idKeyHashes, authorKeyHashes, err := consolidateKeyHashes(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(idKeyHashes) != 2 || len(authorKeyHashes) != 0 {
+			t.Errorf("consolidateKeyHashes() = %d ID key and %d author key hashes, want 2 and 0",
+				len(idKeyHashes), len(authorKeyHashes))
+		}
+	}
+	if len(opts.TrustedIDKeyHashes) != 1 {
+		t.Errorf("consolidateKeyHashes() changed TrustedIDKeyHashes to %d hashes, want 1", len(opts.TrustedIDKeyHashes))
+	}
+}
+
+func TestPolicyTCBParts(t *testing.T) {
+	turin := &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_TURIN}
+	tcs := []struct {
+		name       string
+		policy     *cpb.Policy
+		wantMinTCB kds.TCBParts
+		wantErr    string
+	}{
+		{
+			name:       "packed Milan",
+			policy:     &cpb.Policy{MinimumTcb: 0x4405000000000002},
+			wantMinTCB: kds.TCBParts{UcodeSpl: 0x44, SnpSpl: 0x05, BlSpl: 0x02},
+		},
+		{
+			name:       "packed Turin",
+			policy:     &cpb.Policy{MinimumTcb: 0x4400000016000301, Product: turin},
+			wantMinTCB: kds.TCBParts{UcodeSpl: 0x44, SnpSpl: 0x16, BlSpl: 0x03, FmcSpl: 0x01},
+		},
+		{
+			name: "parts",
+			policy: &cpb.Policy{
+				MinimumTcbParts: &spb.TcbParts{BlSpl: 3, SnpSpl: 22, UcodeSpl: 68, FmcSpl: 1},
+				Product:         turin,
+			},
+			wantMinTCB: kds.TCBParts{UcodeSpl: 0x44, SnpSpl: 0x16, BlSpl: 0x03, FmcSpl: 0x01},
+		},
+		{
+			name: "both",
+			policy: &cpb.Policy{
+				MinimumTcb:      1,
+				MinimumTcbParts: &spb.TcbParts{BlSpl: 3},
+			},
+			wantErr: "minimum_tcb and minimum_tcb_parts are both set",
+		},
+		{
+			name:    "component too large",
+			policy:  &cpb.Policy{MinimumTcbParts: &spb.TcbParts{UcodeSpl: 256}},
+			wantErr: "invalid minimum_tcb_parts: UcodeSpl TCB part is 256",
+		},
+		{
+			name: "FMC on Milan",
+			policy: &cpb.Policy{
+				MinimumLaunchTcbParts: &spb.TcbParts{FmcSpl: 1},
+				Product:               &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_MILAN},
+			},
+			wantErr: "invalid minimum_launch_tcb_parts",
+		},
+		{
+			name: "parts for another product",
+			policy: &cpb.Policy{
+				MinimumTcbParts: &spb.TcbParts{Product: spb.SevProduct_SEV_PRODUCT_MILAN, BlSpl: 3},
+				Product:         turin,
+			},
+			wantErr: "minimum_tcb_parts are for product SEV_PRODUCT_MILAN",
+		},
+		{
+			name:    "FMC on parts' product",
+			policy:  &cpb.Policy{MinimumTcbParts: &spb.TcbParts{Product: spb.SevProduct_SEV_PRODUCT_GENOA, FmcSpl: 1}},
+			wantErr: "invalid minimum_tcb_parts",
+		},
+		{
+			name:   "FMC without product",
+			policy: &cpb.Policy{MinimumLaunchTcbParts: &spb.TcbParts{FmcSpl: 1}},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.policy.Policy = 1 << 17 // The reserved bit that must be 1.
+			opts, err := PolicyToOptions(tc.policy)
+			if !test.Match(err, tc.wantErr) {
+				t.Fatalf("PolicyToOptions() = _, %v. Want error %q", err, tc.wantErr)
+			}
+			if err == nil && opts.MinimumTCB != tc.wantMinTCB {
+				t.Errorf("PolicyToOptions().MinimumTCB = %+v, want %+v", opts.MinimumTCB, tc.wantMinTCB)
+			}
+		})
+	}
+}
+
+func TestValidateTcbTurin(t *testing.T) {
+	const tcb = 0x4400000016000301
+	report := &spb.Report{ReportedTcb: tcb, CurrentTcb: tcb, CommittedTcb: tcb, LaunchTcb: tcb}
+	turin := spb.SevProduct_SEV_PRODUCT_TURIN
+	tcs := []struct {
+		name    string
+		minTCB  kds.TCBParts
+		wantErr string
+	}{
+		{name: "met", minTCB: kds.TCBParts{UcodeSpl: 0x44, SnpSpl: 0x16, BlSpl: 0x03, FmcSpl: 0x01}},
+		{
+			name:    "FMC too low",
+			minTCB:  kds.TCBParts{FmcSpl: 0x02},
+			wantErr: "policy minimum TCB",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateTcb(report, kds.TCBVersion(tcb), turin, &Options{MinimumTCB: tc.minTCB})
+			if !test.Match(err, tc.wantErr) {
+				t.Errorf("validateTcb() = %v. Want error %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyTCBWithoutProduct(t *testing.T) {
+	// In the Milan layout, this is a TEE SPL of 3, which the Turin report does not meet.
+	const tcb = 0x4400000016000301
+	turin := &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_TURIN}
+	report := &spb.Report{
+		Version:      abi.ReportVersion3,
+		Cpuid1EaxFms: abi.MaskedCpuid1EaxFromSevProduct(turin),
+		ReportedTcb:  tcb,
+		CurrentTcb:   tcb,
+		CommittedTcb: tcb,
+		LaunchTcb:    tcb,
+	}
+	product := tcbProduct(&spb.Attestation{Report: report}, &kds.Extensions{}, abi.VcekReportSigner, &Options{})
+	if product != turin.GetName() {
+		t.Errorf("tcbProduct() = %v, want the report's product %v", product, turin.GetName())
+	}
+	opts, err := PolicyToOptions(&cpb.Policy{Policy: 1 << 17, MinimumTcb: tcb})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateTcb(report, kds.TCBVersion(tcb), product, opts); err != nil {
+		t.Errorf("validateTcb() = %v. Want the policy's minimum TCB in the report's layout", err)
+	}
+}
+
+func TestValidateTcbRelations(t *testing.T) {
+	// The host runs provisional firmware with a bootloader SPL one above the committed one, and
+	// launched the guest on it.
+	const committed = 0x4405000000000002
+	const current = 0x4405000000000003
+	report := &spb.Report{ReportedTcb: committed, CurrentTcb: current, CommittedTcb: committed, LaunchTcb: current}
+	milan := spb.SevProduct_SEV_PRODUCT_MILAN
+	mustParse := func(s string) TCBRelation {
+		r, err := ParseTCBRelation(s)
+		if err != nil {
+			t.Fatalf("ParseTCBRelation(%q) = _, %v", s, err)
+		}
+		return r
+	}
+	tcs := []struct {
+		name    string
+		opts    *Options
+		wantErr string
+	}{
+		{name: "provisional permitted", opts: &Options{PermitProvisionalFirmware: true}},
+		{
+			name:    "provisional forbidden",
+			opts:    &Options{},
+			wantErr: "the report's COMMITTED_TCB 0x4405000000000002 does not match the report's CURRENT_TCB 0x4405000000000003",
+		},
+		{
+			name: "relations met",
+			opts: &Options{PermitProvisionalFirmware: true, TCBRelations: []TCBRelation{
+				mustParse("committed<=current"), mustParse("reported <= launch")}},
+		},
+		{
+			name:    "launch above committed",
+			opts:    &Options{PermitProvisionalFirmware: true, TCBRelations: []TCBRelation{mustParse("launch<=committed")}},
+			wantErr: "TCB relation launch<=committed requires the report's LAUNCH_TCB 0x4405000000000003 <= the report's COMMITTED_TCB 0x4405000000000002",
+		},
+		{
+			name:    "committed minimum met",
+			opts:    &Options{PermitProvisionalFirmware: true, MinimumCommittedTCB: kds.TCBParts{BlSpl: 2, UcodeSpl: 0x44}},
+			wantErr: "",
+		},
+		{
+			name:    "committed below minimum",
+			opts:    &Options{PermitProvisionalFirmware: true, MinimumCommittedTCB: kds.TCBParts{BlSpl: 3}},
+			wantErr: "is lower than the policy minimum committed TCB",
+		},
+		{
+			name:    "unknown field",
+			opts:    &Options{PermitProvisionalFirmware: true, TCBRelations: []TCBRelation{{Lower: TCBField(7)}}},
+			wantErr: "TCB relation TCBField(7)<=current has an unknown TCB field",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateTcb(report, kds.TCBVersion(committed), milan, tc.opts)
+			if !test.Match(err, tc.wantErr) {
+				t.Errorf("validateTcb() = %v. Want error %q", err, tc.wantErr)
+			}
+		})
+	}
+
+	for _, s := range []string{"launch", "launch<=boot", "launch<=committed<=current"} {
+		if _, err := ParseTCBRelation(s); err == nil {
+			t.Errorf("ParseTCBRelation(%q) = _, nil. Want an error", s)
+		}
+	}
+	opts, err := PolicyToOptions(&cpb.Policy{
+		Policy:              1 << 17,
+		MinimumCommittedTcb: committed,
+		TcbRelations:        []string{"launch<=committed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.MinimumCommittedTCB.BlSpl != 2 || len(opts.TCBRelations) != 1 || opts.TCBRelations[0] != (TCBRelation{Lower: TCBLaunch, Higher: TCBCommitted}) {
+		t.Errorf("PolicyToOptions() = %+v, %v. Want the policy's committed TCB and relations", opts.MinimumCommittedTCB, opts.TCBRelations)
+	}
+}
+
+func TestValidateTcbOrdering(t *testing.T) {
+	milan := spb.SevProduct_SEV_PRODUCT_MILAN
+	turin := spb.SevProduct_SEV_PRODUCT_TURIN
+	tcs := []struct {
+		name     string
+		report   *spb.Report
+		product  spb.SevProduct_SevProductName
+		ordering TCBOrdering
+		wantErr  string
+	}{
+		{
+			name:     "unchecked rollback",
+			report:   &spb.Report{LaunchTcb: 0x4405000000000003, ReportedTcb: 0x4405000000000002, CurrentTcb: 0x4405000000000002},
+			product:  milan,
+			ordering: TCBOrderingUnchecked,
+		},
+		{
+			name:     "monotonic",
+			report:   &spb.Report{LaunchTcb: 0x4405000000000002, ReportedTcb: 0x4405000000000002, CurrentTcb: 0x4405000000000003},
+			product:  milan,
+			ordering: TCBOrderingMonotonic,
+		},
+		{
+			name:     "rollback since launch",
+			report:   &spb.Report{LaunchTcb: 0x4405000000000003, ReportedTcb: 0x4405000000000002, CurrentTcb: 0x4405000000000003},
+			product:  milan,
+			ordering: TCBOrderingMonotonic,
+			wantErr: "TCB relation launch<=reported requires the report's LAUNCH_TCB 0x4405000000000003 <= the report's REPORTED_TCB " +
+				"0x4405000000000002, but Milan TCB components differ: bl_spl 3 vs. 2",
+		},
+		{
+			name:     "reported above current",
+			report:   &spb.Report{LaunchTcb: 0x4405000000000002, ReportedTcb: 0x4406000000000002, CurrentTcb: 0x4405000000000002},
+			product:  milan,
+			ordering: TCBOrderingMonotonic,
+			wantErr:  "Milan TCB components differ: snp_spl 6 vs. 5",
+		},
+		{
+			name:     "launch below reported",
+			report:   &spb.Report{LaunchTcb: 0x4405000000000002, ReportedTcb: 0x4405000000000003, CurrentTcb: 0x4405000000000003},
+			product:  milan,
+			ordering: TCBOrderingLaunchEqualsReported,
+			wantErr:  "TCB relation reported<=launch requires the report's REPORTED_TCB 0x4405000000000003 <= the report's LAUNCH_TCB",
+		},
+		{
+			name:     "launch equals reported",
+			report:   &spb.Report{LaunchTcb: 0x4405000000000002, ReportedTcb: 0x4405000000000002, CurrentTcb: 0x4405000000000003},
+			product:  milan,
+			ordering: TCBOrderingLaunchEqualsReported,
+		},
+		{
+			name:     "current changed",
+			report:   &spb.Report{LaunchTcb: 0x4405000000000002, ReportedTcb: 0x4405000000000002, CurrentTcb: 0x4405000000000003},
+			product:  milan,
+			ordering: TCBOrderingEqual,
+			wantErr:  "requires the report's CURRENT_TCB 0x4405000000000003 <= the report's REPORTED_TCB 0x4405000000000002",
+		},
+		{
+			// Turin's low byte is the FMC SPL, not the bootloader SPL.
+			name:     "Turin layout",
+			report:   &spb.Report{LaunchTcb: 0x4405000000000203, ReportedTcb: 0x4405000000000202, CurrentTcb: 0x4405000000000203},
+			product:  turin,
+			ordering: TCBOrderingMonotonic,
+			wantErr:  "Turin TCB components differ: fmc_spl 3 vs. 2",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateTcbRelations(getReportTcbs(tc.report, 0, tc.product), tc.ordering.Relations(), tc.product)
+			if !test.Match(err, tc.wantErr) {
+				t.Errorf("validateTcbRelations(%v) = %v. Want error %q", tc.ordering, err, tc.wantErr)
+			}
+		})
+	}
+
+	if _, err := PolicyToOptions(&cpb.Policy{Policy: 1 << 17, TcbOrdering: 9}); !test.Match(err, "unknown tcb_ordering 9") {
+		t.Errorf("PolicyToOptions(tcb_ordering: 9) = _, %v. Want an unknown ordering error", err)
+	}
+	opts, err := PolicyToOptions(&cpb.Policy{
+		Policy:       1 << 17,
+		TcbRelations: []string{"launch<=committed"},
+		TcbOrdering:  cpb.TCBOrdering_TCB_ORDERING_LAUNCH_EQUALS_REPORTED,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]TCBRelation{{Lower: TCBLaunch, Higher: TCBCommitted}}, TCBOrderingLaunchEqualsReported.Relations()...)
+	if !reflect.DeepEqual(opts.TCBRelations, want) {
+		t.Errorf("PolicyToOptions().TCBRelations = %v, want %v", opts.TCBRelations, want)
+	}
+}
+
+func TestValidatePolicyBits(t *testing.T) {
+	const reserved = 1 << 17
+	tcs := []struct {
+		name     string
+		policy   uint64
+		required abi.SnpPolicy
+		wantErrs []string
+	}{
+		{name: "permitted", policy: reserved | 1<<16 | 1<<19, required: abi.SnpPolicy{SMT: true, Debug: true}},
+		{
+			name:     "debug",
+			policy:   reserved | 1<<19,
+			wantErrs: []string{"found unauthorized debug capability: POLICY bit 19 (DEBUG) is 1 in the report, but the validation policy requires 0"},
+		},
+		{
+			name:     "each bit",
+			policy:   reserved | 1<<18 | 1<<19,
+			required: abi.SnpPolicy{SingleSocket: true},
+			wantErrs: []string{
+				"POLICY bit 18 (MIGRATE_MA) is 1",
+				"POLICY bit 19 (DEBUG) is 1",
+				"required single socket restriction not present: POLICY bit 20 (SINGLE_SOCKET) is 0 in the report, but the validation policy requires 1",
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validatePolicy(tc.policy, tc.required)
+			errs := multierr.Errors(err)
+			if len(errs) != len(tc.wantErrs) {
+				t.Fatalf("validatePolicy(%#x) = %v. Want %d errors", tc.policy, err, len(tc.wantErrs))
+			}
+			for i, want := range tc.wantErrs {
+				if !test.Match(errs[i], want) {
+					t.Errorf("validatePolicy(%#x) error %d = %v. Want %q", tc.policy, i, errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSMTConsistency(t *testing.T) {
+	const reserved = 1 << 17
+	if err := validateSMTConsistency(reserved, 1, false); err != nil {
+		t.Errorf("validateSMTConsistency(_, _, false) = %v, want nil", err)
+	}
+	if err := validateSMTConsistency(reserved|1<<16, 1, true); err != nil {
+		t.Errorf("validateSMTConsistency(SMT permitted, SMT enabled) = %v, want nil", err)
+	}
+	if err := validateSMTConsistency(reserved, 0, true); err != nil {
+		t.Errorf("validateSMTConsistency(SMT forbidden, SMT disabled) = %v, want nil", err)
+	}
+	want := "PLATFORM_INFO 0x1 has SMT enabled, but POLICY 0x20000 does not permit SMT (bit 16)"
+	if err := validateSMTConsistency(reserved, 1, true); !test.Match(err, want) {
+		t.Errorf("validateSMTConsistency(SMT forbidden, SMT enabled) = %v. Want error %q", err, want)
+	}
+}
+
+func TestValidatePlatformInfoBits(t *testing.T) {
+	const smtAndRaplDisabled = 0x9
+	tcs := []struct {
+		name      string
+		required  *abi.SnpPlatformInfo
+		forbidden *abi.SnpPlatformInfo
+		wantErr   string
+	}{
+		{name: "unchecked"},
+		{
+			name:      "met",
+			required:  &abi.SnpPlatformInfo{RAPLDisabled: true},
+			forbidden: &abi.SnpPlatformInfo{TSMEEnabled: true, TIOEnabled: true},
+		},
+		{
+			name:     "required missing",
+			required: &abi.SnpPlatformInfo{CiphertextHidingDRAMEnabled: true},
+			wantErr:  `required platform feature "ciphertext hiding in DRAM enabled" missing from PLATFORM_INFO 0x9`,
+		},
+		{
+			name:      "forbidden present",
+			forbidden: &abi.SnpPlatformInfo{SMTEnabled: true},
+			wantErr:   `forbidden platform feature "SMT enabled" present in PLATFORM_INFO 0x9`,
+		},
+		{
+			name:      "conflict",
+			required:  &abi.SnpPlatformInfo{ECCEnabled: true},
+			forbidden: &abi.SnpPlatformInfo{ECCEnabled: true},
+			wantErr:   `platform feature "ECC enabled" is both required and forbidden`,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validatePlatformInfoBits(smtAndRaplDisabled, tc.required, tc.forbidden); !test.Match(err, tc.wantErr) {
+				t.Errorf("validatePlatformInfoBits() = %v. Want error %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCustomChecks(t *testing.T) {
+	sign0, err := test.DefaultTestOnlyCertChain(test.GetProductName(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &spb.Report{}
+	if err := prototext.Unmarshal([]byte(test.TestCases()[0].OutputProto), report); err != nil {
+		t.Fatalf("could not unmarshal zero report: %v", err)
+	}
+	attestation := &spb.Attestation{
+		Report:           report,
+		CertificateChain: &spb.CertificateChain{VcekCert: sign0.Vcek.Raw},
+	}
+	var ran []CheckName
+	check := func(name CheckName, err error) *CustomCheck {
+		return &CustomCheck{Name: name, Validate: func(a *spb.Attestation) error {
+			if a != attestation {
+				t.Errorf("custom check %q got attestation %v, want %v", name, a, attestation)
+			}
+			ran = append(ran, name)
+			return err
+		}}
+	}
+	opts := &Options{
+		GuestPolicy:  abi.SnpPolicy{Debug: true, SMT: true},
+		PlatformInfo: &abi.SnpPlatformInfo{SMTEnabled: true},
+		CustomChecks: []*CustomCheck{
+			check("first", nil),
+			check("second", errors.New("bespoke requirement")),
+			check("third", errors.New("other requirement")),
+		},
+	}
+	if err := SnpAttestation(attestation, opts); !test.Match(err, `custom check "second" failed: bespoke requirement`) {
+		t.Errorf("SnpAttestation() = %v, want the second custom check's error", err)
+	}
+	if len(ran) != 2 {
+		t.Errorf("SnpAttestation() ran custom checks %v, want [first second]", ran)
+	}
+
+	ran = nil
+	res, err := SnpAttestationWithResult(attestation, opts)
+	if !test.Match(err, "other requirement") {
+		t.Errorf("SnpAttestationWithResult() = _, %v, want the third custom check's error too", err)
+	}
+	if len(ran) != 3 {
+		t.Errorf("SnpAttestationWithResult() ran custom checks %v, want [first second third]", ran)
+	}
+	if c := res.Check("first"); c == nil || !c.Passed {
+		t.Errorf("SnpAttestationWithResult().Check(\"first\") = %+v, want passed", c)
+	}
+
+	opts.CustomChecks = []*CustomCheck{{Name: "empty"}}
+	if err := SnpAttestation(attestation, opts); !test.Match(err, "missing Validate function") {
+		t.Errorf("SnpAttestation() = %v, want a missing Validate function error", err)
+	}
+}
+
+func TestValidateFreshness(t *testing.T) {
+	requested := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	nonce := []byte("relying party challenge")
+	reportData := FreshReportData("example.com/attest/v1", nonce, requested)
+	if got, err := ReportDataTime(reportData[:]); err != nil || !got.Equal(requested) {
+		t.Errorf("ReportDataTime(FreshReportData(_, _, %v)) = %v, %v. Want %v", requested, got, err, requested)
+	}
+	at := func(d time.Duration) func() time.Time {
+		return func() time.Time { return requested.Add(d) }
+	}
+	tcs := []struct {
+		name      string
+		freshness *Freshness
+		wantErr   string
+	}{
+		{name: "unchecked"},
+		{
+			name:      "fresh",
+			freshness: &Freshness{Domain: "example.com/attest/v1", Nonce: nonce, MaxAge: time.Minute, Now: at(30 * time.Second)},
+		},
+		{
+			name:      "nonce only",
+			freshness: &Freshness{Domain: "example.com/attest/v1", Nonce: nonce},
+		},
+		{
+			name:      "replayed nonce",
+			freshness: &Freshness{Domain: "example.com/attest/v1", Nonce: []byte("next challenge")},
+			wantErr:   "does not bind the expected nonce",
+		},
+		{
+			name:      "other domain",
+			freshness: &Freshness{Domain: "example.com/attest/v2", Nonce: nonce},
+			wantErr:   "does not bind the expected nonce",
+		},
+		{
+			name:      "too old",
+			freshness: &Freshness{Domain: "example.com/attest/v1", Nonce: nonce, MaxAge: time.Minute, Now: at(2 * time.Minute)},
+			wantErr:   "2m0s old, more than the maximum age 1m0s",
+		},
+		{
+			name:      "future",
+			freshness: &Freshness{Domain: "example.com/attest/v1", MaxAge: time.Minute, MaxClockSkew: time.Second, Now: at(-time.Minute)},
+			wantErr:   "1m0s in the future",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validateFreshness(reportData[:], tc.freshness); !test.Match(err, tc.wantErr) {
+				t.Errorf("validateFreshness() = %v, want error %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestBytePatterns(t *testing.T) {
+	hostData := make([]byte, abi.HostDataSize)
+	copy(hostData, []byte{0xc0, 0xff, 0xee, 0x12})
+	mustParse := func(s string) *BytePattern {
+		p, err := ParseBytePattern(s, abi.HostDataSize)
+		if err != nil {
+			t.Fatalf("ParseBytePattern(%q) = _, %v", s, err)
+		}
+		return p
+	}
+	tcs := []struct {
+		name     string
+		patterns []*BytePattern
+		wantErr  string
+	}{
+		{name: "unchecked"},
+		{name: "prefix", patterns: []*BytePattern{mustParse("c0ffee*")}},
+		{name: "wildcard nibbles", patterns: []*BytePattern{mustParse("c0??ee?2*")}},
+		{name: "exact", patterns: []*BytePattern{{Value: hostData}}},
+		{name: "second of set", patterns: []*BytePattern{mustParse("beef*"), mustParse("c0ffee12*")}},
+		{
+			name:     "bit mask",
+			patterns: []*BytePattern{{Value: make([]byte, abi.HostDataSize), Mask: append([]byte{0x0f}, make([]byte, abi.HostDataSize-1)...)}},
+		},
+		{
+			name:     "no match",
+			patterns: []*BytePattern{mustParse("beef*"), mustParse("c0ffee13*")},
+			wantErr:  "report field HOST_DATA is c0ffee1200000000000000000000000000000000000000000000000000000000. Expect a match of one of [beef*, c0ffee13*]",
+		},
+		{
+			name:     "bad size",
+			patterns: []*BytePattern{{Value: hostData[:16]}},
+			wantErr:  "option HostDataPatterns entries must have a 32 byte value and mask",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateBytePatterns("HostDataPatterns", "HOST_DATA", abi.HostDataSize, hostData, tc.patterns)
+			if !test.Match(err, tc.wantErr) {
+				t.Errorf("validateBytePatterns() = %v, want error %q", err, tc.wantErr)
+			}
+		})
+	}
+
+	for _, s := range []string{"c0ffee", "c0ffee*" + strings.Repeat("0", 64), "xyz*"} {
+		if _, err := ParseBytePattern(s, abi.HostDataSize); err == nil {
+			t.Errorf("ParseBytePattern(%q) = _, nil, want error", s)
+		}
+	}
+	if got := mustParse("c0??ee*").String(); got != "c0??ee*" {
+		t.Errorf("ParseBytePattern(\"c0??ee*\").String() = %q", got)
+	}
+
+	opts, err := PolicyToOptions(&cpb.Policy{
+		Policy:           1 << 17,
+		HostDataPatterns: []string{"c0ffee*"},
+		FamilyIdPatterns: []string{strings.Repeat("?", 32)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.HostDataPatterns) != 1 || !opts.HostDataPatterns[0].Match(hostData) || len(opts.FamilyIDPatterns) != 1 {
+		t.Errorf("PolicyToOptions() patterns = %v, %v. Want the policy's patterns", opts.HostDataPatterns, opts.FamilyIDPatterns)
+	}
+	if _, err := PolicyToOptions(&cpb.Policy{Policy: 1 << 17, ImageIdPatterns: []string{"0"}}); !test.Match(err, "image_id_patterns[0]") {
+		t.Errorf("PolicyToOptions(bad image_id_patterns) = _, %v. Want a pattern error", err)
+	}
+}
+
+func TestPolicyToOptionsSigningKeyAndChipIDs(t *testing.T) {
+	chipID := make([]byte, abi.ChipIDSize)
+	opts, err := PolicyToOptions(&cpb.Policy{Policy: 1 << 17, SigningKey: cpb.SigningKey_SIGNING_KEY_VLEK, ChipIds: [][]byte{chipID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.SigningKey == nil || *opts.SigningKey != abi.VlekReportSigner || len(opts.ChipIDs) != 1 {
+		t.Errorf("PolicyToOptions() = %v, %v. Want the VLEK and the policy's CHIP_IDs", opts.SigningKey, opts.ChipIDs)
+	}
+	if opts, err := PolicyToOptions(&cpb.Policy{Policy: 1 << 17}); err != nil || opts.SigningKey != nil {
+		t.Errorf("PolicyToOptions(no signing_key) = %v, %v. Want nil SigningKey", opts, err)
+	}
+	if _, err := PolicyToOptions(&cpb.Policy{Policy: 1 << 17, SigningKey: 7}); !test.Match(err, "unknown signing_key 7") {
+		t.Errorf("PolicyToOptions(signing_key: 7) = _, %v. Want unknown signing_key error", err)
+	}
+	if _, err := PolicyToOptions(&cpb.Policy{Policy: 1 << 17, ChipIds: [][]byte{{1}}}); !test.Match(err, "chip_ids[0]") {
+		t.Errorf("PolicyToOptions(short chip_ids) = _, %v. Want a length error", err)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/google/go-sev-guest/verify/trust"
+	"google.golang.org/protobuf/proto"
+)
+
+// sharedFetch is one URL's result in a dedupGetter.
+type sharedFetch struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+// dedupGetter fetches each URL at most once for a batch, and makes concurrent requests for the same
+// URL wait for the first. Failed fetches are not remembered, so later attestations may retry them.
+type dedupGetter struct {
+	getter  trust.HTTPSGetter
+	mu      sync.Mutex
+	fetches map[string]*sharedFetch
+}
+
+func (g *dedupGetter) Get(url string) ([]byte, error) {
+	return g.GetContext(context.TODO(), url)
+}
+
+func (g *dedupGetter) GetContext(ctx context.Context, url string) ([]byte, error) {
+	for {
+		g.mu.Lock()
+		fetch, ok := g.fetches[url]
+		if !ok {
+			fetch = &sharedFetch{done: make(chan struct{})}
+			g.fetches[url] = fetch
+			g.mu.Unlock()
+			fetch.body, fetch.err = trust.GetWith(ctx, g.getter, url)
+			if fetch.err != nil {
+				g.mu.Lock()
+				delete(g.fetches, url)
+				g.mu.Unlock()
+			}
+			close(fetch.done)
+			return fetch.body, fetch.err
+		}
+		g.mu.Unlock()
+		select {
+		case <-fetch.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if fetch.err == nil {
+			return fetch.body, nil
+		}
+		// The first fetch failed, perhaps only because its context ended. Try again.
+	}
+}
+
+// SnpAttestations verifies each attestation like SnpAttestation, using up to workers goroutines,
+// and returns the error for each attestation at its index. The attestations share one fetch of
+// each certificate and CRL, so that VCEKs are fetched once per chip and TCB. If workers is not
+// positive, uses GOMAXPROCS.
+func SnpAttestations(attestations []*spb.Attestation, options *Options, workers int) []error {
+	return SnpAttestationsContext(context.TODO(), attestations, options, workers)
+}
+
+// SnpAttestationsContext behaves like SnpAttestations but forwards the context to the HTTPSGetter.
+func SnpAttestationsContext(ctx context.Context, attestations []*spb.Attestation, options *Options, workers int) []error {
+	errs := make([]error, len(attestations))
+	if options == nil {
+		for i := range errs {
+			errs[i] = SnpAttestationContext(ctx, attestations[i], options)
+		}
+		return errs
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	shared := &dedupGetter{getter: options.getter(), fetches: map[string]*sharedFetch{}}
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				// Verification refines the product expectation, so each attestation gets its own.
+				opts := *options
+				// The shared getter already fetches from the mirrors.
+				opts.Getter = shared
+				opts.KDSMirrors = nil
+				if options.Product != nil {
+					opts.Product = proto.Clone(options.Product).(*spb.SevProduct)
+				}
+				errs[i] = SnpAttestationContext(ctx, attestations[i], &opts)
+			}
+		}()
+	}
+	for i := range attestations {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,272 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+	"google.golang.org/protobuf/proto"
+)
+
+// Names of the files in a bundle archive.
+const (
+	bundleReportFile    = "report.bin"
+	bundleVcekFile      = "vcek.der"
+	bundleVlekFile      = "vlek.der"
+	bundleAskFile       = "ask.der"
+	bundleArkFile       = "ark.der"
+	bundleCrlFile       = "crl.der"
+	bundleTimestampFile = "timestamp"
+	bundleExtrasDir     = "extras/"
+	// maxBundleFileSize bounds each file of an untrusted bundle archive.
+	maxBundleFileSize = 1 << 20
+)
+
+// Bundle holds everything needed to verify an attestation without network access: the report,
+// its certificate chain, the product CRL, and the time at which the evidence was collected.
+type Bundle struct {
+	// Attestation is the report with its complete certificate chain.
+	Attestation *spb.Attestation
+	// CRL is the DER-encoded product CRL, or nil if revocation was not checked.
+	CRL []byte
+	// Timestamp is when the bundle was created. Nothing authenticates it, so verification only
+	// checks certificates and the CRL at this time if the caller sets Options.Now to it.
+	Timestamp time.Time
+}
+
+// CreateBundle fills in the attestation's certificate chain and fetches the product CRL if
+// options.CheckRevocations is set, and verifies the result, so that the returned bundle can be
+// verified offline with SnpBundle. The attestation is not modified.
+func CreateBundle(attestation *spb.Attestation, options *Options) (*Bundle, error) {
+	return CreateBundleContext(context.TODO(), attestation, options)
+}
+
+// CreateBundleContext behaves like CreateBundle but forwards the context to the HTTPSGetter.
+func CreateBundleContext(ctx context.Context, attestation *spb.Attestation, options *Options) (*Bundle, error) {
+	if options == nil {
+		return nil, fmt.Errorf("options cannot be nil")
+	}
+	if attestation == nil {
+		return nil, fmt.Errorf("attestation cannot be nil")
+	}
+	attestation = proto.Clone(attestation).(*spb.Attestation)
+	if err := fillInAttestation(ctx, attestation, options); err != nil {
+		return nil, err
+	}
+	result := &Bundle{Attestation: attestation, Timestamp: options.now()}
+	info, err := abi.ProtoSignerInfo(attestation.GetReport())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSigner(info.SigningKey, options); err != nil {
+		return nil, err
+	}
+	knownProductLine, err := reportProductLine(attestation.GetReport(), options)
+	if err != nil {
+		return nil, err
+	}
+	endorsementKeyCert, root, err := decodeCertsContext(ctx, attestation.GetCertificateChain(), info.SigningKey, knownProductLine, options, nil)
+	if err != nil {
+		return nil, err
+	}
+	if options.CheckRevocations {
+		crl, err := GetCrlAndCheckRootContext(ctx, root, options)
+		if err != nil {
+			return nil, err
+		}
+		result.CRL = crl.Raw
+	}
+	if err := snpProtoReportSignature(attestation.GetReport(), endorsementKeyCert, options.cryptoBackend()); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Marshal returns the bundle as a tar archive with one file per component, so that auditors can
+// inspect it with standard tools.
+func (b *Bundle) Marshal() ([]byte, error) {
+	report, err := abi.ReportToAbiBytes(b.Attestation.GetReport())
+	if err != nil {
+		return nil, err
+	}
+	chain := b.Attestation.GetCertificateChain()
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{bundleReportFile, report},
+		{bundleVcekFile, chain.GetVcekCert()},
+		{bundleVlekFile, chain.GetVlekCert()},
+		{bundleAskFile, chain.GetAskCert()},
+		{bundleArkFile, chain.GetArkCert()},
+		{bundleCrlFile, b.CRL},
+		{bundleTimestampFile, []byte(b.Timestamp.UTC().Format(time.RFC3339Nano))},
+	}
+	for guid, extra := range chain.GetExtras() {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{bundleExtrasDir + guid, extra})
+	}
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, f := range files {
+		if len(f.data) == 0 {
+			continue
+		}
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data)), ModTime: b.Timestamp}
+		if err := w.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBundle parses a tar archive produced by Bundle.Marshal.
+func UnmarshalBundle(data []byte) (*Bundle, error) {
+	chain := &spb.CertificateChain{Extras: map[string][]byte{}}
+	result := &Bundle{Attestation: &spb.Attestation{CertificateChain: chain}}
+	var haveTimestamp bool
+	r := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read bundle: %v", err)
+		}
+		if hdr.Size > maxBundleFileSize {
+			return nil, fmt.Errorf("bundle file %q is %d bytes. Expect at most %d", hdr.Name, hdr.Size, maxBundleFileSize)
+		}
+		contents, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("could not read bundle file %q: %v", hdr.Name, err)
+		}
+		switch {
+		case hdr.Name == bundleReportFile:
+			report, err := abi.ReportToProto(contents)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse bundle report: %v", err)
+			}
+			result.Attestation.Report = report
+		case hdr.Name == bundleVcekFile:
+			chain.VcekCert = contents
+		case hdr.Name == bundleVlekFile:
+			chain.VlekCert = contents
+		case hdr.Name == bundleAskFile:
+			chain.AskCert = contents
+		case hdr.Name == bundleArkFile:
+			chain.ArkCert = contents
+		case hdr.Name == bundleCrlFile:
+			result.CRL = contents
+		case hdr.Name == bundleTimestampFile:
+			result.Timestamp, err = time.Parse(time.RFC3339Nano, string(contents))
+			if err != nil {
+				return nil, fmt.Errorf("could not parse bundle timestamp: %v", err)
+			}
+			haveTimestamp = true
+		case strings.HasPrefix(hdr.Name, bundleExtrasDir):
+			chain.Extras[strings.TrimPrefix(hdr.Name, bundleExtrasDir)] = contents
+		default:
+			return nil, fmt.Errorf("unexpected bundle file %q", hdr.Name)
+		}
+	}
+	if result.Attestation.Report == nil {
+		return nil, fmt.Errorf("bundle is missing %s", bundleReportFile)
+	}
+	if !haveTimestamp {
+		return nil, fmt.Errorf("bundle is missing %s", bundleTimestampFile)
+	}
+	return result, nil
+}
+
+// bundleGetter fails every request in place of the network.
+type bundleGetter struct{}
+
+func (bundleGetter) Get(url string) ([]byte, error) {
+	return nil, fmt.Errorf("offline verification cannot fetch %s", url)
+}
+
+// SnpBundle verifies a bundle without network access. Revocation is checked if
+// options.CheckRevocations is set, which requires the bundle to carry a CRL. The CRL is the
+// bundle's own, rather than one cached by other verifications, and is not cached itself.
+//
+// Certificates and the CRL are checked at options.Now or options.Clock, or the current time, like
+// other verifications. The bundle's Timestamp is not authenticated, so an attacker who can supply
+// bundles could pair an old CRL with an old timestamp to hide a revocation. Only set options.Now to
+// b.Timestamp for bundles from a trusted source.
+func SnpBundle(b *Bundle, options *Options) error {
+	return SnpBundleContext(context.TODO(), b, options)
+}
+
+// SnpBundleContext behaves like SnpBundle but gives up when ctx is done.
+func SnpBundleContext(ctx context.Context, b *Bundle, options *Options) error {
+	offline, err := bundleOptions(b, options)
+	if err != nil {
+		return err
+	}
+	return SnpAttestationContext(ctx, b.Attestation, offline)
+}
+
+// SnpBundleWithResult behaves like SnpBundle but also returns the outcome of each check, like
+// SnpAttestationWithResult.
+func SnpBundleWithResult(b *Bundle, options *Options) (*Result, error) {
+	return SnpBundleWithResultContext(context.TODO(), b, options)
+}
+
+// SnpBundleWithResultContext behaves like SnpBundleWithResult but gives up when ctx is done.
+func SnpBundleWithResultContext(ctx context.Context, b *Bundle, options *Options) (*Result, error) {
+	offline, err := bundleOptions(b, options)
+	if err != nil {
+		return &Result{}, err
+	}
+	return SnpAttestationWithResultContext(ctx, b.Attestation, offline)
+}
+
+// bundleOptions returns options that verify the bundle with only its own contents.
+func bundleOptions(b *Bundle, options *Options) (*Options, error) {
+	if options == nil {
+		return nil, fmt.Errorf("options cannot be nil")
+	}
+	if b == nil || b.Attestation == nil {
+		return nil, fmt.Errorf("bundle cannot be nil")
+	}
+	if options.CheckRevocations && len(b.CRL) == 0 {
+		return nil, fmt.Errorf("bundle has no CRL to check revocations with")
+	}
+	offline := *options
+	offline.DisableCertFetching = true
+	offline.CertStore = nil
+	offline.CRLStaleGrace = 0
+	offline.Getter = bundleGetter{}
+	offline.bundleCRL = b.CRL
+	return &offline, nil
+}
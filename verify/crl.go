@@ -0,0 +1,83 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"github.com/google/go-sev-guest/verify/trust"
+)
+
+// crlCacheKey identifies a product CRL. The distribution point differs between the VCEK and VLEK
+// signing keys of a product line.
+type crlCacheKey struct {
+	productLine       string
+	distributionPoint string
+}
+
+type cachedCRL struct {
+	crl     *x509.RevocationList
+	fetched time.Time
+}
+
+var (
+	crlCacheMu sync.Mutex
+	crlCache   = map[crlCacheKey]*cachedCRL{}
+	// crlClock returns the time that CRL ages are measured against.
+	crlClock = time.Now
+)
+
+// ClearCRLCache forgets every CRL fetched by earlier revocation checks.
+func ClearCRLCache() {
+	crlCacheMu.Lock()
+	crlCache = map[crlCacheKey]*cachedCRL{}
+	crlCacheMu.Unlock()
+}
+
+// cachedCRLFor returns the cached CRL for r's distribution point if it is fresh according to opts:
+// its NextUpdate is after the verification time and it was fetched less than opts.CRLMaxAge ago. If
+// stale is true, both limits are extended by opts.CRLStaleGrace.
+func cachedCRLFor(r *trust.AMDRootCerts, distributionPoint string, opts *Options, stale bool) *x509.RevocationList {
+	crlCacheMu.Lock()
+	cached, ok := crlCache[crlCacheKey{r.GetProductLine(), distributionPoint}]
+	crlCacheMu.Unlock()
+	if !ok {
+		return nil
+	}
+	var grace time.Duration
+	if stale {
+		grace = opts.CRLStaleGrace
+	}
+	if !opts.now().Before(cached.crl.NextUpdate.Add(grace)) {
+		return nil
+	}
+	if opts.CRLMaxAge > 0 && !crlClock().Before(cached.fetched.Add(opts.CRLMaxAge+grace)) {
+		return nil
+	}
+	return cached.crl
+}
+
+// cacheCRL remembers crl for r's distribution point if r's ARK issued it, so that a CRL from an
+// untrusted root cannot displace the real one.
+func cacheCRL(r *trust.AMDRootCerts, distributionPoint string, crl *x509.RevocationList, backend CryptoBackend) {
+	if r.ProductCerts.Ark == nil || checkCRLIssuer(crl, r.ProductCerts.Ark, backend) != nil {
+		return
+	}
+	crlCacheMu.Lock()
+	crlCache[crlCacheKey{r.GetProductLine(), distributionPoint}] = &cachedCRL{crl: crl, fetched: crlClock()}
+	crlCacheMu.Unlock()
+}
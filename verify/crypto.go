@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CryptoBackend performs the signature checks of verification, so that deployments can use a
+// FIPS-validated module, boringcrypto, or a PKCS#11 token instead of the Go standard library.
+type CryptoBackend interface {
+	// VerifyECDSAP384SHA384 checks the ASN.1 DER-encoded ECDSA P-384 signature of the SHA-384
+	// digest of message.
+	VerifyECDSAP384SHA384(key *ecdsa.PublicKey, message, signature []byte) error
+	// CheckCertificateSignature checks that issuer signed cert.
+	CheckCertificateSignature(cert, issuer *x509.Certificate) error
+	// CheckCRLSignature checks that issuer signed crl.
+	CheckCRLSignature(crl *x509.RevocationList, issuer *x509.Certificate) error
+}
+
+// GoCrypto implements CryptoBackend with the Go standard library.
+type GoCrypto struct{}
+
+// VerifyECDSAP384SHA384 checks the signature with crypto/ecdsa.
+func (GoCrypto) VerifyECDSAP384SHA384(key *ecdsa.PublicKey, message, signature []byte) error {
+	digest := sha512.Sum384(message)
+	if !ecdsa.VerifyASN1(key, digest[:], signature) {
+		return errors.New("ECDSA verification failure")
+	}
+	return nil
+}
+
+// CheckCertificateSignature checks the signature with crypto/x509.
+func (GoCrypto) CheckCertificateSignature(cert, issuer *x509.Certificate) error {
+	return cert.CheckSignatureFrom(issuer)
+}
+
+// CheckCRLSignature checks the signature with crypto/x509.
+func (GoCrypto) CheckCRLSignature(crl *x509.RevocationList, issuer *x509.Certificate) error {
+	return crl.CheckSignatureFrom(issuer)
+}
+
+// checkValidity returns an error if cert is not valid at now.
+func checkValidity(cert *x509.Certificate, role string, now time.Time) error {
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("%s certificate is valid from %v to %v, not at %v", role, cert.NotBefore, cert.NotAfter, now)
+	}
+	return nil
+}
+
+// verifyChainWith checks the endorsement key, intermediate, and self-signed root certificates'
+// signatures with backend, and their validity at now. It replaces x509.Certificate.Verify, whose
+// signature checks cannot be delegated.
+func verifyChainWith(backend CryptoBackend, ek, ica, ark *x509.Certificate, now time.Time) error {
+	if now.IsZero() {
+		now = time.Now()
+	}
+	for _, link := range []struct {
+		cert, issuer *x509.Certificate
+		role         string
+	}{
+		{ek, ica, "endorsement key"},
+		{ica, ark, "intermediate"},
+		{ark, ark, "root"},
+	} {
+		if err := checkValidity(link.cert, link.role, now); err != nil {
+			return err
+		}
+		if link.cert != ark && !link.issuer.IsCA {
+			return fmt.Errorf("%s certificate issuer is not a certificate authority", link.role)
+		}
+		if err := backend.CheckCertificateSignature(link.cert, link.issuer); err != nil {
+			return fmt.Errorf("%s certificate signature verification error: %v", link.role, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-sev-guest/abi"
+	spb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// hclDigest returns the digest of data with which the HCL binds the runtime claims.
+func hclDigest(h abi.HclHashType, data []byte) ([]byte, error) {
+	switch h {
+	case abi.HclHashSHA256:
+		d := sha256.Sum256(data)
+		return d[:], nil
+	case abi.HclHashSHA384:
+		d := sha512.Sum384(data)
+		return d[:], nil
+	case abi.HclHashSHA512:
+		d := sha512.Sum512(data)
+		return d[:], nil
+	}
+	return nil, fmt.Errorf("unknown HCL runtime data hash type %d", h)
+}
+
+// HCLKey is a JSON Web Key in the runtime claims, such as the vTPM's attestation key "HCLAkPub".
+type HCLKey struct {
+	Kid    string   `json:"kid"`
+	Kty    string   `json:"kty"`
+	KeyOps []string `json:"key_ops,omitempty"`
+	E      string   `json:"e,omitempty"`
+	N      string   `json:"n,omitempty"`
+}
+
+// HCLRuntimeClaims is the runtime data that the HCL binds to the SEV-SNP report of an HCL report,
+// the report that the Azure paravisor (HCL) of a confidential VM writes to the vTPM.
+type HCLRuntimeClaims struct {
+	Keys []HCLKey `json:"keys"`
+	// UserData is the hex-encoded nonce that the guest supplied when it requested the report.
+	UserData string `json:"user-data"`
+}
+
+// Key returns the runtime claims key with the given key ID, or nil.
+func (c *HCLRuntimeClaims) Key(kid string) *HCLKey {
+	for i := range c.Keys {
+		if c.Keys[i].Kid == kid {
+			return &c.Keys[i]
+		}
+	}
+	return nil
+}
+
+// checkHCLBinding returns the runtime claims if reportData binds them: it must start with their
+// digest and be zero afterwards. If nonce is non-nil, the claims' user data must equal it.
+func checkHCLBinding(reportData []byte, hcl *abi.HclReport, nonce []byte) (*HCLRuntimeClaims, error) {
+	digest, err := hclDigest(hcl.HashType, hcl.RuntimeClaims)
+	if err != nil {
+		return nil, err
+	}
+	if len(reportData) != abi.ReportDataSize {
+		return nil, fmt.Errorf("REPORT_DATA is %d bytes, want %d", len(reportData), abi.ReportDataSize)
+	}
+	padded := make([]byte, abi.ReportDataSize)
+	copy(padded, digest)
+	if !bytes.Equal(reportData, padded) {
+		return nil, fmt.Errorf("REPORT_DATA %s does not bind the HCL runtime claims with digest %s",
+			hex.EncodeToString(reportData), hex.EncodeToString(digest))
+	}
+	claims := &HCLRuntimeClaims{}
+	if err := json.Unmarshal(hcl.RuntimeClaims, claims); err != nil {
+		return nil, fmt.Errorf("could not parse HCL runtime claims: %v", err)
+	}
+	if nonce != nil {
+		userData, err := hex.DecodeString(claims.UserData)
+		if err != nil {
+			return nil, fmt.Errorf("HCL runtime claims user-data %q is not hex: %v", claims.UserData, err)
+		}
+		if !bytes.Equal(userData, nonce) {
+			return nil, fmt.Errorf("HCL runtime claims user-data %s is not the expected nonce %s",
+				claims.UserData, hex.EncodeToString(nonce))
+		}
+	}
+	return claims, nil
+}
+
+// SnpHCLReport verifies an Azure HCL report: its runtime claims must be bound to the enclosed
+// SEV-SNP report's REPORT_DATA and, if nonce is non-nil, carry nonce as their user data. The
+// SEV-SNP report is then verified like SnpAttestation with options. On success, returns the runtime
+// claims, whose "HCLAkPub" key verifies the quotes of the VM's vTPM.
+func SnpHCLReport(hclReport []byte, nonce []byte, options *Options) (*HCLRuntimeClaims, error) {
+	return SnpHCLReportContext(context.TODO(), hclReport, nonce, options)
+}
+
+// SnpHCLReportContext behaves like SnpHCLReport but forwards the context to the HTTPSGetter.
+func SnpHCLReportContext(ctx context.Context, hclReport []byte, nonce []byte, options *Options) (*HCLRuntimeClaims, error) {
+	hcl, err := abi.ParseHclReport(hclReport)
+	if err != nil {
+		return nil, err
+	}
+	report, err := abi.ReportToProto(hcl.Report)
+	if err != nil {
+		return nil, fmt.Errorf("could not interpret HCL hardware report: %v", err)
+	}
+	claims, err := checkHCLBinding(report.GetReportData(), hcl, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if err := SnpAttestationContext(ctx, &spb.Attestation{Report: report}, options); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
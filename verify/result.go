@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+// CheckName identifies one step of attestation verification.
+type CheckName string
+
+const (
+	// CheckSigner checks that the report's signing key type is allowed. It only runs if
+	// Options.AllowedSigners is set.
+	CheckSigner CheckName = "signer"
+	// CheckCertificateFetch obtains any certificates missing from the attestation.
+	CheckCertificateFetch CheckName = "certificate_fetch"
+	// CheckReportFormat checks that the report is well-formed.
+	CheckReportFormat CheckName = "report_format"
+	// CheckExtensions checks the endorsement key certificate's format and KDS extensions.
+	CheckExtensions CheckName = "extensions"
+	// CheckCertChain checks the ARK and AS[V]K and that they certify the endorsement key.
+	CheckCertChain CheckName = "cert_chain"
+	// CheckRevocation checks the product CRL. It is skipped unless Options.CheckRevocations is set.
+	CheckRevocation CheckName = "revocation"
+	// CheckSignature checks the report's signature with the endorsement key.
+	CheckSignature CheckName = "signature"
+)
+
+// CheckResult is the outcome of one verification step.
+type CheckResult struct {
+	Check CheckName
+	// Passed is whether the check ran and succeeded.
+	Passed bool
+	// Skipped is whether the options disabled the check.
+	Skipped bool
+	// Detail is the reason the check failed, if it did.
+	Detail string
+}
+
+// Result enumerates the checks that verification performed, in order. Verification stops at the
+// first failed check, so the checks after it are absent, unless Options.CollectAllFailures is set.
+// Then only the checks that depend on a failed check are absent.
+type Result struct {
+	Checks []*CheckResult
+}
+
+// Passed returns whether every check that ran succeeded.
+func (r *Result) Passed() bool {
+	for _, c := range r.Checks {
+		if !c.Passed && !c.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+// Check returns the outcome of the named check, or nil if it did not run.
+func (r *Result) Check(name CheckName) *CheckResult {
+	for _, c := range r.Checks {
+		if c.Check == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// record appends the outcome of check to r, if r is non-nil, and returns err.
+func (r *Result) record(check CheckName, err error) error {
+	if r == nil {
+		return err
+	}
+	result := &CheckResult{Check: check, Passed: err == nil}
+	if err != nil {
+		result.Detail = err.Error()
+	}
+	r.Checks = append(r.Checks, result)
+	return err
+}
+
+// skip appends a skipped check to r, if r is non-nil.
+func (r *Result) skip(check CheckName) {
+	if r != nil {
+		r.Checks = append(r.Checks, &CheckResult{Check: check, Skipped: true})
+	}
+}
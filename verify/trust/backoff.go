@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	defaultBackoffAttempts     = 5
+	defaultBackoffInitialDelay = time.Second
+	defaultBackoffMaxDelay     = 30 * time.Second
+)
+
+// The classes of KDS failures that an HTTPStatusError errors.Is, so that callers can react to
+// them without matching error text.
+var (
+	// ErrCertNotYetGenerated is a 404 Not Found response to a VCEK or VLEK certificate request,
+	// which the KDS may give for a chip or TCB that it has not generated a certificate for yet.
+	// Retrying getters only retry it if asked to, since the KDS gives the same response for a
+	// chip or TCB that it never certifies.
+	ErrCertNotYetGenerated = errors.New("KDS certificate not yet generated")
+	// ErrRateLimited is a 429 Too Many Requests response. The HTTPStatusError's RetryAfter is the
+	// server's hint of when to retry, if it gave one.
+	ErrRateLimited = errors.New("KDS rate limit exceeded")
+	// ErrServerError is a 5xx response.
+	ErrServerError = errors.New("KDS server error")
+)
+
+// HTTPStatusError is returned by SimpleHTTPSGetter when the server responds with a non-success
+// status. It errors.Is ErrCertNotYetGenerated, ErrRateLimited, or ErrServerError according to
+// its status.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	// RetryAfter is the delay the server requested with a Retry-After header, or zero.
+	RetryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("failed to retrieve '%s' status %d", e.URL, e.StatusCode)
+}
+
+// Is returns whether target is the failure class of e's status.
+func (e *HTTPStatusError) Is(target error) bool {
+	switch target {
+	case ErrCertNotYetGenerated:
+		return e.StatusCode == http.StatusNotFound && isEndorsementKeyCertURL(e.URL)
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServerError:
+		return e.StatusCode >= 500 && e.StatusCode < 600
+	}
+	return false
+}
+
+// isEndorsementKeyCertURL returns whether rawURL requests a VCEK or VLEK certificate from the KDS
+// or a mirror of it, i.e., its path ends in /{vcek,vlek}/v1/product/endpoint for an endpoint other
+// than cert_chain and crl.
+func isEndorsementKeyCertURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(u.Path, "/")
+	n := len(parts)
+	if n < 4 || (parts[n-4] != "vcek" && parts[n-4] != "vlek") || parts[n-3] != "v1" {
+		return false
+	}
+	return parts[n-1] != "cert_chain" && parts[n-1] != "crl"
+}
+
+// transient returns whether a later request may succeed. ErrCertNotYetGenerated is transient only
+// if retryNotYetGenerated. Other client errors, e.g., 404 for a CRL or 403 for missing
+// credentials, are permanent.
+func (e *HTTPStatusError) transient(retryNotYetGenerated bool) bool {
+	return e.Is(ErrRateLimited) || e.Is(ErrServerError) || (retryNotYetGenerated && e.Is(ErrCertNotYetGenerated))
+}
+
+// retryAdvice returns whether the failure err of a fetch is permanent, i.e., every error it
+// combines is a permanent HTTPStatusError, and the longest delay that the servers requested.
+func retryAdvice(err error, retryNotYetGenerated bool) (bool, time.Duration) {
+	permanent := true
+	var retryAfter time.Duration
+	for _, e := range multierr.Errors(err) {
+		var statusErr *HTTPStatusError
+		if !errors.As(e, &statusErr) {
+			permanent = false
+			continue
+		}
+		if statusErr.transient(retryNotYetGenerated) {
+			permanent = false
+		}
+		if statusErr.RetryAfter > retryAfter {
+			retryAfter = statusErr.RetryAfter
+		}
+	}
+	return permanent, retryAfter
+}
+
+// parseRetryAfter interprets a Retry-After header as either delay-seconds or an HTTP date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// BackoffHTTPSGetter is a meta-HTTPS getter that retries transient failures with exponential
+// backoff and jitter, up to a maximum number of attempts. When the server throttles with a 429 or
+// 503 response carrying Retry-After, it waits as long as the server asks instead.
+type BackoffHTTPSGetter struct {
+	// Getter is the non-retrying way of getting a URL. If nil, uses SimpleHTTPSGetter.
+	Getter HTTPSGetter
+	// MaxAttempts is the number of requests to make before failing. If zero, makes 5.
+	MaxAttempts int
+	// InitialDelay is the delay before the first retry, which doubles for each retry after. If
+	// zero, starts at one second.
+	InitialDelay time.Duration
+	// MaxDelay caps the backoff delay, though not a server's Retry-After. If zero, caps at 30
+	// seconds.
+	MaxDelay time.Duration
+	// Jitter is the fraction of each backoff delay to randomize, in [0, 1], so that many
+	// verifiers do not retry in lockstep.
+	Jitter float64
+	// RetryCertNotYetGenerated if true, also retries ErrCertNotYetGenerated failures, e.g., to wait
+	// for the KDS to generate the certificate of a freshly updated TCB.
+	RetryCertNotYetGenerated bool
+}
+
+// Get fetches the body of the URL, retrying transient failures.
+func (n *BackoffHTTPSGetter) Get(url string) ([]byte, error) {
+	return n.GetContext(context.TODO(), url)
+}
+
+// GetContext behaves like Get, but forwards the context to the Getter and stops retrying when the
+// context is done.
+func (n *BackoffHTTPSGetter) GetContext(ctx context.Context, url string) ([]byte, error) {
+	getter := n.Getter
+	if getter == nil {
+		getter = &SimpleHTTPSGetter{}
+	}
+	attempts := n.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultBackoffAttempts
+	}
+	delay := n.InitialDelay
+	if delay <= 0 {
+		delay = defaultBackoffInitialDelay
+	}
+	maxDelay := n.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultBackoffMaxDelay
+	}
+	var returnedError error
+	for attempt := 1; ; attempt++ {
+		body, err := GetWith(ctx, getter, url)
+		if err == nil {
+			return body, nil
+		}
+		returnedError = multierr.Append(returnedError, err)
+		wait := n.jittered(delay)
+		permanent, retryAfter := retryAdvice(err, n.RetryCertNotYetGenerated)
+		if permanent {
+			return nil, returnedError
+		}
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		if attempt >= attempts {
+			return nil, returnedError
+		}
+		select {
+		case <-ctx.Done():
+			return nil, multierr.Append(returnedError, ctx.Err())
+		case <-time.After(wait):
+		}
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// jittered returns delay randomly shortened by up to the Jitter fraction of it.
+func (n *BackoffHTTPSGetter) jittered(delay time.Duration) time.Duration {
+	jitter := n.Jitter
+	if jitter <= 0 {
+		return delay
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	return delay - time.Duration(jitter*rand.Float64()*float64(delay))
+}
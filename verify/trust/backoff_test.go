@@ -0,0 +1,192 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-sev-guest/verify/trust"
+	"go.uber.org/multierr"
+)
+
+// statusGetter fails with the given errors in order, then succeeds.
+type statusGetter struct {
+	errs  []error
+	calls int
+}
+
+func (g *statusGetter) Get(string) ([]byte, error) {
+	g.calls++
+	if len(g.errs) == 0 {
+		return []byte("content"), nil
+	}
+	err := g.errs[0]
+	g.errs = g.errs[1:]
+	return nil, err
+}
+
+func TestBackoffHTTPSGetter(t *testing.T) {
+	busy := &trust.HTTPStatusError{StatusCode: http.StatusServiceUnavailable}
+	throttled := &trust.HTTPStatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 50 * time.Millisecond}
+	notGenerated := &trust.HTTPStatusError{URL: "https://kdsintf.amd.com/vlek/v1/Milan/cert", StatusCode: http.StatusNotFound}
+	tcs := []struct {
+		name              string
+		errs              []error
+		retryNotGenerated bool
+		wantCalls         int
+		wantErr           bool
+		minTime           time.Duration
+	}{
+		{name: "immediate success", wantCalls: 1},
+		{name: "network error then success", errs: []error{errors.New("reset")}, wantCalls: 2},
+		{name: "busy then success", errs: []error{busy, busy}, wantCalls: 3},
+		{name: "retry after", errs: []error{throttled}, wantCalls: 2, minTime: 50 * time.Millisecond},
+		{name: "not found is permanent", errs: []error{&trust.HTTPStatusError{StatusCode: http.StatusNotFound}}, wantCalls: 1, wantErr: true},
+		{name: "attempts exhausted", errs: []error{busy, busy, busy, busy}, wantCalls: 3, wantErr: true},
+		{name: "not yet generated is permanent", errs: []error{notGenerated}, wantCalls: 1, wantErr: true},
+		{name: "not yet generated retries if asked", errs: []error{notGenerated}, retryNotGenerated: true, wantCalls: 2},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			g := &statusGetter{errs: tc.errs}
+			getter := &trust.BackoffHTTPSGetter{
+				Getter:       g,
+				MaxAttempts:  3,
+				InitialDelay: time.Millisecond,
+				MaxDelay:     2 * time.Millisecond,
+				Jitter:       0.5,
+
+				RetryCertNotYetGenerated: tc.retryNotGenerated,
+			}
+			start := time.Now()
+			body, err := getter.Get("https://fetch.me")
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Get() = %q, %v. Want error: %t", body, err, tc.wantErr)
+			}
+			if g.calls != tc.wantCalls {
+				t.Errorf("Get() made %d requests, want %d", g.calls, tc.wantCalls)
+			}
+			if elapsed := time.Since(start); elapsed < tc.minTime {
+				t.Errorf("Get() took %v, want at least %v", elapsed, tc.minTime)
+			}
+		})
+	}
+}
+
+func TestSimpleHTTPSGetterRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	_, err := (&trust.SimpleHTTPSGetter{}).Get(server.URL)
+	var statusErr *trust.HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Get() = _, %v, want an HTTPStatusError", err)
+	}
+	if statusErr.StatusCode != http.StatusTooManyRequests || statusErr.RetryAfter != 7*time.Second {
+		t.Errorf("Get() = _, %+v, want status 429 with Retry-After 7s", statusErr)
+	}
+}
+
+func TestHTTPStatusErrorClasses(t *testing.T) {
+	vcekURL := "https://kdsintf.amd.com/vcek/v1/Milan/0a0b?blSPL=0&teeSPL=0&snpSPL=0&ucodeSPL=0"
+	mirrorVlekURL := "https://mirror.example.com/amd/vlek/v1/Genoa/cert?blSPL=0&teeSPL=0&snpSPL=0&ucodeSPL=0"
+	chainURL := "https://kdsintf.amd.com/vcek/v1/Milan/cert_chain"
+	tcs := []struct {
+		err  *trust.HTTPStatusError
+		want error
+	}{
+		{err: &trust.HTTPStatusError{URL: vcekURL, StatusCode: http.StatusNotFound}, want: trust.ErrCertNotYetGenerated},
+		{err: &trust.HTTPStatusError{URL: mirrorVlekURL, StatusCode: http.StatusNotFound}, want: trust.ErrCertNotYetGenerated},
+		{err: &trust.HTTPStatusError{URL: chainURL, StatusCode: http.StatusNotFound}},
+		{err: &trust.HTTPStatusError{URL: vcekURL, StatusCode: http.StatusForbidden}},
+		{err: &trust.HTTPStatusError{URL: chainURL, StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second}, want: trust.ErrRateLimited},
+		{err: &trust.HTTPStatusError{URL: vcekURL, StatusCode: http.StatusBadGateway}, want: trust.ErrServerError},
+	}
+	for _, tc := range tcs {
+		for _, class := range []error{trust.ErrCertNotYetGenerated, trust.ErrRateLimited, trust.ErrServerError} {
+			// Classes survive wrapping, e.g., by RetryHTTPSGetter's combined errors.
+			wrapped := fmt.Errorf("fetch failed: %w", tc.err)
+			if got := errors.Is(wrapped, class); got != (class == tc.want) {
+				t.Errorf("errors.Is(%v, %v) = %t, want %t", tc.err, class, got, class == tc.want)
+			}
+		}
+	}
+}
+
+func TestRetryHTTPSGetterStatusErrors(t *testing.T) {
+	forbidden := &trust.HTTPStatusError{StatusCode: http.StatusForbidden}
+	throttled := &trust.HTTPStatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 50 * time.Millisecond}
+	notMirrored := &trust.HTTPStatusError{URL: "https://mirror.example.com/vcek/v1/Milan/crl", StatusCode: http.StatusNotFound}
+	notGenerated := &trust.HTTPStatusError{URL: "https://kdsintf.amd.com/vcek/v1/Milan/0a0b", StatusCode: http.StatusNotFound}
+	tcs := []struct {
+		name              string
+		errs              []error
+		retryNotGenerated bool
+		wantCalls         int
+		wantErr           bool
+		minTime           time.Duration
+	}{
+		{name: "forbidden is permanent", errs: []error{forbidden}, wantCalls: 1, wantErr: true},
+		{name: "retry after", errs: []error{throttled}, wantCalls: 2, minTime: 50 * time.Millisecond},
+		{name: "any transient error retries", errs: []error{multierr.Combine(notMirrored, &trust.HTTPStatusError{StatusCode: http.StatusServiceUnavailable})}, wantCalls: 2},
+		{name: "not yet generated is permanent", errs: []error{notGenerated}, wantCalls: 1, wantErr: true},
+		{name: "not yet generated retries if asked", errs: []error{notGenerated}, retryNotGenerated: true, wantCalls: 2},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			g := &statusGetter{errs: tc.errs}
+			getter := &trust.RetryHTTPSGetter{Timeout: time.Second, MaxRetryDelay: time.Millisecond, Getter: g,
+				RetryCertNotYetGenerated: tc.retryNotGenerated}
+			start := time.Now()
+			body, err := getter.Get("https://fetch.me")
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Get() = %q, %v. Want error: %t", body, err, tc.wantErr)
+			}
+			if g.calls != tc.wantCalls {
+				t.Errorf("Get() made %d requests, want %d", g.calls, tc.wantCalls)
+			}
+			if elapsed := time.Since(start); elapsed < tc.minTime {
+				t.Errorf("Get() took %v, want at least %v", elapsed, tc.minTime)
+			}
+		})
+	}
+}
+
+func TestNewHTTPSGetterNotFound(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	start := time.Now()
+	_, err := trust.NewHTTPSGetter(server.Client()).Get(server.URL + "/vcek/v1/Milan/0a0b?blSPL=0&teeSPL=0&snpSPL=0&ucodeSPL=0")
+	if !errors.Is(err, trust.ErrCertNotYetGenerated) {
+		t.Errorf("Get() = _, %v, want ErrCertNotYetGenerated", err)
+	}
+	if requests != 1 {
+		t.Errorf("Get() made %d requests, want 1", requests)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Get() took %v, want it to fail without retrying", elapsed)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/kds"
+)
+
+// ErrCertNotStored is returned by a CertStore's Load when it holds no certificate for the key.
+var ErrCertNotStored = errors.New("certificate not stored")
+
+// CertStore persists DER-encoded AMD certificates across verifications, so that repeated
+// verifications need not download the same certificates from the KDS. A store is only a cache:
+// certificates loaded from it are verified like any other.
+type CertStore interface {
+	// Load returns the certificate stored under key, or an error that errors.Is ErrCertNotStored.
+	Load(key string) ([]byte, error)
+	// Store saves the certificate under key, replacing any previous one.
+	Store(key string, der []byte) error
+}
+
+// VcekStoreKey returns the CertStore key of the VCEK certificate for the given chip and TCB. A chip
+// has a VCEK per TCB, so a store holds each of them under its own key, and verification selects
+// the one for the report's reported TCB. Like the KDS, the key only uses the first
+// kds.HWIDSize(productLine) bytes of a longer hwid, e.g., a Turin CHIP_ID.
+func VcekStoreKey(productLine string, hwid []byte, tcb kds.TCBVersion) string {
+	if size := kds.HWIDSize(productLine); len(hwid) > size {
+		hwid = hwid[:size]
+	}
+	return fmt.Sprintf("vcek/%s/%x/%016x", productLine, hwid, uint64(tcb))
+}
+
+// VlekStoreKey returns the CertStore key of the VLEK certificate for the given product line, cloud
+// service provider, and TCB. AMD certifies a VLEK per CSP_ID and TCB, so the VLEKs of several
+// providers do not replace each other.
+func VlekStoreKey(productLine, cspID string, tcb kds.TCBVersion) string {
+	return fmt.Sprintf("vlek/%s/%s/%016x", productLine, url.PathEscape(cspID), uint64(tcb))
+}
+
+func productChainStoreKey(productLine string, s abi.ReportSigner, role string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.ToLower(s.String()), productLine, role)
+}
+
+// AskStoreKey returns the CertStore key of the ASK (or ASVK for VLEK) certificate of a product line.
+func AskStoreKey(productLine string, s abi.ReportSigner) string {
+	return productChainStoreKey(productLine, s, "ask")
+}
+
+// ArkStoreKey returns the CertStore key of the ARK certificate of a product line.
+func ArkStoreKey(productLine string, s abi.ReportSigner) string {
+	return productChainStoreKey(productLine, s, "ark")
+}
+
+// CrlStoreKey returns the CertStore key of the CRL that the KDS serves at
+// kds.CrlLinkByKey(productLine, s).
+func CrlStoreKey(productLine string, s abi.ReportSigner) string {
+	return productChainStoreKey(productLine, s, "crl")
+}
+
+// FileCertStore implements CertStore with one file per certificate under a directory.
+type FileCertStore struct {
+	Dir string
+}
+
+// NewFileCertStore returns a CertStore in dir, creating the directory if needed.
+func NewFileCertStore(dir string) (*FileCertStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create certificate store directory %q: %v", dir, err)
+	}
+	return &FileCertStore{Dir: dir}, nil
+}
+
+// path returns the file that holds key's certificate. Keys are slash-separated and may not escape
+// the store's directory.
+func (s *FileCertStore) path(key string) (string, error) {
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.ContainsRune(part, filepath.Separator) {
+			return "", fmt.Errorf("invalid certificate store key %q", key)
+		}
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+// Load returns the contents of key's file.
+func (s *FileCertStore) Load(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	der, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrCertNotStored, key)
+	}
+	return der, err
+}
+
+// Store writes der to key's file. The write is atomic, so concurrent verifiers sharing the
+// directory never observe a partial certificate.
+func (s *FileCertStore) Store(key string, der []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = f.Write(der)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write certificate %s: %v", key, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// MemoryCertStore implements CertStore in memory, for verifiers that only need certificates to
+// outlive a single verification.
+type MemoryCertStore struct {
+	mu    sync.RWMutex
+	certs map[string][]byte
+}
+
+// Load returns a copy of the certificate stored under key.
+func (s *MemoryCertStore) Load(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	der, ok := s.certs[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCertNotStored, key)
+	}
+	return append([]byte(nil), der...), nil
+}
+
+// Store saves a copy of der under key.
+func (s *MemoryCertStore) Store(key string, der []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.certs == nil {
+		s.certs = make(map[string][]byte)
+	}
+	s.certs[key] = append([]byte(nil), der...)
+	return nil
+}
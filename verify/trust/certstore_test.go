@@ -0,0 +1,77 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust_test
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/verify/trust"
+)
+
+func TestFileCertStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	store, err := trust.NewFileCertStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileCertStore(%q) = _, %v, want nil", dir, err)
+	}
+	key := trust.VcekStoreKey("Milan", []byte{1, 2, 3}, 0x1234)
+	if _, err := store.Load(key); !errors.Is(err, trust.ErrCertNotStored) {
+		t.Errorf("Load(%q) on an empty store = _, %v, want ErrCertNotStored", key, err)
+	}
+	for _, der := range [][]byte{[]byte("first"), []byte("second")} {
+		if err := store.Store(key, der); err != nil {
+			t.Fatalf("Store(%q, %q) = %v, want nil", key, der, err)
+		}
+		got, err := store.Load(key)
+		if err != nil || !bytes.Equal(got, der) {
+			t.Errorf("Load(%q) = %q, %v, want %q, nil", key, got, err, der)
+		}
+	}
+	askKey := trust.AskStoreKey("Milan", abi.VcekReportSigner)
+	if _, err := store.Load(askKey); !errors.Is(err, trust.ErrCertNotStored) {
+		t.Errorf("Load(%q) = _, %v, want ErrCertNotStored", askKey, err)
+	}
+	for _, bad := range []string{"", "../escape", "vcek//x", "vcek/./x"} {
+		if err := store.Store(bad, []byte("x")); err == nil {
+			t.Errorf("Store(%q) = nil, want error", bad)
+		}
+	}
+}
+
+func TestMemoryCertStore(t *testing.T) {
+	store := &trust.MemoryCertStore{}
+	key := trust.VcekStoreKey("Milan", []byte{1, 2, 3}, 0x1234)
+	if _, err := store.Load(key); !errors.Is(err, trust.ErrCertNotStored) {
+		t.Errorf("Load(%q) on an empty store = _, %v, want ErrCertNotStored", key, err)
+	}
+	der := []byte("vcek")
+	if err := store.Store(key, der); err != nil {
+		t.Fatalf("Store(%q, %q) = %v, want nil", key, der, err)
+	}
+	der[0] = 'x'
+	// Each TCB's VCEK is kept separately.
+	other := trust.VcekStoreKey("Milan", []byte{1, 2, 3}, 0x1235)
+	if _, err := store.Load(other); !errors.Is(err, trust.ErrCertNotStored) {
+		t.Errorf("Load(%q) = _, %v, want ErrCertNotStored", other, err)
+	}
+	got, err := store.Load(key)
+	if err != nil || !bytes.Equal(got, []byte("vcek")) {
+		t.Errorf("Load(%q) = %q, %v, want \"vcek\", nil", key, got, err)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrResponseNotCached is returned by an HTTPCache's Load when it holds no response for the URL.
+var ErrResponseNotCached = errors.New("response not cached")
+
+// CachedResponse is a response body with the validators and freshness lifetime of its HTTP
+// headers.
+type CachedResponse struct {
+	// Body is the response body, e.g., a DER-encoded certificate or CRL.
+	Body []byte
+	// ETag is the response's entity tag, sent back in If-None-Match to revalidate.
+	ETag string
+	// LastModified is the response's Last-Modified header, sent back in If-Modified-Since to
+	// revalidate.
+	LastModified string
+	// Expires is when the response stops being fresh according to Cache-Control max-age or the
+	// Expires header. A zero Expires response is revalidated on every use.
+	Expires time.Time
+}
+
+// HTTPCache persists responses by URL for a CachingHTTPSGetter.
+type HTTPCache interface {
+	// Load returns the response cached for url, or an error that errors.Is ErrResponseNotCached.
+	Load(url string) (*CachedResponse, error)
+	// Store saves the response for url, replacing any previous one.
+	Store(url string, response *CachedResponse) error
+}
+
+// MemoryHTTPCache implements HTTPCache in memory.
+type MemoryHTTPCache struct {
+	mu        sync.RWMutex
+	responses map[string]*CachedResponse
+}
+
+// Load returns a copy of the response cached for url.
+func (c *MemoryHTTPCache) Load(url string) (*CachedResponse, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	response, ok := c.responses[url]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrResponseNotCached, url)
+	}
+	result := *response
+	result.Body = append([]byte(nil), response.Body...)
+	return &result, nil
+}
+
+// Store saves a copy of response for url.
+func (c *MemoryHTTPCache) Store(url string, response *CachedResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.responses == nil {
+		c.responses = make(map[string]*CachedResponse)
+	}
+	stored := *response
+	stored.Body = append([]byte(nil), response.Body...)
+	c.responses[url] = &stored
+	return nil
+}
+
+// CachingHTTPSGetter implements the HTTPSGetter interface with HTTP GET requests whose responses
+// it caches according to their Cache-Control, Expires, ETag, and Last-Modified headers. A fresh
+// cached response is returned without a request, and a stale one is revalidated with a
+// conditional request, which the KDS answers with 304 Not Modified instead of the body.
+type CachingHTTPSGetter struct {
+	// Client sends the requests. If nil, uses a client with NewHTTPClient's defaults that all
+	// SimpleHTTPSGetters share.
+	Client *http.Client
+	// Cache holds the responses. If nil, uses a MemoryHTTPCache of this getter.
+	Cache HTTPCache
+	// Now returns the time at which responses are checked for freshness. If nil, uses time.Now.
+	Now func() time.Time
+
+	memory MemoryHTTPCache
+}
+
+func (n *CachingHTTPSGetter) cache() HTTPCache {
+	if n.Cache != nil {
+		return n.Cache
+	}
+	return &n.memory
+}
+
+func (n *CachingHTTPSGetter) now() time.Time {
+	if n.Now != nil {
+		return n.Now()
+	}
+	return time.Now()
+}
+
+// Get returns the cached response body for url if it is fresh, and otherwise sends an HTTP GET
+// request, conditional on the cached response's validators if there is one.
+func (n *CachingHTTPSGetter) Get(url string) ([]byte, error) {
+	return n.GetContext(context.TODO(), url)
+}
+
+// GetContext behaves like Get, but forwards the context to the http package.
+func (n *CachingHTTPSGetter) GetContext(ctx context.Context, url string) ([]byte, error) {
+	cache := n.cache()
+	cached, err := cache.Load(url)
+	if err != nil {
+		if !errors.Is(err, ErrResponseNotCached) {
+			return nil, fmt.Errorf("could not load cached response for %s: %v", url, err)
+		}
+		cached = nil
+	}
+	now := n.now()
+	if cached != nil && now.Before(cached.Expires) {
+		return cached.Body, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	client := n.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response *CachedResponse
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		response = cached
+	case resp.StatusCode >= 300:
+		return nil, &HTTPStatusError{
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), now),
+		}
+	default:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		response = &CachedResponse{
+			Body:         body,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}
+	}
+	expires, store := freshUntil(resp.Header, now)
+	response.Expires = expires
+	if store {
+		if err := cache.Store(url, response); err != nil {
+			return nil, fmt.Errorf("could not cache response for %s: %v", url, err)
+		}
+	}
+	return response.Body, nil
+}
+
+// freshUntil returns when a response with the given headers stops being fresh, and whether it may
+// be stored at all. Cache-Control max-age takes precedence over Expires, and the response's Age
+// counts against its max-age.
+func freshUntil(header http.Header, now time.Time) (time.Time, bool) {
+	maxAge := -1
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store":
+			return time.Time{}, false
+		case "no-cache":
+			return time.Time{}, true
+		case "max-age":
+			if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+				maxAge = seconds
+			}
+		}
+	}
+	if maxAge >= 0 {
+		if age, err := strconv.Atoi(header.Get("Age")); err == nil && age > 0 {
+			maxAge -= age
+		}
+		return now.Add(time.Duration(maxAge) * time.Second), true
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		return expires, true
+	}
+	return time.Time{}, true
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-sev-guest/verify/trust"
+)
+
+func TestCachingHTTPSGetter(t *testing.T) {
+	var requests, revalidations int
+	cacheControl := "max-age=60"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", cacheControl)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidations++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("crl"))
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	getter := &trust.CachingHTTPSGetter{Now: func() time.Time { return now }}
+	get := func(wantRequests, wantRevalidations int) {
+		t.Helper()
+		body, err := getter.Get(server.URL)
+		if err != nil || string(body) != "crl" {
+			t.Fatalf("Get(%q) = %q, %v, want \"crl\", nil", server.URL, body, err)
+		}
+		if requests != wantRequests || revalidations != wantRevalidations {
+			t.Errorf("after Get(%q): %d requests and %d revalidations, want %d and %d",
+				server.URL, requests, revalidations, wantRequests, wantRevalidations)
+		}
+	}
+	get(1, 0)
+	// Fresh for max-age.
+	get(1, 0)
+	now = now.Add(2 * time.Minute)
+	get(2, 1)
+	// The 304 response renewed the freshness.
+	get(2, 1)
+
+	cacheControl = "no-cache"
+	now = now.Add(2 * time.Minute)
+	get(3, 2)
+	get(4, 3)
+}
+
+func TestCachingHTTPSGetterNoStore(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("cert"))
+	}))
+	defer server.Close()
+	cache := &trust.MemoryHTTPCache{}
+	getter := &trust.CachingHTTPSGetter{Cache: cache}
+	for i := 0; i < 2; i++ {
+		if _, err := getter.Get(server.URL); err != nil {
+			t.Fatalf("Get(%q) = _, %v", server.URL, err)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("Get(%q) twice sent %d requests, want 2", server.URL, requests)
+	}
+	if _, err := cache.Load(server.URL); !errors.Is(err, trust.ErrResponseNotCached) {
+		t.Errorf("Load(%q) = _, %v, want %v", server.URL, err, trust.ErrResponseNotCached)
+	}
+}
+
+func TestCachingHTTPSGetterStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	var statusErr *trust.HTTPStatusError
+	if _, err := (&trust.CachingHTTPSGetter{}).Get(server.URL); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Get(%q) = _, %v, want a 404 HTTPStatusError", server.URL, err)
+	}
+}
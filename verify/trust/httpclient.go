@@ -0,0 +1,201 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	defaultMaxIdleConnsPerHost = 4
+	defaultMaxIdleConns        = 64
+)
+
+// defaultHTTPClient is shared by every SimpleHTTPSGetter without a Client, so that their
+// connections to the KDS are pooled.
+var defaultHTTPClient = &http.Client{Transport: newTransport(&HTTPClientOptions{}, nil)}
+
+// HTTPClientOptions configures an HTTP client for fetching certificates and CRLs from the AMD KDS.
+type HTTPClientOptions struct {
+	// RootCAs, if non-nil, replaces the system roots for verifying servers' TLS certificates.
+	RootCAs *x509.CertPool
+	// CABundlePaths are PEM files of CA certificates to trust in addition to RootCAs or the system
+	// roots, e.g., the CA of a corporate TLS-intercepting proxy.
+	CABundlePaths []string
+	// Proxy returns the proxy for a request. If nil, uses the HTTPS_PROXY, HTTP_PROXY, and NO_PROXY
+	// environment variables.
+	Proxy func(*http.Request) (*url.URL, error)
+	// MaxIdleConnsPerHost bounds the idle connections kept for reuse per host. If zero, keeps 4.
+	MaxIdleConnsPerHost int
+	// Timeout bounds each request, including reading its body. If zero, only contexts bound
+	// requests.
+	Timeout time.Duration
+	// ClientCertificates are presented to servers that request a TLS client certificate, e.g., an
+	// authenticating proxy in front of the KDS.
+	ClientCertificates []tls.Certificate
+	// ClientCertPath and ClientKeyPath, if non-empty, are PEM files of a client certificate chain
+	// and its private key to present in addition to ClientCertificates.
+	ClientCertPath string
+	ClientKeyPath  string
+	// Header is added to every request, e.g., an API key.
+	Header http.Header
+	// HeaderFunc, if non-nil, returns headers to add to each request after Header, e.g., a
+	// short-lived bearer token. An error fails the request.
+	HeaderFunc func(*http.Request) (http.Header, error)
+}
+
+// headerTransport adds an HTTPClientOptions' headers to each request.
+type headerTransport struct {
+	base       http.RoundTripper
+	header     http.Header
+	headerFunc func(*http.Request) (http.Header, error)
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper may not modify its request.
+	req = req.Clone(req.Context())
+	for key, values := range t.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if t.headerFunc != nil {
+		header, err := t.headerFunc(req)
+		if err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, fmt.Errorf("could not get request headers for %s: %v", req.URL, err)
+		}
+		for key, values := range header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+func newTransport(opts *HTTPClientOptions, roots *x509.CertPool) *http.Transport {
+	proxy := opts.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	perHost := opts.MaxIdleConnsPerHost
+	if perHost == 0 {
+		perHost = defaultMaxIdleConnsPerHost
+	}
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		// A custom TLS configuration disables HTTP/2 unless it is forced.
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   perHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+	}
+}
+
+// rootPool returns the CA pool that opts describes, or nil for the system roots.
+func rootPool(opts *HTTPClientOptions) (*x509.CertPool, error) {
+	if len(opts.CABundlePaths) == 0 {
+		return opts.RootCAs, nil
+	}
+	pool := opts.RootCAs
+	if pool == nil {
+		var err error
+		pool, err = x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+	} else {
+		pool = pool.Clone()
+	}
+	for _, path := range opts.CABundlePaths {
+		pems, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle %q: %v", path, err)
+		}
+		if !pool.AppendCertsFromPEM(pems) {
+			return nil, fmt.Errorf("CA bundle %q has no PEM certificates", path)
+		}
+	}
+	return pool, nil
+}
+
+// NewHTTPClient returns an HTTP client that pools connections, uses HTTP/2 when the server
+// supports it, and follows opts' proxy, CA, client certificate, and header settings. If opts is
+// nil, uses the defaults.
+func NewHTTPClient(opts *HTTPClientOptions) (*http.Client, error) {
+	if opts == nil {
+		opts = &HTTPClientOptions{}
+	}
+	roots, err := rootPool(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport := newTransport(opts, roots)
+	certs := append([]tls.Certificate(nil), opts.ClientCertificates...)
+	if opts.ClientCertPath != "" || opts.ClientKeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertPath, opts.ClientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not load TLS client certificate %q with key %q: %v",
+				opts.ClientCertPath, opts.ClientKeyPath, err)
+		}
+		certs = append(certs, cert)
+	}
+	transport.TLSClientConfig.Certificates = certs
+	var rt http.RoundTripper = transport
+	if len(opts.Header) != 0 || opts.HeaderFunc != nil {
+		rt = &headerTransport{base: transport, header: opts.Header.Clone(), headerFunc: opts.HeaderFunc}
+	}
+	return &http.Client{Transport: rt, Timeout: opts.Timeout}, nil
+}
+
+// NewHTTPSGetter returns a getter that fetches with client and retries like DefaultHTTPSGetter.
+func NewHTTPSGetter(client *http.Client) HTTPSGetter {
+	return &RetryHTTPSGetter{
+		Timeout:       2 * time.Minute,
+		MaxRetryDelay: 30 * time.Second,
+		Getter:        &SimpleHTTPSGetter{Client: client},
+	}
+}
+
+// NewMirrorHTTPSGetter returns a getter that fetches AMD KDS URLs from each of mirrors in order and
+// then from the AMD KDS itself, with client, and retries like DefaultHTTPSGetter when all fail.
+func NewMirrorHTTPSGetter(client *http.Client, mirrors []string) HTTPSGetter {
+	return &RetryHTTPSGetter{
+		Timeout:       2 * time.Minute,
+		MaxRetryDelay: 30 * time.Second,
+		Getter: &MirrorHTTPSGetter{
+			Mirrors:       mirrors,
+			FallbackToKDS: true,
+			Getter:        &SimpleHTTPSGetter{Client: client},
+		},
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	test "github.com/google/go-sev-guest/testing"
+	"github.com/google/go-sev-guest/verify/trust"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := trust.NewHTTPClient(&trust.HTTPClientOptions{CABundlePaths: []string{bundle}})
+	if err != nil {
+		t.Fatalf("NewHTTPClient() = _, %v, want nil", err)
+	}
+	getter := &trust.SimpleHTTPSGetter{Client: client}
+	got, err := getter.GetContext(context.Background(), server.URL)
+	if err != nil || string(got) != "body" {
+		t.Errorf("GetContext(%q) with the server's CA = %q, %v, want \"body\", nil", server.URL, got, err)
+	}
+
+	client, err = trust.NewHTTPClient(nil)
+	if err != nil {
+		t.Fatalf("NewHTTPClient(nil) = _, %v, want nil", err)
+	}
+	getter = &trust.SimpleHTTPSGetter{Client: client}
+	if _, err := getter.GetContext(context.Background(), server.URL); err == nil {
+		t.Errorf("GetContext(%q) without the server's CA = nil, want a TLS error", server.URL)
+	}
+
+	for _, path := range []string{filepath.Join(t.TempDir(), "missing.pem"), filepath.Join(t.TempDir())} {
+		if _, err := trust.NewHTTPClient(&trust.HTTPClientOptions{CABundlePaths: []string{path}}); err == nil {
+			t.Errorf("NewHTTPClient() with CA bundle %q = _, nil, want error", path)
+		}
+	}
+}
+
+func TestNewHTTPClientAuthentication(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.Header.Get("X-Api-Key") != "key" || r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens int
+	opts := &trust.HTTPClientOptions{
+		CABundlePaths:  []string{bundle},
+		ClientCertPath: certPath,
+		ClientKeyPath:  keyPath,
+		Header:         http.Header{"X-Api-Key": []string{"key"}},
+		HeaderFunc: func(*http.Request) (http.Header, error) {
+			tokens++
+			return http.Header{"Authorization": []string{fmt.Sprintf("Bearer %d", tokens)}}, nil
+		},
+	}
+	client, err := trust.NewHTTPClient(opts)
+	if err != nil {
+		t.Fatalf("NewHTTPClient() = _, %v, want nil", err)
+	}
+	getter := &trust.SimpleHTTPSGetter{Client: client}
+	for _, want := range []string{"Bearer 1", "Bearer 2"} {
+		if got, err := getter.Get(server.URL); err != nil || string(got) != want {
+			t.Errorf("Get(%q) with credentials = %q, %v, want %q, nil", server.URL, got, err, want)
+		}
+	}
+
+	opts.HeaderFunc = func(*http.Request) (http.Header, error) { return nil, errors.New("token expired") }
+	if client, err = trust.NewHTTPClient(opts); err != nil {
+		t.Fatalf("NewHTTPClient() = _, %v, want nil", err)
+	}
+	if _, err := (&trust.SimpleHTTPSGetter{Client: client}).Get(server.URL); !test.Match(err, "token expired") {
+		t.Errorf("Get(%q) with a failing HeaderFunc = _, %v, want the HeaderFunc's error", server.URL, err)
+	}
+	opts.HeaderFunc = nil
+	opts.ClientCertPath, opts.ClientKeyPath = "", ""
+	if client, err = trust.NewHTTPClient(opts); err != nil {
+		t.Fatalf("NewHTTPClient() = _, %v, want nil", err)
+	}
+	if _, err := (&trust.SimpleHTTPSGetter{Client: client}).Get(server.URL); err == nil {
+		t.Errorf("Get(%q) without a client certificate = _, nil, want a TLS error", server.URL)
+	}
+	opts.ClientKeyPath = filepath.Join(dir, "missing.key")
+	if _, err := trust.NewHTTPClient(opts); !test.Match(err, "could not load TLS client certificate") {
+		t.Errorf("NewHTTPClient() with a missing key = _, %v, want a load error", err)
+	}
+}
+
+func TestVLEKHTTPSGetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Csp-Secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("vlek"))
+	}))
+	defer server.Close()
+	client, err := trust.NewHTTPClient(&trust.HTTPClientOptions{Header: http.Header{"X-Csp-Secret": []string{"secret"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := (&trust.VLEKHTTPSGetter{Client: client}).Get(server.URL); err != nil || string(got) != "vlek" {
+		t.Errorf("Get(%q) with the CSP secret = %q, %v, want \"vlek\", nil", server.URL, got, err)
+	}
+	if _, err := (&trust.VLEKHTTPSGetter{Client: http.DefaultClient}).Get(server.URL); err == nil {
+		t.Errorf("Get(%q) without the CSP secret = _, nil, want an HTTP status error", server.URL)
+	}
+	if _, err := (&trust.VLEKHTTPSGetter{}).Get(server.URL); !test.Match(err, "no Client") {
+		t.Errorf("Get(%q) without a Client = _, %v, want an error for the missing Client", server.URL, err)
+	}
+}
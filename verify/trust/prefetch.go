@@ -0,0 +1,241 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+	"github.com/google/go-sev-guest/kds"
+	"go.uber.org/multierr"
+)
+
+const defaultPrefetchWorkers = 4
+
+// VcekRequest identifies the VCEK certificate of one chip at one TCB.
+type VcekRequest struct {
+	// ProductLine is the chip's KDS product line, e.g., "Milan".
+	ProductLine string
+	// ChipID is the CHIP_ID of the chip's attestation reports, or for Turin, just the first
+	// kds.TurinHWIDSize bytes of it that the KDS identifies the chip by.
+	ChipID []byte
+	// TCB is the reported TCB of the attestation reports to verify.
+	TCB kds.TCBVersion
+}
+
+// PrefetchOptions configures PrefetchVceks.
+type PrefetchOptions struct {
+	// Getter fetches the certificates. If nil, uses DefaultHTTPSGetter.
+	Getter HTTPSGetter
+	// Workers is the maximum number of concurrent KDS requests. If not positive, uses 4.
+	Workers int
+	// RequestInterval is the minimum time between the starts of two KDS requests, to stay below
+	// the KDS's rate limit. If zero, requests are only limited by Workers.
+	RequestInterval time.Duration
+	// Refetch if true, fetches certificates that the store already holds.
+	Refetch bool
+	// CRLs if true, also fetches the VCEK CRL of each product line, e.g., for a Server mirror of
+	// the KDS in the kds/mirror package to serve.
+	CRLs bool
+}
+
+// rateLimiter lets one caller through per interval.
+type rateLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+}
+
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+	timer := time.NewTimer(start.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// prefetcher holds the state that a PrefetchVceks call's workers share.
+type prefetcher struct {
+	getter  HTTPSGetter
+	store   CertStore
+	limiter *rateLimiter
+	refetch bool
+	crls    bool
+}
+
+func (p *prefetcher) stored(key string) bool {
+	if p.refetch {
+		return false
+	}
+	_, err := p.store.Load(key)
+	return err == nil
+}
+
+// productChain stores the ASK and ARK certificates of productLine.
+func (p *prefetcher) productChain(ctx context.Context, productLine string) error {
+	askKey := AskStoreKey(productLine, abi.VcekReportSigner)
+	arkKey := ArkStoreKey(productLine, abi.VcekReportSigner)
+	if p.stored(askKey) && p.stored(arkKey) {
+		return nil
+	}
+	if err := p.limiter.wait(ctx); err != nil {
+		return err
+	}
+	url := kds.ProductCertChainURL(abi.VcekReportSigner, productLine)
+	askark, err := GetWith(ctx, p.getter, url)
+	if err != nil {
+		return fmt.Errorf("could not download %s ASK and ARK certificates: %v", productLine, err)
+	}
+	chain, err := kds.ParseProductCertChainFor(productLine, abi.VcekReportSigner, askark)
+	if err != nil {
+		return fmt.Errorf("could not parse %s cert_chain: %v", productLine, err)
+	}
+	if err := p.store.Store(askKey, chain.Ask.Raw); err != nil {
+		return err
+	}
+	return p.store.Store(arkKey, chain.Ark.Raw)
+}
+
+// crl stores the VCEK CRL of productLine. CRLs change, so it is always fetched again.
+func (p *prefetcher) crl(ctx context.Context, productLine string) error {
+	if err := p.limiter.wait(ctx); err != nil {
+		return err
+	}
+	der, err := GetWith(ctx, p.getter, kds.CrlLinkByKey(productLine, abi.VcekReportSigner))
+	if err != nil {
+		return fmt.Errorf("could not download %s CRL: %v", productLine, err)
+	}
+	if _, err := x509.ParseRevocationList(der); err != nil {
+		return fmt.Errorf("could not parse %s CRL: %v", productLine, err)
+	}
+	return p.store.Store(CrlStoreKey(productLine, abi.VcekReportSigner), der)
+}
+
+// vcek stores the VCEK certificate that req identifies.
+func (p *prefetcher) vcek(ctx context.Context, req VcekRequest) error {
+	size := kds.HWIDSize(req.ProductLine)
+	if len(req.ChipID) != abi.ChipIDSize && len(req.ChipID) != size {
+		return fmt.Errorf("chip ID is %d bytes, want %d", len(req.ChipID), abi.ChipIDSize)
+	}
+	key := VcekStoreKey(req.ProductLine, req.ChipID, req.TCB)
+	if p.stored(key) {
+		return nil
+	}
+	if err := p.limiter.wait(ctx); err != nil {
+		return err
+	}
+	der, err := GetWith(ctx, p.getter, kds.VCEKCertURL(req.ProductLine, req.ChipID, req.TCB))
+	if err != nil {
+		return fmt.Errorf("could not download VCEK certificate: %v", err)
+	}
+	cert, err := ParseCert(der)
+	if err != nil {
+		return fmt.Errorf("could not parse VCEK certificate: %v", err)
+	}
+	exts, err := kds.VcekCertificateExtensions(cert)
+	if err != nil {
+		return fmt.Errorf("could not get VCEK certificate extensions: %v", err)
+	}
+	if !bytes.Equal(exts.HWID, req.ChipID[:size]) || exts.TCBVersion != req.TCB {
+		return fmt.Errorf("KDS returned the VCEK certificate of HWID %x at TCB 0x%x", exts.HWID, uint64(exts.TCBVersion))
+	}
+	return p.store.Store(key, cert.Raw)
+}
+
+// PrefetchVceks fetches the VCEK certificate of every request from the KDS into store, along with
+// the ASK and ARK certificates of each product line, so that verifiers with Options.CertStore set
+// to store can verify the chips' attestation reports without network access, e.g., to provision a
+// fleet's certificates before a maintenance window. Certificates that store already holds are not
+// fetched again unless opts.Refetch is set. A failed request does not stop the others. The returned
+// error combines the failures, each naming its chip and TCB.
+func PrefetchVceks(ctx context.Context, requests []VcekRequest, store CertStore, opts *PrefetchOptions) error {
+	if store == nil {
+		return errors.New("no certificate store to prefetch into")
+	}
+	if opts == nil {
+		opts = &PrefetchOptions{}
+	}
+	p := &prefetcher{
+		getter:  opts.Getter,
+		store:   store,
+		limiter: &rateLimiter{interval: opts.RequestInterval},
+		refetch: opts.Refetch,
+		crls:    opts.CRLs,
+	}
+	if p.getter == nil {
+		p.getter = DefaultHTTPSGetter()
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultPrefetchWorkers
+	}
+
+	var errs error
+	productLines := map[string]bool{}
+	for _, req := range requests {
+		if productLines[req.ProductLine] {
+			continue
+		}
+		productLines[req.ProductLine] = true
+		errs = multierr.Append(errs, p.productChain(ctx, req.ProductLine))
+		if p.crls {
+			errs = multierr.Append(errs, p.crl(ctx, req.ProductLine))
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	indices := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				req := requests[i]
+				if err := p.vcek(ctx, req); err != nil {
+					mu.Lock()
+					errs = multierr.Append(errs, fmt.Errorf("%s chip %x at TCB 0x%x: %v", req.ProductLine, req.ChipID, uint64(req.TCB), err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range requests {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return errs
+}
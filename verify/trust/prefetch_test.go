@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust_test
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-sev-guest/abi"
+	test "github.com/google/go-sev-guest/testing"
+	"github.com/google/go-sev-guest/verify/trust"
+)
+
+type countingGetter struct {
+	getter trust.HTTPSGetter
+	calls  atomic.Int32
+}
+
+func (c *countingGetter) Get(url string) ([]byte, error) {
+	c.calls.Add(1)
+	return c.getter.Get(url)
+}
+
+func TestPrefetchVceks(t *testing.T) {
+	signer, err := test.DefaultTestOnlyCertChain("Milan-B1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeKDS, err := test.FakeKDSFromSigner(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getter := &countingGetter{getter: fakeKDS}
+	store := &trust.MemoryCertStore{}
+	chipID := signer.HWID[:]
+	requests := []trust.VcekRequest{
+		{ProductLine: "Milan", ChipID: chipID, TCB: signer.TCB},
+		{ProductLine: "Milan", ChipID: chipID, TCB: signer.TCB},
+	}
+	opts := &trust.PrefetchOptions{Getter: getter, Workers: 2, RequestInterval: time.Millisecond}
+	if err := trust.PrefetchVceks(context.Background(), requests, store, opts); err != nil {
+		t.Fatalf("PrefetchVceks() = %v, want nil", err)
+	}
+	for key, want := range map[string][]byte{
+		trust.VcekStoreKey("Milan", chipID, signer.TCB):  signer.Vcek.Raw,
+		trust.AskStoreKey("Milan", abi.VcekReportSigner): signer.Ask.Raw,
+		trust.ArkStoreKey("Milan", abi.VcekReportSigner): signer.Ark.Raw,
+	} {
+		if got, err := store.Load(key); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("store.Load(%q) = %v, %v, want the fake KDS's certificate", key, got, err)
+		}
+	}
+
+	calls := getter.calls.Load()
+	if err := trust.PrefetchVceks(context.Background(), requests[:1], store, opts); err != nil {
+		t.Fatalf("PrefetchVceks() again = %v, want nil", err)
+	}
+	if got := getter.calls.Load(); got != calls {
+		t.Errorf("PrefetchVceks() of stored certificates made %d requests, want 0", got-calls)
+	}
+
+	bad := []trust.VcekRequest{
+		{ProductLine: "Milan", ChipID: chipID, TCB: signer.TCB + 1},
+		{ProductLine: "Milan", ChipID: chipID[:8], TCB: signer.TCB},
+	}
+	err = trust.PrefetchVceks(context.Background(), bad, store, opts)
+	for _, want := range []string{"bad TCB", "chip ID is 8 bytes, want 64"} {
+		if !test.Match(err, want) {
+			t.Errorf("PrefetchVceks(%v) = %v, want error containing %q", bad, err, want)
+		}
+	}
+}
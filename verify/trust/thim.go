@@ -0,0 +1,185 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/go-sev-guest/kds"
+)
+
+// DefaultTHIMURL is the Azure Instance Metadata Service endpoint of Trusted Hardware Identity
+// Management (THIM), which serves the VCEK certificate of the VM's own chip.
+const DefaultTHIMURL = "http://169.254.169.254/metadata/THIM/amd/certification"
+
+// thimCertification is THIM's response to a certification request.
+type thimCertification struct {
+	VcekCert         string `json:"vcekCert"`
+	Tcbm             string `json:"tcbm"`
+	CertificateChain string `json:"certificateChain"`
+}
+
+// THIMGetter implements HTTPSGetter by answering AMD KDS requests for VCEK certificates and the
+// VCEK certificate chain from Azure THIM, so that Azure confidential VMs need no connection to the
+// KDS. THIM only certifies its VM's chip at the TCB that THIM reports. Other requests, including
+// CRLs, and requests while THIM is unreachable go to Fallback. Use a THIMGetter as
+// verify.Options.Getter.
+type THIMGetter struct {
+	// URL is the THIM certification endpoint. If empty, uses DefaultTHIMURL.
+	URL string
+	// Client sends THIM requests. If nil, uses http.DefaultClient.
+	Client *http.Client
+	// Fallback gets every URL that THIM cannot serve. If nil, those requests fail.
+	Fallback HTTPSGetter
+}
+
+// Get returns the body of the KDS URL from THIM if it can, or else from Fallback.
+func (g *THIMGetter) Get(url string) ([]byte, error) {
+	return g.GetContext(context.TODO(), url)
+}
+
+// GetContext behaves like Get but forwards the context to the THIM request and Fallback.
+func (g *THIMGetter) GetContext(ctx context.Context, url string) ([]byte, error) {
+	if productLine, function, err := kds.ParseProductCertChainURL(url); err == nil && function == kds.VcekCertFunction {
+		cert, err := g.certification(ctx)
+		if err != nil {
+			return g.fallback(ctx, url, err)
+		}
+		if err := checkTHIMChain(cert, productLine); err != nil {
+			return g.fallback(ctx, url, err)
+		}
+		return []byte(cert.CertificateChain), nil
+	}
+	if vcek, err := kds.ParseVCEKCertURL(url); err == nil {
+		cert, err := g.certification(ctx)
+		if err != nil {
+			return g.fallback(ctx, url, err)
+		}
+		der, err := thimVcek(cert, vcek)
+		if err != nil {
+			return g.fallback(ctx, url, err)
+		}
+		return der, nil
+	}
+	return g.fallback(ctx, url, fmt.Errorf("THIM does not serve %s", url))
+}
+
+// ReportedTCB returns the TCB version at which THIM certifies the VM's chip.
+func (g *THIMGetter) ReportedTCB(ctx context.Context) (kds.TCBVersion, error) {
+	cert, err := g.certification(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return parseTcbm(cert.Tcbm)
+}
+
+func (g *THIMGetter) fallback(ctx context.Context, url string, reason error) ([]byte, error) {
+	if g.Fallback == nil {
+		return nil, reason
+	}
+	return GetWith(ctx, g.Fallback, url)
+}
+
+func (g *THIMGetter) certification(ctx context.Context) (*thimCertification, error) {
+	url := g.URL
+	if url == "" {
+		url = DefaultTHIMURL
+	}
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach THIM: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, &HTTPStatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	result := &thimCertification{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf("could not parse THIM response: %v", err)
+	}
+	return result, nil
+}
+
+func parseTcbm(tcbm string) (kds.TCBVersion, error) {
+	tcb, err := strconv.ParseUint(tcbm, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("THIM tcbm %q is not a 64-bit hex number: %v", tcbm, err)
+	}
+	return kds.TCBVersion(tcb), nil
+}
+
+// thimVcek returns the THIM VCEK certificate in DER if it is the one the KDS URL requests.
+func thimVcek(cert *thimCertification, want kds.VCEKCert) ([]byte, error) {
+	tcb, err := parseTcbm(cert.Tcbm)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(tcb) != want.TCB {
+		return nil, fmt.Errorf("THIM certifies TCB %016x, not the requested %016x", uint64(tcb), want.TCB)
+	}
+	block, _ := pem.Decode([]byte(cert.VcekCert))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("THIM VCEK certificate is not a PEM certificate")
+	}
+	x, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse THIM VCEK certificate: %v", err)
+	}
+	exts, err := kds.VcekCertificateExtensions(x)
+	if err != nil {
+		return nil, fmt.Errorf("could not read THIM VCEK certificate extensions: %v", err)
+	}
+	if !bytes.Equal(exts.HWID, want.HWID) {
+		return nil, fmt.Errorf("THIM certifies chip %x, not the requested %x", exts.HWID, want.HWID)
+	}
+	return block.Bytes, nil
+}
+
+// checkTHIMChain returns an error if THIM's certificate chain is not the productLine's.
+func checkTHIMChain(cert *thimCertification, productLine string) error {
+	_, ark, err := kds.ParseProductCertChain([]byte(cert.CertificateChain))
+	if err != nil {
+		return fmt.Errorf("could not parse THIM certificate chain: %v", err)
+	}
+	x, err := x509.ParseCertificate(ark)
+	if err != nil {
+		return fmt.Errorf("could not parse THIM ARK certificate: %v", err)
+	}
+	if want := "ARK-" + productLine; x.Subject.CommonName != want {
+		return fmt.Errorf("THIM certificate chain is for %s, not %s", x.Subject.CommonName, want)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-sev-guest/verify/testdata"
+	"github.com/google/go-sev-guest/verify/trust"
+)
+
+const testVcekURL = "https://kdsintf.amd.com/vcek/v1/Milan/3ac3fe21e13fb0990eb28a802e3fb6a29483a6b0753590c951bdd3b8e53786184ca39e359669a2b76a1936776b564ea464cdce40c05f63c9b610c5068b006b5d?blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68"
+
+func TestTHIMGetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"vcekCert":         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testdata.VcekBytes})),
+			"tcbm":             "4405000000000002",
+			"certificateChain": string(trust.AskArkMilanVcekBytes),
+		})
+	}))
+	defer server.Close()
+	fallback := &recordingGetter{}
+	getter := &trust.THIMGetter{URL: server.URL, Fallback: fallback}
+
+	vcek, err := getter.Get(testVcekURL)
+	if err != nil || !bytes.Equal(vcek, testdata.VcekBytes) {
+		t.Errorf("Get(%q) = %v, %v, want the THIM VCEK", testVcekURL, vcek, err)
+	}
+	chainURL := "https://kdsintf.amd.com/vcek/v1/Milan/cert_chain"
+	chain, err := getter.Get(chainURL)
+	if err != nil || !bytes.Equal(chain, trust.AskArkMilanVcekBytes) {
+		t.Errorf("Get(%q) = %v, %v, want the THIM certificate chain", chainURL, chain, err)
+	}
+	tcb, err := getter.ReportedTCB(context.Background())
+	if err != nil || tcb != 0x4405000000000002 {
+		t.Errorf("ReportedTCB() = %x, %v, want 4405000000000002, nil", tcb, err)
+	}
+	if fallback.getCalls != 0 {
+		t.Errorf("THIM requests used the fallback %d times, want 0", fallback.getCalls)
+	}
+	for _, url := range []string{
+		"https://kdsintf.amd.com/vcek/v1/Milan/crl",
+		"https://kdsintf.amd.com/vcek/v1/Genoa/cert_chain",
+		"https://kdsintf.amd.com/vcek/v1/Milan/3ac3fe21e13fb0990eb28a802e3fb6a29483a6b0753590c951bdd3b8e53786184ca39e359669a2b76a1936776b564ea464cdce40c05f63c9b610c5068b006b5d?blSPL=3&teeSPL=0&snpSPL=5&ucodeSPL=68",
+	} {
+		fallback.getCalls = 0
+		if _, err := getter.Get(url); err != nil || fallback.getCalls != 1 {
+			t.Errorf("Get(%q) = _, %v with %d fallback requests, want nil with 1", url, err, fallback.getCalls)
+		}
+	}
+	if _, err := (&trust.THIMGetter{URL: server.URL}).Get("https://kdsintf.amd.com/vcek/v1/Milan/crl"); err == nil {
+		t.Error("Get() of a CRL without a fallback = nil, want error")
+	}
+}
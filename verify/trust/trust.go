@@ -20,6 +20,7 @@ import (
 	"crypto/x509"
 	_ "embed"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -65,7 +66,7 @@ var (
 	AskArkTurinVcekBytes []byte
 
 	// AskArkTurinVlekBytes is a CA bundle for VLEK certs on Turin.
-	// source: https://kdsintf.amd.com/vcek/v1/Turin/cert_chain
+	// source: https://kdsintf.amd.com/vlek/v1/Turin/cert_chain
 	//go:embed ask_ark_turin_vlek.pem
 	AskArkTurinVlekBytes []byte
 
@@ -136,12 +137,30 @@ type ContextHTTPSGetter interface {
 }
 
 // GetWith gets a resource from a URL using an HTTPSGetter.
-// If the HTTPSGetter implements ContextHTTPSGetter, the GetContext method will be used.
+// If the HTTPSGetter implements ContextHTTPSGetter, the GetContext method will be used. Otherwise
+// GetWith stops waiting for Get when ctx is done, though Get itself cannot be interrupted.
 func GetWith(ctx context.Context, getter HTTPSGetter, url string) ([]byte, error) {
 	if contextGetter, ok := getter.(ContextHTTPSGetter); ok {
 		return contextGetter.GetContext(ctx, url)
 	}
-	return getter.Get(url)
+	if ctx.Done() == nil {
+		return getter.Get(url)
+	}
+	type response struct {
+		body []byte
+		err  error
+	}
+	done := make(chan response, 1)
+	go func() {
+		body, err := getter.Get(url)
+		done <- response{body, err}
+	}()
+	select {
+	case r := <-done:
+		return r.body, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 // AttestationRecreationErr represents a problem with fetching or interpreting associated
@@ -154,25 +173,71 @@ func (e *AttestationRecreationErr) Error() string {
 	return e.Msg
 }
 
-// SimpleHTTPSGetter implements the HTTPSGetter interface with http.Get.
-type SimpleHTTPSGetter struct{}
+// SimpleHTTPSGetter implements the HTTPSGetter interface with HTTP GET requests.
+type SimpleHTTPSGetter struct {
+	// Client sends the requests. If nil, uses a client with NewHTTPClient's defaults that all
+	// SimpleHTTPSGetters share.
+	Client *http.Client
+}
 
-// Get uses http.Get to return the HTTPS response body as a byte array.
+// Get sends an HTTP GET request to return the HTTPS response body as a byte array.
 func (n *SimpleHTTPSGetter) Get(url string) ([]byte, error) {
 	return n.GetContext(context.TODO(), url)
 }
 
 // GetContext behaves like get, but forwards the context to the http package.
 func (n *SimpleHTTPSGetter) GetContext(ctx context.Context, url string) ([]byte, error) {
+	return getHTTPS(ctx, n.Client, url, nil)
+}
+
+// VLEKHTTPSGetter implements the HTTPSGetter interface with HTTP GET requests that carry a cloud
+// service provider's (CSP) credentials. The KDS only serves a VLEK certificate to the CSP whose
+// CSP_ID it certifies, so requests for kds.VLEKCertURL need a VLEKHTTPSGetter.
+type VLEKHTTPSGetter struct {
+	// Client sends the requests with the CSP's credentials, e.g., from NewHTTPClient with the
+	// authentication header that AMD issued along with the CSP_ID as HTTPClientOptions.Header.
+	// Required, since a client without the credentials cannot fetch VLEK certificates.
+	Client *http.Client
+}
+
+// Get sends an HTTP GET request with the CSP's credentials to return the HTTPS response body as a
+// byte array.
+func (n *VLEKHTTPSGetter) Get(url string) ([]byte, error) {
+	return n.GetContext(context.TODO(), url)
+}
+
+// GetContext behaves like get, but forwards the context to the http package.
+func (n *VLEKHTTPSGetter) GetContext(ctx context.Context, url string) ([]byte, error) {
+	if n.Client == nil {
+		return nil, errors.New("VLEKHTTPSGetter has no Client with the CSP's credentials")
+	}
+	return getHTTPS(ctx, n.Client, url, nil)
+}
+
+// getHTTPS sends an HTTP GET request with the given headers to return the response body.
+func getHTTPS(ctx context.Context, client *http.Client, url string, header http.Header) ([]byte, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	} else if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("failed to retrieve '%s' status %d", url, resp.StatusCode)
+		resp.Body.Close()
+		return nil, &HTTPStatusError{
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -183,7 +248,54 @@ func (n *SimpleHTTPSGetter) GetContext(ctx context.Context, url string) ([]byte,
 	return body, nil
 }
 
-// RetryHTTPSGetter is a meta-HTTPS getter that will retry on failure a given number of times.
+// MirrorHTTPSGetter is a meta-HTTPS getter that fetches AMD KDS URLs from mirrors of the KDS, e.g.,
+// an enterprise's internal certificate mirror or a regional cache. Other URLs are fetched as is.
+type MirrorHTTPSGetter struct {
+	// Mirrors are the base URLs of the KDS mirrors in the order to try them, e.g.,
+	// "https://kds-mirror.example.com/amd". Each must serve the KDS's paths below its base URL.
+	Mirrors []string
+	// FallbackToKDS if true, fetches from the AMD KDS itself when every mirror fails.
+	FallbackToKDS bool
+	// Getter fetches each URL.
+	Getter HTTPSGetter
+}
+
+// Get fetches the body of the URL from the first mirror that serves it.
+func (n *MirrorHTTPSGetter) Get(url string) ([]byte, error) {
+	return n.GetContext(context.TODO(), url)
+}
+
+// GetContext behaves like Get, but forwards the context to the Getter.
+func (n *MirrorHTTPSGetter) GetContext(ctx context.Context, url string) ([]byte, error) {
+	var errs error
+	for _, mirror := range n.Mirrors {
+		mirrorURL, err := kds.RebaseURL(url, mirror)
+		if err != nil {
+			// Not a KDS URL, so no mirror serves it.
+			return GetWith(ctx, n.Getter, url)
+		}
+		body, err := GetWith(ctx, n.Getter, mirrorURL)
+		if err == nil {
+			return body, nil
+		}
+		errs = multierr.Append(errs, err)
+		if ctx.Err() != nil {
+			return nil, errs
+		}
+	}
+	if n.FallbackToKDS || len(n.Mirrors) == 0 {
+		body, err := GetWith(ctx, n.Getter, url)
+		if err == nil {
+			return body, nil
+		}
+		errs = multierr.Append(errs, err)
+	}
+	return nil, errs
+}
+
+// RetryHTTPSGetter is a meta-HTTPS getter that will retry on failure until its timeout. It waits at
+// least as long as a rate-limiting server asks, and fails without retrying on client errors that a
+// later request cannot fix, e.g., 403 Forbidden.
 type RetryHTTPSGetter struct {
 	// Timeout is how long to retry before failure.
 	// If Timeout is zero, the Get method will retry indefinitely and the GetContext method will
@@ -193,6 +305,9 @@ type RetryHTTPSGetter struct {
 	MaxRetryDelay time.Duration
 	// Getter is the non-retrying way of getting a URL.
 	Getter HTTPSGetter
+	// RetryCertNotYetGenerated if true, also retries ErrCertNotYetGenerated failures until the
+	// timeout, e.g., to wait for the KDS to generate the certificate of a freshly updated TCB.
+	RetryCertNotYetGenerated bool
 }
 
 // Get fetches the body of the URL, retrying a given amount of times on failure.
@@ -220,11 +335,20 @@ func (n *RetryHTTPSGetter) GetContext(ctx context.Context, url string) ([]byte,
 		if delay > n.MaxRetryDelay {
 			delay = n.MaxRetryDelay
 		}
+		wait := delay
+		permanent, retryAfter := retryAdvice(err, n.RetryCertNotYetGenerated)
+		if permanent {
+			cancel()
+			return nil, returnedError
+		}
+		if retryAfter > wait {
+			wait = retryAfter
+		}
 		select {
 		case <-ctx.Done():
 			cancel()
 			return nil, multierr.Append(returnedError, ctx.Err())
-		case <-time.After(delay): // wait to retry
+		case <-time.After(wait): // wait to retry
 		}
 	}
 }
@@ -232,11 +356,7 @@ func (n *RetryHTTPSGetter) GetContext(ctx context.Context, url string) ([]byte,
 // DefaultHTTPSGetter returns the library's default getter implementation. It will
 // retry slowly due to the AMD KDS's rate limiting.
 func DefaultHTTPSGetter() HTTPSGetter {
-	return &RetryHTTPSGetter{
-		Timeout:       2 * time.Minute,
-		MaxRetryDelay: 30 * time.Second,
-		Getter:        &SimpleHTTPSGetter{},
-	}
+	return NewHTTPSGetter(nil)
 }
 
 // Unmarshal populates ASK and ARK certificates from AMD SEV format certificates in data.
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -243,7 +244,23 @@ func TestGetWith(t *testing.T) {
 			t.Errorf("wrong number of calls to Get: got %d, want 0", contextGetter.getCalls)
 		}
 	})
+	t.Run("HTTPSGetter stops waiting when context is done", func(t *testing.T) {
+		unblock := make(chan struct{})
+		defer close(unblock)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := trust.GetWith(ctx, hangingGetter(unblock), url); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("trust.GetWith() with a hung getter = _, %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
 
+// hangingGetter blocks in Get until it is closed.
+type hangingGetter chan struct{}
+
+func (h hangingGetter) Get(string) ([]byte, error) {
+	<-h
+	return nil, errors.New("unblocked")
 }
 
 // Ensure that the HTTPSGetters implement the expected interfaces.
@@ -252,4 +269,73 @@ var (
 	_ = trust.HTTPSGetter(&trust.RetryHTTPSGetter{})
 	_ = trust.ContextHTTPSGetter(&trust.SimpleHTTPSGetter{})
 	_ = trust.ContextHTTPSGetter(&trust.RetryHTTPSGetter{})
+	_ = trust.ContextHTTPSGetter(&trust.BackoffHTTPSGetter{})
 )
+
+type urlGetter struct {
+	urls  []string
+	serve map[string][]byte
+}
+
+func (r *urlGetter) Get(url string) ([]byte, error) {
+	r.urls = append(r.urls, url)
+	if body, ok := r.serve[url]; ok {
+		return body, nil
+	}
+	return nil, fmt.Errorf("%s not found", url)
+}
+
+func TestMirrorHTTPSGetter(t *testing.T) {
+	const kdsURL = "https://kdsintf.amd.com/vcek/v1/Milan/cert_chain"
+	mirrors := []string{"https://down.example.com", "https://up.example.com/amd"}
+	tcs := []struct {
+		name     string
+		serve    map[string][]byte
+		fallback bool
+		url      string
+		want     string
+		wantURLs []string
+	}{
+		{
+			name:     "second mirror",
+			serve:    map[string][]byte{"https://up.example.com/amd/vcek/v1/Milan/cert_chain": []byte("mirror")},
+			url:      kdsURL,
+			want:     "mirror",
+			wantURLs: []string{"https://down.example.com/vcek/v1/Milan/cert_chain", "https://up.example.com/amd/vcek/v1/Milan/cert_chain"},
+		},
+		{
+			name:     "fallback",
+			serve:    map[string][]byte{kdsURL: []byte("kds")},
+			fallback: true,
+			url:      kdsURL,
+			want:     "kds",
+			wantURLs: []string{"https://down.example.com/vcek/v1/Milan/cert_chain", "https://up.example.com/amd/vcek/v1/Milan/cert_chain", kdsURL},
+		},
+		{
+			name:     "no fallback",
+			serve:    map[string][]byte{kdsURL: []byte("kds")},
+			url:      kdsURL,
+			wantURLs: []string{"https://down.example.com/vcek/v1/Milan/cert_chain", "https://up.example.com/amd/vcek/v1/Milan/cert_chain"},
+		},
+		{
+			name:     "not KDS",
+			serve:    map[string][]byte{"https://example.com/crl": []byte("crl")},
+			url:      "https://example.com/crl",
+			want:     "crl",
+			wantURLs: []string{"https://example.com/crl"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &urlGetter{serve: tc.serve}
+			getter := &trust.MirrorHTTPSGetter{Mirrors: mirrors, FallbackToKDS: tc.fallback, Getter: r}
+			got, err := getter.Get(tc.url)
+			if (err == nil) != (tc.want != "") || string(got) != tc.want {
+				t.Errorf("Get(%q) = %q, %v, want %q", tc.url, got, err, tc.want)
+			}
+			if fmt.Sprint(r.urls) != fmt.Sprint(tc.wantURLs) {
+				t.Errorf("Get(%q) fetched %v, want %v", tc.url, r.urls, tc.wantURLs)
+			}
+		})
+	}
+}
@@ -16,14 +16,17 @@
 package verify
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/google/go-sev-guest/abi"
@@ -293,7 +296,9 @@ type CRLUnavailableErr struct {
 }
 
 // GetCrlAndCheckRoot downloads the given cert's CRL from one of the distribution points and
-// verifies that the CRL is valid and doesn't revoke an intermediate key.
+// verifies that the CRL is valid and doesn't revoke an intermediate key. A CRL fetched by an
+// earlier call for the same product line and signing key is reused while fresh according to
+// opts.CRLMaxAge and its NextUpdate.
 func GetCrlAndCheckRoot(r *trust.AMDRootCerts, opts *Options) (*x509.RevocationList, error) {
 	return GetCrlAndCheckRootContext(context.TODO(), r, opts)
 }
@@ -301,20 +306,35 @@ func GetCrlAndCheckRoot(r *trust.AMDRootCerts, opts *Options) (*x509.RevocationL
 // GetCrlAndCheckRootContext behaves like GetCrlAndCheckRoot but forwards the context to the
 // HTTPSGetter.
 func GetCrlAndCheckRootContext(ctx context.Context, r *trust.AMDRootCerts, opts *Options) (*x509.RevocationList, error) {
+	if opts.bundleCRL != nil {
+		return checkBundleCRL(r, opts)
+	}
+	ctx, cancel := stepContext(ctx, opts.CRLFetchTimeout)
+	defer cancel()
 	r.Mu.Lock()
 	defer r.Mu.Unlock()
-	getter := opts.Getter
-	if getter == nil {
-		getter = trust.DefaultHTTPSGetter()
+	getter := opts.getter()
+	if r.CRL != nil && opts.now().Before(r.CRL.NextUpdate) {
+		if err := verifyCRL(r, opts); err != nil {
+			return nil, err
+		}
+		return r.CRL, nil
 	}
-	if r.CRL != nil && opts.Now.Before(r.CRL.NextUpdate) {
-		if err := verifyCRL(r); err != nil {
+	useCRL := func(crl *x509.RevocationList) (*x509.RevocationList, error) {
+		r.CRL = crl
+		if err := verifyCRL(r, opts); err != nil {
 			return nil, err
 		}
 		return r.CRL, nil
 	}
+	distributionPoints := r.ProductCerts.Ask.CRLDistributionPoints
+	for _, url := range distributionPoints {
+		if crl := cachedCRLFor(r, url, opts, false); crl != nil {
+			return useCRL(crl)
+		}
+	}
 	var errs error
-	for _, url := range r.ProductCerts.Ask.CRLDistributionPoints {
+	for _, url := range distributionPoints {
 		bytes, err := trust.GetWith(ctx, getter, url)
 		if err != nil {
 			errs = multierr.Append(errs, err)
@@ -325,18 +345,65 @@ func GetCrlAndCheckRootContext(ctx context.Context, r *trust.AMDRootCerts, opts
 			errs = multierr.Append(errs, err)
 			continue
 		}
-		r.CRL = crl
-		if err := verifyCRL(r); err != nil {
-			return nil, err
+		cacheCRL(r, url, crl, opts.cryptoBackend())
+		return useCRL(crl)
+	}
+	if opts.CRLStaleGrace > 0 {
+		for _, url := range distributionPoints {
+			if crl := cachedCRLFor(r, url, opts, true); crl != nil {
+				logger.Warningf("using stale CRL from %s since it could not be fetched: %v", url, errs)
+				return useCRL(crl)
+			}
 		}
-		return r.CRL, nil
 	}
 	return nil, CRLUnavailableErr{multierr.Append(errs, errors.New("could not fetch product CRL"))}
 }
 
-// verifyCRL checks that the VCEK CRL is signed by the ARK. Must be called after r.CRL is set and while
-// r.Mu is held.
-func verifyCRL(r *trust.AMDRootCerts) error {
+// checkBundleCRL verifies the CRL of the bundle that opts verifies like a fetched one. It neither
+// reads nor updates r.CRL or the CRL cache, which hold CRLs that are current at other times.
+func checkBundleCRL(r *trust.AMDRootCerts, opts *Options) (*x509.RevocationList, error) {
+	crl, err := x509.ParseRevocationList(opts.bundleCRL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse bundle CRL: %v", err)
+	}
+	if err := verifyCRL(&trust.AMDRootCerts{ProductLine: r.GetProductLine(), ProductCerts: r.ProductCerts, CRL: crl}, opts); err != nil {
+		return nil, err
+	}
+	return crl, nil
+}
+
+// checkCRLIssuer returns an error if the ARK did not issue and sign crl.
+func checkCRLIssuer(crl *x509.RevocationList, ark *x509.Certificate, backend CryptoBackend) error {
+	if !bytes.Equal(crl.RawIssuer, ark.RawSubject) {
+		return fmt.Errorf("CRL issuer %q is not the ARK %q", crl.Issuer, ark.Subject)
+	}
+	if err := backend.CheckCRLSignature(crl, ark); err != nil {
+		return fmt.Errorf("CRL is not signed by ARK: %v", err)
+	}
+	return nil
+}
+
+// checkCRLWindow returns an error if crl is not current at now. A CRL remains usable for grace
+// after its NextUpdate.
+func checkCRLWindow(crl *x509.RevocationList, now time.Time, grace time.Duration) error {
+	if crl.NextUpdate.IsZero() {
+		return errors.New("CRL has no nextUpdate, so its staleness cannot be determined")
+	}
+	if !crl.NextUpdate.After(crl.ThisUpdate) {
+		return fmt.Errorf("CRL nextUpdate %v is not after its thisUpdate %v", crl.NextUpdate, crl.ThisUpdate)
+	}
+	if now.Before(crl.ThisUpdate) {
+		return fmt.Errorf("CRL is not valid until %v, after the verification time %v", crl.ThisUpdate, now)
+	}
+	if now.After(crl.NextUpdate.Add(grace)) {
+		return fmt.Errorf("CRL expired at %v, before the verification time %v", crl.NextUpdate, now)
+	}
+	return nil
+}
+
+// verifyCRL checks that the VCEK CRL is issued and signed by the ARK, current at the verification
+// time, and does not revoke the ASK. Must be called after r.CRL is set and while r.Mu is held.
+func verifyCRL(r *trust.AMDRootCerts, opts *Options) error {
 	if r.CRL == nil {
 		return errors.New("internal error: CRL not set")
 	}
@@ -346,8 +413,11 @@ func verifyCRL(r *trust.AMDRootCerts) error {
 	if r.ProductCerts.Ask == nil {
 		return errors.New("missing ASK x509 certificate to check intermediate key validity")
 	}
-	if err := r.CRL.CheckSignatureFrom(r.ProductCerts.Ark); err != nil {
-		return fmt.Errorf("CRL is not signed by ARK: %v", err)
+	if err := checkCRLIssuer(r.CRL, r.ProductCerts.Ark, opts.cryptoBackend()); err != nil {
+		return err
+	}
+	if err := checkCRLWindow(r.CRL, opts.now(), opts.CRLStaleGrace); err != nil {
+		return err
 	}
 	for _, bad := range r.CRL.RevokedCertificates {
 		if r.ProductCerts.Ask.SerialNumber.Cmp(bad.SerialNumber) == 0 {
@@ -449,11 +519,15 @@ func validateKDSCertificateProductSpecifics(r *trust.AMDRootCerts, cert *x509.Ce
 	if ica == nil {
 		return fmt.Errorf("root of trust missing intermediate certificate authority certificate for key %v", key)
 	}
-	verifyOpts := r.X509Options(opts.Now, key)
+	verifyOpts := r.X509Options(opts.now(), key)
 	if verifyOpts == nil {
 		return fmt.Errorf("internal error: could not get X509 options for %v (missing ARK cert or ICA cert)", key)
 	}
-	if _, err := cert.Verify(*verifyOpts); err != nil {
+	if opts.Crypto != nil {
+		if err := verifyChainWith(opts.Crypto, cert, ica, r.ProductCerts.Ark, opts.now()); err != nil {
+			return fmt.Errorf("error verifying %v certificate: %v", key, err)
+		}
+	} else if _, err := cert.Verify(*verifyOpts); err != nil {
 		return fmt.Errorf("error verifying %v certificate: %v (%v)", key, err, ica.IsCA)
 	}
 	// VCEK is not expected to have a CRL link.
@@ -486,8 +560,94 @@ func checkProductName(got, want *spb.SevProduct, key abi.ReportSigner) error {
 
 // decodeCerts checks that the V[CL]EK certificate matches expected fields
 // from the KDS specification and also that its certificate chain matches
-// hardcoded trusted root certificates from AMD.
-func decodeCerts(chain *spb.CertificateChain, key abi.ReportSigner, knownProductLine string, options *Options) (*x509.Certificate, *trust.AMDRootCerts, error) {
+// hardcoded trusted root certificates from AMD. On failure, the V[CL]EK
+// certificate is still returned if it parses.
+func decodeCerts(chain *spb.CertificateChain, key abi.ReportSigner, knownProductLine string, options *Options, res *Result) (*x509.Certificate, *trust.AMDRootCerts, error) {
+	endorsementKeyCert, productLine, err := decodeEndorsementKeyCert(chain, key, knownProductLine, options)
+	if err := res.record(CheckExtensions, err); err != nil {
+		return endorsementKeyCert, nil, err
+	}
+	root, err := checkEndorsementKeyChain(chain, endorsementKeyCert, key, productLine, options)
+	if err := res.record(CheckCertChain, err); err != nil {
+		return endorsementKeyCert, nil, err
+	}
+	return endorsementKeyCert, root, nil
+}
+
+// decodeCertsContext behaves like decodeCerts but gives up when ctx is done or
+// options.ChainVerifyTimeout passes.
+func decodeCertsContext(ctx context.Context, chain *spb.CertificateChain, key abi.ReportSigner, knownProductLine string, options *Options, res *Result) (*x509.Certificate, *trust.AMDRootCerts, error) {
+	ctx, cancel := stepContext(ctx, options.ChainVerifyTimeout)
+	defer cancel()
+	if ctx.Done() == nil {
+		return decodeCerts(chain, key, knownProductLine, options, res)
+	}
+	type decoded struct {
+		endorsementKeyCert *x509.Certificate
+		root               *trust.AMDRootCerts
+		res                *Result
+		err                error
+	}
+	// Decode into a private Result, since the caller's may not be touched after a timeout.
+	done := make(chan decoded, 1)
+	go func() {
+		var stepRes *Result
+		if res != nil {
+			stepRes = &Result{}
+		}
+		ek, root, err := decodeCerts(chain, key, knownProductLine, options, stepRes)
+		done <- decoded{ek, root, stepRes, err}
+	}()
+	select {
+	case d := <-done:
+		if res != nil {
+			res.Checks = append(res.Checks, d.res.Checks...)
+		}
+		return d.endorsementKeyCert, d.root, d.err
+	case <-ctx.Done():
+		return nil, nil, res.record(CheckCertChain, fmt.Errorf("certificate chain verification: %w", ctx.Err()))
+	}
+}
+
+// checkTrustAnchors returns an error if the ARK is not among the operator-configured trust anchors
+// of options. Without configured anchors, every ARK that passed the other checks is accepted.
+func checkTrustAnchors(ark *x509.Certificate, options *Options) error {
+	if ark == nil {
+		return errors.New("missing ARK x509 certificate to check trust anchors")
+	}
+	if options.TrustedArks != nil {
+		if _, err := ark.Verify(x509.VerifyOptions{
+			Roots:       options.TrustedArks,
+			CurrentTime: options.now(),
+			KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return fmt.Errorf("ARK is not in the trusted ARK pool: %v", err)
+		}
+	}
+	if len(options.ArkSPKIPins) != 0 {
+		pin := sha256.Sum256(ark.RawSubjectPublicKeyInfo)
+		for _, want := range options.ArkSPKIPins {
+			if pin == want {
+				return nil
+			}
+		}
+		return fmt.Errorf("ARK public key SHA-256 %x matches no SPKI pin", pin)
+	}
+	return nil
+}
+
+// stepContext returns ctx bounded by timeout if it is positive.
+func stepContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// decodeEndorsementKeyCert parses the chain's V[CL]EK certificate, checks its format and
+// extensions, and returns it with its product line. A certificate that parses is returned even if
+// it fails a check.
+func decodeEndorsementKeyCert(chain *spb.CertificateChain, key abi.ReportSigner, knownProductLine string, options *Options) (*x509.Certificate, string, error) {
 	var ek []byte
 	switch key {
 	case abi.VcekReportSigner:
@@ -496,42 +656,59 @@ func decodeCerts(chain *spb.CertificateChain, key abi.ReportSigner, knownProduct
 		ek = chain.GetVlekCert()
 	}
 	if len(ek) == 0 {
-		return nil, nil, fmt.Errorf("missing %v certificate", key)
+		return nil, "", fmt.Errorf("missing %v certificate", key)
 	}
 	endorsementKeyCert, err := trust.ParseCert(ek)
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not interpret %v DER bytes %v: %v", key, ek, err)
+		return nil, "", fmt.Errorf("could not interpret %v DER bytes %v: %v", key, ek, err)
 	}
 	exts, err := validateKDSCertificateProductNonspecific(endorsementKeyCert, key, knownProductLine)
 	if err != nil {
-		return nil, nil, err
+		return endorsementKeyCert, "", err
+	}
+	if key == abi.VlekReportSigner && options.CSPID != "" && exts.CspID != options.CSPID {
+		return endorsementKeyCert, "", fmt.Errorf("VLEK certificate CSP_ID is %q, want %q", exts.CspID, options.CSPID)
 	}
-	roots := options.TrustedRoots
 
 	productLine := knownProductLine
 	// Relevant for v2 reports only.
 	if productLine == "" {
 		product, err := kds.ParseProductName(exts.ProductName, key)
 		if err != nil {
-			return nil, nil, err
+			return endorsementKeyCert, "", err
 		}
 
 		productLine = kds.ProductLine(product)
 		// Ensure the extension product info matches expectations.
 		if err := checkProductName(product, options.Product, key); err != nil {
-			return nil, nil, err
+			return endorsementKeyCert, "", err
 		}
 	}
+	return endorsementKeyCert, productLine, nil
+}
+
+// checkEndorsementKeyChain returns the trusted root that certifies the endorsement key.
+func checkEndorsementKeyChain(chain *spb.CertificateChain, endorsementKeyCert *x509.Certificate, key abi.ReportSigner, productLine string, options *Options) (*trust.AMDRootCerts, error) {
+	roots := options.TrustedRoots
 	if len(roots) == 0 {
+		if options.DisableEmbeddedRoots && options.TrustedArks == nil && len(options.ArkSPKIPins) == 0 {
+			return nil, errors.New("embedded AMD roots are disabled, but no trust anchors are configured")
+		}
 		root := trust.AMDRootCertsProduct(productLine)
-		// Require that the root matches embedded root certs.
-		root.AskSev = trust.DefaultRootCerts[productLine].AskSev
-		root.ArkSev = trust.DefaultRootCerts[productLine].ArkSev
+		if !options.DisableEmbeddedRoots {
+			embedded, ok := trust.DefaultRootCerts[productLine]
+			if !ok {
+				return nil, fmt.Errorf("no embedded AMD roots for product line %q. Use TrustedRoots or TrustedArks", productLine)
+			}
+			// Require that the root matches embedded root certs.
+			root.AskSev = embedded.AskSev
+			root.ArkSev = embedded.ArkSev
+		}
 		if err := root.Decode(chain.GetAskCert(), chain.GetArkCert()); err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		if err := validateX509(root, key); err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		roots = map[string][]*trust.AMDRootCerts{
 			productLine: {root},
@@ -543,14 +720,22 @@ func decodeCerts(chain *spb.CertificateChain, key abi.ReportSigner, knownProduct
 			lastErr = err
 			continue
 		}
-		return endorsementKeyCert, productRoot, nil
+		if err := checkTrustAnchors(productRoot.ProductCerts.Ark, options); err != nil {
+			lastErr = err
+			continue
+		}
+		return productRoot, nil
 	}
-	return nil, nil, fmt.Errorf("%v could not be verified by any trusted roots. Last error: %v", key, lastErr)
+	return nil, fmt.Errorf("%v could not be verified by any trusted roots. Last error: %v", key, lastErr)
 }
 
 // SnpReportSignature verifies the attestation report's signature based on the report's
 // SignatureAlgo.
 func SnpReportSignature(report []byte, vcek *x509.Certificate) error {
+	return snpReportSignature(report, vcek, GoCrypto{})
+}
+
+func snpReportSignature(report []byte, vcek *x509.Certificate, backend CryptoBackend) error {
 	if err := abi.ValidateReportFormat(report); err != nil {
 		return fmt.Errorf("attestation report format error: %v", err)
 	}
@@ -559,7 +744,11 @@ func SnpReportSignature(report []byte, vcek *x509.Certificate) error {
 		return fmt.Errorf("could not interpret report signature: %v", err)
 	}
 	if abi.SignatureAlgo(report) == abi.SignEcdsaP384Sha384 {
-		if err := vcek.CheckSignature(x509.ECDSAWithSHA384, abi.SignedComponent(report), der); err != nil {
+		pub, ok := vcek.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("report signature verification error: endorsement key is %T, not ECDSA", vcek.PublicKey)
+		}
+		if err := backend.VerifyECDSAP384SHA384(pub, abi.SignedComponent(report), der); err != nil {
 			return fmt.Errorf("report signature verification error: %v", err)
 		}
 		return nil
@@ -571,11 +760,15 @@ func SnpReportSignature(report []byte, vcek *x509.Certificate) error {
 // SnpProtoReportSignature verifies the protobuf representation of an attestation report's signature
 // based on the report's SignatureAlgo.
 func SnpProtoReportSignature(report *spb.Report, vcek *x509.Certificate) error {
+	return snpProtoReportSignature(report, vcek, GoCrypto{})
+}
+
+func snpProtoReportSignature(report *spb.Report, vcek *x509.Certificate, backend CryptoBackend) error {
 	raw, err := abi.ReportToAbiBytes(report)
 	if err != nil {
 		return fmt.Errorf("could not interpret report: %v", err)
 	}
-	return SnpReportSignature(raw, vcek)
+	return snpReportSignature(raw, vcek, backend)
 }
 
 // Options represents verification options for an SEV-SNP attestation report.
@@ -586,19 +779,133 @@ type Options struct {
 	// DisableCertFetching set to true if SnpAttestation should not connect to the AMD KDS to fill in
 	// any missing certificates in an attestation's certificate chain. Uses Getter if false.
 	DisableCertFetching bool
-	// Getter takes a URL and returns the body of its contents. By default uses http.Get and returns
-	// the body. If Getter implements trust.ContextHTTPSGetter, GetContext will be preferred over Get.
+	// Getter takes a URL and returns the body of its contents. By default uses HTTPClient with
+	// retries and returns the body. If Getter implements trust.ContextHTTPSGetter, GetContext will be
+	// preferred over Get. On Azure, a trust.THIMGetter serves VCEK certificates without contacting
+	// the AMD KDS.
 	Getter trust.HTTPSGetter
-	// Now is the time at which to verify the validity of certificates. If unset, uses time.Now().
+	// VlekGetter, if non-nil, downloads the VLEK certificate from kds.VLEKCertURL for VLEK-signed
+	// attestations that do not carry one, e.g., a trust.VLEKHTTPSGetter with the cloud service
+	// provider's KDS credentials. If nil, such attestations fail with ErrMissingVlek.
+	VlekGetter trust.HTTPSGetter
+	// CSPID, if not empty, is the only CSP_ID accepted in the VLEK certificate of a VLEK-signed
+	// report, i.e., the cloud service provider that AMD certified the VLEK for.
+	CSPID string
+	// KDSMirrors are the base URLs of mirrors of the AMD KDS, e.g.,
+	// "https://kds-mirror.example.com/amd", from which certificates and CRLs are fetched in order
+	// before the AMD KDS itself. Each mirror must serve the KDS's paths below its base URL. Applies
+	// to Getter if set, within the retries of a trust.RetryHTTPSGetter or trust.BackoffHTTPSGetter.
+	KDSMirrors []string
+	// HTTPClient sends the KDS requests of the default Getter, e.g., one from trust.NewHTTPClient
+	// with a proxy or a corporate CA bundle. If nil, uses a shared client with pooled connections
+	// and the environment's proxy settings. Ignored if Getter is set.
+	HTTPClient *http.Client
+	// Now is the time at which to verify the validity of certificates and CRLs. If unset, uses
+	// Clock.
 	Now time.Time
+	// Clock returns the time at which to verify if Now is unset, e.g., for long-lived Options. If
+	// nil, uses time.Now.
+	Clock func() time.Time
 	// TrustedRoots specifies the ARK and ASK certificates to trust when checking the VCEK. If nil,
 	// then verification will fall back on embedded AMD-published root certificates.
 	// Maps the product name to an array of allowed roots.
 	TrustedRoots map[string][]*trust.AMDRootCerts
+	// Crypto, if non-nil, performs the report, certificate, and CRL signature checks instead of the
+	// Go standard library.
+	Crypto CryptoBackend
+	// AllowedSigners, if not empty, are the only key types accepted to sign the report, e.g., only
+	// abi.VcekReportSigner to require a chip-bound signature.
+	AllowedSigners []abi.ReportSigner
+	// TrustedArks, if non-nil, must contain the ARK that certifies the endorsement key.
+	TrustedArks *x509.CertPool
+	// ArkSPKIPins, if not empty, are the SHA-256 hashes of the DER-encoded SubjectPublicKeyInfo of
+	// the ARKs to trust. The ARK that certifies the endorsement key must match one of them.
+	ArkSPKIPins [][sha256.Size]byte
+	// DisableEmbeddedRoots set to true if the AMD root certificates embedded in this module should
+	// not be trusted. Then TrustedRoots, TrustedArks, or ArkSPKIPins must establish trust.
+	DisableEmbeddedRoots bool
 	// Product is a forced value for the attestation product name when verifying or retrieving
 	// VCEK certificates. An attestation should carry the product of the reporting
 	// machine. Only used for v2 attestation reports.
 	Product *spb.SevProduct
+	// CertFetchTimeout bounds fetching the attestation's missing certificates. If zero, only the
+	// context bounds it.
+	CertFetchTimeout time.Duration
+	// CRLFetchTimeout bounds fetching the product CRL. If zero, only the context bounds it.
+	CRLFetchTimeout time.Duration
+	// ChainVerifyTimeout bounds checking the certificate chain. If zero, only the context bounds it.
+	ChainVerifyTimeout time.Duration
+	// CRLMaxAge bounds how long a fetched CRL is reused by later revocation checks, even before its
+	// NextUpdate. If zero, a CRL is reused until its NextUpdate.
+	CRLMaxAge time.Duration
+	// CRLStaleGrace is how stale a CRL may be before revocation checking fails: how long after its
+	// NextUpdate a CRL is still accepted, and how long after a cached CRL stops being fresh it may
+	// still be used when no distribution point can be reached. If zero, a CRL past its NextUpdate
+	// and an unreachable CRL are always errors.
+	CRLStaleGrace time.Duration
+	// CertStore, if non-nil, supplies missing certificates before they are fetched from the KDS, and
+	// receives the certificates of each successfully verified attestation. Stored certificates are
+	// used even if DisableCertFetching is set. Stored VLEK certificates are keyed by their CSP_ID, so
+	// only a set CSPID makes verification load one.
+	CertStore trust.CertStore
+	// CollectAllFailures continues verification past a failed check, so that the returned error
+	// joins every failure instead of only the first. Checks that depend on a failed check, such as
+	// the signature check on an unparsable endorsement key certificate, are still not performed.
+	CollectAllFailures bool
+
+	// bundleCRL is the DER-encoded CRL of the bundle being verified, if any, which is checked in
+	// place of a fetched or cached one.
+	bundleCRL []byte
+}
+
+// now returns the time at which to verify.
+func (o *Options) now() time.Time {
+	if !o.Now.IsZero() {
+		return o.Now
+	}
+	if o.Clock != nil {
+		return o.Clock()
+	}
+	return time.Now()
+}
+
+// getter returns the getter for KDS requests.
+func (o *Options) getter() trust.HTTPSGetter {
+	if o.Getter != nil {
+		if len(o.KDSMirrors) == 0 {
+			return o.Getter
+		}
+		mirrored := func(getter trust.HTTPSGetter) trust.HTTPSGetter {
+			return &trust.MirrorHTTPSGetter{Mirrors: o.KDSMirrors, FallbackToKDS: true, Getter: getter}
+		}
+		// Try the mirrors within each retry like NewMirrorHTTPSGetter, so that a dead mirror is not
+		// retried until the timeout before the next one.
+		switch g := o.Getter.(type) {
+		case *trust.RetryHTTPSGetter:
+			retry := *g
+			retry.Getter = mirrored(g.Getter)
+			return &retry
+		case *trust.BackoffHTTPSGetter:
+			backoff := *g
+			if backoff.Getter == nil {
+				backoff.Getter = &trust.SimpleHTTPSGetter{}
+			}
+			backoff.Getter = mirrored(backoff.Getter)
+			return &backoff
+		}
+		return mirrored(o.Getter)
+	}
+	if len(o.KDSMirrors) != 0 {
+		return trust.NewMirrorHTTPSGetter(o.HTTPClient, o.KDSMirrors)
+	}
+	return trust.NewHTTPSGetter(o.HTTPClient)
+}
+
+func (o *Options) cryptoBackend() CryptoBackend {
+	if o.Crypto != nil {
+		return o.Crypto
+	}
+	return GoCrypto{}
 }
 
 // DefaultOptions returns a useful default verification option setting
@@ -683,39 +990,129 @@ func SnpAttestation(attestation *spb.Attestation, options *Options) error {
 
 // SnpAttestationContext behaves like SnpAttestation but forwards the context to the HTTPSGetter.
 func SnpAttestationContext(ctx context.Context, attestation *spb.Attestation, options *Options) error {
+	_, err := SnpAttestationWithResultContext(ctx, attestation, options)
+	return err
+}
+
+// SnpAttestationWithResult behaves like SnpAttestation but also returns which checks were
+// performed and their outcomes, for relying parties that must log exactly what was verified.
+func SnpAttestationWithResult(attestation *spb.Attestation, options *Options) (*Result, error) {
+	return SnpAttestationWithResultContext(context.TODO(), attestation, options)
+}
+
+// SnpAttestationWithResultContext behaves like SnpAttestationWithResult but forwards the context
+// to the HTTPSGetter.
+func SnpAttestationWithResultContext(ctx context.Context, attestation *spb.Attestation, options *Options) (*Result, error) {
+	res := &Result{}
 	if options == nil {
-		return fmt.Errorf("options cannot be nil")
+		return res, fmt.Errorf("options cannot be nil")
 	}
 	if attestation == nil {
-		return fmt.Errorf("attestation cannot be nil")
+		return res, fmt.Errorf("attestation cannot be nil")
+	}
+	report := attestation.GetReport()
+	info, err := abi.ProtoSignerInfo(report)
+	if err != nil {
+		return res, err
+	}
+	// errs collects the failures. Without options.CollectAllFailures, verification stops at the
+	// first one.
+	var errs error
+	stop := func(err error) bool {
+		errs = multierr.Append(errs, err)
+		return err != nil && !options.CollectAllFailures
+	}
+	if len(options.AllowedSigners) != 0 {
+		if stop(res.record(CheckSigner, checkSigner(info.SigningKey, options))) {
+			return res, errs
+		}
 	}
 	// Make sure we have the whole certificate chain, or at least the product
 	// info.
-	if err := fillInAttestation(ctx, attestation, options); err != nil {
-		return err
+	if stop(res.record(CheckCertificateFetch, fillInAttestation(ctx, attestation, options))) {
+		return res, errs
 	}
 
-	report := attestation.GetReport()
-	info, err := abi.ParseSignerInfo(report.GetSignerInfo())
-	if err != nil {
-		return err
+	formatErr := res.record(CheckReportFormat, validateProtoReportFormat(report))
+	if stop(formatErr) {
+		return res, errs
 	}
 	chain := attestation.GetCertificateChain()
 
-	var knownProductLine string
-	if fms := attestation.GetReport().GetCpuid1EaxFms(); fms != 0 {
-		knownProductLine = kds.ProductLineFromFms(fms)
-	}
-	endorsementKeyCert, root, err := decodeCerts(chain, info.SigningKey, knownProductLine, options)
+	knownProductLine, err := reportProductLine(report, options)
 	if err != nil {
-		return err
+		// The certificate checks depend on the product.
+		stop(res.record(CheckExtensions, err))
+		return res, errs
+	}
+	endorsementKeyCert, root, err := decodeCertsContext(ctx, chain, info.SigningKey, knownProductLine, options, res)
+	if stop(err) {
+		return res, errs
+	}
+	// Revocation depends on the trusted root.
+	if !options.CheckRevocations {
+		res.skip(CheckRevocation)
+	} else if root != nil {
+		if stop(res.record(CheckRevocation, VcekNotRevokedContext(ctx, root, endorsementKeyCert, options))) {
+			return res, errs
+		}
 	}
-	if options.CheckRevocations {
-		if err := VcekNotRevoked(root, endorsementKeyCert, options); err != nil {
-			return err
+	// The signature check depends on a well-formed report and a parsed endorsement key.
+	if formatErr == nil && endorsementKeyCert != nil {
+		if stop(res.record(CheckSignature, snpProtoReportSignature(report, endorsementKeyCert, options.cryptoBackend()))) {
+			return res, errs
+		}
+	}
+	if errs != nil {
+		return res, errs
+	}
+	if options.CertStore != nil {
+		storeCerts(attestation, root.GetProductLine(), info.SigningKey, options.CertStore)
+	}
+	return res, nil
+}
+
+// checkSigner returns an error if options.AllowedSigners is not empty and does not include key.
+func checkSigner(key abi.ReportSigner, options *Options) error {
+	if len(options.AllowedSigners) == 0 {
+		return nil
+	}
+	for _, allowed := range options.AllowedSigners {
+		if key == allowed {
+			return nil
 		}
 	}
-	return SnpProtoReportSignature(report, endorsementKeyCert)
+	return fmt.Errorf("report is signed by the %v, but only %v signatures are allowed", key, options.AllowedSigners)
+}
+
+// reportProductLine returns the product line that a version 3 or later report states in its
+// CPUID fields, and makes that product the expectation if options has none. It returns "" for
+// earlier reports and unknown products, whose product line comes from the endorsement key
+// certificate instead.
+func reportProductLine(report *spb.Report, options *Options) (string, error) {
+	fms, ok := abi.ReportCpuid1EaxFms(report)
+	if !ok {
+		return "", nil
+	}
+	product := abi.SevProductFromCpuid1Eax(fms)
+	if product.GetName() == spb.SevProduct_SEV_PRODUCT_UNKNOWN {
+		return "", nil
+	}
+	if err := updateProductExpectation(&options.Product, product); err != nil {
+		return "", err
+	}
+	return kds.ProductLine(product), nil
+}
+
+func validateProtoReportFormat(report *spb.Report) error {
+	raw, err := abi.ReportToAbiBytes(report)
+	if err != nil {
+		return fmt.Errorf("could not interpret report: %v", err)
+	}
+	if err := abi.ValidateReportFormat(raw); err != nil {
+		return fmt.Errorf("attestation report format error: %v", err)
+	}
+	return nil
 }
 
 func getProductFromCerts(attestation *spb.Attestation) *spb.SevProduct {
@@ -767,8 +1164,7 @@ func cpuidWorkaround(attestation *spb.Attestation, options *Options) (string, fu
 	productUpdate := func([]byte) error { return nil }
 	updateExpectation := func() error { return nil }
 
-	fms := attestation.GetReport().GetCpuid1EaxFms()
-	if fms != 0 {
+	if fms, ok := abi.ReportCpuid1EaxFms(attestation.GetReport()); ok {
 		return kds.ProductLineFromFms(fms), productUpdate, updateExpectation, nil
 	}
 	// ATTESTATION_REPORT v2 makes product determination difficult.
@@ -808,20 +1204,33 @@ func cpuidWorkaround(attestation *spb.Attestation, options *Options) (string, fu
 // fillInAttestation uses AMD's KDS to populate any empty certificate field in the attestation's
 // certificate chain.
 func fillInAttestation(ctx context.Context, attestation *spb.Attestation, options *Options) error {
-	if options.DisableCertFetching {
+	if options.DisableCertFetching && options.CertStore == nil {
 		return nil
 	}
+	ctx, cancel := stepContext(ctx, options.CertFetchTimeout)
+	defer cancel()
 	productLine, productUpdate, updateExpectation, err := cpuidWorkaround(attestation, options)
 	if err != nil {
 		return err
 	}
-
-	getter := options.Getter
-	if getter == nil {
-		getter = trust.DefaultHTTPSGetter()
+	dropMismatchedVcek(attestation)
+	if options.CertStore != nil {
+		if err := fillInStoredCerts(attestation, productLine, options.CSPID, options.CertStore); err != nil {
+			return err
+		}
+		if len(attestation.GetCertificateChain().GetVcekCert()) != 0 {
+			if err := productUpdate(attestation.GetCertificateChain().GetVcekCert()); err != nil {
+				return err
+			}
+		}
+	}
+	if options.DisableCertFetching {
+		return updateExpectation()
 	}
+
+	getter := options.getter()
 	report := attestation.GetReport()
-	info, err := abi.ParseSignerInfo(report.GetSignerInfo())
+	info, err := abi.ProtoSignerInfo(report)
 	if err != nil {
 		return err
 	}
@@ -861,16 +1270,151 @@ func fillInAttestation(ctx context.Context, attestation *spb.Attestation, option
 			}
 		}
 	case abi.VlekReportSigner:
-		// We can't lazily ask KDS for the certificate as a user. The CSP must cache their provisioned
-		// certificates and provide them in GET_EXT_REPORT.
-		if len(chain.GetVlekCert()) == 0 {
+		if len(chain.GetVlekCert()) != 0 {
+			break
+		}
+		// We can't lazily ask KDS for the certificate as a user. Unless the CSP's credentials are
+		// available, the CSP must cache their provisioned certificates and provide them in
+		// GET_EXT_REPORT.
+		if options.VlekGetter == nil {
 			return ErrMissingVlek
 		}
+		vlekURL := kds.VLEKCertURL(productLine, kds.TCBVersion(report.GetReportedTcb()))
+		vlek, err := trust.GetWith(ctx, options.VlekGetter, vlekURL)
+		if err != nil {
+			return &trust.AttestationRecreationErr{
+				Msg: fmt.Sprintf("could not download VLEK certificate: %v", err),
+			}
+		}
+		chain.VlekCert = vlek
 	}
 
 	return updateExpectation()
 }
 
+// storedCertKeys returns the CertStore keys of the endorsement key, ASK, and ARK certificates for
+// the attestation's report. The VLEK certificate key is empty without a CSP_ID.
+func storedCertKeys(report *spb.Report, productLine, cspID string, key abi.ReportSigner) (string, string, string) {
+	tcb := kds.TCBVersion(report.GetReportedTcb())
+	ek := trust.VcekStoreKey(productLine, report.GetChipId(), tcb)
+	if key == abi.VlekReportSigner {
+		ek = ""
+		if cspID != "" {
+			ek = trust.VlekStoreKey(productLine, cspID, tcb)
+		}
+	}
+	return ek, trust.AskStoreKey(productLine, key), trust.ArkStoreKey(productLine, key)
+}
+
+// loadStoredCert returns the certificate that store holds for key, or nil if it holds none that
+// parses.
+func loadStoredCert(store trust.CertStore, key string) []byte {
+	der, err := store.Load(key)
+	if err != nil {
+		if !errors.Is(err, trust.ErrCertNotStored) {
+			logger.Warningf("could not load certificate %s from store: %v", key, err)
+		}
+		return nil
+	}
+	if _, err := x509.ParseCertificate(der); err != nil {
+		logger.Warningf("ignoring unparsable stored certificate %s: %v", key, err)
+		return nil
+	}
+	return der
+}
+
+// fillInStoredCerts populates any empty endorsement key, ASK, or ARK field of the attestation's
+// certificate chain from store. The VLEK certificate is only loaded for a known cspID.
+func fillInStoredCerts(attestation *spb.Attestation, productLine, cspID string, store trust.CertStore) error {
+	report := attestation.GetReport()
+	info, err := abi.ProtoSignerInfo(report)
+	if err != nil {
+		return err
+	}
+	chain := attestation.GetCertificateChain()
+	if chain == nil {
+		chain = &spb.CertificateChain{}
+		attestation.CertificateChain = chain
+	}
+	ekKey, askKey, arkKey := storedCertKeys(report, productLine, cspID, info.SigningKey)
+	if len(chain.GetAskCert()) == 0 || len(chain.GetArkCert()) == 0 {
+		// Only use a stored pair, since an ASK must match its ARK.
+		ask, ark := loadStoredCert(store, askKey), loadStoredCert(store, arkKey)
+		if ask != nil && ark != nil {
+			chain.AskCert = ask
+			chain.ArkCert = ark
+		}
+	}
+	switch info.SigningKey {
+	case abi.VcekReportSigner:
+		if len(chain.GetVcekCert()) == 0 {
+			chain.VcekCert = loadStoredCert(store, ekKey)
+		}
+	case abi.VlekReportSigner:
+		if len(chain.GetVlekCert()) == 0 && ekKey != "" {
+			chain.VlekCert = loadStoredCert(store, ekKey)
+		}
+	}
+	return nil
+}
+
+// dropMismatchedVcek removes the attestation's VCEK certificate if it certifies a TCB other than
+// the report's reported TCB, e.g., when the host's certificate cache predates a firmware update.
+// Such a VCEK cannot have signed the report, so the certificate store or the KDS supplies the one
+// for the reported TCB instead.
+func dropMismatchedVcek(attestation *spb.Attestation) {
+	report := attestation.GetReport()
+	chain := attestation.GetCertificateChain()
+	if len(chain.GetVcekCert()) == 0 {
+		return
+	}
+	info, err := abi.ProtoSignerInfo(report)
+	if err != nil || info.SigningKey != abi.VcekReportSigner {
+		return
+	}
+	// Certificates that do not parse fail verification later with a better error.
+	cert, err := trust.ParseCert(chain.GetVcekCert())
+	if err != nil {
+		return
+	}
+	exts, err := kds.VcekCertificateExtensions(cert)
+	if err != nil || uint64(exts.TCBVersion) == report.GetReportedTcb() {
+		return
+	}
+	logger.Infof("VCEK certificate is for TCB %016x, not the reported TCB %016x. Replacing it",
+		uint64(exts.TCBVersion), report.GetReportedTcb())
+	chain.VcekCert = nil
+}
+
+// storeCerts saves the verified attestation's endorsement key, ASK, and ARK certificates in store.
+// Failure to store is not a verification failure, so it is only logged.
+func storeCerts(attestation *spb.Attestation, productLine string, key abi.ReportSigner, store trust.CertStore) {
+	chain := attestation.GetCertificateChain()
+	ek := chain.GetVcekCert()
+	var cspID string
+	if key == abi.VlekReportSigner {
+		ek = chain.GetVlekCert()
+		// The verified VLEK certificate names its CSP.
+		if cert, err := trust.ParseCert(ek); err == nil {
+			if exts, err := kds.VlekCertificateExtensions(cert); err == nil {
+				cspID = exts.CspID
+			}
+		}
+	}
+	ekKey, askKey, arkKey := storedCertKeys(attestation.GetReport(), productLine, cspID, key)
+	for storeKey, der := range map[string][]byte{ekKey: ek, askKey: chain.GetAskCert(), arkKey: chain.GetArkCert()} {
+		if len(der) == 0 || storeKey == "" {
+			continue
+		}
+		if stored, err := store.Load(storeKey); err == nil && bytes.Equal(stored, der) {
+			continue
+		}
+		if err := store.Store(storeKey, der); err != nil {
+			logger.Warningf("could not store certificate %s: %v", storeKey, err)
+		}
+	}
+}
+
 // GetAttestationFromReport uses AMD's Key Distribution Service (KDS) to download the certificate
 // chain for the VCEK that supposedly signed the given report, and returns the Attestation
 // representation of their combination. If getter is nil, uses Golang's http.Get.
@@ -890,7 +1434,7 @@ func GetAttestationFromReportContext(ctx context.Context, report *spb.Report, op
 	}
 	// Attempt to fill in the product field of the attestation. Don't error at this
 	// point since this is not validation.
-	info, _ := abi.ParseSignerInfo(report.SignerInfo)
+	info, _ := abi.ProtoSignerInfo(report)
 	var exts *kds.Extensions
 	parse := func(der []byte) *x509.Certificate {
 		out, _ := x509.ParseCertificate(der)
@@ -902,7 +1446,7 @@ func GetAttestationFromReportContext(ctx context.Context, report *spb.Report, op
 	case abi.VlekReportSigner:
 		exts, _ = kds.VlekCertificateExtensions(parse(result.CertificateChain.VlekCert))
 	}
-	if exts != nil && report.GetCpuid1EaxFms() == 0 {
+	if _, ok := abi.ReportCpuid1EaxFms(report); exts != nil && !ok {
 		product, _ := kds.ParseProductName(exts.ProductName, info.SigningKey)
 		setProduct(result, product)
 	}
@@ -918,7 +1462,7 @@ func SnpReport(report *spb.Report, options *Options) error {
 
 // SnpReportContext behaves like SnpReport but forwards the context to the HTTPSGetter.
 func SnpReportContext(ctx context.Context, report *spb.Report, options *Options) error {
-	if options.DisableCertFetching {
+	if options.DisableCertFetching && options.CertStore == nil {
 		return errors.New("cannot verify attestation report without fetching certificates")
 	}
 	attestation, err := GetAttestationFromReportContext(ctx, report, options)
@@ -17,17 +17,22 @@ package verify
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	_ "embed"
 	"encoding/asn1"
+	"encoding/binary"
 	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
 	"math/big"
 	"math/rand"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -42,6 +47,8 @@ import (
 	"github.com/google/go-sev-guest/verify/testdata"
 	"github.com/google/go-sev-guest/verify/trust"
 	"github.com/google/logger"
+	"go.uber.org/multierr"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
@@ -348,7 +355,7 @@ func TestKdsMetadataLogic(t *testing.T) {
 			options = &Options{Product: abi.DefaultSevProduct()}
 		}
 		vcekPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: newSigner.Vcek.Raw})
-		vcek, _, err := decodeCerts(&spb.CertificateChain{VcekCert: vcekPem, AskCert: newSigner.Ask.Raw, ArkCert: newSigner.Ark.Raw}, abi.VcekReportSigner, "", options)
+		vcek, _, err := decodeCerts(&spb.CertificateChain{VcekCert: vcekPem, AskCert: newSigner.Ask.Raw, ArkCert: newSigner.Ark.Raw}, abi.VcekReportSigner, "", options, nil)
 		if !test.Match(err, tc.wantErr) {
 			t.Errorf("%s: decodeCerts(...) = %+v, %v did not error as expected. Want %q", tc.name, vcek, err, tc.wantErr)
 		}
@@ -398,7 +405,9 @@ func TestCRLRootValidity(t *testing.T) {
 			{SerialNumber: big.NewInt(0), RevocationTime: afterCreation},
 			{SerialNumber: big.NewInt(0x8088), RevocationTime: afterCreation},
 		},
-		Number: big.NewInt(1),
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
 	}
 	root := trust.AMDRootCertsProduct(test.GetProductLine())
 	root.ProductCerts = &trust.ProductCerts{
@@ -444,6 +453,163 @@ func TestCRLRootValidity(t *testing.T) {
 	}
 }
 
+// crlGetter serves a CRL and counts how often it was fetched, or fails if down.
+type crlGetter struct {
+	crl     []byte
+	down    bool
+	fetches int
+}
+
+func (g *crlGetter) Get(string) ([]byte, error) {
+	if g.down {
+		return nil, fmt.Errorf("KDS unreachable")
+	}
+	g.fetches++
+	return g.crl, nil
+}
+
+func TestCRLCache(t *testing.T) {
+	signMu.Do(initSigner)
+	ClearCRLCache()
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	crlClock = func() time.Time { return now }
+	t.Cleanup(func() {
+		crlClock = time.Now
+		ClearCRLCache()
+	})
+	crl, err := x509.CreateRevocationList(insecureRandomness, &x509.RevocationList{
+		SignatureAlgorithm: x509.SHA384WithRSAPSS,
+		Number:             big.NewInt(1),
+		ThisUpdate:         now,
+		NextUpdate:         now.Add(time.Hour),
+	}, signer.Ark, signer.Keys.Ark)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := trust.AMDRootCertsProduct(test.GetProductLine())
+	root.ProductCerts = &trust.ProductCerts{Ark: signer.Ark, Ask: signer.Ask}
+	getter := &crlGetter{crl: crl}
+	opts := &Options{Getter: getter, Clock: crlClock, CRLMaxAge: 10 * time.Minute, CRLStaleGrace: 30 * time.Minute}
+	check := func(wantFetches int, wantErr bool) {
+		t.Helper()
+		// Use a fresh root each time, as verification of an attestation does.
+		r := trust.AMDRootCertsProduct(test.GetProductLine())
+		r.ProductCerts = root.ProductCerts
+		_, err := GetCrlAndCheckRoot(r, opts)
+		if (err != nil) != wantErr {
+			t.Errorf("GetCrlAndCheckRoot() at %v = _, %v. Want error: %t", now, err, wantErr)
+		}
+		if getter.fetches != wantFetches {
+			t.Errorf("GetCrlAndCheckRoot() at %v fetched the CRL %d times, want %d", now, getter.fetches, wantFetches)
+		}
+	}
+	check(1, false)
+	check(1, false)
+	// Past CRLMaxAge the CRL is fetched again.
+	now = now.Add(11 * time.Minute)
+	check(2, false)
+	// An unreachable KDS is tolerated within CRLStaleGrace of expiry, but not beyond it.
+	getter.down = true
+	now = now.Add(20 * time.Minute)
+	check(2, false)
+	now = now.Add(21 * time.Minute)
+	check(2, true)
+}
+
+func TestCRLWindow(t *testing.T) {
+	signMu.Do(initSigner)
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	otherIssuer := *signer.Ark
+	otherIssuer.RawSubject = signer.Ask.RawSubject
+	tcs := []struct {
+		name       string
+		thisUpdate time.Time
+		nextUpdate time.Time
+		issuer     *x509.Certificate
+		grace      time.Duration
+		wantErr    string
+	}{
+		{name: "current", thisUpdate: now.Add(-time.Hour), nextUpdate: now.Add(time.Hour)},
+		{name: "not yet valid", thisUpdate: now.Add(time.Minute), nextUpdate: now.Add(time.Hour), wantErr: "CRL is not valid until"},
+		{name: "expired", thisUpdate: now.Add(-2 * time.Hour), nextUpdate: now.Add(-time.Hour), wantErr: "CRL expired at"},
+		{name: "expired within grace", thisUpdate: now.Add(-2 * time.Hour), nextUpdate: now.Add(-time.Hour), grace: 2 * time.Hour},
+		{name: "no nextUpdate", wantErr: "CRL has no nextUpdate"},
+		{name: "wrong issuer", thisUpdate: now.Add(-time.Hour), nextUpdate: now.Add(time.Hour), issuer: &otherIssuer, wantErr: "is not the ARK"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			der, err := x509.CreateRevocationList(insecureRandomness, &x509.RevocationList{
+				SignatureAlgorithm: x509.SHA384WithRSAPSS,
+				Number:             big.NewInt(1),
+				ThisUpdate:         tc.thisUpdate,
+				NextUpdate:         tc.nextUpdate,
+			}, signer.Ark, signer.Keys.Ark)
+			if err != nil {
+				t.Fatal(err)
+			}
+			crl, err := x509.ParseRevocationList(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			issuer := signer.Ark
+			if tc.issuer != nil {
+				issuer = tc.issuer
+			}
+			r := trust.AMDRootCertsProduct(test.GetProductLine())
+			r.ProductCerts = &trust.ProductCerts{Ark: issuer, Ask: signer.Ask}
+			r.CRL = crl
+			if err := verifyCRL(r, &Options{Now: now, CRLStaleGrace: tc.grace}); !test.Match(err, tc.wantErr) {
+				t.Errorf("verifyCRL() = %v. Want error %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerificationClock(t *testing.T) {
+	signMu.Do(initSigner)
+	ClearCRLCache()
+	defer ClearCRLCache()
+	trust.ClearProductCertCache()
+	report, err := abi.ReportToProto(testdata.AttestationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getter := test.SimpleGetter(
+		map[string][]byte{
+			"https://kdsintf.amd.com/vcek/v1/Milan/cert_chain": trust.AskArkMilanVcekBytes,
+			"https://kdsintf.amd.com/vcek/v1/Milan/3ac3fe21e13fb0990eb28a802e3fb6a29483a6b0753590c951bdd3b8e53786184ca39e359669a2b76a1936776b564ea464cdce40c05f63c9b610c5068b006b5d?blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68": testdata.VcekBytes,
+		},
+	)
+	past := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	opts := &Options{Getter: getter, Clock: func() time.Time { return past }, Product: &spb.SevProduct{
+		Name:            spb.SevProduct_SEV_PRODUCT_MILAN,
+		MachineStepping: &wrapperspb.UInt32Value{Value: 0},
+	}}
+	if err := SnpAttestation(&spb.Attestation{Report: report}, opts); err == nil {
+		t.Errorf("SnpAttestation() at %v = nil, want a certificate validity error", past)
+	}
+
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	crl, err := x509.CreateRevocationList(insecureRandomness, &x509.RevocationList{
+		SignatureAlgorithm: x509.SHA384WithRSAPSS,
+		Number:             big.NewInt(1),
+		ThisUpdate:         now,
+		NextUpdate:         now.Add(time.Hour),
+	}, signer.Ark, signer.Keys.Ark)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := trust.AMDRootCertsProduct(test.GetProductLine())
+	root.ProductCerts = &trust.ProductCerts{Ark: signer.Ark, Ask: signer.Ask}
+	crlGetter := test.SimpleGetter(map[string][]byte{
+		fmt.Sprintf("https://kdsintf.amd.com/vcek/v1/%s/crl", test.GetProductLine()): crl,
+	})
+	wantErr := "CRL expired"
+	if _, err := GetCrlAndCheckRoot(root, &Options{Getter: crlGetter, Now: now.Add(2 * time.Hour)}); !test.Match(err, wantErr) {
+		t.Errorf("GetCrlAndCheckRoot() after the CRL's NextUpdate = %v, want %q", err, wantErr)
+	}
+}
+
 type reportGetter func(sg.QuoteProvider, [64]byte) (*spb.Attestation, error)
 type reportGetterProfile struct {
 	name           string
@@ -539,6 +705,55 @@ var snpAttestationFuncs = map[string]func(attestation *spb.Attestation, options
 	},
 }
 
+func TestFetchVlek(t *testing.T) {
+	if !sg.UseDefaultSevGuest() {
+		t.Skip("VLEK certificates are only known for the fake device")
+	}
+	trust.ClearProductCertCache()
+	var tc *test.TestCase
+	for _, c := range test.TestCases() {
+		if c.EK == test.KeyChoiceVlek {
+			tc = &c
+			break
+		}
+	}
+	if tc == nil {
+		t.Fatal("no VLEK test case")
+	}
+	providerCache := &providerCache{tcs: test.TestCases(), opts: &test.DeviceOptions{Now: time.Now()}}
+	pd := providerCache.forceProvider(t, fmsFromReport(t, tc.Output[:]))
+	device, ok := pd.qp.(*test.QuoteProvider)
+	if !ok {
+		t.Skip("not a fake quote provider")
+	}
+	attestation, err := sg.GetQuoteProto(pd.qp, tc.Input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation.GetCertificateChain().VlekCert = nil
+	productLine := kds.ProductLine(pd.opts.Product)
+	vlekURL := kds.VLEKCertURL(productLine, kds.TCBVersion(attestation.GetReport().GetReportedTcb()))
+	vlekGetter := test.SimpleGetter(map[string][]byte{vlekURL: device.Device.Signer.Vlek.Raw})
+
+	opts := *pd.opts
+	if err := SnpAttestation(proto.Clone(attestation).(*spb.Attestation), &opts); !errors.Is(err, ErrMissingVlek) {
+		t.Errorf("SnpAttestation() without VlekGetter = %v, want %v", err, ErrMissingVlek)
+	}
+	opts.VlekGetter = vlekGetter
+	if err := SnpAttestation(proto.Clone(attestation).(*spb.Attestation), &opts); err != nil {
+		t.Errorf("SnpAttestation() with VlekGetter = %v, want nil", err)
+	}
+	opts.CSPID = "go-sev-guest"
+	if err := SnpAttestation(proto.Clone(attestation).(*spb.Attestation), &opts); err != nil {
+		t.Errorf("SnpAttestation() with CSPID %q = %v, want nil", opts.CSPID, err)
+	}
+	opts.CSPID = "other-csp"
+	wantErr := `VLEK certificate CSP_ID is "go-sev-guest", want "other-csp"`
+	if err := SnpAttestation(proto.Clone(attestation).(*spb.Attestation), &opts); !test.Match(err, wantErr) {
+		t.Errorf("SnpAttestation() with CSPID %q = %v, want %q", opts.CSPID, err, wantErr)
+	}
+}
+
 func fmsFromReport(t testing.TB, report []byte) uint32 {
 	fms := abi.FmsToCpuid1Eax(report[0x188], report[0x189], report[0x18A])
 	if fms == 0 {
@@ -828,6 +1043,524 @@ func TestRealAttestationVerification(t *testing.T) {
 	}
 }
 
+func TestCertStoreAttestationVerification(t *testing.T) {
+	trust.ClearProductCertCache()
+	store, err := trust.NewFileCertStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	getter := test.SimpleGetter(
+		map[string][]byte{
+			"https://kdsintf.amd.com/vcek/v1/Milan/cert_chain": trust.AskArkMilanVcekBytes,
+			"https://kdsintf.amd.com/vcek/v1/Milan/3ac3fe21e13fb0990eb28a802e3fb6a29483a6b0753590c951bdd3b8e53786184ca39e359669a2b76a1936776b564ea464cdce40c05f63c9b610c5068b006b5d?blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68": testdata.VcekBytes,
+		},
+	)
+	product := &spb.SevProduct{
+		Name:            spb.SevProduct_SEV_PRODUCT_MILAN,
+		MachineStepping: &wrapperspb.UInt32Value{Value: 0},
+	}
+	if err := RawSnpReport(testdata.AttestationBytes, &Options{Getter: getter, Product: product, CertStore: store}); err != nil {
+		t.Fatalf("RawSnpReport() with a fetching getter = %v, want nil", err)
+	}
+	// The previous verification stored the certificates, so no fetching is needed.
+	trust.ClearProductCertCache()
+	opts := &Options{DisableCertFetching: true, Product: product, CertStore: store}
+	if err := RawSnpReport(testdata.AttestationBytes, opts); err != nil {
+		t.Errorf("RawSnpReport() from the certificate store = %v, want nil", err)
+	}
+	opts.CertStore, err = trust.NewFileCertStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RawSnpReport(testdata.AttestationBytes, opts); err == nil {
+		t.Error("RawSnpReport() from an empty certificate store = nil, want error")
+	}
+}
+
+func TestTCBMismatchedVcek(t *testing.T) {
+	signMu.Do(initSigner)
+	trust.ClearProductCertCache()
+	report, err := abi.ReportToProto(testdata.AttestationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	product := &spb.SevProduct{
+		Name:            spb.SevProduct_SEV_PRODUCT_MILAN,
+		MachineStepping: &wrapperspb.UInt32Value{Value: 0},
+	}
+	// The host supplies a VCEK for a different TCB than the report's.
+	attestation := func() *spb.Attestation {
+		return &spb.Attestation{
+			Report:           report,
+			CertificateChain: &spb.CertificateChain{VcekCert: signer.Vcek.Raw},
+		}
+	}
+	store := &trust.MemoryCertStore{}
+	if err := SnpAttestation(attestation(), &Options{DisableCertFetching: true, Product: product, CertStore: store}); err == nil {
+		t.Error("SnpAttestation() without the reported TCB's VCEK = nil, want error")
+	}
+	tcb := kds.TCBVersion(report.GetReportedTcb())
+	for key, der := range map[string][]byte{
+		trust.VcekStoreKey("Milan", report.GetChipId(), tcb):   testdata.VcekBytes,
+		trust.AskStoreKey("Milan", abi.VcekReportSigner):       trust.DefaultRootCerts["Milan"].ProductCerts.Ask.Raw,
+		trust.ArkStoreKey("Milan", abi.VcekReportSigner):       trust.DefaultRootCerts["Milan"].ProductCerts.Ark.Raw,
+		trust.VcekStoreKey("Milan", report.GetChipId(), tcb+1): signer.Vcek.Raw,
+	} {
+		if err := store.Store(key, der); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := attestation()
+	if err := SnpAttestation(a, &Options{DisableCertFetching: true, Product: product, CertStore: store}); err != nil {
+		t.Fatalf("SnpAttestation() with the reported TCB's VCEK stored = %v, want nil", err)
+	}
+	if !bytes.Equal(a.GetCertificateChain().GetVcekCert(), testdata.VcekBytes) {
+		t.Error("SnpAttestation() did not select the VCEK for the reported TCB")
+	}
+}
+
+func TestBundle(t *testing.T) {
+	trust.ClearProductCertCache()
+	getter := test.SimpleGetter(
+		map[string][]byte{
+			"https://kdsintf.amd.com/vcek/v1/Milan/cert_chain": trust.AskArkMilanVcekBytes,
+			"https://kdsintf.amd.com/vcek/v1/Milan/3ac3fe21e13fb0990eb28a802e3fb6a29483a6b0753590c951bdd3b8e53786184ca39e359669a2b76a1936776b564ea464cdce40c05f63c9b610c5068b006b5d?blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68": testdata.VcekBytes,
+		},
+	)
+	product := &spb.SevProduct{
+		Name:            spb.SevProduct_SEV_PRODUCT_MILAN,
+		MachineStepping: &wrapperspb.UInt32Value{Value: 0},
+	}
+	report, err := abi.ReportToProto(testdata.AttestationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := CreateBundle(&spb.Attestation{Report: report}, &Options{Getter: getter, Product: product})
+	if err != nil {
+		t.Fatalf("CreateBundle() = _, %v, want nil", err)
+	}
+	data, err := bundle.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() = _, %v, want nil", err)
+	}
+	got, err := UnmarshalBundle(data)
+	if err != nil {
+		t.Fatalf("UnmarshalBundle() = _, %v, want nil", err)
+	}
+	if !got.Timestamp.Equal(bundle.Timestamp) {
+		t.Errorf("UnmarshalBundle() timestamp = %v, want %v", got.Timestamp, bundle.Timestamp)
+	}
+	trust.ClearProductCertCache()
+	if err := SnpBundle(got, &Options{Product: product}); err != nil {
+		t.Errorf("SnpBundle() = %v, want nil", err)
+	}
+	if res, err := SnpBundleWithResult(got, &Options{Product: product}); err != nil || !res.Passed() {
+		t.Errorf("SnpBundleWithResult() = %v, %v, want a passing result", res, err)
+	}
+	wantErr := "bundle has no CRL"
+	if err := SnpBundle(got, &Options{Product: product, CheckRevocations: true}); !test.Match(err, wantErr) {
+		t.Errorf("SnpBundle() with CheckRevocations = %v, want %q", err, wantErr)
+	}
+	got.Attestation.CertificateChain.VcekCert = nil
+	if err := SnpBundle(got, &Options{Product: product}); err == nil {
+		t.Error("SnpBundle() without a VCEK = nil, want error")
+	}
+	if _, err := UnmarshalBundle([]byte("not a tar archive")); err == nil {
+		t.Error("UnmarshalBundle() of garbage = nil, want error")
+	}
+}
+
+// crlOverlayGetter serves a CRL for CRL URLs and passes other requests on.
+type crlOverlayGetter struct {
+	crl  []byte
+	base trust.HTTPSGetter
+}
+
+func (g *crlOverlayGetter) Get(url string) ([]byte, error) {
+	if strings.HasSuffix(url, "/crl") {
+		return g.crl, nil
+	}
+	return g.base.Get(url)
+}
+
+func TestBundleCRL(t *testing.T) {
+	if !sg.UseDefaultSevGuest() {
+		t.Skip("Test certificates cannot sign hardware reports")
+	}
+	trust.ClearProductCertCache()
+	ClearCRLCache()
+	t.Cleanup(ClearCRLCache)
+	now := time.Now()
+	s, err := test.DefaultTestOnlyCertChain(test.GetProductName(), now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := test.TestCases()
+	qp, roots, _, kdsGetter := testclient.GetSevQuoteProvider(tests, &test.DeviceOptions{Now: now, Signer: s}, t)
+	raw, err := qp.GetRawQuote(tests[0].Input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation, err := abi.ReportCertsToProto(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCRL := func(number int64, thisUpdate, nextUpdate time.Time, revokeAsk bool) []byte {
+		t.Helper()
+		template := &x509.RevocationList{
+			SignatureAlgorithm: x509.SHA384WithRSAPSS,
+			Number:             big.NewInt(number),
+			ThisUpdate:         thisUpdate,
+			NextUpdate:         nextUpdate,
+		}
+		if revokeAsk {
+			template.RevokedCertificateEntries = []x509.RevocationListEntry{{SerialNumber: s.Ask.SerialNumber, RevocationTime: thisUpdate}}
+		}
+		crl, err := x509.CreateRevocationList(insecureRandomness, template, s.Ark, s.Keys.Ark)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crl
+	}
+	product := abi.DefaultSevProduct()
+	// An online check caches a current CRL and sets it on the shared roots.
+	online := &Options{
+		TrustedRoots:     roots,
+		Getter:           &crlOverlayGetter{crl: newCRL(2, now.Add(-time.Minute), now.Add(time.Hour), false), base: kdsGetter},
+		CheckRevocations: true,
+		Product:          product,
+	}
+	if err := SnpAttestation(proto.Clone(attestation).(*spb.Attestation), online); err != nil {
+		t.Fatalf("SnpAttestation() online = %v, want nil", err)
+	}
+
+	bundle := func(crl []byte) *Bundle {
+		return &Bundle{Attestation: proto.Clone(attestation).(*spb.Attestation), CRL: crl, Timestamp: now.Add(-2 * time.Hour)}
+	}
+	offline := &Options{TrustedRoots: roots, CheckRevocations: true, Product: product}
+	atTimestamp := func(b *Bundle) *Options {
+		o := *offline
+		o.Now = b.Timestamp
+		return &o
+	}
+	tcs := []struct {
+		name    string
+		bundle  *Bundle
+		opts    func(*Bundle) *Options
+		wantErr string
+	}{
+		{
+			name:   "own CRL at its timestamp",
+			bundle: bundle(newCRL(1, now.Add(-3*time.Hour), now.Add(time.Hour), false)),
+			opts:   atTimestamp,
+		},
+		{
+			name:   "own CRL now",
+			bundle: bundle(newCRL(1, now.Add(-3*time.Hour), now.Add(time.Hour), false)),
+		},
+		{
+			name:    "own CRL revokes the ASK",
+			bundle:  bundle(newCRL(1, now.Add(-3*time.Hour), now.Add(time.Hour), true)),
+			wantErr: "ASK was revoked",
+		},
+		{
+			name:    "expired CRL with an old timestamp",
+			bundle:  bundle(newCRL(1, now.Add(-3*time.Hour), now.Add(-time.Hour), false)),
+			wantErr: "CRL expired",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := offline
+			if tc.opts != nil {
+				opts = tc.opts(tc.bundle)
+			}
+			if err := SnpBundle(tc.bundle, opts); !test.Match(err, tc.wantErr) {
+				t.Errorf("SnpBundle() = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+	// The bundles' CRLs neither replaced the cached CRL nor the roots' CRL.
+	for _, r := range roots[test.GetProductLine()] {
+		if r.CRL == nil || r.CRL.Number.Int64() != 2 {
+			t.Errorf("root CRL = %v after bundle verification, want the online CRL", r.CRL)
+		}
+	}
+	for _, url := range s.Ask.CRLDistributionPoints {
+		if crl := cachedCRLFor(roots[test.GetProductLine()][0], url, online, false); crl != nil && crl.Number.Int64() != 2 {
+			t.Errorf("cached CRL for %s is number %v after bundle verification, want 2", url, crl.Number)
+		}
+	}
+}
+
+func TestSnpAttestationWithResult(t *testing.T) {
+	trust.ClearProductCertCache()
+	getter := test.SimpleGetter(
+		map[string][]byte{
+			"https://kdsintf.amd.com/vcek/v1/Milan/cert_chain": trust.AskArkMilanVcekBytes,
+			"https://kdsintf.amd.com/vcek/v1/Milan/3ac3fe21e13fb0990eb28a802e3fb6a29483a6b0753590c951bdd3b8e53786184ca39e359669a2b76a1936776b564ea464cdce40c05f63c9b610c5068b006b5d?blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68": testdata.VcekBytes,
+		},
+	)
+	tcs := []struct {
+		name     string
+		stepping uint32
+		want     []*CheckResult
+	}{
+		{
+			name: "happy path",
+			want: []*CheckResult{
+				{Check: CheckCertificateFetch, Passed: true},
+				{Check: CheckReportFormat, Passed: true},
+				{Check: CheckExtensions, Passed: true},
+				{Check: CheckCertChain, Passed: true},
+				{Check: CheckRevocation, Skipped: true},
+				{Check: CheckSignature, Passed: true},
+			},
+		},
+		{
+			name:     "bad vcek stepping",
+			stepping: 12,
+			// The v2 report's product is checked against the fetched VCEK.
+			want: []*CheckResult{
+				{Check: CheckCertificateFetch, Detail: "expected product stepping 12, got 0"},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := abi.ReportToProto(testdata.AttestationBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := &Options{Getter: getter, Product: &spb.SevProduct{
+				Name:            spb.SevProduct_SEV_PRODUCT_MILAN,
+				MachineStepping: &wrapperspb.UInt32Value{Value: tc.stepping},
+			}}
+			res, err := SnpAttestationWithResult(&spb.Attestation{Report: report}, opts)
+			if (err == nil) != res.Passed() {
+				t.Errorf("SnpAttestationWithResult() = %v, %v. Want Passed() to match the error", res, err)
+			}
+			if diff := cmp.Diff(res.Checks, tc.want); diff != "" {
+				t.Errorf("SnpAttestationWithResult() checks differ: %s", diff)
+			}
+		})
+	}
+}
+
+// hangingGetter blocks in Get until it is closed.
+type hangingGetter chan struct{}
+
+func (h hangingGetter) Get(string) ([]byte, error) {
+	<-h
+	return nil, errors.New("unblocked")
+}
+
+func TestCertFetchTimeout(t *testing.T) {
+	trust.ClearProductCertCache()
+	unblock := make(chan struct{})
+	defer close(unblock)
+	report, err := abi.ReportToProto(testdata.AttestationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &Options{Getter: hangingGetter(unblock), CertFetchTimeout: 10 * time.Millisecond}
+	wantErr := context.DeadlineExceeded.Error()
+	if err := SnpAttestation(&spb.Attestation{Report: report}, opts); !test.Match(err, wantErr) {
+		t.Errorf("SnpAttestation() with a hung KDS = %v, want %q", err, wantErr)
+	}
+}
+
+func TestSnpAttestations(t *testing.T) {
+	trust.ClearProductCertCache()
+	// Each certificate may only be fetched once for the whole batch.
+	getter := &test.Getter{
+		Responses: map[string][]test.GetResponse{
+			"https://kdsintf.amd.com/vcek/v1/Milan/cert_chain": {{Occurrences: 1, Body: trust.AskArkMilanVcekBytes}},
+			"https://kdsintf.amd.com/vcek/v1/Milan/3ac3fe21e13fb0990eb28a802e3fb6a29483a6b0753590c951bdd3b8e53786184ca39e359669a2b76a1936776b564ea464cdce40c05f63c9b610c5068b006b5d?blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68": {{Occurrences: 1, Body: testdata.VcekBytes}},
+		},
+	}
+	var attestations []*spb.Attestation
+	for i := 0; i < 8; i++ {
+		report, err := abi.ReportToProto(testdata.AttestationBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attestations = append(attestations, &spb.Attestation{Report: report})
+	}
+	attestations = append(attestations, nil)
+	opts := &Options{Getter: getter, Product: &spb.SevProduct{
+		Name:            spb.SevProduct_SEV_PRODUCT_MILAN,
+		MachineStepping: &wrapperspb.UInt32Value{Value: 0},
+	}}
+	errs := SnpAttestations(attestations, opts, 4)
+	if len(errs) != len(attestations) {
+		t.Fatalf("SnpAttestations() returned %d errors, want %d", len(errs), len(attestations))
+	}
+	for i, err := range errs[:len(errs)-1] {
+		if err != nil {
+			t.Errorf("SnpAttestations() error %d = %v, want nil", i, err)
+		}
+	}
+	if errs[len(errs)-1] == nil {
+		t.Error("SnpAttestations() error for a nil attestation = nil, want error")
+	}
+}
+
+func TestGetterMirrors(t *testing.T) {
+	mirrors := []string{"https://kds-mirror.example.com/amd"}
+	inner := &test.Getter{}
+	retry := &trust.RetryHTTPSGetter{Timeout: time.Minute, Getter: inner}
+	opts := &Options{Getter: retry, KDSMirrors: mirrors}
+	got, ok := opts.getter().(*trust.RetryHTTPSGetter)
+	if !ok || got == retry || got.Timeout != retry.Timeout {
+		t.Fatalf("getter() = %v, want a copy of the RetryHTTPSGetter", opts.getter())
+	}
+	if mirror, ok := got.Getter.(*trust.MirrorHTTPSGetter); !ok || mirror.Getter != inner || !mirror.FallbackToKDS {
+		t.Errorf("getter().Getter = %v, want the mirrors within the retries", got.Getter)
+	}
+	if retry.Getter != inner {
+		t.Errorf("getter() changed Options.Getter to %v", retry.Getter)
+	}
+	backoff, ok := (&Options{Getter: &trust.BackoffHTTPSGetter{}, KDSMirrors: mirrors}).getter().(*trust.BackoffHTTPSGetter)
+	if !ok {
+		t.Fatal("getter() of a BackoffHTTPSGetter is not a BackoffHTTPSGetter")
+	}
+	if mirror, ok := backoff.Getter.(*trust.MirrorHTTPSGetter); !ok || mirror.Getter == nil {
+		t.Errorf("getter().Getter = %v, want the mirrors within the backoff", backoff.Getter)
+	}
+	if got := (&Options{Getter: inner, KDSMirrors: mirrors}).getter(); got.(*trust.MirrorHTTPSGetter).Getter != inner {
+		t.Errorf("getter() = %v, want the mirrors around the Getter", got)
+	}
+}
+
+func TestTrustAnchors(t *testing.T) {
+	getter := test.SimpleGetter(
+		map[string][]byte{
+			"https://kdsintf.amd.com/vcek/v1/Milan/cert_chain": trust.AskArkMilanVcekBytes,
+			"https://kdsintf.amd.com/vcek/v1/Milan/3ac3fe21e13fb0990eb28a802e3fb6a29483a6b0753590c951bdd3b8e53786184ca39e359669a2b76a1936776b564ea464cdce40c05f63c9b610c5068b006b5d?blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68": testdata.VcekBytes,
+		},
+	)
+	milanArk := trust.DefaultRootCerts["Milan"].ProductCerts.Ark
+	genoaArk := trust.DefaultRootCerts["Genoa"].ProductCerts.Ark
+	pool := func(cert *x509.Certificate) *x509.CertPool {
+		p := x509.NewCertPool()
+		p.AddCert(cert)
+		return p
+	}
+	tcs := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{name: "SPKI pin", opts: Options{ArkSPKIPins: [][32]byte{sha256.Sum256(milanArk.RawSubjectPublicKeyInfo)}, DisableEmbeddedRoots: true}},
+		{name: "wrong SPKI pin", opts: Options{ArkSPKIPins: [][32]byte{sha256.Sum256(genoaArk.RawSubjectPublicKeyInfo)}}, wantErr: "matches no SPKI pin"},
+		{name: "ARK pool", opts: Options{TrustedArks: pool(milanArk), DisableEmbeddedRoots: true}},
+		{name: "wrong ARK pool", opts: Options{TrustedArks: pool(genoaArk)}, wantErr: "not in the trusted ARK pool"},
+		{name: "no anchors", opts: Options{DisableEmbeddedRoots: true}, wantErr: "no trust anchors are configured"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			trust.ClearProductCertCache()
+			report, err := abi.ReportToProto(testdata.AttestationBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := tc.opts
+			opts.Getter = getter
+			opts.Product = &spb.SevProduct{
+				Name:            spb.SevProduct_SEV_PRODUCT_MILAN,
+				MachineStepping: &wrapperspb.UInt32Value{Value: 0},
+			}
+			if err := SnpAttestation(&spb.Attestation{Report: report}, &opts); !test.Match(err, tc.wantErr) {
+				t.Errorf("SnpAttestation() = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestAllowedSigners(t *testing.T) {
+	trust.ClearProductCertCache()
+	getter := test.SimpleGetter(
+		map[string][]byte{
+			"https://kdsintf.amd.com/vcek/v1/Milan/cert_chain": trust.AskArkMilanVcekBytes,
+			"https://kdsintf.amd.com/vcek/v1/Milan/3ac3fe21e13fb0990eb28a802e3fb6a29483a6b0753590c951bdd3b8e53786184ca39e359669a2b76a1936776b564ea464cdce40c05f63c9b610c5068b006b5d?blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68": testdata.VcekBytes,
+		},
+	)
+	tcs := []struct {
+		name    string
+		allowed []abi.ReportSigner
+		wantErr string
+	}{
+		{name: "any"},
+		{name: "VCEK only", allowed: []abi.ReportSigner{abi.VcekReportSigner}},
+		{name: "VLEK only", allowed: []abi.ReportSigner{abi.VlekReportSigner}, wantErr: "report is signed by the VCEK, but only [VLEK] signatures are allowed"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := abi.ReportToProto(testdata.AttestationBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := &Options{Getter: getter, AllowedSigners: tc.allowed, Product: &spb.SevProduct{
+				Name:            spb.SevProduct_SEV_PRODUCT_MILAN,
+				MachineStepping: &wrapperspb.UInt32Value{Value: 0},
+			}}
+			if err := SnpAttestation(&spb.Attestation{Report: report}, opts); !test.Match(err, tc.wantErr) {
+				t.Errorf("SnpAttestation() = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// recordingCrypto counts the checks delegated to it, and fails them if reject is set.
+type recordingCrypto struct {
+	GoCrypto
+	reject       bool
+	reports      int
+	certificates int
+}
+
+func (c *recordingCrypto) VerifyECDSAP384SHA384(key *ecdsa.PublicKey, message, signature []byte) error {
+	c.reports++
+	if c.reject {
+		return errors.New("rejected")
+	}
+	return c.GoCrypto.VerifyECDSAP384SHA384(key, message, signature)
+}
+
+func (c *recordingCrypto) CheckCertificateSignature(cert, issuer *x509.Certificate) error {
+	c.certificates++
+	return c.GoCrypto.CheckCertificateSignature(cert, issuer)
+}
+
+func TestCryptoBackend(t *testing.T) {
+	trust.ClearProductCertCache()
+	getter := test.SimpleGetter(
+		map[string][]byte{
+			"https://kdsintf.amd.com/vcek/v1/Milan/cert_chain": trust.AskArkMilanVcekBytes,
+			"https://kdsintf.amd.com/vcek/v1/Milan/3ac3fe21e13fb0990eb28a802e3fb6a29483a6b0753590c951bdd3b8e53786184ca39e359669a2b76a1936776b564ea464cdce40c05f63c9b610c5068b006b5d?blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68": testdata.VcekBytes,
+		},
+	)
+	for _, reject := range []bool{false, true} {
+		report, err := abi.ReportToProto(testdata.AttestationBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backend := &recordingCrypto{reject: reject}
+		opts := &Options{Getter: getter, Crypto: backend, Product: &spb.SevProduct{
+			Name:            spb.SevProduct_SEV_PRODUCT_MILAN,
+			MachineStepping: &wrapperspb.UInt32Value{Value: 0},
+		}}
+		err = SnpAttestation(&spb.Attestation{Report: report}, opts)
+		if (err != nil) != reject {
+			t.Errorf("SnpAttestation() with a backend rejecting %t = %v", reject, err)
+		}
+		if backend.reports != 1 || backend.certificates != 3 {
+			t.Errorf("SnpAttestation() delegated %d report and %d certificate checks, want 1 and 3", backend.reports, backend.certificates)
+		}
+	}
+}
+
 func TestKDSCertBackdated(t *testing.T) {
 	if !test.TestUseKDS() {
 		t.Skip()
@@ -911,3 +1644,168 @@ func TestV3KDSProduct(t *testing.T) {
 		t.Errorf("missed Genoa case")
 	}
 }
+
+func TestReportProductLine(t *testing.T) {
+	genoa := &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_GENOA}
+	tcs := []struct {
+		name        string
+		report      *spb.Report
+		product     *spb.SevProduct
+		want        string
+		wantProduct spb.SevProduct_SevProductName
+		wantErr     string
+	}{
+		{
+			name:   "v2 report",
+			report: &spb.Report{Version: 2},
+		},
+		{
+			name:        "Turin inferred",
+			report:      &spb.Report{Version: 3, Cpuid1EaxFms: 0x00b00f21},
+			want:        "Turin",
+			wantProduct: spb.SevProduct_SEV_PRODUCT_TURIN,
+		},
+		{
+			name:        "Genoa expected",
+			report:      &spb.Report{Version: 3, Cpuid1EaxFms: 0x00a10f10},
+			product:     genoa,
+			want:        "Genoa",
+			wantProduct: spb.SevProduct_SEV_PRODUCT_GENOA,
+		},
+		{
+			name:    "Turin expected Genoa",
+			report:  &spb.Report{Version: 3, Cpuid1EaxFms: 0x00b00f21},
+			product: genoa,
+			wantErr: "expected product name SEV_PRODUCT_GENOA, got SEV_PRODUCT_TURIN",
+		},
+		{
+			name:   "unknown product",
+			report: &spb.Report{Version: 3, Cpuid1EaxFms: 0x00c00f00},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			options := &Options{}
+			if tc.product != nil {
+				options.Product = proto.Clone(tc.product).(*spb.SevProduct)
+			}
+			got, err := reportProductLine(tc.report, options)
+			if !test.Match(err, tc.wantErr) {
+				t.Fatalf("reportProductLine() = _, %v. Want error %q", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("reportProductLine() = %q, want %q", got, tc.want)
+			}
+			if tc.wantErr == "" && tc.want != "" && options.Product.GetName() != tc.wantProduct {
+				t.Errorf("options.Product = %v, want %v", options.Product, tc.wantProduct)
+			}
+		})
+	}
+}
+
+func hclReport(report, claims []byte, hashType abi.HclHashType) []byte {
+	header := make([]byte, abi.HclHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:4], abi.HclSignature)
+	runtimeData := make([]byte, abi.HclRuntimeDataHeaderSize)
+	binary.LittleEndian.PutUint32(runtimeData[0:4], uint32(abi.HclRuntimeDataHeaderSize+len(claims)))
+	binary.LittleEndian.PutUint32(runtimeData[8:12], abi.HclReportTypeSnp)
+	binary.LittleEndian.PutUint32(runtimeData[12:16], uint32(hashType))
+	binary.LittleEndian.PutUint32(runtimeData[16:20], uint32(len(claims)))
+	return bytes.Join([][]byte{header, report, runtimeData, claims}, nil)
+}
+
+func TestHCLReport(t *testing.T) {
+	claims := []byte(`{"keys":[{"kid":"HCLAkPub","kty":"RSA","e":"AQAB","n":"abcd"}],"user-data":"0102"}`)
+	digest := sha256.Sum256(claims)
+	reportData := make([]byte, abi.ReportDataSize)
+	copy(reportData, digest[:])
+	tcs := []struct {
+		name       string
+		reportData []byte
+		hashType   abi.HclHashType
+		nonce      []byte
+		wantErr    string
+	}{
+		{name: "bound", reportData: reportData, hashType: abi.HclHashSHA256},
+		{name: "bound with nonce", reportData: reportData, hashType: abi.HclHashSHA256, nonce: []byte{1, 2}},
+		{name: "wrong nonce", reportData: reportData, hashType: abi.HclHashSHA256, nonce: []byte{3}, wantErr: "is not the expected nonce"},
+		{name: "wrong hash type", reportData: reportData, hashType: abi.HclHashSHA384, wantErr: "does not bind"},
+		{name: "unknown hash type", reportData: reportData, hashType: 7, wantErr: "unknown HCL runtime data hash type 7"},
+		{name: "unbound", reportData: make([]byte, abi.ReportDataSize), hashType: abi.HclHashSHA256, wantErr: "does not bind"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := checkHCLBinding(tc.reportData, &abi.HclReport{HashType: tc.hashType, RuntimeClaims: claims}, tc.nonce)
+			if !test.Match(err, tc.wantErr) {
+				t.Fatalf("checkHCLBinding() = _, %v. Want error %q", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if key := got.Key("HCLAkPub"); key == nil || key.N != "abcd" {
+				t.Errorf("checkHCLBinding() = %v, want the HCLAkPub key", got)
+			}
+		})
+	}
+	// The real report's REPORT_DATA does not bind these claims.
+	if _, err := SnpHCLReport(hclReport(testdata.AttestationBytes, claims, abi.HclHashSHA256), nil, &Options{}); !test.Match(err, "does not bind") {
+		t.Errorf("SnpHCLReport() = _, %v, want a binding error", err)
+	}
+}
+
+func TestCollectAllFailures(t *testing.T) {
+	signMu.Do(initSigner)
+	report, err := abi.ReportToProto(testdata.AttestationBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake VCEK is for another product and did not sign the report.
+	attestation := func() *spb.Attestation {
+		return &spb.Attestation{
+			Report: report,
+			CertificateChain: &spb.CertificateChain{
+				VcekCert: signer.Vcek.Raw,
+				AskCert:  signer.Ask.Raw,
+				ArkCert:  signer.Ark.Raw,
+			},
+		}
+	}
+	genoa := func() *spb.SevProduct { return &spb.SevProduct{Name: spb.SevProduct_SEV_PRODUCT_GENOA} }
+	opts := &Options{DisableCertFetching: true, Product: genoa()}
+	res, err := SnpAttestationWithResult(attestation(), opts)
+	if err == nil || len(multierr.Errors(err)) != 1 {
+		t.Fatalf("SnpAttestationWithResult() = _, %v, want one error", err)
+	}
+	if res.Check(CheckSignature) != nil {
+		t.Errorf("SnpAttestationWithResult() checked the signature after a failure")
+	}
+
+	opts = &Options{DisableCertFetching: true, Product: genoa(), CollectAllFailures: true}
+	res, err = SnpAttestationWithResult(attestation(), opts)
+	if got := len(multierr.Errors(err)); got != 2 {
+		t.Fatalf("SnpAttestationWithResult() with CollectAllFailures = _, %v, want 2 errors", err)
+	}
+	for _, check := range []CheckName{CheckExtensions, CheckSignature} {
+		if c := res.Check(check); c == nil || c.Passed {
+			t.Errorf("SnpAttestationWithResult() check %s = %v, want a failure", check, c)
+		}
+	}
+	// The chain check depends on the product in the certificate extensions.
+	if c := res.Check(CheckCertChain); c != nil {
+		t.Errorf("SnpAttestationWithResult() check %s = %v, want it absent", CheckCertChain, c)
+	}
+}
+
+func TestStoredVlekCertKey(t *testing.T) {
+	report := &spb.Report{ReportedTcb: 0x1234}
+	if ek, _, _ := storedCertKeys(report, "Milan", "", abi.VlekReportSigner); ek != "" {
+		t.Errorf("storedCertKeys(no CSP_ID) VLEK key = %q, want none", ek)
+	}
+	want := trust.VlekStoreKey("Milan", "CSP-A", 0x1234)
+	if ek, _, _ := storedCertKeys(report, "Milan", "CSP-A", abi.VlekReportSigner); ek != want {
+		t.Errorf("storedCertKeys(CSP-A) VLEK key = %q, want %q", ek, want)
+	}
+	if other := trust.VlekStoreKey("Milan", "CSP-B", 0x1234); other == want {
+		t.Errorf("VlekStoreKey() = %q for both CSP-A and CSP-B", want)
+	}
+}